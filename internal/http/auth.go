@@ -0,0 +1,271 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"bankapp/internal/service"
+	"bankapp/internal/storage"
+)
+
+var adminConfig = struct {
+	Token string // пустой — админ-эндпоинты выключены: общеизвестного токена по умолчанию нет
+}{
+	Token: os.Getenv("BANKAPP_ADMIN_TOKEN"),
+}
+
+var authConfig = struct {
+	RequireToken bool // при false запросы без токена обслуживаются как раньше, scope проверяются только у предъявленных токенов
+}{
+	RequireToken: os.Getenv("BANKAPP_REQUIRE_TOKEN") == "true",
+}
+
+var partnerAuthConfig = struct {
+	Enabled      bool
+	ReplayWindow time.Duration
+}{
+	Enabled:      true,
+	ReplayWindow: 5 * time.Minute,
+}
+
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminConfig.Token == "" {
+			respondError(w, http.StatusForbidden, "Admin API is disabled: BANKAPP_ADMIN_TOKEN is not set")
+			return
+		}
+		token := r.Header.Get("X-Admin-Token")
+		if token == "" || !hmac.Equal([]byte(token), []byte(adminConfig.Token)) {
+			respondError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+type merchantContextKey struct{}
+
+func merchantFromContext(ctx context.Context) storage.Merchant {
+	merchant, _ := ctx.Value(merchantContextKey{}).(storage.Merchant)
+	return merchant
+}
+
+// merchantOnly пропускает запросы с действующим ключом мерчанта в X-Merchant-Key
+func (h *Handler) merchantOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Merchant-Key")
+		if key == "" {
+			respondError(w, http.StatusUnauthorized, "Merchant key is required")
+			return
+		}
+		merchant, err := h.svc.AuthenticateMerchant(r.Context(), key, time.Now())
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, fmt.Sprintf("Merchant authentication failed: %v", err))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), merchantContextKey{}, merchant)))
+	}
+}
+
+func (h *Handler) verifyPartnerRequest(r *http.Request) (storage.APIClient, error) {
+	ctx := r.Context()
+	clientID := r.Header.Get("X-Client-ID")
+	timestamp := r.Header.Get("X-Timestamp")
+	signature := r.Header.Get("X-Signature")
+	if timestamp == "" || signature == "" {
+		return storage.APIClient{}, errors.New("missing X-Timestamp or X-Signature header")
+	}
+
+	client, ok := h.svc.GetAPIClient(ctx, clientID)
+	if !ok || !client.Active {
+		return storage.APIClient{}, errors.New("unknown or inactive API client")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return storage.APIClient{}, errors.New("invalid X-Timestamp header")
+	}
+	sentAt := time.Unix(unix, 0)
+	if skew := time.Since(sentAt); skew > partnerAuthConfig.ReplayWindow || skew < -partnerAuthConfig.ReplayWindow {
+		return storage.APIClient{}, errors.New("request timestamp outside of allowed window")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return storage.APIClient{}, errors.New("failed to read request body")
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := service.SignPartnerRequest(client.Secret, timestamp, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return storage.APIClient{}, errors.New("invalid request signature")
+	}
+	if !h.svc.RememberSignature(ctx, client.ID+":"+signature, time.Now(), 2*partnerAuthConfig.ReplayWindow) {
+		return storage.APIClient{}, errors.New("replayed request")
+	}
+	return client, nil
+}
+
+// partnerAuthMiddleware проверяет HMAC-подпись, если запрос пришёл от зарегистрированного API-клиента
+func (h *Handler) partnerAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !partnerAuthConfig.Enabled || r.Header.Get("X-Client-ID") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client, err := h.verifyPartnerRequest(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, fmt.Sprintf("Partner authentication failed: %v", err))
+			return
+		}
+		log.Printf("Partner request authenticated: client %s (%s)", client.ID, client.Name)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) recordSecurityEvent(r *http.Request, userID, eventType string, details map[string]string) {
+	ctx := r.Context()
+	h.svc.AddSecurityEvent(ctx, storage.SecurityEvent{
+		ID:        storage.GenerateID(),
+		UserID:    userID,
+		Type:      eventType,
+		Timestamp: time.Now(),
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Details:   details,
+	})
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (h *Handler) sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			// Ключ API заменяет токен сессии: из него собирается сессия с scope ключа
+			if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+				session, err := h.svc.AuthenticateAPIKey(r.Context(), apiKey, time.Now())
+				if err != nil {
+					respondError(w, http.StatusUnauthorized, "Invalid or revoked API key")
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		session, ok := h.svc.GetSessionByToken(r.Context(), token)
+		if !ok || session.Revoked {
+			respondError(w, http.StatusUnauthorized, "Invalid or revoked session")
+			return
+		}
+		now := time.Now()
+		if session.ExpiresAt != nil && now.After(*session.ExpiresAt) {
+			respondError(w, http.StatusUnauthorized, "Access token expired")
+			return
+		}
+		h.svc.TouchSession(r.Context(), session.ID, now)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+	})
+}
+
+type sessionContextKey struct{}
+
+func sessionFromContext(ctx context.Context) (storage.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey{}).(storage.Session)
+	return session, ok
+}
+
+// sessionUserID — пользователь сессии запроса; пусто, если запрос без токена
+func sessionUserID(ctx context.Context) string {
+	if session, ok := sessionFromContext(ctx); ok {
+		return session.UserID
+	}
+	return ""
+}
+
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessionFromContext(r.Context())
+		if !ok {
+			if authConfig.RequireToken {
+				respondError(w, http.StatusUnauthorized, "Access token is required")
+				return
+			}
+			next(w, r)
+			return
+		}
+		if !session.HasScope(scope) {
+			respondError(w, http.StatusForbidden, fmt.Sprintf("Token lacks required scope %s", scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+type organizationContextKey struct{}
+
+func organizationFromContext(ctx context.Context) storage.Organization {
+	org, _ := ctx.Value(organizationContextKey{}).(storage.Organization)
+	return org
+}
+
+// requireOrgPermission пропускает к маршрутам /organizations/{orgId} только участников, чья роль даёт право perm;
+// найденная организация кладётся в контекст запроса
+func (h *Handler) requireOrgPermission(perm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		org, err := h.svc.AuthorizeOrganization(r.Context(), mux.Vars(r)["orgId"], sessionUserID(r.Context()), perm)
+		if err != nil {
+			respondStorageError(w, err, "Organization access check failed")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), organizationContextKey{}, org)))
+	}
+}
+
+// requireAccountPermission проверяет роль участника для маршрутов с {accountId}, если счёт принадлежит
+// организации. Личные счета и несуществующие счета обработчик проверяет сам, как раньше.
+func (h *Handler) requireAccountPermission(perm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if account, ok := h.svc.GetAccount(ctx, mux.Vars(r)["accountId"]); ok {
+			if err := h.svc.AuthorizeOrgAccount(ctx, account, sessionUserID(ctx), perm); err != nil {
+				respondStorageError(w, err, "Account access check failed")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
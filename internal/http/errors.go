@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"bankapp/internal/storage"
+)
+
+// ErrorResponse — единый формат ошибки; поле error оставлено строкой для старых клиентов
+type ErrorResponse struct {
+	Error     string            `json:"error"`
+	Code      storage.ErrorCode `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// codeForStatus — код по умолчанию, если обработчик не указал более точный
+func codeForStatus(status int) storage.ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return storage.CodeValidation
+	case http.StatusUnauthorized:
+		return storage.CodeUnauthorized
+	case http.StatusPaymentRequired:
+		return storage.CodeInsufficientFunds
+	case http.StatusForbidden:
+		return storage.CodeForbidden
+	case http.StatusNotFound:
+		return storage.CodeNotFound
+	case http.StatusNotAcceptable:
+		return storage.CodeUnsupportedVersion
+	case http.StatusConflict:
+		return storage.CodeConflict
+	case http.StatusUnprocessableEntity:
+		return storage.CodeQuotaExceeded
+	case http.StatusTooManyRequests:
+		return storage.CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return storage.CodeServiceUnavailable
+	case statusClientClosedRequest:
+		return storage.CodeRequestCancelled
+	case http.StatusGatewayTimeout:
+		return storage.CodeRequestTimeout
+	default:
+		return storage.CodeInternal
+	}
+}
+
+// storageErrorCode берёт код из StorageError, а при его отсутствии — из категории ошибки
+func storageErrorCode(err error) storage.ErrorCode {
+	var se *storage.StorageError
+	if errors.As(err, &se) && se.Code != "" {
+		return se.Code
+	}
+	return codeForStatus(storageErrorStatus(err))
+}
+
+func respondError(w http.ResponseWriter, status int, message string) {
+	respondErrorCode(w, status, codeForStatus(status), message)
+}
+
+// respondErrorCode отвечает ошибкой с явным кодом; request ID берётся из заголовка ответа,
+// который выставляет requestIDMiddleware
+func respondErrorCode(w http.ResponseWriter, status int, code storage.ErrorCode, message string) {
+	requestID := w.Header().Get(requestIDHeader)
+	log.Printf("HTTP Error %d %s [%s]: %s", status, code, requestID, message)
+	respondJSON(w, status, ErrorResponse{Error: message, Code: code, RequestID: requestID})
+}
@@ -0,0 +1,4872 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/service"
+	"bankapp/internal/storage"
+)
+
+func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "Internal server error"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+const streamFlushEvery = 100
+
+// Списки кодируются поэлементно прямо в ResponseWriter: без Content-Length сервер отдаёт
+// ответ chunked, а память на запрос ограничена одним элементом, а не всем payload.
+func respondJSONStream[T any](w http.ResponseWriter, status int, items []T) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	w.Write([]byte("["))
+	for i, item := range items {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(item); err != nil {
+			log.Printf("Error streaming JSON item %d: %v", i, err)
+			return
+		}
+		if flusher != nil && (i+1)%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	w.Write([]byte("]\n"))
+}
+
+// statusClientClosedRequest — нестандартный код (nginx) для запросов, отменённых клиентом
+const statusClientClosedRequest = 499
+
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrInsufficientFunds):
+		return http.StatusPaymentRequired
+	case errors.Is(err, storage.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, storage.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, storage.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondStorageError отдаёт статус по категории ошибки; для неизвестных ошибок
+// к сообщению добавляется контекст операции
+func respondStorageError(w http.ResponseWriter, err error, context string) {
+	status := storageErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		respondError(w, status, fmt.Sprintf("%s: %v", context, err))
+		return
+	}
+	respondErrorCode(w, status, storageErrorCode(err), err.Error())
+}
+
+func (h *Handler) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Username == "" || req.Email == "" || req.Password == "" {
+		respondError(w, http.StatusBadRequest, "Username, email, and password are required")
+		return
+	}
+	if req.Language == "" {
+		req.Language = storage.DefaultLanguage
+	}
+	if !storage.IsSupportedLanguage(req.Language) {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported language %s", req.Language))
+		return
+	}
+
+	hashedPassword, err := service.HashPassword(req.Password)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	now := time.Now()
+	user := storage.User{
+		ID:           storage.GenerateID(),
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: hashedPassword,
+		CreatedAt:    now,
+		Language:     req.Language,
+		KYCStatus:    storage.KYCNone,
+	}
+	code := service.IssueVerificationCode(&user, now)
+
+	if err := h.svc.AddUser(ctx, user); err != nil {
+		respondStorageError(w, err, "Failed to register user")
+		return
+	}
+
+	h.svc.QueueEmail(ctx, user.Email, "Welcome to Simple Bank!",
+		fmt.Sprintf("Hello %s,\n\nThank you for registering at Simple Bank.\n\nYour email verification code: %s. It expires in %d hours.",
+			user.Username, code, int(service.VerificationPolicy.CodeTTL.Hours())))
+
+	log.Printf("User registered: %s (ID: %s)", user.Username, user.ID)
+	user.PasswordHash = ""
+	user.VerificationCode = ""
+	respondJSON(w, http.StatusCreated, user)
+}
+
+func (h *Handler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.UserID == "" || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "UserID and code are required")
+		return
+	}
+
+	if err := h.svc.VerifyUserEmail(ctx, req.UserID, req.Code, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrInvalidInput) {
+			h.recordSecurityEvent(r, req.UserID, storage.SecurityOTPFailed, map[string]string{"purpose": "email_verification"})
+		}
+		respondStorageError(w, err, "Failed to verify email")
+		return
+	}
+
+	log.Printf("Email verified for user %s", req.UserID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+// ResendVerificationHandler отправляет новый код подтверждения email, если прежний истёк или сгорел
+func (h *Handler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.UserID == "" {
+		respondError(w, http.StatusBadRequest, "UserID is required")
+		return
+	}
+	if err := h.svc.ResendVerificationCode(ctx, req.UserID, time.Now()); err != nil {
+		respondStorageError(w, err, "Failed to send verification code")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Verification code sent"})
+}
+
+func (h *Handler) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.svc.GetUserByUsername(ctx, req.Username)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+
+	if !service.CheckPasswordHash(req.Password, user.PasswordHash) {
+		h.recordSecurityEvent(r, user.ID, storage.SecurityLoginFailed, nil)
+		respondError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+
+	newDevice := !h.svc.HasKnownDevice(ctx, user.ID, r.UserAgent(), clientIP(r))
+	now := time.Now()
+	session := storage.Session{
+		ID:         storage.GenerateID(),
+		UserID:     user.ID,
+		Token:      storage.GenerateToken(),
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		Kind:       storage.SessionKindLogin,
+		Scopes:     storage.AllScopes,
+	}
+	if err := h.svc.AddSession(ctx, session); err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create session: %v", err))
+		return
+	}
+	if newDevice {
+		h.recordSecurityEvent(r, user.ID, storage.SecurityNewDevice, map[string]string{"session_id": session.ID})
+	}
+
+	log.Printf("User logged in: %s (session %s)", user.Username, session.ID)
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message":    "Login successful",
+		"user_id":    user.ID,
+		"session_id": session.ID,
+		"token":      session.Token,
+	})
+}
+
+func (h *Handler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Email == "" {
+		respondError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	// Ответ одинаковый независимо от наличия пользователя, чтобы не раскрывать зарегистрированные email
+	if user, ok := h.svc.GetUserByEmail(ctx, req.Email); ok {
+		token := service.GenerateResetToken(user, time.Now().Add(service.ResetTokenTTL))
+		h.svc.QueueEmail(ctx, user.Email, "Simple Bank password reset",
+			fmt.Sprintf("Hello %s,\n\nUse this token to reset your password (valid for %v):\n\n%s\n\nIf you did not request a reset, ignore this email.",
+				user.Username, service.ResetTokenTTL, token))
+		h.recordSecurityEvent(r, user.ID, storage.SecurityPasswordReset, nil)
+		log.Printf("Password reset requested for user %s", user.ID)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "If the email is registered, a reset link has been sent"})
+}
+
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Token == "" || req.NewPassword == "" {
+		respondError(w, http.StatusBadRequest, "Token and new password are required")
+		return
+	}
+
+	userID, err := h.svc.ParseResetToken(ctx, req.Token)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hashedPassword, err := service.HashPassword(req.NewPassword)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	if err := h.svc.UpdateUserPassword(ctx, userID, hashedPassword); err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update password: %v", err))
+		return
+	}
+
+	revoked := h.svc.RevokeUserSessions(ctx, userID)
+	h.recordSecurityEvent(r, userID, storage.SecurityPasswordChanged, map[string]string{"revoked_sessions": strconv.Itoa(revoked)})
+	log.Printf("Password reset for user %s, %d sessions revoked", userID, revoked)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset"})
+}
+
+func (h *Handler) CreatePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+
+	var req storage.CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Name == "" || len(req.Scopes) == 0 {
+		respondError(w, http.StatusBadRequest, "Token name and scopes are required")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !storage.ReadOnlyScopes[scope] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Scope %s is not allowed for personal access tokens", scope))
+			return
+		}
+	}
+	now := time.Now()
+	session := storage.Session{
+		ID:         storage.GenerateID(),
+		UserID:     userID,
+		Token:      storage.GenerateToken(),
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		Kind:       storage.SessionKindPAT,
+		Name:       req.Name,
+		Scopes:     storage.UniqueTerms(req.Scopes),
+	}
+	if err := h.svc.AddSession(ctx, session); err != nil {
+		respondStorageError(w, err, "Failed to issue token")
+		return
+	}
+
+	h.recordSecurityEvent(r, userID, storage.SecurityTokenIssued, map[string]string{"token_id": session.ID, "name": session.Name})
+	log.Printf("Personal access token %s issued for user %s with scopes %v", session.ID, userID, session.Scopes)
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"token_info": session,
+		"token":      session.Token,
+	})
+}
+
+// credentialOwner пропускает к токенам, ключам и согласиям пользователя только его самого и только из сессии входа.
+// Без токена запрос не проходит даже в нестрогом режиме, а ключ API, личный токен или токен стороннего приложения
+// не могут выпустить себе замену.
+func credentialOwner(w http.ResponseWriter, r *http.Request, userID string) bool {
+	caller, ok := sessionFromContext(r.Context())
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Credentials can only be managed from the owner's login session")
+		return false
+	}
+	if caller.UserID != userID {
+		respondError(w, http.StatusForbidden, "Cannot manage another user's credentials")
+		return false
+	}
+	if caller.Kind != storage.SessionKindLogin {
+		respondError(w, http.StatusForbidden, "API keys and access tokens cannot manage credentials")
+		return false
+	}
+	return true
+}
+
+// userSelf пропускает к данным пользователя {userId} только его самого; токен обязателен и в нестрогом режиме.
+// Личный токен только читает.
+func userSelf(w http.ResponseWriter, r *http.Request, userID string) bool {
+	caller, ok := sessionFromContext(r.Context())
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Access token is required")
+		return false
+	}
+	if caller.UserID != userID {
+		respondError(w, http.StatusForbidden, "Cannot access another user's data")
+		return false
+	}
+	if caller.Kind == storage.SessionKindPAT && r.Method != http.MethodGet {
+		respondError(w, http.StatusForbidden, "Personal access tokens are read-only")
+		return false
+	}
+	return true
+}
+
+func (h *Handler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+
+	var req storage.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+	key, secret, err := h.svc.IssueUserAPIKey(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to issue API key")
+		return
+	}
+	h.recordSecurityEvent(r, userID, storage.SecurityAPIKeyIssued, map[string]string{"key_id": key.ID, "name": key.Name, "access": key.Access})
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"key_info": key,
+		"api_key":  secret,
+	})
+}
+
+func (h *Handler) GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.GetUserAPIKeys(ctx, userID))
+}
+
+func (h *Handler) RotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !credentialOwner(w, r, vars["userId"]) {
+		return
+	}
+	key, secret, err := h.svc.RotateUserAPIKey(ctx, vars["userId"], vars["keyId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to rotate API key")
+		return
+	}
+	h.recordSecurityEvent(r, key.UserID, storage.SecurityAPIKeyRotated, map[string]string{"key_id": key.ID})
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"key_info": key,
+		"api_key":  secret,
+	})
+}
+
+func (h *Handler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !credentialOwner(w, r, vars["userId"]) {
+		return
+	}
+	key, err := h.svc.RevokeUserAPIKey(ctx, vars["userId"], vars["keyId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to revoke API key")
+		return
+	}
+	h.recordSecurityEvent(r, key.UserID, storage.SecurityAPIKeyRevoked, map[string]string{"key_id": key.ID})
+	log.Printf("API key %s revoked for user %s", key.ID, key.UserID)
+	respondJSON(w, http.StatusOK, key)
+}
+
+// oauthUser — пользователь, который решает на экране согласия; это возможно только в обычной сессии входа
+func oauthUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	session, ok := sessionFromContext(r.Context())
+	if !ok || session.Kind != storage.SessionKindLogin {
+		respondError(w, http.StatusUnauthorized, "Sign in to authorize third-party apps")
+		return "", false
+	}
+	return session.UserID, true
+}
+
+func (h *Handler) GetOAuthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := oauthUser(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if responseType := query.Get("response_type"); responseType != "" && responseType != "code" {
+		respondError(w, http.StatusBadRequest, "Only response_type=code is supported")
+		return
+	}
+	consent, err := h.svc.OAuthConsentRequest(ctx, userID, storage.OAuthAuthorizeRequest{
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		ConsentID:           query.Get("consent_id"),
+	}, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Invalid authorization request")
+		return
+	}
+	respondJSON(w, http.StatusOK, consent)
+}
+
+func (h *Handler) AuthorizeOAuthHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.OAuthAuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	userID, ok := oauthUser(w, r)
+	if !ok {
+		return
+	}
+	redirect, err := h.svc.AuthorizeOAuth(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Invalid authorization request")
+		return
+	}
+	if req.Approve {
+		h.recordSecurityEvent(r, userID, storage.SecurityOAuthGranted, map[string]string{"client_id": req.ClientID, "scope": req.Scope})
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"redirect_uri": redirect})
+}
+
+// respondOAuthError отвечает в формате RFC 6749: приложения разбирают поле error, а не код банка
+func respondOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		respondStorageError(w, err, "Failed to issue token")
+		return
+	}
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	respondJSON(w, status, map[string]string{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
+
+// OAuthTokenHandler — эндпоинт токенов: форма application/x-www-form-urlencoded, приложение
+// представляется через HTTP Basic или полями client_id и client_secret
+func (h *Handler) OAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed form body"})
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	var (
+		tokens storage.OAuthTokenResponse
+		err    error
+	)
+	now := time.Now()
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		tokens, err = h.svc.ExchangeOAuthCode(ctx, clientID, secret, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"), now)
+	case "refresh_token":
+		tokens, err = h.svc.RefreshOAuthToken(ctx, clientID, secret, r.PostForm.Get("refresh_token"), now)
+	default:
+		err = &service.OAuthError{Code: "unsupported_grant_type", Description: "grant_type must be authorization_code or refresh_token"}
+	}
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+func (h *Handler) GetOAuthGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.GetUserOAuthGrants(ctx, userID))
+}
+
+func (h *Handler) RevokeOAuthGrantHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !credentialOwner(w, r, vars["userId"]) {
+		return
+	}
+	grant, err := h.svc.RevokeOAuthGrant(ctx, vars["userId"], vars["grantId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to revoke access")
+		return
+	}
+	h.recordSecurityEvent(r, grant.UserID, storage.SecurityOAuthRevoked, map[string]string{"grant_id": grant.ID, "client_id": grant.ClientID})
+	log.Printf("OAuth grant %s for client %s revoked by user %s", grant.ID, grant.ClientID, grant.UserID)
+	respondJSON(w, http.StatusOK, grant)
+}
+
+func (h *Handler) GetSecurityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+
+	from, to := time.Time{}, time.Now()
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid from, expected RFC3339 timestamp")
+			return
+		}
+		from = parsed
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid to, expected RFC3339 timestamp")
+			return
+		}
+		to = parsed
+	}
+
+	events := h.svc.GetSecurityEvents(ctx, userID, from, to, r.URL.Query().Get("type"))
+	page, pageSize := parsePagination(r)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total":     len(events),
+		"page":      page,
+		"page_size": pageSize,
+		"events":    paginate(events, page, pageSize),
+	})
+}
+
+func (h *Handler) CreateDependentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, parentID) {
+		return
+	}
+
+	var req storage.CreateDependentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Username == "" || req.Email == "" || req.Password == "" {
+		respondError(w, http.StatusBadRequest, "Username, email, and password are required")
+		return
+	}
+	parent, ok := h.svc.GetUser(ctx, parentID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", parentID))
+		return
+	}
+	if parent.ParentID != "" {
+		respondError(w, http.StatusBadRequest, "Dependent profiles cannot have their own dependents")
+		return
+	}
+
+	hashedPassword, err := service.HashPassword(req.Password)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	// Профиль создаёт уже подтверждённый родитель, поэтому email ребёнка повторно не проверяется
+	child := storage.User{
+		ID:            storage.GenerateID(),
+		Username:      req.Username,
+		Email:         req.Email,
+		PasswordHash:  hashedPassword,
+		CreatedAt:     time.Now(),
+		EmailVerified: parent.EmailVerified,
+		ParentID:      parent.ID,
+		Language:      parent.Language,
+		KYCStatus:     storage.KYCNone,
+	}
+	if err := h.svc.AddUser(ctx, child); err != nil {
+		respondStorageError(w, err, "Failed to create dependent")
+		return
+	}
+
+	log.Printf("Dependent profile %s created for parent %s", child.ID, parent.ID)
+	child.PasswordHash = ""
+	respondJSON(w, http.StatusCreated, child)
+}
+
+func (h *Handler) loadDependent(ctx context.Context, w http.ResponseWriter, parentID, childID string) (storage.User, bool) {
+	child, ok := h.svc.GetUser(ctx, childID)
+	if !ok || child.ParentID != parentID {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("Dependent %s not found for user %s", childID, parentID))
+		return storage.User{}, false
+	}
+	return child, true
+}
+
+func (h *Handler) SetParentalControlHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !userSelf(w, r, vars["userId"]) {
+		return
+	}
+	child, ok := h.loadDependent(ctx, w, vars["userId"], vars["childId"])
+	if !ok {
+		return
+	}
+
+	var control storage.ParentalControl
+	if err := json.NewDecoder(r.Body).Decode(&control); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	account, ok := h.svc.GetAccount(ctx, control.AccountID)
+	if !ok || account.UserID != child.ID {
+		respondError(w, http.StatusBadRequest, "Account must belong to the dependent")
+		return
+	}
+	if control.DailySpendLimit.IsNegative() || control.PerTransactionLimit.IsNegative() {
+		respondError(w, http.StatusBadRequest, "Limits must not be negative")
+		return
+	}
+	if control.BlockedCategories == nil {
+		control.BlockedCategories = []string{}
+	}
+	control.UpdatedAt = time.Now()
+
+	if err := h.svc.SetParentalControl(ctx, control); err != nil {
+		respondStorageError(w, err, "Failed to save parental controls")
+		return
+	}
+
+	log.Printf("Parental controls updated for account %s of dependent %s", control.AccountID, child.ID)
+	respondJSON(w, http.StatusOK, control)
+}
+
+func (h *Handler) GetDependentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	dependents := h.svc.GetDependents(ctx, userID)
+	for i := range dependents {
+		dependents[i].PasswordHash = ""
+	}
+	respondJSONStream(w, http.StatusOK, dependents)
+}
+
+func (h *Handler) GetDependentDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !userSelf(w, r, vars["userId"]) {
+		return
+	}
+	child, ok := h.loadDependent(ctx, w, vars["userId"], vars["childId"])
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.BuildDependentDashboard(ctx, child, time.Now()))
+}
+
+func (h *Handler) GetUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+
+	sessions := h.svc.GetUserSessions(ctx, userID)
+	log.Printf("Fetched %d sessions for user %s", len(sessions), userID)
+	respondJSONStream(w, http.StatusOK, sessions)
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WebSocketHandler — браузеры не умеют ставить заголовки при апгрейде, поэтому токен сессии
+// принимается и из query-параметра token
+func (h *Handler) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	session, ok := h.svc.GetSessionByToken(ctx, token)
+	if token == "" || !ok || session.Revoked {
+		respondError(w, http.StatusUnauthorized, "Valid session token is required")
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := h.svc.Events().Subscribe(session.UserID)
+	defer unsubscribe()
+	log.Printf("WebSocket connected for user %s (session %s)", session.UserID, session.ID)
+
+	// Чтение нужно только для обработки close/pong от клиента
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				log.Printf("WebSocket write failed for user %s: %v", session.UserID, err)
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			log.Printf("WebSocket disconnected for user %s", session.UserID)
+			return
+		}
+	}
+}
+
+func (h *Handler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+	sessionID := vars["sessionId"]
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+
+	if err := h.svc.RevokeSession(ctx, userID, sessionID); err != nil {
+		respondStorageError(w, err, "Failed to revoke session")
+		return
+	}
+	h.recordSecurityEvent(r, userID, storage.SecuritySessionRevoked, map[string]string{"session_id": sessionID})
+
+	log.Printf("Session %s revoked for user %s", sessionID, userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+func (h *Handler) CreateAPIClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateAPIClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Client name is required")
+		return
+	}
+	if err := service.ValidateOAuthClientSettings(req.RedirectURIs, req.OAuthScopes, req.CallbackURL); err != nil {
+		respondStorageError(w, err, "Invalid OAuth settings")
+		return
+	}
+
+	client := storage.APIClient{
+		ID:        storage.GenerateID(),
+		Name:      req.Name,
+		Secret:    storage.GenerateToken(),
+		Active:    true,
+		CreatedAt: time.Now(),
+
+		RedirectURIs: req.RedirectURIs,
+		OAuthScopes:  storage.UniqueTerms(req.OAuthScopes),
+		CallbackURL:  req.CallbackURL,
+	}
+	h.svc.AddAPIClient(ctx, client)
+
+	log.Printf("API client registered: %s (%s)", client.Name, client.ID)
+	// Секрет показывается только при создании и ротации
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"client": client,
+		"secret": client.Secret,
+	})
+}
+
+func (h *Handler) ListAPIClientsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSONStream(w, http.StatusOK, h.svc.ListAPIClients(ctx))
+}
+
+func (h *Handler) RotateAPIClientSecretHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	clientID := mux.Vars(r)["clientId"]
+	client, err := h.svc.UpdateAPIClient(ctx, clientID, func(c *storage.APIClient) {
+		c.Secret = storage.GenerateToken()
+	})
+	if err != nil {
+		respondStorageError(w, err, "Failed to rotate secret")
+		return
+	}
+
+	log.Printf("API client %s secret rotated", clientID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"client": client,
+		"secret": client.Secret,
+	})
+}
+
+func (h *Handler) DeactivateAPIClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	clientID := mux.Vars(r)["clientId"]
+	client, err := h.svc.UpdateAPIClient(ctx, clientID, func(c *storage.APIClient) {
+		c.Active = false
+	})
+	if err != nil {
+		respondStorageError(w, err, "Failed to deactivate client")
+		return
+	}
+	// Отключённое приложение теряет и все согласия пользователей вместе с выданными токенами
+	revoked := h.svc.RevokeClientOAuthGrants(ctx, clientID, time.Now())
+
+	log.Printf("API client %s deactivated, %d oauth grants revoked", clientID, revoked)
+	respondJSON(w, http.StatusOK, client)
+}
+
+func (h *Handler) GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	entries := h.svc.GetAuditLog(ctx, r.URL.Query().Get("action"))
+	page, pageSize := parsePagination(r)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total":     len(entries),
+		"page":      page,
+		"page_size": pageSize,
+		"entries":   paginate(entries, page, pageSize),
+	})
+}
+
+// ListSagasHandler — журнал многошаговых операций; ?status=stuck показывает требующие разбора
+func (h *Handler) ListSagasHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListSagas(r.Context(), r.URL.Query().Get("status")))
+}
+
+func (h *Handler) GetSagaHandler(w http.ResponseWriter, r *http.Request) {
+	sagaID := mux.Vars(r)["sagaId"]
+	saga, ok := h.svc.GetSaga(r.Context(), sagaID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Saga %s not found", sagaID))
+		return
+	}
+	respondJSON(w, http.StatusOK, saga)
+}
+
+func (h *Handler) RetrySagaHandler(w http.ResponseWriter, r *http.Request) {
+	saga, err := h.svc.RetrySaga(r.Context(), mux.Vars(r)["sagaId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to retry saga")
+		return
+	}
+	respondJSON(w, http.StatusOK, saga)
+}
+
+func (h *Handler) ResolveSagaHandler(w http.ResponseWriter, r *http.Request) {
+	var req storage.ResolveSagaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	saga, err := h.svc.ResolveSaga(r.Context(), mux.Vars(r)["sagaId"], req.Resolution, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to resolve saga")
+		return
+	}
+	respondJSON(w, http.StatusOK, saga)
+}
+
+func (h *Handler) RunEndOfDayHandler(w http.ResponseWriter, r *http.Request) {
+	var req storage.EODRunRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	batch, err := h.svc.RunEndOfDay(r.Context(), req.Date, storage.EODTriggerManual, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to run end-of-day batch")
+		return
+	}
+	respondJSON(w, http.StatusOK, batch)
+}
+
+func (h *Handler) ListEODBatchesHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListEODBatches(r.Context()))
+}
+
+func (h *Handler) GetEODBatchHandler(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.svc.EODBatch(r.Context(), mux.Vars(r)["date"])
+	if err != nil {
+		respondStorageError(w, err, "Failed to get end-of-day batch")
+		return
+	}
+	respondJSON(w, http.StatusOK, batch)
+}
+
+func (h *Handler) EODBalancesHandler(w http.ResponseWriter, r *http.Request) {
+	date := mux.Vars(r)["date"]
+	if _, err := h.svc.EODBatch(r.Context(), date); err != nil {
+		respondStorageError(w, err, "Failed to get balance snapshots")
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.ListBalanceSnapshots(r.Context(), date, r.URL.Query().Get("account_id")))
+}
+
+func RetentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, service.RetentionPolicies)
+}
+
+// TransactionArchiveHandler — сколько проводок политика хранения вынесла из горячего журнала в архив
+func (h *Handler) TransactionArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.TransactionArchiveStats(r.Context()))
+}
+
+func (h *Handler) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.UserID == "" {
+		respondError(w, http.StatusBadRequest, "UserID is required")
+		return
+	}
+
+	if service.VerificationPolicy.RequireForAccounts {
+		if user, ok := h.svc.GetUser(ctx, req.UserID); ok && !user.EmailVerified {
+			respondError(w, http.StatusForbidden, "Email must be verified before opening an account")
+			return
+		}
+	}
+
+	if req.ProductCode == "" {
+		req.ProductCode = storage.DefaultProductCode
+	}
+	product, ok := storage.GetProduct(req.ProductCode)
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown product code %s", req.ProductCode))
+		return
+	}
+	if product.Business {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Product %s is opened for organizations via /organizations/{orgId}/accounts", product.Code))
+		return
+	}
+	if req.Currency == "" {
+		req.Currency = product.Currencies[0]
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+
+	if err := storage.CheckProductEligibility(product, req.Currency, h.svc.GetUserAccounts(ctx, req.UserID)); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	account := h.svc.NewProductAccount(ctx, req.UserID, product, req.Currency, time.Now())
+
+	if err := h.svc.AddAccount(ctx, account); err != nil {
+		respondStorageError(w, err, "Failed to create account")
+		return
+	}
+
+	log.Printf("Account created: %s (%s, %s) for user %s", account.Number, product.Code, account.Currency, account.UserID)
+	respondJSON(w, http.StatusCreated, storage.AccountWithProduct{Account: account, Product: product})
+}
+
+func ListProductsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, storage.ListProducts())
+}
+
+func (h *Handler) LookupAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	number := r.URL.Query().Get("number")
+	if err := storage.ValidateAccountNumber(number); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	account, ok := h.svc.GetAccountByNumber(ctx, number)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account number %s not found", number))
+		return
+	}
+	holder, _ := h.svc.GetUser(ctx, account.UserID)
+
+	respondJSON(w, http.StatusOK, storage.AccountLookup{
+		AccountID:  account.ID,
+		Number:     account.Number,
+		Currency:   account.Currency,
+		HolderName: storage.MaskName(holder.Username),
+	})
+}
+
+func (h *Handler) GetUserAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+
+	if h.checkETag(w, r, "accounts-"+userID, storage.CollectionAccounts) {
+		return
+	}
+	accounts := h.svc.GetUserAccounts(ctx, userID)
+	log.Printf("Fetched %d accounts for user %s", len(accounts), userID)
+	respondJSONStream(w, http.StatusOK, accounts)
+}
+
+func (h *Handler) GenerateCardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.GenerateCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	account, ok := h.svc.GetAccount(ctx, req.AccountID)
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Account %s not found", req.AccountID))
+		return
+	}
+	if !h.orgAccountAllows(w, r, account, storage.OrgPermManage) {
+		return
+	}
+
+	card := storage.NewCard(req.AccountID)
+
+	if err := h.svc.AddCard(ctx, card); err != nil {
+		respondStorageError(w, err, "Failed to generate card")
+		return
+	}
+
+	log.Printf("Card generated for account %s", card.AccountID)
+	card.CVV = "***"
+	respondJSON(w, http.StatusCreated, card)
+}
+
+func (h *Handler) BatchIssueCardsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.BatchCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Employer == "" || len(req.Items) == 0 {
+		respondError(w, http.StatusBadRequest, "Employer and at least one item are required")
+		return
+	}
+	if len(req.Items) > service.MaxBatchCardItems {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Batch is limited to %d items", service.MaxBatchCardItems))
+		return
+	}
+
+	op := storage.Operation{
+		ID:        storage.GenerateID(),
+		Type:      "batch_card_issuance",
+		Status:    storage.OperationPending,
+		CreatedAt: time.Now(),
+	}
+	h.svc.SaveOperation(ctx, op)
+
+	go h.svc.ProcessBatchCardIssuance(ctx, op, req)
+
+	log.Printf("Batch card issuance for %s queued: %d items (operation %s)", req.Employer, len(req.Items), op.ID)
+	respondJSON(w, http.StatusAccepted, op)
+}
+
+func (h *Handler) UpdateCardDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cardID := mux.Vars(r)["cardId"]
+
+	var req storage.UpdateDeliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if !storage.DeliveryStatuses[req.DeliveryStatus] {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown delivery status %s", req.DeliveryStatus))
+		return
+	}
+
+	card, err := h.svc.UpdateCardDelivery(ctx, cardID, req.DeliveryStatus, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to update delivery status")
+		return
+	}
+
+	log.Printf("Card %s delivery status: %s", cardID, card.DeliveryStatus)
+	card.CVV = "***"
+	respondJSON(w, http.StatusOK, card)
+}
+
+func (h *Handler) GetOperationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	operationID := mux.Vars(r)["operationId"]
+	op, ok := h.svc.GetOperation(ctx, operationID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Operation %s not found", operationID))
+		return
+	}
+	respondJSON(w, http.StatusOK, op)
+}
+
+func (h *Handler) GetAccountCardsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	accountID := vars["accountId"]
+
+	if _, ok := h.svc.GetAccount(ctx, accountID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+
+	cards := h.svc.GetAccountCards(ctx, accountID)
+	for i := range cards {
+		cards[i].CVV = "***"
+	}
+	log.Printf("Fetched %d cards for account %s", len(cards), accountID)
+	respondJSONStream(w, http.StatusOK, cards)
+}
+
+// StartCardRevealHandler — шаг 1 показа реквизитов: только владелец карты в login-сессии, код уходит на email
+func (h *Handler) StartCardRevealHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cardID := mux.Vars(r)["cardId"]
+
+	session, ok := sessionFromContext(ctx)
+	if !ok || session.Kind != storage.SessionKindLogin {
+		respondError(w, http.StatusUnauthorized, "Card details can only be revealed from a login session")
+		return
+	}
+	card, ok := h.svc.GetCard(ctx, cardID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeCardNotFound, fmt.Sprintf("Card %s not found", cardID))
+		return
+	}
+	account, ok := h.svc.GetAccount(ctx, card.AccountID)
+	if !ok || account.UserID != session.UserID {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeCardNotFound, fmt.Sprintf("Card %s not found", cardID))
+		return
+	}
+	user, ok := h.svc.GetUser(ctx, session.UserID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", session.UserID))
+		return
+	}
+
+	reveal, err := h.svc.StartCardReveal(ctx, card, user, session.ID, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to start card reveal")
+		return
+	}
+	log.Printf("Card reveal %s started for card %s", reveal.ID, card.ID)
+	respondJSON(w, http.StatusAccepted, reveal)
+}
+
+// ConfirmCardRevealHandler — шаг 2: код из письма в обмен на одноразовый токен
+func (h *Handler) ConfirmCardRevealHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	revealID := mux.Vars(r)["revealId"]
+
+	session, ok := sessionFromContext(ctx)
+	if !ok || session.Kind != storage.SessionKindLogin {
+		respondError(w, http.StatusUnauthorized, "Card details can only be revealed from a login session")
+		return
+	}
+	var req storage.ConfirmCardRevealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	reveal, token, err := h.svc.ConfirmCardReveal(ctx, revealID, session.ID, req.Code, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidInput) {
+			h.recordSecurityEvent(r, session.UserID, storage.SecurityOTPFailed, map[string]string{"purpose": "card_reveal", "card_id": reveal.CardID})
+		}
+		respondStorageError(w, err, "Failed to confirm card reveal")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"reveal_id":  reveal.ID,
+		"token":      token,
+		"reveal_url": "/v1/cards/reveal/" + token,
+		"expires_at": reveal.ExpiresAt,
+	})
+}
+
+// RedeemCardRevealHandler — шаг 3: реквизиты отдаются один раз, повторный запрос по токену получает 404
+func (h *Handler) RedeemCardRevealHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := mux.Vars(r)["token"]
+
+	reveal, details, err := h.svc.RedeemCardReveal(ctx, token, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to reveal card details")
+		return
+	}
+	h.recordSecurityEvent(r, reveal.UserID, storage.SecurityCardRevealed, map[string]string{"card_id": reveal.CardID})
+	log.Printf("Card details revealed for card %s (reveal %s)", reveal.CardID, reveal.ID)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondJSON(w, http.StatusOK, details)
+}
+
+func (h *Handler) PayWithCardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Payment amount must be positive")
+		return
+	}
+
+	card, ok := h.paymentCard(w, r, req)
+	if !ok {
+		return
+	}
+	if err := h.svc.CheckParentalControls(ctx, card.AccountID, req.Amount, req.Category, time.Now()); err != nil {
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	account, ok := h.svc.GetAccount(ctx, card.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return
+	}
+
+	if err := storage.ValidateAmount(req.Amount, account.Currency); err != nil {
+		respondStorageError(w, err, "Payment failed")
+		return
+	}
+	if account.AvailableBalance.LessThan(req.Amount) {
+		respondError(w, http.StatusPaymentRequired, "Insufficient funds")
+		return
+	}
+	if err := h.svc.CheckTierLimits(ctx, &account, nil, req.Amount, time.Now()); err != nil {
+		respondStorageError(w, err, "Payment failed")
+		return
+	}
+
+	tx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   account.ID,
+		ToAccountID:     "",
+		Amount:          req.Amount,
+		Timestamp:       time.Now(),
+		TransactionType: "payment",
+		Merchant:        req.Merchant,
+		CardID:          card.ID,
+		Category:        req.Category,
+	}
+	if req.MerchantID != "" {
+		merchant, err := h.svc.PaymentMerchant(ctx, req.MerchantID)
+		if err != nil {
+			respondStorageError(w, err, "Failed to process payment")
+			return
+		}
+		applyMerchant(&tx, merchant)
+		req.Merchant = tx.Merchant
+	}
+	tx.Describe(storage.DescCardPayment, map[string]string{"merchant": tx.Merchant})
+
+	fraud, ok := h.assessCardPayment(w, r, card, account, tx.Amount, tx.Merchant, tx.MerchantID, tx.Category, tx.Timestamp)
+	if !ok {
+		return
+	}
+	tx.Fraud = &fraud
+	if h.svc.RequiresPaymentChallenge(ctx, tx.Amount, account.Currency) {
+		challenge, err := h.svc.StartPaymentChallenge(ctx, card, account, tx, tx.Timestamp)
+		if err != nil {
+			respondStorageError(w, err, "Failed to process payment")
+			return
+		}
+		respondJSON(w, http.StatusAccepted, challenge)
+		return
+	}
+	release, err := h.svc.ReserveOperation(ctx, storage.OpCardPayment, req.Amount, account.Currency, tx.Timestamp)
+	if err != nil {
+		respondStorageError(w, err, "Payment failed")
+		return
+	}
+
+	if tx.ToAccountID != "" {
+		if err := h.svc.PayMerchant(ctx, tx); err != nil {
+			release()
+			respondStorageError(w, err, "Failed to process payment")
+			return
+		}
+		h.svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+		h.svc.NotifyChargeEvent(ctx, storage.ChargeCaptured, tx)
+	} else {
+		if err := h.svc.UpdateAccountBalance(ctx, account.ID, req.Amount.Neg()); err != nil {
+			release()
+			respondStorageError(w, err, "Failed to process payment")
+			return
+		}
+		h.svc.AddTransaction(ctx, tx)
+	}
+	h.svc.PublishBalanceChanged(ctx, account.ID)
+	h.svc.PublishCardPayment(account, card, req.Amount, req.Merchant)
+
+	log.Printf("Payment of %s processed from account %s (card %s) to %s", req.Amount.String(), account.ID, card.Number[:4]+"...", req.Merchant)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Payment successful"})
+}
+
+// ConfirmPaymentHandler подтверждает крупную оплату картой кодом из письма; оплата проводится сразу
+func (h *Handler) ConfirmPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	paymentID := mux.Vars(r)["paymentId"]
+
+	var req storage.PaymentConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	challenge, err := h.svc.ConfirmPaymentChallenge(ctx, paymentID, sessionUserID(ctx), req.Code, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidInput) {
+			h.recordSecurityEvent(r, challenge.UserID, storage.SecurityOTPFailed, map[string]string{"purpose": "payment_confirmation", "card_id": challenge.CardID})
+		}
+		respondStorageError(w, err, "Failed to confirm payment")
+		return
+	}
+	respondJSON(w, http.StatusOK, challenge)
+}
+
+// paymentCard находит карту оплаты по номеру или по токену устройства. CVV проверяется только при оплате
+// по номеру: токен уже подтверждает, что платит устройство владельца. При ошибке отвечает сам.
+func (h *Handler) paymentCard(w http.ResponseWriter, r *http.Request, req storage.PaymentRequest) (storage.Card, bool) {
+	ctx := r.Context()
+	var card storage.Card
+	if req.Token != "" {
+		tokenCard, token, err := h.svc.ResolveCardToken(ctx, req.Token, req.DeviceID, time.Now())
+		if err != nil {
+			respondStorageError(w, err, "Payment failed")
+			return storage.Card{}, false
+		}
+		log.Printf("Card %s paid with token %s (device %s)", tokenCard.ID, token.ID, token.DeviceID)
+		card = tokenCard
+	} else {
+		numberCard, ok := h.svc.GetCardByNumber(ctx, req.CardNumber)
+		if !ok {
+			respondErrorCode(w, http.StatusNotFound, storage.CodeCardNotFound, "Card not found")
+			return storage.Card{}, false
+		}
+		card = numberCard
+	}
+
+	if !card.IsActive(time.Now()) {
+		respondError(w, http.StatusBadRequest, "Card expired or blocked")
+		return storage.Card{}, false
+	}
+	if req.Token == "" && req.CVV != "" && !service.VerifyCardCVV(card, req.CVV) {
+		if acc, ok := h.svc.GetAccount(ctx, card.AccountID); ok {
+			h.recordSecurityEvent(r, acc.UserID, storage.SecurityCardCVVMismatch, map[string]string{"card_id": card.ID})
+		}
+		respondError(w, http.StatusUnauthorized, "Invalid card verification code")
+		return storage.Card{}, false
+	}
+	if acc, ok := h.svc.GetAccount(ctx, card.AccountID); ok && !h.orgAccountAllows(w, r, acc, storage.OrgPermPay) {
+		return storage.Card{}, false
+	}
+	return card, true
+}
+
+// assessCardPayment оценивает риск оплаты картой; при отказе пишет событие безопасности и отвечает 403
+func (h *Handler) assessCardPayment(w http.ResponseWriter, r *http.Request, card storage.Card, account storage.Account, amount decimal.Decimal, merchant, merchantID, category string, now time.Time) (storage.FraudAssessment, bool) {
+	assessment := h.svc.AssessPayment(r.Context(), service.FraudRequest{
+		UserID:     account.UserID,
+		AccountID:  account.ID,
+		CardID:     card.ID,
+		Amount:     amount,
+		Currency:   account.Currency,
+		Merchant:   merchant,
+		MerchantID: merchantID,
+		Category:   category,
+		Time:       now,
+	})
+	if !assessment.Declined {
+		return assessment, true
+	}
+	h.recordSecurityEvent(r, account.UserID, storage.SecurityPaymentDeclined, map[string]string{
+		"card_id":  card.ID,
+		"amount":   amount.String(),
+		"merchant": merchant,
+		"score":    strconv.Itoa(assessment.Score),
+		"provider": assessment.Provider,
+	})
+	log.Printf("Card payment of %s on account %s declined: fraud score %d (%s)", amount.String(), account.ID, assessment.Score, assessment.Provider)
+	respondStorageError(w, service.FraudDeclinedError(assessment), "Payment declined")
+	return assessment, false
+}
+
+// applyMerchant направляет оплату на расчётный счёт зарегистрированного мерчанта
+func applyMerchant(tx *storage.Transaction, merchant storage.Merchant) {
+	tx.ToAccountID = merchant.SettlementAccountID
+	tx.MerchantID = merchant.ID
+	tx.Merchant = merchant.Name
+	if tx.Category == "" {
+		tx.Category = merchant.Category
+	}
+}
+
+func (h *Handler) AuthorizeCardPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Payment amount must be positive")
+		return
+	}
+
+	card, ok := h.paymentCard(w, r, req)
+	if !ok {
+		return
+	}
+	if err := h.svc.CheckParentalControls(ctx, card.AccountID, req.Amount, req.Category, time.Now()); err != nil {
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if req.MerchantID != "" {
+		merchant, err := h.svc.PaymentMerchant(ctx, req.MerchantID)
+		if err != nil {
+			respondStorageError(w, err, "Failed to authorize payment")
+			return
+		}
+		req.Merchant = merchant.Name
+		if req.Category == "" {
+			req.Category = merchant.Category
+		}
+	}
+
+	account, ok := h.svc.GetAccount(ctx, card.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return
+	}
+	if err := storage.ValidateAmount(req.Amount, account.Currency); err != nil {
+		respondStorageError(w, err, "Failed to authorize payment")
+		return
+	}
+	now := time.Now()
+	if err := h.svc.CheckTierLimits(ctx, &account, nil, req.Amount, now); err != nil {
+		respondStorageError(w, err, "Failed to authorize payment")
+		return
+	}
+	fraud, ok := h.assessCardPayment(w, r, card, account, req.Amount, req.Merchant, req.MerchantID, req.Category, now)
+	if !ok {
+		return
+	}
+
+	hold := storage.Hold{
+		ID:          storage.GenerateID(),
+		AccountID:   card.AccountID,
+		CardID:      card.ID,
+		Amount:      req.Amount,
+		Merchant:    req.Merchant,
+		MerchantID:  req.MerchantID,
+		Category:    req.Category,
+		Status:      storage.HoldActive,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(service.HoldConfig.TTL),
+		CapturedAmt: decimal.Zero,
+		Fraud:       &fraud,
+	}
+	release, err := h.svc.ReserveOperation(ctx, storage.OpCardPayment, req.Amount, account.Currency, now)
+	if err != nil {
+		respondStorageError(w, err, "Failed to authorize payment")
+		return
+	}
+	if err := h.svc.CreateHold(ctx, hold); err != nil {
+		release()
+		respondStorageError(w, err, "Failed to authorize payment")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, card.AccountID)
+	h.svc.NotifyHoldEvent(ctx, storage.ChargeAuthorized, hold)
+
+	log.Printf("Authorization %s: hold of %s on account %s for %s", hold.ID, req.Amount.String(), card.AccountID, req.Merchant)
+	respondJSON(w, http.StatusCreated, hold)
+}
+
+// holdParty — распоряжаться авторизацией могут мерчант, на которого она выдана (по X-Merchant-Key), и владелец
+// карты; для остальных холд неотличим от несуществующего
+func (h *Handler) holdParty(r *http.Request, hold storage.Hold) bool {
+	ctx := r.Context()
+	if key := r.Header.Get("X-Merchant-Key"); key != "" {
+		merchant, err := h.svc.AuthenticateMerchant(ctx, key, time.Now())
+		return err == nil && hold.MerchantID != "" && merchant.ID == hold.MerchantID
+	}
+	userID := sessionUserID(ctx)
+	if userID == "" {
+		return false
+	}
+	account, ok := h.svc.GetAccount(ctx, hold.AccountID)
+	if !ok {
+		return false
+	}
+	if account.OrganizationID != "" {
+		return h.svc.AuthorizeOrgAccount(ctx, account, userID, storage.OrgPermPay) == nil
+	}
+	return account.UserID == userID
+}
+
+func (h *Handler) CapturePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	authID := mux.Vars(r)["authId"]
+
+	var req storage.CaptureRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	hold, ok := h.svc.GetHold(ctx, authID)
+	if !ok || !h.holdParty(r, hold) {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Authorization %s not found", authID))
+		return
+	}
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = hold.Amount
+	}
+	if amount.IsNegative() {
+		respondError(w, http.StatusBadRequest, "Capture amount must be positive")
+		return
+	}
+	if account, ok := h.svc.GetAccount(ctx, hold.AccountID); ok {
+		if err := storage.ValidateAmount(amount, account.Currency); err != nil {
+			respondStorageError(w, err, "Failed to capture payment")
+			return
+		}
+	}
+
+	now := time.Now()
+	tx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   hold.AccountID,
+		Amount:          amount,
+		Timestamp:       now,
+		TransactionType: "payment",
+		Merchant:        hold.Merchant,
+		CardID:          hold.CardID,
+		Category:        hold.Category,
+		Fraud:           hold.Fraud,
+	}
+	if hold.MerchantID != "" {
+		merchant, ok := h.svc.GetMerchant(ctx, hold.MerchantID)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, "Merchant of the authorization not found")
+			return
+		}
+		applyMerchant(&tx, merchant)
+	}
+	tx.Describe(storage.DescCardPayment, map[string]string{"merchant": hold.Merchant})
+	hold, err := h.svc.CaptureHold(ctx, authID, amount, tx, now)
+	if err != nil {
+		respondStorageError(w, err, "Failed to capture payment")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, hold.AccountID)
+	if tx.ToAccountID != "" {
+		h.svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+	}
+	h.svc.NotifyHoldEvent(ctx, storage.ChargeCaptured, hold)
+
+	log.Printf("Authorization %s captured: %s of %s", authID, amount.String(), hold.Amount.String())
+	respondJSON(w, http.StatusOK, hold)
+}
+
+func (h *Handler) ReleasePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	authID := mux.Vars(r)["authId"]
+	if hold, ok := h.svc.GetHold(ctx, authID); !ok || !h.holdParty(r, hold) {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Authorization %s not found", authID))
+		return
+	}
+	hold, err := h.svc.ReleaseHold(ctx, authID, storage.HoldReleased, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to release authorization")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, hold.AccountID)
+	h.svc.NotifyHoldEvent(ctx, storage.ChargeVoided, hold)
+
+	log.Printf("Authorization %s released", authID)
+	respondJSON(w, http.StatusOK, hold)
+}
+
+func (h *Handler) RefundPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	transactionID := mux.Vars(r)["transactionId"]
+
+	var req storage.RefundRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	original, ok := h.svc.GetTransaction(ctx, transactionID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeTransactionNotFound, fmt.Sprintf("Transaction %s not found", transactionID))
+		return
+	}
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = original.Amount.Sub(h.svc.GetRefundedAmount(ctx, transactionID))
+	}
+	if amount.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Refund amount must be positive")
+		return
+	}
+	if account, ok := h.svc.GetAccount(ctx, original.FromAccountID); ok {
+		if err := storage.ValidateAmount(amount, account.Currency); err != nil {
+			respondStorageError(w, err, "Failed to process refund")
+			return
+		}
+	}
+
+	refund := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   original.ToAccountID,
+		ToAccountID:     original.FromAccountID,
+		Amount:          amount,
+		Timestamp:       time.Now(),
+		TransactionType: "refund",
+		Merchant:        original.Merchant,
+		MerchantID:      original.MerchantID,
+		LinkedTxID:      original.ID,
+	}
+	refund.Describe(storage.DescRefund, map[string]string{"merchant": original.Merchant, "reason": req.Reason})
+	if err := h.svc.RefundPayment(ctx, refund); err != nil {
+		respondStorageError(w, err, "Failed to process refund")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, original.FromAccountID)
+	if original.ToAccountID != "" {
+		h.svc.PublishBalanceChanged(ctx, original.ToAccountID)
+	}
+	h.svc.NotifyChargeEvent(ctx, storage.ChargeRefunded, refund)
+
+	if account, ok := h.svc.GetAccount(ctx, original.FromAccountID); ok {
+		if user, ok := h.svc.GetUser(ctx, account.UserID); ok {
+			h.svc.QueueEmail(ctx, user.Email, "Simple Bank: refund received",
+				fmt.Sprintf("Hello %s,\n\nA refund of %s from %s has been credited to account %s.",
+					user.Username, amount.String(), original.Merchant, account.Number))
+		}
+	}
+
+	log.Printf("Refund %s of %s for payment %s processed", refund.ID, amount.String(), original.ID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"refund":         refund,
+		"total_refunded": h.svc.GetRefundedAmount(ctx, original.ID),
+	})
+}
+
+func (h *Handler) ReverseDepositHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	transactionID := mux.Vars(r)["transactionId"]
+
+	var req storage.ReverseDepositRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	result, err := h.svc.ReverseDeposit(ctx, transactionID, req.Reason, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to reverse deposit")
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) ListReceivablesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status := r.URL.Query().Get("status")
+	if status != "" && status != storage.ReceivableOpen && status != storage.ReceivableSettled {
+		respondError(w, http.StatusBadRequest, "status must be open or settled")
+		return
+	}
+
+	receivables := h.svc.ListReceivables(ctx, status)
+	total := decimal.Zero
+	for _, rec := range receivables {
+		total = total.Add(rec.Outstanding)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"receivables":       receivables,
+		"total_outstanding": total,
+	})
+}
+
+func (h *Handler) RegisterMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.RegisterMerchantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	merchant, err := h.svc.RegisterMerchant(ctx, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to register merchant")
+		return
+	}
+	log.Printf("Merchant registered: %s (%s), settlement account %s", merchant.Name, merchant.ID, merchant.SettlementAccountID)
+	respondJSON(w, http.StatusCreated, merchant)
+}
+
+func (h *Handler) ListMerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListMerchants(r.Context()))
+}
+
+func (h *Handler) CreateMerchantKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchantID := mux.Vars(r)["merchantId"]
+	key, secret, err := h.svc.IssueMerchantAPIKey(ctx, merchantID, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to issue merchant key")
+		return
+	}
+
+	log.Printf("Merchant %s: API key %s issued", merchantID, key.Prefix)
+	// Ключ показывается только при выпуске
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"key":    key,
+		"secret": secret,
+	})
+}
+
+func (h *Handler) ListMerchantKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchantID := mux.Vars(r)["merchantId"]
+	if _, ok := h.svc.GetMerchant(ctx, merchantID); !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Merchant %s not found", merchantID))
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.GetMerchantAPIKeys(ctx, merchantID))
+}
+
+func (h *Handler) RevokeMerchantKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	key, err := h.svc.RevokeMerchantAPIKey(ctx, vars["merchantId"], vars["keyId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to revoke merchant key")
+		return
+	}
+	log.Printf("Merchant %s: API key %s revoked", key.MerchantID, key.Prefix)
+	respondJSON(w, http.StatusOK, key)
+}
+
+// GetMerchantPaymentsHandler — поступившие мерчанту оплаты и возвраты за период (по умолчанию с начала месяца)
+func (h *Handler) GetMerchantPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	from, to, err := service.ParseStatementPeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	payments := h.svc.MerchantPayments(ctx, merchant.ID, from, to)
+	sort.Slice(payments, func(i, j int) bool { return payments[i].Timestamp.After(payments[j].Timestamp) })
+	page, pageSize := parsePagination(r)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"merchant_id": merchant.ID,
+		"total":       len(payments),
+		"page":        page,
+		"page_size":   pageSize,
+		"payments":    paginate(payments, page, pageSize),
+	})
+}
+
+// GetRateHistoryHandler — сохранённые курсы ЦБ или ключевая ставка по дням за период (по умолчанию с начала месяца)
+func (h *Handler) GetRateHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := service.ParseStatementPeriod(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rates, err := h.svc.RateHistory(r.Context(), query.Get("kind"), query.Get("currency"), from, to)
+	if err != nil {
+		respondStorageError(w, err, "Failed to get rate history")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+		"rates": rates,
+	})
+}
+
+func (h *Handler) GetMerchantSettlementsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	from, to, err := service.ParseStatementPeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"merchant_id":           merchant.ID,
+		"settlement_account_id": merchant.SettlementAccountID,
+		"days":                  h.svc.MerchantSettlements(ctx, merchant, from, to),
+	})
+}
+
+// FileChargebackHandler — клиент оспаривает оплату мерчанту; из login-сессии спор доступен только по своим оплатам
+func (h *Handler) FileChargebackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	transactionID := mux.Vars(r)["transactionId"]
+
+	var req storage.ChargebackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	userID := ""
+	if session, ok := sessionFromContext(ctx); ok {
+		userID = session.UserID
+	}
+	cb, err := h.svc.FileChargeback(ctx, userID, transactionID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to file chargeback")
+		return
+	}
+	respondJSON(w, http.StatusCreated, cb)
+}
+
+func (h *Handler) GetUserChargebacksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	respondJSON(w, http.StatusOK, h.svc.ListChargebacks(ctx, "", userID, r.URL.Query().Get("status")))
+}
+
+func (h *Handler) GetMerchantChargebacksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	respondJSON(w, http.StatusOK, h.svc.ListChargebacks(ctx, merchant.ID, "", r.URL.Query().Get("status")))
+}
+
+func (h *Handler) SubmitChargebackEvidenceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	chargebackID := mux.Vars(r)["chargebackId"]
+
+	var req storage.ChargebackEvidenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	cb, err := h.svc.SubmitChargebackEvidence(ctx, merchantFromContext(ctx), chargebackID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to submit evidence")
+		return
+	}
+	log.Printf("Chargeback %s: evidence submitted by merchant %s", cb.ID, cb.MerchantID)
+	respondJSON(w, http.StatusOK, cb)
+}
+
+func (h *Handler) GetMerchantWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	hook, ok := h.svc.GetMerchantWebhook(ctx, merchant.ID)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Webhook is not configured")
+		return
+	}
+	respondJSON(w, http.StatusOK, hook)
+}
+
+func (h *Handler) SetMerchantWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.MerchantWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	merchant := merchantFromContext(ctx)
+	hook, secret, err := h.svc.SetMerchantWebhook(ctx, merchant.ID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to configure webhook")
+		return
+	}
+	log.Printf("Merchant %s: webhook set to %s %v", merchant.ID, hook.URL, hook.Events)
+	if secret == "" {
+		respondJSON(w, http.StatusOK, map[string]interface{}{"webhook": hook})
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"webhook": hook,
+		"secret":  secret,
+	})
+}
+
+func (h *Handler) DeleteMerchantWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	if err := h.svc.DeleteMerchantWebhook(ctx, merchant.ID); err != nil {
+		respondStorageError(w, err, "Failed to delete webhook")
+		return
+	}
+	log.Printf("Merchant %s: webhook deleted", merchant.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RotateMerchantWebhookSecretHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	hook, secret, err := h.svc.RotateMerchantWebhookSecret(ctx, merchant.ID, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to rotate webhook secret")
+		return
+	}
+	log.Printf("Merchant %s: webhook secret rotated", merchant.ID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"webhook": hook,
+		"secret":  secret,
+	})
+}
+
+func (h *Handler) TestMerchantWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	delivery, err := h.svc.SendTestMerchantEvent(ctx, merchant.ID, r.URL.Query().Get("event"))
+	if err != nil {
+		respondStorageError(w, err, "Failed to send test event")
+		return
+	}
+	respondJSON(w, http.StatusOK, delivery)
+}
+
+func (h *Handler) GetMerchantWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	merchant := merchantFromContext(ctx)
+	q := r.URL.Query()
+	respondJSON(w, http.StatusOK, h.svc.GetMerchantWebhookDeliveries(ctx, merchant.ID, q.Get("event"), q.Get("failed") == "true"))
+}
+
+func (h *Handler) ListChargebacksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSON(w, http.StatusOK, h.svc.ListChargebacks(ctx, r.URL.Query().Get("merchant_id"), "", r.URL.Query().Get("status")))
+}
+
+func (h *Handler) ResolveChargebackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	var req storage.ResolveChargebackRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	cb, err := h.svc.ResolveChargeback(ctx, vars["chargebackId"], vars["decision"] == "accept", req.Resolution, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to resolve chargeback")
+		return
+	}
+	respondJSON(w, http.StatusOK, cb)
+}
+
+// deviceSignature — подпись списания ключом устройства из заголовков X-Device-*
+func deviceSignature(r *http.Request) storage.DeviceSignature {
+	return storage.DeviceSignature{
+		KeyID:     r.Header.Get("X-Device-Key-Id"),
+		Timestamp: r.Header.Get("X-Device-Timestamp"),
+		Signature: r.Header.Get("X-Device-Signature"),
+	}
+}
+
+func (h *Handler) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.ToAccountID == "" && req.ToAccountNumber != "" {
+		if err := storage.ValidateAccountNumber(req.ToAccountNumber); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		toAccount, ok := h.svc.GetAccountByNumber(ctx, req.ToAccountNumber)
+		if !ok {
+			respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Destination account number %s not found", req.ToAccountNumber))
+			return
+		}
+		req.ToAccountID = toAccount.ID
+	}
+
+	if req.FromAccountID == req.ToAccountID {
+		respondError(w, http.StatusBadRequest, "Cannot transfer to the same account")
+		return
+	}
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Transfer amount must be positive")
+		return
+	}
+
+	now := time.Now()
+	fromAccount, ok := h.svc.GetAccount(ctx, req.FromAccountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Source account %s not found", req.FromAccountID))
+		return
+	}
+	if !h.orgAccountAllows(w, r, fromAccount, storage.OrgPermPay) {
+		return
+	}
+	if err := storage.ValidateAmount(req.Amount, fromAccount.Currency); err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+	releaseLimit, err := h.svc.ReserveTransferLimit(ctx, fromAccount, req.Amount, now)
+	if err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+	defer releaseLimit()
+	var toAccount *storage.Account
+	if acc, ok := h.svc.GetAccount(ctx, req.ToAccountID); ok {
+		toAccount = &acc
+	}
+	if err := h.svc.CheckTierLimits(ctx, &fromAccount, toAccount, req.Amount, now); err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+	signature := deviceSignature(r)
+	deviceKey, err := h.svc.RequireTransferSignature(ctx, fromAccount, req.ToAccountID, req.Amount, signature, now)
+	if err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+	if required, err := h.svc.PaymentApprovalRequired(ctx, fromAccount, req.Amount); err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	} else if required {
+		approval, err := h.svc.RequestPaymentApproval(ctx, fromAccount, req.ToAccountID, req.Amount, sessionUserID(ctx), now)
+		if err != nil {
+			respondStorageError(w, err, "Transfer failed")
+			return
+		}
+		respondJSON(w, http.StatusAccepted, approval)
+		return
+	}
+	release, err := h.svc.ReserveOperation(ctx, storage.OpTransfer, req.Amount, fromAccount.Currency, now)
+	if err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+	tx, err := h.svc.TransferFunds(ctx, req.FromAccountID, req.ToAccountID, req.Amount, now)
+	if err != nil {
+		release()
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+	if deviceKey != nil {
+		h.svc.AuditSignedTransfer(ctx, *deviceKey, tx.ID, signature, fromAccount, req.ToAccountID, req.Amount, now)
+	}
+
+	go func() {
+		// Запрос к этому моменту уже завершён, его отмена не должна терять события
+		ctx := context.WithoutCancel(ctx)
+		h.svc.PublishBalanceChanged(ctx, req.FromAccountID)
+		h.svc.PublishBalanceChanged(ctx, req.ToAccountID)
+	}()
+
+	log.Printf("Transfer of %s from %s to %s successful", req.Amount.String(), req.FromAccountID, req.ToAccountID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Transfer successful"})
+}
+
+// P2PTransferHandler — перевод по телефону или логину. Без confirmation_token отвечает данными получателя
+// для подтверждения, с токеном из ответа — выполняет перевод.
+func (h *Handler) P2PTransferHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.P2PTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	now := time.Now()
+	userID := sessionUserID(ctx)
+	if req.ConfirmationToken == "" {
+		confirmation, err := h.svc.PrepareP2PTransfer(ctx, userID, req, now)
+		if err != nil {
+			respondStorageError(w, err, "Failed to resolve recipient")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"status":    "confirmation_required",
+			"recipient": confirmation,
+		})
+		return
+	}
+
+	tx, err := h.svc.ExecuteP2PTransfer(ctx, userID, req, deviceSignature(r), now)
+	if err != nil {
+		respondStorageError(w, err, "Transfer failed")
+		return
+	}
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		h.svc.PublishBalanceChanged(ctx, tx.FromAccountID)
+		h.svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+	}()
+
+	log.Printf("P2P transfer of %s from %s to %s successful", req.Amount.String(), tx.FromAccountID, req.To)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "completed",
+		"transaction_id": tx.ID,
+		"amount":         tx.Amount,
+	})
+}
+
+func (h *Handler) SetAliasHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+
+	var req storage.AliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.svc.GetUser(ctx, userID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	alias, err := h.svc.RegisterAlias(ctx, user, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to register alias")
+		return
+	}
+	log.Printf("Alias %s registered for user %s -> account %s", alias.Key(), userID, alias.AccountID)
+	respondJSON(w, http.StatusOK, alias)
+}
+
+// RegisterDeviceKeyHandler привязывает ключ подписи устройства; доступно только из login-сессии владельца,
+// иначе украденный API-токен позволил бы подменить ключ
+func (h *Handler) RegisterDeviceKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	session, ok := sessionFromContext(ctx)
+	if !ok || session.Kind != storage.SessionKindLogin || session.UserID != userID {
+		respondError(w, http.StatusUnauthorized, "Device keys can only be registered from the owner's login session")
+		return
+	}
+
+	var req storage.DeviceKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	key, err := h.svc.RegisterDeviceKey(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to register device key")
+		return
+	}
+	h.recordSecurityEvent(r, userID, storage.SecurityDeviceKeyRegistered, map[string]string{"key_id": key.ID, "algorithm": key.Algorithm})
+	log.Printf("Device key %s (%s) registered for user %s", key.ID, key.Algorithm, userID)
+	respondJSON(w, http.StatusCreated, key)
+}
+
+func (h *Handler) GetDeviceKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.ListDeviceKeys(r.Context(), userID))
+}
+
+func (h *Handler) RevokeDeviceKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	session, ok := sessionFromContext(ctx)
+	if !ok || session.Kind != storage.SessionKindLogin || session.UserID != vars["userId"] {
+		respondError(w, http.StatusUnauthorized, "Device keys can only be revoked from the owner's login session")
+		return
+	}
+	key, err := h.svc.RevokeDeviceKey(ctx, vars["userId"], vars["keyId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to revoke device key")
+		return
+	}
+	respondJSON(w, http.StatusOK, key)
+}
+
+func (h *Handler) GetAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.GetUserAliases(r.Context(), userID))
+}
+
+func (h *Handler) DeleteAliasHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !userSelf(w, r, vars["userId"]) {
+		return
+	}
+	value := vars["value"]
+	if vars["type"] == storage.AliasPhone {
+		phone, err := service.NormalizePhone(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		value = phone
+	} else {
+		value = strings.ToLower(value)
+	}
+	if err := h.svc.DeleteAlias(ctx, vars["userId"], vars["type"], value); err != nil {
+		respondStorageError(w, err, "Failed to delete alias")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) CreateInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateInvoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	inv, err := h.svc.CreateInvoice(ctx, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to create invoice")
+		return
+	}
+	respondJSON(w, http.StatusCreated, inv)
+}
+
+// GetInvoiceHandler — страница платёжной ссылки: плательщик видит сумму, назначение и замаскированного получателя
+func (h *Handler) GetInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	view, err := h.svc.InvoiceView(r.Context(), mux.Vars(r)["invoiceId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to get invoice")
+		return
+	}
+	respondJSON(w, http.StatusOK, view)
+}
+
+func (h *Handler) PayInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.PayInvoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	inv, tx, err := h.svc.PayInvoice(ctx, mux.Vars(r)["invoiceId"], sessionUserID(ctx), req, deviceSignature(r), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Invoice payment failed")
+		return
+	}
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		h.svc.PublishBalanceChanged(ctx, tx.FromAccountID)
+		h.svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+	}()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         inv.Status,
+		"invoice_id":     inv.ID,
+		"transaction_id": tx.ID,
+		"amount":         tx.Amount,
+	})
+}
+
+func (h *Handler) CancelInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	inv, err := h.svc.CancelInvoice(ctx, mux.Vars(r)["invoiceId"], sessionUserID(ctx), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to cancel invoice")
+		return
+	}
+	respondJSON(w, http.StatusOK, inv)
+}
+
+// GetUserInvoicesHandler — счета, выставленные пользователем; ?status=open|paid|expired|cancelled|unpaid
+func (h *Handler) GetUserInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	invoices, err := h.svc.UserInvoices(ctx, mux.Vars(r)["userId"], r.URL.Query().Get("status"), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to list invoices")
+		return
+	}
+	respondJSON(w, http.StatusOK, invoices)
+}
+
+func (h *Handler) CreatePaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateMoneyRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+	if _, ok := h.ownAccount(w, r, req.AccountID); !ok {
+		return
+	}
+
+	pr, err := h.svc.CreateMoneyRequest(ctx, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to create payment request")
+		return
+	}
+	respondJSON(w, http.StatusCreated, pr)
+}
+
+// GetPaymentRequestHandler — запрос денег; с сессией виден только запросившему и плательщику
+func (h *Handler) GetPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pr, err := h.svc.MoneyRequestFor(ctx, mux.Vars(r)["requestId"], sessionUserID(ctx), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to get payment request")
+		return
+	}
+	respondJSON(w, http.StatusOK, pr)
+}
+
+func (h *Handler) AcceptPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.AcceptMoneyRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	pr, tx, err := h.svc.AcceptMoneyRequest(ctx, mux.Vars(r)["requestId"], sessionUserID(ctx), req, deviceSignature(r), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to accept payment request")
+		return
+	}
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		h.svc.PublishBalanceChanged(ctx, tx.FromAccountID)
+		h.svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+	}()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":             pr.Status,
+		"payment_request_id": pr.ID,
+		"transaction_id":     tx.ID,
+		"amount":             tx.Amount,
+	})
+}
+
+func (h *Handler) DeclinePaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.DeclineMoneyRequestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	pr, err := h.svc.DeclineMoneyRequest(ctx, mux.Vars(r)["requestId"], sessionUserID(ctx), req.Reason, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to decline payment request")
+		return
+	}
+	respondJSON(w, http.StatusOK, pr)
+}
+
+func (h *Handler) CancelPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pr, err := h.svc.CancelMoneyRequest(ctx, mux.Vars(r)["requestId"], sessionUserID(ctx), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to cancel payment request")
+		return
+	}
+	respondJSON(w, http.StatusOK, pr)
+}
+
+// GetUserPaymentRequestsHandler — запросы денег пользователя; ?role=incoming|outgoing&status=pending|accepted|...
+func (h *Handler) GetUserPaymentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	requests, err := h.svc.UserMoneyRequests(ctx, mux.Vars(r)["userId"], query.Get("role"), query.Get("status"), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to list payment requests")
+		return
+	}
+	respondJSON(w, http.StatusOK, requests)
+}
+
+func (h *Handler) CreateEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateEscrowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	e, err := h.svc.CreateEscrow(ctx, sessionUserID(ctx), req, deviceSignature(r), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to fund escrow")
+		return
+	}
+	respondJSON(w, http.StatusCreated, e)
+}
+
+// GetEscrowHandler — статус сделки; участникам с сессией видны только свои сделки
+func (h *Handler) GetEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	escrowID := mux.Vars(r)["escrowId"]
+	e, ok := h.svc.GetEscrow(ctx, escrowID)
+	if userID := sessionUserID(ctx); !ok || (userID != "" && userID != e.BuyerUserID && userID != e.SellerUserID) {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeEscrowNotFound, fmt.Sprintf("Escrow %s not found", escrowID))
+		return
+	}
+	respondJSON(w, http.StatusOK, e)
+}
+
+// EscrowActionHandler — действия сторон: fulfill (продавец), release и dispute (покупатель)
+func (h *Handler) EscrowActionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID := sessionUserID(ctx)
+	now := time.Now()
+
+	var e storage.Escrow
+	var err error
+	switch vars["action"] {
+	case "fulfill":
+		e, err = h.svc.FulfillEscrow(ctx, vars["escrowId"], userID, now)
+	case "release":
+		e, err = h.svc.ReleaseEscrow(ctx, vars["escrowId"], userID, now)
+	case "dispute":
+		var req storage.EscrowDisputeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+		e, err = h.svc.DisputeEscrow(ctx, vars["escrowId"], userID, req.Reason, now)
+	}
+	if err != nil {
+		respondStorageError(w, err, "Escrow action failed")
+		return
+	}
+	respondJSON(w, http.StatusOK, e)
+}
+
+func (h *Handler) GetUserEscrowsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSON(w, http.StatusOK, h.svc.ListEscrows(ctx, mux.Vars(r)["userId"], r.URL.Query().Get("status")))
+}
+
+func (h *Handler) ListEscrowsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSON(w, http.StatusOK, h.svc.ListEscrows(ctx, "", r.URL.Query().Get("status")))
+}
+
+func (h *Handler) ResolveEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	var req storage.EscrowDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	e, err := h.svc.ResolveEscrowDispute(ctx, vars["escrowId"], vars["decision"] == "release", req.Resolution, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to resolve escrow dispute")
+		return
+	}
+	respondJSON(w, http.StatusOK, e)
+}
+
+// MetricsHandler отдаёт бизнес-метрики в текстовом формате Prometheus
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := h.svc.WriteMetrics(r.Context(), w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
+
+// EmailDeliveriesHandler — последние отправленные письма и их статус у провайдера, ?status= и ?to= фильтруют
+func EmailDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	respondJSON(w, http.StatusOK, service.EmailDeliveries(query.Get("status"), query.Get("to")))
+}
+
+// ListEmailQueueHandler — письма, ожидающие повтора, и dead-letter; ?status=dead оставляет только исчерпавшие попытки
+func (h *Handler) ListEmailQueueHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListEmailNotifications(r.Context(), r.URL.Query().Get("status")))
+}
+
+func (h *Handler) RequeueEmailHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := h.svc.RequeueEmail(r.Context(), mux.Vars(r)["notificationId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to requeue email")
+		return
+	}
+	respondJSON(w, http.StatusOK, n)
+}
+
+// MetricsOverviewHandler — сводка по банку для админской панели; X-Cache показывает, пересчитана ли она
+func (h *Handler) MetricsOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	overview, cached := h.svc.BankOverview(r.Context(), time.Now())
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	respondJSON(w, http.StatusOK, overview)
+}
+
+// ReconciliationHandler — сверка остатков всех счетов с журналом; расхождения отдаются по убыванию суммы
+func (h *Handler) ReconciliationHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ReconcileLedger(r.Context(), time.Now()))
+}
+
+func (h *Handler) ListOperationControlsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.OperationControls(r.Context(), time.Now()))
+}
+
+// SetOperationControlHandler — выключатель и дневной лимит типа операции; действует сразу для всех клиентов
+func (h *Handler) SetOperationControlHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.OperationControlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	view, err := h.svc.SetOperationControl(ctx, mux.Vars(r)["type"], req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to update operation control")
+		return
+	}
+	respondJSON(w, http.StatusOK, view)
+}
+
+func (h *Handler) RequestLimitOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+	account, ok := h.svc.GetAccount(ctx, accountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+
+	var req storage.LimitOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	override, err := h.svc.RequestLimitOverride(ctx, account, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to request limit override")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, override)
+}
+
+func (h *Handler) GetAccountLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+	account, ok := h.svc.GetAccount(ctx, accountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+
+	now := time.Now()
+	limit, active := h.svc.EffectiveTransferLimit(ctx, account, now)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"account_id":            account.ID,
+		"daily_transfer_limit":  account.DailyTransferLimit,
+		"effective_daily_limit": limit,
+		"transferred_today":     h.svc.TransferredSince(ctx, account.ID, service.StartOfDay(now)),
+		"active_override":       active,
+		"override_requests":     h.svc.ListLimitOverrides(ctx, account.ID, ""),
+	})
+}
+
+func (h *Handler) ListLimitOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = storage.LimitOverridePending
+	}
+	if status == "all" {
+		status = ""
+	}
+	respondJSON(w, http.StatusOK, h.svc.ListLimitOverrides(ctx, "", status))
+}
+
+// DecideLimitOverrideHandler обслуживает /approve и /reject; тело запроса необязательно
+func (h *Handler) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	user, ok := h.svc.GetUser(ctx, userID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+
+	var req storage.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	user, err := h.svc.UpdateProfile(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to update profile")
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+// GetUserLimitsHandler — лимиты уровня KYC и их использование на сегодня
+func (h *Handler) GetUserLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	user, ok := h.svc.GetUser(ctx, userID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	limits, err := h.svc.UserLimits(ctx, user, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to calculate limits")
+		return
+	}
+	respondJSON(w, http.StatusOK, limits)
+}
+
+func (h *Handler) GetCreditScoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	score, err := h.svc.UserCreditScore(ctx, userID, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to calculate credit score")
+		return
+	}
+	respondJSON(w, http.StatusOK, score)
+}
+
+func (h *Handler) ListPendingKYCHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.PendingKYC(r.Context()))
+}
+
+func (h *Handler) ReviewKYCHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	var req storage.KYCDecisionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	user, err := h.svc.ReviewKYC(ctx, vars["userId"], vars["decision"] == "verify", req.Reason, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to review KYC")
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) DecideLimitOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	var decision storage.LimitOverrideDecision
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	override, err := h.svc.DecideLimitOverride(ctx, vars["overrideId"], vars["decision"] == "approve", decision, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to decide limit override")
+		return
+	}
+	respondJSON(w, http.StatusOK, override)
+}
+
+// PostBackdatedTransactionHandler — перенос исторической операции с датой валютирования (только для миграций)
+func (h *Handler) PostBackdatedTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.BackdatedTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	tx, err := h.svc.PostBackdatedTransaction(ctx, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to post back-dated transaction")
+		return
+	}
+	respondJSON(w, http.StatusCreated, tx)
+}
+
+func (h *Handler) CreateBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateBroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	broadcast, err := h.svc.CreateBroadcast(ctx, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to create broadcast")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, broadcast)
+}
+
+func (h *Handler) ListBroadcastsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListBroadcasts(r.Context()))
+}
+
+func (h *Handler) GetBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	broadcastID := mux.Vars(r)["broadcastId"]
+	broadcast, ok := h.svc.GetBroadcast(r.Context(), broadcastID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Broadcast %s not found", broadcastID))
+		return
+	}
+	respondJSON(w, http.StatusOK, broadcast)
+}
+
+// GetBroadcastRecipientsHandler — статус доставки по каждому получателю, ?status= фильтрует
+func (h *Handler) GetBroadcastRecipientsHandler(w http.ResponseWriter, r *http.Request) {
+	recipients, err := h.svc.GetBroadcastRecipients(r.Context(), mux.Vars(r)["broadcastId"], r.URL.Query().Get("status"))
+	if err != nil {
+		respondStorageError(w, err, "Failed to get broadcast recipients")
+		return
+	}
+	respondJSON(w, http.StatusOK, recipients)
+}
+
+// ImportPaymentsHandler принимает файл pain.001 (XML) или упрощённый CSV и ставит пакет платежей в очередь.
+// Формат определяется параметром format или Content-Type.
+func (h *Handler) ImportPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, service.MaxImportFileSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read payment file: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+			format = "csv"
+		} else {
+			format = "pain.001"
+		}
+	}
+
+	var report storage.PaymentImportReport
+	switch format {
+	case "pain.001", "xml":
+		report, err = service.ParsePain001(data)
+	case "csv":
+		report, err = service.ParsePaymentCSV(data)
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported payment file format %s", format))
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	op := storage.Operation{
+		ID:        storage.GenerateID(),
+		Type:      "payment_import",
+		Status:    storage.OperationPending,
+		CreatedAt: time.Now(),
+		Result:    report,
+	}
+	h.svc.SaveOperation(ctx, op)
+
+	go h.svc.ProcessPaymentImport(context.WithoutCancel(ctx), op, sessionUserID(ctx), report)
+
+	log.Printf("Payment import %s queued: %d payments, message %s (operation %s)", report.Format, report.Total, report.MessageID, op.ID)
+	respondJSON(w, http.StatusAccepted, op)
+}
+
+// ImportTransactionsHandler загружает историю счёта из CSV-выписки другого банка по описанию колонок
+func (h *Handler) ImportTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.ownAccount(w, r, mux.Vars(r)["accountId"])
+	if !ok {
+		return
+	}
+	var req storage.ImportTransactionsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, service.MaxImportFileSize)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	report, err := h.svc.ImportTransactions(ctx, account, sessionUserID(ctx), req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to import transactions")
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// GetPaymentImportReportHandler отдаёт отчёт о пакете платежей в JSON или CSV
+func (h *Handler) GetPaymentImportReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	operationID := mux.Vars(r)["operationId"]
+	op, ok := h.svc.GetOperation(ctx, operationID)
+	if !ok || op.Type != "payment_import" {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Payment import %s not found", operationID))
+		return
+	}
+	report, ok := op.Result.(storage.PaymentImportReport)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Payment import report is unavailable")
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"operation_id": op.ID,
+			"status":       op.Status,
+			"report":       report,
+		})
+	case "csv":
+		data, err := service.FormatPaymentReportCSV(report)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to build CSV: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "payment-import-"+op.ID+".csv"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported report format %s", format))
+	}
+}
+
+func (h *Handler) ExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.ExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Exchange amount must be positive")
+		return
+	}
+
+	fromAccount, okFrom := h.svc.GetAccount(ctx, req.FromAccountID)
+	toAccount, okTo := h.svc.GetAccount(ctx, req.ToAccountID)
+	if !okFrom {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Source account %s not found", req.FromAccountID))
+		return
+	}
+	if !okTo {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Destination account %s not found", req.ToAccountID))
+		return
+	}
+	if (fromAccount.OrganizationID == "" && fromAccount.UserID != toAccount.UserID) || fromAccount.OrganizationID != toAccount.OrganizationID {
+		respondError(w, http.StatusBadRequest, "Exchange is only allowed between accounts of the same user")
+		return
+	}
+	if !h.orgAccountAllows(w, r, fromAccount, storage.OrgPermPay) {
+		return
+	}
+	if fromAccount.Currency == toAccount.Currency {
+		respondError(w, http.StatusBadRequest, "Accounts have the same currency, use /transfers")
+		return
+	}
+	if err := storage.ValidateAmount(req.Amount, fromAccount.Currency); err != nil {
+		respondStorageError(w, err, "Exchange failed")
+		return
+	}
+
+	rate, credited, err := h.svc.QuoteExchange(ctx, fromAccount.Currency, toAccount.Currency, req.Amount)
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, fmt.Sprintf("Exchange rate unavailable: %v", err))
+		return
+	}
+	if credited.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Exchange amount is too small")
+		return
+	}
+
+	now := time.Now()
+	outTx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   fromAccount.ID,
+		Amount:          req.Amount,
+		Timestamp:       now,
+		TransactionType: "exchange_out",
+	}
+	outTx.Describe(storage.DescExchangeOut, map[string]string{
+		"amount": req.Amount.String(), "from_currency": fromAccount.Currency, "to_currency": toAccount.Currency, "rate": rate.String(),
+	})
+	inTx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		ToAccountID:     toAccount.ID,
+		Amount:          credited,
+		Timestamp:       now,
+		TransactionType: "exchange_in",
+	}
+	inTx.Describe(storage.DescExchangeIn, map[string]string{
+		"amount": req.Amount.String(), "from_currency": fromAccount.Currency, "credited": credited.String(), "to_currency": toAccount.Currency,
+	})
+	outTx.LinkedTxID = inTx.ID
+	inTx.LinkedTxID = outTx.ID
+
+	release, err := h.svc.ReserveOperation(ctx, storage.OpExchange, req.Amount, fromAccount.Currency, now)
+	if err != nil {
+		respondStorageError(w, err, "Exchange failed")
+		return
+	}
+	if err := h.svc.ExchangeFunds(ctx, outTx, inTx, req.Amount, credited); err != nil {
+		release()
+		respondStorageError(w, err, "Failed to process exchange")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, fromAccount.ID)
+	h.svc.PublishBalanceChanged(ctx, toAccount.ID)
+
+	log.Printf("Exchange %s %s -> %s %s for user %s (rate %s)", req.Amount.String(), fromAccount.Currency, credited.String(), toAccount.Currency, fromAccount.UserID, rate.String())
+	respondJSON(w, http.StatusOK, storage.ExchangeQuote{
+		FromCurrency:   fromAccount.Currency,
+		ToCurrency:     toAccount.Currency,
+		Rate:           rate,
+		SpreadPercent:  service.ExchangeConfig.SpreadPercent,
+		DebitedAmount:  req.Amount,
+		CreditedAmount: credited,
+		OutTransaction: outTx,
+		InTransaction:  inTx,
+	})
+}
+
+func (h *Handler) SetFXSweepRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+
+	var req storage.FXSweepRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.TargetAccountID == "" || req.Threshold.IsNegative() {
+		respondError(w, http.StatusBadRequest, "Target account is required and threshold must not be negative")
+		return
+	}
+
+	rule := storage.FXSweepRule{
+		UserID:          userID,
+		TargetAccountID: req.TargetAccountID,
+		Threshold:       req.Threshold,
+		Enabled:         req.Enabled,
+		UpdatedAt:       time.Now(),
+	}
+	if err := h.svc.SetFXSweepRule(ctx, rule); err != nil {
+		respondStorageError(w, err, "Failed to save FX sweep rule")
+		return
+	}
+
+	log.Printf("FX sweep rule updated for user %s (enabled=%t)", userID, rule.Enabled)
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) GetFXSweepRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	rule, ok := h.svc.GetFXSweepRule(ctx, userID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("FX sweep rule for user %s not found", userID))
+		return
+	}
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteFXSweepRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	if err := h.svc.DeleteFXSweepRule(ctx, userID); err != nil {
+		respondStorageError(w, err, "Failed to delete FX sweep rule")
+		return
+	}
+	log.Printf("FX sweep rule removed for user %s", userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "FX sweep rule deleted"})
+}
+
+func (h *Handler) GetBankConnectorsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.BankConnectors())
+}
+
+// LinkBankHandler подключает счёт в другом банке; данные доступа передаёт только сам пользователь
+func (h *Handler) LinkBankHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !credentialOwner(w, r, userID) {
+		return
+	}
+	var req storage.LinkBankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	link, err := h.svc.LinkBank(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to link bank")
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"link":     link,
+		"accounts": h.svc.ListExternalAccounts(ctx, userID),
+	})
+}
+
+func (h *Handler) GetBankLinksHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListBankLinks(r.Context(), mux.Vars(r)["userId"]))
+}
+
+// SyncBankLinkHandler обновляет подключение сразу, не дожидаясь фоновой синхронизации
+func (h *Handler) SyncBankLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if link, ok := h.svc.GetBankLink(ctx, vars["linkId"]); !ok || link.UserID != vars["userId"] {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Bank link %s not found", vars["linkId"]))
+		return
+	}
+	link, err := h.svc.SyncBankLink(ctx, vars["linkId"], time.Now())
+	if err != nil && link.ID == "" {
+		respondStorageError(w, err, "Failed to sync bank link")
+		return
+	}
+	// Ошибка банка-источника — не ошибка запроса: она видна в status и last_error подключения
+	respondJSON(w, http.StatusOK, link)
+}
+
+func (h *Handler) UnlinkBankHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !credentialOwner(w, r, vars["userId"]) {
+		return
+	}
+	if err := h.svc.UnlinkBank(ctx, vars["userId"], vars["linkId"], time.Now()); err != nil {
+		respondStorageError(w, err, "Failed to unlink bank")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetExternalAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.svc.ListExternalAccounts(r.Context(), mux.Vars(r)["userId"]))
+}
+
+// GetExternalTransactionsHandler — операции внешнего счёта, новые первыми, страницами по page_size
+func (h *Handler) GetExternalTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	account, ok := h.svc.GetExternalAccount(ctx, vars["accountId"])
+	if !ok || account.UserID != vars["userId"] {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("External account %s not found", vars["accountId"]))
+		return
+	}
+	txs := h.svc.GetExternalTransactions(ctx, account.ID)
+	page, pageSize := parsePagination(r)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"account":      account,
+		"transactions": paginate(txs, page, pageSize),
+		"total":        len(txs),
+		"page":         page,
+		"page_size":    pageSize,
+	})
+}
+
+func (h *Handler) CreateAutoTransferRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+
+	var req storage.AutoTransferRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	rule, err := h.svc.CreateAutoTransferRule(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to create auto-transfer rule")
+		return
+	}
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+func (h *Handler) GetAutoTransferRulesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.ListAutoTransferRules(ctx, userID))
+}
+
+func (h *Handler) UpdateAutoTransferRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !userSelf(w, r, vars["userId"]) {
+		return
+	}
+
+	var req storage.AutoTransferRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	rule, err := h.svc.UpdateAutoTransferRule(ctx, vars["userId"], vars["ruleId"], req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to update auto-transfer rule")
+		return
+	}
+	log.Printf("Auto-transfer rule %s updated for user %s (enabled=%t)", rule.ID, rule.UserID, rule.Enabled)
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteAutoTransferRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	if !userSelf(w, r, vars["userId"]) {
+		return
+	}
+	if err := h.svc.DeleteAutoTransferRule(ctx, vars["userId"], vars["ruleId"]); err != nil {
+		respondStorageError(w, err, "Failed to delete auto-transfer rule")
+		return
+	}
+	log.Printf("Auto-transfer rule %s removed for user %s", vars["ruleId"], vars["userId"])
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Auto-transfer rule deleted"})
+}
+
+// orgAccountAllows проверяет роль пользователя сессии в организации — владельце счёта; при отказе отвечает сам.
+// Для личных счетов всегда true.
+func (h *Handler) orgAccountAllows(w http.ResponseWriter, r *http.Request, account storage.Account, perm string) bool {
+	if err := h.svc.AuthorizeOrgAccount(r.Context(), account, sessionUserID(r.Context()), perm); err != nil {
+		respondStorageError(w, err, "Account access check failed")
+		return false
+	}
+	return true
+}
+
+// accountVisible — счёт виден пользователю сессии: личный — владельцу, счёт организации — её участникам
+func (h *Handler) accountVisible(ctx context.Context, account storage.Account, userID string) bool {
+	if account.OrganizationID != "" {
+		return h.svc.AuthorizeOrgAccount(ctx, account, userID, storage.OrgPermView) == nil
+	}
+	return account.UserID == userID
+}
+
+// ownAccount находит счёт и, если запрос пришёл с сессией, проверяет, что он принадлежит её владельцу;
+// чужой счёт неотличим от несуществующего
+func (h *Handler) ownAccount(w http.ResponseWriter, r *http.Request, accountID string) (storage.Account, bool) {
+	ctx := r.Context()
+	account, ok := h.svc.GetAccount(ctx, accountID)
+	if ok {
+		if userID := sessionUserID(ctx); userID != "" && !h.accountVisible(ctx, account, userID) {
+			ok = false
+		}
+	}
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return storage.Account{}, false
+	}
+	return account, true
+}
+
+func (h *Handler) CreateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.ownAccount(w, r, mux.Vars(r)["accountId"])
+	if !ok {
+		return
+	}
+
+	var req storage.AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	rule, err := h.svc.CreateAlertRule(ctx, account, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to create alert rule")
+		return
+	}
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+func (h *Handler) GetAlertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.ownAccount(w, r, mux.Vars(r)["accountId"])
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.ListAlertRules(r.Context(), account.ID))
+}
+
+func (h *Handler) UpdateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	account, ok := h.ownAccount(w, r, vars["accountId"])
+	if !ok {
+		return
+	}
+
+	var req storage.AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	rule, err := h.svc.UpdateAlertRuleSettings(ctx, account.ID, vars["ruleId"], req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to update alert rule")
+		return
+	}
+	log.Printf("Alert rule %s updated for account %s (enabled=%t)", rule.ID, account.ID, rule.Enabled)
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	account, ok := h.ownAccount(w, r, vars["accountId"])
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteAlertRule(ctx, account.ID, vars["ruleId"]); err != nil {
+		respondStorageError(w, err, "Failed to delete alert rule")
+		return
+	}
+	log.Printf("Alert rule %s removed for account %s", vars["ruleId"], account.ID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Alert rule deleted"})
+}
+
+func (h *Handler) GetUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.GetUserSettings(ctx, userID))
+}
+
+func (h *Handler) UpdateUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+
+	var req storage.UserSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	settings, err := h.svc.UpdateUserSettings(ctx, userID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to save settings")
+		return
+	}
+	log.Printf("Settings updated for user %s (digest=%s)", userID, settings.DigestFrequency)
+	respondJSON(w, http.StatusOK, settings)
+}
+
+// GetDigestPreviewHandler показывает сводку, которую пользователь получил бы сейчас
+func (h *Handler) GetDigestPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if !userSelf(w, r, userID) {
+		return
+	}
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	freq := r.URL.Query().Get("frequency")
+	if freq == "" {
+		freq = h.svc.GetUserSettings(ctx, userID).DigestFrequency
+	}
+	if freq == storage.DigestOff || !service.IsValidDigestFrequency(freq) {
+		freq = storage.DigestDaily
+	}
+	respondJSON(w, http.StatusOK, h.svc.BuildDigest(ctx, userID, freq, time.Now()))
+}
+
+func (h *Handler) DepositHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.DepositRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		respondError(w, http.StatusBadRequest, "Deposit amount must be positive")
+		return
+	}
+	now := time.Now()
+	if req.ValueDate != nil {
+		if err := service.ValidateExternalValueDate(*req.ValueDate, now); err != nil {
+			respondStorageError(w, err, "Invalid value date")
+			return
+		}
+	}
+
+	account, ok := h.svc.GetAccount(ctx, req.ToAccountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", req.ToAccountID))
+		return
+	}
+	if err := storage.ValidateAmount(req.Amount, account.Currency); err != nil {
+		respondStorageError(w, err, "Failed to process deposit")
+		return
+	}
+	if err := h.svc.CheckTierLimits(ctx, nil, &account, req.Amount, now); err != nil {
+		respondStorageError(w, err, "Failed to process deposit")
+		return
+	}
+
+	release, err := h.svc.ReserveOperation(ctx, storage.OpDeposit, req.Amount, account.Currency, now)
+	if err != nil {
+		respondStorageError(w, err, "Failed to process deposit")
+		return
+	}
+	if err := h.svc.UpdateAccountBalance(ctx, req.ToAccountID, req.Amount); err != nil {
+		release()
+		respondStorageError(w, err, "Failed to process deposit")
+		return
+	}
+	tx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   "",
+		ToAccountID:     req.ToAccountID,
+		Amount:          req.Amount,
+		Timestamp:       now,
+		TransactionType: "deposit",
+	}
+	if req.ValueDate != nil {
+		tx.ValueDate = *req.ValueDate
+	}
+	tx.Describe(storage.DescDeposit, map[string]string{"account": account.Number})
+	h.svc.AddTransaction(ctx, tx)
+	h.svc.PublishBalanceChanged(ctx, req.ToAccountID)
+
+	log.Printf("Deposit of %s to account %s successful", req.Amount.String(), req.ToAccountID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Deposit successful"})
+}
+
+func (h *Handler) ApplyLoanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.ApplyLoanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount.LessThanOrEqual(decimal.Zero) || req.TermMonths <= 0 {
+		respondError(w, http.StatusBadRequest, "Loan amount and term must be positive")
+		return
+	}
+
+	user, userExists := h.svc.GetUser(ctx, req.UserID)
+	account, accountExists := h.svc.GetAccount(ctx, req.AccountID)
+
+	if !userExists {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", req.UserID))
+		return
+	}
+	if service.VerificationPolicy.RequireForLoans && !user.EmailVerified {
+		respondError(w, http.StatusForbidden, "Email must be verified before applying for a loan")
+		return
+	}
+	if err := h.svc.RequireKYCForLoan(user); err != nil {
+		respondStorageError(w, err, "Failed to apply for a loan")
+		return
+	}
+	if !accountExists {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", req.AccountID))
+		return
+	}
+	if err := storage.ValidateAmount(req.Amount, account.Currency); err != nil {
+		respondStorageError(w, err, "Failed to apply for a loan")
+		return
+	}
+	collateral, err := service.PrepareCollateral(req.Collateral, req.Amount)
+	if err != nil {
+		respondStorageError(w, err, "Failed to apply for a loan")
+		return
+	}
+	score, err := h.svc.CreditDecision(ctx, user.ID, req.Amount, account.Currency, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to apply for a loan")
+		return
+	}
+
+	baseRate, err := h.svc.GetCBRKeyRate(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to get key rate, using default 10%%: %v", err)
+		baseRate = decimal.NewFromInt(10)
+	}
+
+	// Надбавка за риск по грейду кредитного рейтинга
+	interestRate := baseRate.Add(decimal.NewFromInt(5)).Add(score.RateAdjustment)
+
+	if req.GuarantorUserID != "" {
+		app, err := h.svc.RequestLoanGuarantee(ctx, storage.LoanApplication{
+			UserID:          req.UserID,
+			AccountID:       req.AccountID,
+			GuarantorUserID: req.GuarantorUserID,
+			Amount:          req.Amount,
+			Currency:        account.Currency,
+			InterestRate:    interestRate,
+			TermMonths:      req.TermMonths,
+			CreditGrade:     score.Grade,
+			Collateral:      collateral,
+		}, time.Now())
+		if err != nil {
+			respondStorageError(w, err, "Failed to apply for a loan")
+			return
+		}
+		respondJSON(w, http.StatusAccepted, app)
+		return
+	}
+
+	monthlyPayment := storage.CalculateMonthlyPayment(req.Amount, interestRate, req.TermMonths)
+	startDate := time.Now()
+	schedule := storage.GeneratePaymentSchedule(req.Amount, interestRate, req.TermMonths, startDate, monthlyPayment)
+
+	loan := storage.Loan{
+		ID:              storage.GenerateID(),
+		UserID:          req.UserID,
+		AccountID:       req.AccountID,
+		Amount:          req.Amount,
+		InterestRate:    interestRate,
+		TermMonths:      req.TermMonths,
+		StartDate:       startDate,
+		PaymentSchedule: schedule,
+		RemainingAmount: req.Amount,
+		Collateral:      service.PledgeCollateral(collateral, startDate),
+		Status:          storage.LoanCurrent,
+		PenaltyInterest: decimal.Zero,
+	}
+
+	release, err := h.svc.ReserveOperation(ctx, storage.OpLoan, req.Amount, account.Currency, startDate)
+	if err != nil {
+		respondStorageError(w, err, "Failed to apply for a loan")
+		return
+	}
+	if _, err := h.svc.DisburseLoan(ctx, loan, startDate); err != nil {
+		release()
+		respondStorageError(w, err, "Failed to disburse loan")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, req.AccountID)
+
+	log.Printf("Loan %s approved for user %s (credit grade %s), amount %s, rate %s%%, term %d months. Funds disbursed to account %s.",
+		loan.ID, req.UserID, score.Grade, req.Amount.String(), interestRate.String(), req.TermMonths, req.AccountID)
+
+	respondJSON(w, http.StatusCreated, loan)
+}
+
+// GetLoanHandler — кредит с начисленными процентами, ближайшим платежом и просрочкой на момент запроса
+func (h *Handler) GetLoanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	view, err := h.svc.LoanView(ctx, mux.Vars(r)["loanId"], sessionUserID(ctx), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to get loan")
+		return
+	}
+	respondJSON(w, http.StatusOK, view)
+}
+
+// GetUserLoansHandler — список кредитов без графиков: ?status=current|delinquent|default, ?active=true, пагинация
+func (h *Handler) GetUserLoansHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	activeOnly := false
+	if v := r.URL.Query().Get("active"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid active, expected true or false")
+			return
+		}
+		activeOnly = parsed
+	}
+
+	loans, err := h.svc.UserLoans(ctx, userID, r.URL.Query().Get("status"), activeOnly, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to list loans")
+		return
+	}
+	page, pageSize := parsePagination(r)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total":     len(loans),
+		"page":      page,
+		"page_size": pageSize,
+		"loans":     paginate(loans, page, pageSize),
+	})
+}
+
+func (h *Handler) GetLoanScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	loanID := vars["loanId"]
+
+	loan, ok := h.svc.GetLoan(ctx, loanID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeLoanNotFound, fmt.Sprintf("Loan %s not found", loanID))
+		return
+	}
+
+	log.Printf("Fetched payment schedule for loan %s", loanID)
+	respondJSONStream(w, http.StatusOK, loan.PaymentSchedule)
+}
+
+// LoanHolidayHandler — кредитные каникулы: откладывает ближайшие платежи и возвращает кредит с новым графиком
+func (h *Handler) LoanHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.LoanHolidayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	view, err := h.svc.LoanPaymentHoliday(ctx, mux.Vars(r)["loanId"], sessionUserID(ctx), req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to apply payment holiday")
+		return
+	}
+	respondJSON(w, http.StatusOK, view)
+}
+
+// LoanGuaranteeHandler — ответ поручителя: accept выдаёт кредит, decline отклоняет заявку
+func (h *Handler) LoanGuaranteeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID := sessionUserID(ctx)
+	now := time.Now()
+
+	switch vars["action"] {
+	case "accept":
+		loan, err := h.svc.AcceptLoanGuarantee(ctx, vars["loanId"], userID, now)
+		if err != nil {
+			respondStorageError(w, err, "Failed to accept loan guarantee")
+			return
+		}
+		respondJSON(w, http.StatusCreated, loan)
+	case "decline":
+		app, err := h.svc.DeclineLoanGuarantee(ctx, vars["loanId"], userID, now)
+		if err != nil {
+			respondStorageError(w, err, "Failed to decline loan guarantee")
+			return
+		}
+		respondJSON(w, http.StatusOK, app)
+	default:
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Unknown guarantee action %s", vars["action"]))
+	}
+}
+
+// GetUserGuaranteesHandler — поручительства пользователя: входящие запросы, свои заявки и кредиты под его ответственностью
+func (h *Handler) GetUserGuaranteesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	guarantees, err := h.svc.UserGuarantees(ctx, userID, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to list guarantees")
+		return
+	}
+	respondJSON(w, http.StatusOK, guarantees)
+}
+
+func (h *Handler) CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	org, err := h.svc.CreateOrganization(ctx, req, sessionUserID(ctx), time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to create organization")
+		return
+	}
+	respondJSON(w, http.StatusCreated, org)
+}
+
+func (h *Handler) GetOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, organizationFromContext(r.Context()))
+}
+
+func (h *Handler) GetUserOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.GetUserOrganizations(ctx, userID))
+}
+
+func (h *Handler) SetOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.OrgMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	org := organizationFromContext(ctx)
+	org, err := h.svc.SetOrganizationMember(ctx, org.ID, sessionUserID(ctx), mux.Vars(r)["userId"], req.Role, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to update organization member")
+		return
+	}
+	respondJSON(w, http.StatusOK, org)
+}
+
+func (h *Handler) RemoveOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	org, err := h.svc.RemoveOrganizationMember(ctx, organizationFromContext(ctx).ID, sessionUserID(ctx), mux.Vars(r)["userId"], time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to remove organization member")
+		return
+	}
+	respondJSON(w, http.StatusOK, org)
+}
+
+func (h *Handler) OpenBusinessAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.OpenBusinessAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	account, err := h.svc.OpenBusinessAccount(ctx, organizationFromContext(ctx), sessionUserID(ctx), req.ProductCode, req.Currency, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to open business account")
+		return
+	}
+	respondJSON(w, http.StatusCreated, account)
+}
+
+func (h *Handler) GetOrganizationAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSON(w, http.StatusOK, h.svc.GetOrganizationAccounts(ctx, organizationFromContext(ctx).ID))
+}
+
+func (h *Handler) SetApprovalThresholdHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.ApprovalThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	org, err := h.svc.SetApprovalThreshold(ctx, organizationFromContext(ctx).ID, sessionUserID(ctx), req.Threshold, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to set approval threshold")
+		return
+	}
+	respondJSON(w, http.StatusOK, org)
+}
+
+func (h *Handler) GetPaymentApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status := r.URL.Query().Get("status")
+	respondJSON(w, http.StatusOK, h.svc.PaymentApprovals(ctx, organizationFromContext(ctx).ID, status, time.Now()))
+}
+
+func (h *Handler) DecidePaymentApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	var req storage.PaymentDecisionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	orgID := organizationFromContext(ctx).ID
+	var approval storage.PaymentApproval
+	var err error
+	if vars["decision"] == "approve" {
+		approval, err = h.svc.ApprovePayment(ctx, orgID, vars["approvalId"], sessionUserID(ctx), time.Now())
+	} else {
+		approval, err = h.svc.RejectPayment(ctx, orgID, vars["approvalId"], sessionUserID(ctx), req.Reason, time.Now())
+	}
+	if err != nil {
+		respondStorageError(w, err, "Failed to decide payment approval")
+		return
+	}
+	respondJSON(w, http.StatusOK, approval)
+}
+
+func (h *Handler) GetTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	accountID := vars["accountId"]
+
+	if _, ok := h.svc.GetAccount(ctx, accountID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+
+	transactions := storage.LocalizeTransactions(h.svc.GetAccountTransactions(ctx, accountID), h.svc.AccountLanguage(ctx, accountID))
+	if r.URL.Query().Get("include_imported") == "true" {
+		transactions = append(transactions, h.svc.GetImportedTransactions(ctx, accountID)...)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].EffectiveDate().After(transactions[j].EffectiveDate())
+	})
+
+	log.Printf("Fetched %d transactions for account %s", len(transactions), accountID)
+	respondJSONStream(w, http.StatusOK, transactions)
+}
+
+func parsePagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return page, pageSize
+}
+
+func paginate[T any](items []T, page, pageSize int) []T {
+	start := (page - 1) * pageSize
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// GetCardTransactionsHandler — оплаты конкретной картой и возвраты по ним, новые первыми
+// ownCard возвращает карту из сессии её владельца; чужая карта отдаётся как несуществующая
+func (h *Handler) ownCard(w http.ResponseWriter, r *http.Request, cardID string) (storage.Card, bool) {
+	ctx := r.Context()
+	card, ok := h.svc.GetCard(ctx, cardID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeCardNotFound, fmt.Sprintf("Card %s not found", cardID))
+		return storage.Card{}, false
+	}
+	if userID := sessionUserID(ctx); userID != "" {
+		if account, ok := h.svc.GetAccount(ctx, card.AccountID); !ok || !h.accountVisible(ctx, account, userID) {
+			respondErrorCode(w, http.StatusNotFound, storage.CodeCardNotFound, fmt.Sprintf("Card %s not found", cardID))
+			return storage.Card{}, false
+		}
+	}
+	return card, true
+}
+
+func (h *Handler) GetCardTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cardID := mux.Vars(r)["cardId"]
+	card, ok := h.ownCard(w, r, cardID)
+	if !ok {
+		return
+	}
+
+	transactions := storage.LocalizeTransactions(h.svc.GetCardTransactions(ctx, cardID), h.svc.AccountLanguage(ctx, card.AccountID))
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].EffectiveDate().After(transactions[j].EffectiveDate())
+	})
+	page, pageSize := parsePagination(r)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"card_id":      card.ID,
+		"total":        len(transactions),
+		"page":         page,
+		"page_size":    pageSize,
+		"transactions": paginate(transactions, page, pageSize),
+	})
+}
+
+// CreateCardTokenHandler выпускает токен карты для устройства; значение токена показывается только в этом ответе
+func (h *Handler) CreateCardTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	card, ok := h.ownCard(w, r, mux.Vars(r)["cardId"])
+	if !ok {
+		return
+	}
+	var req storage.CardTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	account, ok := h.svc.GetAccount(ctx, card.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return
+	}
+	token, value, err := h.svc.IssueCardToken(ctx, card, account.UserID, req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to issue card token")
+		return
+	}
+	log.Printf("Card %s: token %s issued for device %s", card.ID, token.ID, token.DeviceID)
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":         token,
+		"payment_token": value,
+	})
+}
+
+func (h *Handler) GetCardTokensHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownCard(w, r, mux.Vars(r)["cardId"])
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.ListCardTokens(r.Context(), card.ID))
+}
+
+func (h *Handler) SuspendCardTokenHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeCardToken(w, r, h.svc.SuspendCardToken, "Failed to suspend card token")
+}
+
+func (h *Handler) ResumeCardTokenHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeCardToken(w, r, h.svc.ResumeCardToken, "Failed to resume card token")
+}
+
+func (h *Handler) DeleteCardTokenHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeCardToken(w, r, h.svc.DeleteCardToken, "Failed to delete card token")
+}
+
+func (h *Handler) changeCardToken(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, cardID, tokenID, actor string, now time.Time) (storage.CardToken, error), failure string) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	card, ok := h.ownCard(w, r, vars["cardId"])
+	if !ok {
+		return
+	}
+	token, err := change(ctx, card.ID, vars["tokenId"], sessionUserID(ctx), time.Now())
+	if err != nil {
+		respondStorageError(w, err, failure)
+		return
+	}
+	log.Printf("Card %s: token %s is %s", card.ID, token.ID, token.Status)
+	respondJSON(w, http.StatusOK, token)
+}
+
+func (h *Handler) GetTransactionDetailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	detail, err := h.svc.TransactionDetail(ctx, mux.Vars(r)["transactionId"], sessionUserID(ctx))
+	if err != nil {
+		respondStorageError(w, err, "Failed to get transaction")
+		return
+	}
+	respondJSON(w, http.StatusOK, detail)
+}
+
+func (h *Handler) SearchTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	userID := r.URL.Query().Get("userId")
+
+	if query == "" || userID == "" {
+		respondError(w, http.StatusBadRequest, "Query parameters q and userId are required")
+		return
+	}
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	results := h.svc.SearchUserTransactions(ctx, userID, query)
+
+	log.Printf("Transaction search for user %s (%q): %d matches", userID, query, len(results))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"query":     query,
+		"total":     len(results),
+		"page":      page,
+		"page_size": pageSize,
+		"results":   paginate(results, page, pageSize),
+	})
+}
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// exportBatchSize — сколько транзакций выгрузка читает из журнала за раз
+const exportBatchSize = 500
+
+// acceptsGzip — клиент перечислил gzip в Accept-Encoding и не запретил его через q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// ExportTransactionsHandler выгружает всю историю счёта в NDJSON — по транзакции в строке, по возрастанию
+// sequence. Журнал читается порциями, так что память на запрос не зависит от длины истории. ?since=<sequence>
+// продолжает выгрузку после последней полученной строки — так делаются инкрементальные синхронизации.
+func (h *Handler) ExportTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+	query := r.URL.Query()
+
+	if format := query.Get("format"); format != "" && format != "ndjson" {
+		respondError(w, http.StatusBadRequest, "format must be ndjson")
+		return
+	}
+	var since int64
+	if raw := query.Get("since"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			respondError(w, http.StatusBadRequest, "since must be a non-negative transaction sequence")
+			return
+		}
+		since = parsed
+	}
+	if _, ok := h.svc.GetAccount(ctx, accountID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+	lang := h.svc.AccountLanguage(ctx, accountID)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Vary", "Accept-Encoding")
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(out)
+
+	exported := 0
+	for ctx.Err() == nil {
+		batch := h.svc.GetAccountTransactionsBatch(ctx, accountID, since, exportBatchSize)
+		for _, tx := range batch {
+			tx.Description = storage.LocalizedDescription(tx, lang)
+			if err := enc.Encode(tx); err != nil {
+				log.Printf("Transaction export for account %s interrupted after %d rows: %v", accountID, exported, err)
+				return
+			}
+			since = tx.Sequence
+			exported++
+		}
+		if gz != nil {
+			gz.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(batch) < exportBatchSize {
+			break
+		}
+	}
+	log.Printf("Exported %d transactions for account %s (last sequence %d)", exported, accountID, since)
+}
+
+func writeSSETransaction(w http.ResponseWriter, tx storage.Transaction, lang string) error {
+	tx.Description = storage.LocalizedDescription(tx, lang)
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: transaction\ndata: %s\n\n", tx.Sequence, data)
+	return err
+}
+
+// StreamTransactionsHandler отдаёт новые транзакции счёта через SSE. Идентификатор события —
+// порядковый номер транзакции, поэтому по Last-Event-ID клиент получает пропущенное.
+func (h *Handler) StreamTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+
+	account, ok := h.svc.GetAccount(ctx, accountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastSent int64 = -1
+	if lastEventID != "" {
+		parsed, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || parsed < 0 {
+			respondError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastSent = parsed
+	}
+
+	lang := h.svc.AccountLanguage(ctx, accountID)
+
+	// Подписка до чтения пропущенного, чтобы не потерять транзакции между ними
+	events, unsubscribe := h.svc.Events().Subscribe(account.UserID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if lastSent >= 0 {
+		for _, tx := range h.svc.GetAccountTransactionsSince(ctx, accountID, lastSent) {
+			if err := writeSSETransaction(w, tx, lang); err != nil {
+				return
+			}
+			lastSent = tx.Sequence
+		}
+	}
+	flusher.Flush()
+	log.Printf("SSE stream opened for account %s (from event %d)", accountID, lastSent)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("SSE stream closed for account %s", accountID)
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			tx, isTx := event.Payload.(storage.Transaction)
+			if event.Type != storage.EventTransactionCreated || event.AccountID != accountID || !isTx || tx.Sequence <= lastSent {
+				continue
+			}
+			if err := writeSSETransaction(w, tx, lang); err != nil {
+				return
+			}
+			lastSent = tx.Sequence
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req storage.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.UserID == "" || len(req.Events) == 0 {
+		respondError(w, http.StatusBadRequest, "UserID and at least one event type are required")
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		respondError(w, http.StatusBadRequest, "Webhook URL must be an absolute http(s) URL")
+		return
+	}
+	for _, eventType := range req.Events {
+		if _, ok := service.FindWebhookEventType(eventType); !ok {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown event type %s", eventType))
+			return
+		}
+	}
+
+	hook := storage.Webhook{
+		ID:        storage.GenerateID(),
+		UserID:    req.UserID,
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    storage.GenerateToken(),
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	if err := h.svc.AddWebhook(ctx, hook); err != nil {
+		respondStorageError(w, err, "Failed to create webhook")
+		return
+	}
+
+	log.Printf("Webhook %s registered for user %s: %v", hook.ID, hook.UserID, hook.Events)
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"webhook": hook,
+		"secret":  hook.Secret,
+	})
+}
+
+func (h *Handler) GetUserWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	respondJSONStream(w, http.StatusOK, h.svc.GetUserWebhooks(ctx, userID))
+}
+
+func (h *Handler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	webhookID := mux.Vars(r)["webhookId"]
+	if err := h.svc.DeleteWebhook(ctx, webhookID); err != nil {
+		respondStorageError(w, err, "Failed to delete webhook")
+		return
+	}
+	log.Printf("Webhook %s deleted", webhookID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted"})
+}
+
+func ListWebhookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, service.WebhookEventCatalog)
+}
+
+func (h *Handler) TestWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	webhookID := mux.Vars(r)["webhookId"]
+	hook, ok := h.svc.GetWebhook(ctx, webhookID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Webhook %s not found", webhookID))
+		return
+	}
+
+	eventType := r.URL.Query().Get("event")
+	if eventType == "" {
+		eventType = hook.Events[0]
+	}
+	sample, ok := service.FindWebhookEventType(eventType)
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown event type %s", eventType))
+		return
+	}
+
+	delivery := service.DeliverWebhook(ctx, hook, storage.Event{
+		Type:      sample.Type,
+		UserID:    hook.UserID,
+		Payload:   sample.SamplePayload,
+		Timestamp: time.Now(),
+	}, true)
+
+	log.Printf("Test delivery of %s to webhook %s: success=%t", eventType, webhookID, delivery.Success)
+	respondJSON(w, http.StatusOK, delivery)
+}
+
+func (h *Handler) CloseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+
+	var req storage.CloseAccountRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	closure, err := h.svc.CloseAccount(ctx, accountID, req.PayoutAccountID, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to close account")
+		return
+	}
+	h.svc.PublishBalanceChanged(ctx, accountID)
+	if closure.Payout != nil {
+		h.svc.PublishBalanceChanged(ctx, req.PayoutAccountID)
+	}
+
+	st := h.svc.BuildStatement(ctx, closure.Account, closure.Account.CreatedAt, closure.ClosedAt)
+	closure.Statement = &st
+
+	if user, ok := h.svc.GetUser(ctx, closure.Account.UserID); ok {
+		go func() {
+			data, err := service.FormatStatementCSV(st)
+			if err != nil {
+				log.Printf("Failed to build closing statement for account %s: %v", accountID, err)
+				return
+			}
+			subject := fmt.Sprintf("Simple Bank: account %s closed", closure.Account.Number)
+			body := fmt.Sprintf("Hello %s,\n\nYour account %s was closed on %s. Final statement (CSV):\n\n%s",
+				user.Username, closure.Account.Number, closure.ClosedAt.Format("2006-01-02"), data)
+			h.svc.QueueEmail(ctx, user.Email, subject, body)
+		}()
+	}
+
+	log.Printf("Account %s closed, %d transactions in final statement", accountID, len(st.Transactions))
+	respondJSON(w, http.StatusOK, closure)
+}
+
+func (h *Handler) GetStatementHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+	account, ok := h.svc.GetAccount(ctx, accountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+
+	now := time.Now()
+	from, to, err := service.ParseStatementPeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"), now)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	st := h.svc.BuildStatement(ctx, account, from, to)
+	filename := fmt.Sprintf("statement_%s_%s_%s", account.Number, from.Format("20060102"), to.Format("20060102"))
+
+	format := r.URL.Query().Get("format")
+	if ext := mux.Vars(r)["format"]; ext != "" {
+		format = ext // /statement.camt053, /statement.mt940
+	}
+	switch format {
+	case "", "json":
+		respondJSON(w, http.StatusOK, st)
+	case "csv":
+		data, err := service.FormatStatementCSV(st)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to build CSV: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	case "1c":
+		w.Header().Set("Content-Type", "text/plain; charset=windows-1251")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".txt"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(h.svc.Format1C(ctx, st, now))
+	case "camt053":
+		data, err := h.svc.FormatCAMT053(ctx, st, now)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to build camt.053: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".xml"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	case "mt940":
+		w.Header().Set("Content-Type", "text/plain; charset=us-ascii")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".sta"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(h.svc.FormatMT940(ctx, st))
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported statement format %s", format))
+		return
+	}
+	log.Printf("Statement for account %s (%s - %s) exported, %d transactions", accountID, from.Format("2006-01-02"), to.Format("2006-01-02"), len(st.Transactions))
+}
+
+// checkETag выставляет ETag из поколений коллекций и отвечает 304, если клиент уже видел эту версию
+// GetInterestCertificateHandler — справка о процентах за год для налоговой декларации (PDF по умолчанию)
+func (h *Handler) GetInterestCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := mux.Vars(r)["accountId"]
+	account, ok := h.svc.GetAccount(ctx, accountID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeAccountNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+
+	now := time.Now()
+	year, err := service.ParseCertificateYear(r.URL.Query().Get("year"), account, now)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cert := h.svc.BuildInterestCertificate(ctx, account, year, now)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("interest_%s_%d.pdf", account.Number, year)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(service.FormatInterestCertificatePDF(cert))
+	case "json":
+		respondJSON(w, http.StatusOK, cert)
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported certificate format %s", format))
+		return
+	}
+	log.Printf("Interest certificate %s for account %s issued: %s", cert.Number, accountID, cert.NetInterest.String())
+}
+
+func (h *Handler) checkETag(w http.ResponseWriter, r *http.Request, scope string, collections ...string) bool {
+	ctx := r.Context()
+	tag := scope
+	for _, c := range collections {
+		tag += fmt.Sprintf("-%s.%d", c, h.svc.Generation(ctx, c))
+	}
+	etag := `W/"` + tag + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+func (h *Handler) DevSeedHandler(w http.ResponseWriter, r *http.Request) {
+	var req storage.SeedRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	report, err := h.svc.SeedDevData(r.Context(), req, time.Now())
+	if err != nil {
+		respondStorageError(w, err, "Failed to seed data")
+		return
+	}
+
+	log.Printf("Dev seed: %d users, %d cards, %d transactions in %s", report.Users, report.Cards, report.Transactions, report.Elapsed.Round(time.Millisecond))
+	respondJSON(w, http.StatusCreated, report)
+}
+
+func (h *Handler) CreateRateOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !service.SandboxConfig.Enabled {
+		respondError(w, http.StatusForbidden, "Rate overrides are available only in sandbox mode")
+		return
+	}
+
+	var req storage.RateOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	override := storage.RateOverride{
+		ID:            storage.GenerateID(),
+		Kind:          req.Kind,
+		Currency:      strings.ToUpper(req.Currency),
+		Rate:          req.Rate,
+		EffectiveFrom: req.EffectiveFrom,
+		CreatedAt:     time.Now(),
+	}
+	if override.EffectiveFrom.IsZero() {
+		override.EffectiveFrom = override.CreatedAt
+	}
+	if err := h.svc.AddRateOverride(ctx, override); err != nil {
+		respondStorageError(w, err, "Failed to save rate override")
+		return
+	}
+
+	log.Printf("Sandbox %s override %s set to %s from %s", override.Kind, override.Currency, override.Rate, override.EffectiveFrom.Format(time.RFC3339))
+	respondJSON(w, http.StatusCreated, override)
+}
+
+func (h *Handler) ListRateOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSON(w, http.StatusOK, h.svc.ListRateOverrides(ctx))
+}
+
+func (h *Handler) DeleteRateOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := h.svc.DeleteRateOverride(ctx, mux.Vars(r)["overrideId"]); err != nil {
+		respondStorageError(w, err, "Failed to delete rate override")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminSearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query().Get("q")
+	if len([]rune(strings.Join(strings.Fields(query), ""))) < storage.MinSearchQueryLen {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Query must contain at least %d characters", storage.MinSearchQueryLen))
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	respondJSON(w, http.StatusOK, h.svc.AdminSearch(ctx, query, limit))
+}
+
+func (h *Handler) GetStorageGenerationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	respondJSON(w, http.StatusOK, h.svc.Generations(ctx))
+}
+
+func (h *Handler) GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "pdf":
+		h.monthlyReportPDF(w, r, userID)
+		return
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported summary format %s", format))
+		return
+	}
+
+	if h.checkETag(w, r, "summary-"+userID, storage.CollectionAccounts, storage.CollectionLoans, storage.CollectionReceivables, storage.CollectionExternalAccounts) {
+		return
+	}
+
+	sum := h.svc.GetUserSummary(ctx, userID)
+
+	guaranteedDebt, guaranteedLoans := decimal.Zero, 0
+	for _, loan := range h.svc.GetGuaranteedLoans(ctx, userID) {
+		if loan.RemainingAmount.IsPositive() {
+			guaranteedDebt = guaranteedDebt.Add(loan.RemainingAmount)
+			guaranteedLoans++
+		}
+	}
+
+	openReceivables := make([]storage.Receivable, 0)
+	for _, rec := range h.svc.GetUserReceivables(ctx, userID) {
+		if rec.Status == storage.ReceivableOpen {
+			openReceivables = append(openReceivables, rec)
+		}
+	}
+
+	summary := map[string]interface{}{
+		"user_id":                 userID,
+		"total_account_balance":   sum.TotalBalance,
+		"number_of_accounts":      sum.Accounts,
+		"total_loan_debt":         sum.TotalLoanDebt,
+		"active_loans":            sum.ActiveLoans,
+		"guaranteed_loan_debt":    guaranteedDebt,
+		"guaranteed_loans":        guaranteedLoans,
+		"outstanding_receivables": sum.OutstandingReceivables,
+		"receivables":             openReceivables,
+		"interest":                h.svc.UserInterest(ctx, userID, time.Now()),
+	}
+	// Счета в других банках показываются отдельно и в total_account_balance не входят: банк ими не управляет
+	if externalTotal, externalAccounts := h.svc.ExternalBalance(ctx, userID); len(externalAccounts) > 0 {
+		summary["external_accounts"] = externalAccounts
+		summary["total_external_balance"] = externalTotal
+		summary["external_balance_currency"] = storage.BaseCurrency
+	}
+
+	log.Printf("Generated financial summary for user %s", userID)
+	respondJSON(w, http.StatusOK, summary)
+}
+
+// GetCashflowHandler — доходы и расходы клиента по месяцам; X-Cache показывает, взят ли отчёт из кеша
+func (h *Handler) GetCashflowHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	months, err := service.ParseCashflowMonths(r.URL.Query().Get("months"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	perAccount := r.URL.Query().Get("per_account") == "true"
+
+	report, cached := h.svc.UserCashflow(ctx, userID, months, perAccount, time.Now())
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// GetMerchantSpendingHandler — оплаты картой клиента за период по мерчантам (?from=&to=&top=&sort=total|count|average)
+func (h *Handler) GetMerchantSpendingHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	query := r.URL.Query()
+	from, to, err := service.ParseStatementPeriod(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	top, sortBy, err := service.ParseMerchantSpendingQuery(query.Get("top"), query.Get("sort"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.svc.UserMerchantSpending(ctx, userID, from, to, top, sortBy))
+}
+
+// GetRecurringPaymentsHandler — регулярные платежи клиента, найденные по истории операций
+func (h *Handler) GetRecurringPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userId"]
+	if _, ok := h.svc.GetUser(ctx, userID); !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	respondJSON(w, http.StatusOK, h.svc.UserRecurringPayments(ctx, userID, time.Now()))
+}
+
+// monthlyReportPDF отдаёт финансовый отчёт за месяц (?month=YYYY-MM, по умолчанию прошлый) файлом PDF
+func (h *Handler) monthlyReportPDF(w http.ResponseWriter, r *http.Request, userID string) {
+	ctx := r.Context()
+	user, ok := h.svc.GetUser(ctx, userID)
+	if !ok {
+		respondErrorCode(w, http.StatusNotFound, storage.CodeUserNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+	now := time.Now()
+	month, err := service.ParseReportMonth(r.URL.Query().Get("month"), now)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	report := h.svc.BuildMonthlyReport(ctx, user, month, now)
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("financial_report_%s.pdf", report.Month)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(service.FormatMonthlyReportPDF(report))
+	log.Printf("Monthly financial report %s for user %s exported: %d accounts, %d categories", report.Month, userID, len(report.Accounts), len(report.Categories))
+}
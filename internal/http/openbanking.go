@@ -0,0 +1,630 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// Open Banking API (/openbanking/v1) — отдельная поверхность для агрегаторов: схема в духе спецификаций
+// Open Banking (поля PascalCase, ответы в обёртке Data/Links/Meta), согласия вместо прямого доступа к счетам.
+// Внутренние эндпоинты и их формат от неё не зависят.
+
+const openBankingPrefix = "/openbanking/v1"
+
+func (h *Handler) registerOpenBankingRoutes(r *mux.Router) {
+	r.HandleFunc("/account-access-consents", h.obClientOnly(h.CreateAccountConsentHandler)).Methods("POST")
+	r.HandleFunc("/account-access-consents/{consentId}", h.obClientOnly(h.GetAccountConsentHandler)).Methods("GET")
+	r.HandleFunc("/account-access-consents/{consentId}", h.obClientOnly(h.DeleteAccountConsentHandler)).Methods("DELETE")
+
+	r.HandleFunc("/accounts", h.obConsentRequired(h.OBAccountsHandler)).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}", h.obConsentRequired(h.OBAccountHandler)).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/balances", h.obConsentRequired(h.OBBalancesHandler)).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/transactions", h.obConsentRequired(h.OBTransactionsHandler)).Methods("GET")
+
+	r.HandleFunc("/domestic-payment-consents", h.obClientOnly(h.CreatePaymentConsentHandler)).Methods("POST")
+	r.HandleFunc("/domestic-payment-consents/{consentId}", h.obClientOnly(h.GetPaymentConsentHandler)).Methods("GET")
+	r.HandleFunc("/domestic-payments", h.CreateDomesticPaymentHandler).Methods("POST")
+	r.HandleFunc("/domestic-payments/{paymentId}", h.obClientOnly(h.GetDomesticPaymentHandler)).Methods("GET")
+}
+
+type obAmount struct {
+	Amount   string `json:"Amount"`
+	Currency string `json:"Currency"`
+}
+
+type obLinks struct {
+	Self string `json:"Self"`
+	Next string `json:"Next,omitempty"`
+}
+
+type obMeta struct {
+	TotalPages int `json:"TotalPages"`
+}
+
+type obResponse struct {
+	Data  interface{} `json:"Data"`
+	Links obLinks     `json:"Links"`
+	Meta  obMeta      `json:"Meta"`
+}
+
+type obErrorDetail struct {
+	ErrorCode storage.ErrorCode `json:"ErrorCode"`
+	Message   string            `json:"Message"`
+}
+
+type obError struct {
+	Code    string          `json:"Code"` // «403 Forbidden»
+	ID      string          `json:"Id"`
+	Message string          `json:"Message"`
+	Errors  []obErrorDetail `json:"Errors"`
+}
+
+type obConsent struct {
+	ConsentID               string     `json:"ConsentId"`
+	Status                  string     `json:"Status"`
+	CreationDateTime        time.Time  `json:"CreationDateTime"`
+	StatusUpdateDateTime    time.Time  `json:"StatusUpdateDateTime"`
+	Permissions             []string   `json:"Permissions"`
+	ExpirationDateTime      time.Time  `json:"ExpirationDateTime"`
+	TransactionFromDateTime *time.Time `json:"TransactionFromDateTime,omitempty"`
+	TransactionToDateTime   *time.Time `json:"TransactionToDateTime,omitempty"`
+}
+
+type obConsentRequest struct {
+	Data struct {
+		Permissions             []string   `json:"Permissions"`
+		ExpirationDateTime      *time.Time `json:"ExpirationDateTime"`
+		TransactionFromDateTime *time.Time `json:"TransactionFromDateTime"`
+		TransactionToDateTime   *time.Time `json:"TransactionToDateTime"`
+	} `json:"Data"`
+}
+
+type obAccountIdentification struct {
+	SchemeName     string `json:"SchemeName"`
+	Identification string `json:"Identification"`
+	Name           string `json:"Name,omitempty"`
+}
+
+type obAccount struct {
+	AccountID      string                    `json:"AccountId"`
+	Status         string                    `json:"Status"` // Enabled | Disabled
+	Currency       string                    `json:"Currency"`
+	AccountType    string                    `json:"AccountType"` // Personal | Business
+	AccountSubType string                    `json:"AccountSubType"`
+	Nickname       string                    `json:"Nickname,omitempty"`
+	OpeningDate    time.Time                 `json:"OpeningDate"`
+	Account        []obAccountIdentification `json:"Account,omitempty"` // только с ReadAccountsDetail
+}
+
+type obBalance struct {
+	AccountID            string    `json:"AccountId"`
+	CreditDebitIndicator string    `json:"CreditDebitIndicator"`
+	Type                 string    `json:"Type"`
+	DateTime             time.Time `json:"DateTime"`
+	Amount               obAmount  `json:"Amount"`
+}
+
+type obBankTransactionCode struct {
+	Code   string `json:"Code"`
+	Issuer string `json:"Issuer"`
+}
+
+type obMerchantDetails struct {
+	MerchantName string `json:"MerchantName"`
+}
+
+type obTransaction struct {
+	AccountID                      string                `json:"AccountId"`
+	TransactionID                  string                `json:"TransactionId"`
+	CreditDebitIndicator           string                `json:"CreditDebitIndicator"`
+	Status                         string                `json:"Status"`
+	BookingDateTime                time.Time             `json:"BookingDateTime"`
+	ValueDateTime                  time.Time             `json:"ValueDateTime"`
+	Amount                         obAmount              `json:"Amount"`
+	ProprietaryBankTransactionCode obBankTransactionCode `json:"ProprietaryBankTransactionCode"`
+	// Только с ReadTransactionsDetail
+	TransactionInformation string             `json:"TransactionInformation,omitempty"`
+	MerchantDetails        *obMerchantDetails `json:"MerchantDetails,omitempty"`
+}
+
+type obRemittanceInformation struct {
+	Reference string `json:"Reference,omitempty"`
+}
+
+type obInitiation struct {
+	InstructionIdentification string                   `json:"InstructionIdentification"`
+	EndToEndIdentification    string                   `json:"EndToEndIdentification"`
+	InstructedAmount          obAmount                 `json:"InstructedAmount"`
+	CreditorAccount           obAccountIdentification  `json:"CreditorAccount"`
+	RemittanceInformation     *obRemittanceInformation `json:"RemittanceInformation,omitempty"`
+}
+
+type obPaymentConsent struct {
+	ConsentID            string       `json:"ConsentId"`
+	Status               string       `json:"Status"`
+	CreationDateTime     time.Time    `json:"CreationDateTime"`
+	StatusUpdateDateTime time.Time    `json:"StatusUpdateDateTime"`
+	ExpirationDateTime   time.Time    `json:"ExpirationDateTime"`
+	Initiation           obInitiation `json:"Initiation"`
+	DomesticPaymentID    string       `json:"DomesticPaymentId,omitempty"`
+}
+
+type obPaymentConsentRequest struct {
+	Data struct {
+		Initiation obInitiation `json:"Initiation"`
+	} `json:"Data"`
+}
+
+type obDomesticPayment struct {
+	DomesticPaymentID    string       `json:"DomesticPaymentId"`
+	ConsentID            string       `json:"ConsentId"`
+	Status               string       `json:"Status"` // Pending | AcceptedSettlementCompleted | Rejected
+	StatusReason         string       `json:"StatusReason,omitempty"`
+	CreationDateTime     time.Time    `json:"CreationDateTime"`
+	StatusUpdateDateTime time.Time    `json:"StatusUpdateDateTime"`
+	Initiation           obInitiation `json:"Initiation"`
+}
+
+type obDomesticPaymentRequest struct {
+	Data struct {
+		ConsentID  string       `json:"ConsentId"`
+		Initiation obInitiation `json:"Initiation"`
+	} `json:"Data"`
+}
+
+// obAccountNumberScheme — единственная схема идентификации счёта: номер счёта в банке
+const obAccountNumberScheme = "BankApp.AccountNumber"
+
+func toOBInitiation(p storage.PaymentInitiation) obInitiation {
+	result := obInitiation{
+		InstructionIdentification: p.InstructionID,
+		EndToEndIdentification:    p.EndToEndID,
+		InstructedAmount:          obAmount{Amount: p.Amount.StringFixed(2), Currency: p.Currency},
+		CreditorAccount:           obAccountIdentification{SchemeName: obAccountNumberScheme, Identification: p.CreditorAccountNumber, Name: p.CreditorName},
+	}
+	if p.Reference != "" {
+		result.RemittanceInformation = &obRemittanceInformation{Reference: p.Reference}
+	}
+	return result
+}
+
+// fromOBInitiation переводит Initiation из запроса в модель банка
+func fromOBInitiation(i obInitiation) (storage.PaymentInitiation, error) {
+	if i.CreditorAccount.SchemeName != obAccountNumberScheme {
+		return storage.PaymentInitiation{}, fmt.Errorf("CreditorAccount.SchemeName must be %s", obAccountNumberScheme)
+	}
+	amount, err := decimal.NewFromString(i.InstructedAmount.Amount)
+	if err != nil {
+		return storage.PaymentInitiation{}, fmt.Errorf("InstructedAmount.Amount must be a decimal number")
+	}
+	result := storage.PaymentInitiation{
+		InstructionID:         i.InstructionIdentification,
+		EndToEndID:            i.EndToEndIdentification,
+		Amount:                amount,
+		Currency:              i.InstructedAmount.Currency,
+		CreditorAccountNumber: i.CreditorAccount.Identification,
+		CreditorName:          i.CreditorAccount.Name,
+	}
+	if i.RemittanceInformation != nil {
+		result.Reference = i.RemittanceInformation.Reference
+	}
+	return result, nil
+}
+
+func toOBPaymentConsent(c storage.DomesticPaymentConsent) obPaymentConsent {
+	return obPaymentConsent{
+		ConsentID:            c.ID,
+		Status:               c.Status,
+		CreationDateTime:     c.CreatedAt,
+		StatusUpdateDateTime: c.StatusUpdatedAt,
+		ExpirationDateTime:   c.ExpiresAt,
+		Initiation:           toOBInitiation(c.Initiation),
+		DomesticPaymentID:    c.PaymentID,
+	}
+}
+
+func toOBDomesticPayment(p storage.DomesticPayment) obDomesticPayment {
+	return obDomesticPayment{
+		DomesticPaymentID:    p.ID,
+		ConsentID:            p.ConsentID,
+		Status:               p.Status,
+		StatusReason:         p.RejectReason,
+		CreationDateTime:     p.CreatedAt,
+		StatusUpdateDateTime: p.StatusUpdatedAt,
+		Initiation:           toOBInitiation(p.Initiation),
+	}
+}
+
+func toOBConsent(c storage.AccountAccessConsent) obConsent {
+	return obConsent{
+		ConsentID:               c.ID,
+		Status:                  c.Status,
+		CreationDateTime:        c.CreatedAt,
+		StatusUpdateDateTime:    c.StatusUpdatedAt,
+		Permissions:             c.Permissions,
+		ExpirationDateTime:      c.ExpiresAt,
+		TransactionFromDateTime: c.TransactionFrom,
+		TransactionToDateTime:   c.TransactionTo,
+	}
+}
+
+func creditDebit(credit bool) string {
+	if credit {
+		return "Credit"
+	}
+	return "Debit"
+}
+
+func respondOB(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	respondJSON(w, status, obResponse{Data: data, Links: obLinks{Self: r.URL.RequestURI()}, Meta: obMeta{TotalPages: 1}})
+}
+
+// respondOBError отвечает ошибкой в формате Open Banking; код банка уходит в Errors[].ErrorCode
+func respondOBError(w http.ResponseWriter, status int, code storage.ErrorCode, message string) {
+	respondJSON(w, status, obError{
+		Code:    fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		ID:      w.Header().Get(requestIDHeader),
+		Message: message,
+		Errors:  []obErrorDetail{{ErrorCode: code, Message: message}},
+	})
+}
+
+func respondOBStorageError(w http.ResponseWriter, err error) {
+	respondOBError(w, storageErrorStatus(err), storageErrorCode(err), err.Error())
+}
+
+type obClientContextKey struct{}
+type obConsentContextKey struct{}
+
+// obClientOnly пускает к согласиям только само приложение: client_id и client_secret через HTTP Basic
+func (h *Handler) obClientOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		client, err := h.svc.AuthenticateOAuthClient(r.Context(), clientID, secret)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="openbanking"`)
+			respondOBError(w, http.StatusUnauthorized, storage.CodeUnauthorized, "Client authentication failed")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), obClientContextKey{}, client)))
+	}
+}
+
+// obConsentRequired пускает к данным только токен приложения, выданный по действующему согласию
+func (h *Handler) obConsentRequired(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessionFromContext(r.Context())
+		if !ok || session.Kind != storage.SessionKindOAuth {
+			respondOBError(w, http.StatusUnauthorized, storage.CodeUnauthorized, "Third-party app access token is required")
+			return
+		}
+		if !session.HasScope(storage.ScopeAccountsRead) {
+			respondOBError(w, http.StatusForbidden, storage.CodeForbidden, fmt.Sprintf("Token lacks required scope %s", storage.ScopeAccountsRead))
+			return
+		}
+		consent, err := h.svc.SessionAccountConsent(r.Context(), session, time.Now())
+		if err != nil {
+			respondOBStorageError(w, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), obConsentContextKey{}, consent)))
+	}
+}
+
+func obClientFromContext(ctx context.Context) storage.APIClient {
+	client, _ := ctx.Value(obClientContextKey{}).(storage.APIClient)
+	return client
+}
+
+func obConsentFromContext(ctx context.Context) storage.AccountAccessConsent {
+	consent, _ := ctx.Value(obConsentContextKey{}).(storage.AccountAccessConsent)
+	return consent
+}
+
+func (h *Handler) CreateAccountConsentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req obConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	consent, err := h.svc.CreateAccountConsent(ctx, obClientFromContext(ctx).ID, storage.CreateAccountConsentRequest{
+		Permissions:     req.Data.Permissions,
+		ExpiresAt:       req.Data.ExpirationDateTime,
+		TransactionFrom: req.Data.TransactionFromDateTime,
+		TransactionTo:   req.Data.TransactionToDateTime,
+	}, time.Now())
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	w.Header().Set("Location", openBankingPrefix+"/account-access-consents/"+consent.ID)
+	respondOB(w, r, http.StatusCreated, toOBConsent(consent))
+}
+
+func (h *Handler) GetAccountConsentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	consent, err := h.svc.ClientAccountConsent(ctx, obClientFromContext(ctx).ID, mux.Vars(r)["consentId"])
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	respondOB(w, r, http.StatusOK, toOBConsent(consent))
+}
+
+func (h *Handler) DeleteAccountConsentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if _, err := h.svc.RevokeClientAccountConsent(ctx, obClientFromContext(ctx).ID, mux.Vars(r)["consentId"], time.Now()); err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// toOBAccount — счёт в схеме Open Banking; реквизиты и имя владельца отдаются только с ReadAccountsDetail
+func (h *Handler) toOBAccount(ctx context.Context, consent storage.AccountAccessConsent, account storage.Account) obAccount {
+	result := obAccount{
+		AccountID:      account.ID,
+		Status:         "Enabled",
+		Currency:       account.Currency,
+		AccountType:    "Personal",
+		AccountSubType: "CurrentAccount",
+		OpeningDate:    account.CreatedAt,
+	}
+	if account.IsClosed() {
+		result.Status = "Disabled"
+	}
+	if account.ProductCode == storage.ProductSavings {
+		result.AccountSubType = "Savings"
+	}
+	if product, ok := storage.GetProduct(account.ProductCode); ok {
+		result.Nickname = product.Name
+	}
+	if !consent.Allows(storage.PermReadAccountsDetail) {
+		return result
+	}
+	holder := ""
+	if user, ok := h.svc.GetUser(ctx, account.UserID); ok {
+		holder = user.Username
+		if user.Profile != nil && user.Profile.FullName != "" {
+			holder = user.Profile.FullName
+		}
+	}
+	if account.OrganizationID != "" {
+		result.AccountType = "Business"
+		if org, ok := h.svc.GetOrganization(ctx, account.OrganizationID); ok {
+			holder = org.Name
+		}
+	}
+	result.Account = []obAccountIdentification{{SchemeName: obAccountNumberScheme, Identification: account.Number, Name: holder}}
+	return result
+}
+
+// obAccountAllowed проверяет, что согласие разрешает читать сами счета
+func obAccountAllowed(w http.ResponseWriter, consent storage.AccountAccessConsent) bool {
+	if consent.Allows(storage.PermReadAccountsBasic) || consent.Allows(storage.PermReadAccountsDetail) {
+		return true
+	}
+	respondOBError(w, http.StatusForbidden, storage.CodeForbidden, "Consent does not permit reading accounts")
+	return false
+}
+
+func (h *Handler) OBAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	consent := obConsentFromContext(ctx)
+	if !obAccountAllowed(w, consent) {
+		return
+	}
+	accounts := make([]obAccount, 0)
+	for _, account := range h.svc.ConsentAccounts(ctx, consent) {
+		accounts = append(accounts, h.toOBAccount(ctx, consent, account))
+	}
+	respondOB(w, r, http.StatusOK, map[string]interface{}{"Account": accounts})
+}
+
+func (h *Handler) OBAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	consent := obConsentFromContext(ctx)
+	if !obAccountAllowed(w, consent) {
+		return
+	}
+	account, err := h.svc.ConsentAccount(ctx, consent, mux.Vars(r)["accountId"])
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	respondOB(w, r, http.StatusOK, map[string]interface{}{"Account": []obAccount{h.toOBAccount(ctx, consent, account)}})
+}
+
+// OBBalancesHandler — остаток по проводкам (InterimBooked) и доступный с учётом холдов (InterimAvailable)
+func (h *Handler) OBBalancesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	consent := obConsentFromContext(ctx)
+	if !consent.Allows(storage.PermReadBalances) {
+		respondOBError(w, http.StatusForbidden, storage.CodeForbidden, "Consent does not permit reading balances")
+		return
+	}
+	account, err := h.svc.ConsentAccount(ctx, consent, mux.Vars(r)["accountId"])
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	now := time.Now()
+	balance := func(kind string, value decimal.Decimal) obBalance {
+		return obBalance{
+			AccountID:            account.ID,
+			CreditDebitIndicator: creditDebit(!value.IsNegative()),
+			Type:                 kind,
+			DateTime:             now,
+			Amount:               obAmount{Amount: value.Abs().StringFixed(2), Currency: account.Currency},
+		}
+	}
+	balances := []obBalance{balance("InterimBooked", account.Balance), balance("InterimAvailable", account.AvailableBalance)}
+	respondOB(w, r, http.StatusOK, map[string]interface{}{"Balance": balances})
+}
+
+// parseOBTime разбирает необязательный параметр даты в RFC 3339
+func parseOBTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 date-time", name)
+	}
+	return &t, nil
+}
+
+// OBTransactionsHandler — выписка по счёту в окне согласия, новые операции первыми, страницами по page_size
+func (h *Handler) OBTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	consent := obConsentFromContext(ctx)
+	detail := consent.Allows(storage.PermReadTransactionsDetail)
+	if !detail && !consent.Allows(storage.PermReadTransactionsBasic) {
+		respondOBError(w, http.StatusForbidden, storage.CodeForbidden, "Consent does not permit reading transactions")
+		return
+	}
+	account, err := h.svc.ConsentAccount(ctx, consent, mux.Vars(r)["accountId"])
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	from, err := parseOBTime(r, "fromBookingDateTime")
+	if err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, err.Error())
+		return
+	}
+	to, err := parseOBTime(r, "toBookingDateTime")
+	if err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, err.Error())
+		return
+	}
+
+	txs := h.svc.ConsentTransactions(ctx, consent, account, from, to)
+	page, pageSize := parsePagination(r)
+	result := make([]obTransaction, 0)
+	for _, tx := range paginate(txs, page, pageSize) {
+		item := obTransaction{
+			AccountID:                      account.ID,
+			TransactionID:                  tx.ID,
+			CreditDebitIndicator:           creditDebit(tx.ToAccountID == account.ID),
+			Status:                         "Booked",
+			BookingDateTime:                tx.BookingDate,
+			ValueDateTime:                  tx.ValueDate,
+			Amount:                         obAmount{Amount: tx.Amount.StringFixed(2), Currency: account.Currency},
+			ProprietaryBankTransactionCode: obBankTransactionCode{Code: tx.TransactionType, Issuer: "BankApp"},
+		}
+		if detail {
+			item.TransactionInformation = tx.Description
+			if tx.Merchant != "" {
+				item.MerchantDetails = &obMerchantDetails{MerchantName: tx.Merchant}
+			}
+		}
+		result = append(result, item)
+	}
+
+	totalPages := (len(txs) + pageSize - 1) / pageSize
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	links := obLinks{Self: r.URL.RequestURI()}
+	if page < totalPages {
+		next := url.Values{}
+		for k, v := range r.URL.Query() {
+			next[k] = v
+		}
+		next.Set("page", strconv.Itoa(page+1))
+		links.Next = r.URL.Path + "?" + next.Encode()
+	}
+	respondJSON(w, http.StatusOK, obResponse{Data: map[string]interface{}{"Transaction": result}, Links: links, Meta: obMeta{TotalPages: totalPages}})
+}
+
+func (h *Handler) CreatePaymentConsentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req obPaymentConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+	initiation, err := fromOBInitiation(req.Data.Initiation)
+	if err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, err.Error())
+		return
+	}
+
+	consent, err := h.svc.CreatePaymentConsent(ctx, obClientFromContext(ctx).ID, initiation, time.Now())
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	w.Header().Set("Location", openBankingPrefix+"/domestic-payment-consents/"+consent.ID)
+	respondOB(w, r, http.StatusCreated, toOBPaymentConsent(consent))
+}
+
+func (h *Handler) GetPaymentConsentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	consent, err := h.svc.ClientPaymentConsent(ctx, obClientFromContext(ctx).ID, mux.Vars(r)["consentId"])
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	respondOB(w, r, http.StatusOK, toOBPaymentConsent(consent))
+}
+
+// CreateDomesticPaymentHandler исполняет согласие на платёж токеном приложения, выданным по этому согласию.
+// Отказ банка (лимиты, остаток) — не ошибка запроса: платёж создаётся в статусе Rejected.
+func (h *Handler) CreateDomesticPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, ok := sessionFromContext(ctx)
+	if !ok || session.Kind != storage.SessionKindOAuth {
+		respondOBError(w, http.StatusUnauthorized, storage.CodeUnauthorized, "Third-party app access token is required")
+		return
+	}
+	if !session.HasScope(storage.ScopeTransfersWrite) {
+		respondOBError(w, http.StatusForbidden, storage.CodeForbidden, fmt.Sprintf("Token lacks required scope %s", storage.ScopeTransfersWrite))
+		return
+	}
+	var req obDomesticPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+	initiation, err := fromOBInitiation(req.Data.Initiation)
+	if err != nil {
+		respondOBError(w, http.StatusBadRequest, storage.CodeValidation, err.Error())
+		return
+	}
+
+	payment, err := h.svc.ExecuteDomesticPayment(ctx, session, req.Data.ConsentID, initiation, time.Now())
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	w.Header().Set("Location", openBankingPrefix+"/domestic-payments/"+payment.ID)
+	respondOB(w, r, http.StatusCreated, toOBDomesticPayment(payment))
+}
+
+func (h *Handler) GetDomesticPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	payment, err := h.svc.ClientDomesticPayment(ctx, obClientFromContext(ctx).ID, mux.Vars(r)["paymentId"])
+	if err != nil {
+		respondOBStorageError(w, err)
+		return
+	}
+	respondOB(w, r, http.StatusOK, toOBDomesticPayment(payment))
+}
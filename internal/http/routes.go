@@ -0,0 +1,278 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"bankapp/internal/service"
+	"bankapp/internal/storage"
+)
+
+// Handler — HTTP-слой: разбирает запросы и вызывает сервисный слой
+type Handler struct {
+	svc *service.Service
+}
+
+func NewHandler(svc *service.Service) *Handler {
+	if adminConfig.Token == "" {
+		log.Println("BANKAPP_ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
+	return &Handler{svc: svc}
+}
+
+// Routes собирает роутер со всеми версиями API и цепочкой middleware
+func (h *Handler) Routes() http.Handler {
+	r := mux.NewRouter()
+	r.Use(versionNegotiationMiddleware)
+
+	// Текущая версия API; /v2 подключается отдельным подроутером рядом с ней
+	h.registerRoutes(r.PathPrefix("/v1").Subrouter())
+
+	// Open Banking для агрегаторов — со своей схемой и без версий внутреннего API
+	h.registerOpenBankingRoutes(r.PathPrefix(openBankingPrefix).Subrouter())
+
+	// Маршруты без префикса версии сохранены для старых клиентов и помечены как устаревшие
+	legacy := r.NewRoute().Subrouter()
+	legacy.Use(legacyDeprecationMiddleware)
+	h.registerRoutes(legacy)
+
+	return requestIDMiddleware(loggingMiddleware(h.partnerAuthMiddleware(h.sessionMiddleware(r))))
+}
+
+func (h *Handler) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/register", h.RegisterUserHandler).Methods("POST")
+	r.HandleFunc("/verify-email", h.VerifyEmailHandler).Methods("POST")
+	r.HandleFunc("/verify-email/resend", h.ResendVerificationHandler).Methods("POST")
+	r.HandleFunc("/login", h.LoginUserHandler).Methods("POST")
+	r.HandleFunc("/password/forgot", h.ForgotPasswordHandler).Methods("POST")
+	r.HandleFunc("/password/reset", h.ResetPasswordHandler).Methods("POST")
+	r.HandleFunc("/ws", h.WebSocketHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/tokens", h.CreatePersonalTokenHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/api-keys", h.CreateAPIKeyHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/api-keys", h.GetAPIKeysHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/api-keys/{keyId}/rotate", h.RotateAPIKeyHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/api-keys/{keyId}", h.RevokeAPIKeyHandler).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/oauth-grants", h.GetOAuthGrantsHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/oauth-grants/{grantId}", h.RevokeOAuthGrantHandler).Methods("DELETE")
+	r.HandleFunc("/oauth/authorize", h.GetOAuthConsentHandler).Methods("GET")
+	r.HandleFunc("/oauth/authorize", h.AuthorizeOAuthHandler).Methods("POST")
+	r.HandleFunc("/oauth/token", h.OAuthTokenHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/dependents", h.CreateDependentHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/dependents", h.GetDependentsHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/dependents/{childId}/controls", h.SetParentalControlHandler).Methods("PUT")
+	r.HandleFunc("/users/{userId}/dependents/{childId}/dashboard", h.GetDependentDashboardHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/security-events", h.GetSecurityEventsHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/sessions", h.GetUserSessionsHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/sessions/{sessionId}", h.RevokeSessionHandler).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/profile", h.GetProfileHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/profile", h.UpdateProfileHandler).Methods("PATCH")
+
+	r.HandleFunc("/admin/api-clients", adminOnly(h.CreateAPIClientHandler)).Methods("POST")
+	r.HandleFunc("/admin/api-clients", adminOnly(h.ListAPIClientsHandler)).Methods("GET")
+	r.HandleFunc("/admin/api-clients/{clientId}/rotate", adminOnly(h.RotateAPIClientSecretHandler)).Methods("POST")
+	r.HandleFunc("/admin/api-clients/{clientId}", adminOnly(h.DeactivateAPIClientHandler)).Methods("DELETE")
+
+	r.HandleFunc("/admin/storage/generations", adminOnly(h.GetStorageGenerationsHandler)).Methods("GET")
+	r.HandleFunc("/admin/audit-log", adminOnly(h.GetAuditLogHandler)).Methods("GET")
+	r.HandleFunc("/admin/search", adminOnly(h.AdminSearchHandler)).Methods("GET")
+	r.HandleFunc("/admin/sagas", adminOnly(h.ListSagasHandler)).Methods("GET")
+	r.HandleFunc("/admin/sagas/{sagaId}", adminOnly(h.GetSagaHandler)).Methods("GET")
+	r.HandleFunc("/admin/sagas/{sagaId}/retry", adminOnly(h.RetrySagaHandler)).Methods("POST")
+	r.HandleFunc("/admin/sagas/{sagaId}/resolve", adminOnly(h.ResolveSagaHandler)).Methods("POST")
+	r.HandleFunc("/admin/eod", adminOnly(h.ListEODBatchesHandler)).Methods("GET")
+	r.HandleFunc("/admin/eod/run", adminOnly(h.RunEndOfDayHandler)).Methods("POST")
+	r.HandleFunc("/admin/eod/{date}", adminOnly(h.GetEODBatchHandler)).Methods("GET")
+	r.HandleFunc("/admin/eod/{date}/balances", adminOnly(h.EODBalancesHandler)).Methods("GET")
+	r.HandleFunc("/admin/retention-policies", adminOnly(RetentionPoliciesHandler)).Methods("GET")
+	r.HandleFunc("/admin/transaction-archive", adminOnly(h.TransactionArchiveHandler)).Methods("GET")
+	r.HandleFunc("/admin/sandbox/rate-overrides", adminOnly(h.CreateRateOverrideHandler)).Methods("POST")
+	r.HandleFunc("/admin/sandbox/rate-overrides", adminOnly(h.ListRateOverridesHandler)).Methods("GET")
+	r.HandleFunc("/admin/sandbox/rate-overrides/{overrideId}", adminOnly(h.DeleteRateOverrideHandler)).Methods("DELETE")
+	r.HandleFunc("/dev/seed", adminOnly(h.DevSeedHandler)).Methods("POST")
+
+	r.HandleFunc("/products", ListProductsHandler).Methods("GET")
+	r.HandleFunc("/accounts", requireScope(storage.ScopeAccountsWrite, h.CreateAccountHandler)).Methods("POST")
+	r.HandleFunc("/accounts/lookup", requireScope(storage.ScopeAccountsRead, h.LookupAccountHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/accounts", requireScope(storage.ScopeAccountsRead, h.GetUserAccountsHandler)).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/close", requireScope(storage.ScopeAccountsWrite, h.requireAccountPermission(storage.OrgPermManage, h.CloseAccountHandler))).Methods("POST")
+	r.HandleFunc("/accounts/{accountId}/limits", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.GetAccountLimitsHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/limit-overrides", requireScope(storage.ScopeAccountsWrite, h.requireAccountPermission(storage.OrgPermManage, h.RequestLimitOverrideHandler))).Methods("POST")
+
+	r.HandleFunc("/organizations", requireScope(storage.ScopeAccountsWrite, h.CreateOrganizationHandler)).Methods("POST")
+	r.HandleFunc("/organizations/{orgId}", requireScope(storage.ScopeAccountsRead, h.requireOrgPermission(storage.OrgPermView, h.GetOrganizationHandler))).Methods("GET")
+	r.HandleFunc("/users/{userId}/organizations", requireScope(storage.ScopeAccountsRead, h.GetUserOrganizationsHandler)).Methods("GET")
+	r.HandleFunc("/organizations/{orgId}/members/{userId}", requireScope(storage.ScopeAccountsWrite, h.requireOrgPermission(storage.OrgPermManage, h.SetOrganizationMemberHandler))).Methods("PUT")
+	r.HandleFunc("/organizations/{orgId}/members/{userId}", requireScope(storage.ScopeAccountsWrite, h.requireOrgPermission(storage.OrgPermManage, h.RemoveOrganizationMemberHandler))).Methods("DELETE")
+	r.HandleFunc("/organizations/{orgId}/accounts", requireScope(storage.ScopeAccountsWrite, h.requireOrgPermission(storage.OrgPermManage, h.OpenBusinessAccountHandler))).Methods("POST")
+	r.HandleFunc("/organizations/{orgId}/accounts", requireScope(storage.ScopeAccountsRead, h.requireOrgPermission(storage.OrgPermView, h.GetOrganizationAccountsHandler))).Methods("GET")
+	r.HandleFunc("/organizations/{orgId}/approval-threshold", requireScope(storage.ScopeAccountsWrite, h.requireOrgPermission(storage.OrgPermManage, h.SetApprovalThresholdHandler))).Methods("PUT")
+	r.HandleFunc("/organizations/{orgId}/approvals", requireScope(storage.ScopeAccountsRead, h.requireOrgPermission(storage.OrgPermView, h.GetPaymentApprovalsHandler))).Methods("GET")
+	r.HandleFunc("/organizations/{orgId}/approvals/{approvalId}/{decision:approve|reject}", requireScope(storage.ScopeTransfersWrite, h.requireOrgPermission(storage.OrgPermPay, h.DecidePaymentApprovalHandler))).Methods("POST")
+
+	r.HandleFunc("/cards", requireScope(storage.ScopeCardsManage, h.GenerateCardHandler)).Methods("POST")
+	r.HandleFunc("/cards/batch", requireScope(storage.ScopeCardsManage, h.BatchIssueCardsHandler)).Methods("POST")
+	r.HandleFunc("/cards/{cardId}/transactions", requireScope(storage.ScopeAccountsRead, h.GetCardTransactionsHandler)).Methods("GET")
+	r.HandleFunc("/cards/{cardId}/tokens", requireScope(storage.ScopeCardsManage, h.CreateCardTokenHandler)).Methods("POST")
+	r.HandleFunc("/cards/{cardId}/tokens", requireScope(storage.ScopeAccountsRead, h.GetCardTokensHandler)).Methods("GET")
+	r.HandleFunc("/cards/{cardId}/tokens/{tokenId}/suspend", requireScope(storage.ScopeCardsManage, h.SuspendCardTokenHandler)).Methods("POST")
+	r.HandleFunc("/cards/{cardId}/tokens/{tokenId}/resume", requireScope(storage.ScopeCardsManage, h.ResumeCardTokenHandler)).Methods("POST")
+	r.HandleFunc("/cards/{cardId}/tokens/{tokenId}", requireScope(storage.ScopeCardsManage, h.DeleteCardTokenHandler)).Methods("DELETE")
+	r.HandleFunc("/cards/{cardId}/delivery", requireScope(storage.ScopeCardsManage, h.UpdateCardDeliveryHandler)).Methods("PATCH")
+	r.HandleFunc("/cards/{cardId}/reveal", requireScope(storage.ScopeCardsManage, h.StartCardRevealHandler)).Methods("POST")
+	r.HandleFunc("/cards/{cardId}/reveal/{revealId}/confirm", requireScope(storage.ScopeCardsManage, h.ConfirmCardRevealHandler)).Methods("POST")
+	r.HandleFunc("/cards/reveal/{token}", h.RedeemCardRevealHandler).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/cards", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.GetAccountCardsHandler))).Methods("GET")
+	r.HandleFunc("/operations/{operationId}", h.GetOperationHandler).Methods("GET")
+	r.HandleFunc("/payments/card", requireScope(storage.ScopeTransfersWrite, h.PayWithCardHandler)).Methods("POST")
+	r.HandleFunc("/payments/{paymentId}/confirm", requireScope(storage.ScopeTransfersWrite, h.ConfirmPaymentHandler)).Methods("POST")
+	r.HandleFunc("/payments/card/authorize", requireScope(storage.ScopeTransfersWrite, h.AuthorizeCardPaymentHandler)).Methods("POST")
+	r.HandleFunc("/payments/{authId}/capture", requireScope(storage.ScopeTransfersWrite, h.CapturePaymentHandler)).Methods("POST")
+	r.HandleFunc("/payments/{authId}/release", requireScope(storage.ScopeTransfersWrite, h.ReleasePaymentHandler)).Methods("POST")
+	r.HandleFunc("/payments/{transactionId}/refund", adminOnly(h.RefundPaymentHandler)).Methods("POST")
+	r.HandleFunc("/admin/deposits/{transactionId}/reverse", adminOnly(h.ReverseDepositHandler)).Methods("POST")
+	r.HandleFunc("/admin/transactions/backdated", adminOnly(h.PostBackdatedTransactionHandler)).Methods("POST")
+	r.HandleFunc("/admin/receivables", adminOnly(h.ListReceivablesHandler)).Methods("GET")
+	r.HandleFunc("/admin/limit-overrides", adminOnly(h.ListLimitOverridesHandler)).Methods("GET")
+	r.HandleFunc("/admin/limit-overrides/{overrideId}/{decision:approve|reject}", adminOnly(h.DecideLimitOverrideHandler)).Methods("POST")
+	r.HandleFunc("/admin/kyc", adminOnly(h.ListPendingKYCHandler)).Methods("GET")
+	r.HandleFunc("/admin/users/{userId}/kyc/{decision:verify|reject}", adminOnly(h.ReviewKYCHandler)).Methods("POST")
+	r.HandleFunc("/admin/merchants", adminOnly(h.RegisterMerchantHandler)).Methods("POST")
+	r.HandleFunc("/admin/merchants", adminOnly(h.ListMerchantsHandler)).Methods("GET")
+	r.HandleFunc("/admin/merchants/{merchantId}/keys", adminOnly(h.CreateMerchantKeyHandler)).Methods("POST")
+	r.HandleFunc("/admin/merchants/{merchantId}/keys", adminOnly(h.ListMerchantKeysHandler)).Methods("GET")
+	r.HandleFunc("/admin/merchants/{merchantId}/keys/{keyId}", adminOnly(h.RevokeMerchantKeyHandler)).Methods("DELETE")
+	r.HandleFunc("/merchant/payments", h.merchantOnly(h.GetMerchantPaymentsHandler)).Methods("GET")
+	r.HandleFunc("/merchant/settlements", h.merchantOnly(h.GetMerchantSettlementsHandler)).Methods("GET")
+	r.HandleFunc("/merchant/chargebacks", h.merchantOnly(h.GetMerchantChargebacksHandler)).Methods("GET")
+	r.HandleFunc("/merchant/chargebacks/{chargebackId}/evidence", h.merchantOnly(h.SubmitChargebackEvidenceHandler)).Methods("POST")
+	r.HandleFunc("/merchant/webhook", h.merchantOnly(h.GetMerchantWebhookHandler)).Methods("GET")
+	r.HandleFunc("/merchant/webhook", h.merchantOnly(h.SetMerchantWebhookHandler)).Methods("PUT")
+	r.HandleFunc("/merchant/webhook", h.merchantOnly(h.DeleteMerchantWebhookHandler)).Methods("DELETE")
+	r.HandleFunc("/merchant/webhook/rotate-secret", h.merchantOnly(h.RotateMerchantWebhookSecretHandler)).Methods("POST")
+	r.HandleFunc("/merchant/webhook/test", h.merchantOnly(h.TestMerchantWebhookHandler)).Methods("POST")
+	r.HandleFunc("/merchant/webhook/deliveries", h.merchantOnly(h.GetMerchantWebhookDeliveriesHandler)).Methods("GET")
+	r.HandleFunc("/payments/{transactionId}/chargebacks", requireScope(storage.ScopeTransfersWrite, h.FileChargebackHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/chargebacks", requireScope(storage.ScopeAccountsRead, h.GetUserChargebacksHandler)).Methods("GET")
+	r.HandleFunc("/admin/chargebacks", adminOnly(h.ListChargebacksHandler)).Methods("GET")
+	r.HandleFunc("/admin/chargebacks/{chargebackId}/{decision:accept|reject}", adminOnly(h.ResolveChargebackHandler)).Methods("POST")
+	r.HandleFunc("/admin/escrows", adminOnly(h.ListEscrowsHandler)).Methods("GET")
+	r.HandleFunc("/admin/escrows/{escrowId}/{decision:release|refund}", adminOnly(h.ResolveEscrowHandler)).Methods("POST")
+	r.HandleFunc("/admin/operations", adminOnly(h.ListOperationControlsHandler)).Methods("GET")
+	r.HandleFunc("/admin/metrics", adminOnly(h.MetricsHandler)).Methods("GET")
+	r.HandleFunc("/admin/metrics/overview", adminOnly(h.MetricsOverviewHandler)).Methods("GET")
+	r.HandleFunc("/admin/reconciliation", adminOnly(h.ReconciliationHandler)).Methods("GET")
+	r.HandleFunc("/admin/email-deliveries", adminOnly(EmailDeliveriesHandler)).Methods("GET")
+	r.HandleFunc("/admin/email-queue", adminOnly(h.ListEmailQueueHandler)).Methods("GET")
+	r.HandleFunc("/admin/email-queue/{notificationId}/requeue", adminOnly(h.RequeueEmailHandler)).Methods("POST")
+	r.HandleFunc("/admin/operations/{type}", adminOnly(h.SetOperationControlHandler)).Methods("PUT")
+	r.HandleFunc("/admin/broadcasts", adminOnly(h.CreateBroadcastHandler)).Methods("POST")
+	r.HandleFunc("/admin/broadcasts", adminOnly(h.ListBroadcastsHandler)).Methods("GET")
+	r.HandleFunc("/admin/broadcasts/{broadcastId}", adminOnly(h.GetBroadcastHandler)).Methods("GET")
+	r.HandleFunc("/admin/broadcasts/{broadcastId}/recipients", adminOnly(h.GetBroadcastRecipientsHandler)).Methods("GET")
+
+	r.HandleFunc("/transfers", requireScope(storage.ScopeTransfersWrite, h.TransferHandler)).Methods("POST")
+	r.HandleFunc("/transfers/p2p", requireScope(storage.ScopeTransfersWrite, h.P2PTransferHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/aliases", requireScope(storage.ScopeAccountsWrite, h.SetAliasHandler)).Methods("PUT")
+	r.HandleFunc("/users/{userId}/device-keys", h.RegisterDeviceKeyHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/device-keys", requireScope(storage.ScopeAccountsRead, h.GetDeviceKeysHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/device-keys/{keyId}", requireScope(storage.ScopeAccountsWrite, h.RevokeDeviceKeyHandler)).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/aliases", requireScope(storage.ScopeAccountsRead, h.GetAliasesHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/aliases/{type:phone|username}/{value}", requireScope(storage.ScopeAccountsWrite, h.DeleteAliasHandler)).Methods("DELETE")
+	r.HandleFunc("/invoices", requireScope(storage.ScopeAccountsWrite, h.CreateInvoiceHandler)).Methods("POST")
+	r.HandleFunc("/invoices/{invoiceId}", h.GetInvoiceHandler).Methods("GET")
+	r.HandleFunc("/invoices/{invoiceId}/pay", requireScope(storage.ScopeTransfersWrite, h.PayInvoiceHandler)).Methods("POST")
+	r.HandleFunc("/invoices/{invoiceId}/cancel", requireScope(storage.ScopeAccountsWrite, h.CancelInvoiceHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/invoices", requireScope(storage.ScopeAccountsRead, h.GetUserInvoicesHandler)).Methods("GET")
+	r.HandleFunc("/payment-requests", requireScope(storage.ScopeTransfersWrite, h.CreatePaymentRequestHandler)).Methods("POST")
+	r.HandleFunc("/payment-requests/{requestId}", requireScope(storage.ScopeAccountsRead, h.GetPaymentRequestHandler)).Methods("GET")
+	r.HandleFunc("/payment-requests/{requestId}/accept", requireScope(storage.ScopeTransfersWrite, h.AcceptPaymentRequestHandler)).Methods("POST")
+	r.HandleFunc("/payment-requests/{requestId}/decline", requireScope(storage.ScopeTransfersWrite, h.DeclinePaymentRequestHandler)).Methods("POST")
+	r.HandleFunc("/payment-requests/{requestId}/cancel", requireScope(storage.ScopeTransfersWrite, h.CancelPaymentRequestHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/payment-requests", requireScope(storage.ScopeAccountsRead, h.GetUserPaymentRequestsHandler)).Methods("GET")
+	r.HandleFunc("/escrows", requireScope(storage.ScopeTransfersWrite, h.CreateEscrowHandler)).Methods("POST")
+	r.HandleFunc("/escrows/{escrowId}", requireScope(storage.ScopeAccountsRead, h.GetEscrowHandler)).Methods("GET")
+	r.HandleFunc("/escrows/{escrowId}/{action:fulfill|release|dispute}", requireScope(storage.ScopeTransfersWrite, h.EscrowActionHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/escrows", requireScope(storage.ScopeAccountsRead, h.GetUserEscrowsHandler)).Methods("GET")
+	r.HandleFunc("/transfers/import", requireScope(storage.ScopeTransfersWrite, h.ImportPaymentsHandler)).Methods("POST")
+	r.HandleFunc("/transfers/import/{operationId}/report", requireScope(storage.ScopeAccountsRead, h.GetPaymentImportReportHandler)).Methods("GET")
+	r.HandleFunc("/deposits", requireScope(storage.ScopeTransfersWrite, h.DepositHandler)).Methods("POST")
+	r.HandleFunc("/exchange", requireScope(storage.ScopeTransfersWrite, h.ExchangeHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/fx-sweep", requireScope(storage.ScopeAccountsWrite, h.SetFXSweepRuleHandler)).Methods("PUT")
+	r.HandleFunc("/users/{userId}/fx-sweep", requireScope(storage.ScopeAccountsRead, h.GetFXSweepRuleHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/fx-sweep", requireScope(storage.ScopeAccountsWrite, h.DeleteFXSweepRuleHandler)).Methods("DELETE")
+	r.HandleFunc("/bank-connectors", requireScope(storage.ScopeAccountsRead, h.GetBankConnectorsHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/bank-links", requireScope(storage.ScopeAccountsWrite, h.LinkBankHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/bank-links", requireScope(storage.ScopeAccountsRead, h.GetBankLinksHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/bank-links/{linkId}/sync", requireScope(storage.ScopeAccountsWrite, h.SyncBankLinkHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/bank-links/{linkId}", requireScope(storage.ScopeAccountsWrite, h.UnlinkBankHandler)).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/external-accounts", requireScope(storage.ScopeAccountsRead, h.GetExternalAccountsHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/external-accounts/{accountId}/transactions", requireScope(storage.ScopeAccountsRead, h.GetExternalTransactionsHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/auto-transfers", requireScope(storage.ScopeAccountsWrite, h.CreateAutoTransferRuleHandler)).Methods("POST")
+	r.HandleFunc("/users/{userId}/auto-transfers", requireScope(storage.ScopeAccountsRead, h.GetAutoTransferRulesHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/auto-transfers/{ruleId}", requireScope(storage.ScopeAccountsWrite, h.UpdateAutoTransferRuleHandler)).Methods("PUT")
+	r.HandleFunc("/users/{userId}/auto-transfers/{ruleId}", requireScope(storage.ScopeAccountsWrite, h.DeleteAutoTransferRuleHandler)).Methods("DELETE")
+	r.HandleFunc("/accounts/{accountId}/alerts", requireScope(storage.ScopeAccountsWrite, h.requireAccountPermission(storage.OrgPermManage, h.CreateAlertRuleHandler))).Methods("POST")
+	r.HandleFunc("/accounts/{accountId}/alerts", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.GetAlertRulesHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/alerts/{ruleId}", requireScope(storage.ScopeAccountsWrite, h.requireAccountPermission(storage.OrgPermManage, h.UpdateAlertRuleHandler))).Methods("PUT")
+	r.HandleFunc("/accounts/{accountId}/alerts/{ruleId}", requireScope(storage.ScopeAccountsWrite, h.requireAccountPermission(storage.OrgPermManage, h.DeleteAlertRuleHandler))).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/limits", requireScope(storage.ScopeAccountsRead, h.GetUserLimitsHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/loans", requireScope(storage.ScopeAccountsRead, h.GetUserLoansHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/guarantees", requireScope(storage.ScopeAccountsRead, h.GetUserGuaranteesHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/credit-score", requireScope(storage.ScopeAccountsRead, h.GetCreditScoreHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/settings", requireScope(storage.ScopeAccountsRead, h.GetUserSettingsHandler)).Methods("GET")
+	r.HandleFunc("/users/{userId}/settings", requireScope(storage.ScopeAccountsWrite, h.UpdateUserSettingsHandler)).Methods("PUT")
+	r.HandleFunc("/users/{userId}/digest/preview", requireScope(storage.ScopeAccountsRead, h.GetDigestPreviewHandler)).Methods("GET")
+	r.HandleFunc("/transactions/search", requireScope(storage.ScopeAnalyticsRead, h.SearchTransactionsHandler)).Methods("GET")
+	r.HandleFunc("/transactions/{transactionId}", requireScope(storage.ScopeAccountsRead, h.GetTransactionDetailHandler)).Methods("GET")
+
+	r.HandleFunc("/loans", requireScope(storage.ScopeAccountsWrite, h.ApplyLoanHandler)).Methods("POST")
+	r.HandleFunc("/loans/{loanId}", requireScope(storage.ScopeAccountsRead, h.GetLoanHandler)).Methods("GET")
+	r.HandleFunc("/loans/{loanId}/schedule", requireScope(storage.ScopeAccountsRead, h.GetLoanScheduleHandler)).Methods("GET")
+	r.HandleFunc("/loans/{loanId}/holiday", requireScope(storage.ScopeAccountsWrite, h.LoanHolidayHandler)).Methods("POST")
+	r.HandleFunc("/loans/{loanId}/guarantee/{action}", requireScope(storage.ScopeAccountsWrite, h.LoanGuaranteeHandler)).Methods("POST")
+
+	r.HandleFunc("/analytics/transactions/{accountId}", requireScope(storage.ScopeAnalyticsRead, h.requireAccountPermission(storage.OrgPermView, h.GetTransactionsHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/statement", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.GetStatementHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/statement.{format:camt053|mt940}", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.GetStatementHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/interest-certificate", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.GetInterestCertificateHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/transactions/import", requireScope(storage.ScopeAccountsWrite, h.requireAccountPermission(storage.OrgPermManage, h.ImportTransactionsHandler))).Methods("POST")
+	r.HandleFunc("/accounts/{accountId}/transactions/export", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.ExportTransactionsHandler))).Methods("GET")
+	r.HandleFunc("/accounts/{accountId}/transactions/stream", requireScope(storage.ScopeAccountsRead, h.requireAccountPermission(storage.OrgPermView, h.StreamTransactionsHandler))).Methods("GET")
+	r.HandleFunc("/rates/history", requireScope(storage.ScopeAnalyticsRead, h.GetRateHistoryHandler)).Methods("GET")
+	r.HandleFunc("/analytics/summary/{userId}", requireScope(storage.ScopeAnalyticsRead, h.GetFinancialSummaryHandler)).Methods("GET")
+	r.HandleFunc("/analytics/cashflow/{userId}", requireScope(storage.ScopeAnalyticsRead, h.GetCashflowHandler)).Methods("GET")
+	r.HandleFunc("/analytics/merchants/{userId}", requireScope(storage.ScopeAnalyticsRead, h.GetMerchantSpendingHandler)).Methods("GET")
+	r.HandleFunc("/analytics/recurring/{userId}", requireScope(storage.ScopeAnalyticsRead, h.GetRecurringPaymentsHandler)).Methods("GET")
+
+	r.HandleFunc("/webhooks", h.CreateWebhookHandler).Methods("POST")
+	r.HandleFunc("/webhooks/events", ListWebhookEventsHandler).Methods("GET")
+	r.HandleFunc("/webhooks/{webhookId}/test", h.TestWebhookHandler).Methods("POST")
+	r.HandleFunc("/webhooks/{webhookId}", h.DeleteWebhookHandler).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/webhooks", h.GetUserWebhooksHandler).Methods("GET")
+}
+
+// requestIDMiddleware принимает X-Request-ID клиента или выдаёт новый и возвращает его в ответе
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = storage.GenerateID()
+			r.Header.Set(requestIDHeader, requestID)
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(requestIDHeader)
+		log.Printf("--> %s %s %s [%s]", r.Method, r.RequestURI, r.Proto, requestID)
+		next.ServeHTTP(w, r)
+		log.Printf("<-- %s %s (%v) [%s]", r.Method, r.RequestURI, time.Since(start), requestID)
+	})
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const currentAPIVersion = "1"
+
+var supportedAPIVersions = map[string]bool{"1": true}
+
+// Дата отключения маршрутов без префикса версии
+var legacyRoutesSunset = time.Date(2026, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+type routeDeprecation struct {
+	Since     time.Time
+	Sunset    time.Time
+	Successor string
+}
+
+// deprecatedRoutes — выводимые из эксплуатации маршруты версии, key: шаблон пути внутри версии
+var deprecatedRoutes = map[string]routeDeprecation{
+	"/analytics/transactions/{accountId}": {
+		Since:     time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC),
+		Successor: "/v1/accounts/{accountId}/statement",
+	},
+}
+
+// requestedAPIVersion читает версию из заголовка API-Version или из Accept: application/vnd.bankapp.v1+json
+func requestedAPIVersion(r *http.Request) string {
+	if v := strings.TrimPrefix(strings.TrimSpace(r.Header.Get("API-Version")), "v"); v != "" {
+		return v
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		if strings.HasPrefix(mediaType, "application/vnd.bankapp.v") {
+			return strings.TrimSuffix(strings.TrimPrefix(mediaType, "application/vnd.bankapp.v"), "+json")
+		}
+	}
+	return ""
+}
+
+func versionNegotiationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := currentAPIVersion
+		if strings.HasPrefix(r.URL.Path, "/v") {
+			version = strings.TrimPrefix(strings.SplitN(r.URL.Path, "/", 3)[1], "v")
+		} else if requested := requestedAPIVersion(r); requested != "" {
+			if !supportedAPIVersions[requested] {
+				respondError(w, http.StatusNotAcceptable, fmt.Sprintf("API version %s is not supported", requested))
+				return
+			}
+			version = requested
+		}
+		w.Header().Set("API-Version", version)
+
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				if dep, ok := deprecatedRoutes[strings.TrimPrefix(tmpl, "/v"+version)]; ok {
+					setDeprecationHeaders(w, dep.Since, dep.Sunset, dep.Successor)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func legacyDeprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Собственный срок отключения маршрута из deprecatedRoutes важнее общего
+		if w.Header().Get("Sunset") == "" {
+			setDeprecationHeaders(w, time.Time{}, legacyRoutesSunset, "/v"+currentAPIVersion+r.URL.Path)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Заголовки по RFC 8594 (Sunset) и draft-ietf-httpapi-deprecation-header
+func setDeprecationHeaders(w http.ResponseWriter, since, sunset time.Time, successor string) {
+	if since.IsZero() {
+		w.Header().Set("Deprecation", "true")
+	} else {
+		w.Header().Set("Deprecation", since.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	if successor != "" {
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var AlertConfig = struct {
+	MaxRulesPerAccount int
+}{
+	MaxRulesPerAccount: 20,
+}
+
+var alertChannels = map[string]bool{storage.AlertChannelEmail: true, storage.AlertChannelPush: true}
+
+func applyAlertRuleRequest(rule *storage.AlertRule, req storage.AlertRuleRequest) error {
+	switch req.Type {
+	case storage.AlertBalanceBelow:
+		if req.Threshold.IsNegative() {
+			return invalidInputf("threshold must not be negative")
+		}
+	case storage.AlertTransactionAbove:
+		if !req.Threshold.IsPositive() {
+			return invalidInputf("threshold must be positive")
+		}
+	case storage.AlertForeignCurrency:
+		if !req.Threshold.IsZero() {
+			return invalidInputf("threshold does not apply to %s alerts", storage.AlertForeignCurrency)
+		}
+	case storage.AlertRecurringPrice:
+		if req.Threshold.IsNegative() {
+			return invalidInputf("threshold must not be negative")
+		}
+	default:
+		return invalidInputf("type must be %s, %s, %s or %s", storage.AlertBalanceBelow, storage.AlertTransactionAbove, storage.AlertForeignCurrency, storage.AlertRecurringPrice)
+	}
+	channels := req.Channels
+	if len(channels) == 0 {
+		channels = []string{storage.AlertChannelEmail, storage.AlertChannelPush}
+	}
+	seen := make(map[string]bool, len(channels))
+	for _, ch := range channels {
+		if !alertChannels[ch] {
+			return invalidInputf("channel must be %s or %s", storage.AlertChannelEmail, storage.AlertChannelPush)
+		}
+		if seen[ch] {
+			return invalidInputf("channel %s is listed twice", ch)
+		}
+		seen[ch] = true
+	}
+	if rule.Type != req.Type || !rule.Threshold.Equal(req.Threshold) {
+		rule.Below = false
+	}
+	rule.Type = req.Type
+	rule.Threshold = req.Threshold
+	rule.Channels = channels
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// CreateAlertRule заводит оповещение по счёту; проверяться оно начнёт со следующей операции
+func (svc *Service) CreateAlertRule(ctx context.Context, account storage.Account, req storage.AlertRuleRequest, now time.Time) (storage.AlertRule, error) {
+	if len(svc.ListAlertRules(ctx, account.ID)) >= AlertConfig.MaxRulesPerAccount {
+		return storage.AlertRule{}, &storage.StorageError{Kind: storage.ErrQuotaExceeded, Message: fmt.Sprintf("at most %d alert rules per account", AlertConfig.MaxRulesPerAccount)}
+	}
+	rule := storage.AlertRule{ID: storage.GenerateID(), AccountID: account.ID, UserID: account.UserID, Enabled: true, CreatedAt: now, UpdatedAt: now}
+	if err := applyAlertRuleRequest(&rule, req); err != nil {
+		return storage.AlertRule{}, err
+	}
+	if err := svc.AddAlertRule(ctx, rule); err != nil {
+		return storage.AlertRule{}, err
+	}
+	log.Printf("Alert rule %s (%s) created for account %s", rule.ID, rule.Type, account.ID)
+	return rule, nil
+}
+
+// UpdateAlertRuleSettings заменяет условия оповещения; смена типа или порога сбрасывает состояние balance_below
+func (svc *Service) UpdateAlertRuleSettings(ctx context.Context, accountID, ruleID string, req storage.AlertRuleRequest, now time.Time) (storage.AlertRule, error) {
+	return svc.UpdateAlertRule(ctx, accountID, ruleID, func(rule *storage.AlertRule) error {
+		if err := applyAlertRuleRequest(rule, req); err != nil {
+			return err
+		}
+		rule.UpdatedAt = now
+		return nil
+	})
+}
+
+// StartAlertEngine проверяет оповещения счёта после каждой транзакции по нему
+func (svc *Service) StartAlertEngine(ctx context.Context) {
+	events := svc.events.SubscribeAll(1024)
+	go func() {
+		for event := range events {
+			if event.Type != storage.EventTransactionCreated {
+				continue
+			}
+			tx, ok := event.Payload.(storage.Transaction)
+			if !ok {
+				continue
+			}
+			svc.evaluateAlerts(ctx, event.AccountID, tx, time.Now())
+		}
+	}()
+}
+
+func (svc *Service) evaluateAlerts(ctx context.Context, accountID string, tx storage.Transaction, now time.Time) {
+	rules := svc.ListAlertRules(ctx, accountID)
+	if len(rules) == 0 {
+		return
+	}
+	account, ok := svc.GetAccount(ctx, accountID)
+	if !ok {
+		return
+	}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		var message string
+		fire := false
+		switch rule.Type {
+		case storage.AlertBalanceBelow:
+			below := account.Balance.LessThan(rule.Threshold)
+			fire = below && !rule.Below
+			if below != rule.Below {
+				if _, err := svc.UpdateAlertRule(ctx, accountID, rule.ID, func(r *storage.AlertRule) error {
+					r.Below = below
+					return nil
+				}); err != nil {
+					log.Printf("Alert rule %s: %v", rule.ID, err)
+				}
+			}
+			message = fmt.Sprintf("The balance of account %s is %s %s, below your alert threshold of %s %s.",
+				account.Number, account.Balance.StringFixed(2), account.Currency, rule.Threshold.StringFixed(2), account.Currency)
+		case storage.AlertTransactionAbove:
+			fire = tx.Amount.GreaterThan(rule.Threshold)
+			message = fmt.Sprintf("An operation of %s %s (%s) was made on account %s, above your alert threshold of %s %s.",
+				tx.Amount.StringFixed(2), account.Currency, tx.TransactionType, account.Number, rule.Threshold.StringFixed(2), account.Currency)
+		case storage.AlertForeignCurrency:
+			currency, foreign := svc.foreignCurrency(ctx, account, tx)
+			fire = foreign
+			message = fmt.Sprintf("A %s operation of %s %s involving %s was made on account %s.",
+				tx.TransactionType, tx.Amount.StringFixed(2), account.Currency, currency, account.Number)
+		case storage.AlertRecurringPrice:
+			rp, increased := svc.recurringPriceIncrease(ctx, account, tx)
+			if !increased {
+				continue
+			}
+			limit := rp.Amount.Mul(decimal.NewFromInt(100).Add(rule.Threshold)).Div(decimal.NewFromInt(100))
+			fire = tx.Amount.GreaterThan(limit)
+			payee := rp.Merchant
+			if payee == "" {
+				payee = "account " + rp.ToAccountID
+				if to, ok := svc.GetAccount(ctx, rp.ToAccountID); ok {
+					payee = "account " + to.Number
+				}
+			}
+			message = fmt.Sprintf("Your %s payment to %s from account %s went up from %s to %s %s.",
+				rp.Period, payee, account.Number, rp.Amount.StringFixed(2), tx.Amount.StringFixed(2), account.Currency)
+		}
+		if fire {
+			svc.deliverAlert(ctx, rule, account, tx, message, now)
+		}
+	}
+}
+
+// foreignCurrency — валюта операции, если это не рубль: валюта самого счёта, счёта на другой стороне
+// или, для шагов обмена, валюта второй стороны обмена
+func (svc *Service) foreignCurrency(ctx context.Context, account storage.Account, tx storage.Transaction) (string, bool) {
+	if account.Currency != storage.BaseCurrency {
+		return account.Currency, true
+	}
+	for _, key := range []string{"from_currency", "to_currency"} {
+		if currency := tx.DescriptionParams[key]; currency != "" && currency != storage.BaseCurrency {
+			return currency, true
+		}
+	}
+	counterpart := tx.ToAccountID
+	if counterpart == account.ID {
+		counterpart = tx.FromAccountID
+	}
+	if other, ok := svc.GetAccount(ctx, counterpart); ok && other.Currency != storage.BaseCurrency {
+		return other.Currency, true
+	}
+	return "", false
+}
+
+// deliverAlert отправляет оповещение по выбранным каналам и запоминает срабатывание
+func (svc *Service) deliverAlert(ctx context.Context, rule storage.AlertRule, account storage.Account, tx storage.Transaction, message string, now time.Time) {
+	if _, err := svc.UpdateAlertRule(ctx, rule.AccountID, rule.ID, func(r *storage.AlertRule) error {
+		triggered := now
+		r.LastTriggeredAt = &triggered
+		r.LastTransactionID = tx.ID
+		return nil
+	}); err != nil {
+		log.Printf("Alert rule %s: %v", rule.ID, err)
+	}
+	for _, channel := range rule.Channels {
+		switch channel {
+		case storage.AlertChannelPush:
+			svc.events.Publish(storage.Event{
+				Type:      storage.EventAccountAlert,
+				UserID:    account.UserID,
+				AccountID: account.ID,
+				Payload: map[string]interface{}{
+					"rule_id":        rule.ID,
+					"alert_type":     rule.Type,
+					"threshold":      rule.Threshold,
+					"transaction_id": tx.ID,
+					"amount":         tx.Amount,
+					"balance":        account.Balance,
+					"currency":       account.Currency,
+					"message":        message,
+				},
+			})
+		case storage.AlertChannelEmail:
+			if user, ok := svc.GetUser(ctx, account.UserID); ok {
+				svc.QueueEmail(ctx, user.Email, "Simple Bank: account alert", fmt.Sprintf("Hello %s,\n\n%s", user.Username, message))
+			}
+		}
+	}
+	log.Printf("Alert rule %s (%s) triggered on account %s by transaction %s", rule.ID, rule.Type, account.ID, tx.ID)
+}
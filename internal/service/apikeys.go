@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// userKeyPrefix отличает ключи пользователей от ключей мерчантов и токенов сессий
+const userKeyPrefix = "uk_"
+
+var APIKeyConfig = struct {
+	MaxActivePerUser int
+}{
+	MaxActivePerUser: 10,
+}
+
+func newUserAPIKeySecret() (secret, prefix string) {
+	secret = userKeyPrefix + storage.GenerateToken()
+	return secret, secret[:len(userKeyPrefix)+8]
+}
+
+// IssueUserAPIKey выпускает ключ с уровнем доступа read_only или transact; открытое значение возвращается только здесь
+func (svc *Service) IssueUserAPIKey(ctx context.Context, userID string, req storage.CreateAPIKeyRequest, now time.Time) (storage.UserAPIKey, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return storage.UserAPIKey{}, "", invalidInputf("api key name is required")
+	}
+	scopes, ok := storage.APIKeyAccessScopes[req.Access]
+	if !ok {
+		return storage.UserAPIKey{}, "", invalidInputf("access must be %s or %s", storage.APIKeyReadOnly, storage.APIKeyTransact)
+	}
+	active := 0
+	for _, key := range svc.GetUserAPIKeys(ctx, userID) {
+		if key.RevokedAt == nil {
+			active++
+		}
+	}
+	if active >= APIKeyConfig.MaxActivePerUser {
+		return storage.UserAPIKey{}, "", &storage.StorageError{Kind: storage.ErrQuotaExceeded, Code: storage.CodeQuotaExceeded,
+			Message: fmt.Sprintf("at most %d active api keys per user", APIKeyConfig.MaxActivePerUser)}
+	}
+
+	secret, prefix := newUserAPIKeySecret()
+	key := storage.UserAPIKey{
+		ID:        storage.GenerateID(),
+		UserID:    userID,
+		Name:      name,
+		Access:    req.Access,
+		Scopes:    append([]string(nil), scopes...),
+		Prefix:    prefix,
+		KeyHash:   sha256Hex(secret),
+		CreatedAt: now,
+	}
+	if err := svc.AddUserAPIKey(ctx, key); err != nil {
+		return storage.UserAPIKey{}, "", err
+	}
+	log.Printf("API key %s (%s) issued for user %s", key.ID, key.Access, userID)
+	return key, secret, nil
+}
+
+// RotateUserAPIKey выдаёт ключу новый секрет; прежний перестаёт приниматься сразу
+func (svc *Service) RotateUserAPIKey(ctx context.Context, userID, keyID string, now time.Time) (storage.UserAPIKey, string, error) {
+	secret, prefix := newUserAPIKeySecret()
+	key, err := svc.Repository.RotateUserAPIKey(ctx, userID, keyID, prefix, sha256Hex(secret), now)
+	if err != nil {
+		return storage.UserAPIKey{}, "", err
+	}
+	log.Printf("API key %s rotated for user %s", keyID, userID)
+	return key, secret, nil
+}
+
+// AuthenticateAPIKey проверяет ключ из X-API-Key и собирает из него сессию запроса: дальше scope и владелец
+// проверяются так же, как для токенов сессий
+func (svc *Service) AuthenticateAPIKey(ctx context.Context, secret string, now time.Time) (storage.Session, error) {
+	if !strings.HasPrefix(secret, userKeyPrefix) {
+		return storage.Session{}, invalidInputf("malformed api key")
+	}
+	key, err := svc.AuthenticateUserAPIKey(ctx, sha256Hex(secret), now)
+	if err != nil {
+		return storage.Session{}, err
+	}
+	return storage.Session{
+		ID:         key.ID,
+		UserID:     key.UserID,
+		CreatedAt:  key.CreatedAt,
+		LastSeenAt: now,
+		Kind:       storage.SessionKindAPIKey,
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+	}, nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var DualControlConfig = struct {
+	DefaultThreshold decimal.Decimal // порог новой организации, ₽
+	ApprovalWindow   time.Duration   // столько перевод ждёт подтверждения
+}{
+	DefaultThreshold: decimal.NewFromInt(1_000_000),
+	ApprovalWindow:   72 * time.Hour,
+}
+
+func approvalNotFound(id string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeApprovalNotFound, Message: fmt.Sprintf("payment approval %s not found", id)}
+}
+
+func (svc *Service) auditPaymentApproval(ctx context.Context, actor, action string, approval storage.PaymentApproval, now time.Time) {
+	if actor == "" {
+		actor = "admin"
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    action,
+		Details: map[string]string{"approval_id": approval.ID, "organization_id": approval.OrganizationID,
+			"from_account_id": approval.FromAccountID, "amount": approval.Amount.String(), "currency": approval.Currency},
+	})
+}
+
+// SetApprovalThreshold меняет порог двойного контроля организации; 0 отключает подтверждение переводов
+func (svc *Service) SetApprovalThreshold(ctx context.Context, orgID, actor string, threshold decimal.Decimal, now time.Time) (storage.Organization, error) {
+	if threshold.IsNegative() {
+		return storage.Organization{}, invalidInputf("threshold must not be negative")
+	}
+	org, err := svc.UpdateOrganization(ctx, orgID, func(o *storage.Organization) error {
+		o.ApprovalThreshold = threshold
+		return nil
+	})
+	if err != nil {
+		return storage.Organization{}, err
+	}
+	svc.auditOrganization(ctx, actor, "organization.approval_threshold", org, map[string]string{"threshold": threshold.String()}, now)
+	return org, nil
+}
+
+// PaymentApprovalRequired — нужен ли второй участник для перевода amount со счёта организации
+func (svc *Service) PaymentApprovalRequired(ctx context.Context, account storage.Account, amount decimal.Decimal) (bool, error) {
+	if account.OrganizationID == "" {
+		return false, nil
+	}
+	org, ok := svc.GetOrganization(ctx, account.OrganizationID)
+	if !ok || !org.ApprovalThreshold.IsPositive() {
+		return false, nil
+	}
+	base, err := svc.toBaseCurrency(ctx, amount, account.Currency)
+	if err != nil {
+		return false, err
+	}
+	return base.GreaterThan(org.ApprovalThreshold), nil
+}
+
+// AuthorizeDebit проверяет, что userID может списать amount со счёта вне /transfers: личный счёт — только владелец,
+// счёт организации — участник с правом платежей. Суммы выше порога двойного контроля здесь не проходят:
+// подтверждение вторым участником есть только у обычного перевода.
+func (svc *Service) AuthorizeDebit(ctx context.Context, account storage.Account, userID string, amount decimal.Decimal) error {
+	if account.OrganizationID == "" {
+		if userID == "" || account.UserID != userID {
+			return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("source account %s not found", account.ID)}
+		}
+		return nil
+	}
+	if err := svc.AuthorizeOrgAccount(ctx, account, userID, storage.OrgPermPay); err != nil {
+		return err
+	}
+	required, err := svc.PaymentApprovalRequired(ctx, account, amount)
+	if err != nil {
+		return err
+	}
+	if required {
+		return &storage.StorageError{Kind: storage.ErrConflict,
+			Message: fmt.Sprintf("payments from account %s above the approval threshold must go through a transfer with approval", account.ID)}
+	}
+	return nil
+}
+
+// RequestPaymentApproval ставит перевод со счёта организации в очередь на подтверждение и пишет участникам,
+// которые могут его подтвердить. Если таких, кроме автора, нет, перевод не создаётся.
+func (svc *Service) RequestPaymentApproval(ctx context.Context, from storage.Account, toAccountID string, amount decimal.Decimal, maker string, now time.Time) (storage.PaymentApproval, error) {
+	org, ok := svc.GetOrganization(ctx, from.OrganizationID)
+	if !ok {
+		return storage.PaymentApproval{}, orgNotFound(from.OrganizationID)
+	}
+	checkers := make([]string, 0, len(org.Members))
+	for _, m := range org.Members {
+		if m.UserID != maker && org.Allows(m.UserID, storage.OrgPermPay) {
+			checkers = append(checkers, m.UserID)
+		}
+	}
+	if len(checkers) == 0 {
+		return storage.PaymentApproval{}, &storage.StorageError{Kind: storage.ErrConflict,
+			Message: fmt.Sprintf("transfers above %s %s need a second member with payment rights", org.ApprovalThreshold.String(), storage.BaseCurrency)}
+	}
+
+	approval := storage.PaymentApproval{
+		ID:             storage.GenerateID(),
+		OrganizationID: org.ID,
+		FromAccountID:  from.ID,
+		ToAccountID:    toAccountID,
+		Amount:         amount,
+		Currency:       from.Currency,
+		Status:         storage.PaymentApprovalPending,
+		MakerUserID:    maker,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(DualControlConfig.ApprovalWindow),
+	}
+	if err := svc.AddPaymentApproval(ctx, approval); err != nil {
+		return storage.PaymentApproval{}, err
+	}
+	svc.auditPaymentApproval(ctx, maker, "payment.approval_requested", approval, now)
+	for _, userID := range checkers {
+		if user, ok := svc.GetUser(ctx, userID); ok {
+			svc.QueueEmail(ctx, user.Email, "Simple Bank: a payment awaits your approval",
+				fmt.Sprintf("Hello %s,\n\nA transfer of %s %s from an account of %s awaits a second approval. "+
+					"Approve or reject payment %s before %s.",
+					user.Username, amount.StringFixed(2), from.Currency, org.Name, approval.ID, approval.ExpiresAt.Format("02.01.2006 15:04")))
+		}
+	}
+	log.Printf("Transfer of %s %s from %s awaits approval %s", amount.String(), from.Currency, from.ID, approval.ID)
+	return approval, nil
+}
+
+// expirePaymentApproval закрывает просроченное подтверждение при первом обращении к нему
+func (svc *Service) expirePaymentApproval(ctx context.Context, approval storage.PaymentApproval, now time.Time) storage.PaymentApproval {
+	if approval.Status != storage.PaymentApprovalPending || !now.After(approval.ExpiresAt) {
+		return approval
+	}
+	expired, err := svc.UpdatePaymentApproval(ctx, approval.ID, func(a *storage.PaymentApproval) error {
+		if a.Status == storage.PaymentApprovalPending {
+			a.Status = storage.PaymentApprovalExpired
+			a.DecidedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return approval
+	}
+	return expired
+}
+
+// PaymentApprovals — очередь переводов организации по статусу (пусто — все)
+func (svc *Service) PaymentApprovals(ctx context.Context, orgID, status string, now time.Time) []storage.PaymentApproval {
+	approvals := svc.ListPaymentApprovals(ctx, orgID, "")
+	result := make([]storage.PaymentApproval, 0, len(approvals))
+	for _, approval := range approvals {
+		approval = svc.expirePaymentApproval(ctx, approval, now)
+		if status == "" || approval.Status == status {
+			result = append(result, approval)
+		}
+	}
+	return result
+}
+
+// pendingPaymentApproval — подтверждение организации orgID, по которому ещё можно принять решение
+func (svc *Service) pendingPaymentApproval(ctx context.Context, orgID, id string, now time.Time) (storage.PaymentApproval, error) {
+	approval, ok := svc.GetPaymentApproval(ctx, id)
+	if !ok || approval.OrganizationID != orgID {
+		return storage.PaymentApproval{}, approvalNotFound(id)
+	}
+	approval = svc.expirePaymentApproval(ctx, approval, now)
+	if approval.Status != storage.PaymentApprovalPending {
+		return storage.PaymentApproval{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("payment approval %s is %s", id, approval.Status)}
+	}
+	return approval, nil
+}
+
+// ApprovePayment — второй участник подтверждает перевод, и он исполняется с проверкой лимитов на момент
+// подтверждения. Автор перевода подтвердить его сам не может. Если перевод не прошёл, подтверждение снова ждёт решения.
+func (svc *Service) ApprovePayment(ctx context.Context, orgID, id, checker string, now time.Time) (storage.PaymentApproval, error) {
+	approval, err := svc.pendingPaymentApproval(ctx, orgID, id, now)
+	if err != nil {
+		return storage.PaymentApproval{}, err
+	}
+	if checker == "" {
+		return storage.PaymentApproval{}, &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeForbidden, Message: "payment approval requires a signed-in member"}
+	}
+	if checker == approval.MakerUserID {
+		return storage.PaymentApproval{}, &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeForbidden, Message: "payment must be approved by a member other than its author"}
+	}
+	from, ok := svc.GetAccount(ctx, approval.FromAccountID)
+	if !ok {
+		return storage.PaymentApproval{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("account %s not found", approval.FromAccountID)}
+	}
+	releaseLimit, err := svc.ReserveTransferLimit(ctx, from, approval.Amount, now)
+	if err != nil {
+		return storage.PaymentApproval{}, err
+	}
+	defer releaseLimit()
+	var to *storage.Account
+	if acc, ok := svc.GetAccount(ctx, approval.ToAccountID); ok {
+		to = &acc
+	}
+	if err := svc.CheckTierLimits(ctx, &from, to, approval.Amount, now); err != nil {
+		return storage.PaymentApproval{}, err
+	}
+
+	// Подтверждение переходит в executed до перевода, чтобы параллельное подтверждение не списало деньги дважды
+	if _, err := svc.UpdatePaymentApproval(ctx, id, func(a *storage.PaymentApproval) error {
+		if a.Status != storage.PaymentApprovalPending {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("payment approval %s is %s", id, a.Status)}
+		}
+		a.Status = storage.PaymentApprovalExecuted
+		a.CheckerUserID = checker
+		a.DecidedAt = &now
+		return nil
+	}); err != nil {
+		return storage.PaymentApproval{}, err
+	}
+	reopen := func() {
+		svc.UpdatePaymentApproval(ctx, id, func(a *storage.PaymentApproval) error {
+			a.Status = storage.PaymentApprovalPending
+			a.CheckerUserID = ""
+			a.DecidedAt = nil
+			return nil
+		})
+	}
+
+	release, err := svc.ReserveOperation(ctx, storage.OpTransfer, approval.Amount, approval.Currency, now)
+	if err != nil {
+		reopen()
+		return storage.PaymentApproval{}, err
+	}
+	tx, err := svc.TransferFunds(ctx, approval.FromAccountID, approval.ToAccountID, approval.Amount, now)
+	if err != nil {
+		release()
+		reopen()
+		return storage.PaymentApproval{}, err
+	}
+	approval, _ = svc.UpdatePaymentApproval(ctx, id, func(a *storage.PaymentApproval) error {
+		a.TransactionID = tx.ID
+		return nil
+	})
+	svc.PublishBalanceChanged(ctx, approval.FromAccountID)
+	svc.PublishBalanceChanged(ctx, approval.ToAccountID)
+	svc.auditPaymentApproval(ctx, checker, "payment.approved", approval, now)
+	log.Printf("Payment approval %s approved by %s, transaction %s", id, checker, tx.ID)
+	return approval, nil
+}
+
+// RejectPayment отклоняет перевод; автор может так отозвать свой перевод. Автору уходит письмо.
+func (svc *Service) RejectPayment(ctx context.Context, orgID, id, checker, reason string, now time.Time) (storage.PaymentApproval, error) {
+	if _, err := svc.pendingPaymentApproval(ctx, orgID, id, now); err != nil {
+		return storage.PaymentApproval{}, err
+	}
+	approval, err := svc.UpdatePaymentApproval(ctx, id, func(a *storage.PaymentApproval) error {
+		if a.Status != storage.PaymentApprovalPending {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("payment approval %s is %s", id, a.Status)}
+		}
+		a.Status = storage.PaymentApprovalRejected
+		a.CheckerUserID = checker
+		a.Reason = reason
+		a.DecidedAt = &now
+		return nil
+	})
+	if err != nil {
+		return storage.PaymentApproval{}, err
+	}
+	svc.auditPaymentApproval(ctx, checker, "payment.rejected", approval, now)
+	if reason == "" {
+		reason = "not specified"
+	}
+	if maker, ok := svc.GetUser(ctx, approval.MakerUserID); ok && approval.MakerUserID != checker {
+		svc.QueueEmail(ctx, maker.Email, "Simple Bank: your payment was rejected",
+			fmt.Sprintf("Hello %s,\n\nYour transfer of %s %s (payment %s) was rejected by a second member. Reason: %s",
+				maker.Username, approval.Amount.StringFixed(2), approval.Currency, approval.ID, reason))
+	}
+	log.Printf("Payment approval %s rejected by %s", id, checker)
+	return approval, nil
+}
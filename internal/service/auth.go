@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"bankapp/internal/storage"
+)
+
+func HashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(bytes), err
+}
+
+func CheckPasswordHash(password, hash string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil //
+}
+
+var VerificationPolicy = struct {
+	RequireForAccounts bool
+	RequireForLoans    bool
+	CodeTTL            time.Duration // сколько действует код подтверждения email
+	MaxAttempts        int           // неверных попыток до того, как код сгорает
+	ResendInterval     time.Duration // новый код — не чаще
+}{
+	RequireForAccounts: true,
+	RequireForLoans:    true,
+	CodeTTL:            durationFromEnv("BANKAPP_VERIFICATION_CODE_TTL", 24*time.Hour),
+	MaxAttempts:        5,
+	ResendInterval:     time.Minute,
+}
+
+// IssueVerificationCode выдаёт пользователю новый код подтверждения email со сроком VerificationPolicy.CodeTTL;
+// счётчик неверных попыток начинается заново. Возвращает код для письма.
+func IssueVerificationCode(user *storage.User, now time.Time) string {
+	user.VerificationCode = storage.GenerateVerificationCode()
+	user.VerificationSentAt = now
+	user.VerificationExpiresAt = now.Add(VerificationPolicy.CodeTTL)
+	user.VerificationAttempts = 0
+	return user.VerificationCode
+}
+
+// VerifyUserEmail проверяет код подтверждения с учётом срока и лимита попыток
+func (svc *Service) VerifyUserEmail(ctx context.Context, userID, code string, now time.Time) error {
+	return svc.Repository.VerifyUserEmail(ctx, userID, code, VerificationPolicy.MaxAttempts, now)
+}
+
+// ResendVerificationCode отправляет новый код взамен просроченного или сгоревшего; прежний перестаёт действовать
+func (svc *Service) ResendVerificationCode(ctx context.Context, userID string, now time.Time) error {
+	var code string
+	user, err := svc.UpdateUser(ctx, userID, func(u *storage.User) error {
+		if u.EmailVerified {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: "email is already verified"}
+		}
+		if now.Sub(u.VerificationSentAt) < VerificationPolicy.ResendInterval {
+			return &storage.StorageError{Kind: storage.ErrConflict, Code: storage.CodeRateLimited,
+				Message: fmt.Sprintf("a new code can be requested once per %s", VerificationPolicy.ResendInterval)}
+		}
+		code = IssueVerificationCode(u, now)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: email verification code",
+		fmt.Sprintf("Hello %s,\n\nYour email verification code: %s. It expires in %d hours.",
+			user.Username, code, int(VerificationPolicy.CodeTTL.Hours())))
+	return nil
+}
+
+func EnvOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// secretFromEnv читает ключ подписи из переменной окружения. Значения по умолчанию нет: без переменной ключ
+// генерируется случайно при старте, и подписанные им токены перестают действовать после перезапуска.
+func secretFromEnv(key string) []byte {
+	if value := os.Getenv(key); value != "" {
+		return []byte(value)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate %s: %v", key, err))
+	}
+	log.Printf("%s is not set, using a random key until restart", key)
+	return secret
+}
+
+// Подпись партнёра: hex(HMAC-SHA256(secret, timestamp + "\n" + method + "\n" + uri + "\n" + body)),
+// uri — путь вместе со строкой запроса, чтобы подпись нельзя было перенести на другие параметры
+func SignPartnerRequest(secret, timestamp, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + uri + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var resetTokenSecret = secretFromEnv("BANKAPP_RESET_TOKEN_SECRET")
+
+const ResetTokenTTL = 30 * time.Minute
+
+// Токен: base64(userID|expiresUnix|hashPrefix).hexHMAC — привязка к текущему хешу пароля
+// делает токен одноразовым: после смены пароля он перестаёт проходить проверку.
+func GenerateResetToken(user storage.User, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s|%d|%s", user.ID, expiresAt.Unix(), passwordFingerprint(user.PasswordHash))
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + signResetPayload(encoded)
+}
+
+func (svc *Service) ParseResetToken(ctx context.Context, token string) (string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signResetPayload(parts[0]))) {
+		return "", errors.New("invalid reset token")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("invalid reset token")
+	}
+	fields := strings.Split(string(raw), "|")
+	if len(fields) != 3 {
+		return "", errors.New("invalid reset token")
+	}
+	expiresUnix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", errors.New("invalid reset token")
+	}
+	if time.Now().After(time.Unix(expiresUnix, 0)) {
+		return "", errors.New("reset token expired")
+	}
+
+	user, ok := svc.GetUser(ctx, fields[0])
+	if !ok || passwordFingerprint(user.PasswordHash) != fields[2] {
+		return "", errors.New("invalid reset token")
+	}
+	return user.ID, nil
+}
+
+func signResetPayload(payload string) string {
+	mac := hmac.New(sha256.New, resetTokenSecret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func passwordFingerprint(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var AutoTransferConfig = struct {
+	MaxRulesPerUser int
+}{
+	MaxRulesPerUser: 10,
+}
+
+// autoTransferType — тип проводок правил; такие проводки не запускают правила повторно, иначе
+// два встречных правила перекидывали бы деньги по кругу
+const autoTransferType = "auto_transfer"
+
+func autoTransferRuleNotFound(id string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("auto-transfer rule %s not found", id)}
+}
+
+func applyAutoTransferRequest(rule *storage.AutoTransferRule, req storage.AutoTransferRuleRequest) error {
+	switch req.Kind {
+	case storage.AutoTransferSweep, storage.AutoTransferTopUp:
+	default:
+		return invalidInputf("kind must be %s or %s", storage.AutoTransferSweep, storage.AutoTransferTopUp)
+	}
+	if req.SourceAccountID == "" || req.TargetAccountID == "" {
+		return invalidInputf("source_account_id and target_account_id are required")
+	}
+	if req.SourceAccountID == req.TargetAccountID {
+		return invalidInputf("source and target accounts must differ")
+	}
+	if req.Threshold.IsNegative() || req.TopUpTo.IsNegative() {
+		return invalidInputf("threshold and top_up_to must not be negative")
+	}
+	if req.Kind == storage.AutoTransferTopUp && !req.TopUpTo.IsZero() && req.TopUpTo.LessThan(req.Threshold) {
+		return invalidInputf("top_up_to must not be below threshold")
+	}
+	if req.Kind == storage.AutoTransferSweep && !req.TopUpTo.IsZero() {
+		return invalidInputf("top_up_to applies to top_up rules only")
+	}
+	rule.Kind = req.Kind
+	rule.SourceAccountID = req.SourceAccountID
+	rule.TargetAccountID = req.TargetAccountID
+	rule.Threshold = req.Threshold
+	rule.TopUpTo = req.TopUpTo
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// CreateAutoTransferRule заводит правило автоперевода и сразу проверяет его по текущим остаткам
+func (svc *Service) CreateAutoTransferRule(ctx context.Context, userID string, req storage.AutoTransferRuleRequest, now time.Time) (storage.AutoTransferRule, error) {
+	if len(svc.ListAutoTransferRules(ctx, userID)) >= AutoTransferConfig.MaxRulesPerUser {
+		return storage.AutoTransferRule{}, &storage.StorageError{Kind: storage.ErrQuotaExceeded, Message: fmt.Sprintf("at most %d auto-transfer rules per user", AutoTransferConfig.MaxRulesPerUser)}
+	}
+	rule := storage.AutoTransferRule{ID: storage.GenerateID(), UserID: userID, Enabled: true, CreatedAt: now, UpdatedAt: now}
+	if err := applyAutoTransferRequest(&rule, req); err != nil {
+		return storage.AutoTransferRule{}, err
+	}
+	if err := svc.SaveAutoTransferRule(ctx, rule); err != nil {
+		return storage.AutoTransferRule{}, err
+	}
+	log.Printf("Auto-transfer rule %s (%s) created for user %s", rule.ID, rule.Kind, userID)
+	return svc.evaluateAutoTransferRule(ctx, rule, now), nil
+}
+
+// UpdateAutoTransferRule заменяет условия правила; история срабатываний сохраняется
+func (svc *Service) UpdateAutoTransferRule(ctx context.Context, userID, ruleID string, req storage.AutoTransferRuleRequest, now time.Time) (storage.AutoTransferRule, error) {
+	rule, ok := svc.GetAutoTransferRule(ctx, ruleID)
+	if !ok || rule.UserID != userID {
+		return storage.AutoTransferRule{}, autoTransferRuleNotFound(ruleID)
+	}
+	if err := applyAutoTransferRequest(&rule, req); err != nil {
+		return storage.AutoTransferRule{}, err
+	}
+	rule.UpdatedAt = now
+	if err := svc.SaveAutoTransferRule(ctx, rule); err != nil {
+		return storage.AutoTransferRule{}, err
+	}
+	return svc.evaluateAutoTransferRule(ctx, rule, now), nil
+}
+
+// evaluateAutoTransferRule проводит перевод по правилу, если условие выполнено, и возвращает правило
+// с обновлёнными полями последнего срабатывания
+func (svc *Service) evaluateAutoTransferRule(ctx context.Context, rule storage.AutoTransferRule, now time.Time) storage.AutoTransferRule {
+	tx, moved, err := svc.RunAutoTransferRule(ctx, rule.ID, storage.Transaction{ID: storage.GenerateID(), Timestamp: now, TransactionType: autoTransferType}, now)
+	if err != nil {
+		log.Printf("Auto-transfer rule %s: %v", rule.ID, err)
+	}
+	if moved {
+		svc.PublishBalanceChanged(ctx, tx.FromAccountID)
+		svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+		log.Printf("Auto-transfer rule %s moved %s from %s to %s", rule.ID, tx.Amount.String(), tx.FromAccountID, tx.ToAccountID)
+	}
+	if updated, ok := svc.GetAutoTransferRule(ctx, rule.ID); ok {
+		return updated
+	}
+	return rule
+}
+
+// StartAutoTransferEngine проверяет правила счёта после каждой транзакции по нему. События обрабатываются
+// по одному, поэтому правила одного счёта не срабатывают параллельно.
+func (svc *Service) StartAutoTransferEngine(ctx context.Context) {
+	events := svc.events.SubscribeAll(1024)
+	go func() {
+		for event := range events {
+			if event.Type != storage.EventTransactionCreated {
+				continue
+			}
+			if tx, ok := event.Payload.(storage.Transaction); ok && tx.TransactionType == autoTransferType {
+				continue
+			}
+			for _, rule := range svc.ListAutoTransferRules(ctx, event.UserID) {
+				if rule.Enabled && rule.WatchedAccountID() == event.AccountID {
+					svc.evaluateAutoTransferRule(ctx, rule, time.Now())
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var BackdateConfig = struct {
+	MaxAge         time.Duration // насколько далеко в прошлое можно перенести операцию
+	MaxExternalLag time.Duration // насколько дата валютирования входящего внешнего перевода может отставать от проводки
+}{
+	MaxAge:         10 * 365 * 24 * time.Hour,
+	MaxExternalLag: 5 * 24 * time.Hour,
+}
+
+// ValidateExternalValueDate проверяет дату валютирования входящего перевода: не в будущем и не старше MaxExternalLag
+func ValidateExternalValueDate(valueDate, now time.Time) error {
+	if valueDate.After(now) {
+		return invalidInputf("value_date cannot be in the future")
+	}
+	if now.Sub(valueDate) > BackdateConfig.MaxExternalLag {
+		return invalidInputf("value_date is more than %d days in the past; use back-dated migration entries for older history",
+			int(BackdateConfig.MaxExternalLag.Hours()/24))
+	}
+	return nil
+}
+
+// Стороны, обязательные для каждого типа переносимой операции: true — счёт обязателен, false — должен отсутствовать
+var backdatedTypeSides = map[string]struct{ from, to bool }{
+	"deposit":    {from: false, to: true},
+	"withdrawal": {from: true, to: false},
+	"transfer":   {from: true, to: true},
+	"payment":    {from: true, to: false},
+}
+
+func validateBackdatedTransaction(req storage.BackdatedTransactionRequest, now time.Time) error {
+	sides, ok := backdatedTypeSides[req.Type]
+	if !ok {
+		return invalidInputf("unsupported type %q, expected deposit, withdrawal, transfer or payment", req.Type)
+	}
+	if sides.from != (req.FromAccountID != "") || sides.to != (req.ToAccountID != "") {
+		return invalidInputf("%s requires from_account_id=%t and to_account_id=%t", req.Type, sides.from, sides.to)
+	}
+	if req.FromAccountID != "" && req.FromAccountID == req.ToAccountID {
+		return invalidInputf("source and destination accounts must differ")
+	}
+	if !req.Amount.IsPositive() {
+		return invalidInputf("amount must be positive")
+	}
+	if req.ValueDate.IsZero() {
+		return invalidInputf("value_date is required")
+	}
+	if !req.ValueDate.Before(StartOfDay(now)) {
+		return invalidInputf("value_date must be before today; use regular operations for current entries")
+	}
+	if now.Sub(req.ValueDate) > BackdateConfig.MaxAge {
+		return invalidInputf("value_date is more than %d days in the past", int(BackdateConfig.MaxAge.Hours()/24))
+	}
+	if strings.TrimSpace(req.ExternalRef) == "" {
+		return invalidInputf("external_ref is required to make migration reruns idempotent")
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return invalidInputf("reason is required")
+	}
+	if req.Type == "payment" && strings.TrimSpace(req.Merchant) == "" {
+		return invalidInputf("payment requires merchant")
+	}
+	return nil
+}
+
+// PostBackdatedTransaction проводит историческую операцию с датой валютирования в прошлом.
+// Остаток меняется сейчас, а в выписках и аналитике операция встаёт на дату валютирования.
+func (svc *Service) PostBackdatedTransaction(ctx context.Context, req storage.BackdatedTransactionRequest, now time.Time) (storage.Transaction, error) {
+	if err := validateBackdatedTransaction(req, now); err != nil {
+		return storage.Transaction{}, err
+	}
+	accountID := req.FromAccountID
+	if accountID == "" {
+		accountID = req.ToAccountID
+	}
+	if acc, ok := svc.GetAccount(ctx, accountID); ok {
+		if err := storage.ValidateAmount(req.Amount, acc.Currency); err != nil {
+			return storage.Transaction{}, err
+		}
+	}
+
+	valueDate := req.ValueDate
+	tx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   req.FromAccountID,
+		ToAccountID:     req.ToAccountID,
+		Amount:          req.Amount,
+		Timestamp:       now,
+		TransactionType: req.Type,
+		Description:     req.Description,
+		Merchant:        req.Merchant,
+		Category:        req.Category,
+		ValueDate:       valueDate,
+		ExternalRef:     req.ExternalRef,
+	}
+	if tx.Description == "" && req.Type == "deposit" {
+		if acc, ok := svc.GetAccount(ctx, req.ToAccountID); ok {
+			tx.Describe(storage.DescDeposit, map[string]string{"account": acc.Number})
+		}
+	}
+	if tx.Description == "" && req.Type == "payment" {
+		tx.Describe(storage.DescCardPayment, map[string]string{"merchant": req.Merchant})
+	}
+
+	if err := svc.Repository.PostBackdatedTransaction(ctx, tx); err != nil {
+		return storage.Transaction{}, err
+	}
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "transaction.backdate",
+		Details: map[string]string{
+			"transaction_id":  tx.ID,
+			"type":            tx.TransactionType,
+			"from_account_id": tx.FromAccountID,
+			"to_account_id":   tx.ToAccountID,
+			"amount":          tx.Amount.String(),
+			"value_date":      valueDate.Format(time.RFC3339),
+			"external_ref":    tx.ExternalRef,
+			"reason":          req.Reason,
+		},
+	})
+	for _, accountID := range []string{tx.FromAccountID, tx.ToAccountID} {
+		if accountID != "" {
+			svc.PublishBalanceChanged(ctx, accountID)
+		}
+	}
+	log.Printf("Back-dated %s %s posted (value date %s, ref %s)", tx.TransactionType, tx.ID, valueDate.Format("2006-01-02"), tx.ExternalRef)
+	return tx, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// OperationTypes — типы операций, которые админ может выключить или ограничить по объёму за день
+var OperationTypes = []string{
+	storage.OpTransfer,
+	storage.OpP2PTransfer,
+	storage.OpBatchPayment,
+	storage.OpCardPayment,
+	storage.OpDeposit,
+	storage.OpExchange,
+	storage.OpInvoicePayment,
+	storage.OpEscrow,
+	storage.OpLoan,
+}
+
+func isOperationType(opType string) bool {
+	for _, t := range OperationTypes {
+		if t == opType {
+			return true
+		}
+	}
+	return false
+}
+
+// ReserveOperation проверяет выключатель банка для типа операции и засчитывает сумму в его дневной лимит.
+// Возвращённая release снимает резерв — её нужно вызвать, если сама операция затем не прошла.
+func (svc *Service) ReserveOperation(ctx context.Context, opType string, amount decimal.Decimal, currency string, now time.Time) (func(), error) {
+	noop := func() {}
+	c, ok := svc.GetOperationControl(ctx, opType)
+	if !ok || (!c.Disabled && !c.DailyCap.IsPositive()) {
+		return noop, nil
+	}
+	base := amount
+	if !c.Disabled {
+		var err error
+		if base, err = svc.toBaseCurrency(ctx, amount, currency); err != nil {
+			return noop, err
+		}
+	}
+	day := StartOfDay(now)
+	if err := svc.ReserveOperationVolume(ctx, opType, day, base); err != nil {
+		log.Printf("Operation %s of %s %s rejected by bank controls: %v", opType, amount.String(), currency, err)
+		return noop, err
+	}
+	return func() { svc.ReleaseOperationVolume(context.WithoutCancel(ctx), opType, day, base) }, nil
+}
+
+// SetOperationControl включает или выключает тип операции и меняет его дневной лимит
+func (svc *Service) SetOperationControl(ctx context.Context, opType string, req storage.OperationControlRequest, now time.Time) (storage.OperationControlView, error) {
+	if !isOperationType(opType) {
+		return storage.OperationControlView{}, &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("unknown operation type %s", opType)}
+	}
+	c, ok := svc.GetOperationControl(ctx, opType)
+	if !ok {
+		c = storage.OperationControl{Type: opType, DailyCap: decimal.Zero}
+	}
+	if req.DailyCap != nil {
+		if req.DailyCap.IsNegative() {
+			return storage.OperationControlView{}, invalidInputf("daily_cap must not be negative")
+		}
+		c.DailyCap = *req.DailyCap
+	}
+	if req.Disabled != nil {
+		c.Disabled = *req.Disabled
+	}
+	if req.Reason != nil {
+		c.Reason = strings.TrimSpace(*req.Reason)
+	}
+	if !c.Disabled {
+		c.Reason = ""
+	}
+	c.UpdatedAt = now
+	if err := svc.Repository.SetOperationControl(ctx, c); err != nil {
+		return storage.OperationControlView{}, err
+	}
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "operation.control",
+		Details:   map[string]string{"type": opType, "disabled": fmt.Sprint(c.Disabled), "daily_cap": c.DailyCap.String(), "reason": c.Reason},
+	})
+	if c.Disabled {
+		log.Printf("Operation %s disabled bank-wide: %s", opType, c.Reason)
+	}
+	return svc.operationControlView(ctx, c, now), nil
+}
+
+func (svc *Service) operationControlView(ctx context.Context, c storage.OperationControl, now time.Time) storage.OperationControlView {
+	return storage.OperationControlView{
+		OperationControl: c,
+		Currency:         storage.BaseCurrency,
+		UsedToday:        svc.OperationVolume(ctx, c.Type, StartOfDay(now)),
+	}
+}
+
+// OperationControls — состояние всех типов операций: выключатели, лимиты и объём за сегодня
+func (svc *Service) OperationControls(ctx context.Context, now time.Time) []storage.OperationControlView {
+	views := make([]storage.OperationControlView, 0, len(OperationTypes))
+	for _, opType := range OperationTypes {
+		c, ok := svc.GetOperationControl(ctx, opType)
+		if !ok {
+			c = storage.OperationControl{Type: opType, DailyCap: decimal.Zero}
+		}
+		views = append(views, svc.operationControlView(ctx, c, now))
+	}
+	return views
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var BroadcastConfig = struct {
+	RatePerSecond int           // сколько писем рассылок уходит в секунду, чтобы не упереться в лимиты SMTP
+	MaxAttempts   int           // после стольких неудачных попыток получатель помечается failed
+	RetryAfter    time.Duration // пауза перед повторной отправкой
+}{
+	RatePerSecond: broadcastRateFromEnv("BANKAPP_BROADCAST_RATE", 5),
+	MaxAttempts:   3,
+	RetryAfter:    time.Minute,
+}
+
+func broadcastRateFromEnv(key string, fallback int) int {
+	rate, err := strconv.Atoi(EnvOrDefault(key, strconv.Itoa(fallback)))
+	if err != nil || rate <= 0 {
+		log.Printf("Invalid %s, using %d", key, fallback)
+		return fallback
+	}
+	return rate
+}
+
+const (
+	BroadcastMaintenance  = "maintenance"
+	BroadcastTariffChange = "tariff_change"
+	BroadcastCustom       = "custom" // тема и текст задаются в запросе, без перевода
+)
+
+type broadcastTemplate struct {
+	Subject string
+	Body    string
+}
+
+// Обязательные параметры шаблонов; details необязателен везде
+var broadcastRequiredParams = map[string][]string{
+	BroadcastMaintenance:  {"start", "end"},
+	BroadcastTariffChange: {"product", "effective_from"},
+	BroadcastCustom:       {},
+}
+
+var broadcastTemplates = map[string]map[string]broadcastTemplate{
+	"en": {
+		BroadcastMaintenance: {
+			Subject: "Simple Bank: scheduled maintenance",
+			Body:    "Dear {{.username}},\n\nSimple Bank services will be unavailable from {{.start}} to {{.end}} due to scheduled maintenance.{{if .details}}\n\n{{.details}}{{end}}\n\nWe apologise for the inconvenience.",
+		},
+		BroadcastTariffChange: {
+			Subject: "Simple Bank: tariff change",
+			Body:    "Dear {{.username}},\n\nThe terms of the {{.product}} product change on {{.effective_from}}.{{if .details}}\n\n{{.details}}{{end}}",
+		},
+	},
+	"ru": {
+		BroadcastMaintenance: {
+			Subject: "Simple Bank: плановые работы",
+			Body:    "Здравствуйте, {{.username}}!\n\nС {{.start}} до {{.end}} сервисы Simple Bank будут недоступны из-за плановых работ.{{if .details}}\n\n{{.details}}{{end}}\n\nПриносим извинения за неудобства.",
+		},
+		BroadcastTariffChange: {
+			Subject: "Simple Bank: изменение тарифов",
+			Body:    "Здравствуйте, {{.username}}!\n\nС {{.effective_from}} меняются условия продукта «{{.product}}».{{if .details}}\n\n{{.details}}{{end}}",
+		},
+	},
+}
+
+// renderBroadcast собирает письмо для получателя на его языке (или на языке по умолчанию)
+func renderBroadcast(b storage.Broadcast, r storage.BroadcastRecipient, username string) (string, string, error) {
+	params := map[string]string{"username": username}
+	for k, v := range b.Params {
+		params[k] = v
+	}
+
+	src := broadcastTemplate{Subject: b.Subject, Body: b.Body}
+	if b.Template != BroadcastCustom {
+		var ok bool
+		if src, ok = broadcastTemplates[r.Language][b.Template]; !ok {
+			src = broadcastTemplates[storage.DefaultLanguage][b.Template]
+		}
+	}
+
+	var rendered [2]string
+	for i, text := range []string{src.Subject, src.Body} {
+		tmpl, err := template.New(b.Template).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", "", err
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, params); err != nil {
+			return "", "", err
+		}
+		rendered[i] = sb.String()
+	}
+	return rendered[0], rendered[1], nil
+}
+
+func validateBroadcast(req storage.CreateBroadcastRequest) error {
+	invalid := func(format string, args ...interface{}) error {
+		return &storage.StorageError{Kind: storage.ErrInvalidInput, Message: fmt.Sprintf(format, args...)}
+	}
+	required, ok := broadcastRequiredParams[req.Template]
+	if !ok {
+		return invalid("unknown broadcast template %q", req.Template)
+	}
+	for _, key := range required {
+		if strings.TrimSpace(req.Params[key]) == "" {
+			return invalid("template %s requires parameter %q", req.Template, key)
+		}
+	}
+	if req.Template == BroadcastCustom {
+		if strings.TrimSpace(req.Subject) == "" || strings.TrimSpace(req.Body) == "" {
+			return invalid("custom broadcast requires subject and body")
+		}
+		for _, text := range []string{req.Subject, req.Body} {
+			if _, err := template.New("custom").Parse(text); err != nil {
+				return invalid("invalid custom template: %v", err)
+			}
+		}
+	}
+	for _, code := range req.Audience.Products {
+		if _, ok := storage.GetProduct(code); !ok {
+			return invalid("unknown product %q in audience", code)
+		}
+	}
+	if req.Audience.Language != "" && !storage.IsSupportedLanguage(req.Audience.Language) {
+		return invalid("unsupported audience language %q", req.Audience.Language)
+	}
+	return nil
+}
+
+// matchesAudience проверяет пользователя по фильтру рассылки
+func (svc *Service) matchesAudience(ctx context.Context, user storage.User, audience storage.BroadcastAudience) bool {
+	if audience.Language != "" && userLanguage(user) != audience.Language {
+		return false
+	}
+	if len(audience.Products) == 0 {
+		return true
+	}
+	for _, acc := range svc.GetUserAccounts(ctx, user.ID) {
+		if acc.IsClosed() {
+			continue
+		}
+		for _, code := range audience.Products {
+			if acc.ProductCode == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func userLanguage(user storage.User) string {
+	if user.Language != "" {
+		return user.Language
+	}
+	return storage.DefaultLanguage
+}
+
+// CreateBroadcast отбирает аудиторию и ставит письма в очередь; отправкой занимается StartBroadcastDispatcher
+func (svc *Service) CreateBroadcast(ctx context.Context, req storage.CreateBroadcastRequest, now time.Time) (storage.Broadcast, error) {
+	if err := validateBroadcast(req); err != nil {
+		return storage.Broadcast{}, err
+	}
+
+	b := storage.Broadcast{
+		ID:        storage.GenerateID(),
+		Template:  req.Template,
+		Params:    req.Params,
+		Audience:  req.Audience,
+		CreatedBy: "admin",
+		CreatedAt: now,
+	}
+	if req.Template == BroadcastCustom {
+		b.Subject, b.Body = req.Subject, req.Body
+	}
+
+	recipients := make([]storage.BroadcastRecipient, 0)
+	for _, user := range svc.ListUsers(ctx) {
+		if !svc.matchesAudience(ctx, user, req.Audience) {
+			continue
+		}
+		r := storage.BroadcastRecipient{UserID: user.ID, Email: user.Email, Language: userLanguage(user), Status: storage.RecipientPending}
+		if !user.EmailVerified {
+			r.Status = storage.RecipientSkipped
+		}
+		recipients = append(recipients, r)
+	}
+	if err := svc.AddBroadcast(ctx, b, recipients); err != nil {
+		return storage.Broadcast{}, err
+	}
+	b, _ = svc.GetBroadcast(ctx, b.ID)
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     b.CreatedBy,
+		Action:    "broadcast.create",
+		Details: map[string]string{
+			"broadcast_id": b.ID,
+			"template":     b.Template,
+			"products":     strings.Join(b.Audience.Products, ","),
+			"language":     b.Audience.Language,
+			"recipients":   strconv.Itoa(b.Total),
+			"skipped":      strconv.Itoa(b.Skipped),
+		},
+	})
+	log.Printf("Broadcast %s (%s) queued for %d recipients", b.ID, b.Template, b.Total)
+	return b, nil
+}
+
+// deliverBroadcasts отправляет очередную порцию писем; за один тик — не больше limit
+func (svc *Service) deliverBroadcasts(ctx context.Context, limit int, now time.Time) {
+	for _, r := range svc.NextBroadcastRecipients(ctx, limit, now) {
+		b, ok := svc.GetBroadcast(ctx, r.BroadcastID)
+		if !ok {
+			continue
+		}
+		username := ""
+		if user, ok := svc.GetUser(ctx, r.UserID); ok {
+			username = user.Username
+		}
+
+		subject, body, err := renderBroadcast(b, r, username)
+		if err == nil {
+			err = SendEmailNotification(ctx, r.Email, subject, body)
+		}
+		if err != nil {
+			log.Printf("Broadcast %s delivery to %s failed (attempt %d): %v", b.ID, r.Email, r.Attempts+1, err)
+		}
+		updated, recErr := svc.RecordBroadcastDelivery(ctx, b.ID, r.UserID, err, BroadcastConfig.MaxAttempts, BroadcastConfig.RetryAfter, time.Now())
+		if recErr != nil {
+			log.Printf("Failed to record broadcast %s delivery to %s: %v", b.ID, r.UserID, recErr)
+			continue
+		}
+		if updated.Status == storage.BroadcastCompleted && b.Status != storage.BroadcastCompleted {
+			log.Printf("Broadcast %s completed: %d sent, %d failed, %d skipped", b.ID, updated.Sent, updated.Failed, updated.Skipped)
+		}
+	}
+}
+
+// StartBroadcastDispatcher раз в секунду отправляет не больше BroadcastConfig.RatePerSecond писем из очереди
+func (svc *Service) StartBroadcastDispatcher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				svc.deliverBroadcasts(ctx, BroadcastConfig.RatePerSecond, now)
+			}
+		}
+	}()
+}
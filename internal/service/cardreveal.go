@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var CardRevealConfig = struct {
+	CodeTTL     time.Duration // сколько действует код подтверждения из письма
+	TokenTTL    time.Duration // сколько действует одноразовый токен после подтверждения
+	MaxAttempts int
+}{
+	CodeTTL:     durationFromEnv("BANKAPP_CARD_REVEAL_TTL", 5*time.Minute),
+	TokenTTL:    time.Minute,
+	MaxAttempts: 3,
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// StartCardReveal создаёт запрос на показ реквизитов и отправляет владельцу код подтверждения
+func (svc *Service) StartCardReveal(ctx context.Context, card storage.Card, user storage.User, sessionID string, now time.Time) (storage.CardReveal, error) {
+	code := storage.GenerateVerificationCode()
+	reveal := storage.CardReveal{
+		ID:        storage.GenerateID(),
+		CardID:    card.ID,
+		UserID:    user.ID,
+		SessionID: sessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(CardRevealConfig.CodeTTL),
+		Status:    storage.CardRevealPendingStepUp,
+		CodeHash:  sha256Hex(code),
+	}
+	if err := svc.AddCardReveal(ctx, reveal); err != nil {
+		return storage.CardReveal{}, err
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nYour code to view the details of card %s is %s. It expires in %d minutes.\n"+
+		"If you did not request this, change your password and revoke your sessions.",
+		user.Username, storage.MaskPAN(card.Number), code, int(CardRevealConfig.CodeTTL.Minutes()))
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: card details confirmation code", body)
+	return reveal, nil
+}
+
+// ConfirmCardReveal проверяет код step-up из той же сессии и выдаёт одноразовый токен.
+// После MaxAttempts неверных кодов запрос сгорает.
+func (svc *Service) ConfirmCardReveal(ctx context.Context, revealID, sessionID, code string, now time.Time) (storage.CardReveal, string, error) {
+	token := storage.GenerateToken()
+	reveal, err := svc.UpdateCardReveal(ctx, revealID, func(r *storage.CardReveal) error {
+		if r.SessionID != sessionID {
+			return &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("card reveal %s not found", revealID)}
+		}
+		if !now.Before(r.ExpiresAt) {
+			r.Status = storage.CardRevealFailed
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: "confirmation code has expired"}
+		}
+		if !hmac.Equal([]byte(sha256Hex(code)), []byte(r.CodeHash)) {
+			r.Attempts++
+			if r.Attempts >= CardRevealConfig.MaxAttempts {
+				r.Status = storage.CardRevealFailed
+			}
+			return &storage.StorageError{Kind: storage.ErrInvalidInput, Code: storage.CodeUnauthorized, Message: "invalid confirmation code"}
+		}
+		r.Status = storage.CardRevealReady
+		r.ExpiresAt = now.Add(CardRevealConfig.TokenTTL)
+		r.TokenHash = sha256Hex(token)
+		return nil
+	})
+	if err != nil {
+		return reveal, "", err
+	}
+	return reveal, token, nil
+}
+
+// RedeemCardReveal возвращает реквизиты карты ровно один раз за токен
+func (svc *Service) RedeemCardReveal(ctx context.Context, token string, now time.Time) (storage.CardReveal, storage.CardDetails, error) {
+	reveal, card, err := svc.Repository.RedeemCardReveal(ctx, sha256Hex(token), now)
+	if err != nil {
+		return storage.CardReveal{}, storage.CardDetails{}, err
+	}
+	return reveal, storage.CardDetails{
+		CardID:      card.ID,
+		Number:      card.Number,
+		ExpiryMonth: card.ExpiryMonth,
+		ExpiryYear:  card.ExpiryYear,
+		CVV:         card.CVV,
+		HolderName:  card.HolderName,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var CardTokenConfig = struct {
+	MaxPerCard int // неудалённых токенов на одну карту
+}{
+	MaxPerCard: 10,
+}
+
+func cardTokenForbidden(format string, args ...interface{}) error {
+	return &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+func (svc *Service) auditCardToken(ctx context.Context, actor, action string, token storage.CardToken, now time.Time) {
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    action,
+		Details:   map[string]string{"card_id": token.CardID, "token_id": token.ID, "device_id": token.DeviceID},
+	})
+}
+
+// IssueCardToken выпускает токен карты для устройства и возвращает его значение; повторно оно не показывается
+func (svc *Service) IssueCardToken(ctx context.Context, card storage.Card, userID string, req storage.CardTokenRequest, now time.Time) (storage.CardToken, string, error) {
+	deviceID := strings.TrimSpace(req.DeviceID)
+	if deviceID == "" {
+		return storage.CardToken{}, "", invalidInputf("device_id is required")
+	}
+	if !card.IsActive(now) {
+		return storage.CardToken{}, "", &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("card %s is expired or blocked", card.ID)}
+	}
+	issued := 0
+	for _, token := range svc.ListCardTokens(ctx, card.ID) {
+		if token.Status != storage.CardTokenDeleted {
+			issued++
+		}
+	}
+	if issued >= CardTokenConfig.MaxPerCard {
+		return storage.CardToken{}, "", &storage.StorageError{Kind: storage.ErrQuotaExceeded, Message: fmt.Sprintf("at most %d tokens per card", CardTokenConfig.MaxPerCard)}
+	}
+
+	value := storage.GenerateToken()
+	token := storage.CardToken{
+		ID:         storage.GenerateID(),
+		CardID:     card.ID,
+		UserID:     userID,
+		DeviceID:   deviceID,
+		DeviceName: strings.TrimSpace(req.DeviceName),
+		Last4:      value[len(value)-4:],
+		Status:     storage.CardTokenActive,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		TokenHash:  sha256Hex(value),
+	}
+	if err := svc.AddCardToken(ctx, token); err != nil {
+		return storage.CardToken{}, "", err
+	}
+	svc.auditCardToken(ctx, userID, "card_token.issue", token, now)
+	return token, value, nil
+}
+
+// SuspendCardToken временно запрещает оплату токеном, например при потере устройства
+func (svc *Service) SuspendCardToken(ctx context.Context, cardID, tokenID, actor string, now time.Time) (storage.CardToken, error) {
+	return svc.setCardTokenStatus(ctx, cardID, tokenID, actor, []string{storage.CardTokenActive}, storage.CardTokenSuspended, "card_token.suspend", now)
+}
+
+func (svc *Service) ResumeCardToken(ctx context.Context, cardID, tokenID, actor string, now time.Time) (storage.CardToken, error) {
+	return svc.setCardTokenStatus(ctx, cardID, tokenID, actor, []string{storage.CardTokenSuspended}, storage.CardTokenActive, "card_token.resume", now)
+}
+
+// DeleteCardToken отзывает токен навсегда; для устройства после этого можно выпустить новый
+func (svc *Service) DeleteCardToken(ctx context.Context, cardID, tokenID, actor string, now time.Time) (storage.CardToken, error) {
+	return svc.setCardTokenStatus(ctx, cardID, tokenID, actor, []string{storage.CardTokenActive, storage.CardTokenSuspended}, storage.CardTokenDeleted, "card_token.delete", now)
+}
+
+func (svc *Service) setCardTokenStatus(ctx context.Context, cardID, tokenID, actor string, from []string, status, action string, now time.Time) (storage.CardToken, error) {
+	token, err := svc.SetCardTokenStatus(ctx, cardID, tokenID, from, status, now)
+	if err != nil {
+		return storage.CardToken{}, err
+	}
+	if actor == "" {
+		actor = token.UserID
+	}
+	svc.auditCardToken(ctx, actor, action, token, now)
+	return token, nil
+}
+
+// ResolveCardToken находит карту по токену оплаты. Токен должен быть активен и предъявлен с того же устройства,
+// для которого выпущен; неизвестный или удалённый токен неотличим от несуществующей карты.
+func (svc *Service) ResolveCardToken(ctx context.Context, value, deviceID string, now time.Time) (storage.Card, storage.CardToken, error) {
+	notFound := &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeCardNotFound, Message: "card not found"}
+	token, ok := svc.GetCardTokenByHash(ctx, sha256Hex(value))
+	if !ok || token.Status == storage.CardTokenDeleted {
+		return storage.Card{}, storage.CardToken{}, notFound
+	}
+	if token.Status != storage.CardTokenActive {
+		return storage.Card{}, storage.CardToken{}, cardTokenForbidden("card token %s is %s", token.ID, token.Status)
+	}
+	if deviceID != token.DeviceID {
+		return storage.Card{}, storage.CardToken{}, cardTokenForbidden("card token %s is bound to another device", token.ID)
+	}
+	card, ok := svc.GetCard(ctx, token.CardID)
+	if !ok {
+		return storage.Card{}, storage.CardToken{}, notFound
+	}
+	svc.TouchCardToken(ctx, token.ID, now)
+	return card, token, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var CashflowConfig = struct {
+	DefaultMonths int
+	MaxMonths     int
+	CacheEntries  int // столько отчётов хранится в кеше; при переполнении кеш очищается целиком
+}{
+	DefaultMonths: 6,
+	MaxMonths:     24,
+	CacheEntries:  1000,
+}
+
+// cashflowCollections — коллекции, от которых зависит отчёт; пока их поколения не менялись, отчёт из кеша верен
+var cashflowCollections = []string{storage.CollectionAccounts, storage.CollectionTransactions}
+
+var cachedCashflow = struct {
+	mu      sync.Mutex
+	reports map[string]storage.Cashflow
+}{reports: make(map[string]storage.Cashflow)}
+
+// externalFlow относит операцию по счёту accountID к доходу или расходу клиента. Переводы между его
+// собственными счетами (own) не считаются ни тем, ни другим.
+func externalFlow(tx storage.Transaction, accountID string, own map[string]bool) (income, expense bool) {
+	if tx.ToAccountID == accountID {
+		return !own[tx.FromAccountID], false
+	}
+	return false, !own[tx.ToAccountID]
+}
+
+// ParseCashflowMonths проверяет число месяцев отчёта; пусто — CashflowConfig.DefaultMonths
+func ParseCashflowMonths(param string) (int, error) {
+	if param == "" {
+		return CashflowConfig.DefaultMonths, nil
+	}
+	var months int
+	if _, err := fmt.Sscanf(param, "%d", &months); err != nil || months < 1 || months > CashflowConfig.MaxMonths {
+		return 0, fmt.Errorf("months must be between 1 and %d", CashflowConfig.MaxMonths)
+	}
+	return months, nil
+}
+
+// UserCashflow — доходы и расходы клиента за последние months месяцев, включая текущий, по журналу операций.
+// Доход — поступления извне (пополнения, входящие переводы), расход — списания наружу (оплаты, исходящие переводы,
+// снятия, платежи по кредитам). Отчёт кешируется, пока не менялись счета и журнал; второй результат — из кеша ли он.
+func (svc *Service) UserCashflow(ctx context.Context, userID string, months int, perAccount bool, now time.Time) (storage.Cashflow, bool) {
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	key := fmt.Sprintf("%s-%d-%t-%s", userID, months, perAccount, current.Format("2006-01"))
+	for _, c := range cashflowCollections {
+		key += fmt.Sprintf("-%s.%d", c, svc.Generation(ctx, c))
+	}
+	cachedCashflow.mu.Lock()
+	report, ok := cachedCashflow.reports[key]
+	cachedCashflow.mu.Unlock()
+	if ok {
+		return report, true
+	}
+
+	report = svc.buildCashflow(ctx, userID, current.AddDate(0, -(months-1), 0), months, perAccount, now)
+
+	cachedCashflow.mu.Lock()
+	defer cachedCashflow.mu.Unlock()
+	if len(cachedCashflow.reports) >= CashflowConfig.CacheEntries {
+		cachedCashflow.reports = make(map[string]storage.Cashflow)
+	}
+	cachedCashflow.reports[key] = report
+	return report, false
+}
+
+func (svc *Service) buildCashflow(ctx context.Context, userID string, from time.Time, months int, perAccount bool, now time.Time) storage.Cashflow {
+	accounts := svc.GetUserAccounts(ctx, userID)
+	own := make(map[string]bool, len(accounts))
+	for _, acc := range accounts {
+		own[acc.ID] = true
+	}
+
+	// byAccount[i][j] — обороты счёта j за месяц i в валюте счёта
+	byAccount := make([][]storage.CashflowAccount, months)
+	for i := range byAccount {
+		byAccount[i] = make([]storage.CashflowAccount, len(accounts))
+		for j, acc := range accounts {
+			byAccount[i][j] = storage.CashflowAccount{AccountID: acc.ID, Number: acc.Number, Currency: acc.Currency, Income: decimal.Zero, Expenses: decimal.Zero}
+		}
+	}
+	for j, acc := range accounts {
+		for _, tx := range svc.GetAccountTransactions(ctx, acc.ID) {
+			date := tx.EffectiveDate()
+			if date.Before(from) || date.After(now) {
+				continue
+			}
+			i := (date.Year()-from.Year())*12 + int(date.Month()) - int(from.Month())
+			if i < 0 || i >= months {
+				continue
+			}
+			line := &byAccount[i][j]
+			switch income, expense := externalFlow(tx, acc.ID, own); {
+			case income:
+				line.Income = line.Income.Add(tx.Amount)
+			case expense:
+				line.Expenses = line.Expenses.Add(tx.Amount)
+			}
+		}
+	}
+
+	report := storage.Cashflow{UserID: userID, Currency: storage.BaseCurrency, Months: make([]storage.CashflowMonth, 0, months), GeneratedAt: now}
+	totalIncome, totalExpenses := map[string]decimal.Decimal{}, map[string]decimal.Decimal{}
+	for i, lines := range byAccount {
+		income, expenses := map[string]decimal.Decimal{}, map[string]decimal.Decimal{}
+		month := storage.CashflowMonth{Month: from.AddDate(0, i, 0).Format("2006-01")}
+		for _, line := range lines {
+			income[line.Currency] = income[line.Currency].Add(line.Income)
+			expenses[line.Currency] = expenses[line.Currency].Add(line.Expenses)
+			totalIncome[line.Currency] = totalIncome[line.Currency].Add(line.Income)
+			totalExpenses[line.Currency] = totalExpenses[line.Currency].Add(line.Expenses)
+			if perAccount {
+				line.Net = line.Income.Sub(line.Expenses)
+				month.Accounts = append(month.Accounts, line)
+			}
+		}
+		month.Income = svc.overviewAmount(ctx, income).Total
+		month.Expenses = svc.overviewAmount(ctx, expenses).Total
+		month.Net = month.Income.Sub(month.Expenses)
+		report.Months = append(report.Months, month)
+	}
+	report.Income = svc.overviewAmount(ctx, totalIncome).Total
+	report.Expenses = svc.overviewAmount(ctx, totalExpenses).Total
+	report.Net = report.Income.Sub(report.Expenses)
+	return report
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// ParseCertificateYear проверяет год справки: завершённый или текущий год, не раньше открытия счёта
+func ParseCertificateYear(param string, account storage.Account, now time.Time) (int, error) {
+	year := now.Year() - 1
+	if param != "" {
+		if _, err := fmt.Sscanf(param, "%d", &year); err != nil || len(param) != 4 {
+			return 0, fmt.Errorf("invalid year, expected YYYY")
+		}
+	}
+	if year > now.Year() {
+		return 0, fmt.Errorf("year %d has not started yet", year)
+	}
+	if year < account.CreatedAt.Year() {
+		return 0, fmt.Errorf("account was opened in %d", account.CreatedAt.Year())
+	}
+	return year, nil
+}
+
+// accountHolderName — имя держателя с карты счёта, иначе логин владельца
+func (svc *Service) accountHolderName(ctx context.Context, account storage.Account) string {
+	for _, card := range svc.GetAccountCards(ctx, account.ID) {
+		if card.HolderName != "" {
+			return card.HolderName
+		}
+	}
+	if user, ok := svc.GetUser(ctx, account.UserID); ok {
+		return user.Username
+	}
+	return ""
+}
+
+// BuildInterestCertificate собирает проценты и плату за хранение, проведённые по счёту за год (по дате валютирования)
+func (svc *Service) BuildInterestCertificate(ctx context.Context, account storage.Account, year int, now time.Time) storage.InterestCertificate {
+	cert := storage.InterestCertificate{
+		Number:       fmt.Sprintf("INT-%d-%s", year, account.Number[len(account.Number)-6:]),
+		Account:      account,
+		HolderName:   svc.accountHolderName(ctx, account),
+		Year:         year,
+		Postings:     make([]storage.InterestPosting, 0),
+		TotalEarned:  decimal.Zero,
+		TotalCharged: decimal.Zero,
+		IssuedAt:     now,
+	}
+	for _, tx := range svc.GetAccountTransactions(ctx, account.ID) {
+		if tx.EffectiveDate().Year() != year {
+			continue
+		}
+		switch {
+		case tx.TransactionType == "interest" && tx.ToAccountID == account.ID:
+			cert.TotalEarned = cert.TotalEarned.Add(tx.Amount)
+		case tx.TransactionType == "custody_fee" && tx.FromAccountID == account.ID:
+			cert.TotalCharged = cert.TotalCharged.Add(tx.Amount)
+		default:
+			continue
+		}
+		cert.Postings = append(cert.Postings, storage.InterestPosting{
+			TransactionID: tx.ID,
+			ValueDate:     tx.EffectiveDate(),
+			Type:          tx.TransactionType,
+			Amount:        tx.Amount,
+			Period:        tx.DescriptionParams["period"],
+		})
+	}
+	sort.Slice(cert.Postings, func(i, j int) bool { return cert.Postings[i].ValueDate.Before(cert.Postings[j].ValueDate) })
+	cert.NetInterest = cert.TotalEarned.Sub(cert.TotalCharged)
+	return cert
+}
+
+func FormatInterestCertificatePDF(cert storage.InterestCertificate) []byte {
+	var doc pdfDocument
+	doc.Heading("Simple Bank")
+	doc.Bold("Certificate of interest earned No. %s", cert.Number)
+	doc.Blank()
+	doc.Text("This certificate confirms the interest paid on the account below for calendar year %d.", cert.Year)
+	doc.Blank()
+	doc.Text("Account holder:   %s", cert.HolderName)
+	doc.Text("Account number:   %s", cert.Account.Number)
+	doc.Text("Product:          %s", cert.Account.ProductCode)
+	doc.Text("Currency:         %s", cert.Account.Currency)
+	doc.Text("Period:           01.01.%d - 31.12.%d", cert.Year, cert.Year)
+	doc.Blank()
+
+	if len(cert.Postings) == 0 {
+		doc.Text("No interest was paid on this account during the period.")
+	} else {
+		doc.Bold("%-14s%-14s%-16s%s", "Value date", "Period", "Type", "Amount")
+		for _, p := range cert.Postings {
+			amount := p.Amount.StringFixed(2)
+			if p.Type == "custody_fee" {
+				amount = "-" + amount
+			}
+			doc.Text("%-14s%-14s%-16s%s", p.ValueDate.Format("02.01.2006"), p.Period, strings.ReplaceAll(p.Type, "_", " "), amount)
+		}
+	}
+	doc.Blank()
+	doc.Bold("Total interest earned:    %s %s", cert.TotalEarned.StringFixed(2), cert.Account.Currency)
+	doc.Text("Custody fees charged:     %s %s", cert.TotalCharged.StringFixed(2), cert.Account.Currency)
+	doc.Bold("Net interest income:      %s %s", cert.NetInterest.StringFixed(2), cert.Account.Currency)
+	doc.Blank()
+	doc.Text("Issued on %s. This document was generated electronically and is valid without a signature.", cert.IssuedAt.Format("02.01.2006"))
+	return doc.Bytes()
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// FileChargeback открывает спор клиента по оплате мерчанту; сумма сразу удерживается у мерчанта
+func (svc *Service) FileChargeback(ctx context.Context, userID, transactionID string, req storage.ChargebackRequest, now time.Time) (storage.Chargeback, error) {
+	if strings.TrimSpace(req.Reason) == "" {
+		return storage.Chargeback{}, invalidInputf("reason is required")
+	}
+	if req.Amount.IsNegative() {
+		return storage.Chargeback{}, invalidInputf("amount must be positive")
+	}
+	if original, ok := svc.GetTransaction(ctx, transactionID); ok {
+		if acc, ok := svc.GetAccount(ctx, original.FromAccountID); ok {
+			if err := storage.ValidateAmount(req.Amount, acc.Currency); err != nil {
+				return storage.Chargeback{}, err
+			}
+		}
+	}
+
+	cb, err := svc.OpenChargeback(ctx, storage.Chargeback{
+		ID:            storage.GenerateID(),
+		TransactionID: transactionID,
+		UserID:        userID,
+		Amount:        req.Amount,
+		Reason:        req.Reason,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return storage.Chargeback{}, err
+	}
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     cb.UserID,
+		Action:    "chargeback.open",
+		Details: map[string]string{
+			"chargeback_id":  cb.ID,
+			"transaction_id": cb.TransactionID,
+			"merchant_id":    cb.MerchantID,
+			"amount":         cb.Amount.String(),
+			"held":           cb.HeldAmount.String(),
+		},
+	})
+	svc.PublishBalanceChanged(ctx, cb.SettlementAccountID)
+	svc.NotifyMerchant(ctx, cb.MerchantID, storage.ChargeDisputeOpened, chargebackEventData(cb))
+	log.Printf("Chargeback %s opened for payment %s: %s (held %s)", cb.ID, cb.TransactionID, cb.Amount.String(), cb.HeldAmount.String())
+	return cb, nil
+}
+
+func (svc *Service) SubmitChargebackEvidence(ctx context.Context, merchant storage.Merchant, chargebackID string, req storage.ChargebackEvidenceRequest, now time.Time) (storage.Chargeback, error) {
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return storage.Chargeback{}, invalidInputf("evidence text is required")
+	}
+	return svc.AddChargebackEvidence(ctx, merchant.ID, chargebackID, storage.ChargebackEvidence{Text: text, SubmittedAt: now})
+}
+
+// ResolveChargeback фиксирует решение админа: accept возвращает сумму клиенту, иначе удержание снимается в пользу мерчанта
+func (svc *Service) ResolveChargeback(ctx context.Context, chargebackID string, accept bool, resolution string, now time.Time) (storage.Chargeback, error) {
+	cb, ok := svc.GetChargeback(ctx, chargebackID)
+	if !ok {
+		return storage.Chargeback{}, &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("chargeback %s not found", chargebackID)}
+	}
+	merchantName := cb.MerchantID
+	if merchant, ok := svc.GetMerchant(ctx, cb.MerchantID); ok {
+		merchantName = merchant.Name
+	}
+
+	tx := storage.Transaction{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Merchant:  merchantName,
+	}
+	tx.Describe(storage.DescChargeback, map[string]string{"merchant": merchantName})
+	receivable := storage.Receivable{
+		ID:     storage.GenerateID(),
+		Reason: "chargeback",
+	}
+
+	cb, err := svc.Repository.ResolveChargeback(ctx, chargebackID, accept, resolution, tx, receivable, now)
+	if err != nil {
+		return cb, err
+	}
+
+	action := "chargeback.reject"
+	if accept {
+		action = "chargeback.accept"
+	}
+	details := map[string]string{
+		"chargeback_id":  cb.ID,
+		"transaction_id": cb.TransactionID,
+		"merchant_id":    cb.MerchantID,
+		"amount":         cb.Amount.String(),
+		"resolution":     resolution,
+	}
+	if cb.ReceivableID != "" {
+		details["receivable"] = cb.ReceivableID
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    action,
+		Details:   details,
+	})
+	svc.PublishBalanceChanged(ctx, cb.SettlementAccountID)
+	if accept {
+		svc.PublishBalanceChanged(ctx, cb.CustomerAccountID)
+	}
+	svc.notifyChargebackResolved(context.WithoutCancel(ctx), cb, merchantName)
+	svc.NotifyMerchant(ctx, cb.MerchantID, storage.ChargeChargeback, chargebackEventData(cb))
+
+	log.Printf("Chargeback %s resolved: %s", cb.ID, cb.Status)
+	return cb, nil
+}
+
+func (svc *Service) notifyChargebackResolved(ctx context.Context, cb storage.Chargeback, merchantName string) {
+	user, ok := svc.GetUser(ctx, cb.UserID)
+	if !ok {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\nYour dispute of the payment of %s to %s has been reviewed.", user.Username, cb.Amount.String(), merchantName)
+	if cb.Status == storage.ChargebackAccepted {
+		body += "\nThe amount has been returned to your account."
+	} else {
+		body += "\nThe dispute was declined."
+	}
+	if cb.Resolution != "" {
+		body += "\nComment: " + cb.Resolution
+	}
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: payment dispute resolved", body)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var CollateralConfig = struct {
+	MaxItems int
+	// MaxLTV — какую долю заявленной стоимости залога банк готов выдать в кредит, %
+	MaxLTV map[string]decimal.Decimal
+}{
+	MaxItems: 5,
+	MaxLTV: map[string]decimal.Decimal{
+		storage.CollateralRealEstate: decimal.NewFromInt(80),
+		storage.CollateralVehicle:    decimal.NewFromInt(60),
+		storage.CollateralDeposit:    decimal.NewFromInt(90),
+		storage.CollateralSecurities: decimal.NewFromInt(50),
+		storage.CollateralOther:      decimal.NewFromInt(30),
+	},
+}
+
+// PrepareCollateral проверяет залог из заявки и соотношение кредита к залогу (LTV): сумма кредита не должна
+// превышать заявленную стоимость каждой позиции, умноженную на допустимый для её типа LTV. Без залога кредит
+// выдаётся как раньше. Позиции возвращаются в статусе pending — оформляются они при выдаче кредита.
+func PrepareCollateral(reqs []storage.CollateralRequest, amount decimal.Decimal) ([]storage.Collateral, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	if len(reqs) > CollateralConfig.MaxItems {
+		return nil, invalidInputf("at most %d collateral items per loan", CollateralConfig.MaxItems)
+	}
+	items := make([]storage.Collateral, 0, len(reqs))
+	lendable := decimal.Zero
+	for _, req := range reqs {
+		ltv, ok := CollateralConfig.MaxLTV[req.AssetType]
+		if !ok {
+			return nil, invalidInputf("asset_type must be one of %s, %s, %s, %s, %s", storage.CollateralRealEstate,
+				storage.CollateralVehicle, storage.CollateralDeposit, storage.CollateralSecurities, storage.CollateralOther)
+		}
+		description := strings.TrimSpace(req.Description)
+		if description == "" {
+			return nil, invalidInputf("collateral description is required")
+		}
+		if !req.DeclaredValue.IsPositive() {
+			return nil, invalidInputf("collateral declared_value must be positive")
+		}
+		lendable = lendable.Add(req.DeclaredValue.Mul(ltv).Div(decimal.NewFromInt(100)))
+		items = append(items, storage.Collateral{
+			ID:            storage.GenerateID(),
+			AssetType:     req.AssetType,
+			Description:   description,
+			DeclaredValue: req.DeclaredValue,
+			Status:        storage.CollateralPending,
+		})
+	}
+	if amount.GreaterThan(lendable) {
+		return nil, &storage.StorageError{
+			Kind:    storage.ErrQuotaExceeded,
+			Code:    storage.CodeCreditDeclined,
+			Message: fmt.Sprintf("loan amount exceeds %s allowed by the loan-to-value limits of the collateral", lendable.RoundBank(2).String()),
+		}
+	}
+	return items, nil
+}
+
+// PledgeCollateral оформляет залог при выдаче кредита
+func PledgeCollateral(items []storage.Collateral, now time.Time) []storage.Collateral {
+	pledged := make([]storage.Collateral, 0, len(items))
+	for _, item := range items {
+		item.Status = storage.CollateralPledged
+		item.PledgedAt = &now
+		pledged = append(pledged, item)
+	}
+	return pledged
+}
+
+// notifyCollateralReleased сообщает заёмщику, что залог по погашенному кредиту снят
+func (svc *Service) notifyCollateralReleased(ctx context.Context, loan storage.Loan, now time.Time) {
+	released := make([]string, 0, len(loan.Collateral))
+	for _, item := range loan.Collateral {
+		if item.Status == storage.CollateralReleased && item.ReleasedAt != nil && item.ReleasedAt.Equal(now) {
+			released = append(released, item.Description)
+		}
+	}
+	if len(released) == 0 {
+		return
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "system",
+		Action:    "loan.collateral_released",
+		Details:   map[string]string{"loan_id": loan.ID, "items": strconv.Itoa(len(released))},
+	})
+	log.Printf("Loan %s repaid: %d collateral items released", loan.ID, len(released))
+	if user, ok := svc.GetUser(ctx, loan.UserID); ok {
+		svc.QueueEmail(ctx, user.Email, "Simple Bank: collateral released",
+			fmt.Sprintf("Hello %s,\n\nYour loan %s is fully repaid. The pledge has been released from: %s.",
+				user.Username, loan.ID, strings.Join(released, "; ")))
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ConfirmationCleanupConfig — как часто закрываются операции, не подтверждённые клиентом в срок.
+// Сроки задаются по типам операций: PaymentChallengeConfig.CodeTTL (3-D Secure), CardRevealConfig.CodeTTL и TokenTTL.
+var ConfirmationCleanupConfig = struct {
+	Interval time.Duration
+}{
+	Interval: time.Minute,
+}
+
+func (svc *Service) StartConfirmationCleanupJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				svc.runConfirmationCleanup(ctx, now)
+			}
+		}
+	}()
+}
+
+// runConfirmationCleanup закрывает просроченные подтверждения: у оплат 3-D Secure снимается холд,
+// запросы реквизитов карты сгорают вместе с токеном. Инициатор получает письмо о том, что операция отменена.
+func (svc *Service) runConfirmationCleanup(ctx context.Context, now time.Time) {
+	for _, c := range svc.ExpirePaymentChallenges(ctx, now) {
+		metrics.add(metricPaymentChallengesLost, 1)
+		log.Printf("Payment %s expired unconfirmed, %s %s released on account %s", c.ID, c.Amount.String(), c.Currency, c.AccountID)
+		svc.PublishBalanceChanged(ctx, c.AccountID)
+		svc.notifyConfirmationExpired(ctx, c.UserID, "Simple Bank: payment cancelled",
+			fmt.Sprintf("The payment of %s %s to %s was not confirmed in time and has been cancelled. "+
+				"The blocked amount is available on your account again.", c.Amount.String(), c.Currency, c.Merchant))
+	}
+	for _, reveal := range svc.ExpireCardReveals(ctx, now) {
+		log.Printf("Card reveal %s for card %s expired", reveal.ID, reveal.CardID)
+		svc.notifyConfirmationExpired(ctx, reveal.UserID, "Simple Bank: card details request expired",
+			"Your request to view card details was not completed in time and has expired. "+
+				"If you did not make this request, change your password and revoke your sessions.")
+	}
+}
+
+func (svc *Service) notifyConfirmationExpired(ctx context.Context, userID, subject, text string) {
+	user, ok := svc.GetUser(ctx, userID)
+	if !ok {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\n%s", user.Username, text)
+	svc.QueueEmail(ctx, user.Email, subject, body)
+}
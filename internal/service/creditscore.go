@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var CreditScoreConfig = struct {
+	Base, Min, Max int
+}{
+	Base: 600,
+	Min:  300,
+	Max:  850,
+}
+
+// CreditGrades — грейды по убыванию порога; клиент получает первый, до которого дотягивает рейтинг
+var CreditGrades = []storage.CreditGrade{
+	{Grade: "A", MinScore: 750, RateAdjustment: decimal.NewFromInt(-2), MaxLoanAmount: decimal.NewFromInt(5000000)},
+	{Grade: "B", MinScore: 680, RateAdjustment: decimal.NewFromInt(-1), MaxLoanAmount: decimal.NewFromInt(2000000)},
+	{Grade: "C", MinScore: 600, RateAdjustment: decimal.Zero, MaxLoanAmount: decimal.NewFromInt(1000000)},
+	{Grade: "D", MinScore: 520, RateAdjustment: decimal.NewFromInt(3), MaxLoanAmount: decimal.NewFromInt(300000)},
+	{Grade: "E", MinScore: 0, RateAdjustment: decimal.Zero, MaxLoanAmount: decimal.Zero},
+}
+
+func creditGrade(score int) storage.CreditGrade {
+	for _, g := range CreditGrades {
+		if score >= g.MinScore {
+			return g
+		}
+	}
+	return CreditGrades[len(CreditGrades)-1]
+}
+
+// balanceImpact — вклад суммарного остатка на счетах в рублях
+func balanceImpact(total decimal.Decimal) int {
+	switch {
+	case total.GreaterThanOrEqual(decimal.NewFromInt(500000)):
+		return 100
+	case total.GreaterThanOrEqual(decimal.NewFromInt(100000)):
+		return 60
+	case total.GreaterThanOrEqual(decimal.NewFromInt(10000)):
+		return 30
+	}
+	return 0
+}
+
+// guaranteeImpact — вклад поручительств: −10 за каждые 100 000 ₽ чужого долга и −50 за каждый кредит в просрочке
+func guaranteeImpact(liability decimal.Decimal, overdue int) int {
+	impact := -10*int(liability.Div(decimal.NewFromInt(100000)).IntPart()) - 50*overdue
+	return max(impact, -200)
+}
+
+// RefreshCreditScore пересчитывает рейтинг клиента по истории платежей по кредитам, просрочкам, поручительствам
+// и остаткам на счетах
+func (svc *Service) RefreshCreditScore(ctx context.Context, userID string, now time.Time) (storage.CreditScore, error) {
+	paid := 0
+	delinquency := 0
+	overdueLoans := 0
+	for _, loan := range svc.GetUserLoans(ctx, userID) {
+		for _, payment := range loan.PaymentSchedule {
+			if payment.Paid {
+				paid++
+			}
+		}
+		view := accrueLoan(loan, now)
+		switch view.Status {
+		case storage.LoanDefault:
+			delinquency -= 250
+			overdueLoans++
+		case storage.LoanDelinquent:
+			delinquency -= min(50+2*view.DaysPastDue, 200)
+			overdueLoans++
+		}
+	}
+
+	balance := decimal.Zero
+	for _, acc := range svc.GetUserAccounts(ctx, userID) {
+		if acc.IsClosed() {
+			continue
+		}
+		amount, err := svc.toBaseCurrency(ctx, acc.Balance, acc.Currency)
+		if err != nil {
+			return storage.CreditScore{}, err
+		}
+		balance = balance.Add(amount)
+	}
+
+	liability, overdueGuarantees, err := svc.guaranteeLiability(ctx, userID, now)
+	if err != nil {
+		return storage.CreditScore{}, err
+	}
+
+	factors := []storage.CreditScoreFactor{
+		{Name: "repayment", Impact: min(5*paid, 100), Detail: fmt.Sprintf("%d scheduled payments paid", paid)},
+		{Name: "delinquency", Impact: max(delinquency, -400), Detail: fmt.Sprintf("%d loans overdue or in default", overdueLoans)},
+		{Name: "guarantees", Impact: guaranteeImpact(liability, overdueGuarantees), Detail: fmt.Sprintf("guarantor liability %s %s, %d guaranteed loans overdue", liability.StringFixed(2), storage.BaseCurrency, overdueGuarantees)},
+		{Name: "balances", Impact: balanceImpact(balance), Detail: fmt.Sprintf("total balance %s %s", balance.StringFixed(2), storage.BaseCurrency)},
+	}
+	score := CreditScoreConfig.Base
+	for _, f := range factors {
+		score += f.Impact
+	}
+	score = max(CreditScoreConfig.Min, min(score, CreditScoreConfig.Max))
+	grade := creditGrade(score)
+
+	result := storage.CreditScore{
+		UserID:         userID,
+		Score:          score,
+		Grade:          grade.Grade,
+		RateAdjustment: grade.RateAdjustment,
+		MaxLoanAmount:  grade.MaxLoanAmount,
+		Currency:       storage.BaseCurrency,
+		Factors:        factors,
+		UpdatedAt:      now,
+	}
+	if err := svc.SaveCreditScore(ctx, result); err != nil {
+		return storage.CreditScore{}, err
+	}
+	return result, nil
+}
+
+// UserCreditScore — последний рассчитанный рейтинг; если его ещё нет, рейтинг считается сейчас
+func (svc *Service) UserCreditScore(ctx context.Context, userID string, now time.Time) (storage.CreditScore, error) {
+	if score, ok := svc.GetCreditScore(ctx, userID); ok {
+		return score, nil
+	}
+	return svc.RefreshCreditScore(ctx, userID, now)
+}
+
+// CreditDecision пересчитывает рейтинг заявителя и проверяет, что сумма кредита в рублях укладывается в лимит грейда
+func (svc *Service) CreditDecision(ctx context.Context, userID string, amount decimal.Decimal, currency string, now time.Time) (storage.CreditScore, error) {
+	score, err := svc.RefreshCreditScore(ctx, userID, now)
+	if err != nil {
+		return storage.CreditScore{}, err
+	}
+	base, err := svc.toBaseCurrency(ctx, amount, currency)
+	if err != nil {
+		return storage.CreditScore{}, err
+	}
+	if base.GreaterThan(score.MaxLoanAmount) {
+		return score, &storage.StorageError{
+			Kind:    storage.ErrQuotaExceeded,
+			Code:    storage.CodeCreditDeclined,
+			Message: fmt.Sprintf("loan amount exceeds the limit of %s %s for credit grade %s", score.MaxLoanAmount.String(), storage.BaseCurrency, score.Grade),
+		}
+	}
+	return score, nil
+}
+
+func (svc *Service) runCreditScoring(ctx context.Context, now time.Time) {
+	for _, user := range svc.ListUsers(ctx) {
+		if _, err := svc.RefreshCreditScore(ctx, user.ID, now); err != nil {
+			log.Printf("Credit scoring: user %s: %v", user.ID, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"bankapp/internal/storage"
+)
+
+// AccountLanguage — язык владельца счёта, которым рендерятся выписки и лента операций
+func (svc *Service) AccountLanguage(ctx context.Context, accountID string) string {
+	if acc, ok := svc.GetAccount(ctx, accountID); ok {
+		if user, ok := svc.GetUser(ctx, acc.UserID); ok && user.Language != "" {
+			return user.Language
+		}
+	}
+	return storage.DefaultLanguage
+}
+
+// TransactionDetail — операция с родительской и связанными проводками, описания на языке участника.
+// Непустой userID должен владеть счётом списания или зачисления, иначе операция считается ненайденной.
+func (svc *Service) TransactionDetail(ctx context.Context, txID, userID string) (storage.TransactionDetail, error) {
+	detail, ok := svc.GetTransactionDetail(ctx, txID)
+	notFound := &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeTransactionNotFound, Message: fmt.Sprintf("transaction %s not found", txID)}
+	if !ok {
+		return storage.TransactionDetail{}, notFound
+	}
+	tx := detail.Transaction
+	accountID := tx.FromAccountID
+	if userID != "" {
+		from, _ := svc.GetAccount(ctx, tx.FromAccountID)
+		to, _ := svc.GetAccount(ctx, tx.ToAccountID)
+		switch userID {
+		case from.UserID:
+		case to.UserID:
+			accountID = to.ID
+		default:
+			return storage.TransactionDetail{}, notFound
+		}
+	} else if accountID == "" {
+		accountID = tx.ToAccountID
+	}
+
+	lang := svc.AccountLanguage(ctx, accountID)
+	detail.Transaction.Description = storage.LocalizedDescription(detail.Transaction, lang)
+	if detail.Parent != nil {
+		detail.Parent.Description = storage.LocalizedDescription(*detail.Parent, lang)
+	}
+	detail.Group = storage.LocalizeTransactions(detail.Group, lang)
+	return detail, nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var DeviceSigningConfig = struct {
+	Threshold      decimal.Decimal // в рублях: переводы от этой суммы клиент с ключом устройства обязан подписать
+	ReplayWindow   time.Duration
+	MaxKeysPerUser int
+}{
+	Threshold:      marginFromEnv("BANKAPP_SIGNING_THRESHOLD", decimal.NewFromInt(1000000)),
+	ReplayWindow:   5 * time.Minute,
+	MaxKeysPerUser: 5,
+}
+
+// parseDevicePublicKey принимает base64 DER SubjectPublicKeyInfo или PEM; поддерживаются Ed25519 и ECDSA P-256
+func parseDevicePublicKey(encoded string) ([]byte, string, error) {
+	encoded = strings.TrimSpace(encoded)
+	var der []byte
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, "", invalidInputf("public_key must be base64 DER or PEM")
+		}
+		der = decoded
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, "", invalidInputf("public_key is not a valid SubjectPublicKeyInfo: %v", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return der, storage.DeviceKeyEd25519, nil
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return der, storage.DeviceKeyECDSAP256, nil
+		}
+	}
+	return nil, "", invalidInputf("only Ed25519 and ECDSA P-256 keys are supported")
+}
+
+// RegisterDeviceKey привязывает открытый ключ устройства к пользователю
+func (svc *Service) RegisterDeviceKey(ctx context.Context, userID string, req storage.DeviceKeyRequest, now time.Time) (storage.DeviceKey, error) {
+	der, algorithm, err := parseDevicePublicKey(req.PublicKey)
+	if err != nil {
+		return storage.DeviceKey{}, err
+	}
+	active := 0
+	for _, key := range svc.ListDeviceKeys(ctx, userID) {
+		if key.Active() {
+			active++
+		}
+	}
+	if active >= DeviceSigningConfig.MaxKeysPerUser {
+		return storage.DeviceKey{}, &storage.StorageError{Kind: storage.ErrQuotaExceeded, Message: fmt.Sprintf("at most %d active device keys per user", DeviceSigningConfig.MaxKeysPerUser)}
+	}
+	key := storage.DeviceKey{
+		ID:        storage.GenerateID(),
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Algorithm: algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(der),
+		CreatedAt: now,
+	}
+	if err := svc.AddDeviceKey(ctx, key); err != nil {
+		return storage.DeviceKey{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     userID,
+		Action:    "device_key.register",
+		Details:   map[string]string{"key_id": key.ID, "algorithm": algorithm, "name": key.Name},
+	})
+	return key, nil
+}
+
+func (svc *Service) RevokeDeviceKey(ctx context.Context, userID, keyID string, now time.Time) (storage.DeviceKey, error) {
+	key, err := svc.Repository.RevokeDeviceKey(ctx, userID, keyID, now)
+	if err != nil {
+		return storage.DeviceKey{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     userID,
+		Action:    "device_key.revoke",
+		Details:   map[string]string{"key_id": key.ID},
+	})
+	return key, nil
+}
+
+// CanonicalTransferPayload — строка, которую устройство подписывает для перевода:
+// "transfer\n" + timestamp + "\n" + from + "\n" + to + "\n" + amount + "\n" + currency, сумма без лишних нулей
+func CanonicalTransferPayload(timestamp, fromAccountID, toAccountID string, amount decimal.Decimal, currency string) string {
+	return strings.Join([]string{"transfer", timestamp, fromAccountID, toAccountID, amount.String(), currency}, "\n")
+}
+
+func invalidSignature(format string, args ...interface{}) error {
+	return &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeInvalidSignature, Message: fmt.Sprintf(format, args...)}
+}
+
+// RequireTransferSignature проверяет подпись крупного списания. Подпись обязательна, если сумма в рублях не меньше
+// порога и у владельца счёта есть активный ключ устройства. to — получатель в подписанной строке: счёт зачисления
+// для перевода и эскроу, алиас для P2P, номер счёта или запроса денег при их оплате. Возвращает ключ, которым
+// подписано списание, или nil, если подпись не требовалась и не передана.
+func (svc *Service) RequireTransferSignature(ctx context.Context, from storage.Account, to string, amount decimal.Decimal, sig storage.DeviceSignature, now time.Time) (*storage.DeviceKey, error) {
+	if sig.KeyID == "" && sig.Signature == "" {
+		base, err := svc.toBaseCurrency(ctx, amount, from.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if base.LessThan(DeviceSigningConfig.Threshold) {
+			return nil, nil
+		}
+		for _, key := range svc.ListDeviceKeys(ctx, from.UserID) {
+			if key.Active() {
+				return nil, &storage.StorageError{
+					Kind:    storage.ErrForbidden,
+					Code:    storage.CodeSignatureRequired,
+					Message: fmt.Sprintf("transfers from %s %s must be signed with a registered device key", DeviceSigningConfig.Threshold.String(), storage.BaseCurrency),
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	key, ok := svc.GetDeviceKey(ctx, sig.KeyID)
+	if !ok || key.UserID != from.UserID || !key.Active() {
+		return nil, invalidSignature("unknown or revoked device key %s", sig.KeyID)
+	}
+	unix, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return nil, invalidSignature("invalid X-Device-Timestamp")
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > DeviceSigningConfig.ReplayWindow || skew < -DeviceSigningConfig.ReplayWindow {
+		return nil, invalidSignature("signature timestamp outside of allowed window")
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return nil, invalidSignature("signature must be base64")
+	}
+	der, _ := base64.StdEncoding.DecodeString(key.PublicKey)
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, invalidSignature("stored device key is unreadable")
+	}
+	payload := []byte(CanonicalTransferPayload(sig.Timestamp, from.ID, to, amount, from.Currency))
+	valid := false
+	switch k := publicKey.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, payload, signature)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		valid = ecdsa.VerifyASN1(k, digest[:], signature)
+	}
+	if !valid {
+		return nil, invalidSignature("transfer signature does not match the payload")
+	}
+	if !svc.RememberSignature(ctx, key.ID+":"+sig.Signature, now, 2*DeviceSigningConfig.ReplayWindow) {
+		return nil, invalidSignature("replayed signature")
+	}
+	svc.TouchDeviceKey(ctx, key.ID, now)
+	return &key, nil
+}
+
+// AuditSignedTransfer сохраняет подпись вместе с подписанной строкой — доказательство, что перевод подтвердило устройство клиента
+func (svc *Service) AuditSignedTransfer(ctx context.Context, key storage.DeviceKey, transactionID string, sig storage.DeviceSignature, from storage.Account, to string, amount decimal.Decimal, now time.Time) {
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     key.UserID,
+		Action:    "transfer.signed",
+		Details: map[string]string{
+			"transaction_id": transactionID,
+			"key_id":         key.ID,
+			"signature":      sig.Signature,
+			"payload":        CanonicalTransferPayload(sig.Timestamp, from.ID, to, amount, from.Currency),
+		},
+	})
+}
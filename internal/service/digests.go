@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const (
+	digestHour            = 8
+	digestTopTransactions = 3
+	digestLoanHorizon     = 14 * 24 * time.Hour
+)
+
+// Шаблоны дайджеста; данные — digestView, суммы уже отформатированы
+var digestTemplates = map[string]broadcastTemplate{
+	"en": {
+		Subject: "Simple Bank: your {{.Frequency}} digest",
+		Body: "Dear {{.Username}},\n\nHere is your account summary for {{.From}} - {{.To}}.\n" +
+			"\nBalances:\n{{range .Accounts}}  {{.Number}}: {{.Opening}} -> {{.Closing}} {{.Currency}} ({{.Change}})\n{{end}}" +
+			"{{if .Transactions}}\nLargest transactions:\n{{range .Transactions}}  {{.Date}}  {{.Amount}} {{.Currency}}  {{.Description}}\n{{end}}{{end}}" +
+			"{{if .Loans}}\nUpcoming loan payments:\n{{range .Loans}}  {{.Date}}  {{.Amount}}\n{{end}}{{end}}" +
+			"\nYou can change the digest frequency in your profile settings.",
+	},
+	"ru": {
+		Subject: "Simple Bank: {{if eq .Frequency \"weekly\"}}еженедельная{{else}}ежедневная{{end}} сводка",
+		Body: "Здравствуйте, {{.Username}}!\n\nСводка по вашим счетам за период {{.From}} - {{.To}}.\n" +
+			"\nОстатки:\n{{range .Accounts}}  {{.Number}}: {{.Opening}} -> {{.Closing}} {{.Currency}} ({{.Change}})\n{{end}}" +
+			"{{if .Transactions}}\nКрупнейшие операции:\n{{range .Transactions}}  {{.Date}}  {{.Amount}} {{.Currency}}  {{.Description}}\n{{end}}{{end}}" +
+			"{{if .Loans}}\nБлижайшие платежи по кредитам:\n{{range .Loans}}  {{.Date}}  {{.Amount}}\n{{end}}{{end}}" +
+			"\nЧастоту сводки можно изменить в настройках профиля.",
+	},
+}
+
+type digestView struct {
+	Username     string
+	Frequency    string
+	From, To     string
+	Accounts     []struct{ Number, Currency, Opening, Closing, Change string }
+	Transactions []struct{ Date, Amount, Currency, Description string }
+	Loans        []struct{ Date, Amount string }
+}
+
+func IsValidDigestFrequency(freq string) bool {
+	switch freq {
+	case storage.DigestOff, storage.DigestDaily, storage.DigestWeekly:
+		return true
+	}
+	return false
+}
+
+// digestPeriod — длина периода сводки; еженедельная уходит только по понедельникам
+func digestPeriod(freq string, now time.Time) (time.Duration, bool) {
+	switch freq {
+	case storage.DigestDaily:
+		return 24 * time.Hour, true
+	case storage.DigestWeekly:
+		return 7 * 24 * time.Hour, now.Weekday() == time.Monday
+	}
+	return 0, false
+}
+
+// BuildDigest собирает сводку: изменение остатков, крупнейшие операции за период и ближайшие платежи по кредитам
+func (svc *Service) BuildDigest(ctx context.Context, userID, freq string, now time.Time) storage.Digest {
+	period, _ := digestPeriod(freq, now)
+	if period == 0 {
+		period = 24 * time.Hour
+	}
+	digest := storage.Digest{
+		UserID:          userID,
+		Frequency:       freq,
+		From:            now.Add(-period),
+		To:              now,
+		Accounts:        make([]storage.DigestAccount, 0),
+		TopTransactions: make([]storage.Transaction, 0),
+		UpcomingLoans:   make([]storage.DigestLoanPayment, 0),
+	}
+
+	seen := make(map[string]bool)
+	for _, acc := range svc.GetUserAccounts(ctx, userID) {
+		if acc.IsClosed() {
+			continue
+		}
+		st := svc.BuildStatement(ctx, acc, digest.From, digest.To)
+		digest.Accounts = append(digest.Accounts, storage.DigestAccount{
+			AccountID:      acc.ID,
+			Number:         acc.Number,
+			Currency:       acc.Currency,
+			OpeningBalance: st.OpeningBalance,
+			ClosingBalance: st.ClosingBalance,
+			Change:         st.ClosingBalance.Sub(st.OpeningBalance),
+		})
+		for _, tx := range st.Transactions {
+			if !seen[tx.ID] {
+				seen[tx.ID] = true
+				digest.TopTransactions = append(digest.TopTransactions, tx)
+			}
+		}
+	}
+	sort.SliceStable(digest.TopTransactions, func(i, j int) bool {
+		return digest.TopTransactions[i].Amount.GreaterThan(digest.TopTransactions[j].Amount)
+	})
+	if len(digest.TopTransactions) > digestTopTransactions {
+		digest.TopTransactions = digest.TopTransactions[:digestTopTransactions]
+	}
+
+	for _, loan := range svc.GetUserLoans(ctx, userID) {
+		for _, payment := range loan.PaymentSchedule {
+			if payment.Paid || payment.DueDate.Before(now) || payment.DueDate.Sub(now) > digestLoanHorizon {
+				continue
+			}
+			digest.UpcomingLoans = append(digest.UpcomingLoans, storage.DigestLoanPayment{LoanID: loan.ID, DueDate: payment.DueDate, Amount: payment.Amount})
+		}
+	}
+	sort.Slice(digest.UpcomingLoans, func(i, j int) bool { return digest.UpcomingLoans[i].DueDate.Before(digest.UpcomingLoans[j].DueDate) })
+	return digest
+}
+
+// renderDigest собирает письмо со сводкой на языке пользователя
+func renderDigest(d storage.Digest, user storage.User) (string, string, error) {
+	src, ok := digestTemplates[userLanguage(user)]
+	if !ok {
+		src = digestTemplates[storage.DefaultLanguage]
+	}
+
+	view := digestView{
+		Username:  user.Username,
+		Frequency: d.Frequency,
+		From:      d.From.Format("02.01.2006"),
+		To:        d.To.Format("02.01.2006"),
+	}
+	currencies := make(map[string]string)
+	for _, acc := range d.Accounts {
+		currencies[acc.AccountID] = acc.Currency
+		view.Accounts = append(view.Accounts, struct{ Number, Currency, Opening, Closing, Change string }{
+			acc.Number, acc.Currency, acc.OpeningBalance.StringFixed(2), acc.ClosingBalance.StringFixed(2), signedString(acc.Change),
+		})
+	}
+	for _, tx := range d.TopTransactions {
+		currency := currencies[tx.ToAccountID]
+		if currency == "" {
+			currency = currencies[tx.FromAccountID]
+		}
+		description := storage.LocalizedDescription(tx, userLanguage(user))
+		view.Transactions = append(view.Transactions, struct{ Date, Amount, Currency, Description string }{
+			tx.EffectiveDate().Format("02.01.2006"), tx.Amount.StringFixed(2), currency, description,
+		})
+	}
+	for _, p := range d.UpcomingLoans {
+		view.Loans = append(view.Loans, struct{ Date, Amount string }{p.DueDate.Format("02.01.2006"), p.Amount.StringFixed(2)})
+	}
+
+	var rendered [2]string
+	for i, text := range []string{src.Subject, src.Body} {
+		tmpl, err := template.New("digest").Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", "", err
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, view); err != nil {
+			return "", "", err
+		}
+		rendered[i] = sb.String()
+	}
+	return rendered[0], rendered[1], nil
+}
+
+func signedString(d decimal.Decimal) string {
+	if d.IsPositive() {
+		return "+" + d.StringFixed(2)
+	}
+	return d.StringFixed(2)
+}
+
+// runDigests рассылает сводки подписавшимся пользователям; повторно в тот же день письмо не уходит
+func (svc *Service) runDigests(ctx context.Context, now time.Time) {
+	sent := 0
+	for _, settings := range svc.ListDigestSubscribers(ctx) {
+		if _, due := digestPeriod(settings.DigestFrequency, now); !due {
+			continue
+		}
+		if last := settings.DigestLastSentAt; last != nil && last.Year() == now.Year() && last.YearDay() == now.YearDay() {
+			continue
+		}
+		user, ok := svc.GetUser(ctx, settings.UserID)
+		if !ok || !user.EmailVerified {
+			continue
+		}
+		digest := svc.BuildDigest(ctx, user.ID, settings.DigestFrequency, now)
+		subject, body, err := renderDigest(digest, user)
+		if err != nil {
+			log.Printf("Digest for user %s: %v", user.ID, err)
+			continue
+		}
+		if err := SendEmailNotification(ctx, user.Email, subject, body); err != nil {
+			log.Printf("Digest for user %s: %v", user.ID, err)
+			continue
+		}
+		svc.MarkDigestSent(ctx, user.ID, now)
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("Digests sent: %d", sent)
+	}
+}
+
+// UpdateUserSettings сохраняет настройки пользователя; время последней сводки не сбрасывается
+func (svc *Service) UpdateUserSettings(ctx context.Context, userID string, req storage.UserSettingsRequest, now time.Time) (storage.UserSettings, error) {
+	if !IsValidDigestFrequency(req.DigestFrequency) {
+		return storage.UserSettings{}, invalidInputf("digest_frequency must be one of %s, %s, %s", storage.DigestOff, storage.DigestDaily, storage.DigestWeekly)
+	}
+	settings := svc.GetUserSettings(ctx, userID)
+	settings.DigestFrequency = req.DigestFrequency
+	settings.UpdatedAt = now
+	if err := svc.SaveUserSettings(ctx, settings); err != nil {
+		return storage.UserSettings{}, err
+	}
+	return settings, nil
+}
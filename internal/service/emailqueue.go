@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// EmailQueueConfig — повторы писем: пауза растёт от BaseDelay вдвое после каждой неудачи, но не больше MaxDelay
+var EmailQueueConfig = struct {
+	MaxAttempts int           // после стольких неудач письмо переходит в dead-letter
+	BaseDelay   time.Duration // пауза перед первым повтором
+	MaxDelay    time.Duration
+	Interval    time.Duration // как часто очередь проверяется на письма к повтору
+	BatchSize   int
+	Lease       time.Duration // на сколько письмо откладывается, пока идёт попытка отправки
+}{
+	MaxAttempts: 6,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    time.Hour,
+	Interval:    10 * time.Second,
+	BatchSize:   50,
+	Lease:       2 * time.Minute,
+}
+
+// QueueEmail ставит письмо в очередь и сразу пытается его отправить; при неудаче письмо остаётся в очереди
+// и отправляется повторно, так что сбой почты не теряет уведомление
+func (svc *Service) QueueEmail(ctx context.Context, to, subject, body string) {
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	n := storage.EmailNotification{
+		ID:            storage.GenerateID(),
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        storage.NotificationPending,
+		NextAttemptAt: now.Add(EmailQueueConfig.Lease),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := svc.AddEmailNotification(ctx, n); err != nil {
+		log.Printf("Failed to queue email to %s: %v", to, err)
+		return
+	}
+	go svc.deliverEmail(ctx, n)
+}
+
+func (svc *Service) deliverEmail(ctx context.Context, n storage.EmailNotification) {
+	sendErr := SendEmailNotification(ctx, n.To, n.Subject, n.Body)
+	now := time.Now()
+	updated, err := svc.RecordEmailAttempt(ctx, n.ID, sendErr, EmailQueueConfig.MaxAttempts, now.Add(emailRetryDelay(n.Attempts+1)), now)
+	if err != nil {
+		log.Printf("Failed to record email %s delivery: %v", n.ID, err)
+		return
+	}
+	switch updated.Status {
+	case storage.NotificationPending:
+		log.Printf("Email %s to %s failed (attempt %d), retrying at %s", n.ID, n.To, updated.Attempts, updated.NextAttemptAt.Format(time.RFC3339))
+	case storage.NotificationDead:
+		metrics.add(metricEmailDeadLetters, 1)
+		log.Printf("Email %s to %s moved to dead-letter after %d attempts: %s", n.ID, n.To, updated.Attempts, updated.LastError)
+	}
+}
+
+// emailRetryDelay — пауза после attempts неудачных попыток
+func emailRetryDelay(attempts int) time.Duration {
+	delay := EmailQueueConfig.BaseDelay
+	for i := 1; i < attempts && delay < EmailQueueConfig.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, EmailQueueConfig.MaxDelay)
+}
+
+func (svc *Service) StartEmailRetryJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				svc.retryEmails(ctx, now)
+			}
+		}
+	}()
+}
+
+// retryEmails отправляет письма, срок повтора которых наступил, включая возвращённые из dead-letter
+func (svc *Service) retryEmails(ctx context.Context, now time.Time) {
+	for _, n := range svc.ClaimEmailNotifications(ctx, EmailQueueConfig.BatchSize, EmailQueueConfig.Lease, now) {
+		svc.deliverEmail(ctx, n)
+	}
+}
+
+// RequeueEmail возвращает письмо из dead-letter в очередь; отправка будет при ближайшем проходе
+func (svc *Service) RequeueEmail(ctx context.Context, id string, now time.Time) (storage.EmailNotification, error) {
+	n, err := svc.RequeueEmailNotification(ctx, id, now)
+	if err != nil {
+		return storage.EmailNotification{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "email.requeue",
+		Details:   map[string]string{"notification_id": n.ID, "to": n.To},
+	})
+	return n, nil
+}
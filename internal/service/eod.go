@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// eodRunning не даёт двум прогонам закрытия дня идти одновременно — по расписанию и вручную
+var eodRunning sync.Mutex
+
+type eodStep struct {
+	Name string
+	Run  func(ctx context.Context, now time.Time, batch *storage.EODBatch, step *storage.EODStep) error
+}
+
+// eodSteps — шаги закрытия дня в порядке выполнения: платежи по кредитам списываются до расчёта просрочки,
+// а снимок остатков делается последним, когда все движения дня уже проведены
+func (svc *Service) eodSteps() []eodStep {
+	return []eodStep{
+		{"interest_accrual", func(ctx context.Context, now time.Time, _ *storage.EODBatch, step *storage.EODStep) error {
+			return svc.runInterestAccrual(ctx, now, step)
+		}},
+		{"monthly_fees", func(ctx context.Context, now time.Time, _ *storage.EODBatch, step *storage.EODStep) error {
+			return svc.chargeMonthlyFees(ctx, now, step)
+		}},
+		{"loan_payments", func(ctx context.Context, now time.Time, _ *storage.EODBatch, step *storage.EODStep) error {
+			return svc.collectLoanPayments(ctx, now, step)
+		}},
+		{"loan_delinquency", func(ctx context.Context, now time.Time, _ *storage.EODBatch, step *storage.EODStep) error {
+			return svc.runLoanDelinquency(ctx, now, step)
+		}},
+		{"hold_expiry", func(ctx context.Context, now time.Time, _ *storage.EODBatch, step *storage.EODStep) error {
+			step.Processed = len(svc.expireHolds(ctx, now))
+			return ctx.Err()
+		}},
+		{"merchant_settlement", svc.settleMerchants},
+		{"balance_snapshot", func(ctx context.Context, _ time.Time, batch *storage.EODBatch, step *storage.EODStep) error {
+			snapshots, err := svc.SnapshotBalances(ctx, batch.Date)
+			for _, snapshot := range snapshots {
+				step.Processed++
+				addEODAmount(step, snapshot.Currency, snapshot.Balance)
+			}
+			return err
+		}},
+	}
+}
+
+func (svc *Service) runEndOfDay(ctx context.Context, now time.Time) {
+	if _, err := svc.RunEndOfDay(ctx, "", storage.EODTriggerSchedule, now); err != nil {
+		log.Printf("End of day: %v", err)
+	}
+}
+
+// RunEndOfDay закрывает операционный день date (пусто — сегодня). Закрытый день повторно не обрабатывается,
+// а после сбоя прогон продолжается с упавшего шага. За прошедшую дату шаги выполняются на конец того дня.
+func (svc *Service) RunEndOfDay(ctx context.Context, date, trigger string, now time.Time) (storage.EODBatch, error) {
+	today := StartOfDay(now)
+	day := today
+	if date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, now.Location())
+		if err != nil {
+			return storage.EODBatch{}, invalidInputf("date must be in YYYY-MM-DD format")
+		}
+		day = parsed
+	}
+	if day.After(today) {
+		return storage.EODBatch{}, invalidInputf("cannot close a future business day")
+	}
+	asOf := now
+	if day.Before(today) {
+		asOf = day.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	date = day.Format("2006-01-02")
+
+	if !eodRunning.TryLock() {
+		return storage.EODBatch{}, &storage.StorageError{Kind: storage.ErrConflict, Message: "end-of-day batch is already running"}
+	}
+	defer eodRunning.Unlock()
+
+	steps := svc.eodSteps()
+	batch, ok := svc.GetEODBatch(ctx, date)
+	if ok && batch.Status == storage.EODCompleted {
+		log.Printf("End of day %s is already closed, nothing to do", date)
+		return batch, nil
+	}
+	if !ok {
+		batch = storage.EODBatch{Date: date, Steps: make([]storage.EODStep, len(steps)), StartedAt: now}
+		for i, step := range steps {
+			batch.Steps[i] = storage.EODStep{Name: step.Name, Status: storage.EODStepPending}
+		}
+	}
+	batch.Status = storage.EODRunning
+	batch.Trigger = trigger
+	batch.Attempts++
+	svc.SaveEODBatch(ctx, batch)
+
+	for i, step := range steps {
+		if batch.Steps[i].Status == storage.EODStepDone {
+			continue
+		}
+		result := storage.EODStep{Name: step.Name}
+		err := step.Run(ctx, asOf, &batch, &result)
+		finished := time.Now()
+		result.FinishedAt = &finished
+		if err != nil {
+			result.Status = storage.EODStepFailed
+			result.Error = err.Error()
+			batch.Steps[i] = result
+			batch.Status = storage.EODFailed
+			svc.SaveEODBatch(context.WithoutCancel(ctx), batch)
+			log.Printf("End of day %s failed at step %s: %v", date, step.Name, err)
+			return batch, nil
+		}
+		result.Status = storage.EODStepDone
+		batch.Steps[i] = result
+		svc.SaveEODBatch(ctx, batch)
+		log.Printf("End of day %s: %s processed %d, skipped %d, failed %d", date, step.Name, result.Processed, result.Skipped, result.Failed)
+	}
+
+	finished := time.Now()
+	batch.Status = storage.EODCompleted
+	batch.FinishedAt = &finished
+	svc.SaveEODBatch(ctx, batch)
+	actor := "system"
+	if trigger == storage.EODTriggerManual {
+		actor = "admin"
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: finished,
+		Actor:     actor,
+		Action:    "eod.completed",
+		Details:   map[string]string{"date": date, "attempts": strconv.Itoa(batch.Attempts)},
+	})
+	log.Printf("End of day %s closed after %d attempt(s)", date, batch.Attempts)
+	return batch, nil
+}
+
+// chargeMonthlyFees — в последний день месяца списывает плату за обслуживание по продукту счёта. Плата задана
+// в рублях, со счетов в других валютах она списывается по курсу ЦБ; повторный прогон не списывает её второй раз.
+func (svc *Service) chargeMonthlyFees(ctx context.Context, now time.Time, step *storage.EODStep) error {
+	if now.AddDate(0, 0, 1).Day() != 1 {
+		return nil
+	}
+	for _, acc := range svc.ListAccounts(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if acc.IsClosed() || !acc.MonthlyFee.IsPositive() {
+			continue
+		}
+		fee := acc.MonthlyFee
+		if acc.Currency != storage.BaseCurrency {
+			rate, err := svc.GetCBRExchangeRate(ctx, acc.Currency)
+			if err != nil {
+				log.Printf("Monthly fee: account %s: %v", acc.ID, err)
+				step.Failed++
+				continue
+			}
+			fee = fee.Div(rate)
+		}
+		tx, charged, err := svc.ChargeMonthlyFee(ctx, acc.ID, fee, now)
+		if err != nil {
+			log.Printf("Monthly fee: account %s: %v", acc.ID, err)
+			step.Failed++
+			continue
+		}
+		if !charged {
+			step.Skipped++
+			continue
+		}
+		step.Processed++
+		addEODAmount(step, acc.Currency, tx.Amount)
+		svc.PublishBalanceChanged(ctx, acc.ID)
+	}
+	return nil
+}
+
+// collectLoanPayments списывает наступившие платежи по графику со счетов кредитов. Если остатка не хватает,
+// платёж остаётся неоплаченным и попадает в просрочку на следующем шаге.
+func (svc *Service) collectLoanPayments(ctx context.Context, now time.Time, step *storage.EODStep) error {
+	for _, loan := range svc.ListLoans(ctx) {
+		if !loan.RemainingAmount.IsPositive() {
+			continue
+		}
+		collected := false
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			tx, payment, ok, err := svc.CollectLoanPayment(ctx, loan.ID, now)
+			if err != nil {
+				var se *storage.StorageError
+				if errors.As(err, &se) && se.Kind == storage.ErrInsufficientFunds {
+					step.Skipped++
+				} else {
+					step.Failed++
+				}
+				log.Printf("Loan payment: loan %s: %v", loan.ID, err)
+				break
+			}
+			if !ok {
+				break
+			}
+			collected = true
+			step.Processed++
+			if acc, ok := svc.GetAccount(ctx, loan.AccountID); ok {
+				addEODAmount(step, acc.Currency, payment.Amount)
+			}
+			log.Printf("Loan payment: collected %s for loan %s due %s (transaction %s)", payment.Amount.String(), loan.ID, payment.DueDate.Format("2006-01-02"), tx.ID)
+		}
+		if collected {
+			svc.PublishBalanceChanged(ctx, loan.AccountID)
+			if updated, ok := svc.GetLoan(ctx, loan.ID); ok && !updated.RemainingAmount.IsPositive() {
+				svc.notifyCollateralReleased(ctx, updated, now)
+			}
+		}
+	}
+	return nil
+}
+
+// settleMerchants подводит итог дня по каждому мерчанту: оплаты, возвраты, чарджбэки и чистая сумма
+func (svc *Service) settleMerchants(ctx context.Context, now time.Time, batch *storage.EODBatch, step *storage.EODStep) error {
+	batch.Settlements = make([]storage.EODMerchantSettlement, 0)
+	for _, merchant := range svc.ListMerchants(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, day := range svc.MerchantSettlements(ctx, merchant, StartOfDay(now), now) {
+			if day.Date != batch.Date {
+				continue
+			}
+			batch.Settlements = append(batch.Settlements, storage.EODMerchantSettlement{MerchantID: merchant.ID, Name: merchant.Name, MerchantSettlement: day})
+			step.Processed++
+			addEODAmount(step, day.Currency, day.Net)
+		}
+	}
+	return nil
+}
+
+func addEODAmount(step *storage.EODStep, currency string, amount decimal.Decimal) {
+	if step.Amounts == nil {
+		step.Amounts = make(map[string]decimal.Decimal)
+	}
+	step.Amounts[currency] = step.Amounts[currency].Add(amount)
+}
+
+// EODBatch — отчёт о закрытии дня date
+func (svc *Service) EODBatch(ctx context.Context, date string) (storage.EODBatch, error) {
+	batch, ok := svc.GetEODBatch(ctx, date)
+	if !ok {
+		return storage.EODBatch{}, &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("no end-of-day batch for %s", date)}
+	}
+	return batch, nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var EscrowConfig = struct {
+	FulfillTimeout time.Duration // продавец не исполнил за это время — деньги возвращаются покупателю
+	MaxFulfill     time.Duration
+	ReleaseTimeout time.Duration // покупатель не подтвердил и не оспорил исполнение — деньги уходят продавцу
+	SweepInterval  time.Duration
+}{
+	FulfillTimeout: 14 * 24 * time.Hour,
+	MaxFulfill:     90 * 24 * time.Hour,
+	ReleaseTimeout: 3 * 24 * time.Hour,
+	SweepInterval:  5 * time.Minute,
+}
+
+func escrowForbidden(id, role string) error {
+	return &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeForbidden, Message: fmt.Sprintf("only the %s can do this with escrow %s", role, id)}
+}
+
+// escrowParty проверяет, что действие выполняет нужная сторона сделки; пустой userID (без сессии) не проверяется
+func (svc *Service) escrowParty(ctx context.Context, id, userID string, seller bool) (storage.Escrow, error) {
+	e, ok := svc.GetEscrow(ctx, id)
+	if !ok {
+		return storage.Escrow{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeEscrowNotFound, Message: fmt.Sprintf("escrow %s not found", id)}
+	}
+	switch {
+	case userID == "":
+	case seller && userID != e.SellerUserID:
+		return storage.Escrow{}, escrowForbidden(id, "seller")
+	case !seller && userID != e.BuyerUserID:
+		return storage.Escrow{}, escrowForbidden(id, "buyer")
+	}
+	return e, nil
+}
+
+func (svc *Service) auditEscrow(ctx context.Context, actor, action string, e storage.Escrow, now time.Time) {
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    action,
+		Details:   map[string]string{"escrow_id": e.ID, "status": e.Status, "amount": e.Amount.String()},
+	})
+}
+
+// CreateEscrow — покупатель userID депонирует сумму сделки: деньги сразу уходят с его счёта на системный счёт эскроу
+func (svc *Service) CreateEscrow(ctx context.Context, userID string, req storage.CreateEscrowRequest, sig storage.DeviceSignature, now time.Time) (storage.Escrow, error) {
+	buyer, ok := svc.GetAccount(ctx, req.BuyerAccountID)
+	if !ok {
+		return storage.Escrow{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("buyer account %s not found", req.BuyerAccountID)}
+	}
+	if err := svc.AuthorizeDebit(ctx, buyer, userID, req.Amount); err != nil {
+		return storage.Escrow{}, err
+	}
+	seller, ok := svc.GetAccount(ctx, req.SellerAccountID)
+	if !ok {
+		return storage.Escrow{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("seller account %s not found", req.SellerAccountID)}
+	}
+	if !req.Amount.IsPositive() {
+		return storage.Escrow{}, invalidInputf("escrow amount must be positive")
+	}
+	if err := storage.ValidateAmount(req.Amount, buyer.Currency); err != nil {
+		return storage.Escrow{}, err
+	}
+	fulfill := EscrowConfig.FulfillTimeout
+	if req.FulfillWithinHours < 0 {
+		return storage.Escrow{}, invalidInputf("fulfill_within_hours must be positive")
+	}
+	if req.FulfillWithinHours > 0 {
+		fulfill = time.Duration(req.FulfillWithinHours) * time.Hour
+	}
+	if fulfill > EscrowConfig.MaxFulfill {
+		return storage.Escrow{}, invalidInputf("fulfill_within_hours must be at most %d", int(EscrowConfig.MaxFulfill.Hours()))
+	}
+	releaseLimit, err := svc.ReserveTransferLimit(ctx, buyer, req.Amount, now)
+	if err != nil {
+		return storage.Escrow{}, err
+	}
+	defer releaseLimit()
+	if err := svc.CheckTierLimits(ctx, &buyer, &seller, req.Amount, now); err != nil {
+		return storage.Escrow{}, err
+	}
+	deviceKey, err := svc.RequireTransferSignature(ctx, buyer, seller.ID, req.Amount, sig, now)
+	if err != nil {
+		return storage.Escrow{}, err
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpEscrow, req.Amount, buyer.Currency, now)
+	if err != nil {
+		return storage.Escrow{}, err
+	}
+
+	e, err := svc.OpenEscrow(ctx, storage.Escrow{
+		ID:              storage.GenerateID(),
+		BuyerAccountID:  buyer.ID,
+		SellerAccountID: seller.ID,
+		Amount:          req.Amount,
+		Description:     strings.TrimSpace(req.Description),
+		FulfillBy:       now.Add(fulfill),
+		CreatedAt:       now,
+	}, storage.Transaction{ID: storage.GenerateID(), Timestamp: now})
+	if err != nil {
+		release()
+		return storage.Escrow{}, err
+	}
+	if deviceKey != nil {
+		svc.AuditSignedTransfer(ctx, *deviceKey, e.FundTxID, sig, buyer, seller.ID, req.Amount, now)
+	}
+	svc.auditEscrow(ctx, e.BuyerUserID, "escrow.fund", e, now)
+	svc.PublishBalanceChanged(ctx, e.BuyerAccountID)
+	log.Printf("Escrow %s funded: %s %s from %s for %s", e.ID, e.Amount.String(), e.Currency, e.BuyerAccountID, e.SellerAccountID)
+	return e, nil
+}
+
+// FulfillEscrow — продавец отмечает исполнение; с этого момента у покупателя ReleaseTimeout на подтверждение или спор
+func (svc *Service) FulfillEscrow(ctx context.Context, id, userID string, now time.Time) (storage.Escrow, error) {
+	if _, err := svc.escrowParty(ctx, id, userID, true); err != nil {
+		return storage.Escrow{}, err
+	}
+	e, err := svc.UpdateEscrow(ctx, id, func(e *storage.Escrow) error {
+		if e.Status != storage.EscrowFunded {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("escrow %s is %s, not funded", id, e.Status)}
+		}
+		releaseBy := now.Add(EscrowConfig.ReleaseTimeout)
+		e.Status = storage.EscrowFulfilled
+		e.FulfilledAt = &now
+		e.ReleaseBy = &releaseBy
+		return nil
+	})
+	if err != nil {
+		return storage.Escrow{}, err
+	}
+	svc.auditEscrow(ctx, e.SellerUserID, "escrow.fulfill", e, now)
+	return e, nil
+}
+
+// ReleaseEscrow — покупатель подтверждает сделку, деньги уходят продавцу
+func (svc *Service) ReleaseEscrow(ctx context.Context, id, userID string, now time.Time) (storage.Escrow, error) {
+	if _, err := svc.escrowParty(ctx, id, userID, false); err != nil {
+		return storage.Escrow{}, err
+	}
+	return svc.settleEscrow(ctx, id, true, []string{storage.EscrowFunded, storage.EscrowFulfilled}, "", "escrow.release", now)
+}
+
+// DisputeEscrow — покупатель оспаривает сделку; таймауты перестают действовать, решение принимает админ
+func (svc *Service) DisputeEscrow(ctx context.Context, id, userID, reason string, now time.Time) (storage.Escrow, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return storage.Escrow{}, invalidInputf("reason is required")
+	}
+	if _, err := svc.escrowParty(ctx, id, userID, false); err != nil {
+		return storage.Escrow{}, err
+	}
+	e, err := svc.UpdateEscrow(ctx, id, func(e *storage.Escrow) error {
+		if e.Status != storage.EscrowFunded && e.Status != storage.EscrowFulfilled {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("escrow %s is %s", id, e.Status)}
+		}
+		e.Status = storage.EscrowDisputed
+		e.DisputeReason = reason
+		e.DisputedAt = &now
+		return nil
+	})
+	if err != nil {
+		return storage.Escrow{}, err
+	}
+	svc.auditEscrow(ctx, e.BuyerUserID, "escrow.dispute", e, now)
+	log.Printf("Escrow %s disputed: %s", e.ID, reason)
+	return e, nil
+}
+
+// ResolveEscrowDispute — решение админа по спору: release выплачивает продавцу, иначе деньги возвращаются покупателю
+func (svc *Service) ResolveEscrowDispute(ctx context.Context, id string, release bool, resolution string, now time.Time) (storage.Escrow, error) {
+	resolution = strings.TrimSpace(resolution)
+	if resolution == "" {
+		return storage.Escrow{}, invalidInputf("resolution is required")
+	}
+	action := "escrow.dispute_refund"
+	if release {
+		action = "escrow.dispute_release"
+	}
+	return svc.settleEscrow(ctx, id, release, []string{storage.EscrowDisputed}, resolution, action, now)
+}
+
+func (svc *Service) settleEscrow(ctx context.Context, id string, release bool, from []string, resolution, action string, now time.Time) (storage.Escrow, error) {
+	e, err := svc.SettleEscrow(ctx, id, release, from, storage.Transaction{ID: storage.GenerateID(), Timestamp: now}, resolution, now)
+	if err != nil {
+		return storage.Escrow{}, err
+	}
+	actor := "admin"
+	switch action {
+	case "escrow.release":
+		actor = e.BuyerUserID
+	case "escrow.timeout_release", "escrow.timeout_refund":
+		actor = "system"
+	}
+	svc.auditEscrow(ctx, actor, action, e, now)
+	if release {
+		svc.PublishBalanceChanged(ctx, e.SellerAccountID)
+	} else {
+		svc.PublishBalanceChanged(ctx, e.BuyerAccountID)
+	}
+	log.Printf("Escrow %s %s (transaction %s)", e.ID, e.Status, e.SettleTxID)
+	return e, nil
+}
+
+// runEscrowTimeouts закрывает сделки с истёкшим сроком: неисполненные возвращаются покупателю,
+// исполненные без реакции покупателя выплачиваются продавцу
+func (svc *Service) runEscrowTimeouts(ctx context.Context, now time.Time) {
+	for _, e := range svc.DueEscrows(ctx, now) {
+		release := e.Status == storage.EscrowFulfilled
+		action := "escrow.timeout_refund"
+		if release {
+			action = "escrow.timeout_release"
+		}
+		if _, err := svc.settleEscrow(ctx, e.ID, release, []string{e.Status}, "timeout", action, now); err != nil {
+			log.Printf("Escrow %s timeout: %v", e.ID, err)
+		}
+	}
+}
+
+func (svc *Service) StartEscrowTimeoutJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				svc.runEscrowTimeouts(ctx, now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const subscriberBuffer = 64
+
+// EventBus — внутренняя шина событий: подписка по пользователю, публикация без блокировки
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan storage.Event]struct{} // key: UserID
+	global      []chan storage.Event                       // получают события всех пользователей
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[string]map[chan storage.Event]struct{})}
+}
+
+// SubscribeAll — подписка внутренних обработчиков (вебхуки) на все события шины
+func (b *EventBus) SubscribeAll(buffer int) <-chan storage.Event {
+	ch := make(chan storage.Event, buffer)
+	b.mu.Lock()
+	b.global = append(b.global, ch)
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *EventBus) Subscribe(userID string) (<-chan storage.Event, func()) {
+	ch := make(chan storage.Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan storage.Event]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[userID][ch]; ok {
+			delete(b.subscribers[userID], ch)
+			close(ch)
+		}
+		if len(b.subscribers[userID]) == 0 {
+			delete(b.subscribers, userID)
+		}
+	}
+	return ch, unsubscribe
+}
+
+func (b *EventBus) Publish(event storage.Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.global {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Event bus: global subscriber buffer full, dropping %s", event.Type)
+		}
+	}
+	for ch := range b.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Event bus: subscriber buffer full, dropping %s for user %s", event.Type, event.UserID)
+		}
+	}
+}
+
+func (svc *Service) PublishBalanceChanged(ctx context.Context, accountID string) {
+	acc, ok := svc.GetAccount(ctx, accountID)
+	if !ok {
+		return
+	}
+	svc.events.Publish(storage.Event{
+		Type:      storage.EventBalanceChanged,
+		UserID:    acc.UserID,
+		AccountID: acc.ID,
+		Payload: map[string]interface{}{
+			"balance":  acc.Balance,
+			"currency": acc.Currency,
+		},
+	})
+}
+
+func (svc *Service) PublishCardPayment(account storage.Account, card storage.Card, amount decimal.Decimal, merchant string) {
+	svc.events.Publish(storage.Event{
+		Type:      storage.EventCardPayment,
+		UserID:    account.UserID,
+		AccountID: account.ID,
+		Payload: map[string]interface{}{
+			"card_id":  card.ID,
+			"amount":   amount,
+			"merchant": merchant,
+		},
+	})
+}
+
+const loanDueNoticeWindow = 3 * 24 * time.Hour
+
+// runLoanDueNotifications публикует события о неоплаченных платежах, срок которых наступает в ближайшие дни
+func (svc *Service) runLoanDueNotifications(ctx context.Context, now time.Time) {
+	for _, loan := range svc.ListLoans(ctx) {
+		for _, payment := range loan.PaymentSchedule {
+			if payment.Paid || payment.DueDate.Before(now) || payment.DueDate.Sub(now) > loanDueNoticeWindow {
+				continue
+			}
+			svc.events.Publish(storage.Event{
+				Type:      storage.EventLoanPaymentDue,
+				UserID:    loan.UserID,
+				AccountID: loan.AccountID,
+				Payload: map[string]interface{}{
+					"loan_id":  loan.ID,
+					"due_date": payment.DueDate,
+					"amount":   payment.Amount,
+				},
+			})
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var FraudConfig = struct {
+	URL          string        // адрес внешнего скоринга; пусто — оценка только правилами
+	Timeout      time.Duration // сколько ждём внешний сервис, прежде чем перейти на правила
+	DeclineScore int           // с этой оценки авторизация отклоняется
+}{
+	URL:          EnvOrDefault("BANKAPP_FRAUD_URL", ""),
+	Timeout:      300 * time.Millisecond,
+	DeclineScore: 80,
+}
+
+// FraudRequest — данные авторизации, которые видит скоринг
+type FraudRequest struct {
+	UserID     string          `json:"user_id"`
+	AccountID  string          `json:"account_id"`
+	CardID     string          `json:"card_id"`
+	Amount     decimal.Decimal `json:"amount"`
+	Currency   string          `json:"currency"`
+	Merchant   string          `json:"merchant"`
+	MerchantID string          `json:"merchant_id,omitempty"`
+	Category   string          `json:"category,omitempty"`
+	Time       time.Time       `json:"time"`
+}
+
+// FraudScorer оценивает риск авторизации от 0 до 100. Реализация должна уважать дедлайн ctx.
+type FraudScorer interface {
+	Score(ctx context.Context, req FraudRequest) (score int, reasons []string, err error)
+}
+
+// HTTPFraudScorer вызывает внешний ML-сервис: POST FraudRequest, ответ {"score": 0..100, "reasons": [...]}
+type HTTPFraudScorer struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewHTTPFraudScorer(url string) *HTTPFraudScorer {
+	return &HTTPFraudScorer{URL: url, Client: &http.Client{}}
+}
+
+func (s *HTTPFraudScorer) Score(ctx context.Context, req FraudRequest) (int, []string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(httpReq)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, fmt.Errorf("fraud scorer returned %s", resp.Status)
+	}
+	var result struct {
+		Score   *int     `json:"score"`
+		Reasons []string `json:"reasons"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, nil, fmt.Errorf("decode fraud score: %w", err)
+	}
+	if result.Score == nil || *result.Score < 0 || *result.Score > 100 {
+		return 0, nil, fmt.Errorf("fraud scorer returned no score in range 0..100")
+	}
+	return *result.Score, result.Reasons, nil
+}
+
+const (
+	fraudVelocityWindow = time.Hour
+	fraudVelocityMax    = 5
+	fraudHistoryWindow  = 30 * 24 * time.Hour
+	fraudNewCardAge     = 24 * time.Hour
+)
+
+// scoreByRules — запасная оценка на правилах по истории счёта: сумма против обычного чека, частота оплат,
+// ночное время, свежевыпущенная карта и незнакомый мерчант
+func (svc *Service) scoreByRules(ctx context.Context, req FraudRequest) (int, []string) {
+	score := 0
+	var reasons []string
+	add := func(points int, reason string) {
+		score += points
+		reasons = append(reasons, reason)
+	}
+
+	var count, recent int
+	total := decimal.Zero
+	knownMerchant := false
+	for _, tx := range svc.GetAccountTransactions(ctx, req.AccountID) {
+		if tx.FromAccountID != req.AccountID || tx.TransactionType != "payment" || req.Time.Sub(tx.Timestamp) > fraudHistoryWindow {
+			continue
+		}
+		count++
+		total = total.Add(tx.Amount)
+		if req.Time.Sub(tx.Timestamp) <= fraudVelocityWindow {
+			recent++
+		}
+		if strings.EqualFold(tx.Merchant, req.Merchant) {
+			knownMerchant = true
+		}
+	}
+
+	if count > 0 {
+		average := total.Div(decimal.NewFromInt(int64(count)))
+		switch {
+		case req.Amount.GreaterThan(average.Mul(decimal.NewFromInt(10))):
+			add(45, "amount is more than 10x the usual payment")
+		case req.Amount.GreaterThan(average.Mul(decimal.NewFromInt(3))):
+			add(20, "amount is more than 3x the usual payment")
+		}
+	} else if req.Amount.GreaterThan(decimal.NewFromInt(50000)) {
+		add(25, "large first payment")
+	}
+	if recent >= fraudVelocityMax {
+		add(30, fmt.Sprintf("%d payments in the last hour", recent))
+	}
+	if h := req.Time.Hour(); h < 5 {
+		add(10, "night-time payment")
+	}
+	if card, ok := svc.GetCard(ctx, req.CardID); ok && req.Time.Sub(card.CreatedAt) < fraudNewCardAge {
+		add(15, "card issued less than a day ago")
+	}
+	if count > 0 && !knownMerchant && req.Merchant != "" {
+		add(5, "first payment to this merchant")
+	}
+	if score > 100 {
+		score = 100
+	}
+	return score, reasons
+}
+
+// AssessPayment оценивает авторизацию: сначала внешний скоринг с таймаутом, при ошибке — правила.
+// Оценку сохраняют на холде и транзакции; Declined означает, что платёж нужно отклонить.
+func (svc *Service) AssessPayment(ctx context.Context, req FraudRequest) storage.FraudAssessment {
+	assessment := storage.FraudAssessment{AssessedAt: req.Time}
+	scored := false
+	if svc.fraud != nil {
+		scoreCtx, cancel := context.WithTimeout(ctx, FraudConfig.Timeout)
+		score, reasons, err := svc.fraud.Score(scoreCtx, req)
+		cancel()
+		if err != nil {
+			log.Printf("Fraud scorer unavailable, falling back to rules: %v", err)
+		} else {
+			assessment.Score, assessment.Reasons, assessment.Provider = score, reasons, storage.FraudProviderExternal
+			scored = true
+		}
+	}
+	if !scored {
+		assessment.Score, assessment.Reasons = svc.scoreByRules(ctx, req)
+		assessment.Provider = storage.FraudProviderRules
+	}
+	assessment.Declined = assessment.Score >= FraudConfig.DeclineScore
+	if assessment.Declined {
+		metrics.add(metricFraudDeclines, 1, "provider", assessment.Provider)
+	}
+	return assessment
+}
+
+func FraudDeclinedError(a storage.FraudAssessment) error {
+	return &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeFraudSuspected, Message: fmt.Sprintf("payment declined by fraud checks (score %d)", a.Score)}
+}
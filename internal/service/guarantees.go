@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var LoanGuaranteeConfig = struct {
+	ResponseWindow time.Duration // столько поручитель может думать над заявкой
+}{
+	ResponseWindow: 7 * 24 * time.Hour,
+}
+
+func (svc *Service) auditLoanApplication(ctx context.Context, actor, action string, app storage.LoanApplication, now time.Time) {
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    action,
+		Details:   map[string]string{"loan_id": app.ID, "user_id": app.UserID, "guarantor_user_id": app.GuarantorUserID, "amount": app.Amount.String()},
+	})
+}
+
+// RequestLoanGuarantee откладывает выдачу одобренного кредита до согласия поручителя: сохраняет заявку
+// и пишет поручителю. Поручителем не может быть сам заёмщик.
+func (svc *Service) RequestLoanGuarantee(ctx context.Context, app storage.LoanApplication, now time.Time) (storage.LoanApplication, error) {
+	if app.GuarantorUserID == app.UserID {
+		return storage.LoanApplication{}, invalidInputf("borrower cannot be their own guarantor")
+	}
+	guarantor, ok := svc.GetUser(ctx, app.GuarantorUserID)
+	if !ok {
+		return storage.LoanApplication{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeUserNotFound, Message: fmt.Sprintf("guarantor %s not found", app.GuarantorUserID)}
+	}
+	app.ID = storage.GenerateID()
+	app.Status = storage.LoanApplicationPending
+	app.CreatedAt = now
+	app.ExpiresAt = now.Add(LoanGuaranteeConfig.ResponseWindow)
+	if err := svc.AddLoanApplication(ctx, app); err != nil {
+		return storage.LoanApplication{}, err
+	}
+	svc.auditLoanApplication(ctx, app.UserID, "loan.guarantee_requested", app, now)
+
+	borrower := app.UserID
+	if user, ok := svc.GetUser(ctx, app.UserID); ok {
+		borrower = user.Username
+	}
+	svc.QueueEmail(ctx, guarantor.Email, "Simple Bank: you are asked to guarantee a loan",
+		fmt.Sprintf("Hello %s,\n\n%s asks you to guarantee a loan of %s %s for %d months. If the borrower does not pay, "+
+			"you will be liable for the debt.\nAccept or decline the request %s before %s.",
+			guarantor.Username, borrower, app.Amount.StringFixed(2), app.Currency, app.TermMonths, app.ID, app.ExpiresAt.Format("02.01.2006 15:04")))
+	log.Printf("Loan %s for user %s awaits guarantee by %s", app.ID, app.UserID, app.GuarantorUserID)
+	return app, nil
+}
+
+// pendingLoanApplication — заявка, на которую ещё можно ответить. Истёкшая заявка закрывается при первом обращении.
+// userID, если задан, должен быть поручителем: чужая заявка отдаётся как не найденная.
+func (svc *Service) pendingLoanApplication(ctx context.Context, id, userID string, now time.Time) (storage.LoanApplication, error) {
+	app, ok := svc.GetLoanApplication(ctx, id)
+	if !ok || (userID != "" && app.GuarantorUserID != userID) {
+		return storage.LoanApplication{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeLoanNotFound, Message: fmt.Sprintf("loan %s not found", id)}
+	}
+	if app.Status == storage.LoanApplicationPending && now.After(app.ExpiresAt) {
+		app, _ = svc.UpdateLoanApplication(ctx, id, func(a *storage.LoanApplication) error {
+			if a.Status == storage.LoanApplicationPending {
+				a.Status = storage.LoanApplicationExpired
+				a.DecidedAt = &now
+			}
+			return nil
+		})
+	}
+	if app.Status != storage.LoanApplicationPending {
+		return storage.LoanApplication{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan application %s is %s", id, app.Status)}
+	}
+	return app, nil
+}
+
+// guaranteeLiability — непогашенный долг в рублях по кредитам, где пользователь поручитель, и сколько из них в просрочке
+func (svc *Service) guaranteeLiability(ctx context.Context, userID string, now time.Time) (decimal.Decimal, int, error) {
+	total := decimal.Zero
+	overdue := 0
+	for _, loan := range svc.GetGuaranteedLoans(ctx, userID) {
+		if !loan.RemainingAmount.IsPositive() {
+			continue
+		}
+		acc, ok := svc.GetAccount(ctx, loan.AccountID)
+		if !ok {
+			continue
+		}
+		amount, err := svc.toBaseCurrency(ctx, loan.RemainingAmount, acc.Currency)
+		if err != nil {
+			return decimal.Zero, 0, err
+		}
+		total = total.Add(amount)
+		if accrueLoan(loan, now).Status != storage.LoanCurrent {
+			overdue++
+		}
+	}
+	return total, overdue, nil
+}
+
+// AcceptLoanGuarantee — поручитель соглашается, и кредит выдаётся по условиям заявки. Поручитель проходит KYC,
+// а сумма кредита вместе с уже взятыми поручительствами должна укладываться в лимит его кредитного грейда.
+func (svc *Service) AcceptLoanGuarantee(ctx context.Context, id, userID string, now time.Time) (storage.Loan, error) {
+	app, err := svc.pendingLoanApplication(ctx, id, userID, now)
+	if err != nil {
+		return storage.Loan{}, err
+	}
+	guarantor, ok := svc.GetUser(ctx, app.GuarantorUserID)
+	if !ok {
+		return storage.Loan{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeUserNotFound, Message: fmt.Sprintf("guarantor %s not found", app.GuarantorUserID)}
+	}
+	if err := svc.RequireKYCForLoan(guarantor); err != nil {
+		return storage.Loan{}, err
+	}
+	liability, _, err := svc.guaranteeLiability(ctx, guarantor.ID, now)
+	if err != nil {
+		return storage.Loan{}, err
+	}
+	score, err := svc.RefreshCreditScore(ctx, guarantor.ID, now)
+	if err != nil {
+		return storage.Loan{}, err
+	}
+	amount, err := svc.toBaseCurrency(ctx, app.Amount, app.Currency)
+	if err != nil {
+		return storage.Loan{}, err
+	}
+	if amount.Add(liability).GreaterThan(score.MaxLoanAmount) {
+		return storage.Loan{}, &storage.StorageError{
+			Kind:    storage.ErrQuotaExceeded,
+			Code:    storage.CodeCreditDeclined,
+			Message: fmt.Sprintf("guarantees would exceed the limit of %s %s for credit grade %s", score.MaxLoanAmount.String(), storage.BaseCurrency, score.Grade),
+		}
+	}
+
+	// Заявка переходит в accepted до выдачи, чтобы повторное согласие не выдало кредит дважды
+	if _, err := svc.UpdateLoanApplication(ctx, id, func(a *storage.LoanApplication) error {
+		if a.Status != storage.LoanApplicationPending {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan application %s is %s", id, a.Status)}
+		}
+		a.Status = storage.LoanApplicationAccepted
+		a.DecidedAt = &now
+		return nil
+	}); err != nil {
+		return storage.Loan{}, err
+	}
+	reopen := func() {
+		svc.UpdateLoanApplication(ctx, id, func(a *storage.LoanApplication) error {
+			a.Status = storage.LoanApplicationPending
+			a.DecidedAt = nil
+			return nil
+		})
+	}
+
+	monthlyPayment := storage.CalculateMonthlyPayment(app.Amount, app.InterestRate, app.TermMonths)
+	loan := storage.Loan{
+		ID:              app.ID,
+		UserID:          app.UserID,
+		AccountID:       app.AccountID,
+		GuarantorUserID: app.GuarantorUserID,
+		Collateral:      PledgeCollateral(app.Collateral, now),
+		Amount:          app.Amount,
+		InterestRate:    app.InterestRate,
+		TermMonths:      app.TermMonths,
+		StartDate:       now,
+		PaymentSchedule: storage.GeneratePaymentSchedule(app.Amount, app.InterestRate, app.TermMonths, now, monthlyPayment),
+		RemainingAmount: app.Amount,
+		Status:          storage.LoanCurrent,
+		PenaltyInterest: decimal.Zero,
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpLoan, app.Amount, app.Currency, now)
+	if err != nil {
+		reopen()
+		return storage.Loan{}, err
+	}
+	if _, err := svc.DisburseLoan(ctx, loan, now); err != nil {
+		release()
+		reopen()
+		return storage.Loan{}, err
+	}
+	svc.PublishBalanceChanged(ctx, loan.AccountID)
+	svc.auditLoanApplication(ctx, guarantor.ID, "loan.guarantee_accepted", app, now)
+	if borrower, ok := svc.GetUser(ctx, app.UserID); ok {
+		svc.QueueEmail(ctx, borrower.Email, "Simple Bank: your loan has been disbursed",
+			fmt.Sprintf("Hello %s,\n\n%s has agreed to guarantee your loan of %s %s. The funds have been credited to your account.",
+				borrower.Username, guarantor.Username, app.Amount.StringFixed(2), app.Currency))
+	}
+	log.Printf("Loan %s guaranteed by %s and disbursed to account %s", loan.ID, guarantor.ID, loan.AccountID)
+	return loan, nil
+}
+
+// DeclineLoanGuarantee — поручитель отказывается; кредит не выдаётся, заёмщику уходит письмо
+func (svc *Service) DeclineLoanGuarantee(ctx context.Context, id, userID string, now time.Time) (storage.LoanApplication, error) {
+	if _, err := svc.pendingLoanApplication(ctx, id, userID, now); err != nil {
+		return storage.LoanApplication{}, err
+	}
+	app, err := svc.UpdateLoanApplication(ctx, id, func(a *storage.LoanApplication) error {
+		if a.Status != storage.LoanApplicationPending {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan application %s is %s", id, a.Status)}
+		}
+		a.Status = storage.LoanApplicationDeclined
+		a.DecidedAt = &now
+		return nil
+	})
+	if err != nil {
+		return storage.LoanApplication{}, err
+	}
+	svc.auditLoanApplication(ctx, app.GuarantorUserID, "loan.guarantee_declined", app, now)
+	if borrower, ok := svc.GetUser(ctx, app.UserID); ok {
+		svc.QueueEmail(ctx, borrower.Email, "Simple Bank: loan guarantee declined",
+			fmt.Sprintf("Hello %s,\n\nThe guarantor has declined your loan of %s %s, so the loan will not be disbursed.",
+				borrower.Username, app.Amount.StringFixed(2), app.Currency))
+	}
+	log.Printf("Loan application %s: guarantee declined by %s", app.ID, app.GuarantorUserID)
+	return app, nil
+}
+
+// UserGuarantees — заявки, ждущие ответа пользователя как поручителя, его собственные заявки с поручителем
+// и кредиты, по которым он отвечает, с общей суммой ответственности
+func (svc *Service) UserGuarantees(ctx context.Context, userID string, now time.Time) (storage.LoanGuarantees, error) {
+	result := storage.LoanGuarantees{
+		UserID:       userID,
+		Requests:     make([]storage.LoanApplication, 0),
+		Applications: make([]storage.LoanApplication, 0),
+		Loans:        make([]storage.LoanSummary, 0),
+		Currency:     storage.BaseCurrency,
+	}
+	for _, app := range svc.ListLoanApplications(ctx, userID, storage.LoanApplicationPending) {
+		if now.After(app.ExpiresAt) {
+			continue
+		}
+		if app.GuarantorUserID == userID {
+			result.Requests = append(result.Requests, app)
+		} else {
+			result.Applications = append(result.Applications, app)
+		}
+	}
+	for _, loan := range svc.GetGuaranteedLoans(ctx, userID) {
+		view := accrueLoan(loan, now)
+		result.Loans = append(result.Loans, storage.LoanSummary{
+			ID:                loan.ID,
+			AccountID:         loan.AccountID,
+			Amount:            loan.Amount,
+			InterestRate:      loan.InterestRate,
+			TermMonths:        loan.TermMonths,
+			StartDate:         loan.StartDate,
+			RemainingAmount:   loan.RemainingAmount,
+			Status:            view.Status,
+			Active:            loan.RemainingAmount.IsPositive(),
+			DaysPastDue:       view.DaysPastDue,
+			OverdueAmount:     view.OverdueAmount,
+			NextPaymentDate:   view.NextPaymentDate,
+			NextPaymentAmount: view.NextPaymentAmount,
+		})
+	}
+	liability, _, err := svc.guaranteeLiability(ctx, userID, now)
+	if err != nil {
+		return storage.LoanGuarantees{}, err
+	}
+	result.Liability = liability.RoundBank(2)
+	return result, nil
+}
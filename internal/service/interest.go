@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// BalanceInterestConfig — проценты на остаток текущих счетов: ключевая ставка ЦБ минус маржа банка, не ниже нуля.
+// Ставка пересчитывается перед ежедневным начислением и при открытии счёта.
+var BalanceInterestConfig = struct {
+	Products      []string
+	KeyRateMargin decimal.Decimal
+}{
+	Products:      []string{storage.ProductChecking},
+	KeyRateMargin: marginFromEnv("BANKAPP_BALANCE_INTEREST_MARGIN", decimal.NewFromInt(12)),
+}
+
+func marginFromEnv(key string, fallback decimal.Decimal) decimal.Decimal {
+	margin, err := decimal.NewFromString(EnvOrDefault(key, fallback.String()))
+	if err != nil || margin.IsNegative() {
+		log.Printf("Invalid %s, using %s", key, fallback)
+		return fallback
+	}
+	return margin
+}
+
+func hasFloatingRate(productCode string) bool {
+	for _, code := range BalanceInterestConfig.Products {
+		if code == productCode {
+			return true
+		}
+	}
+	return false
+}
+
+// BalanceInterestRate — текущая плавающая ставка для продукта; false, если ставка продукта фиксированная
+func (svc *Service) BalanceInterestRate(ctx context.Context, productCode string) (decimal.Decimal, bool) {
+	if !hasFloatingRate(productCode) {
+		return decimal.Zero, false
+	}
+	keyRate, err := svc.GetCBRKeyRate(ctx)
+	if err != nil {
+		log.Printf("Balance interest: key rate unavailable: %v", err)
+		return decimal.Zero, false
+	}
+	return decimal.Max(keyRate.Sub(BalanceInterestConfig.KeyRateMargin), decimal.Zero), true
+}
+
+// refreshFloatingRates переносит текущую плавающую ставку на счета, чтобы начисление шло по ней
+func (svc *Service) refreshFloatingRates(ctx context.Context, accounts []storage.Account) {
+	rates := make(map[string]decimal.Decimal)
+	for i, acc := range accounts {
+		rate, ok := rates[acc.ProductCode]
+		if !ok {
+			if rate, ok = svc.BalanceInterestRate(ctx, acc.ProductCode); !ok {
+				continue
+			}
+			rates[acc.ProductCode] = rate
+		}
+		if acc.IsClosed() || acc.InterestRate.Equal(rate) {
+			continue
+		}
+		if err := svc.SetAccountInterestRate(ctx, acc.ID, rate); err != nil {
+			log.Printf("Balance interest: failed to update rate of account %s: %v", acc.ID, err)
+			continue
+		}
+		accounts[i].InterestRate = rate
+	}
+}
+
+// runInterestAccrual — шаг закрытия дня: начисляет дневные проценты, а в последний день месяца проводит накопленное
+func (svc *Service) runInterestAccrual(ctx context.Context, now time.Time, step *storage.EODStep) error {
+	accounts := svc.ListAccounts(ctx)
+	svc.refreshFloatingRates(ctx, accounts)
+
+	// Шаг не прерывается на середине: повторный запуск начислил бы проценты уже обработанным счетам второй раз
+	for _, acc := range accounts {
+		if acc.IsClosed() {
+			continue
+		}
+		amount := storage.DailyAccrual(acc)
+		if amount.IsZero() {
+			continue
+		}
+		if err := svc.AccrueInterest(ctx, acc.ID, amount); err != nil {
+			log.Printf("Interest accrual failed for account %s: %v", acc.ID, err)
+			step.Failed++
+			continue
+		}
+		step.Processed++
+		addEODAmount(step, acc.Currency, amount)
+	}
+	log.Printf("Interest accrual: %d accounts accrued", step.Processed)
+
+	// Капитализация в последний день месяца
+	if now.AddDate(0, 0, 1).Day() == 1 {
+		svc.postMonthlyInterest(ctx, now, step)
+	}
+	return nil
+}
+
+func (svc *Service) postMonthlyInterest(ctx context.Context, now time.Time, step *storage.EODStep) {
+	posted := 0
+	for _, acc := range svc.ListAccounts(ctx) {
+		if acc.AccruedInterest.IsZero() {
+			continue
+		}
+		tx, ok, err := svc.PostAccruedInterest(ctx, acc.ID, now)
+		if err != nil {
+			log.Printf("Interest posting failed for account %s: %v", acc.ID, err)
+			step.Failed++
+			continue
+		}
+		if ok {
+			posted++
+			log.Printf("Posted %s %s %s for account %s", tx.TransactionType, tx.Amount.String(), acc.Currency, acc.ID)
+		}
+	}
+	log.Printf("Monthly interest posting: %d transactions", posted)
+}
+
+// UserInterest — проценты по счетам пользователя для финансовой сводки; счета без ставки и начислений пропускаются
+func (svc *Service) UserInterest(ctx context.Context, userID string, now time.Time) []storage.AccountInterest {
+	result := make([]storage.AccountInterest, 0)
+	for _, acc := range svc.GetUserAccounts(ctx, userID) {
+		item := storage.AccountInterest{
+			AccountID:        acc.ID,
+			Currency:         acc.Currency,
+			Rate:             acc.InterestRate,
+			Floating:         hasFloatingRate(acc.ProductCode),
+			Accrued:          acc.AccruedInterest,
+			CreditedThisYear: decimal.Zero,
+		}
+		for _, tx := range svc.GetAccountTransactions(ctx, acc.ID) {
+			if tx.TransactionType == "interest" && tx.ToAccountID == acc.ID && tx.EffectiveDate().Year() == now.Year() {
+				item.CreditedThisYear = item.CreditedThisYear.Add(tx.Amount)
+			}
+		}
+		if item.Rate.IsZero() && item.Accrued.IsZero() && item.CreditedThisYear.IsZero() {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var InvoiceConfig = struct {
+	PublicURL      string        // адрес API для платёжных ссылок
+	DefaultTTL     time.Duration // срок счёта, если клиент его не указал
+	MaxTTL         time.Duration
+	MaxDescription int
+}{
+	PublicURL:      strings.TrimSuffix(EnvOrDefault("BANKAPP_PUBLIC_URL", "http://localhost:8080"), "/"),
+	DefaultTTL:     7 * 24 * time.Hour,
+	MaxTTL:         90 * 24 * time.Hour,
+	MaxDescription: 140,
+}
+
+// InvoiceStatusUnpaid — фильтр списка: открытые и просроченные счета
+const InvoiceStatusUnpaid = "unpaid"
+
+func invoicePaymentLink(id string) string {
+	return InvoiceConfig.PublicURL + "/v1/invoices/" + id
+}
+
+// CreateInvoice выставляет счёт на оплату на открытый счёт пользователя и выдаёт ссылку для плательщика
+func (svc *Service) CreateInvoice(ctx context.Context, req storage.CreateInvoiceRequest, now time.Time) (storage.Invoice, error) {
+	account, ok := svc.GetAccount(ctx, req.AccountID)
+	if !ok {
+		return storage.Invoice{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("account %s not found", req.AccountID)}
+	}
+	if account.IsClosed() {
+		return storage.Invoice{}, &storage.StorageError{Kind: storage.ErrConflict, Code: storage.CodeAccountClosed, Message: fmt.Sprintf("account %s is closed", account.ID)}
+	}
+	if !req.Amount.IsPositive() {
+		return storage.Invoice{}, invalidInputf("invoice amount must be positive")
+	}
+	if err := storage.ValidateAmount(req.Amount, account.Currency); err != nil {
+		return storage.Invoice{}, err
+	}
+	description := strings.TrimSpace(req.Description)
+	if len([]rune(description)) > InvoiceConfig.MaxDescription {
+		return storage.Invoice{}, invalidInputf("description must be at most %d characters", InvoiceConfig.MaxDescription)
+	}
+
+	expiresAt := now.Add(InvoiceConfig.DefaultTTL)
+	switch {
+	case req.ExpiresAt != nil:
+		expiresAt = *req.ExpiresAt
+	case req.ExpiresInHours < 0:
+		return storage.Invoice{}, invalidInputf("expires_in_hours must be positive")
+	case req.ExpiresInHours > 0:
+		expiresAt = now.Add(time.Duration(req.ExpiresInHours) * time.Hour)
+	}
+	if !expiresAt.After(now) || expiresAt.Sub(now) > InvoiceConfig.MaxTTL {
+		return storage.Invoice{}, invalidInputf("invoice must expire in the future and within %d days", int(InvoiceConfig.MaxTTL.Hours()/24))
+	}
+
+	inv := storage.Invoice{
+		ID:           storage.GenerateID(),
+		IssuerUserID: account.UserID,
+		AccountID:    account.ID,
+		Amount:       storage.NormalizeAmount(req.Amount, account.Currency),
+		Currency:     account.Currency,
+		Description:  description,
+		Status:       storage.InvoiceOpen,
+		ExpiresAt:    expiresAt,
+		CreatedAt:    now,
+	}
+	inv.PaymentLink = invoicePaymentLink(inv.ID)
+	if err := svc.AddInvoice(ctx, inv); err != nil {
+		return storage.Invoice{}, err
+	}
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     inv.IssuerUserID,
+		Action:    "invoice.create",
+		Details:   map[string]string{"invoice_id": inv.ID, "account_id": inv.AccountID, "amount": inv.Amount.String()},
+	})
+	log.Printf("Invoice %s for %s %s issued to account %s", inv.ID, inv.Amount.String(), inv.Currency, inv.AccountID)
+	return inv, nil
+}
+
+// InvoiceView — данные счёта для плательщика: имя получателя замаскировано, счёт зачисления скрыт
+func (svc *Service) InvoiceView(ctx context.Context, id string, now time.Time) (storage.InvoiceView, error) {
+	inv, ok := svc.GetInvoice(ctx, id)
+	if !ok {
+		return storage.InvoiceView{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeInvoiceNotFound, Message: fmt.Sprintf("invoice %s not found", id)}
+	}
+	issuer, _ := svc.GetUser(ctx, inv.IssuerUserID)
+	payee := issuer.Username
+	if issuer.Profile != nil && issuer.Profile.FullName != "" {
+		payee = issuer.Profile.FullName
+	}
+	return storage.InvoiceView{
+		ID:          inv.ID,
+		PayeeName:   storage.MaskName(payee),
+		Amount:      inv.Amount,
+		Currency:    inv.Currency,
+		Description: inv.Description,
+		Status:      inv.StatusAt(now),
+		ExpiresAt:   inv.ExpiresAt,
+	}, nil
+}
+
+// PayInvoice оплачивает счёт со счёта плательщика userID; лимиты и подпись устройства проверяются как у обычного
+// перевода, получатель в подписи — номер счёта на оплату
+func (svc *Service) PayInvoice(ctx context.Context, id, userID string, req storage.PayInvoiceRequest, sig storage.DeviceSignature, now time.Time) (storage.Invoice, storage.Transaction, error) {
+	inv, ok := svc.GetInvoice(ctx, id)
+	if !ok {
+		return storage.Invoice{}, storage.Transaction{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeInvoiceNotFound, Message: fmt.Sprintf("invoice %s not found", id)}
+	}
+	from, ok := svc.GetAccount(ctx, req.FromAccountID)
+	if !ok {
+		return storage.Invoice{}, storage.Transaction{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("source account %s not found", req.FromAccountID)}
+	}
+	if err := svc.AuthorizeDebit(ctx, from, userID, inv.Amount); err != nil {
+		return storage.Invoice{}, storage.Transaction{}, err
+	}
+	if status := inv.StatusAt(now); status == storage.InvoiceOpen {
+		releaseLimit, err := svc.ReserveTransferLimit(ctx, from, inv.Amount, now)
+		if err != nil {
+			return storage.Invoice{}, storage.Transaction{}, err
+		}
+		defer releaseLimit()
+		var to *storage.Account
+		if acc, ok := svc.GetAccount(ctx, inv.AccountID); ok {
+			to = &acc
+		}
+		if err := svc.CheckTierLimits(ctx, &from, to, inv.Amount, now); err != nil {
+			return storage.Invoice{}, storage.Transaction{}, err
+		}
+	}
+	deviceKey, err := svc.RequireTransferSignature(ctx, from, inv.ID, inv.Amount, sig, now)
+	if err != nil {
+		return storage.Invoice{}, storage.Transaction{}, err
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpInvoicePayment, inv.Amount, inv.Currency, now)
+	if err != nil {
+		return storage.Invoice{}, storage.Transaction{}, err
+	}
+
+	inv, tx, err := svc.Repository.PayInvoice(ctx, id, from.ID, storage.Transaction{ID: storage.GenerateID(), Timestamp: now}, now)
+	if err != nil {
+		release()
+		return storage.Invoice{}, storage.Transaction{}, err
+	}
+	if deviceKey != nil {
+		svc.AuditSignedTransfer(ctx, *deviceKey, tx.ID, sig, from, inv.ID, inv.Amount, now)
+	}
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     userID,
+		Action:    "invoice.pay",
+		Details:   map[string]string{"invoice_id": inv.ID, "from_account_id": from.ID, "transaction_id": tx.ID, "amount": inv.Amount.String()},
+	})
+	if issuer, ok := svc.GetUser(ctx, inv.IssuerUserID); ok {
+		body := fmt.Sprintf("Hello %s,\n\nYour invoice %s for %s %s has been paid.", issuer.Username, inv.ID, inv.Amount.StringFixed(2), inv.Currency)
+		svc.QueueEmail(ctx, issuer.Email, "Simple Bank: invoice paid", body)
+	}
+	log.Printf("Invoice %s paid from account %s (transaction %s)", inv.ID, from.ID, tx.ID)
+	return inv, tx, nil
+}
+
+// CancelInvoice отзывает неоплаченный счёт; ссылка после этого перестаёт принимать оплату
+func (svc *Service) CancelInvoice(ctx context.Context, id, userID string, now time.Time) (storage.Invoice, error) {
+	inv, err := svc.Repository.CancelInvoice(ctx, id, userID, now)
+	if err != nil {
+		return storage.Invoice{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     inv.IssuerUserID,
+		Action:    "invoice.cancel",
+		Details:   map[string]string{"invoice_id": inv.ID},
+	})
+	return inv, nil
+}
+
+// UserInvoices — выставленные пользователем счета со статусом на момент now; status=unpaid отбирает открытые и просроченные
+func (svc *Service) UserInvoices(ctx context.Context, userID, status string, now time.Time) ([]storage.Invoice, error) {
+	switch status {
+	case "", InvoiceStatusUnpaid, storage.InvoiceOpen, storage.InvoicePaid, storage.InvoiceExpired, storage.InvoiceCancelled:
+	default:
+		return nil, invalidInputf("status must be one of open, paid, expired, cancelled, unpaid")
+	}
+	result := make([]storage.Invoice, 0)
+	for _, inv := range svc.ListInvoices(ctx, userID) {
+		inv.Status = inv.StatusAt(now)
+		switch {
+		case status == "", inv.Status == status:
+		case status == InvoiceStatusUnpaid && (inv.Status == storage.InvoiceOpen || inv.Status == storage.InvoiceExpired):
+		default:
+			continue
+		}
+		result = append(result, inv)
+	}
+	return result, nil
+}
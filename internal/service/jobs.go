@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const (
+	reconciliationInterval  = 10 * time.Minute
+	endOfDayHour            = 23
+	loanDueNotificationHour = 9
+	creditScoringHour       = 1  // после вечернего начисления пеней
+	rateFetchHour           = 16 // ЦБ публикует курсы на следующий день после 15:30 МСК
+)
+
+// StartBackgroundJobs запускает все фоновые задачи; они завершаются с отменой ctx
+func (svc *Service) StartBackgroundJobs(ctx context.Context) {
+	svc.StartReconciliationJob(ctx, reconciliationInterval)
+	svc.StartWebhookDispatcher(ctx)
+	svc.StartAutoTransferEngine(ctx)
+	svc.StartAlertEngine(ctx)
+	svc.StartHoldExpiryJob(ctx, HoldConfig.SweepInterval)
+	svc.StartRetentionJob(ctx, retentionInterval)
+	svc.StartBroadcastDispatcher(ctx)
+	svc.StartEscrowTimeoutJob(ctx, EscrowConfig.SweepInterval)
+	svc.StartConfirmationCleanupJob(ctx, ConfirmationCleanupConfig.Interval)
+	svc.StartEmailRetryJob(ctx, EmailQueueConfig.Interval)
+	svc.StartExternalSyncJob(ctx, AggregationConfig.SyncInterval)
+	StartDailyJob(ctx, "rate-fetch", rateFetchHour, svc.runRateFetch)
+	StartDailyJob(ctx, "fx-sweep", endOfDayHour, svc.runFXSweep)
+	StartDailyJob(ctx, "end-of-day", endOfDayHour, svc.runEndOfDay)
+	StartDailyJob(ctx, "loan-due-notifications", loanDueNotificationHour, svc.runLoanDueNotifications)
+	StartDailyJob(ctx, "credit-scoring", creditScoringHour, svc.runCreditScoring)
+	StartDailyJob(ctx, "digests", digestHour, svc.runDigests)
+}
+
+func (svc *Service) StartReconciliationJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				svc.runReconciliation(ctx)
+			}
+		}
+	}()
+}
+
+// StartDailyJob запускает fn каждый день в указанный час по локальному времени сервера
+func StartDailyJob(ctx context.Context, name string, hour int, fn func(ctx context.Context, now time.Time)) {
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			log.Printf("Running daily job %s", name)
+			observeDailyJob(ctx, name, next, fn)
+		}
+	}()
+}
+
+// runFXSweep конвертирует превышение порога на валютных счетах в валюту целевого счёта по курсу дня
+func (svc *Service) runFXSweep(ctx context.Context, now time.Time) {
+	for _, rule := range svc.ListFXSweepRules(ctx) {
+		target, ok := svc.GetAccount(ctx, rule.TargetAccountID)
+		if !ok {
+			log.Printf("FX sweep: target account %s for user %s not found", rule.TargetAccountID, rule.UserID)
+			continue
+		}
+		for _, acc := range svc.GetUserAccounts(ctx, rule.UserID) {
+			if acc.ID == target.ID || acc.Currency == target.Currency || !acc.Balance.GreaterThan(rule.Threshold) {
+				continue
+			}
+			if err := svc.sweepAccount(ctx, acc, target, acc.Balance.Sub(rule.Threshold), now); err != nil {
+				log.Printf("FX sweep: failed for account %s: %v", acc.ID, err)
+			}
+		}
+	}
+}
+
+func (svc *Service) sweepAccount(ctx context.Context, from, to storage.Account, excess decimal.Decimal, now time.Time) error {
+	rate, credited, err := svc.QuoteExchange(ctx, from.Currency, to.Currency, excess)
+	if err != nil {
+		return err
+	}
+	outTx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		FromAccountID:   from.ID,
+		Amount:          excess,
+		Timestamp:       now,
+		TransactionType: "fx_sweep_out",
+	}
+	outTx.Describe(storage.DescFXSweepOut, map[string]string{
+		"amount": excess.String(), "from_currency": from.Currency, "to_currency": to.Currency, "rate": rate.String(),
+	})
+	inTx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		ToAccountID:     to.ID,
+		Amount:          credited,
+		Timestamp:       now,
+		TransactionType: "fx_sweep_in",
+	}
+	inTx.Describe(storage.DescFXSweepIn, map[string]string{"from": from.Number})
+	outTx.LinkedTxID = inTx.ID
+	inTx.LinkedTxID = outTx.ID
+
+	if err := svc.ExchangeFunds(ctx, outTx, inTx, excess, credited); err != nil {
+		return err
+	}
+	log.Printf("FX sweep: moved %s %s from %s to %s as %s %s", excess.String(), from.Currency, from.ID, to.ID, credited.String(), to.Currency)
+	return nil
+}
+
+var HoldConfig = struct {
+	TTL           time.Duration
+	SweepInterval time.Duration
+}{
+	TTL:           7 * 24 * time.Hour,
+	SweepInterval: time.Minute,
+}
+
+func (svc *Service) StartHoldExpiryJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				svc.expireHolds(ctx, now)
+			}
+		}
+	}()
+}
+
+// expireHolds снимает просроченные авторизации и сообщает о них владельцу счёта и мерчанту
+func (svc *Service) expireHolds(ctx context.Context, now time.Time) []storage.Hold {
+	expired := svc.ExpireHolds(ctx, now)
+	for _, hold := range expired {
+		log.Printf("Authorization %s expired, %s released on account %s", hold.ID, hold.Amount.String(), hold.AccountID)
+		svc.PublishBalanceChanged(ctx, hold.AccountID)
+		svc.NotifyHoldEvent(ctx, storage.ChargeVoided, hold)
+	}
+	return expired
+}
+
+func (svc *Service) runReconciliation(ctx context.Context) {
+	mismatched := svc.ReconcileUserSummaries(ctx)
+	metrics.set(metricReconcileMismatches, float64(len(mismatched)))
+	metrics.add(metricReconcileCorrections, float64(len(mismatched)))
+	if len(mismatched) > 0 {
+		log.Printf("Reconciliation: corrected financial summary cache for %d users: %v", len(mismatched), mismatched)
+		return
+	}
+	log.Println("Reconciliation: financial summary cache is consistent")
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var KYCPolicy = struct {
+	RequireForLoans        bool
+	LargeTransferThreshold decimal.Decimal // переводы выше этой суммы (в валюте счёта) только после верификации
+	MinAge                 int             // с этого возраста принимаем анкету (паспорт РФ)
+}{
+	RequireForLoans:        true,
+	LargeTransferThreshold: decimal.NewFromInt(100000),
+	MinAge:                 14,
+}
+
+func kycRequiredf(format string, args ...interface{}) error {
+	return &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeKYCRequired, Message: fmt.Sprintf(format, args...)}
+}
+
+// UpdateProfile частично обновляет анкету. Заполненная анкета уходит на проверку (pending); изменение
+// ФИО, даты рождения или документа у верифицированного клиента снова отправляет её на проверку.
+func (svc *Service) UpdateProfile(ctx context.Context, userID string, req storage.UpdateProfileRequest, now time.Time) (storage.User, error) {
+	if req.DateOfBirth != nil {
+		if err := validateDateOfBirth(*req.DateOfBirth, now); err != nil {
+			return storage.User{}, err
+		}
+	}
+
+	submitted := false
+	user, err := svc.UpdateUser(ctx, userID, func(u *storage.User) error {
+		if u.Profile == nil {
+			u.Profile = &storage.UserProfile{}
+		}
+		p := u.Profile
+		before := *p
+		for _, f := range []struct {
+			value *string
+			field *string
+		}{{req.FullName, &p.FullName}, {req.DateOfBirth, &p.DateOfBirth}, {req.Address, &p.Address}, {req.DocumentNumber, &p.DocumentNumber}} {
+			if f.value != nil {
+				*f.field = strings.TrimSpace(*f.value)
+			}
+		}
+
+		identityChanged := p.FullName != before.FullName || p.DateOfBirth != before.DateOfBirth || p.DocumentNumber != before.DocumentNumber
+		switch {
+		case !p.Complete():
+			if u.KYC() != storage.KYCNone {
+				u.KYCStatus = storage.KYCNone
+				u.KYCUpdatedAt = &now
+			}
+		case u.KYC() == storage.KYCNone || (u.KYC() == storage.KYCVerified && identityChanged):
+			u.KYCStatus = storage.KYCPending
+			u.KYCNote = ""
+			u.KYCUpdatedAt = &now
+			submitted = true
+		}
+		return nil
+	})
+	if err != nil {
+		return storage.User{}, err
+	}
+
+	if submitted {
+		svc.AddAuditEntry(ctx, storage.AuditEntry{
+			ID:        storage.GenerateID(),
+			Timestamp: now,
+			Actor:     user.ID,
+			Action:    "kyc.submit",
+			Details:   map[string]string{"user_id": user.ID},
+		})
+		log.Printf("KYC profile of user %s submitted for review", user.ID)
+	}
+	return user, nil
+}
+
+func validateDateOfBirth(value string, now time.Time) error {
+	dob, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		return invalidInputf("date_of_birth must be YYYY-MM-DD")
+	}
+	if dob.AddDate(KYCPolicy.MinAge, 0, 0).After(now) {
+		return invalidInputf("customer must be at least %d years old", KYCPolicy.MinAge)
+	}
+	return nil
+}
+
+// PendingKYC — очередь анкет на проверку, старые сверху
+func (svc *Service) PendingKYC(ctx context.Context) []storage.User {
+	pending := make([]storage.User, 0)
+	for _, user := range svc.ListUsers(ctx) {
+		if user.KYC() == storage.KYCPending {
+			pending = append(pending, user)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].KYCUpdatedAt.Before(*pending[j].KYCUpdatedAt) })
+	return pending
+}
+
+// ReviewKYC — решение админа по анкете: verify подтверждает личность, reject возвращает статус none с причиной
+func (svc *Service) ReviewKYC(ctx context.Context, userID string, verify bool, reason string, now time.Time) (storage.User, error) {
+	user, err := svc.UpdateUser(ctx, userID, func(u *storage.User) error {
+		if u.KYC() != storage.KYCPending {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("KYC of user %s is %s, not pending", userID, u.KYC())}
+		}
+		u.KYCStatus = storage.KYCVerified
+		u.KYCNote = ""
+		if !verify {
+			if strings.TrimSpace(reason) == "" {
+				return invalidInputf("reason is required to reject KYC")
+			}
+			u.KYCStatus = storage.KYCNone
+			u.KYCNote = strings.TrimSpace(reason)
+		}
+		u.KYCUpdatedAt = &now
+		return nil
+	})
+	if err != nil {
+		return storage.User{}, err
+	}
+
+	action := "kyc.verify"
+	if !verify {
+		action = "kyc.reject"
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    action,
+		Details:   map[string]string{"user_id": user.ID, "reason": user.KYCNote},
+	})
+
+	body := fmt.Sprintf("Hello %s,\n\nYour identity has been verified. Loans and large transfers are now available.", user.Username)
+	if !verify {
+		body = fmt.Sprintf("Hello %s,\n\nWe could not verify your identity: %s\nPlease update your profile and try again.", user.Username, user.KYCNote)
+	}
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: identity verification", body)
+	log.Printf("KYC of user %s: %s", user.ID, user.KYC())
+	return user, nil
+}
+
+// RequireKYCForLoan — кредит выдаётся только клиенту с подтверждённой личностью
+func (svc *Service) RequireKYCForLoan(user storage.User) error {
+	if KYCPolicy.RequireForLoans && user.KYC() != storage.KYCVerified {
+		return kycRequiredf("identity verification is required before applying for a loan (KYC status: %s)", user.KYC())
+	}
+	return nil
+}
+
+// CheckKYCForTransfer — крупные переводы доступны только после верификации владельца счёта
+func (svc *Service) CheckKYCForTransfer(ctx context.Context, account storage.Account, amount decimal.Decimal) error {
+	if !amount.GreaterThan(KYCPolicy.LargeTransferThreshold) {
+		return nil
+	}
+	user, ok := svc.GetUser(ctx, account.UserID)
+	if ok && user.KYC() == storage.KYCVerified {
+		return nil
+	}
+	return kycRequiredf("transfers above %s require identity verification", KYCPolicy.LargeTransferThreshold.String())
+}
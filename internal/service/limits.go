@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// MaxLimitOverrideDuration — самый долгий срок временного повышения лимита
+const MaxLimitOverrideDuration = 30 * 24 * time.Hour
+
+// TransferredSince суммирует исходящие списания клиента со счёта (storage.OutgoingDebitTypes) начиная с момента since
+func (svc *Service) TransferredSince(ctx context.Context, accountID string, since time.Time) decimal.Decimal {
+	return svc.OutgoingDebitsSince(ctx, accountID, since)
+}
+
+// EffectiveTransferLimit — дневной лимит переводов с учётом одобренного повышения, действующего на момент now
+func (svc *Service) EffectiveTransferLimit(ctx context.Context, account storage.Account, now time.Time) (decimal.Decimal, *storage.LimitOverride) {
+	if o, ok := svc.ActiveLimitOverride(ctx, account.ID, now); ok {
+		return o.Limit, &o
+	}
+	return account.DailyTransferLimit, nil
+}
+
+// ReserveTransferLimit проверяет, что крупное списание делает клиент с подтверждённой личностью, и атомарно
+// засчитывает amount в дневной лимит счёта (нулевой лимит — без ограничений). Возвращённую release нужно вызвать,
+// когда списание проведено или не прошло: после проводки сумму учитывает уже сам журнал.
+func (svc *Service) ReserveTransferLimit(ctx context.Context, account storage.Account, amount decimal.Decimal, now time.Time) (func(), error) {
+	noop := func() {}
+	if err := svc.CheckKYCForTransfer(ctx, account, amount); err != nil {
+		return noop, err
+	}
+	limit, _ := svc.EffectiveTransferLimit(ctx, account, now)
+	if !limit.IsPositive() {
+		return noop, nil
+	}
+	if err := svc.Repository.ReserveTransferLimit(ctx, account.ID, StartOfDay(now), limit, amount); err != nil {
+		return noop, err
+	}
+	return func() { svc.ReleaseTransferLimit(context.WithoutCancel(ctx), account.ID, amount) }, nil
+}
+
+// RequestLimitOverride ставит заявку клиента на временное повышение лимита в очередь админа
+func (svc *Service) RequestLimitOverride(ctx context.Context, account storage.Account, req storage.LimitOverrideRequest, now time.Time) (storage.LimitOverride, error) {
+	duration := time.Duration(req.DurationHours) * time.Hour
+	if duration <= 0 || duration > MaxLimitOverrideDuration {
+		return storage.LimitOverride{}, &storage.StorageError{Kind: storage.ErrInvalidInput, Message: fmt.Sprintf("duration_hours must be between 1 and %d", int(MaxLimitOverrideDuration.Hours()))}
+	}
+	if current, _ := svc.EffectiveTransferLimit(ctx, account, now); !req.Limit.GreaterThan(current) {
+		return storage.LimitOverride{}, &storage.StorageError{Kind: storage.ErrInvalidInput, Message: fmt.Sprintf("requested limit must exceed the current limit of %s", current.String())}
+	}
+
+	o := storage.LimitOverride{
+		ID:          storage.GenerateID(),
+		AccountID:   account.ID,
+		Limit:       req.Limit,
+		Duration:    duration,
+		Reason:      req.Reason,
+		Status:      storage.LimitOverridePending,
+		RequestedAt: now,
+	}
+	if err := svc.AddLimitOverride(ctx, o); err != nil {
+		return storage.LimitOverride{}, err
+	}
+	o.UserID = account.UserID
+	log.Printf("Limit override %s requested for account %s: %s for %s", o.ID, account.ID, o.Limit.String(), duration)
+	return o, nil
+}
+
+// DecideLimitOverride одобряет или отклоняет заявку. Одобренное повышение действует с момента решения
+// на срок заявки (или меньший, указанный админом); решение пишется в журнал аудита.
+func (svc *Service) DecideLimitOverride(ctx context.Context, id string, approve bool, decision storage.LimitOverrideDecision, now time.Time) (storage.LimitOverride, error) {
+	o, err := svc.Repository.DecideLimitOverride(ctx, id, func(o *storage.LimitOverride) {
+		o.DecidedAt = &now
+		o.DecisionNote = decision.Note
+		if !approve {
+			o.Status = storage.LimitOverrideRejected
+			return
+		}
+		if decision.Limit.IsPositive() && decision.Limit.LessThan(o.Limit) {
+			o.Limit = decision.Limit
+		}
+		if d := time.Duration(decision.DurationHours) * time.Hour; d > 0 && d < o.Duration {
+			o.Duration = d
+		}
+		expiresAt := now.Add(o.Duration)
+		o.Status = storage.LimitOverrideApproved
+		o.ExpiresAt = &expiresAt
+	})
+	if err != nil {
+		return o, err
+	}
+
+	details := map[string]string{
+		"override": o.ID,
+		"account":  o.AccountID,
+		"user":     o.UserID,
+		"status":   o.Status,
+		"note":     o.DecisionNote,
+	}
+	if o.ExpiresAt != nil {
+		details["limit"] = o.Limit.String()
+		details["expires_at"] = o.ExpiresAt.Format(time.RFC3339)
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "limit_override." + o.Status,
+		Details:   details,
+	})
+
+	if user, ok := svc.GetUser(ctx, o.UserID); ok {
+		var body string
+		if o.Status == storage.LimitOverrideApproved {
+			body = fmt.Sprintf("Hello %s,\n\nYour request to raise the daily transfer limit has been approved: %s until %s.",
+				user.Username, o.Limit.String(), o.ExpiresAt.Format("02.01.2006 15:04"))
+		} else {
+			body = fmt.Sprintf("Hello %s,\n\nYour request to raise the daily transfer limit has been declined.", user.Username)
+		}
+		if o.DecisionNote != "" {
+			body += "\n" + o.DecisionNote
+		}
+		svc.QueueEmail(ctx, user.Email, "Simple Bank: limit increase request", body)
+	}
+	log.Printf("Limit override %s %s", o.ID, o.Status)
+	return o, nil
+}
+
+// TierLimitsByKYC — лимиты по уровню KYC в рублях; анкета на проверке живёт по лимитам none
+var TierLimitsByKYC = map[string]storage.TierLimits{
+	storage.KYCNone:     {DailyTransferCap: decimal.NewFromInt(100000), MaxBalance: decimal.NewFromInt(600000)},
+	storage.KYCPending:  {DailyTransferCap: decimal.NewFromInt(100000), MaxBalance: decimal.NewFromInt(600000)},
+	storage.KYCVerified: {DailyTransferCap: decimal.NewFromInt(5000000), MaxBalance: decimal.Zero},
+}
+
+// toBaseCurrency переводит сумму в рубли по курсу ЦБ
+func (svc *Service) toBaseCurrency(ctx context.Context, amount decimal.Decimal, currency string) (decimal.Decimal, error) {
+	rate, err := svc.GetCBRExchangeRate(ctx, currency)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return amount.Mul(rate), nil
+}
+
+// UserLimits считает лимиты уровня клиента и их использование: переводы и оплаты со всех счетов за сегодня
+// и суммарный остаток, всё в рублях
+func (svc *Service) UserLimits(ctx context.Context, user storage.User, now time.Time) (storage.UserLimits, error) {
+	tier := TierLimitsByKYC[user.KYC()]
+	limits := storage.UserLimits{
+		UserID:           user.ID,
+		Tier:             user.KYC(),
+		Currency:         storage.BaseCurrency,
+		DailyTransferCap: tier.DailyTransferCap,
+		TransferredToday: decimal.Zero,
+		MaxBalance:       tier.MaxBalance,
+		TotalBalance:     decimal.Zero,
+	}
+	since := StartOfDay(now)
+	for _, acc := range svc.GetUserAccounts(ctx, user.ID) {
+		outgoing := svc.TransferredSince(ctx, acc.ID, since).Add(svc.SpentSince(ctx, acc.ID, since))
+		outgoing, err := svc.toBaseCurrency(ctx, outgoing, acc.Currency)
+		if err != nil {
+			return storage.UserLimits{}, err
+		}
+		balance, err := svc.toBaseCurrency(ctx, acc.Balance, acc.Currency)
+		if err != nil {
+			return storage.UserLimits{}, err
+		}
+		limits.TransferredToday = limits.TransferredToday.Add(outgoing).Round(2)
+		limits.TotalBalance = limits.TotalBalance.Add(balance).Round(2)
+	}
+	return limits, nil
+}
+
+// CheckTierLimits — единая проверка лимитов уровня KYC для перевода (from и to), оплаты (только from) и
+// пополнения (только to). Переводы между своими счетами суммарный остаток не меняют и его не проверяют.
+func (svc *Service) CheckTierLimits(ctx context.Context, from, to *storage.Account, amount decimal.Decimal, now time.Time) error {
+	if from != nil {
+		if err := svc.checkTierCap(ctx, from.UserID, from.Currency, amount, now, true); err != nil {
+			return err
+		}
+	}
+	if to != nil && (from == nil || from.UserID != to.UserID) {
+		if err := svc.checkTierCap(ctx, to.UserID, to.Currency, amount, now, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (svc *Service) checkTierCap(ctx context.Context, userID, currency string, amount decimal.Decimal, now time.Time, outgoing bool) error {
+	user, ok := svc.GetUser(ctx, userID)
+	if !ok {
+		return nil
+	}
+	limits, err := svc.UserLimits(ctx, user, now)
+	if err != nil {
+		return err
+	}
+	base, err := svc.toBaseCurrency(ctx, amount, currency)
+	if err != nil {
+		return err
+	}
+
+	if outgoing && limits.DailyTransferCap.IsPositive() && limits.TransferredToday.Add(base).GreaterThan(limits.DailyTransferCap) {
+		return &storage.StorageError{
+			Kind:    storage.ErrQuotaExceeded,
+			Code:    storage.CodeLimitExceeded,
+			Message: fmt.Sprintf("daily transfer cap of %s %s for KYC level %s exceeded (used today: %s)", limits.DailyTransferCap.String(), limits.Currency, limits.Tier, limits.TransferredToday.String()),
+		}
+	}
+	if !outgoing && limits.MaxBalance.IsPositive() && limits.TotalBalance.Add(base).GreaterThan(limits.MaxBalance) {
+		return &storage.StorageError{
+			Kind:    storage.ErrQuotaExceeded,
+			Code:    storage.CodeLimitExceeded,
+			Message: fmt.Sprintf("recipient balance would exceed the cap of %s %s for KYC level %s", limits.MaxBalance.String(), limits.Currency, limits.Tier),
+		}
+	}
+	return nil
+}
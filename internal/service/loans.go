@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// DisburseLoan выдаёт кредит как сагу: запись кредита, зачисление на счёт, проводка в журнале.
+// Если какой-то шаг не прошёл, кредит удаляется и зачисление списывается обратно.
+func (svc *Service) DisburseLoan(ctx context.Context, loan storage.Loan, now time.Time) (storage.Transaction, error) {
+	tx := storage.Transaction{
+		ID:              storage.GenerateID(),
+		ToAccountID:     loan.AccountID,
+		Amount:          loan.Amount,
+		Timestamp:       now,
+		TransactionType: "loan_disbursement",
+	}
+	tx.Describe(storage.DescLoanDisbursement, map[string]string{"loan_id": loan.ID})
+
+	_, err := svc.RunSaga(ctx, "loan_disbursement", map[string]string{"loan_id": loan.ID, "account_id": loan.AccountID, "user_id": loan.UserID}, []SagaStep{
+		{
+			Name:       "create_loan",
+			Do:         func(ctx context.Context) error { return svc.AddLoan(ctx, loan) },
+			Compensate: func(ctx context.Context) error { return svc.RemoveLoan(ctx, loan.ID) },
+		},
+		{
+			Name: "credit_account",
+			Do:   func(ctx context.Context) error { return svc.UpdateAccountBalance(ctx, loan.AccountID, loan.Amount) },
+			Compensate: func(ctx context.Context) error {
+				return svc.UpdateAccountBalance(ctx, loan.AccountID, loan.Amount.Neg())
+			},
+		},
+		{
+			Name: "record_transaction",
+			Do: func(ctx context.Context) error {
+				svc.AddTransaction(ctx, tx)
+				return nil
+			},
+		},
+	}, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	return tx, nil
+}
+
+// LoanView — кредит с начислением на момент now. userID, если задан, должен быть заёмщиком: чужой кредит
+// отдаётся как не найденный.
+func (svc *Service) LoanView(ctx context.Context, loanID, userID string, now time.Time) (storage.LoanView, error) {
+	loan, ok := svc.GetLoan(ctx, loanID)
+	if !ok || (userID != "" && loan.UserID != userID) {
+		return storage.LoanView{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeLoanNotFound, Message: fmt.Sprintf("loan %s not found", loanID)}
+	}
+	return accrueLoan(loan, now), nil
+}
+
+// UserLoans — кредиты пользователя, новые первыми. status отбирает current, delinquent или default,
+// activeOnly — только с непогашенным остатком.
+func (svc *Service) UserLoans(ctx context.Context, userID, status string, activeOnly bool, now time.Time) ([]storage.LoanSummary, error) {
+	switch status {
+	case "", storage.LoanCurrent, storage.LoanDelinquent, storage.LoanDefault:
+	default:
+		return nil, invalidInputf("status must be one of %s, %s, %s", storage.LoanCurrent, storage.LoanDelinquent, storage.LoanDefault)
+	}
+	loans := svc.GetUserLoans(ctx, userID)
+	sort.Slice(loans, func(i, j int) bool { return loans[i].StartDate.After(loans[j].StartDate) })
+
+	result := make([]storage.LoanSummary, 0, len(loans))
+	for _, loan := range loans {
+		view := accrueLoan(loan, now)
+		active := loan.RemainingAmount.IsPositive()
+		if (status != "" && view.Status != status) || (activeOnly && !active) {
+			continue
+		}
+		result = append(result, storage.LoanSummary{
+			ID:                loan.ID,
+			AccountID:         loan.AccountID,
+			Amount:            loan.Amount,
+			InterestRate:      loan.InterestRate,
+			TermMonths:        loan.TermMonths,
+			StartDate:         loan.StartDate,
+			RemainingAmount:   loan.RemainingAmount,
+			Status:            view.Status,
+			Active:            active,
+			DaysPastDue:       view.DaysPastDue,
+			OverdueAmount:     view.OverdueAmount,
+			NextPaymentDate:   view.NextPaymentDate,
+			NextPaymentAmount: view.NextPaymentAmount,
+		})
+	}
+	return result, nil
+}
+
+var LoanHolidayConfig = struct {
+	MaxMonths      int // за одни каникулы
+	MaxTotalMonths int // за весь срок кредита
+}{
+	MaxMonths:      3,
+	MaxTotalMonths: 6,
+}
+
+// LoanPaymentHoliday откладывает req.Months ближайших платежей: неоплаченная часть графика сдвигается на столько же
+// месяцев, срок растёт. Проценты за каникулы капитализируются — добавляются к остатку долга, а оставшиеся платежи
+// пересчитываются по аннуитету на новый остаток. Кредит с просрочкой на каникулы не уходит. userID, если задан,
+// должен быть заёмщиком.
+func (svc *Service) LoanPaymentHoliday(ctx context.Context, loanID, userID string, req storage.LoanHolidayRequest, now time.Time) (storage.LoanView, error) {
+	if req.Months < 1 || req.Months > LoanHolidayConfig.MaxMonths {
+		return storage.LoanView{}, invalidInputf("months must be between 1 and %d", LoanHolidayConfig.MaxMonths)
+	}
+	if _, err := svc.LoanView(ctx, loanID, userID, now); err != nil {
+		return storage.LoanView{}, err
+	}
+	actor := userID
+	if actor == "" {
+		actor = "admin"
+	}
+
+	var event storage.LoanEvent
+	loan, err := svc.UpdateLoan(ctx, loanID, func(l *storage.Loan) error {
+		if !l.RemainingAmount.IsPositive() {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan %s is repaid", loanID)}
+		}
+		if view := accrueLoan(*l, now); view.OverdueAmount.IsPositive() {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan %s has overdue payments of %s", loanID, view.OverdueAmount.StringFixed(2))}
+		}
+		if l.HolidayMonths+req.Months > LoanHolidayConfig.MaxTotalMonths {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan %s already has %d holiday months of %d allowed", loanID, l.HolidayMonths, LoanHolidayConfig.MaxTotalMonths)}
+		}
+		next := -1
+		for i, payment := range l.PaymentSchedule {
+			if !payment.Paid {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("loan %s has no scheduled payments", loanID)}
+		}
+
+		paused := l.PaymentSchedule[next]
+		remaining := len(l.PaymentSchedule) - next
+		monthlyRate := decimal.NewFromInt(1).Add(l.InterestRate.Div(decimal.NewFromInt(1200)))
+		capitalized := l.RemainingAmount.Mul(monthlyRate.Pow(decimal.NewFromInt(int64(req.Months)))).Sub(l.RemainingAmount).RoundBank(2)
+		principal := l.RemainingAmount.Add(capitalized)
+		monthlyPayment := storage.CalculateMonthlyPayment(principal, l.InterestRate, remaining)
+		// GeneratePaymentSchedule ставит первый платёж через месяц после даты начала
+		schedule := storage.GeneratePaymentSchedule(principal, l.InterestRate, remaining, paused.DueDate.AddDate(0, req.Months-1, 0), monthlyPayment)
+
+		l.PaymentSchedule = append(l.PaymentSchedule[:next], schedule...)
+		l.RemainingAmount = principal
+		l.TermMonths += req.Months
+		l.HolidayMonths += req.Months
+		event = storage.LoanEvent{
+			Type:      storage.LoanEventHoliday,
+			Timestamp: now,
+			Actor:     actor,
+			Details: map[string]string{
+				"months":               strconv.Itoa(req.Months),
+				"paused_from":          paused.DueDate.Format("2006-01-02"),
+				"resumes_on":           schedule[0].DueDate.Format("2006-01-02"),
+				"capitalized_interest": capitalized.StringFixed(2),
+				"previous_payment":     paused.Amount.StringFixed(2),
+				"new_payment":          schedule[0].Amount.StringFixed(2),
+				"term_months":          strconv.Itoa(l.TermMonths),
+			},
+		}
+		if reason := strings.TrimSpace(req.Reason); reason != "" {
+			event.Details["reason"] = reason
+		}
+		l.History = append(l.History, event)
+		return nil
+	})
+	if err != nil {
+		return storage.LoanView{}, err
+	}
+
+	details := map[string]string{"loan_id": loan.ID}
+	for k, v := range event.Details {
+		details[k] = v
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    "loan.holiday",
+		Details:   details,
+	})
+	log.Printf("Loan %s: payment holiday of %d months, payments resume on %s, capitalized interest %s",
+		loan.ID, req.Months, event.Details["resumes_on"], event.Details["capitalized_interest"])
+	return accrueLoan(loan, now), nil
+}
+
+var LoanDelinquencyConfig = struct {
+	PenaltyRate         decimal.Decimal // годовая ставка пени на просроченные платежи, %
+	DelinquentAfterDays int
+	DefaultAfterDays    int // после этого срока кредит остаётся в default, даже если просрочку погасят
+}{
+	PenaltyRate:         decimal.NewFromInt(20),
+	DelinquentAfterDays: 1,
+	DefaultAfterDays:    90,
+}
+
+// accrueLoan считает начисление по графику: проценты неоплаченных платежей со сроком до now начислены целиком,
+// проценты текущего периода — пропорционально прошедшим дням. Просрочка отсчитывается от самого раннего
+// неоплаченного платежа; к сохранённым пеням добавляются пени, набежавшие после последнего начисления.
+func accrueLoan(loan storage.Loan, now time.Time) storage.LoanView {
+	view := storage.LoanView{
+		Loan:              loan,
+		AsOf:              now,
+		AccruedInterest:   decimal.Zero,
+		OverdueAmount:     decimal.Zero,
+		NextPaymentAmount: decimal.Zero,
+		EffectiveRate:     effectiveAnnualRate(loan.InterestRate),
+	}
+	periodStart := loan.StartDate
+	for _, payment := range loan.PaymentSchedule {
+		if payment.Paid {
+			periodStart = payment.DueDate
+			continue
+		}
+		if !payment.DueDate.After(now) {
+			view.AccruedInterest = view.AccruedInterest.Add(payment.InterestPart)
+			view.OverdueAmount = view.OverdueAmount.Add(payment.Amount)
+			if view.DaysPastDue == 0 {
+				view.DaysPastDue = daysBetween(payment.DueDate, now)
+			}
+			periodStart = payment.DueDate
+			continue
+		}
+		if view.NextPaymentDate == nil {
+			due := payment.DueDate
+			view.NextPaymentDate = &due
+			view.NextPaymentAmount = payment.Amount
+			if elapsed, period := daysBetween(periodStart, now), daysBetween(periodStart, payment.DueDate); elapsed > 0 && period > 0 {
+				share := payment.InterestPart.Mul(decimal.NewFromInt(int64(elapsed))).Div(decimal.NewFromInt(int64(period)))
+				view.AccruedInterest = view.AccruedInterest.Add(share)
+			}
+		}
+	}
+	view.AccruedInterest = view.AccruedInterest.RoundBank(2)
+	view.PenaltyInterest = loan.PenaltyInterest.Add(loanPenaltyDue(loan, now)).RoundBank(2)
+	view.Status = loanStatus(loan, view.DaysPastDue)
+	return view
+}
+
+// loanPenaltyDue — пени по просроченным платежам с момента последнего начисления (или со дня просрочки) до now
+func loanPenaltyDue(loan storage.Loan, now time.Time) decimal.Decimal {
+	penalty := decimal.Zero
+	for _, payment := range loan.PaymentSchedule {
+		if payment.Paid || !payment.DueDate.Before(now) {
+			continue
+		}
+		from := payment.DueDate
+		if loan.PenaltyAccruedAt != nil && loan.PenaltyAccruedAt.After(from) {
+			from = *loan.PenaltyAccruedAt
+		}
+		if !now.After(from) {
+			continue
+		}
+		days := decimal.NewFromInt(int64(now.Sub(from) / time.Second)).Div(decimal.NewFromInt(86400))
+		penalty = penalty.Add(payment.Amount.Mul(LoanDelinquencyConfig.PenaltyRate).Div(decimal.NewFromInt(36500)).Mul(days))
+	}
+	return penalty
+}
+
+func loanStatus(loan storage.Loan, daysPastDue int) string {
+	switch {
+	case loan.Status == storage.LoanDefault, daysPastDue >= LoanDelinquencyConfig.DefaultAfterDays:
+		return storage.LoanDefault
+	case daysPastDue >= LoanDelinquencyConfig.DelinquentAfterDays:
+		return storage.LoanDelinquent
+	}
+	return storage.LoanCurrent
+}
+
+// runLoanDelinquency — шаг закрытия дня: начисляет пени по просроченным платежам, переводит кредиты между статусами
+// current/delinquent/default и сообщает заёмщику о переходе в просрочку и в дефолт
+func (svc *Service) runLoanDelinquency(ctx context.Context, now time.Time, step *storage.EODStep) error {
+	for _, loan := range svc.ListLoans(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if view := accrueLoan(loan, now); view.OverdueAmount.IsZero() && view.Status == loan.Status {
+			continue
+		}
+		previous := loan.Status
+		updated, err := svc.UpdateLoan(ctx, loan.ID, func(l *storage.Loan) error {
+			view := accrueLoan(*l, now)
+			if pending := loanPenaltyDue(*l, now); pending.IsPositive() {
+				l.PenaltyInterest = l.PenaltyInterest.Add(pending)
+				l.PenaltyAccruedAt = &now
+			}
+			switch view.Status {
+			case storage.LoanCurrent:
+				l.DelinquentSince = nil
+			case storage.LoanDelinquent, storage.LoanDefault:
+				if l.DelinquentSince == nil {
+					l.DelinquentSince = &now
+				}
+			}
+			if view.Status == storage.LoanDefault && l.DefaultedAt == nil {
+				l.DefaultedAt = &now
+			}
+			l.Status = view.Status
+			return nil
+		})
+		if err != nil {
+			log.Printf("Loan delinquency: loan %s: %v", loan.ID, err)
+			step.Failed++
+			continue
+		}
+		step.Processed++
+		if updated.Status != previous && updated.Status != storage.LoanCurrent {
+			svc.notifyLoanDelinquency(ctx, accrueLoan(updated, now), now)
+		}
+	}
+	return nil
+}
+
+func (svc *Service) notifyLoanDelinquency(ctx context.Context, view storage.LoanView, now time.Time) {
+	loan := view.Loan
+	svc.events.Publish(storage.Event{
+		Type:      storage.EventLoanDelinquency,
+		UserID:    loan.UserID,
+		AccountID: loan.AccountID,
+		Payload: map[string]interface{}{
+			"loan_id":          loan.ID,
+			"status":           loan.Status,
+			"days_past_due":    view.DaysPastDue,
+			"overdue_amount":   view.OverdueAmount,
+			"penalty_interest": view.PenaltyInterest,
+		},
+	})
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "system",
+		Action:    "loan." + loan.Status,
+		Details:   map[string]string{"loan_id": loan.ID, "days_past_due": strconv.Itoa(view.DaysPastDue), "overdue_amount": view.OverdueAmount.String()},
+	})
+	metrics.add(metricLoanDelinquencies, 1, "status", loan.Status)
+	log.Printf("Loan %s is %s: %d days past due, overdue %s", loan.ID, loan.Status, view.DaysPastDue, view.OverdueAmount.String())
+
+	user, ok := svc.GetUser(ctx, loan.UserID)
+	if !ok {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\nYour loan %s is %d days past due. Overdue amount: %s, penalty interest: %s.",
+		user.Username, loan.ID, view.DaysPastDue, view.OverdueAmount.StringFixed(2), view.PenaltyInterest.StringFixed(2))
+	if loan.Status == storage.LoanDefault {
+		body += "\nThe loan has been declared in default."
+	}
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: overdue loan payment", body)
+}
+
+// effectiveAnnualRate переводит номинальную годовую ставку в процентах в эффективную при ежемесячных платежах
+func effectiveAnnualRate(nominal decimal.Decimal) decimal.Decimal {
+	monthly := decimal.NewFromInt(1).Add(nominal.Div(decimal.NewFromInt(1200)))
+	return monthly.Pow(decimal.NewFromInt(12)).Sub(decimal.NewFromInt(1)).Mul(decimal.NewFromInt(100)).RoundBank(2)
+}
+
+func daysBetween(from, to time.Time) int {
+	if !to.After(from) {
+		return 0
+	}
+	return int(to.Sub(from).Hours() / 24)
+}
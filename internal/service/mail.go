@@ -0,0 +1,376 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+const (
+	MailProviderSMTP     = "smtp"
+	MailProviderSendGrid = "sendgrid"
+	MailProviderMailgun  = "mailgun"
+	MailProviderLog      = "log"
+)
+
+// MailConfig — через какого провайдера уходят письма. По умолчанию log: письма только пишутся в лог, как на стенде разработчика.
+var MailConfig = struct {
+	Provider string
+	From     string
+	Timeout  time.Duration // верхняя граница на отправку, если у контекста нет более раннего дедлайна
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	SendGridAPIKey string
+	SendGridURL    string
+
+	MailgunDomain string
+	MailgunAPIKey string
+	MailgunURL    string // для EU-региона — https://api.eu.mailgun.net/v3
+}{
+	Provider: strings.ToLower(EnvOrDefault("BANKAPP_MAIL_PROVIDER", MailProviderLog)),
+	From:     EnvOrDefault("BANKAPP_MAIL_FROM", "bankapp@example.com"),
+	Timeout:  30 * time.Second,
+
+	SMTPHost:     EnvOrDefault("BANKAPP_SMTP_HOST", ""),
+	SMTPPort:     EnvOrDefault("BANKAPP_SMTP_PORT", "587"),
+	SMTPUsername: EnvOrDefault("BANKAPP_SMTP_USERNAME", ""),
+	SMTPPassword: EnvOrDefault("BANKAPP_SMTP_PASSWORD", ""),
+
+	SendGridAPIKey: EnvOrDefault("BANKAPP_SENDGRID_API_KEY", ""),
+	SendGridURL:    EnvOrDefault("BANKAPP_SENDGRID_URL", "https://api.sendgrid.com/v3/mail/send"),
+
+	MailgunDomain: EnvOrDefault("BANKAPP_MAILGUN_DOMAIN", ""),
+	MailgunAPIKey: EnvOrDefault("BANKAPP_MAILGUN_API_KEY", ""),
+	MailgunURL:    EnvOrDefault("BANKAPP_MAILGUN_URL", "https://api.mailgun.net/v3"),
+}
+
+// EmailMessage — письмо в виде, общем для всех провайдеров; тело — простой текст
+type EmailMessage struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer отправляет письмо и возвращает его идентификатор у провайдера, если тот его выдаёт.
+// Реализация должна уважать дедлайн ctx.
+type Mailer interface {
+	Name() string
+	Send(ctx context.Context, msg EmailMessage) (messageID string, err error)
+}
+
+var (
+	mailerMu sync.RWMutex
+	mailer   = newMailer(MailConfig.Provider)
+)
+
+// newMailer выбирает провайдера по имени; неизвестный или не до конца настроенный провайдер заменяется логированием
+func newMailer(provider string) Mailer {
+	client := &http.Client{}
+	switch provider {
+	case MailProviderSMTP:
+		if MailConfig.SMTPHost != "" {
+			return &SMTPMailer{Host: MailConfig.SMTPHost, Port: MailConfig.SMTPPort, Username: MailConfig.SMTPUsername, Password: MailConfig.SMTPPassword}
+		}
+		log.Printf("BANKAPP_SMTP_HOST is not set, emails will only be logged")
+	case MailProviderSendGrid:
+		if MailConfig.SendGridAPIKey != "" {
+			return &SendGridMailer{APIKey: MailConfig.SendGridAPIKey, URL: MailConfig.SendGridURL, Client: client}
+		}
+		log.Printf("BANKAPP_SENDGRID_API_KEY is not set, emails will only be logged")
+	case MailProviderMailgun:
+		if MailConfig.MailgunDomain != "" && MailConfig.MailgunAPIKey != "" {
+			return &MailgunMailer{Domain: MailConfig.MailgunDomain, APIKey: MailConfig.MailgunAPIKey, URL: MailConfig.MailgunURL, Client: client}
+		}
+		log.Printf("BANKAPP_MAILGUN_DOMAIN or BANKAPP_MAILGUN_API_KEY is not set, emails will only be logged")
+	case MailProviderLog:
+	default:
+		log.Printf("Unknown mail provider %q, emails will only be logged", provider)
+	}
+	return LogMailer{}
+}
+
+// SetMailer подключает провайдера почты вместо заданного в BANKAPP_MAIL_PROVIDER
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = m
+}
+
+func currentMailer() Mailer {
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return mailer
+}
+
+func SendEmailNotification(ctx context.Context, to, subject, body string) error {
+	m := currentMailer()
+	ctx, cancel := context.WithTimeout(ctx, MailConfig.Timeout)
+	defer cancel()
+	messageID, err := m.Send(ctx, EmailMessage{From: MailConfig.From, To: to, Subject: subject, Body: body})
+
+	delivery := storage.EmailDelivery{
+		ID:        storage.GenerateID(),
+		Provider:  m.Name(),
+		MessageID: messageID,
+		To:        to,
+		Subject:   subject,
+		Status:    storage.EmailSent,
+		SentAt:    time.Now(),
+	}
+	if _, ok := m.(LogMailer); ok {
+		delivery.Status = storage.EmailLogged
+	}
+	if err != nil {
+		delivery.Status = storage.EmailFailed
+		delivery.Error = err.Error()
+	}
+	emailDeliveries.add(delivery)
+
+	if err != nil {
+		log.Printf("Error sending email to %s via %s: %v", to, m.Name(), err)
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if delivery.Status == storage.EmailSent {
+		log.Printf("Email sent successfully to %s via %s", to, m.Name())
+	}
+	return nil
+}
+
+// LogMailer только пишет письмо в лог; используется, пока провайдер не настроен
+type LogMailer struct{}
+
+func (LogMailer) Name() string { return MailProviderLog }
+
+func (LogMailer) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	log.Printf("Mail provider not configured. Skipping email to %s: Subject: %s", msg.To, msg.Subject)
+	return "", nil
+}
+
+// SMTPMailer отправляет письмо напрямую через SMTP-сервер с STARTTLS, если сервер его поддерживает
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Name() string { return MailProviderSMTP }
+
+func (m *SMTPMailer) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	messageID := fmt.Sprintf("<%s@%s>", storage.GenerateID(), m.Host)
+	raw := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMessage-ID: %s\r\n\r\n%s\r\n",
+		msg.From, msg.To, msg.Subject, messageID, msg.Body)
+	if err := sendMailContext(ctx, net.JoinHostPort(m.Host, m.Port), auth, msg.From, msg.To, []byte(raw)); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+// SendGridMailer отправляет письмо через SendGrid Web API v3; идентификатор приходит в заголовке X-Message-Id
+type SendGridMailer struct {
+	APIKey string
+	URL    string
+	Client *http.Client
+}
+
+func (m *SendGridMailer) Name() string { return MailProviderSendGrid }
+
+func (m *SendGridMailer) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	payload, err := json.Marshal(struct {
+		Personalizations []struct {
+			To []address `json:"to"`
+		} `json:"personalizations"`
+		From    address   `json:"from"`
+		Subject string    `json:"subject"`
+		Content []content `json:"content"`
+	}{
+		Personalizations: []struct {
+			To []address `json:"to"`
+		}{{To: []address{{Email: msg.To}}}},
+		From:    address{Email: msg.From},
+		Subject: msg.Subject,
+		Content: []content{{Type: "text/plain", Value: msg.Body}},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("sendgrid responded with %s: %s", resp.Status, readErrorBody(resp.Body))
+	}
+	return resp.Header.Get("X-Message-Id"), nil
+}
+
+// MailgunMailer отправляет письмо через Mailgun Messages API; идентификатор приходит в поле id ответа
+type MailgunMailer struct {
+	Domain string
+	APIKey string
+	URL    string
+	Client *http.Client
+}
+
+func (m *MailgunMailer) Name() string { return MailProviderMailgun }
+
+func (m *MailgunMailer) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	form := url.Values{
+		"from":    {msg.From},
+		"to":      {msg.To},
+		"subject": {msg.Subject},
+		"text":    {msg.Body},
+	}
+	endpoint := strings.TrimRight(m.URL, "/") + "/" + url.PathEscape(m.Domain) + "/messages"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth("api", m.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mailgun responded with %s: %s", resp.Status, readErrorBody(resp.Body))
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode mailgun response: %w", err)
+	}
+	return result.ID, nil
+}
+
+// readErrorBody — начало ответа провайдера для сообщения об ошибке
+func readErrorBody(r io.Reader) string {
+	raw, _ := io.ReadAll(io.LimitReader(r, 512))
+	return strings.TrimSpace(string(raw))
+}
+
+// Журнал отправок хранит последние письма; он нужен, чтобы разбирать жалобы «письмо не пришло»
+const emailDeliveryLogSize = 1000
+
+type emailDeliveryLog struct {
+	mu         sync.Mutex
+	deliveries []storage.EmailDelivery
+}
+
+var emailDeliveries = &emailDeliveryLog{}
+
+func (l *emailDeliveryLog) add(d storage.EmailDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, d)
+	if len(l.deliveries) > emailDeliveryLogSize {
+		l.deliveries = append([]storage.EmailDelivery(nil), l.deliveries[len(l.deliveries)-emailDeliveryLogSize:]...)
+	}
+}
+
+// EmailDeliveries — последние отправки, новые сверху; status и to сужают выборку
+func EmailDeliveries(status, to string) []storage.EmailDelivery {
+	emailDeliveries.mu.Lock()
+	defer emailDeliveries.mu.Unlock()
+	result := make([]storage.EmailDelivery, 0)
+	for i := len(emailDeliveries.deliveries) - 1; i >= 0; i-- {
+		d := emailDeliveries.deliveries[i]
+		if (status == "" || d.Status == status) && (to == "" || strings.EqualFold(d.To, to)) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// sendMailContext повторяет smtp.SendMail, но соединение открывается через DialContext
+// и закрывается при отмене контекста, а дедлайн контекста ограничивает весь SMTP-диалог
+func sendMailContext(ctx context.Context, addr string, auth smtp.Auth, from, to string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// merchantKeyPrefix отличает ключи мерчантов от прочих токенов в логах и заголовках
+const merchantKeyPrefix = "mk_"
+
+// RegisterMerchant подключает торговую точку к эквайрингу; оплаты будут зачисляться на её расчётный счёт
+func (svc *Service) RegisterMerchant(ctx context.Context, req storage.RegisterMerchantRequest, now time.Time) (storage.Merchant, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return storage.Merchant{}, invalidInputf("merchant name is required")
+	}
+	if _, ok := svc.GetUser(ctx, req.UserID); !ok {
+		return storage.Merchant{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeUserNotFound, Message: "user not found"}
+	}
+	if req.SettlementAccountID == "" {
+		return storage.Merchant{}, invalidInputf("settlement_account_id is required")
+	}
+
+	merchant := storage.Merchant{
+		ID:                  storage.GenerateID(),
+		UserID:              req.UserID,
+		Name:                name,
+		Category:            req.Category,
+		SettlementAccountID: req.SettlementAccountID,
+		Active:              true,
+		CreatedAt:           now,
+	}
+	if err := svc.AddMerchant(ctx, merchant); err != nil {
+		return storage.Merchant{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "merchant.register",
+		Details: map[string]string{
+			"merchant_id":           merchant.ID,
+			"user_id":               merchant.UserID,
+			"settlement_account_id": merchant.SettlementAccountID,
+		},
+	})
+	return merchant, nil
+}
+
+// IssueMerchantAPIKey выпускает новый ключ; открытое значение возвращается только здесь
+func (svc *Service) IssueMerchantAPIKey(ctx context.Context, merchantID string, now time.Time) (storage.MerchantAPIKey, string, error) {
+	secret := merchantKeyPrefix + storage.GenerateToken()
+	key := storage.MerchantAPIKey{
+		ID:         storage.GenerateID(),
+		MerchantID: merchantID,
+		Prefix:     secret[:len(merchantKeyPrefix)+8],
+		KeyHash:    sha256Hex(secret),
+		CreatedAt:  now,
+	}
+	if err := svc.AddMerchantAPIKey(ctx, key); err != nil {
+		return storage.MerchantAPIKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+func (svc *Service) AuthenticateMerchant(ctx context.Context, secret string, now time.Time) (storage.Merchant, error) {
+	if !strings.HasPrefix(secret, merchantKeyPrefix) {
+		return storage.Merchant{}, invalidInputf("malformed merchant key")
+	}
+	return svc.AuthenticateMerchantKey(ctx, sha256Hex(secret), now)
+}
+
+// PaymentMerchant возвращает активного мерчанта, указанного в платеже
+func (svc *Service) PaymentMerchant(ctx context.Context, merchantID string) (storage.Merchant, error) {
+	merchant, ok := svc.GetMerchant(ctx, merchantID)
+	if !ok {
+		return storage.Merchant{}, &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("merchant %s not found", merchantID)}
+	}
+	if !merchant.Active {
+		return storage.Merchant{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("merchant %s does not accept payments", merchantID)}
+	}
+	return merchant, nil
+}
+
+// MerchantPayments — оплаты, возвраты и чарджбэки мерчанта за период [from, to]
+func (svc *Service) MerchantPayments(ctx context.Context, merchantID string, from, to time.Time) []storage.Transaction {
+	var txs []storage.Transaction
+	for _, tx := range svc.GetMerchantTransactions(ctx, merchantID) {
+		if tx.BookedAt().Before(from) || tx.BookedAt().After(to) {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// MerchantSettlements сворачивает оплаты мерчанта в дневные итоги по валюте расчётного счёта
+func (svc *Service) MerchantSettlements(ctx context.Context, merchant storage.Merchant, from, to time.Time) []storage.MerchantSettlement {
+	currency := ""
+	if acc, ok := svc.GetAccount(ctx, merchant.SettlementAccountID); ok {
+		currency = acc.Currency
+	}
+
+	byDate := make(map[string]*storage.MerchantSettlement)
+	for _, tx := range svc.MerchantPayments(ctx, merchant.ID, from, to) {
+		date := tx.BookedAt().Format("2006-01-02")
+		day, ok := byDate[date]
+		if !ok {
+			day = &storage.MerchantSettlement{Date: date, Currency: currency, Gross: decimal.Zero, Refunds: decimal.Zero, Chargebacks: decimal.Zero, Net: decimal.Zero}
+			byDate[date] = day
+		}
+		switch tx.TransactionType {
+		case "payment":
+			day.Payments++
+			day.Gross = day.Gross.Add(tx.Amount)
+		case "refund":
+			day.Refunds = day.Refunds.Add(tx.Amount)
+		case "chargeback":
+			day.Chargebacks = day.Chargebacks.Add(tx.Amount)
+		}
+		day.Net = day.Gross.Sub(day.Refunds).Sub(day.Chargebacks)
+	}
+
+	settlements := make([]storage.MerchantSettlement, 0, len(byDate))
+	for _, day := range byDate {
+		settlements = append(settlements, *day)
+	}
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].Date < settlements[j].Date })
+	return settlements
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var MerchantSpendingConfig = struct {
+	DefaultTop int
+	MaxTop     int
+}{
+	DefaultTop: 10,
+	MaxTop:     100,
+}
+
+// Порядок мерчантов в аналитике расходов
+const (
+	MerchantSortTotal   = "total"
+	MerchantSortCount   = "count"
+	MerchantSortAverage = "average"
+)
+
+// ParseMerchantSpendingQuery проверяет top (пусто — MerchantSpendingConfig.DefaultTop) и sort (пусто — total)
+func ParseMerchantSpendingQuery(topParam, sortParam string) (int, string, error) {
+	top := MerchantSpendingConfig.DefaultTop
+	if topParam != "" {
+		if _, err := fmt.Sscanf(topParam, "%d", &top); err != nil || top < 1 || top > MerchantSpendingConfig.MaxTop {
+			return 0, "", fmt.Errorf("top must be between 1 and %d", MerchantSpendingConfig.MaxTop)
+		}
+	}
+	switch sortParam {
+	case "":
+		sortParam = MerchantSortTotal
+	case MerchantSortTotal, MerchantSortCount, MerchantSortAverage:
+	default:
+		return 0, "", fmt.Errorf("sort must be one of %s, %s, %s", MerchantSortTotal, MerchantSortCount, MerchantSortAverage)
+	}
+	return top, sortParam, nil
+}
+
+// UserMerchantSpending группирует оплаты картой со счетов клиента за период по мерчантам: зарегистрированные —
+// по ID, остальные — по названию. Возвраты и чарджбэки за тот же период уменьшают сумму мерчанта, у которого
+// в периоде были оплаты. Суммы приводятся к рублям по текущему курсу; в ответ попадают top первых по sortBy.
+func (svc *Service) UserMerchantSpending(ctx context.Context, userID string, from, to time.Time, top int, sortBy string) storage.MerchantSpending {
+	result := storage.MerchantSpending{
+		UserID:    userID,
+		From:      from,
+		To:        to,
+		Currency:  storage.BaseCurrency,
+		Sort:      sortBy,
+		Total:     decimal.Zero,
+		Merchants: make([]storage.MerchantSpend, 0),
+	}
+
+	byMerchant := make(map[string]*storage.MerchantSpend)
+	refunds := make(map[string]decimal.Decimal)
+	for _, acc := range svc.GetUserAccounts(ctx, userID) {
+		for _, tx := range svc.GetAccountTransactions(ctx, acc.ID) {
+			date := tx.EffectiveDate()
+			if tx.Merchant == "" || date.Before(from) || date.After(to) {
+				continue
+			}
+			key := tx.MerchantID
+			if key == "" {
+				key = tx.Merchant
+			}
+			switch {
+			case tx.TransactionType == "payment" && tx.FromAccountID == acc.ID:
+			case (tx.TransactionType == "refund" || tx.TransactionType == "chargeback") && tx.ToAccountID == acc.ID:
+			default:
+				continue
+			}
+			amount, err := svc.toBaseCurrency(ctx, tx.Amount, acc.Currency)
+			if err != nil {
+				log.Printf("Merchant spending: %s operation %s excluded: %v", acc.Currency, tx.ID, err)
+				continue
+			}
+			if tx.TransactionType != "payment" {
+				refunds[key] = refunds[key].Add(amount)
+				continue
+			}
+
+			m, ok := byMerchant[key]
+			if !ok {
+				m = &storage.MerchantSpend{MerchantID: tx.MerchantID, Name: tx.Merchant, Gross: decimal.Zero, Refunded: decimal.Zero}
+				byMerchant[key] = m
+			}
+			m.Payments++
+			m.Gross = m.Gross.Add(amount)
+			if tx.Category != "" {
+				m.Category = tx.Category
+			}
+			if tx.Timestamp.After(m.LastPaymentAt) {
+				m.LastPaymentAt = tx.Timestamp
+			}
+		}
+	}
+
+	for key, m := range byMerchant {
+		m.Gross = m.Gross.RoundBank(2)
+		m.Refunded = refunds[key].RoundBank(2)
+		m.Total = m.Gross.Sub(m.Refunded)
+		m.Average = m.Gross.Div(decimal.NewFromInt(int64(m.Payments))).RoundBank(2)
+		result.Payments += m.Payments
+		result.Total = result.Total.Add(m.Total)
+		result.Merchants = append(result.Merchants, *m)
+	}
+	for i := range result.Merchants {
+		if m := &result.Merchants[i]; result.Total.IsPositive() {
+			m.Share = m.Total.Div(result.Total).Mul(decimal.NewFromInt(100)).Round(1)
+		}
+	}
+
+	sort.Slice(result.Merchants, func(i, j int) bool {
+		a, b := result.Merchants[i], result.Merchants[j]
+		switch {
+		case sortBy == MerchantSortCount && a.Payments != b.Payments:
+			return a.Payments > b.Payments
+		case sortBy == MerchantSortAverage && !a.Average.Equal(b.Average):
+			return a.Average.GreaterThan(b.Average)
+		case !a.Total.Equal(b.Total):
+			return a.Total.GreaterThan(b.Total)
+		}
+		return a.Name < b.Name
+	})
+	if len(result.Merchants) > top {
+		result.Merchants = result.Merchants[:top]
+	}
+	return result
+}
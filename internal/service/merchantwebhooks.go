@@ -0,0 +1,274 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var MerchantWebhookConfig = struct {
+	RetryDelays []time.Duration // паузы перед повторными попытками; после последней событие считается недоставленным
+	SecretGrace time.Duration   // сколько старый секрет продолжает подписывать запросы после ротации
+}{
+	RetryDelays: []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute},
+	SecretGrace: 24 * time.Hour,
+}
+
+// MerchantEventTypes — события, на которые мерчант может подписать свой вебхук
+var MerchantEventTypes = []string{
+	storage.ChargeAuthorized,
+	storage.ChargeCaptured,
+	storage.ChargeVoided,
+	storage.ChargeRefunded,
+	storage.ChargeDisputeOpened,
+	storage.ChargeChargeback,
+}
+
+func isMerchantEventType(eventType string) bool {
+	for _, t := range MerchantEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func merchantWebhookNotFound(merchantID string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("merchant %s has no webhook configured", merchantID)}
+}
+
+// SetMerchantWebhook создаёт или меняет вебхук мерчанта. Секрет генерируется только при создании
+// и возвращается один раз; при изменении адреса или событий он остаётся прежним.
+func (svc *Service) SetMerchantWebhook(ctx context.Context, merchantID string, req storage.MerchantWebhookRequest, now time.Time) (storage.MerchantWebhook, string, error) {
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return storage.MerchantWebhook{}, "", invalidInputf("webhook url must be an absolute http(s) URL")
+	}
+	for _, eventType := range req.Events {
+		if !isMerchantEventType(eventType) {
+			return storage.MerchantWebhook{}, "", invalidInputf("unknown event type %s", eventType)
+		}
+	}
+
+	hook, exists := svc.GetMerchantWebhook(ctx, merchantID)
+	secret := ""
+	if !exists {
+		secret = storage.GenerateToken()
+		hook = storage.MerchantWebhook{MerchantID: merchantID, Secret: secret, Active: true, CreatedAt: now}
+	}
+	hook.URL = req.URL
+	hook.Events = req.Events
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	hook.UpdatedAt = now
+	if err := svc.Repository.SetMerchantWebhook(ctx, hook); err != nil {
+		return storage.MerchantWebhook{}, "", err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     merchantID,
+		Action:    "merchant.webhook_set",
+		Details:   map[string]string{"merchant_id": merchantID, "url": hook.URL},
+	})
+	return hook, secret, nil
+}
+
+// RotateMerchantWebhookSecret выдаёт новый секрет; старый ещё SecretGrace подписывает запросы
+// в X-Webhook-Signature-Previous, чтобы мерчант успел переключить проверку без потери событий
+func (svc *Service) RotateMerchantWebhookSecret(ctx context.Context, merchantID string, now time.Time) (storage.MerchantWebhook, string, error) {
+	hook, ok := svc.GetMerchantWebhook(ctx, merchantID)
+	if !ok {
+		return storage.MerchantWebhook{}, "", merchantWebhookNotFound(merchantID)
+	}
+	expiresAt := now.Add(MerchantWebhookConfig.SecretGrace)
+	secret := storage.GenerateToken()
+	hook.PreviousSecret = hook.Secret
+	hook.PreviousSecretExpiresAt = &expiresAt
+	hook.Secret = secret
+	hook.UpdatedAt = now
+	if err := svc.Repository.SetMerchantWebhook(ctx, hook); err != nil {
+		return storage.MerchantWebhook{}, "", err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     merchantID,
+		Action:    "merchant.webhook_rotate_secret",
+		Details:   map[string]string{"merchant_id": merchantID},
+	})
+	return hook, secret, nil
+}
+
+// DeliverMerchantEvent — одна попытка доставки. Подпись та же, что у вебхуков пользователей;
+// в период ротации запрос дополнительно подписан старым секретом.
+func DeliverMerchantEvent(ctx context.Context, hook storage.MerchantWebhook, event storage.MerchantEvent, attempt int, test bool) storage.MerchantWebhookDelivery {
+	delivery := storage.MerchantWebhookDelivery{
+		ID:         storage.GenerateID(),
+		MerchantID: hook.MerchantID,
+		EventID:    event.ID,
+		EventType:  event.Type,
+		URL:        hook.URL,
+		Attempt:    attempt,
+		Test:       test,
+		SentAt:     time.Now(),
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	timestamp := strconv.FormatInt(delivery.SentAt.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Id", event.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(hook.Secret, timestamp, body))
+	if hook.PreviousSecret != "" && hook.PreviousSecretExpiresAt != nil && delivery.SentAt.Before(*hook.PreviousSecretExpiresAt) {
+		req.Header.Set("X-Webhook-Signature-Previous", SignWebhookPayload(hook.PreviousSecret, timestamp, body))
+	}
+	if test {
+		req.Header.Set("X-Webhook-Test", "true")
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("merchant responded with status %d", resp.StatusCode)
+	}
+	return delivery
+}
+
+// NotifyMerchant асинхронно доставляет событие на вебхук мерчанта с повторами по RetryDelays.
+// Каждая попытка попадает в журнал доставок; мерчант без вебхука или не подписанный на тип пропускается.
+func (svc *Service) NotifyMerchant(ctx context.Context, merchantID, eventType string, data map[string]interface{}) {
+	if merchantID == "" {
+		return
+	}
+	hook, ok := svc.GetMerchantWebhook(ctx, merchantID)
+	if !ok || !hook.Active || !hook.Accepts(eventType) {
+		return
+	}
+	event := storage.MerchantEvent{
+		ID:         storage.GenerateID(),
+		Type:       eventType,
+		MerchantID: merchantID,
+		Data:       data,
+		CreatedAt:  time.Now(),
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for attempt := 1; ; attempt++ {
+			delivery := DeliverMerchantEvent(ctx, hook, event, attempt, false)
+			svc.AddMerchantWebhookDelivery(ctx, delivery)
+			if delivery.Success {
+				return
+			}
+			if attempt > len(MerchantWebhookConfig.RetryDelays) {
+				metrics.add(metricWebhookUndelivered, 1, "target", "merchant")
+				log.Printf("Merchant %s webhook: %s %s not delivered after %d attempts: %s", merchantID, event.Type, event.ID, attempt, delivery.Error)
+				return
+			}
+			time.Sleep(MerchantWebhookConfig.RetryDelays[attempt-1])
+		}
+	}()
+}
+
+// SendTestMerchantEvent синхронно отправляет пример события, чтобы мерчант проверил приём и подпись
+func (svc *Service) SendTestMerchantEvent(ctx context.Context, merchantID, eventType string) (storage.MerchantWebhookDelivery, error) {
+	if eventType == "" {
+		eventType = storage.ChargeCaptured
+	}
+	if !isMerchantEventType(eventType) {
+		return storage.MerchantWebhookDelivery{}, invalidInputf("unknown event type %s", eventType)
+	}
+	hook, ok := svc.GetMerchantWebhook(ctx, merchantID)
+	if !ok {
+		return storage.MerchantWebhookDelivery{}, merchantWebhookNotFound(merchantID)
+	}
+	event := storage.MerchantEvent{
+		ID:         storage.GenerateID(),
+		Type:       eventType,
+		MerchantID: merchantID,
+		Data:       chargeEventData(sampleTransaction()),
+		CreatedAt:  time.Now(),
+	}
+	delivery := DeliverMerchantEvent(ctx, hook, event, 1, true)
+	svc.AddMerchantWebhookDelivery(ctx, delivery)
+	return delivery, nil
+}
+
+func chargeEventData(tx storage.Transaction) map[string]interface{} {
+	return map[string]interface{}{
+		"transaction_id": tx.ID,
+		"amount":         tx.Amount,
+		"category":       tx.Category,
+		"timestamp":      tx.Timestamp,
+	}
+}
+
+func holdEventData(hold storage.Hold) map[string]interface{} {
+	data := map[string]interface{}{
+		"authorization_id": hold.ID,
+		"amount":           hold.Amount,
+		"status":           hold.Status,
+		"expires_at":       hold.ExpiresAt,
+	}
+	if hold.CaptureTxID != "" {
+		data["transaction_id"] = hold.CaptureTxID
+		data["captured_amount"] = hold.CapturedAmt
+	}
+	return data
+}
+
+func chargebackEventData(cb storage.Chargeback) map[string]interface{} {
+	data := map[string]interface{}{
+		"chargeback_id":  cb.ID,
+		"transaction_id": cb.TransactionID,
+		"amount":         cb.Amount,
+		"held_amount":    cb.HeldAmount,
+		"reason":         cb.Reason,
+		"status":         cb.Status,
+	}
+	if cb.ResolvedAt != nil {
+		data["outcome"] = cb.Status
+		data["resolution"] = cb.Resolution
+	}
+	return data
+}
+
+// NotifyChargeEvent — событие по проведённой оплате или возврату мерчанта
+func (svc *Service) NotifyChargeEvent(ctx context.Context, eventType string, tx storage.Transaction) {
+	data := chargeEventData(tx)
+	if tx.LinkedTxID != "" {
+		data["original_transaction_id"] = tx.LinkedTxID
+	}
+	svc.NotifyMerchant(ctx, tx.MerchantID, eventType, data)
+}
+
+// NotifyHoldEvent — событие по авторизации карты в пользу мерчанта
+func (svc *Service) NotifyHoldEvent(ctx context.Context, eventType string, hold storage.Hold) {
+	svc.NotifyMerchant(ctx, hold.MerchantID, eventType, holdEventData(hold))
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// Бизнес-метрики в текстовом формате Prometheus. Они показывают здоровье банка (просрочки, отказы антифрода,
+// недоставленные события, отставание фоновых задач), а не нагрузку на HTTP.
+const (
+	metricFraudDeclines         = "bankapp_fraud_declines_total"
+	metricWebhookUndelivered    = "bankapp_webhook_undelivered_total"
+	metricReconcileMismatches   = "bankapp_reconciliation_mismatches"
+	metricReconcileCorrections  = "bankapp_reconciliation_corrections_total"
+	metricLoans                 = "bankapp_loans"
+	metricLoanDelinquencies     = "bankapp_loan_delinquencies_total"
+	metricPaymentChallengesLost = "bankapp_payment_challenges_expired_total"
+	metricRateProviderFailures  = "bankapp_rate_provider_failures_total"
+	metricEmailDeadLetters      = "bankapp_email_dead_letters_total"
+	metricJobLag                = "bankapp_job_lag_seconds"
+	metricJobDuration           = "bankapp_job_duration_seconds"
+	metricJobLastRun            = "bankapp_job_last_run_timestamp_seconds"
+	metricCacheHits             = "bankapp_storage_cache_hits_total"
+	metricCacheMisses           = "bankapp_storage_cache_misses_total"
+	metricCacheInvalidations    = "bankapp_storage_cache_invalidations_total"
+)
+
+type metricFamily struct {
+	name string
+	kind string // counter | gauge
+	help string
+}
+
+// metricFamilies — все метрики в порядке вывода
+var metricFamilies = []metricFamily{
+	{metricFraudDeclines, "counter", "Card payments declined by fraud checks, by scoring provider."},
+	{metricWebhookUndelivered, "counter", "Webhook events given up on: user webhooks after a failed attempt, merchant webhooks and Open Banking callbacks after all retries."},
+	{metricReconcileMismatches, "gauge", "Users whose cached financial summary mismatched the ledger at the last reconciliation run."},
+	{metricReconcileCorrections, "counter", "Financial summary corrections made by reconciliation."},
+	{metricLoans, "gauge", "Outstanding loans by repayment status."},
+	{metricLoanDelinquencies, "counter", "Loans that became delinquent or defaulted."},
+	{metricPaymentChallengesLost, "counter", "3-D Secure card payments cancelled because they were not confirmed in time."},
+	{metricRateProviderFailures, "counter", "Failed key rate requests by provider; the next provider in order was tried."},
+	{metricEmailDeadLetters, "counter", "Email notifications moved to the dead-letter list after all retries."},
+	{metricJobLag, "gauge", "Delay between the scheduled and the actual start of the last run of a daily job."},
+	{metricJobDuration, "gauge", "Duration of the last run of a daily job."},
+	{metricJobLastRun, "gauge", "Unix time when a daily job last finished."},
+	{metricCacheHits, "counter", "Storage lookups served from the read cache, by collection."},
+	{metricCacheMisses, "counter", "Storage lookups that missed the read cache and went to the storage backend, by collection."},
+	{metricCacheInvalidations, "counter", "Read cache entries dropped because the record was written, by collection."},
+}
+
+type metricsRegistry struct {
+	mu     sync.Mutex
+	values map[string]map[string]float64 // имя -> метки в формате {k="v"} -> значение
+}
+
+var metrics = newMetricsRegistry()
+
+// newMetricsRegistry заводит счётчики с известными метками нулями, чтобы правила алертов видели ряд до первого события
+func newMetricsRegistry() *metricsRegistry {
+	m := &metricsRegistry{values: make(map[string]map[string]float64)}
+	for _, provider := range []string{storage.FraudProviderRules, storage.FraudProviderExternal} {
+		m.add(metricFraudDeclines, 0, "provider", provider)
+	}
+	for _, target := range []string{"user", "merchant", "openbanking"} {
+		m.add(metricWebhookUndelivered, 0, "target", target)
+	}
+	for _, status := range []string{storage.LoanDelinquent, storage.LoanDefault} {
+		m.add(metricLoanDelinquencies, 0, "status", status)
+	}
+	for _, provider := range RateProviderConfig.Providers {
+		if provider = strings.ToLower(strings.TrimSpace(provider)); provider != "" {
+			m.add(metricRateProviderFailures, 0, "provider", provider)
+		}
+	}
+	m.add(metricReconcileCorrections, 0)
+	m.add(metricPaymentChallengesLost, 0)
+	m.add(metricEmailDeadLetters, 0)
+	return m
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabels собирает метки из пар ключ-значение
+func metricLabels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], metricLabelEscaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (m *metricsRegistry) series(name string) map[string]float64 {
+	series, ok := m.values[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.values[name] = series
+	}
+	return series
+}
+
+func (m *metricsRegistry) add(name string, delta float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name)[metricLabels(labels...)] += delta
+}
+
+func (m *metricsRegistry) set(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name)[metricLabels(labels...)] = value
+}
+
+// replace заменяет все серии метрики; нужно для показателей, которые пересчитываются целиком при выгрузке
+func (m *metricsRegistry) replace(name string, series map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name] = series
+}
+
+func (m *metricsRegistry) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, family := range metricFamilies {
+		series := m.values[family.name]
+		if len(series) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind); err != nil {
+			return err
+		}
+		labels := make([]string, 0, len(series))
+		for l := range series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", family.name, l, formatMetricValue(series[l])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// WriteMetrics пересчитывает показатели по текущему состоянию хранилища и выгружает все метрики
+func (svc *Service) WriteMetrics(ctx context.Context, w io.Writer) error {
+	loans := map[string]float64{
+		metricLabels("status", storage.LoanCurrent):    0,
+		metricLabels("status", storage.LoanDelinquent): 0,
+		metricLabels("status", storage.LoanDefault):    0,
+	}
+	for _, loan := range svc.ListLoans(ctx) {
+		if !loan.RemainingAmount.IsPositive() {
+			continue
+		}
+		status := loan.Status
+		if status == "" {
+			status = storage.LoanCurrent
+		}
+		loans[metricLabels("status", status)]++
+	}
+	metrics.replace(metricLoans, loans)
+	if cache, ok := svc.Repository.(storage.CacheReporter); ok {
+		hits, misses, invalidations := map[string]float64{}, map[string]float64{}, map[string]float64{}
+		for collection, stats := range cache.CacheStats() {
+			labels := metricLabels("collection", collection)
+			hits[labels] = float64(stats.Hits)
+			misses[labels] = float64(stats.Misses)
+			invalidations[labels] = float64(stats.Invalidations)
+		}
+		metrics.replace(metricCacheHits, hits)
+		metrics.replace(metricCacheMisses, misses)
+		metrics.replace(metricCacheInvalidations, invalidations)
+	}
+	return metrics.write(w)
+}
+
+// observeDailyJob запускает задачу и записывает её отставание от расписания, длительность и время завершения
+func observeDailyJob(ctx context.Context, name string, scheduled time.Time, fn func(ctx context.Context, now time.Time)) {
+	started := time.Now()
+	metrics.set(metricJobLag, started.Sub(scheduled).Seconds(), "job", name)
+	fn(ctx, started)
+	finished := time.Now()
+	metrics.set(metricJobDuration, finished.Sub(started).Seconds(), "job", name)
+	metrics.set(metricJobLastRun, float64(finished.Unix()), "job", name)
+}
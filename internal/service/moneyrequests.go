@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var MoneyRequestConfig = struct {
+	DefaultTTL     time.Duration // срок ответа плательщика, если запросивший его не указал
+	MaxTTL         time.Duration
+	MaxDescription int
+	MaxPending     int // ожидающих ответа исходящих запросов на пользователя — защита от спама
+}{
+	DefaultTTL:     3 * 24 * time.Hour,
+	MaxTTL:         30 * 24 * time.Hour,
+	MaxDescription: 140,
+	MaxPending:     20,
+}
+
+func moneyRequestNotFound(id string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodePaymentRequestNotFound, Message: fmt.Sprintf("payment request %s not found", id)}
+}
+
+// displayName — имя пользователя для второй стороны: ФИО из профиля, иначе логин
+func displayName(user storage.User) string {
+	if user.Profile != nil && user.Profile.FullName != "" {
+		return user.Profile.FullName
+	}
+	return user.Username
+}
+
+// notifyMoneyRequest сообщает стороне запроса об изменении: письмом и событием payment_request.updated
+func (svc *Service) notifyMoneyRequest(ctx context.Context, userID string, pr storage.MoneyRequest, subject, message string, now time.Time) {
+	svc.events.Publish(storage.Event{
+		Type:   storage.EventPaymentRequest,
+		UserID: userID,
+		Payload: map[string]interface{}{
+			"payment_request_id": pr.ID,
+			"status":             pr.Status,
+			"amount":             pr.Amount,
+			"currency":           pr.Currency,
+			"requester_name":     pr.RequesterName,
+			"description":        pr.Description,
+		},
+		Timestamp: now,
+	})
+	if user, ok := svc.GetUser(ctx, userID); ok {
+		svc.QueueEmail(ctx, user.Email, "Simple Bank: "+subject, fmt.Sprintf("Hello %s,\n\n%s", user.Username, message))
+	}
+}
+
+func (svc *Service) auditMoneyRequest(ctx context.Context, actor, action string, pr storage.MoneyRequest, now time.Time) {
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    action,
+		Details:   map[string]string{"payment_request_id": pr.ID, "amount": pr.Amount.String(), "currency": pr.Currency},
+	})
+}
+
+// CreateMoneyRequest запрашивает деньги у пользователя, найденного по телефону или логину, на счёт запросившего
+func (svc *Service) CreateMoneyRequest(ctx context.Context, req storage.CreateMoneyRequestRequest, now time.Time) (storage.MoneyRequest, error) {
+	account, ok := svc.GetAccount(ctx, req.AccountID)
+	if !ok {
+		return storage.MoneyRequest{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("account %s not found", req.AccountID)}
+	}
+	if account.IsClosed() {
+		return storage.MoneyRequest{}, &storage.StorageError{Kind: storage.ErrConflict, Code: storage.CodeAccountClosed, Message: fmt.Sprintf("account %s is closed", account.ID)}
+	}
+	if !req.Amount.IsPositive() {
+		return storage.MoneyRequest{}, invalidInputf("requested amount must be positive")
+	}
+	if err := storage.ValidateAmount(req.Amount, account.Currency); err != nil {
+		return storage.MoneyRequest{}, err
+	}
+	description := strings.TrimSpace(req.Description)
+	if len([]rune(description)) > MoneyRequestConfig.MaxDescription {
+		return storage.MoneyRequest{}, invalidInputf("description must be at most %d characters", MoneyRequestConfig.MaxDescription)
+	}
+	ttl := MoneyRequestConfig.DefaultTTL
+	switch {
+	case req.ExpiresInHours < 0:
+		return storage.MoneyRequest{}, invalidInputf("expires_in_hours must be positive")
+	case req.ExpiresInHours > 0:
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl > MoneyRequestConfig.MaxTTL {
+		return storage.MoneyRequest{}, invalidInputf("payment request must expire within %d days", int(MoneyRequestConfig.MaxTTL.Hours()/24))
+	}
+
+	_, _, payer, err := svc.ResolveAlias(ctx, req.Payer)
+	if err != nil {
+		return storage.MoneyRequest{}, err
+	}
+	if payer.ID == account.UserID {
+		return storage.MoneyRequest{}, invalidInputf("cannot request money from yourself")
+	}
+	pending := 0
+	for _, pr := range svc.ListMoneyRequests(ctx, account.UserID, "outgoing") {
+		if pr.StatusAt(now) == storage.MoneyRequestPending {
+			pending++
+		}
+	}
+	if pending >= MoneyRequestConfig.MaxPending {
+		return storage.MoneyRequest{}, &storage.StorageError{Kind: storage.ErrQuotaExceeded, Message: fmt.Sprintf("at most %d payment requests may await an answer", MoneyRequestConfig.MaxPending)}
+	}
+
+	requester, _ := svc.GetUser(ctx, account.UserID)
+	pr := storage.MoneyRequest{
+		ID:              storage.GenerateID(),
+		RequesterUserID: account.UserID,
+		RequesterName:   displayName(requester),
+		AccountID:       account.ID,
+		PayerUserID:     payer.ID,
+		Amount:          storage.NormalizeAmount(req.Amount, account.Currency),
+		Currency:        account.Currency,
+		Description:     description,
+		Status:          storage.MoneyRequestPending,
+		ExpiresAt:       now.Add(ttl),
+		CreatedAt:       now,
+	}
+	if err := svc.AddMoneyRequest(ctx, pr); err != nil {
+		return storage.MoneyRequest{}, err
+	}
+
+	svc.auditMoneyRequest(ctx, pr.RequesterUserID, "payment_request.create", pr, now)
+	svc.notifyMoneyRequest(ctx, pr.PayerUserID, pr, "money requested",
+		fmt.Sprintf("%s asks you to pay %s %s%s. The request is valid until %s.", pr.RequesterName, pr.Amount.StringFixed(2), pr.Currency,
+			descriptionSuffix(pr.Description), pr.ExpiresAt.Format("2006-01-02 15:04 MST")), now)
+	log.Printf("Payment request %s for %s %s from user %s to user %s", pr.ID, pr.Amount.String(), pr.Currency, pr.PayerUserID, pr.RequesterUserID)
+	return pr, nil
+}
+
+func descriptionSuffix(description string) string {
+	if description == "" {
+		return ""
+	}
+	return " for \"" + description + "\""
+}
+
+// MoneyRequestFor — запрос со статусом на момент now; виден только его сторонам (пустой userID — без проверки)
+func (svc *Service) MoneyRequestFor(ctx context.Context, id, userID string, now time.Time) (storage.MoneyRequest, error) {
+	pr, ok := svc.GetMoneyRequest(ctx, id)
+	if !ok || (userID != "" && userID != pr.RequesterUserID && userID != pr.PayerUserID) {
+		return storage.MoneyRequest{}, moneyRequestNotFound(id)
+	}
+	pr.Status = pr.StatusAt(now)
+	return pr, nil
+}
+
+// AcceptMoneyRequest исполняет запрос переводом со счёта плательщика; лимиты проверяются как у обычного перевода
+func (svc *Service) AcceptMoneyRequest(ctx context.Context, id, userID string, req storage.AcceptMoneyRequestRequest, sig storage.DeviceSignature, now time.Time) (storage.MoneyRequest, storage.Transaction, error) {
+	pr, ok := svc.GetMoneyRequest(ctx, id)
+	if !ok || pr.PayerUserID != userID {
+		return storage.MoneyRequest{}, storage.Transaction{}, moneyRequestNotFound(id)
+	}
+	from, ok := svc.GetAccount(ctx, req.FromAccountID)
+	if !ok || from.UserID != userID {
+		return storage.MoneyRequest{}, storage.Transaction{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("source account %s not found", req.FromAccountID)}
+	}
+	if pr.StatusAt(now) == storage.MoneyRequestPending {
+		releaseLimit, err := svc.ReserveTransferLimit(ctx, from, pr.Amount, now)
+		if err != nil {
+			return storage.MoneyRequest{}, storage.Transaction{}, err
+		}
+		defer releaseLimit()
+		var to *storage.Account
+		if acc, ok := svc.GetAccount(ctx, pr.AccountID); ok {
+			to = &acc
+		}
+		if err := svc.CheckTierLimits(ctx, &from, to, pr.Amount, now); err != nil {
+			return storage.MoneyRequest{}, storage.Transaction{}, err
+		}
+	}
+	deviceKey, err := svc.RequireTransferSignature(ctx, from, pr.ID, pr.Amount, sig, now)
+	if err != nil {
+		return storage.MoneyRequest{}, storage.Transaction{}, err
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpP2PTransfer, pr.Amount, pr.Currency, now)
+	if err != nil {
+		return storage.MoneyRequest{}, storage.Transaction{}, err
+	}
+
+	pr, tx, err := svc.Repository.AcceptMoneyRequest(ctx, id, from.ID, storage.Transaction{ID: storage.GenerateID(), Timestamp: now}, now)
+	if err != nil {
+		release()
+		return storage.MoneyRequest{}, storage.Transaction{}, err
+	}
+	if deviceKey != nil {
+		svc.AuditSignedTransfer(ctx, *deviceKey, tx.ID, sig, from, pr.ID, pr.Amount, now)
+	}
+
+	svc.auditMoneyRequest(ctx, userID, "payment_request.accept", pr, now)
+	svc.notifyMoneyRequest(ctx, pr.RequesterUserID, pr, "payment request accepted",
+		fmt.Sprintf("Your request for %s %s%s has been paid.", pr.Amount.StringFixed(2), pr.Currency, descriptionSuffix(pr.Description)), now)
+	log.Printf("Payment request %s accepted from account %s (transaction %s)", pr.ID, from.ID, tx.ID)
+	return pr, tx, nil
+}
+
+// DeclineMoneyRequest — отказ плательщика; запросивший получает уведомление с причиной
+func (svc *Service) DeclineMoneyRequest(ctx context.Context, id, userID, reason string, now time.Time) (storage.MoneyRequest, error) {
+	if pr, ok := svc.GetMoneyRequest(ctx, id); !ok || pr.PayerUserID != userID {
+		return storage.MoneyRequest{}, moneyRequestNotFound(id)
+	}
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > MoneyRequestConfig.MaxDescription {
+		return storage.MoneyRequest{}, invalidInputf("reason must be at most %d characters", MoneyRequestConfig.MaxDescription)
+	}
+	pr, err := svc.CloseMoneyRequest(ctx, id, storage.MoneyRequestDeclined, reason, now)
+	if err != nil {
+		return storage.MoneyRequest{}, err
+	}
+	svc.auditMoneyRequest(ctx, userID, "payment_request.decline", pr, now)
+	message := fmt.Sprintf("Your request for %s %s%s has been declined.", pr.Amount.StringFixed(2), pr.Currency, descriptionSuffix(pr.Description))
+	if reason != "" {
+		message += " Reason: " + reason
+	}
+	svc.notifyMoneyRequest(ctx, pr.RequesterUserID, pr, "payment request declined", message, now)
+	return pr, nil
+}
+
+// CancelMoneyRequest — запросивший отзывает запрос, пока плательщик не ответил
+func (svc *Service) CancelMoneyRequest(ctx context.Context, id, userID string, now time.Time) (storage.MoneyRequest, error) {
+	if pr, ok := svc.GetMoneyRequest(ctx, id); !ok || pr.RequesterUserID != userID {
+		return storage.MoneyRequest{}, moneyRequestNotFound(id)
+	}
+	pr, err := svc.CloseMoneyRequest(ctx, id, storage.MoneyRequestCancelled, "", now)
+	if err != nil {
+		return storage.MoneyRequest{}, err
+	}
+	svc.auditMoneyRequest(ctx, userID, "payment_request.cancel", pr, now)
+	svc.notifyMoneyRequest(ctx, pr.PayerUserID, pr, "payment request cancelled",
+		fmt.Sprintf("%s has cancelled the request for %s %s%s.", pr.RequesterName, pr.Amount.StringFixed(2), pr.Currency, descriptionSuffix(pr.Description)), now)
+	return pr, nil
+}
+
+// UserMoneyRequests — запросы пользователя со статусом на момент now; role=incoming|outgoing, status — фильтр
+func (svc *Service) UserMoneyRequests(ctx context.Context, userID, role, status string, now time.Time) ([]storage.MoneyRequest, error) {
+	switch role {
+	case "", "incoming", "outgoing":
+	default:
+		return nil, invalidInputf("role must be incoming or outgoing")
+	}
+	switch status {
+	case "", storage.MoneyRequestPending, storage.MoneyRequestAccepted, storage.MoneyRequestDeclined, storage.MoneyRequestCancelled, storage.MoneyRequestExpired:
+	default:
+		return nil, invalidInputf("status must be one of pending, accepted, declined, cancelled, expired")
+	}
+	result := make([]storage.MoneyRequest, 0)
+	for _, pr := range svc.ListMoneyRequests(ctx, userID, role) {
+		pr.Status = pr.StatusAt(now)
+		if status == "" || pr.Status == status {
+			result = append(result, pr)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// ParseReportMonth проверяет месяц отчёта YYYY-MM: по умолчанию прошлый месяц, текущий — с начала месяца по сегодня
+func ParseReportMonth(param string, now time.Time) (time.Time, error) {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	if param != "" {
+		parsed, err := time.ParseInLocation("2006-01", param, now.Location())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid month, expected YYYY-MM")
+		}
+		month = parsed
+	}
+	if month.After(now) {
+		return time.Time{}, fmt.Errorf("month %s has not started yet", month.Format("2006-01"))
+	}
+	return month, nil
+}
+
+// BuildMonthlyReport собирает отчёт за месяц, начинающийся с month: остатки и обороты по счетам, доходы и расходы,
+// расходы по категориям и кредиты. Переводы между своими счетами не считаются ни доходом, ни расходом.
+func (svc *Service) BuildMonthlyReport(ctx context.Context, user storage.User, month, now time.Time) storage.MonthlyReport {
+	from := month
+	to := month.AddDate(0, 1, 0).Add(-time.Nanosecond)
+	if to.After(now) {
+		to = now
+	}
+	report := storage.MonthlyReport{
+		UserID:      user.ID,
+		HolderName:  user.Username,
+		Month:       month.Format("2006-01"),
+		From:        from,
+		To:          to,
+		Currency:    storage.BaseCurrency,
+		Accounts:    make([]storage.MonthlyReportAccount, 0),
+		Categories:  make([]storage.CategorySpending, 0),
+		GeneratedAt: now,
+	}
+	if user.Profile != nil && user.Profile.FullName != "" {
+		report.HolderName = user.Profile.FullName
+	}
+
+	accounts := svc.GetUserAccounts(ctx, user.ID)
+	own := make(map[string]bool, len(accounts))
+	for _, acc := range accounts {
+		own[acc.ID] = true
+	}
+
+	income, spending := map[string]decimal.Decimal{}, map[string]decimal.Decimal{}
+	categories := map[string]*storage.CategorySpending{}
+	for _, acc := range accounts {
+		if acc.CreatedAt.After(to) || (acc.ClosedAt != nil && acc.ClosedAt.Before(from)) {
+			continue
+		}
+		st := svc.BuildStatement(ctx, acc, from, to)
+		line := storage.MonthlyReportAccount{
+			AccountID:      acc.ID,
+			Number:         acc.Number,
+			Currency:       acc.Currency,
+			OpeningBalance: st.OpeningBalance,
+			ClosingBalance: st.ClosingBalance,
+			Income:         decimal.Zero,
+			Spending:       decimal.Zero,
+		}
+		for _, tx := range st.Transactions {
+			income, expense := externalFlow(tx, acc.ID, own)
+			if income {
+				line.Income = line.Income.Add(tx.Amount)
+			}
+			if !expense {
+				continue
+			}
+			line.Spending = line.Spending.Add(tx.Amount)
+			category := tx.TransactionType
+			if tx.TransactionType == "payment" {
+				category = tx.Category
+				if category == "" {
+					category = "other"
+				}
+			}
+			amount, err := svc.toBaseCurrency(ctx, tx.Amount, acc.Currency)
+			if err != nil {
+				log.Printf("Monthly report: %s spending excluded from categories: %v", acc.Currency, err)
+				continue
+			}
+			c, ok := categories[category]
+			if !ok {
+				c = &storage.CategorySpending{Category: category, Amount: decimal.Zero}
+				categories[category] = c
+			}
+			c.Amount = c.Amount.Add(amount)
+			c.Transactions++
+		}
+		income[acc.Currency] = income[acc.Currency].Add(line.Income)
+		spending[acc.Currency] = spending[acc.Currency].Add(line.Spending)
+		report.Accounts = append(report.Accounts, line)
+	}
+
+	report.Income = svc.overviewAmount(ctx, income).Total
+	report.Spending = svc.overviewAmount(ctx, spending).Total
+	report.Net = report.Income.Sub(report.Spending)
+
+	total := decimal.Zero
+	for _, c := range categories {
+		total = total.Add(c.Amount)
+	}
+	for _, c := range categories {
+		c.Amount = c.Amount.RoundBank(2)
+		if total.IsPositive() {
+			c.Share = c.Amount.Div(total).Mul(decimal.NewFromInt(100)).Round(1)
+		}
+		report.Categories = append(report.Categories, *c)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		a, b := report.Categories[i], report.Categories[j]
+		if !a.Amount.Equal(b.Amount) {
+			return a.Amount.GreaterThan(b.Amount)
+		}
+		return a.Category < b.Category
+	})
+
+	report.Loans, _ = svc.UserLoans(ctx, user.ID, "", true, now)
+	return report
+}
+
+// FormatMonthlyReportPDF — отчёт за месяц для печати: счета, доходы и расходы, диаграмма расходов по категориям и кредиты
+func FormatMonthlyReportPDF(report storage.MonthlyReport) []byte {
+	var doc pdfDocument
+	doc.Heading("Simple Bank")
+	doc.Bold("Monthly financial report for %s", report.Month)
+	doc.Blank()
+	doc.Text("Client:           %s", report.HolderName)
+	doc.Text("Period:           %s - %s", report.From.Format("02.01.2006"), report.To.Format("02.01.2006"))
+	doc.Blank()
+
+	doc.Bold("Accounts")
+	if len(report.Accounts) == 0 {
+		doc.Text("No accounts were open during the period.")
+	}
+	for _, acc := range report.Accounts {
+		doc.Text("%s, %s", acc.Number, acc.Currency)
+		doc.Text("    opening %s   in %s   out %s   closing %s", acc.OpeningBalance.StringFixed(2),
+			acc.Income.StringFixed(2), acc.Spending.StringFixed(2), acc.ClosingBalance.StringFixed(2))
+	}
+	doc.Blank()
+
+	doc.Bold("Income and spending, %s", report.Currency)
+	doc.Text("Income:           %s", report.Income.StringFixed(2))
+	doc.Text("Spending:         %s", report.Spending.StringFixed(2))
+	doc.Bold("Net:              %s", report.Net.StringFixed(2))
+	doc.Blank()
+
+	doc.Bold("Spending by category, %s", report.Currency)
+	if len(report.Categories) == 0 {
+		doc.Text("No spending during the period.")
+	} else {
+		largest := report.Categories[0].Amount
+		for _, c := range report.Categories {
+			ratio := 0.0
+			if largest.IsPositive() {
+				ratio = c.Amount.Div(largest).InexactFloat64()
+			}
+			doc.Bar(strings.ReplaceAll(c.Category, "_", " "), ratio, fmt.Sprintf("%s (%s%%)", c.Amount.StringFixed(2), c.Share.StringFixed(1)))
+		}
+	}
+	doc.Blank()
+
+	doc.Bold("Loans")
+	if len(report.Loans) == 0 {
+		doc.Text("No outstanding loans.")
+	}
+	for _, loan := range report.Loans {
+		next := "-"
+		if loan.NextPaymentDate != nil {
+			next = fmt.Sprintf("%s on %s", loan.NextPaymentAmount.StringFixed(2), loan.NextPaymentDate.Format("02.01.2006"))
+		}
+		doc.Text("Loan of %s at %s%%, status %s", loan.Amount.StringFixed(2), loan.InterestRate.String(), loan.Status)
+		doc.Text("    remaining %s, next payment %s", loan.RemainingAmount.StringFixed(2), next)
+		if loan.DaysPastDue > 0 {
+			doc.Text("    overdue %s for %d days", loan.OverdueAmount.StringFixed(2), loan.DaysPastDue)
+		}
+	}
+	doc.Blank()
+	doc.Text("Generated on %s. Amounts in %s are converted at the current exchange rate.", report.GeneratedAt.Format("02.01.2006"), report.Currency)
+	doc.Text("Transfers between your own accounts are not counted as income or spending.")
+	return doc.Bytes()
+}
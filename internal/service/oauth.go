@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var OAuthConfig = struct {
+	CodeTTL        time.Duration
+	AccessTokenTTL time.Duration
+}{
+	CodeTTL:        10 * time.Minute,
+	AccessTokenTTL: time.Hour,
+}
+
+// OAuthError — ошибка протокола OAuth2 (RFC 6749, раздел 5.2): отдаётся приложению как есть
+type OAuthError struct {
+	Code        string // invalid_request | invalid_client | invalid_grant | invalid_scope | unsupported_grant_type
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// ValidateOAuthClientSettings проверяет адреса возврата, scope и адрес callback, с которыми регистрируется
+// стороннее приложение
+func ValidateOAuthClientSettings(redirectURIs, scopes []string, callbackURL string) error {
+	urls := redirectURIs
+	if callbackURL != "" {
+		urls = append(append([]string(nil), redirectURIs...), callbackURL)
+	}
+	for _, uri := range urls {
+		u, err := url.Parse(uri)
+		if err != nil || u.Host == "" || u.Fragment != "" || (u.Scheme != "https" && u.Hostname() != "localhost") {
+			return invalidInputf("url %q must be an absolute https url without a fragment", uri)
+		}
+	}
+	for _, scope := range scopes {
+		if _, ok := storage.OAuthScopes[scope]; !ok {
+			return invalidInputf("unknown oauth scope %s", scope)
+		}
+	}
+	if len(scopes) > 0 && len(redirectURIs) == 0 {
+		return invalidInputf("redirect_uris are required for oauth scopes")
+	}
+	return nil
+}
+
+// OAuthConsentRequest проверяет запрос авторизации и возвращает, на что приложение просит согласие.
+// Ошибки здесь отдаются пользователю, а не на redirect_uri: адресу возврата ещё нельзя доверять.
+func (svc *Service) OAuthConsentRequest(ctx context.Context, userID string, req storage.OAuthAuthorizeRequest, now time.Time) (storage.OAuthConsent, error) {
+	client, ok := svc.GetAPIClient(ctx, req.ClientID)
+	if !ok || !client.Active || len(client.RedirectURIs) == 0 {
+		return storage.OAuthConsent{}, invalidInputf("unknown or inactive oauth client %s", req.ClientID)
+	}
+	registered := false
+	for _, uri := range client.RedirectURIs {
+		if uri == req.RedirectURI {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return storage.OAuthConsent{}, invalidInputf("redirect_uri is not registered for client %s", client.ID)
+	}
+	if req.CodeChallengeMethod != "" && req.CodeChallengeMethod != "S256" {
+		return storage.OAuthConsent{}, invalidInputf("code_challenge_method must be S256")
+	}
+	scopes := storage.UniqueTerms(strings.Fields(req.Scope))
+	if len(scopes) == 0 {
+		return storage.OAuthConsent{}, invalidInputf("scope is required")
+	}
+	for _, scope := range scopes {
+		allowed := false
+		for _, s := range client.OAuthScopes {
+			if s == scope {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return storage.OAuthConsent{}, invalidInputf("scope %s is not allowed for client %s", scope, client.ID)
+		}
+	}
+	result := storage.OAuthConsent{ClientID: client.ID, ClientName: client.Name, RedirectURI: req.RedirectURI, Scopes: scopes}
+	if req.ConsentID == "" {
+		return result, nil
+	}
+	hasScope := func(want string) bool {
+		for _, scope := range scopes {
+			if scope == want {
+				return true
+			}
+		}
+		return false
+	}
+	// consent_id может указывать как на согласие доступа к счетам, так и на согласие на платёж
+	if _, ok := svc.GetPaymentConsent(ctx, req.ConsentID); ok {
+		consent, err := svc.pendingPaymentConsent(ctx, client.ID, req.ConsentID, now)
+		if err != nil {
+			return storage.OAuthConsent{}, err
+		}
+		if !hasScope("payments:write") {
+			return storage.OAuthConsent{}, invalidInputf("scope payments:write is required to authorise consent %s", consent.ID)
+		}
+		result.PaymentConsent = &consent
+		result.Accounts = svc.PayableAccounts(ctx, userID, consent)
+		return result, nil
+	}
+	consent, err := svc.pendingAccountConsent(ctx, client.ID, req.ConsentID, now)
+	if err != nil {
+		return storage.OAuthConsent{}, err
+	}
+	if !hasScope("accounts:read") {
+		return storage.OAuthConsent{}, invalidInputf("scope accounts:read is required to authorise consent %s", consent.ID)
+	}
+	result.AccountConsent = &consent
+	result.Accounts = svc.ConsentableAccounts(ctx, userID)
+	return result, nil
+}
+
+// AuthorizeOAuth записывает решение пользователя и возвращает адрес, куда вернуть его в приложение:
+// с кодом авторизации при согласии или с error=access_denied при отказе
+func (svc *Service) AuthorizeOAuth(ctx context.Context, userID string, req storage.OAuthAuthorizeRequest, now time.Time) (string, error) {
+	consent, err := svc.OAuthConsentRequest(ctx, userID, req, now)
+	if err != nil {
+		return "", err
+	}
+	if consent.AccountConsent != nil {
+		if err := svc.decideAccountConsent(ctx, *consent.AccountConsent, userID, req.AccountIDs, req.Approve, now); err != nil {
+			return "", err
+		}
+	}
+	if consent.PaymentConsent != nil {
+		if err := svc.decidePaymentConsent(ctx, *consent.PaymentConsent, userID, req.AccountIDs, req.Approve, now); err != nil {
+			return "", err
+		}
+	}
+	redirect, _ := url.Parse(consent.RedirectURI)
+	query := redirect.Query()
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	if !req.Approve {
+		query.Set("error", "access_denied")
+		redirect.RawQuery = query.Encode()
+		log.Printf("User %s denied oauth access to client %s", userID, consent.ClientID)
+		return redirect.String(), nil
+	}
+
+	code := storage.GenerateToken()
+	if err := svc.AddOAuthCode(ctx, storage.OAuthCode{
+		CodeHash:      sha256Hex(code),
+		ClientID:      consent.ClientID,
+		UserID:        userID,
+		RedirectURI:   consent.RedirectURI,
+		Scopes:        consent.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		ConsentID:     req.ConsentID,
+		ExpiresAt:     now.Add(OAuthConfig.CodeTTL),
+	}); err != nil {
+		return "", err
+	}
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	log.Printf("User %s granted %v to oauth client %s", userID, consent.Scopes, consent.ClientID)
+	return redirect.String(), nil
+}
+
+// AuthenticateOAuthClient проверяет client_id и client_secret приложения на эндпоинтах токенов и Open Banking
+func (svc *Service) AuthenticateOAuthClient(ctx context.Context, clientID, secret string) (storage.APIClient, error) {
+	client, ok := svc.GetAPIClient(ctx, clientID)
+	if !ok || !client.Active || len(client.RedirectURIs) == 0 || !hmac.Equal([]byte(client.Secret), []byte(secret)) {
+		return storage.APIClient{}, &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	}
+	return client, nil
+}
+
+// issueOAuthAccessToken выдаёт токен доступа — сессию со scope API из согласия, которую понимает обычный middleware
+func (svc *Service) issueOAuthAccessToken(ctx context.Context, grant storage.OAuthGrant, refreshToken string, now time.Time) (storage.OAuthTokenResponse, error) {
+	scopes := make([]string, 0, len(grant.Scopes))
+	for _, scope := range grant.Scopes {
+		scopes = append(scopes, storage.OAuthScopes[scope])
+	}
+	expiresAt := now.Add(OAuthConfig.AccessTokenTTL)
+	session := storage.Session{
+		ID:         storage.GenerateID(),
+		UserID:     grant.UserID,
+		Token:      storage.GenerateToken(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		Kind:       storage.SessionKindOAuth,
+		Name:       grant.ClientName,
+		Scopes:     storage.UniqueTerms(scopes),
+		ClientID:   grant.ClientID,
+		GrantID:    grant.ID,
+		ConsentID:  grant.ConsentID,
+		ExpiresAt:  &expiresAt,
+	}
+	if err := svc.AddSession(ctx, session); err != nil {
+		return storage.OAuthTokenResponse{}, err
+	}
+	return storage.OAuthTokenResponse{
+		AccessToken:  session.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(OAuthConfig.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(grant.Scopes, " "),
+	}, nil
+}
+
+// ExchangeOAuthCode — grant_type=authorization_code: погашает код и создаёт согласие с refresh token.
+// Если при авторизации был передан code_challenge, нужен code_verifier (PKCE, S256).
+func (svc *Service) ExchangeOAuthCode(ctx context.Context, clientID, secret, code, redirectURI, verifier string, now time.Time) (storage.OAuthTokenResponse, error) {
+	client, err := svc.AuthenticateOAuthClient(ctx, clientID, secret)
+	if err != nil {
+		return storage.OAuthTokenResponse{}, err
+	}
+	if code == "" {
+		return storage.OAuthTokenResponse{}, &OAuthError{Code: "invalid_request", Description: "code is required"}
+	}
+	authCode, err := svc.RedeemOAuthCode(ctx, sha256Hex(code), now)
+	if err != nil {
+		return storage.OAuthTokenResponse{}, &OAuthError{Code: "invalid_grant", Description: err.Error()}
+	}
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI {
+		return storage.OAuthTokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "code was issued to another client or redirect_uri"}
+	}
+	if authCode.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(verifier))
+		if verifier == "" || base64.RawURLEncoding.EncodeToString(sum[:]) != authCode.CodeChallenge {
+			return storage.OAuthTokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "code_verifier does not match code_challenge"}
+		}
+	}
+
+	refreshToken := storage.GenerateToken()
+	grant := storage.OAuthGrant{
+		ID:               storage.GenerateID(),
+		UserID:           authCode.UserID,
+		ClientID:         client.ID,
+		ClientName:       client.Name,
+		Scopes:           authCode.Scopes,
+		ConsentID:        authCode.ConsentID,
+		RefreshTokenHash: sha256Hex(refreshToken),
+		CreatedAt:        now,
+	}
+	if err := svc.AddOAuthGrant(ctx, grant); err != nil {
+		return storage.OAuthTokenResponse{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     grant.UserID,
+		Action:    "oauth.grant",
+		Details:   map[string]string{"grant_id": grant.ID, "client_id": client.ID, "scopes": strings.Join(grant.Scopes, " ")},
+	})
+	return svc.issueOAuthAccessToken(ctx, grant, refreshToken, now)
+}
+
+// RefreshOAuthToken — grant_type=refresh_token: выдаёт новую пару токенов, прежние перестают действовать
+func (svc *Service) RefreshOAuthToken(ctx context.Context, clientID, secret, refreshToken string, now time.Time) (storage.OAuthTokenResponse, error) {
+	client, err := svc.AuthenticateOAuthClient(ctx, clientID, secret)
+	if err != nil {
+		return storage.OAuthTokenResponse{}, err
+	}
+	if refreshToken == "" {
+		return storage.OAuthTokenResponse{}, &OAuthError{Code: "invalid_request", Description: "refresh_token is required"}
+	}
+	next := storage.GenerateToken()
+	grant, err := svc.RefreshOAuthGrant(ctx, client.ID, sha256Hex(refreshToken), sha256Hex(next), now)
+	if err != nil {
+		return storage.OAuthTokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "refresh token not found or revoked"}
+	}
+	return svc.issueOAuthAccessToken(ctx, grant, next, now)
+}
+
+// RevokeOAuthGrant отзывает согласие пользователя приложению; согласие Open Banking, выданное по нему, отзывается тоже
+func (svc *Service) RevokeOAuthGrant(ctx context.Context, userID, grantID string, now time.Time) (storage.OAuthGrant, error) {
+	grant, err := svc.Repository.RevokeOAuthGrant(ctx, userID, grantID, now)
+	if err != nil {
+		return storage.OAuthGrant{}, err
+	}
+	if grant.ConsentID != "" {
+		svc.revokeAccountConsent(ctx, grant.ConsentID, now)
+	}
+	return grant, nil
+}
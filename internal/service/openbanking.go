@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var OpenBankingConfig = struct {
+	DefaultConsentValidity time.Duration // срок согласия, если приложение его не указало
+	MaxConsentValidity     time.Duration
+}{
+	DefaultConsentValidity: 90 * 24 * time.Hour,
+	MaxConsentValidity:     180 * 24 * time.Hour,
+}
+
+func consentNotFound(id string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeConsentNotFound, Message: fmt.Sprintf("consent %s not found", id)}
+}
+
+func consentForbidden(format string, args ...interface{}) error {
+	return &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// CreateAccountConsent создаёт согласие приложения clientID; пользователь подтверждает его позже на экране OAuth2
+func (svc *Service) CreateAccountConsent(ctx context.Context, clientID string, req storage.CreateAccountConsentRequest, now time.Time) (storage.AccountAccessConsent, error) {
+	permissions := storage.UniqueTerms(req.Permissions)
+	if len(permissions) == 0 {
+		return storage.AccountAccessConsent{}, invalidInputf("permissions are required")
+	}
+	for _, perm := range permissions {
+		if !storage.AccountConsentPermissions[perm] {
+			return storage.AccountAccessConsent{}, invalidInputf("unknown permission %s", perm)
+		}
+	}
+	consent := storage.AccountAccessConsent{Permissions: permissions}
+	readsTransactions := consent.Allows(storage.PermReadTransactionsBasic) || consent.Allows(storage.PermReadTransactionsDetail)
+	readsDirection := consent.Allows(storage.PermReadTransactionsCredit) || consent.Allows(storage.PermReadTransactionsDebit)
+	if readsTransactions != readsDirection {
+		return storage.AccountAccessConsent{}, invalidInputf("%s or %s must be combined with %s and/or %s",
+			storage.PermReadTransactionsBasic, storage.PermReadTransactionsDetail, storage.PermReadTransactionsCredit, storage.PermReadTransactionsDebit)
+	}
+
+	expiresAt := now.Add(OpenBankingConfig.DefaultConsentValidity)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(OpenBankingConfig.MaxConsentValidity)) {
+		return storage.AccountAccessConsent{}, invalidInputf("expiration must be in the future and within %d days", int(OpenBankingConfig.MaxConsentValidity.Hours()/24))
+	}
+	if req.TransactionFrom != nil && req.TransactionTo != nil && req.TransactionTo.Before(*req.TransactionFrom) {
+		return storage.AccountAccessConsent{}, invalidInputf("transaction window ends before it starts")
+	}
+
+	consent.ID = storage.GenerateID()
+	consent.ClientID = clientID
+	consent.Status = storage.ConsentAwaitingAuthorisation
+	consent.ExpiresAt = expiresAt
+	consent.TransactionFrom = req.TransactionFrom
+	consent.TransactionTo = req.TransactionTo
+	consent.CreatedAt = now
+	consent.StatusUpdatedAt = now
+	if err := svc.AddAccountConsent(ctx, consent); err != nil {
+		return storage.AccountAccessConsent{}, err
+	}
+	log.Printf("Account access consent %s created by client %s: %v", consent.ID, clientID, permissions)
+	return consent, nil
+}
+
+// ClientAccountConsent — согласие приложения clientID; чужие согласия отдаются как несуществующие
+func (svc *Service) ClientAccountConsent(ctx context.Context, clientID, id string) (storage.AccountAccessConsent, error) {
+	consent, ok := svc.GetAccountConsent(ctx, id)
+	if !ok || consent.ClientID != clientID {
+		return storage.AccountAccessConsent{}, consentNotFound(id)
+	}
+	return consent, nil
+}
+
+// RevokeClientAccountConsent — приложение само отказывается от согласия; токены по нему перестают читать счета
+func (svc *Service) RevokeClientAccountConsent(ctx context.Context, clientID, id string, now time.Time) (storage.AccountAccessConsent, error) {
+	if _, err := svc.ClientAccountConsent(ctx, clientID, id); err != nil {
+		return storage.AccountAccessConsent{}, err
+	}
+	return svc.revokeAccountConsent(ctx, id, now)
+}
+
+func (svc *Service) revokeAccountConsent(ctx context.Context, id string, now time.Time) (storage.AccountAccessConsent, error) {
+	consent, err := svc.UpdateAccountConsent(ctx, id, func(c *storage.AccountAccessConsent) error {
+		if c.Status != storage.ConsentRevoked {
+			c.Status = storage.ConsentRevoked
+			c.StatusUpdatedAt = now
+		}
+		return nil
+	})
+	if err != nil {
+		return storage.AccountAccessConsent{}, err
+	}
+	log.Printf("Account access consent %s revoked", id)
+	return consent, nil
+}
+
+// pendingAccountConsent — согласие приложения, которое пользователь ещё может подтвердить
+func (svc *Service) pendingAccountConsent(ctx context.Context, clientID, id string, now time.Time) (storage.AccountAccessConsent, error) {
+	consent, err := svc.ClientAccountConsent(ctx, clientID, id)
+	if err != nil {
+		return storage.AccountAccessConsent{}, err
+	}
+	if consent.Status != storage.ConsentAwaitingAuthorisation {
+		return storage.AccountAccessConsent{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s is %s", id, consent.Status)}
+	}
+	if now.After(consent.ExpiresAt) {
+		return storage.AccountAccessConsent{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s has expired", id)}
+	}
+	return consent, nil
+}
+
+// ConsentableAccounts — открытые счета пользователя, которые он может показать приложению: личные и счета
+// организаций, где ему доступен просмотр
+func (svc *Service) ConsentableAccounts(ctx context.Context, userID string) []storage.Account {
+	accounts := make([]storage.Account, 0)
+	for _, account := range svc.GetUserAccounts(ctx, userID) {
+		if account.IsClosed() || svc.AuthorizeOrgAccount(ctx, account, userID, storage.OrgPermView) != nil {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// decideAccountConsent записывает решение пользователя по согласию: при одобрении — выбранные счета
+// (пусто — все доступные), при отказе согласие отклоняется
+func (svc *Service) decideAccountConsent(ctx context.Context, consent storage.AccountAccessConsent, userID string, accountIDs []string, approve bool, now time.Time) error {
+	status := storage.ConsentRejected
+	var shared []string
+	if approve {
+		status = storage.ConsentAuthorised
+		available := make(map[string]bool)
+		for _, account := range svc.ConsentableAccounts(ctx, userID) {
+			available[account.ID] = true
+			if len(accountIDs) == 0 {
+				shared = append(shared, account.ID)
+			}
+		}
+		for _, id := range storage.UniqueTerms(accountIDs) {
+			if !available[id] {
+				return invalidInputf("account %s cannot be shared", id)
+			}
+			shared = append(shared, id)
+		}
+		if len(shared) == 0 {
+			return invalidInputf("no accounts to share")
+		}
+	}
+	consent, err := svc.UpdateAccountConsent(ctx, consent.ID, func(c *storage.AccountAccessConsent) error {
+		if c.Status != storage.ConsentAwaitingAuthorisation {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s is %s", c.ID, c.Status)}
+		}
+		c.Status = status
+		c.UserID = userID
+		c.AccountIDs = shared
+		c.StatusUpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     userID,
+		Action:    "openbanking.consent_decision",
+		Details:   map[string]string{"consent_id": consent.ID, "client_id": consent.ClientID, "status": consent.Status, "accounts": fmt.Sprint(consent.AccountIDs)},
+	})
+	return nil
+}
+
+// SessionAccountConsent — действующее согласие, к которому привязан токен приложения
+func (svc *Service) SessionAccountConsent(ctx context.Context, session storage.Session, now time.Time) (storage.AccountAccessConsent, error) {
+	if session.ConsentID == "" {
+		return storage.AccountAccessConsent{}, consentForbidden("token is not bound to an account access consent")
+	}
+	consent, ok := svc.GetAccountConsent(ctx, session.ConsentID)
+	if !ok || consent.UserID != session.UserID || consent.ClientID != session.ClientID {
+		return storage.AccountAccessConsent{}, consentForbidden("account access consent %s is not valid for this token", session.ConsentID)
+	}
+	if consent.Status != storage.ConsentAuthorised {
+		return storage.AccountAccessConsent{}, consentForbidden("account access consent %s is %s", consent.ID, consent.Status)
+	}
+	if now.After(consent.ExpiresAt) {
+		return storage.AccountAccessConsent{}, consentForbidden("account access consent %s has expired", consent.ID)
+	}
+	return consent, nil
+}
+
+// ConsentAccount — счёт, открытый согласием; доступ к счёту организации перепроверяется по текущей роли
+func (svc *Service) ConsentAccount(ctx context.Context, consent storage.AccountAccessConsent, accountID string) (storage.Account, error) {
+	account, ok := svc.GetAccount(ctx, accountID)
+	if !ok || !consent.CoversAccount(accountID) || svc.AuthorizeOrgAccount(ctx, account, consent.UserID, storage.OrgPermView) != nil {
+		return storage.Account{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("account %s not found", accountID)}
+	}
+	return account, nil
+}
+
+// ConsentAccounts — все счета согласия, к которым у пользователя ещё есть доступ
+func (svc *Service) ConsentAccounts(ctx context.Context, consent storage.AccountAccessConsent) []storage.Account {
+	accounts := make([]storage.Account, 0, len(consent.AccountIDs))
+	for _, id := range consent.AccountIDs {
+		if account, err := svc.ConsentAccount(ctx, consent, id); err == nil {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+// ConsentTransactions — операции счёта в окне согласия и запроса (по дате проводки), новые первыми.
+// Зачисления и списания отдаются, только если согласие разрешает соответствующее направление.
+func (svc *Service) ConsentTransactions(ctx context.Context, consent storage.AccountAccessConsent, account storage.Account, from, to *time.Time) []storage.Transaction {
+	if consent.TransactionFrom != nil && (from == nil || from.Before(*consent.TransactionFrom)) {
+		from = consent.TransactionFrom
+	}
+	if consent.TransactionTo != nil && (to == nil || to.After(*consent.TransactionTo)) {
+		to = consent.TransactionTo
+	}
+	credits := consent.Allows(storage.PermReadTransactionsCredit)
+	debits := consent.Allows(storage.PermReadTransactionsDebit)
+
+	result := make([]storage.Transaction, 0)
+	for _, tx := range svc.GetAccountTransactions(ctx, account.ID) {
+		if from != nil && tx.BookingDate.Before(*from) || to != nil && tx.BookingDate.After(*to) {
+			continue
+		}
+		if tx.ToAccountID == account.ID && !credits || tx.ToAccountID != account.ID && !debits {
+			continue
+		}
+		result = append(result, tx)
+	}
+	result = storage.LocalizeTransactions(result, svc.AccountLanguage(ctx, account.ID))
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].BookingDate.After(result[j].BookingDate)
+	})
+	return result
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+const MaxBatchCardItems = 1000
+
+func (svc *Service) completeOperation(ctx context.Context, op storage.Operation, result interface{}, err error) {
+	now := time.Now()
+	op.CompletedAt = &now
+	op.Result = result
+	if err != nil {
+		op.Status = storage.OperationFailed
+		op.Error = err.Error()
+	} else {
+		op.Status = storage.OperationCompleted
+	}
+	svc.SaveOperation(ctx, op)
+}
+
+func (svc *Service) ProcessBatchCardIssuance(ctx context.Context, op storage.Operation, req storage.BatchCardRequest) {
+	op.Status = storage.OperationRunning
+	svc.SaveOperation(ctx, op)
+
+	results := make([]storage.BatchCardItemResult, 0, len(req.Items))
+	issued := 0
+	for _, item := range req.Items {
+		result := storage.BatchCardItemResult{AccountID: item.AccountID, HolderName: item.HolderName}
+
+		card := storage.NewCard(item.AccountID)
+		card.HolderName = item.HolderName
+		card.DeliveryStatus = storage.DeliveryOrdered
+		card.DeliveryUpdatedAt = &card.CreatedAt
+
+		if err := svc.AddCard(ctx, card); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		} else {
+			result.Status = "issued"
+			result.CardID = card.ID
+			issued++
+		}
+		results = append(results, result)
+	}
+
+	log.Printf("Batch card issuance %s for %s finished: %d/%d issued", op.ID, req.Employer, issued, len(req.Items))
+	svc.completeOperation(ctx, op, results, nil)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var OrganizationConfig = struct {
+	MaxMembers int
+}{
+	MaxMembers: 50,
+}
+
+func orgNotFound(orgID string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeOrgNotFound, Message: fmt.Sprintf("organization %s not found", orgID)}
+}
+
+func (svc *Service) auditOrganization(ctx context.Context, actor, action string, org storage.Organization, details map[string]string, now time.Time) {
+	if actor == "" {
+		actor = "admin"
+	}
+	entry := map[string]string{"organization_id": org.ID}
+	for k, v := range details {
+		entry[k] = v
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{ID: storage.GenerateID(), Timestamp: now, Actor: actor, Action: action, Details: entry})
+}
+
+// NewProductAccount — новый открытый счёт продукта: ставка, комиссии и лимиты берутся из продукта
+func (svc *Service) NewProductAccount(ctx context.Context, userID string, product storage.Product, currency string, now time.Time) storage.Account {
+	account := storage.Account{
+		ID:        storage.GenerateID(),
+		UserID:    userID,
+		Number:    storage.GenerateAccountNumber(),
+		Balance:   decimal.Zero,
+		CreatedAt: now,
+
+		ProductCode:        product.Code,
+		Currency:           currency,
+		InterestRate:       product.InterestRate,
+		MonthlyFee:         product.MonthlyFee,
+		DailyTransferLimit: product.DailyTransferLimit,
+
+		AccruedInterest:       decimal.Zero,
+		CustodyFeeRate:        product.CustodyFeeFor(currency).AnnualRate,
+		CustodyFeeFreeBalance: product.CustodyFeeFor(currency).FreeBalance,
+
+		Status: storage.AccountStatusActive,
+	}
+	if rate, ok := svc.BalanceInterestRate(ctx, product.Code); ok {
+		account.InterestRate = rate
+	}
+	return account
+}
+
+// CreateOrganization регистрирует организацию; её первый участник — владелец: пользователь сессии (userID)
+// или, для запросов без сессии, req.OwnerUserID
+func (svc *Service) CreateOrganization(ctx context.Context, req storage.CreateOrganizationRequest, userID string, now time.Time) (storage.Organization, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return storage.Organization{}, invalidInputf("name is required")
+	}
+	taxID := strings.TrimSpace(req.TaxID)
+	if len(taxID) != 10 && len(taxID) != 12 || strings.Trim(taxID, "0123456789") != "" {
+		return storage.Organization{}, invalidInputf("tax_id must be 10 digits for a company or 12 for a sole proprietor")
+	}
+	owner := userID
+	if owner == "" {
+		owner = req.OwnerUserID
+	}
+	if owner == "" {
+		return storage.Organization{}, invalidInputf("owner_user_id is required")
+	}
+
+	org := storage.Organization{
+		ID:        storage.GenerateID(),
+		Name:      name,
+		TaxID:     taxID,
+		Members:   []storage.OrgMember{{UserID: owner, Role: storage.OrgRoleOwner, AddedAt: now}},
+		CreatedAt: now,
+
+		ApprovalThreshold: DualControlConfig.DefaultThreshold,
+	}
+	if err := svc.AddOrganization(ctx, org); err != nil {
+		return storage.Organization{}, err
+	}
+	svc.auditOrganization(ctx, userID, "organization.create", org, map[string]string{"owner_user_id": owner, "tax_id": taxID}, now)
+	log.Printf("Organization %s (%s) registered, owner %s", org.ID, org.Name, owner)
+	return org, nil
+}
+
+// AuthorizeOrganization находит организацию и проверяет право perm у пользователя сессии. Тем, кто не состоит
+// в организации, она отдаётся как несуществующая; участнику без нужной роли — ErrForbidden.
+// Пустой userID (запрос без сессии) не ограничивается.
+func (svc *Service) AuthorizeOrganization(ctx context.Context, orgID, userID, perm string) (storage.Organization, error) {
+	org, ok := svc.GetOrganization(ctx, orgID)
+	if !ok {
+		return storage.Organization{}, orgNotFound(orgID)
+	}
+	if userID == "" {
+		return org, nil
+	}
+	member, ok := org.Member(userID)
+	if !ok {
+		return storage.Organization{}, orgNotFound(orgID)
+	}
+	if !org.Allows(userID, perm) {
+		return storage.Organization{}, &storage.StorageError{Kind: storage.ErrForbidden, Code: storage.CodeForbidden,
+			Message: fmt.Sprintf("role %s in organization %s does not allow %s", member.Role, org.Name, perm)}
+	}
+	return org, nil
+}
+
+// AuthorizeOrgAccount проверяет право perm на расчётный счёт организации так же, как AuthorizeOrganization;
+// чужой счёт отдаётся как несуществующий. Личные счета здесь не ограничиваются.
+func (svc *Service) AuthorizeOrgAccount(ctx context.Context, account storage.Account, userID, perm string) error {
+	if account.OrganizationID == "" {
+		return nil
+	}
+	if _, err := svc.AuthorizeOrganization(ctx, account.OrganizationID, userID, perm); err != nil {
+		var se *storage.StorageError
+		if errors.As(err, &se) && se.Kind == storage.ErrNotFound {
+			return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("account %s not found", account.ID)}
+		}
+		return err
+	}
+	return nil
+}
+
+// SetOrganizationMember добавляет участника или меняет его роль. Последнего владельца понизить нельзя.
+func (svc *Service) SetOrganizationMember(ctx context.Context, orgID, actor, memberID, role string, now time.Time) (storage.Organization, error) {
+	if !storage.ValidOrgRole(role) {
+		return storage.Organization{}, invalidInputf("role must be one of %s, %s, %s", storage.OrgRoleOwner, storage.OrgRoleAccountant, storage.OrgRoleViewer)
+	}
+	previous := ""
+	org, err := svc.UpdateOrganization(ctx, orgID, func(o *storage.Organization) error {
+		for i, m := range o.Members {
+			if m.UserID != memberID {
+				continue
+			}
+			previous = m.Role
+			if m.Role == storage.OrgRoleOwner && role != storage.OrgRoleOwner && o.Owners() == 1 {
+				return &storage.StorageError{Kind: storage.ErrConflict, Message: "organization must keep at least one owner"}
+			}
+			o.Members[i].Role = role
+			return nil
+		}
+		if len(o.Members) >= OrganizationConfig.MaxMembers {
+			return &storage.StorageError{Kind: storage.ErrQuotaExceeded, Code: storage.CodeQuotaExceeded, Message: fmt.Sprintf("organization already has the maximum of %d members", OrganizationConfig.MaxMembers)}
+		}
+		o.Members = append(o.Members, storage.OrgMember{UserID: memberID, Role: role, AddedBy: actor, AddedAt: now})
+		return nil
+	})
+	if err != nil {
+		return storage.Organization{}, err
+	}
+	svc.auditOrganization(ctx, actor, "organization.member_set", org, map[string]string{"user_id": memberID, "role": role, "previous_role": previous}, now)
+	log.Printf("Organization %s: member %s is now %s", org.ID, memberID, role)
+	return org, nil
+}
+
+// RemoveOrganizationMember исключает участника; последнего владельца исключить нельзя
+func (svc *Service) RemoveOrganizationMember(ctx context.Context, orgID, actor, memberID string, now time.Time) (storage.Organization, error) {
+	org, err := svc.UpdateOrganization(ctx, orgID, func(o *storage.Organization) error {
+		for i, m := range o.Members {
+			if m.UserID != memberID {
+				continue
+			}
+			if m.Role == storage.OrgRoleOwner && o.Owners() == 1 {
+				return &storage.StorageError{Kind: storage.ErrConflict, Message: "organization must keep at least one owner"}
+			}
+			o.Members = append(o.Members[:i], o.Members[i+1:]...)
+			return nil
+		}
+		return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeUserNotFound, Message: fmt.Sprintf("user %s is not a member of organization %s", memberID, orgID)}
+	})
+	if err != nil {
+		return storage.Organization{}, err
+	}
+	svc.auditOrganization(ctx, actor, "organization.member_remove", org, map[string]string{"user_id": memberID}, now)
+	log.Printf("Organization %s: member %s removed", org.ID, memberID)
+	return org, nil
+}
+
+// OpenBusinessAccount открывает организации расчётный счёт (по умолчанию продукт business). Представителем
+// счёта становится открывший его участник, а при запросе без сессии — первый владелец организации.
+func (svc *Service) OpenBusinessAccount(ctx context.Context, org storage.Organization, actor, productCode, currency string, now time.Time) (storage.AccountWithProduct, error) {
+	if productCode == "" {
+		productCode = storage.ProductBusiness
+	}
+	product, ok := storage.GetProduct(productCode)
+	if !ok || !product.Business {
+		return storage.AccountWithProduct{}, invalidInputf("product %s is not available to organizations", productCode)
+	}
+	if currency == "" {
+		currency = product.Currencies[0]
+	}
+	currency = strings.ToUpper(currency)
+	if err := storage.CheckProductEligibility(product, currency, svc.GetOrganizationAccounts(ctx, org.ID)); err != nil {
+		return storage.AccountWithProduct{}, &storage.StorageError{Kind: storage.ErrQuotaExceeded, Code: storage.CodeValidation, Message: err.Error()}
+	}
+
+	representative := actor
+	if representative == "" {
+		for _, m := range org.Members {
+			if m.Role == storage.OrgRoleOwner {
+				representative = m.UserID
+				break
+			}
+		}
+	}
+	account := svc.NewProductAccount(ctx, representative, product, currency, now)
+	account.OrganizationID = org.ID
+	if err := svc.AddAccount(ctx, account); err != nil {
+		return storage.AccountWithProduct{}, err
+	}
+	svc.auditOrganization(ctx, actor, "organization.account_open", org, map[string]string{"account_id": account.ID, "currency": currency}, now)
+	log.Printf("Business account %s (%s) opened for organization %s", account.Number, currency, org.ID)
+	return storage.AccountWithProduct{Account: account, Product: product}, nil
+}
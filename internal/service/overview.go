@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var OverviewConfig = struct {
+	TopMerchants int
+	MerchantDays int           // за сколько последних дней считается рейтинг мерчантов
+	MaxAge       time.Duration // сводка пересчитывается не чаще, даже если данные меняются непрерывно
+}{
+	TopMerchants: 10,
+	MerchantDays: 30,
+	MaxAge:       30 * time.Second,
+}
+
+// overviewCollections — коллекции, от которых зависит сводка; пока их поколения не менялись, сводка из кеша верна
+var overviewCollections = []string{storage.CollectionUsers, storage.CollectionAccounts, storage.CollectionLoans, storage.CollectionTransactions}
+
+var cachedOverview struct {
+	mu       sync.Mutex
+	overview storage.BankOverview
+	key      string
+}
+
+// BankOverview — агрегаты по банку для админской панели. Результат кешируется: пока не изменились пользователи,
+// счета, кредиты и журнал и не наступил новый день, повторный запрос не пересчитывает сводку; при непрерывном
+// потоке операций она пересчитывается не чаще раза в OverviewConfig.MaxAge.
+func (svc *Service) BankOverview(ctx context.Context, now time.Time) (storage.BankOverview, bool) {
+	dayStart := StartOfDay(now)
+	key := dayStart.Format("2006-01-02")
+	for _, c := range overviewCollections {
+		key += fmt.Sprintf("-%s.%d", c, svc.Generation(ctx, c))
+	}
+
+	cachedOverview.mu.Lock()
+	defer cachedOverview.mu.Unlock()
+	if cachedOverview.key != "" {
+		fresh := cachedOverview.key == key
+		sameDay := cachedOverview.overview.Today.Date == dayStart.Format("2006-01-02")
+		if fresh || (sameDay && now.Sub(cachedOverview.overview.GeneratedAt) < OverviewConfig.MaxAge) {
+			return cachedOverview.overview, true
+		}
+	}
+
+	stats := svc.BankStats(ctx, dayStart, now.AddDate(0, 0, -OverviewConfig.MerchantDays))
+	overview := storage.BankOverview{
+		GeneratedAt:  now,
+		Currency:     storage.BaseCurrency,
+		Users:        stats.Users,
+		Accounts:     stats.Accounts,
+		Deposits:     svc.overviewAmount(ctx, stats.Deposits),
+		Loans:        storage.OverviewLoans{Outstanding: stats.OutstandingLoans, Principal: svc.overviewAmount(ctx, stats.LoanPrincipal)},
+		Today:        storage.OverviewDay{Date: dayStart.Format("2006-01-02"), Transactions: stats.DayTransactions, Volume: svc.overviewAmount(ctx, stats.DayVolume)},
+		TopMerchants: make([]storage.OverviewMerchant, 0, len(stats.Merchants)),
+		MerchantDays: OverviewConfig.MerchantDays,
+	}
+	for _, m := range stats.Merchants {
+		overview.TopMerchants = append(overview.TopMerchants, storage.OverviewMerchant{
+			MerchantID: m.MerchantID,
+			Name:       m.Name,
+			Payments:   m.Payments,
+			Volume:     svc.overviewAmount(ctx, m.Volume).Total,
+		})
+	}
+	sort.Slice(overview.TopMerchants, func(i, j int) bool {
+		a, b := overview.TopMerchants[i], overview.TopMerchants[j]
+		if !a.Volume.Equal(b.Volume) {
+			return a.Volume.GreaterThan(b.Volume)
+		}
+		return a.Name < b.Name
+	})
+	if len(overview.TopMerchants) > OverviewConfig.TopMerchants {
+		overview.TopMerchants = overview.TopMerchants[:OverviewConfig.TopMerchants]
+	}
+
+	cachedOverview.overview = overview
+	cachedOverview.key = key
+	return overview, false
+}
+
+// overviewAmount пересчитывает суммы по валютам в рубли; валюта без курса остаётся только в разбивке
+func (svc *Service) overviewAmount(ctx context.Context, byCurrency map[string]decimal.Decimal) storage.OverviewAmount {
+	total := decimal.Zero
+	for currency, amount := range byCurrency {
+		base, err := svc.toBaseCurrency(ctx, amount, currency)
+		if err != nil {
+			log.Printf("Overview: %s excluded from total: %v", currency, err)
+			continue
+		}
+		total = total.Add(base)
+	}
+	return storage.OverviewAmount{Total: total.RoundBank(2), ByCurrency: byCurrency}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var P2PConfig = struct {
+	ConfirmationTTL time.Duration // сколько действует подтверждение получателя
+}{
+	ConfirmationTTL: 5 * time.Minute,
+}
+
+var p2pConfirmationSecret = secretFromEnv("BANKAPP_P2P_SECRET")
+
+func invalidInputf(format string, args ...interface{}) error {
+	return &storage.StorageError{Kind: storage.ErrInvalidInput, Message: fmt.Sprintf(format, args...)}
+}
+
+// NormalizePhone приводит номер к виду +79161234567; российский 8XXXXXXXXXX считается +7XXXXXXXXXX
+func NormalizePhone(raw string) (string, error) {
+	var digits strings.Builder
+	plus := false
+	for i, c := range strings.TrimSpace(raw) {
+		switch {
+		case c == '+' && i == 0:
+			plus = true
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == ' ' || c == '-' || c == '(' || c == ')':
+		default:
+			return "", fmt.Errorf("phone number contains invalid character %q", c)
+		}
+	}
+	number := digits.String()
+	if !plus && len(number) == 11 && number[0] == '8' {
+		number = "7" + number[1:]
+	} else if !plus {
+		return "", fmt.Errorf("phone number must be in international format, e.g. +79161234567")
+	}
+	if len(number) < 11 || len(number) > 15 {
+		return "", fmt.Errorf("phone number must contain 11 to 15 digits")
+	}
+	return "+" + number, nil
+}
+
+// ParseAliasInput определяет тип алиаса получателя: "+7..." или "8..." — телефон, остальное — логин ("@" необязателен)
+func ParseAliasInput(to string) (string, string, error) {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return "", "", fmt.Errorf("recipient is required")
+	}
+	if strings.HasPrefix(to, "+") || (strings.HasPrefix(to, "8") && len(to) >= 11) {
+		phone, err := NormalizePhone(to)
+		if err != nil {
+			return "", "", err
+		}
+		return storage.AliasPhone, phone, nil
+	}
+	return storage.AliasUsername, strings.ToLower(strings.TrimPrefix(to, "@")), nil
+}
+
+// defaultP2PAccount — основной счёт для входящих переводов: первый открытый текущий счёт в рублях
+func (svc *Service) defaultP2PAccount(ctx context.Context, userID string) (storage.Account, bool) {
+	var fallback *storage.Account
+	for _, acc := range svc.GetUserAccounts(ctx, userID) {
+		if acc.IsClosed() || acc.Currency != storage.BaseCurrency {
+			continue
+		}
+		if acc.ProductCode == storage.ProductChecking {
+			return acc, true
+		}
+		if fallback == nil {
+			acc := acc
+			fallback = &acc
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return storage.Account{}, false
+}
+
+// RegisterAlias публикует телефон или логин пользователя в справочнике получателей
+func (svc *Service) RegisterAlias(ctx context.Context, user storage.User, req storage.AliasRequest, now time.Time) (storage.Alias, error) {
+	alias := storage.Alias{Type: req.Type, UserID: user.ID, AccountID: req.AccountID, CreatedAt: now, UpdatedAt: now}
+	switch req.Type {
+	case storage.AliasPhone:
+		phone, err := NormalizePhone(req.Value)
+		if err != nil {
+			return storage.Alias{}, invalidInputf("%v", err)
+		}
+		alias.Value = phone
+	case storage.AliasUsername:
+		// По логину можно найти только самого пользователя
+		if req.Value != "" && !strings.EqualFold(strings.TrimPrefix(req.Value, "@"), user.Username) {
+			return storage.Alias{}, invalidInputf("username alias must match your username")
+		}
+		alias.Value = strings.ToLower(user.Username)
+	default:
+		return storage.Alias{}, invalidInputf("alias type must be %q or %q", storage.AliasPhone, storage.AliasUsername)
+	}
+
+	if alias.AccountID == "" {
+		acc, ok := svc.defaultP2PAccount(ctx, user.ID)
+		if !ok {
+			return storage.Alias{}, invalidInputf("user has no open %s account to receive transfers", storage.BaseCurrency)
+		}
+		alias.AccountID = acc.ID
+	}
+	return svc.SetAlias(ctx, alias)
+}
+
+// ResolveAlias находит получателя по алиасу; счёт за алиасом должен быть открыт
+func (svc *Service) ResolveAlias(ctx context.Context, to string) (storage.Alias, storage.Account, storage.User, error) {
+	aliasType, value, err := ParseAliasInput(to)
+	if err != nil {
+		return storage.Alias{}, storage.Account{}, storage.User{}, invalidInputf("%v", err)
+	}
+	notFound := &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAliasNotFound, Message: fmt.Sprintf("no recipient registered for %s %s", aliasType, value)}
+	alias, ok := svc.GetAlias(ctx, aliasType, value)
+	if !ok {
+		return storage.Alias{}, storage.Account{}, storage.User{}, notFound
+	}
+	account, ok := svc.GetAccount(ctx, alias.AccountID)
+	if !ok || account.IsClosed() {
+		return storage.Alias{}, storage.Account{}, storage.User{}, notFound
+	}
+	user, _ := svc.GetUser(ctx, alias.UserID)
+	return alias, account, user, nil
+}
+
+// p2pConfirmationToken связывает подтверждение с отправителем, получателем и суммой:
+// "<unix>.<hex(HMAC-SHA256(secret, unix|from|alias|account|amount))>"
+func p2pConfirmationToken(issuedAt time.Time, fromAccountID string, alias storage.Alias, amount decimal.Decimal) string {
+	ts := strconv.FormatInt(issuedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, p2pConfirmationSecret)
+	mac.Write([]byte(strings.Join([]string{ts, fromAccountID, alias.Key(), alias.AccountID, amount.String()}, "|")))
+	return ts + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyP2PConfirmation(token, fromAccountID string, alias storage.Alias, amount decimal.Decimal, now time.Time) error {
+	invalid := &storage.StorageError{Kind: storage.ErrInvalidInput, Code: storage.CodeConfirmationInvalid, Message: "confirmation token is invalid or expired, confirm the recipient again"}
+	ts, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return invalid
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return invalid
+	}
+	issuedAt := time.Unix(unix, 0)
+	if now.Sub(issuedAt) > P2PConfig.ConfirmationTTL || issuedAt.After(now.Add(time.Minute)) {
+		return invalid
+	}
+	if !hmac.Equal([]byte(token), []byte(p2pConfirmationToken(issuedAt, fromAccountID, alias, amount))) {
+		return invalid
+	}
+	return nil
+}
+
+func (svc *Service) p2pParties(ctx context.Context, userID string, req storage.P2PTransferRequest) (storage.Account, storage.Alias, storage.Account, storage.User, error) {
+	if !req.Amount.IsPositive() {
+		return storage.Account{}, storage.Alias{}, storage.Account{}, storage.User{}, invalidInputf("transfer amount must be positive")
+	}
+	from, ok := svc.GetAccount(ctx, req.FromAccountID)
+	if !ok {
+		return storage.Account{}, storage.Alias{}, storage.Account{}, storage.User{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound, Message: fmt.Sprintf("source account %s not found", req.FromAccountID)}
+	}
+	if err := svc.AuthorizeDebit(ctx, from, userID, req.Amount); err != nil {
+		return storage.Account{}, storage.Alias{}, storage.Account{}, storage.User{}, err
+	}
+	alias, to, recipient, err := svc.ResolveAlias(ctx, req.To)
+	if err != nil {
+		return storage.Account{}, storage.Alias{}, storage.Account{}, storage.User{}, err
+	}
+	if to.ID == from.ID {
+		return storage.Account{}, storage.Alias{}, storage.Account{}, storage.User{}, invalidInputf("cannot transfer to the same account")
+	}
+	return from, alias, to, recipient, nil
+}
+
+// PrepareP2PTransfer — первый шаг: показывает замаскированное имя получателя и выдаёт токен подтверждения.
+// Списывать со счёта отправителя должен иметь право userID.
+func (svc *Service) PrepareP2PTransfer(ctx context.Context, userID string, req storage.P2PTransferRequest, now time.Time) (storage.P2PConfirmation, error) {
+	from, alias, to, recipient, err := svc.p2pParties(ctx, userID, req)
+	if err != nil {
+		return storage.P2PConfirmation{}, err
+	}
+	return storage.P2PConfirmation{
+		Alias:             alias.Value,
+		DisplayName:       storage.MaskName(recipient.Username),
+		Currency:          to.Currency,
+		Amount:            req.Amount,
+		ConfirmationToken: p2pConfirmationToken(now, from.ID, alias, req.Amount),
+		ExpiresAt:         now.Add(P2PConfig.ConfirmationTTL),
+	}, nil
+}
+
+// ExecuteP2PTransfer — второй шаг: перевод проходит, только если алиас, счёт получателя и сумма не менялись с подтверждения
+func (svc *Service) ExecuteP2PTransfer(ctx context.Context, userID string, req storage.P2PTransferRequest, sig storage.DeviceSignature, now time.Time) (storage.Transaction, error) {
+	from, alias, to, _, err := svc.p2pParties(ctx, userID, req)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	if err := verifyP2PConfirmation(req.ConfirmationToken, from.ID, alias, req.Amount, now); err != nil {
+		return storage.Transaction{}, err
+	}
+	if err := storage.ValidateAmount(req.Amount, from.Currency); err != nil {
+		return storage.Transaction{}, err
+	}
+	releaseLimit, err := svc.ReserveTransferLimit(ctx, from, req.Amount, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	defer releaseLimit()
+	if err := svc.CheckTierLimits(ctx, &from, &to, req.Amount, now); err != nil {
+		return storage.Transaction{}, err
+	}
+	deviceKey, err := svc.RequireTransferSignature(ctx, from, alias.Value, req.Amount, sig, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpP2PTransfer, req.Amount, from.Currency, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	tx, err := svc.TransferFunds(ctx, from.ID, to.ID, req.Amount, now)
+	if err != nil {
+		release()
+		return storage.Transaction{}, err
+	}
+	if deviceKey != nil {
+		svc.AuditSignedTransfer(ctx, *deviceKey, tx.ID, sig, from, alias.Value, req.Amount, now)
+	}
+	return tx, nil
+}
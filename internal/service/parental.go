@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// SpentSince суммирует списания по картам со счёта начиная с момента since
+func (svc *Service) SpentSince(ctx context.Context, accountID string, since time.Time) decimal.Decimal {
+	total := decimal.Zero
+	for _, tx := range svc.GetAccountTransactions(ctx, accountID) {
+		if tx.FromAccountID == accountID && tx.TransactionType == "payment" && !tx.EffectiveDate().Before(since) {
+			total = total.Add(tx.Amount)
+		}
+	}
+	return total
+}
+
+// CheckParentalControls применяет ограничения родителя к оплате с детского счёта
+func (svc *Service) CheckParentalControls(ctx context.Context, accountID string, amount decimal.Decimal, category string, now time.Time) error {
+	control, ok := svc.GetParentalControl(ctx, accountID)
+	if !ok {
+		return nil
+	}
+	for _, blocked := range control.BlockedCategories {
+		if category != "" && strings.EqualFold(blocked, category) {
+			return fmt.Errorf("payments in category %s are blocked by parental controls", category)
+		}
+	}
+	if control.PerTransactionLimit.IsPositive() && amount.GreaterThan(control.PerTransactionLimit) {
+		return fmt.Errorf("payment exceeds the per-transaction limit of %s set by parent", control.PerTransactionLimit.String())
+	}
+	if control.DailySpendLimit.IsPositive() {
+		spent := svc.SpentSince(ctx, accountID, StartOfDay(now))
+		if spent.Add(amount).GreaterThan(control.DailySpendLimit) {
+			return fmt.Errorf("payment exceeds the daily spend limit of %s set by parent (spent today: %s)", control.DailySpendLimit.String(), spent.String())
+		}
+	}
+	return nil
+}
+
+func (svc *Service) BuildDependentDashboard(ctx context.Context, child storage.User, now time.Time) storage.DependentDashboard {
+	dashboard := storage.DependentDashboard{
+		Child:              child,
+		Accounts:           svc.GetUserAccounts(ctx, child.ID),
+		Controls:           []storage.ParentalControl{},
+		SpentToday:         decimal.Zero,
+		SpentThisMonth:     decimal.Zero,
+		SpendingByCategory: make(map[string]decimal.Decimal),
+		RecentTransactions: []storage.Transaction{},
+	}
+	dashboard.Child.PasswordHash = ""
+	dashboard.Child.VerificationCode = ""
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	dayStart := StartOfDay(now)
+
+	var all []storage.Transaction
+	for _, acc := range dashboard.Accounts {
+		if control, ok := svc.GetParentalControl(ctx, acc.ID); ok {
+			dashboard.Controls = append(dashboard.Controls, control)
+		}
+		for _, tx := range svc.GetAccountTransactions(ctx, acc.ID) {
+			all = append(all, tx)
+			if tx.FromAccountID != acc.ID || tx.TransactionType != "payment" || tx.EffectiveDate().Before(monthStart) {
+				continue
+			}
+			dashboard.SpentThisMonth = dashboard.SpentThisMonth.Add(tx.Amount)
+			if !tx.EffectiveDate().Before(dayStart) {
+				dashboard.SpentToday = dashboard.SpentToday.Add(tx.Amount)
+			}
+			category := tx.Category
+			if category == "" {
+				category = "other"
+			}
+			dashboard.SpendingByCategory[category] = dashboard.SpendingByCategory[category].Add(tx.Amount)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].EffectiveDate().After(all[j].EffectiveDate()) })
+	if len(all) > 10 {
+		all = all[:10]
+	}
+	dashboard.RecentTransactions = append(dashboard.RecentTransactions, all...)
+	return dashboard
+}
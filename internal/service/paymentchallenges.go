@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var PaymentChallengeConfig = struct {
+	Threshold   decimal.Decimal // в рублях: оплаты картой от этой суммы ждут подтверждения кодом; 0 — проверка выключена
+	CodeTTL     time.Duration   // сколько оплата ждёт подтверждения, потом холд снимается
+	MaxAttempts int
+}{
+	Threshold:   marginFromEnv("BANKAPP_3DS_THRESHOLD", decimal.NewFromInt(50000)),
+	CodeTTL:     durationFromEnv("BANKAPP_3DS_TTL", 5*time.Minute),
+	MaxAttempts: 3,
+}
+
+// RequiresPaymentChallenge — нужна ли оплате картой на эту сумму проверка 3-D Secure.
+// Если курс недоступен, подтверждение требуется: лишний код лучше пропущенной проверки.
+func (svc *Service) RequiresPaymentChallenge(ctx context.Context, amount decimal.Decimal, currency string) bool {
+	if PaymentChallengeConfig.Threshold.IsZero() {
+		return false
+	}
+	base, err := svc.toBaseCurrency(ctx, amount, currency)
+	if err != nil {
+		log.Printf("Payment challenge: %v, confirmation required", err)
+		return true
+	}
+	return base.GreaterThanOrEqual(PaymentChallengeConfig.Threshold)
+}
+
+// StartPaymentChallenge блокирует сумму подготовленной оплаты tx холдом и отправляет владельцу карты код подтверждения
+func (svc *Service) StartPaymentChallenge(ctx context.Context, card storage.Card, account storage.Account, tx storage.Transaction, now time.Time) (storage.PaymentChallenge, error) {
+	user, ok := svc.GetUser(ctx, account.UserID)
+	if !ok {
+		return storage.PaymentChallenge{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeUserNotFound, Message: fmt.Sprintf("user %s not found", account.UserID)}
+	}
+	code := storage.GenerateVerificationCode()
+	hold := storage.Hold{
+		ID:          storage.GenerateID(),
+		AccountID:   account.ID,
+		CardID:      card.ID,
+		Amount:      tx.Amount,
+		Merchant:    tx.Merchant,
+		MerchantID:  tx.MerchantID,
+		Category:    tx.Category,
+		Status:      storage.HoldActive,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(HoldConfig.TTL),
+		CapturedAmt: decimal.Zero,
+		Fraud:       tx.Fraud,
+	}
+	challenge := storage.PaymentChallenge{
+		ID:         storage.GenerateID(),
+		UserID:     user.ID,
+		AccountID:  account.ID,
+		CardID:     card.ID,
+		Amount:     tx.Amount,
+		Currency:   account.Currency,
+		Merchant:   tx.Merchant,
+		MerchantID: tx.MerchantID,
+		Status:     storage.PaymentChallengePending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(PaymentChallengeConfig.CodeTTL),
+		Payment:    tx,
+		CodeHash:   sha256Hex(code),
+	}
+	if err := svc.AddPaymentChallenge(ctx, challenge, hold); err != nil {
+		return storage.PaymentChallenge{}, err
+	}
+	challenge.HoldID = hold.ID
+	svc.PublishBalanceChanged(ctx, account.ID)
+
+	body := fmt.Sprintf("Hello %s,\n\nYour code to confirm the payment of %s %s to %s with card %s is %s. It expires in %d minutes.\n"+
+		"If you did not make this payment, do not share the code and block the card.",
+		user.Username, tx.Amount.String(), account.Currency, tx.Merchant, storage.MaskPAN(card.Number), code, int(PaymentChallengeConfig.CodeTTL.Minutes()))
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: payment confirmation code", body)
+	log.Printf("Payment %s of %s %s on account %s awaits confirmation", challenge.ID, tx.Amount.String(), account.Currency, account.ID)
+	return challenge, nil
+}
+
+// ConfirmPaymentChallenge проверяет код и проводит оплату. Чужая оплата не видна (пустой userID не проверяется);
+// после MaxAttempts неверных кодов или по истечении срока оплата отклоняется и холд снимается.
+func (svc *Service) ConfirmPaymentChallenge(ctx context.Context, id, userID, code string, now time.Time) (storage.PaymentChallenge, error) {
+	challenge, ok := svc.GetPaymentChallenge(ctx, id)
+	if !ok || (userID != "" && challenge.UserID != userID) {
+		return storage.PaymentChallenge{}, &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("payment %s not found", id)}
+	}
+	challenge, err := svc.UpdatePaymentChallenge(ctx, id, func(c *storage.PaymentChallenge) error {
+		if !now.Before(c.ExpiresAt) {
+			c.Status = storage.PaymentChallengeExpired
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: "confirmation code has expired"}
+		}
+		if !hmac.Equal([]byte(sha256Hex(code)), []byte(c.CodeHash)) {
+			c.Attempts++
+			if c.Attempts >= PaymentChallengeConfig.MaxAttempts {
+				c.Status = storage.PaymentChallengeFailed
+			}
+			return &storage.StorageError{Kind: storage.ErrInvalidInput, Code: storage.CodeUnauthorized, Message: "invalid confirmation code"}
+		}
+		return nil
+	}, now)
+	if err != nil {
+		if challenge.ClosedAt != nil {
+			svc.PublishBalanceChanged(ctx, challenge.AccountID)
+			log.Printf("Payment %s %s", challenge.ID, challenge.Status)
+		}
+		return challenge, err
+	}
+
+	release, err := svc.ReserveOperation(ctx, storage.OpCardPayment, challenge.Amount, challenge.Currency, now)
+	if err != nil {
+		return challenge, err
+	}
+	challenge, err = svc.CompletePaymentChallenge(ctx, id, now)
+	if err != nil {
+		release()
+		return storage.PaymentChallenge{}, err
+	}
+
+	tx := challenge.Payment
+	tx.Timestamp = now
+	svc.PublishBalanceChanged(ctx, challenge.AccountID)
+	if tx.ToAccountID != "" {
+		svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+		svc.NotifyChargeEvent(ctx, storage.ChargeCaptured, tx)
+	}
+	account, _ := svc.GetAccount(ctx, challenge.AccountID)
+	card, _ := svc.GetCard(ctx, challenge.CardID)
+	svc.PublishCardPayment(account, card, challenge.Amount, challenge.Merchant)
+	log.Printf("Payment %s confirmed: %s %s from account %s to %s", challenge.ID, challenge.Amount.String(), challenge.Currency, challenge.AccountID, challenge.Merchant)
+	return challenge, nil
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const (
+	MaxImportPayments = 1000
+	MaxImportFileSize = 5 << 20
+)
+
+// Подмножество ISO 20022 pain.001 (CustomerCreditTransferInitiation), достаточное для внутренних переводов
+type pain001Document struct {
+	XMLName xml.Name `xml:"Document"`
+	Initn   struct {
+		GrpHdr struct {
+			MsgID   string `xml:"MsgId"`
+			NbOfTxs string `xml:"NbOfTxs"`
+			CtrlSum string `xml:"CtrlSum"`
+		} `xml:"GrpHdr"`
+		PmtInf []struct {
+			DbtrAcct    pain001Account `xml:"DbtrAcct"`
+			CdtTrfTxInf []struct {
+				PmtID struct {
+					EndToEndID string `xml:"EndToEndId"`
+				} `xml:"PmtId"`
+				Amt struct {
+					InstdAmt struct {
+						Currency string `xml:"Ccy,attr"`
+						Value    string `xml:",chardata"`
+					} `xml:"InstdAmt"`
+				} `xml:"Amt"`
+				CdtrAcct pain001Account `xml:"CdtrAcct"`
+				RmtInf   struct {
+					Ustrd []string `xml:"Ustrd"`
+				} `xml:"RmtInf"`
+			} `xml:"CdtTrfTxInf"`
+		} `xml:"PmtInf"`
+	} `xml:"CstmrCdtTrfInitn"`
+}
+
+type pain001Account struct {
+	ID struct {
+		IBAN  string `xml:"IBAN"`
+		Other struct {
+			ID string `xml:"Id"`
+		} `xml:"Othr"`
+	} `xml:"Id"`
+}
+
+func (a pain001Account) number() string {
+	if a.ID.IBAN != "" {
+		return strings.TrimSpace(a.ID.IBAN)
+	}
+	return strings.TrimSpace(a.ID.Other.ID)
+}
+
+// ParsePain001 разбирает файл pain.001 и сверяет количество платежей и контрольную сумму из GrpHdr
+func ParsePain001(data []byte) (storage.PaymentImportReport, error) {
+	var doc pain001Document
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&doc); err != nil {
+		return storage.PaymentImportReport{}, fmt.Errorf("invalid pain.001 document: %w", err)
+	}
+
+	report := storage.PaymentImportReport{MessageID: doc.Initn.GrpHdr.MsgID, Format: "pain.001"}
+	for _, pmtInf := range doc.Initn.PmtInf {
+		debtor := pmtInf.DbtrAcct.number()
+		for _, tx := range pmtInf.CdtTrfTxInf {
+			amount, err := decimal.NewFromString(strings.TrimSpace(tx.Amt.InstdAmt.Value))
+			if err != nil {
+				return storage.PaymentImportReport{}, fmt.Errorf("payment %s: invalid amount %q", tx.PmtID.EndToEndID, tx.Amt.InstdAmt.Value)
+			}
+			report.Payments = append(report.Payments, storage.PaymentResult{PaymentInstruction: storage.PaymentInstruction{
+				EndToEndID:      strings.TrimSpace(tx.PmtID.EndToEndID),
+				DebtorAccount:   debtor,
+				CreditorAccount: tx.CdtrAcct.number(),
+				Amount:          amount,
+				Currency:        strings.ToUpper(strings.TrimSpace(tx.Amt.InstdAmt.Currency)),
+				RemittanceInfo:  strings.TrimSpace(strings.Join(tx.RmtInf.Ustrd, " ")),
+			}})
+		}
+	}
+	if err := finishPaymentReport(&report); err != nil {
+		return storage.PaymentImportReport{}, err
+	}
+
+	hdr := doc.Initn.GrpHdr
+	if hdr.NbOfTxs != "" && hdr.NbOfTxs != fmt.Sprint(report.Total) {
+		return storage.PaymentImportReport{}, fmt.Errorf("NbOfTxs is %s but the file contains %d payments", hdr.NbOfTxs, report.Total)
+	}
+	if hdr.CtrlSum != "" {
+		ctrlSum, err := decimal.NewFromString(hdr.CtrlSum)
+		if err != nil || !ctrlSum.Equal(report.ControlSum) {
+			return storage.PaymentImportReport{}, fmt.Errorf("CtrlSum %s does not match the sum of payments %s", hdr.CtrlSum, report.ControlSum.String())
+		}
+	}
+	return report, nil
+}
+
+// ParsePaymentCSV разбирает упрощённый CSV: debtor_account,creditor_account,amount,currency[,end_to_end_id[,remittance_info]]
+// Первая строка — заголовок.
+func ParsePaymentCSV(data []byte) (storage.PaymentImportReport, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	report := storage.PaymentImportReport{Format: "csv"}
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return storage.PaymentImportReport{}, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line++
+		if line == 1 {
+			continue
+		}
+		if len(record) < 4 {
+			return storage.PaymentImportReport{}, fmt.Errorf("line %d: expected at least 4 columns", line)
+		}
+		amount, err := decimal.NewFromString(strings.TrimSpace(record[2]))
+		if err != nil {
+			return storage.PaymentImportReport{}, fmt.Errorf("line %d: invalid amount %q", line, record[2])
+		}
+		instruction := storage.PaymentInstruction{
+			DebtorAccount:   strings.TrimSpace(record[0]),
+			CreditorAccount: strings.TrimSpace(record[1]),
+			Amount:          amount,
+			Currency:        strings.ToUpper(strings.TrimSpace(record[3])),
+		}
+		if len(record) > 4 {
+			instruction.EndToEndID = strings.TrimSpace(record[4])
+		}
+		if len(record) > 5 {
+			instruction.RemittanceInfo = strings.TrimSpace(record[5])
+		}
+		if instruction.EndToEndID == "" {
+			instruction.EndToEndID = fmt.Sprintf("LINE-%d", line)
+		}
+		report.Payments = append(report.Payments, storage.PaymentResult{PaymentInstruction: instruction})
+	}
+	return report, finishPaymentReport(&report)
+}
+
+func finishPaymentReport(report *storage.PaymentImportReport) error {
+	report.Total = len(report.Payments)
+	if report.Total == 0 {
+		return fmt.Errorf("file contains no payments")
+	}
+	if report.Total > MaxImportPayments {
+		return fmt.Errorf("file is limited to %d payments", MaxImportPayments)
+	}
+	report.ControlSum = decimal.Zero
+	for i := range report.Payments {
+		report.Payments[i].Status = storage.PaymentPending
+		report.ControlSum = report.ControlSum.Add(report.Payments[i].Amount)
+	}
+	if report.MessageID == "" {
+		report.MessageID = storage.GenerateID()
+	}
+	return nil
+}
+
+// ProcessPaymentImport исполняет платежи пакета от имени userID по очереди; ошибка одного платежа не останавливает
+// остальные
+func (svc *Service) ProcessPaymentImport(ctx context.Context, op storage.Operation, userID string, report storage.PaymentImportReport) {
+	op.Status = storage.OperationRunning
+	op.Result = report
+	svc.SaveOperation(ctx, op)
+
+	// Сохранённый отчёт читают параллельно, статусы пишутся в собственную копию
+	report.Payments = append([]storage.PaymentResult(nil), report.Payments...)
+	for i := range report.Payments {
+		payment := &report.Payments[i]
+		tx, err := svc.executePaymentInstruction(ctx, userID, payment.PaymentInstruction)
+		if err != nil {
+			payment.Status = storage.PaymentRejected
+			payment.Error = err.Error()
+			report.Rejected++
+			continue
+		}
+		payment.Status = storage.PaymentExecuted
+		payment.TransactionID = tx.ID
+		report.Executed++
+		svc.PublishBalanceChanged(ctx, tx.FromAccountID)
+		svc.PublishBalanceChanged(ctx, tx.ToAccountID)
+	}
+
+	log.Printf("Payment import %s (%s, message %s) finished: %d executed, %d rejected",
+		op.ID, report.Format, report.MessageID, report.Executed, report.Rejected)
+	svc.completeOperation(ctx, op, report, nil)
+}
+
+// executePaymentInstruction проводит один платёж пакета. Подписать файл ключом устройства нельзя, поэтому платежи,
+// которым нужна подпись, отклоняются — их проводят по одному через /transfers.
+func (svc *Service) executePaymentInstruction(ctx context.Context, userID string, p storage.PaymentInstruction) (storage.Transaction, error) {
+	if !p.Amount.IsPositive() {
+		return storage.Transaction{}, fmt.Errorf("amount must be positive")
+	}
+	for _, number := range []string{p.DebtorAccount, p.CreditorAccount} {
+		if err := storage.ValidateAccountNumber(number); err != nil {
+			return storage.Transaction{}, err
+		}
+	}
+	debtor, ok := svc.GetAccountByNumber(ctx, p.DebtorAccount)
+	if !ok {
+		return storage.Transaction{}, fmt.Errorf("debtor account %s not found", p.DebtorAccount)
+	}
+	creditor, ok := svc.GetAccountByNumber(ctx, p.CreditorAccount)
+	if !ok {
+		return storage.Transaction{}, fmt.Errorf("creditor account %s not found", p.CreditorAccount)
+	}
+	now := time.Now()
+	if err := svc.AuthorizeDebit(ctx, debtor, userID, p.Amount); err != nil {
+		return storage.Transaction{}, err
+	}
+	if debtor.ID == creditor.ID {
+		return storage.Transaction{}, fmt.Errorf("debtor and creditor accounts are the same")
+	}
+	if p.Currency != "" && p.Currency != debtor.Currency {
+		return storage.Transaction{}, fmt.Errorf("currency %s does not match debtor account currency %s", p.Currency, debtor.Currency)
+	}
+	if err := storage.ValidateAmount(p.Amount, debtor.Currency); err != nil {
+		return storage.Transaction{}, err
+	}
+	releaseLimit, err := svc.ReserveTransferLimit(ctx, debtor, p.Amount, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	defer releaseLimit()
+	if err := svc.CheckTierLimits(ctx, &debtor, &creditor, p.Amount, now); err != nil {
+		return storage.Transaction{}, err
+	}
+	if _, err := svc.RequireTransferSignature(ctx, debtor, creditor.ID, p.Amount, storage.DeviceSignature{}, now); err != nil {
+		return storage.Transaction{}, err
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpBatchPayment, p.Amount, debtor.Currency, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	tx, err := svc.TransferFunds(ctx, debtor.ID, creditor.ID, p.Amount, now)
+	if err != nil {
+		release()
+	}
+	return tx, err
+}
+
+// FormatPaymentReportCSV выгружает отчёт о пакете построчно, по одной строке на платёж
+func FormatPaymentReportCSV(report storage.PaymentImportReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"end_to_end_id", "debtor_account", "creditor_account", "amount", "currency", "status", "transaction_id", "error"})
+	for _, p := range report.Payments {
+		w.Write([]string{p.EndToEndID, p.DebtorAccount, p.CreditorAccount, p.Amount.StringFixed(2), p.Currency, p.Status, p.TransactionID, p.Error})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
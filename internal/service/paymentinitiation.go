@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var PaymentInitiationConfig = struct {
+	ConsentTTL          time.Duration   // за это время согласие нужно подтвердить и исполнить
+	CallbackRetryDelays []time.Duration // паузы между попытками доставить callback приложению
+}{
+	ConsentTTL:          24 * time.Hour,
+	CallbackRetryDelays: []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute},
+}
+
+// OpenBankingEvent — уведомление приложению об изменении статуса согласия или платежа. Тело подписывается
+// секретом приложения так же, как вебхуки пользователей.
+type OpenBankingEvent struct {
+	EventID      string    `json:"EventId"`
+	ResourceType string    `json:"ResourceType"` // domestic-payment-consents | domestic-payments
+	ResourceID   string    `json:"ResourceId"`
+	Status       string    `json:"Status"`
+	Reason       string    `json:"Reason,omitempty"`
+	DateTime     time.Time `json:"DateTime"`
+}
+
+func paymentNotFound(id string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodePaymentNotFound, Message: fmt.Sprintf("payment %s not found", id)}
+}
+
+// CreatePaymentConsent создаёт согласие приложения clientID на один перевод на счёт банка по его номеру
+func (svc *Service) CreatePaymentConsent(ctx context.Context, clientID string, initiation storage.PaymentInitiation, now time.Time) (storage.DomesticPaymentConsent, error) {
+	if initiation.InstructionID == "" || initiation.EndToEndID == "" {
+		return storage.DomesticPaymentConsent{}, invalidInputf("instruction and end-to-end identification are required")
+	}
+	if len(initiation.InstructionID) > 35 || len(initiation.EndToEndID) > 35 {
+		return storage.DomesticPaymentConsent{}, invalidInputf("identifications must not exceed 35 characters")
+	}
+	if !initiation.Amount.IsPositive() {
+		return storage.DomesticPaymentConsent{}, invalidInputf("amount must be positive")
+	}
+	initiation.Currency = strings.ToUpper(initiation.Currency)
+	if err := storage.ValidateAmount(initiation.Amount, initiation.Currency); err != nil {
+		return storage.DomesticPaymentConsent{}, err
+	}
+	creditor, ok := svc.GetAccountByNumber(ctx, initiation.CreditorAccountNumber)
+	if !ok || creditor.IsClosed() {
+		return storage.DomesticPaymentConsent{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeAccountNotFound,
+			Message: fmt.Sprintf("creditor account %s not found", initiation.CreditorAccountNumber)}
+	}
+	if creditor.Currency != initiation.Currency {
+		return storage.DomesticPaymentConsent{}, invalidInputf("creditor account is in %s, payment is in %s", creditor.Currency, initiation.Currency)
+	}
+
+	consent := storage.DomesticPaymentConsent{
+		ID:              storage.GenerateID(),
+		ClientID:        clientID,
+		Initiation:      initiation,
+		Status:          storage.ConsentAwaitingAuthorisation,
+		ExpiresAt:       now.Add(PaymentInitiationConfig.ConsentTTL),
+		CreatedAt:       now,
+		StatusUpdatedAt: now,
+	}
+	if err := svc.AddPaymentConsent(ctx, consent); err != nil {
+		return storage.DomesticPaymentConsent{}, err
+	}
+	log.Printf("Payment consent %s created by client %s: %s %s to %s", consent.ID, clientID, initiation.Amount.String(), initiation.Currency, initiation.CreditorAccountNumber)
+	return consent, nil
+}
+
+// ClientPaymentConsent — согласие на платёж приложения clientID; чужие согласия отдаются как несуществующие
+func (svc *Service) ClientPaymentConsent(ctx context.Context, clientID, id string) (storage.DomesticPaymentConsent, error) {
+	consent, ok := svc.GetPaymentConsent(ctx, id)
+	if !ok || consent.ClientID != clientID {
+		return storage.DomesticPaymentConsent{}, consentNotFound(id)
+	}
+	return consent, nil
+}
+
+// ClientDomesticPayment — платёж приложения clientID
+func (svc *Service) ClientDomesticPayment(ctx context.Context, clientID, id string) (storage.DomesticPayment, error) {
+	payment, ok := svc.GetDomesticPayment(ctx, id)
+	if !ok || payment.ClientID != clientID {
+		return storage.DomesticPayment{}, paymentNotFound(id)
+	}
+	return payment, nil
+}
+
+func (svc *Service) pendingPaymentConsent(ctx context.Context, clientID, id string, now time.Time) (storage.DomesticPaymentConsent, error) {
+	consent, err := svc.ClientPaymentConsent(ctx, clientID, id)
+	if err != nil {
+		return storage.DomesticPaymentConsent{}, err
+	}
+	if consent.Status != storage.ConsentAwaitingAuthorisation {
+		return storage.DomesticPaymentConsent{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s is %s", id, consent.Status)}
+	}
+	if now.After(consent.ExpiresAt) {
+		return storage.DomesticPaymentConsent{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s has expired", id)}
+	}
+	return consent, nil
+}
+
+// PayableAccounts — счета пользователя, с которых можно оплатить согласие: в его валюте и с правом платить
+// за организацию
+func (svc *Service) PayableAccounts(ctx context.Context, userID string, consent storage.DomesticPaymentConsent) []storage.Account {
+	accounts := make([]storage.Account, 0)
+	for _, account := range svc.ConsentableAccounts(ctx, userID) {
+		if account.Currency != consent.Initiation.Currency || account.Number == consent.Initiation.CreditorAccountNumber ||
+			svc.AuthorizeOrgAccount(ctx, account, userID, storage.OrgPermPay) != nil {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// decidePaymentConsent записывает решение пользователя по платежу. Счёт списания — единственный из account_ids
+// или, если его не передали, единственный подходящий. Подтверждение на экране банка заменяет подпись устройством
+// не везде: платежи выше порога подписи и двойного контроля так не подтвердить.
+func (svc *Service) decidePaymentConsent(ctx context.Context, consent storage.DomesticPaymentConsent, userID string, accountIDs []string, approve bool, now time.Time) error {
+	status := storage.ConsentRejected
+	debtor := ""
+	if approve {
+		status = storage.ConsentAuthorised
+		payable := svc.PayableAccounts(ctx, userID, consent)
+		switch {
+		case len(accountIDs) > 1:
+			return invalidInputf("choose one account to pay from")
+		case len(accountIDs) == 1:
+			for _, account := range payable {
+				if account.ID == accountIDs[0] {
+					debtor = account.ID
+				}
+			}
+			if debtor == "" {
+				return invalidInputf("account %s cannot pay this consent", accountIDs[0])
+			}
+		case len(payable) == 1:
+			debtor = payable[0].ID
+		default:
+			return invalidInputf("choose one of %d accounts to pay from", len(payable))
+		}
+
+		from, _ := svc.GetAccount(ctx, debtor)
+		if _, err := svc.RequireTransferSignature(ctx, from, "", consent.Initiation.Amount, storage.DeviceSignature{}, now); err != nil {
+			return err
+		}
+		if required, err := svc.PaymentApprovalRequired(ctx, from, consent.Initiation.Amount); err != nil {
+			return err
+		} else if required {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: "payments above the approval threshold of the organization go through /transfers"}
+		}
+	}
+
+	consent, err := svc.UpdatePaymentConsent(ctx, consent.ID, func(c *storage.DomesticPaymentConsent) error {
+		if c.Status != storage.ConsentAwaitingAuthorisation {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s is %s", c.ID, c.Status)}
+		}
+		c.Status = status
+		c.UserID = userID
+		c.DebtorAccountID = debtor
+		c.StatusUpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     userID,
+		Action:    "openbanking.payment_consent_decision",
+		Details: map[string]string{"consent_id": consent.ID, "client_id": consent.ClientID, "status": consent.Status,
+			"debtor_account_id": debtor, "amount": consent.Initiation.Amount.String(), "currency": consent.Initiation.Currency},
+	})
+	svc.NotifyOpenBankingClient(ctx, consent.ClientID, OpenBankingEvent{ResourceType: "domestic-payment-consents", ResourceID: consent.ID, Status: consent.Status, DateTime: now})
+	return nil
+}
+
+// ExecuteDomesticPayment исполняет подтверждённое согласие, к которому привязан токен приложения. Initiation
+// должна совпадать с согласием. Согласие исполняется один раз: повторный запрос возвращает тот же платёж,
+// а не прошедший перевод (лимиты, остаток) остаётся платежом в статусе Rejected.
+func (svc *Service) ExecuteDomesticPayment(ctx context.Context, session storage.Session, consentID string, initiation storage.PaymentInitiation, now time.Time) (storage.DomesticPayment, error) {
+	if session.ConsentID != consentID {
+		return storage.DomesticPayment{}, consentForbidden("token is not bound to consent %s", consentID)
+	}
+	consent, ok := svc.GetPaymentConsent(ctx, consentID)
+	if !ok || consent.ClientID != session.ClientID || consent.UserID != session.UserID {
+		return storage.DomesticPayment{}, consentNotFound(consentID)
+	}
+	initiation.Currency = strings.ToUpper(initiation.Currency)
+	if !consent.Initiation.Equal(initiation) {
+		return storage.DomesticPayment{}, invalidInputf("initiation does not match consent %s", consentID)
+	}
+	if consent.PaymentID != "" {
+		if payment, ok := svc.GetDomesticPayment(ctx, consent.PaymentID); ok {
+			return payment, nil
+		}
+	}
+	if now.After(consent.ExpiresAt) {
+		return storage.DomesticPayment{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s has expired", consentID)}
+	}
+
+	payment := storage.DomesticPayment{
+		ID:              storage.GenerateID(),
+		ConsentID:       consent.ID,
+		ClientID:        consent.ClientID,
+		UserID:          consent.UserID,
+		DebtorAccountID: consent.DebtorAccountID,
+		Initiation:      consent.Initiation,
+		Status:          storage.PaymentStatusPending,
+		CreatedAt:       now,
+		StatusUpdatedAt: now,
+	}
+	// Согласие помечается исполненным до перевода, чтобы параллельный запрос не списал деньги дважды
+	if _, err := svc.UpdatePaymentConsent(ctx, consent.ID, func(c *storage.DomesticPaymentConsent) error {
+		if c.Status != storage.ConsentAuthorised {
+			return &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("consent %s is %s", c.ID, c.Status)}
+		}
+		c.Status = storage.ConsentConsumed
+		c.PaymentID = payment.ID
+		c.StatusUpdatedAt = now
+		return nil
+	}); err != nil {
+		return storage.DomesticPayment{}, err
+	}
+	if err := svc.AddDomesticPayment(ctx, payment); err != nil {
+		return storage.DomesticPayment{}, err
+	}
+
+	tx, err := svc.settleDomesticPayment(ctx, payment, now)
+	payment, _ = svc.UpdateDomesticPayment(ctx, payment.ID, func(p *storage.DomesticPayment) error {
+		if err != nil {
+			p.Status = storage.PaymentStatusRejected
+			p.RejectReason = err.Error()
+		} else {
+			p.Status = storage.PaymentStatusCompleted
+			p.CreditorAccountID = tx.ToAccountID
+			p.TransactionID = tx.ID
+		}
+		p.StatusUpdatedAt = now
+		return nil
+	})
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     payment.UserID,
+		Action:    "openbanking.payment",
+		Details: map[string]string{"payment_id": payment.ID, "consent_id": consent.ID, "client_id": payment.ClientID,
+			"status": payment.Status, "transaction_id": payment.TransactionID},
+	})
+	svc.NotifyOpenBankingClient(ctx, payment.ClientID, OpenBankingEvent{ResourceType: "domestic-payments", ResourceID: payment.ID,
+		Status: payment.Status, Reason: payment.RejectReason, DateTime: now})
+	log.Printf("Open Banking payment %s (consent %s): %s", payment.ID, consent.ID, payment.Status)
+	return payment, nil
+}
+
+// settleDomesticPayment проводит перевод платежа с теми же лимитами, что и перевод из приложения банка
+func (svc *Service) settleDomesticPayment(ctx context.Context, payment storage.DomesticPayment, now time.Time) (storage.Transaction, error) {
+	from, ok := svc.GetAccount(ctx, payment.DebtorAccountID)
+	if !ok {
+		return storage.Transaction{}, fmt.Errorf("debtor account %s not found", payment.DebtorAccountID)
+	}
+	to, ok := svc.GetAccountByNumber(ctx, payment.Initiation.CreditorAccountNumber)
+	if !ok {
+		return storage.Transaction{}, fmt.Errorf("creditor account %s not found", payment.Initiation.CreditorAccountNumber)
+	}
+	releaseLimit, err := svc.ReserveTransferLimit(ctx, from, payment.Initiation.Amount, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	defer releaseLimit()
+	if err := svc.CheckTierLimits(ctx, &from, &to, payment.Initiation.Amount, now); err != nil {
+		return storage.Transaction{}, err
+	}
+	release, err := svc.ReserveOperation(ctx, storage.OpTransfer, payment.Initiation.Amount, from.Currency, now)
+	if err != nil {
+		return storage.Transaction{}, err
+	}
+	tx, err := svc.TransferFunds(ctx, from.ID, to.ID, payment.Initiation.Amount, now)
+	if err != nil {
+		release()
+		return storage.Transaction{}, err
+	}
+	svc.PublishBalanceChanged(ctx, from.ID)
+	svc.PublishBalanceChanged(ctx, to.ID)
+	return tx, nil
+}
+
+// NotifyOpenBankingClient асинхронно доставляет событие на callback_url приложения с повторами по
+// CallbackRetryDelays; приложение без callback_url пропускается
+func (svc *Service) NotifyOpenBankingClient(ctx context.Context, clientID string, event OpenBankingEvent) {
+	client, ok := svc.GetAPIClient(ctx, clientID)
+	if !ok || client.CallbackURL == "" {
+		return
+	}
+	event.EventID = storage.GenerateID()
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for attempt := 1; ; attempt++ {
+			err := deliverOpenBankingEvent(ctx, client, event, body)
+			if err == nil {
+				return
+			}
+			if attempt > len(PaymentInitiationConfig.CallbackRetryDelays) {
+				metrics.add(metricWebhookUndelivered, 1, "target", "openbanking")
+				log.Printf("Client %s callback: %s %s not delivered after %d attempts: %v", clientID, event.ResourceType, event.ResourceID, attempt, err)
+				return
+			}
+			time.Sleep(PaymentInitiationConfig.CallbackRetryDelays[attempt-1])
+		}
+	}()
+}
+
+func deliverOpenBankingEvent(ctx context.Context, client storage.APIClient, event OpenBankingEvent, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.ResourceType)
+	req.Header.Set("X-Webhook-Id", event.EventID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(client.Secret, timestamp, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("client responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
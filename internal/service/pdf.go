@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Минимальный генератор PDF для справок и отчётов: страницы A4 со строками текста стандартными шрифтами
+// Helvetica/Helvetica-Bold и строками столбчатых диаграмм. Встроенных шрифтов нет, поэтому кириллица транслитерируется.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMarginLeft = 56
+	pdfMarginTop  = 64
+	pdfLineHeight = 16
+
+	pdfBarLeft     = pdfMarginLeft + 140 // полосы диаграммы начинаются правее подписи
+	pdfBarMaxWidth = 220
+)
+
+type pdfLine struct {
+	Text string
+	Bold bool
+	Size int
+
+	Bar   bool // строка диаграммы: Text — подпись, Ratio — длина полосы от 0 до 1, Value — подпись справа
+	Ratio float64
+	Value string
+}
+
+type pdfDocument struct {
+	lines []pdfLine
+}
+
+func (d *pdfDocument) Heading(format string, args ...interface{}) {
+	d.lines = append(d.lines, pdfLine{Text: fmt.Sprintf(format, args...), Bold: true, Size: 16})
+}
+
+func (d *pdfDocument) Bold(format string, args ...interface{}) {
+	d.lines = append(d.lines, pdfLine{Text: fmt.Sprintf(format, args...), Bold: true, Size: 11})
+}
+
+func (d *pdfDocument) Text(format string, args ...interface{}) {
+	d.lines = append(d.lines, pdfLine{Text: fmt.Sprintf(format, args...), Size: 11})
+}
+
+// Bar добавляет строку горизонтальной диаграммы; ratio — длина полосы относительно самой длинной (0..1)
+func (d *pdfDocument) Bar(label string, ratio float64, value string) {
+	d.lines = append(d.lines, pdfLine{Text: label, Size: 10, Bar: true, Ratio: math.Max(0, math.Min(1, ratio)), Value: value})
+}
+
+func (d *pdfDocument) Blank() {
+	d.lines = append(d.lines, pdfLine{})
+}
+
+// pdfString транслитерирует кириллицу и экранирует скобки для строкового литерала PDF
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		if latin, ok := cyrillicToLatin[lower]; ok {
+			if r != lower && latin != "" {
+				latin = strings.ToUpper(latin[:1]) + latin[1:]
+			}
+			b.WriteString(latin)
+			continue
+		}
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '№':
+			b.WriteString("No.")
+		case r >= ' ' && r < unicode.MaxASCII:
+			b.WriteRune(r)
+		default:
+			b.WriteRune('?')
+		}
+	}
+	return b.String()
+}
+
+// Bytes раскладывает строки по страницам и собирает файл с таблицей перекрёстных ссылок
+func (d *pdfDocument) Bytes() []byte {
+	perPage := (pdfPageHeight - 2*pdfMarginTop) / pdfLineHeight
+	pages := [][]pdfLine{nil}
+	for _, line := range d.lines {
+		if len(pages[len(pages)-1]) == perPage {
+			pages = append(pages, nil)
+		}
+		pages[len(pages)-1] = append(pages[len(pages)-1], line)
+	}
+
+	// 1 — каталог, 2 — дерево страниц, 3 и 4 — шрифты, далее пары «страница, содержимое»
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	for i, lines := range pages {
+		var content bytes.Buffer
+		y := pdfPageHeight - pdfMarginTop
+		for _, line := range lines {
+			if line.Bar {
+				width := int(math.Round(line.Ratio * pdfBarMaxWidth))
+				if width > 0 {
+					fmt.Fprintf(&content, "0.27 0.45 0.75 rg %d %d %d 9 re f 0 g\n", pdfBarLeft, y-1, width)
+				}
+				fmt.Fprintf(&content, "BT /F1 %d Tf %d %d Td (%s) Tj ET\n", line.Size, pdfBarLeft+width+6, y, pdfString(line.Value))
+			}
+			if line.Text != "" {
+				font := "F1"
+				if line.Bold {
+					font = "F2"
+				}
+				fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, line.Size, pdfMarginLeft, y, pdfString(line.Text))
+			}
+			y -= pdfLineHeight
+		}
+		fmt.Fprintf(&content, "BT /F1 8 Tf %d %d Td (Page %d of %d) Tj ET\n", pdfMarginLeft, pdfMarginTop/2, i+1, len(pages))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// recordRates сохраняет полученные от источника значения в историю; ключ rates — валюта, для ключевой ставки пустой
+func (svc *Service) recordRates(ctx context.Context, kind, source, date string, rates map[string]decimal.Decimal, fetchedAt time.Time) {
+	snapshots := make([]storage.RateSnapshot, 0, len(rates))
+	for currency, rate := range rates {
+		snapshots = append(snapshots, storage.RateSnapshot{Kind: kind, Currency: currency, Date: date, Rate: rate, Source: source, FetchedAt: fetchedAt})
+	}
+	if err := svc.SaveRateSnapshots(context.WithoutCancel(ctx), snapshots); err != nil {
+		log.Printf("Failed to save %s rate history for %s: %v", kind, date, err)
+	}
+}
+
+// RateHistory — история курса валюты (kind fx) или ключевой ставки (kind key_rate) за период
+func (svc *Service) RateHistory(ctx context.Context, kind, currency string, from, to time.Time) ([]storage.RateSnapshot, error) {
+	switch kind {
+	case "", storage.RateKindFX:
+		kind = storage.RateKindFX
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if currency == "" {
+			return nil, invalidInputf("currency is required for fx history")
+		}
+	case storage.RateKindKeyRate:
+		currency = ""
+	default:
+		return nil, invalidInputf("kind must be %s or %s", storage.RateKindFX, storage.RateKindKeyRate)
+	}
+	return svc.Repository.RateHistory(ctx, kind, currency, from.Format("2006-01-02"), to.Format("2006-01-02")), nil
+}
+
+// runRateFetch запрашивает курсы и ключевую ставку в обход кеша, чтобы история пополнялась каждый день,
+// даже если в этот день никто не менял валюту
+func (svc *Service) runRateFetch(ctx context.Context, now time.Time) {
+	fxRatesMutex.Lock()
+	rates, date, err := fetchCBRDailyRates(ctx)
+	if err == nil {
+		cachedFXRates.rates = rates
+		cachedFXRates.time = now
+	}
+	fxRatesMutex.Unlock()
+	if err != nil {
+		log.Printf("Rate fetch: CBR daily rates unavailable: %v", err)
+	} else {
+		svc.recordRates(ctx, storage.RateKindFX, RateProviderCBR, date, rates, now)
+		log.Printf("Rate fetch: stored %d CBR rates for %s", len(rates), date)
+	}
+
+	keyRateMutex.Lock()
+	cachedKeyRate.time = time.Time{}
+	keyRateMutex.Unlock()
+	if _, err := svc.GetCBRKeyRate(ctx); err != nil {
+		log.Printf("Rate fetch: key rate unavailable: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	RateProviderCBR    = "cbr"
+	RateProviderECB    = "ecb"
+	RateProviderStatic = "static"
+)
+
+// RateProviderConfig — откуда берётся ключевая ставка. Providers — порядок опроса: при ошибке источника
+// запрашивается следующий, так что static в конце списка гарантирует ответ.
+var RateProviderConfig = struct {
+	Providers     []string
+	Timeout       time.Duration   // сколько ждём один источник
+	StaticKeyRate decimal.Decimal // значение для static, в процентах годовых
+	CBRURL        string
+	ECBURL        string
+}{
+	Providers:     strings.Split(EnvOrDefault("BANKAPP_RATE_PROVIDERS", RateProviderCBR+","+RateProviderStatic), ","),
+	Timeout:       5 * time.Second,
+	StaticKeyRate: marginFromEnv("BANKAPP_STATIC_KEY_RATE", decimal.NewFromInt(16)),
+	CBRURL:        "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx/KeyRateXML",
+	ECBURL:        "https://data-api.ecb.europa.eu/service/data/FM/B.U2.EUR.4F.KR.MRR_FR.LEV?lastNObservations=1&format=csvdata",
+}
+
+// RateProvider отдаёт текущую ключевую ставку в процентах и дату (YYYY-MM-DD), с которой она действует.
+// Реализация должна уважать дедлайн ctx.
+type RateProvider interface {
+	Name() string
+	KeyRate(ctx context.Context) (rate decimal.Decimal, date string, err error)
+}
+
+// newRateProviders собирает источники в порядке из конфигурации; неизвестные имена пропускаются
+func newRateProviders(names []string) []RateProvider {
+	client := &http.Client{}
+	var providers []RateProvider
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case RateProviderCBR:
+			providers = append(providers, &CBRRateProvider{URL: RateProviderConfig.CBRURL, Client: client})
+		case RateProviderECB:
+			providers = append(providers, &ECBRateProvider{URL: RateProviderConfig.ECBURL, Client: client})
+		case RateProviderStatic:
+			providers = append(providers, StaticRateProvider{Rate: RateProviderConfig.StaticKeyRate})
+		case "":
+		default:
+			log.Printf("Unknown rate provider %q in BANKAPP_RATE_PROVIDERS, skipping", name)
+		}
+	}
+	if len(providers) == 0 {
+		providers = append(providers, StaticRateProvider{Rate: RateProviderConfig.StaticKeyRate})
+	}
+	return providers
+}
+
+// CBRRateProvider — ключевая ставка Банка России из веб-сервиса DailyInfo
+type CBRRateProvider struct {
+	URL    string
+	Client *http.Client
+}
+
+type cbrKeyRateRow struct {
+	DT   string `xml:"DT"`
+	Rate string `xml:"Rate"`
+}
+
+func (p *CBRRateProvider) Name() string { return RateProviderCBR }
+
+func (p *CBRRateProvider) KeyRate(ctx context.Context) (decimal.Decimal, string, error) {
+	now := time.Now()
+	url := fmt.Sprintf("%s?fromDate=%s&ToDate=%s", p.URL, now.AddDate(0, 0, -30).Format("2006-01-02"), now.Format("2006-01-02"))
+	body, err := getRateSource(ctx, p.Client, url, "CBR")
+	if err != nil {
+		return decimal.Zero, "", err
+	}
+	defer body.Close()
+
+	// Ответ — DataSet со строками <KR><DT>дата</DT><Rate>ставка</Rate></KR>; берём самую свежую
+	var latest cbrKeyRateRow
+	decoder := xml.NewDecoder(body)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return decimal.Zero, "", fmt.Errorf("failed to decode CBR key rate: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "KR" {
+			continue
+		}
+		var row cbrKeyRateRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return decimal.Zero, "", fmt.Errorf("failed to decode CBR key rate: %w", err)
+		}
+		if row.DT > latest.DT {
+			latest = row
+		}
+	}
+	if latest.DT == "" {
+		return decimal.Zero, "", errors.New("CBR returned no key rate")
+	}
+	rate, err := decimal.NewFromString(strings.TrimSpace(latest.Rate))
+	if err != nil {
+		return decimal.Zero, "", fmt.Errorf("invalid CBR key rate %q", latest.Rate)
+	}
+	return rate, rateDate(latest.DT), nil
+}
+
+// ECBRateProvider — ставка основных операций рефинансирования ЕЦБ из Data Portal в формате CSV
+type ECBRateProvider struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *ECBRateProvider) Name() string { return RateProviderECB }
+
+func (p *ECBRateProvider) KeyRate(ctx context.Context) (decimal.Decimal, string, error) {
+	body, err := getRateSource(ctx, p.Client, p.URL, "ECB")
+	if err != nil {
+		return decimal.Zero, "", err
+	}
+	defer body.Close()
+
+	records, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return decimal.Zero, "", fmt.Errorf("failed to decode ECB response: %w", err)
+	}
+	if len(records) < 2 {
+		return decimal.Zero, "", errors.New("ECB returned no observations")
+	}
+	period, value := -1, -1
+	for i, column := range records[0] {
+		switch column {
+		case "TIME_PERIOD":
+			period = i
+		case "OBS_VALUE":
+			value = i
+		}
+	}
+	if period < 0 || value < 0 {
+		return decimal.Zero, "", errors.New("ECB response has no TIME_PERIOD/OBS_VALUE columns")
+	}
+	last := records[len(records)-1]
+	if len(last) <= period || len(last) <= value {
+		return decimal.Zero, "", errors.New("ECB returned a malformed observation")
+	}
+	rate, err := decimal.NewFromString(last[value])
+	if err != nil {
+		return decimal.Zero, "", fmt.Errorf("invalid ECB rate %q", last[value])
+	}
+	return rate, rateDate(last[period]), nil
+}
+
+// StaticRateProvider отдаёт ставку из конфигурации; подходит для стендов без доступа наружу и как последний резерв
+type StaticRateProvider struct {
+	Rate decimal.Decimal
+}
+
+func (p StaticRateProvider) Name() string { return RateProviderStatic }
+
+func (p StaticRateProvider) KeyRate(ctx context.Context) (decimal.Decimal, string, error) {
+	return p.Rate, time.Now().Format("2006-01-02"), nil
+}
+
+func getRateSource(ctx context.Context, client *http.Client, url, source string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", source, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s responded with status %d", source, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// rateDate приводит дату источника к YYYY-MM-DD; нераспознанная дата заменяется сегодняшней
+func rateDate(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 10 {
+		if parsed, err := time.Parse("2006-01-02", value[:10]); err == nil {
+			return parsed.Format("2006-01-02")
+		}
+	}
+	return time.Now().Format("2006-01-02")
+}
+
+// fetchKeyRate опрашивает источники по порядку и возвращает первый ответ вместе с именем источника
+func (svc *Service) fetchKeyRate(ctx context.Context) (decimal.Decimal, string, string, error) {
+	var errs []error
+	for _, provider := range svc.rateProviders {
+		providerCtx, cancel := context.WithTimeout(ctx, RateProviderConfig.Timeout)
+		rate, date, err := provider.KeyRate(providerCtx)
+		cancel()
+		if err == nil && rate.IsNegative() {
+			err = fmt.Errorf("negative key rate %s", rate.String())
+		}
+		if err == nil {
+			return rate, date, provider.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return decimal.Zero, "", "", ctx.Err()
+		}
+		metrics.add(metricRateProviderFailures, 1, "provider", provider.Name())
+		log.Printf("Rate provider %s failed, trying next: %v", provider.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return decimal.Zero, "", "", fmt.Errorf("all rate providers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// ReconcileLedger сверяет хранимые остатки всех счетов с остатками, пересчитанными из журнала. Остатки
+// не исправляются: расхождение — признак ошибки в коде проводок, и разбирать его должен человек. Операции, которые
+// меняют остаток и пишут проводку разными вызовами (пополнение, выдача кредита), в момент сверки могут дать
+// кратковременное расхождение — его стоит перепроверить повторным запросом.
+func (svc *Service) ReconcileLedger(ctx context.Context, now time.Time) storage.ReconciliationReport {
+	accounts, totals, transactions := svc.LedgerBalances(ctx)
+	report := storage.ReconciliationReport{
+		GeneratedAt:   now,
+		Accounts:      len(accounts),
+		Transactions:  transactions,
+		Discrepancies: make([]storage.BalanceDiscrepancy, 0),
+	}
+	for _, acc := range accounts {
+		t := totals[acc.ID]
+		ledger := t.Credits.Sub(t.Debits)
+		if acc.Balance.Equal(ledger) {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, storage.BalanceDiscrepancy{
+			AccountID:     acc.ID,
+			UserID:        acc.UserID,
+			Number:        acc.Number,
+			Currency:      acc.Currency,
+			StoredBalance: acc.Balance,
+			LedgerBalance: ledger,
+			Difference:    acc.Balance.Sub(ledger),
+			Credits:       t.Credits,
+			Debits:        t.Debits,
+			Transactions:  t.Transactions,
+		})
+	}
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		return report.Discrepancies[i].Difference.Abs().GreaterThan(report.Discrepancies[j].Difference.Abs())
+	})
+	report.Consistent = len(report.Discrepancies) == 0
+	if !report.Consistent {
+		log.Printf("Ledger reconciliation: %d of %d accounts differ from the ledger", len(report.Discrepancies), report.Accounts)
+	}
+	return report
+}
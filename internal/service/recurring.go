@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var RecurringConfig = struct {
+	MinOccurrences  int     // столько платежей нужно, чтобы признать серию регулярной
+	AmountTolerance float64 // допустимое отклонение суммы от медианы серии (доля)
+	LookbackMonths  int     // глубина истории, по которой ищутся серии
+}{
+	MinOccurrences:  3,
+	AmountTolerance: 0.25,
+	LookbackMonths:  18,
+}
+
+// recurringPeriods — распознаваемые периоды: средняя длина в днях и допустимое отклонение интервала между платежами
+var recurringPeriods = []struct {
+	Name      string
+	Days      float64
+	Tolerance float64
+	Months    int // следующая дата считается календарными месяцами; 0 — днями
+}{
+	{storage.RecurringWeekly, 7, 1.5, 0},
+	{storage.RecurringMonthly, 30.4, 4, 1},
+	{storage.RecurringQuarterly, 91.3, 8, 3},
+	{storage.RecurringYearly, 365.25, 15, 12},
+}
+
+// recurringKey — к какой серии относится списание со счёта accountID: оплаты группируются по мерчанту,
+// переводы — по счёту получателя. Переводы на свои счета (own) регулярными расходами не считаются.
+func recurringKey(tx storage.Transaction, accountID string, own map[string]bool) (string, bool) {
+	if tx.FromAccountID != accountID {
+		return "", false
+	}
+	switch {
+	case tx.TransactionType == "payment" && tx.MerchantID != "":
+		return "merchant:" + tx.MerchantID, true
+	case tx.TransactionType == "payment" && tx.Merchant != "":
+		return "merchant:" + strings.ToLower(tx.Merchant), true
+	case tx.TransactionType == "transfer" && tx.ToAccountID != "" && !own[tx.ToAccountID]:
+		return "account:" + tx.ToAccountID, true
+	}
+	return "", false
+}
+
+// recurringSeries проверяет, что платежи кандидата (по возрастанию даты) идут с постоянным периодом
+// и на близкие суммы. Три четверти интервалов должны укладываться в допуск периода — один пропущенный
+// или сдвинутый платёж серию не ломает.
+func recurringSeries(account storage.Account, txs []storage.Transaction, now time.Time) (storage.RecurringPayment, bool) {
+	if len(txs) < RecurringConfig.MinOccurrences {
+		return storage.RecurringPayment{}, false
+	}
+	intervals := make([]float64, 0, len(txs)-1)
+	for i := 1; i < len(txs); i++ {
+		intervals = append(intervals, txs[i].EffectiveDate().Sub(txs[i-1].EffectiveDate()).Hours()/24)
+	}
+	median := medianFloat(intervals)
+
+	for _, period := range recurringPeriods {
+		if math.Abs(median-period.Days) > period.Tolerance {
+			continue
+		}
+		regular := 0
+		for _, days := range intervals {
+			if math.Abs(days-period.Days) <= period.Tolerance {
+				regular++
+			}
+		}
+		if regular*4 < len(intervals)*3 {
+			return storage.RecurringPayment{}, false
+		}
+
+		amounts := make([]float64, len(txs))
+		sum := decimal.Zero
+		for i, tx := range txs {
+			amounts[i] = tx.Amount.InexactFloat64()
+			sum = sum.Add(tx.Amount)
+		}
+		typical := medianFloat(amounts)
+		for _, amount := range amounts {
+			if math.Abs(amount-typical) > typical*RecurringConfig.AmountTolerance {
+				return storage.RecurringPayment{}, false
+			}
+		}
+
+		first, last := txs[0], txs[len(txs)-1]
+		rp := storage.RecurringPayment{
+			AccountID:     account.ID,
+			Currency:      account.Currency,
+			Category:      last.Category,
+			Period:        period.Name,
+			Occurrences:   len(txs),
+			Amount:        last.Amount,
+			AverageAmount: sum.Div(decimal.NewFromInt(int64(len(txs)))).RoundBank(2),
+			FirstDate:     first.EffectiveDate(),
+			LastDate:      last.EffectiveDate(),
+		}
+		if last.TransactionType == "payment" {
+			rp.Merchant, rp.MerchantID = last.Merchant, last.MerchantID
+		} else {
+			rp.ToAccountID = last.ToAccountID
+			rp.Category = last.TransactionType
+		}
+		if rp.Category == "" {
+			rp.Category = "other"
+		}
+		if previous := txs[len(txs)-2].Amount; last.Amount.GreaterThan(previous) {
+			rp.PreviousAmount = &previous
+		}
+		if period.Months > 0 {
+			rp.NextDate = rp.LastDate.AddDate(0, period.Months, 0)
+		} else {
+			rp.NextDate = rp.LastDate.AddDate(0, 0, int(period.Days))
+		}
+		rp.Active = !now.After(rp.NextDate.Add(time.Duration(2*period.Tolerance*24) * time.Hour))
+		return rp, true
+	}
+	return storage.RecurringPayment{}, false
+}
+
+func medianFloat(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// accountRecurringSeries раскладывает списания со счёта за RecurringConfig.LookbackMonths по сериям-кандидатам:
+// сначала по получателю, затем по близости сумм — так аренда не смешивается с разовыми переводами тому же
+// человеку, а подписка — с покупками у того же мерчанта. Внутри кандидата платежи идут по возрастанию даты.
+func accountRecurringSeries(account storage.Account, txs []storage.Transaction, own map[string]bool, now time.Time) map[string][][]storage.Transaction {
+	since := now.AddDate(0, -RecurringConfig.LookbackMonths, 0)
+	byPayee := make(map[string][]storage.Transaction)
+	for _, tx := range txs {
+		if tx.EffectiveDate().Before(since) || tx.EffectiveDate().After(now) {
+			continue
+		}
+		if key, ok := recurringKey(tx, account.ID, own); ok {
+			byPayee[key] = append(byPayee[key], tx)
+		}
+	}
+
+	series := make(map[string][][]storage.Transaction, len(byPayee))
+	for key, list := range byPayee {
+		sort.Slice(list, func(i, j int) bool { return list[i].Amount.LessThan(list[j].Amount) })
+		var clusters [][]storage.Transaction
+		start := 0
+		for i := 1; i <= len(list); i++ {
+			if i < len(list) && list[i].Amount.InexactFloat64() <= list[start].Amount.InexactFloat64()*(1+RecurringConfig.AmountTolerance) {
+				continue
+			}
+			cluster := append([]storage.Transaction(nil), list[start:i]...)
+			sort.Slice(cluster, func(a, b int) bool { return cluster[a].EffectiveDate().Before(cluster[b].EffectiveDate()) })
+			clusters = append(clusters, cluster)
+			start = i
+		}
+		series[key] = clusters
+	}
+	return series
+}
+
+// UserRecurringPayments находит регулярные платежи по всем счетам клиента: активные первыми по ближайшей дате,
+// затем отменённые. MonthlyTotal — сколько активные платежи стоят в месяц в рублях.
+func (svc *Service) UserRecurringPayments(ctx context.Context, userID string, now time.Time) storage.RecurringPayments {
+	result := storage.RecurringPayments{UserID: userID, Payments: make([]storage.RecurringPayment, 0), MonthlyTotal: decimal.Zero, Currency: storage.BaseCurrency}
+	accounts := svc.GetUserAccounts(ctx, userID)
+	own := make(map[string]bool, len(accounts))
+	for _, acc := range accounts {
+		own[acc.ID] = true
+	}
+
+	perMonth := map[string]float64{storage.RecurringWeekly: 52.0 / 12, storage.RecurringMonthly: 1, storage.RecurringQuarterly: 1.0 / 3, storage.RecurringYearly: 1.0 / 12}
+	for _, acc := range accounts {
+		for _, clusters := range accountRecurringSeries(acc, svc.GetAccountTransactions(ctx, acc.ID), own, now) {
+			for _, txs := range clusters {
+				rp, ok := recurringSeries(acc, txs, now)
+				if !ok {
+					continue
+				}
+				result.Payments = append(result.Payments, rp)
+				if !rp.Active {
+					continue
+				}
+				monthly, err := svc.toBaseCurrency(ctx, rp.Amount.Mul(decimal.NewFromFloat(perMonth[rp.Period])), acc.Currency)
+				if err != nil {
+					log.Printf("Recurring payments: %s excluded from monthly total: %v", acc.Currency, err)
+					continue
+				}
+				result.MonthlyTotal = result.MonthlyTotal.Add(monthly)
+			}
+		}
+	}
+	result.MonthlyTotal = result.MonthlyTotal.RoundBank(2)
+	sort.Slice(result.Payments, func(i, j int) bool {
+		a, b := result.Payments[i], result.Payments[j]
+		if a.Active != b.Active {
+			return a.Active
+		}
+		return a.NextDate.Before(b.NextDate)
+	})
+	return result
+}
+
+// recurringPriceIncrease проверяет, продолжает ли списание tx известную регулярную серию по счёту и насколько оно
+// дороже прошлого платежа серии. Серия определяется по истории до tx, поэтому подорожание её не ломает.
+func (svc *Service) recurringPriceIncrease(ctx context.Context, account storage.Account, tx storage.Transaction) (storage.RecurringPayment, bool) {
+	own := make(map[string]bool)
+	for _, acc := range svc.GetUserAccounts(ctx, account.UserID) {
+		own[acc.ID] = true
+	}
+	key, ok := recurringKey(tx, account.ID, own)
+	if !ok {
+		return storage.RecurringPayment{}, false
+	}
+	history := make([]storage.Transaction, 0)
+	for _, other := range svc.GetAccountTransactions(ctx, account.ID) {
+		if other.ID != tx.ID && other.EffectiveDate().Before(tx.EffectiveDate()) {
+			history = append(history, other)
+		}
+	}
+	// Если у получателя несколько регулярных серий, tx продолжает ту, чья сумма ближе
+	var found *storage.RecurringPayment
+	for _, txs := range accountRecurringSeries(account, history, own, tx.EffectiveDate())[key] {
+		rp, ok := recurringSeries(account, txs, tx.EffectiveDate())
+		if ok && rp.Active && (found == nil || tx.Amount.Sub(rp.Amount).Abs().LessThan(tx.Amount.Sub(found.Amount).Abs())) {
+			found = &rp
+		}
+	}
+	if found == nil || !tx.Amount.GreaterThan(found.Amount) {
+		return storage.RecurringPayment{}, false
+	}
+	return *found, true
+}
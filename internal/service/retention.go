@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var cvvHashSecret = secretFromEnv("BANKAPP_CVV_SECRET")
+
+// TransactionRetentionYears — сколько лет проводки живут в горячем журнале, прежде чем уйти в архив
+var TransactionRetentionYears = retentionYearsFromEnv("BANKAPP_TRANSACTION_RETENTION_YEARS", 5)
+
+var RetentionPolicies = []storage.RetentionPolicy{
+	{Name: "card-cvv", Target: "card.cvv", After: 24 * time.Hour, Action: "hash"},
+	{Name: "revoked-session-client-info", Target: "session.client_info", After: 90 * 24 * time.Hour, Action: "purge"},
+	{Name: "transaction-archive", Target: "transaction", After: time.Duration(TransactionRetentionYears) * 365 * 24 * time.Hour, Action: "archive"},
+}
+
+func retentionYearsFromEnv(key string, fallback int) int {
+	years, err := strconv.Atoi(EnvOrDefault(key, strconv.Itoa(fallback)))
+	if err != nil || years <= 0 {
+		log.Printf("Invalid %s, using %d", key, fallback)
+		return fallback
+	}
+	return years
+}
+
+const retentionInterval = time.Hour
+
+// CVV хешируется с ID карты, чтобы одинаковые коды разных карт давали разные хеши
+func hashCVV(card storage.Card) string {
+	mac := hmac.New(sha256.New, cvvHashSecret)
+	mac.Write([]byte(card.ID + ":" + card.CVV))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyCardCVV(card storage.Card, cvv string) bool {
+	if card.CVV != "" {
+		return hmac.Equal([]byte(card.CVV), []byte(cvv))
+	}
+	if card.CVVHash == "" {
+		return false
+	}
+	candidate := card
+	candidate.CVV = cvv
+	return hmac.Equal([]byte(hashCVV(candidate)), []byte(card.CVVHash))
+}
+
+func (svc *Service) runRetentionPolicies(ctx context.Context, now time.Time) {
+	for _, policy := range RetentionPolicies {
+		cutoff := now.Add(-policy.After)
+		var affected int
+		switch policy.Target {
+		case "card.cvv":
+			affected = svc.HashCardCVVs(ctx, cutoff, hashCVV, now)
+		case "session.client_info":
+			affected = svc.PurgeSessionClientInfo(ctx, cutoff)
+		case "transaction":
+			archived, err := svc.ArchiveTransactions(ctx, cutoff, now)
+			if err != nil {
+				log.Printf("Retention policy %s: %v", policy.Name, err)
+				continue
+			}
+			affected = archived
+		default:
+			log.Printf("Retention: unknown target %s in policy %s", policy.Target, policy.Name)
+			continue
+		}
+
+		svc.AddAuditEntry(ctx, storage.AuditEntry{
+			ID:        storage.GenerateID(),
+			Timestamp: now,
+			Actor:     "system:retention",
+			Action:    "retention.purge",
+			Details: map[string]string{
+				"policy":   policy.Name,
+				"target":   policy.Target,
+				"action":   policy.Action,
+				"cutoff":   cutoff.Format(time.RFC3339),
+				"affected": strconv.Itoa(affected),
+			},
+		})
+		if affected > 0 {
+			log.Printf("Retention policy %s: %d records processed", policy.Name, affected)
+		}
+	}
+}
+
+func (svc *Service) StartRetentionJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				svc.runRetentionPolicies(ctx, now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+var ReversalConfig = struct {
+	Window time.Duration // сколько после зачисления пополнение ещё можно отменить
+}{
+	Window: durationFromEnv("BANKAPP_DEPOSIT_REVERSAL_WINDOW", 72*time.Hour),
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	window, err := time.ParseDuration(EnvOrDefault(key, fallback.String()))
+	if err != nil || window <= 0 {
+		log.Printf("Invalid %s, using %s", key, fallback)
+		return fallback
+	}
+	return window
+}
+
+// ReverseDeposit отменяет ошибочное пополнение по решению администратора и уведомляет клиента.
+// Если средств на счёте не хватает, недостача остаётся дебиторской задолженностью.
+func (svc *Service) ReverseDeposit(ctx context.Context, depositTxID, reason string, now time.Time) (storage.DepositReversal, error) {
+	deposit, ok := svc.GetTransaction(ctx, depositTxID)
+	if !ok {
+		return storage.DepositReversal{}, &storage.StorageError{Kind: storage.ErrNotFound, Code: storage.CodeTransactionNotFound, Message: fmt.Sprintf("transaction %s not found", depositTxID)}
+	}
+	accountNumber := svc.counterpartyNumber(ctx, deposit.ToAccountID)
+
+	reversal := storage.Transaction{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+	}
+	reversal.Describe(storage.DescDepositReversal, map[string]string{"account": accountNumber, "reason": reason})
+	receivable := storage.Receivable{
+		ID:     storage.GenerateID(),
+		Reason: "deposit_reversal",
+	}
+
+	result, err := svc.Repository.ReverseDeposit(ctx, depositTxID, reversal, receivable, ReversalConfig.Window, now)
+	if err != nil {
+		return result, err
+	}
+
+	details := map[string]string{
+		"deposit": deposit.ID,
+		"account": deposit.ToAccountID,
+		"amount":  deposit.Amount.String(),
+		"reason":  reason,
+	}
+	if result.Reversal != nil {
+		details["reversal"] = result.Reversal.ID
+		details["debited"] = result.Reversal.Amount.String()
+	}
+	if result.Receivable != nil {
+		details["receivable"] = result.Receivable.ID
+		details["shortfall"] = result.Receivable.Amount.String()
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "deposit.reverse",
+		Details:   details,
+	})
+	svc.PublishBalanceChanged(ctx, deposit.ToAccountID)
+	svc.notifyDepositReversal(context.WithoutCancel(ctx), result, accountNumber, reason)
+
+	log.Printf("Deposit %s reversed: %s", deposit.ID, details)
+	return result, nil
+}
+
+func (svc *Service) notifyDepositReversal(ctx context.Context, result storage.DepositReversal, accountNumber, reason string) {
+	account, ok := svc.GetAccount(ctx, result.Deposit.ToAccountID)
+	if !ok {
+		return
+	}
+	user, ok := svc.GetUser(ctx, account.UserID)
+	if !ok {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\nThe deposit of %s to account %s from %s was credited in error and has been reversed.",
+		user.Username, result.Deposit.Amount.String(), accountNumber, result.Deposit.Timestamp.Format("02.01.2006 15:04"))
+	if reason != "" {
+		body += "\nReason: " + reason
+	}
+	if result.Receivable != nil {
+		body += fmt.Sprintf("\n\n%s could not be debited because of insufficient funds and is recorded as an outstanding amount on your account. "+
+			"It will be settled automatically from future incoming funds.", result.Receivable.Amount.String())
+	}
+	svc.QueueEmail(ctx, user.Email, "Simple Bank: deposit reversed", body)
+}
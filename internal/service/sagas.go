@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// SagaStep — шаг многошаговой операции. Compensate отменяет уже выполненный Do; nil — откатывать нечего.
+type SagaStep struct {
+	Name       string
+	Do         func(ctx context.Context) error
+	Compensate func(ctx context.Context) error
+}
+
+// sagaRegistry держит откаты зависших операций, чтобы админ мог повторить их без перезапуска.
+// Замыкания живут только в памяти процесса, как и само хранилище.
+type sagaRegistry struct {
+	mu      sync.Mutex
+	pending map[string][]SagaStep // key: SagaID -> ещё не откатанные шаги в порядке отката
+}
+
+func newSagaRegistry() *sagaRegistry {
+	return &sagaRegistry{pending: make(map[string][]SagaStep)}
+}
+
+func (r *sagaRegistry) take(id string) ([]SagaStep, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	steps, ok := r.pending[id]
+	delete(r.pending, id)
+	return steps, ok
+}
+
+func (r *sagaRegistry) put(id string, steps []SagaStep) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[id] = steps
+}
+
+// RunSaga выполняет шаги по порядку и журналирует каждый. При ошибке выполненные шаги откатываются
+// в обратном порядке, а вызывающему возвращается исходная ошибка. Откат идёт без отмены ctx:
+// отменённый клиентом запрос не должен оставить операцию наполовину выполненной.
+func (svc *Service) RunSaga(ctx context.Context, kind string, refs map[string]string, steps []SagaStep, now time.Time) (storage.Saga, error) {
+	saga := storage.Saga{
+		ID:        storage.GenerateID(),
+		Kind:      kind,
+		Refs:      refs,
+		Status:    storage.SagaRunning,
+		Steps:     make([]storage.SagaStep, len(steps)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i, step := range steps {
+		saga.Steps[i] = storage.SagaStep{Name: step.Name, Status: storage.SagaStepPending, UpdatedAt: now}
+	}
+	svc.SaveSaga(ctx, saga)
+
+	for i, step := range steps {
+		err := ctx.Err()
+		if err == nil {
+			err = step.Do(ctx)
+		}
+		if err != nil {
+			saga.Steps[i].Status = storage.SagaStepFailed
+			saga.Steps[i].Error = err.Error()
+			saga.Error = fmt.Sprintf("step %s: %v", step.Name, err)
+			log.Printf("Saga %s (%s) failed at step %s: %v, compensating", saga.ID, kind, step.Name, err)
+
+			undo := make([]SagaStep, 0, i)
+			for j := i - 1; j >= 0; j-- {
+				undo = append(undo, steps[j])
+			}
+			svc.compensateSaga(context.WithoutCancel(ctx), &saga, undo, time.Now())
+			return saga, err
+		}
+		saga.Steps[i].Status = storage.SagaStepDone
+		saga.Steps[i].UpdatedAt = time.Now()
+		saga.UpdatedAt = saga.Steps[i].UpdatedAt
+		svc.SaveSaga(ctx, saga)
+	}
+
+	saga.Status = storage.SagaCompleted
+	svc.SaveSaga(ctx, saga)
+	return saga, nil
+}
+
+// compensateSaga откатывает шаги undo (уже в обратном порядке). На первой неудаче операция
+// становится stuck, а оставшиеся откаты сохраняются для повтора из админки.
+func (svc *Service) compensateSaga(ctx context.Context, saga *storage.Saga, undo []SagaStep, now time.Time) {
+	index := make(map[string]int, len(saga.Steps))
+	for i, step := range saga.Steps {
+		index[step.Name] = i
+	}
+
+	for k, step := range undo {
+		i := index[step.Name]
+		if step.Compensate == nil {
+			continue
+		}
+		if err := step.Compensate(ctx); err != nil {
+			saga.Steps[i].Status = storage.SagaStepCompensationFailed
+			saga.Steps[i].Error = err.Error()
+			saga.Steps[i].UpdatedAt = now
+			saga.Status = storage.SagaStuck
+			saga.UpdatedAt = now
+			svc.sagas.put(saga.ID, undo[k:])
+			svc.SaveSaga(ctx, *saga)
+
+			svc.AddAuditEntry(ctx, storage.AuditEntry{
+				ID:        storage.GenerateID(),
+				Timestamp: now,
+				Actor:     "system",
+				Action:    "saga.stuck",
+				Details:   map[string]string{"saga_id": saga.ID, "kind": saga.Kind, "step": step.Name, "error": err.Error()},
+			})
+			log.Printf("Saga %s (%s) is stuck: compensation of %s failed: %v", saga.ID, saga.Kind, step.Name, err)
+			return
+		}
+		saga.Steps[i].Status = storage.SagaStepCompensated
+		saga.Steps[i].Error = ""
+		saga.Steps[i].UpdatedAt = now
+	}
+
+	saga.Status = storage.SagaCompensated
+	saga.UpdatedAt = now
+	svc.SaveSaga(ctx, *saga)
+}
+
+func sagaNotFound(id string) error {
+	return &storage.StorageError{Kind: storage.ErrNotFound, Message: fmt.Sprintf("saga %s not found", id)}
+}
+
+// RetrySaga повторяет неудавшиеся откаты зависшей операции
+func (svc *Service) RetrySaga(ctx context.Context, id string, now time.Time) (storage.Saga, error) {
+	saga, ok := svc.GetSaga(ctx, id)
+	if !ok {
+		return storage.Saga{}, sagaNotFound(id)
+	}
+	if saga.Status != storage.SagaStuck {
+		return storage.Saga{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("saga %s is %s, not stuck", id, saga.Status)}
+	}
+	undo, ok := svc.sagas.take(id)
+	if !ok {
+		return storage.Saga{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("compensation of saga %s is not available after restart, resolve it manually", id)}
+	}
+	svc.compensateSaga(ctx, &saga, undo, now)
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "saga.retry",
+		Details:   map[string]string{"saga_id": saga.ID, "status": saga.Status},
+	})
+	return saga, nil
+}
+
+// ResolveSaga закрывает зависшую операцию вручную — например, после исправления остатков бухгалтерией
+func (svc *Service) ResolveSaga(ctx context.Context, id, resolution string, now time.Time) (storage.Saga, error) {
+	resolution = strings.TrimSpace(resolution)
+	if resolution == "" {
+		return storage.Saga{}, invalidInputf("resolution is required")
+	}
+	saga, ok := svc.GetSaga(ctx, id)
+	if !ok {
+		return storage.Saga{}, sagaNotFound(id)
+	}
+	if saga.Status != storage.SagaStuck {
+		return storage.Saga{}, &storage.StorageError{Kind: storage.ErrConflict, Message: fmt.Sprintf("saga %s is %s, not stuck", id, saga.Status)}
+	}
+	svc.sagas.take(id)
+	saga.Status = storage.SagaResolved
+	saga.Resolution = resolution
+	saga.UpdatedAt = now
+	if err := svc.SaveSaga(ctx, saga); err != nil {
+		return storage.Saga{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     "admin",
+		Action:    "saga.resolve",
+		Details:   map[string]string{"saga_id": saga.ID, "resolution": resolution},
+	})
+	return saga, nil
+}
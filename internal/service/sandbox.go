@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var SandboxConfig = struct {
+	Enabled bool // в песочнице админ может заранее загрузить ставки ЦБ с датой вступления в силу
+}{
+	Enabled: os.Getenv("BANKAPP_SANDBOX") == "true",
+}
+
+// effectiveRateOverride ищет последний override нужного вида, вступивший в силу к моменту at
+func (svc *Service) effectiveRateOverride(ctx context.Context, kind, currency string, at time.Time) (decimal.Decimal, bool) {
+	if !SandboxConfig.Enabled {
+		return decimal.Zero, false
+	}
+	var found *storage.RateOverride
+	for _, o := range svc.ListRateOverrides(ctx) {
+		if o.Kind != kind || o.Currency != currency || o.EffectiveFrom.After(at) {
+			continue
+		}
+		o := o
+		found = &o
+	}
+	if found == nil {
+		return decimal.Zero, false
+	}
+	return found.Rate, true
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// Service — бизнес-логика поверх хранилища. Методы Repository доступны напрямую
+// через встраивание, чтобы простые чтения не требовали обёрток.
+type Service struct {
+	storage.Repository
+	events *EventBus
+	fraud  FraudScorer // внешний скоринг; nil — только правила
+	sagas  *sagaRegistry
+
+	rateProviders []RateProvider // источники ключевой ставки в порядке опроса
+
+	connectorsMu sync.RWMutex
+	connectors   map[string]BankConnector // коннекторы к другим банкам по имени
+}
+
+func New(repo storage.Repository, events *EventBus) *Service {
+	svc := &Service{Repository: repo, events: events, sagas: newSagaRegistry(), rateProviders: newRateProviders(RateProviderConfig.Providers),
+		connectors: newBankConnectors(AggregationConfig.Connectors)}
+	if FraudConfig.URL != "" {
+		svc.fraud = NewHTTPFraudScorer(FraudConfig.URL)
+	}
+	return svc
+}
+
+// SetFraudScorer подключает внешний сервис оценки риска вместо заданного в BANKAPP_FRAUD_URL
+func (svc *Service) SetFraudScorer(scorer FraudScorer) {
+	svc.fraud = scorer
+}
+
+// SetRateProviders задаёт источники ключевой ставки вместо перечисленных в BANKAPP_RATE_PROVIDERS
+func (svc *Service) SetRateProviders(providers ...RateProvider) {
+	keyRateMutex.Lock()
+	defer keyRateMutex.Unlock()
+	svc.rateProviders = providers
+	cachedKeyRate.time = time.Time{}
+}
+
+// Events — шина событий для подписчиков транспортного слоя (WebSocket, SSE)
+func (svc *Service) Events() *EventBus {
+	return svc.events
+}
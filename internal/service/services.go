@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const cbrURL = "http://www.cbr.ru/scripts/XML_daily.asp"
+
+type ValCurs struct {
+	XMLName xml.Name `xml:"ValCurs"`
+	Date    string   `xml:"Date,attr"`
+	Valute  []Valute `xml:"Valute"`
+}
+
+type Valute struct {
+	XMLName  xml.Name `xml:"Valute"`
+	ID       string   `xml:"ID,attr"`
+	NumCode  string   `xml:"NumCode"`
+	CharCode string   `xml:"CharCode"`
+	Nominal  int      `xml:"Nominal"`
+	Name     string   `xml:"Name"`
+	Value    string   `xml:"Value"`
+}
+
+var cachedKeyRate struct {
+	rate decimal.Decimal
+	time time.Time
+}
+
+var keyRateMutex sync.Mutex
+
+// GetCBRKeyRate возвращает ключевую ставку в процентах: override песочницы, кеш на час или первый ответивший
+// источник из RateProviderConfig.Providers. Если все источники недоступны, отдаётся прежнее значение из кеша.
+func (svc *Service) GetCBRKeyRate(ctx context.Context) (decimal.Decimal, error) {
+	if rate, ok := svc.effectiveRateOverride(ctx, storage.RateKindKeyRate, "", time.Now()); ok {
+		return rate, nil
+	}
+
+	keyRateMutex.Lock()
+	defer keyRateMutex.Unlock()
+
+	if !cachedKeyRate.rate.IsZero() && time.Since(cachedKeyRate.time) < time.Hour {
+		log.Println("Using cached key rate")
+		return cachedKeyRate.rate, nil
+	}
+
+	rate, date, source, err := svc.fetchKeyRate(ctx)
+	if err != nil {
+		if !cachedKeyRate.rate.IsZero() && ctx.Err() == nil {
+			log.Printf("Warning: %v; using last known key rate %s", err, cachedKeyRate.rate.String())
+			return cachedKeyRate.rate, nil
+		}
+		return decimal.Zero, err
+	}
+	cachedKeyRate.rate = rate
+	cachedKeyRate.time = time.Now()
+	svc.recordRates(ctx, storage.RateKindKeyRate, source, date, map[string]decimal.Decimal{"": rate}, cachedKeyRate.time)
+	return rate, nil
+}
+
+var ExchangeConfig = struct {
+	SpreadPercent decimal.Decimal
+	CacheTTL      time.Duration
+	RetryInterval time.Duration // пока ЦБ недоступен, повторный запрос не чаще этого интервала
+	MaxStale      time.Duration // дольше последние полученные курсы не используются: обмен отвечает 503, автообмен пропускается
+}{
+	SpreadPercent: decimal.NewFromFloat(1.5),
+	CacheTTL:      time.Hour,
+	RetryInterval: time.Minute,
+	MaxStale:      24 * time.Hour,
+}
+
+var cachedFXRates struct {
+	rates   map[string]decimal.Decimal
+	time    time.Time // когда курсы получены от ЦБ
+	retried time.Time // последняя неудачная попытка обновить
+}
+
+var fxRatesMutex sync.Mutex
+
+// GetCBRExchangeRate возвращает курс валюты в рублях за единицу (RUB = 1). Если ЦБ недоступен, отдаются последние
+// полученные курсы, пока им не больше ExchangeConfig.MaxStale; придуманных курсов нет — иначе ошибка.
+func (svc *Service) GetCBRExchangeRate(ctx context.Context, currency string) (decimal.Decimal, error) {
+	if currency == storage.BaseCurrency {
+		return decimal.NewFromInt(1), nil
+	}
+	if rate, ok := svc.effectiveRateOverride(ctx, storage.RateKindFX, currency, time.Now()); ok {
+		return rate, nil
+	}
+
+	fxRatesMutex.Lock()
+	defer fxRatesMutex.Unlock()
+
+	if time.Since(cachedFXRates.time) >= ExchangeConfig.CacheTTL && time.Since(cachedFXRates.retried) >= ExchangeConfig.RetryInterval {
+		rates, date, err := fetchCBRDailyRates(ctx)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return decimal.Zero, ctx.Err()
+		case err != nil:
+			cachedFXRates.retried = time.Now()
+			log.Printf("Warning: failed to fetch CBR daily rates: %v", err)
+		default:
+			cachedFXRates.rates = rates
+			cachedFXRates.time = time.Now()
+			svc.recordRates(ctx, storage.RateKindFX, RateProviderCBR, date, rates, cachedFXRates.time)
+		}
+	}
+
+	if cachedFXRates.rates == nil || time.Since(cachedFXRates.time) >= ExchangeConfig.MaxStale {
+		return decimal.Zero, fmt.Errorf("CBR exchange rates are unavailable")
+	}
+	rate, ok := cachedFXRates.rates[currency]
+	if !ok {
+		return decimal.Zero, fmt.Errorf("no exchange rate for currency %s", currency)
+	}
+	return rate, nil
+}
+
+// fetchCBRDailyRates возвращает курсы в рублях за единицу валюты и дату (YYYY-MM-DD), на которую их установил ЦБ
+func fetchCBRDailyRates(ctx context.Context) (map[string]decimal.Decimal, string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cbrURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request to CBR failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("CBR responded with status %d", resp.StatusCode)
+	}
+
+	var curs ValCurs
+	decoder := xml.NewDecoder(resp.Body)
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&curs); err != nil {
+		return nil, "", fmt.Errorf("failed to decode CBR response: %w", err)
+	}
+	date := time.Now().Format("2006-01-02")
+	if parsed, err := time.Parse("02.01.2006", curs.Date); err == nil {
+		date = parsed.Format("2006-01-02")
+	}
+
+	rates := make(map[string]decimal.Decimal, len(curs.Valute))
+	for _, v := range curs.Valute {
+		value, err := decimal.NewFromString(strings.Replace(v.Value, ",", ".", 1))
+		if err != nil || v.Nominal <= 0 {
+			continue
+		}
+		rates[v.CharCode] = value.Div(decimal.NewFromInt(int64(v.Nominal)))
+	}
+	return rates, date, nil
+}
+
+// ЦБ отдаёт XML в windows-1251; числовые поля ASCII, кириллица перекодируется по таблице
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(charset, "windows-1251") {
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+	raw, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, c := range raw {
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c >= 0xC0:
+			b.WriteRune(rune(0x0410 + int(c) - 0xC0))
+		case c == 0xA8:
+			b.WriteRune('Ё')
+		case c == 0xB8:
+			b.WriteRune('ё')
+		default:
+			b.WriteRune('?')
+		}
+	}
+	return strings.NewReader(b.String()), nil
+}
+
+// QuoteExchange считает сумму зачисления с учётом спреда банка; rate — сколько единиц toCurrency за единицу fromCurrency
+func (svc *Service) QuoteExchange(ctx context.Context, fromCurrency, toCurrency string, amount decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	fromRate, err := svc.GetCBRExchangeRate(ctx, fromCurrency)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	toRate, err := svc.GetCBRExchangeRate(ctx, toCurrency)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+
+	spread := decimal.NewFromInt(1).Sub(ExchangeConfig.SpreadPercent.Div(decimal.NewFromInt(100)))
+	rate := fromRate.Div(toRate).Mul(spread).Round(6)
+	return rate, amount.Mul(rate).RoundBank(storage.CurrencyScale(toCurrency)), nil
+}
@@ -0,0 +1,485 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+// BuildStatement восстанавливает остатки на границах периода от текущего баланса назад по журналу.
+// Если период уходит в архив, недостающие проводки с даты from поднимаются из архива.
+func (svc *Service) BuildStatement(ctx context.Context, account storage.Account, from, to time.Time) storage.Statement {
+	txs := append(svc.GetArchivedTransactions(ctx, account.ID, from), svc.GetAccountTransactions(ctx, account.ID)...)
+	sort.Slice(txs, func(i, j int) bool { return txs[i].EffectiveDate().Before(txs[j].EffectiveDate()) })
+
+	st := storage.Statement{
+		Account:      account,
+		From:         from,
+		To:           to,
+		TotalCredits: decimal.Zero,
+		TotalDebits:  decimal.Zero,
+		Transactions: []storage.Transaction{},
+	}
+
+	closing := account.Balance
+	for _, tx := range txs {
+		delta := signedAmount(tx, account.ID)
+		switch {
+		case tx.EffectiveDate().After(to):
+			closing = closing.Sub(delta)
+		case !tx.EffectiveDate().Before(from):
+			st.Transactions = append(st.Transactions, tx)
+			if delta.IsPositive() {
+				st.TotalCredits = st.TotalCredits.Add(delta)
+			} else {
+				st.TotalDebits = st.TotalDebits.Add(delta.Neg())
+			}
+		}
+	}
+	storage.LocalizeTransactions(st.Transactions, svc.AccountLanguage(ctx, account.ID))
+	st.ClosingBalance = closing
+	st.OpeningBalance = closing.Sub(st.TotalCredits).Add(st.TotalDebits)
+	return st
+}
+
+func signedAmount(tx storage.Transaction, accountID string) decimal.Decimal {
+	if tx.ToAccountID == accountID {
+		return tx.Amount
+	}
+	return tx.Amount.Neg()
+}
+
+func ParseStatementPeriod(fromParam, toParam string, now time.Time) (time.Time, time.Time, error) {
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+	if fromParam != "" {
+		parsed, err := time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+		from = parsed
+	}
+	if toParam != "" {
+		parsed, err := time.Parse("2006-01-02", toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		to = parsed.Add(24*time.Hour - time.Nanosecond)
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("period end is before period start")
+	}
+	return from, to, nil
+}
+
+func FormatStatementCSV(st storage.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"id", "timestamp", "type", "direction", "amount", "counterparty_account_id", "description", "value_date", "booking_date"})
+	for _, tx := range st.Transactions {
+		direction, counterparty := "credit", tx.FromAccountID
+		if tx.FromAccountID == st.Account.ID {
+			direction, counterparty = "debit", tx.ToAccountID
+		}
+		writer.Write([]string{
+			tx.ID,
+			tx.Timestamp.Format(time.RFC3339),
+			tx.TransactionType,
+			direction,
+			tx.Amount.StringFixed(2),
+			counterparty,
+			tx.Description,
+			tx.EffectiveDate().Format("2006-01-02"),
+			tx.BookedAt().Format("2006-01-02"),
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Format1C формирует выписку в формате обмена 1CClientBankExchange (версия 1.03) в кодировке windows-1251
+func (svc *Service) Format1C(ctx context.Context, st storage.Statement, now time.Time) []byte {
+	const dateLayout = "02.01.2006"
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString(fmt.Sprintf(format, args...))
+		b.WriteString("\r\n")
+	}
+
+	line("1CClientBankExchange")
+	line("ВерсияФормата=1.03")
+	line("Кодировка=Windows")
+	line("Отправитель=Simple Bank")
+	line("Получатель=Бухгалтерия")
+	line("ДатаСоздания=%s", now.Format(dateLayout))
+	line("ВремяСоздания=%s", now.Format("15:04:05"))
+	line("ДатаНачала=%s", st.From.Format(dateLayout))
+	line("ДатаКонца=%s", st.To.Format(dateLayout))
+	line("РасчСчет=%s", st.Account.Number)
+
+	line("СекцияРасчСчет")
+	line("ДатаНачала=%s", st.From.Format(dateLayout))
+	line("ДатаКонца=%s", st.To.Format(dateLayout))
+	line("РасчСчет=%s", st.Account.Number)
+	line("НачальныйОстаток=%s", st.OpeningBalance.StringFixed(2))
+	line("ВсегоПоступило=%s", st.TotalCredits.StringFixed(2))
+	line("ВсегоСписано=%s", st.TotalDebits.StringFixed(2))
+	line("КонечныйОстаток=%s", st.ClosingBalance.StringFixed(2))
+	line("КонецРасчСчет")
+
+	for i, tx := range st.Transactions {
+		payer, payee := svc.counterpartyNumber(ctx, tx.FromAccountID), svc.counterpartyNumber(ctx, tx.ToAccountID)
+		line("СекцияДокумент=Платежное поручение")
+		line("Номер=%d", i+1)
+		line("Дата=%s", tx.EffectiveDate().Format(dateLayout))
+		line("Сумма=%s", tx.Amount.StringFixed(2))
+		line("ПлательщикСчет=%s", payer)
+		line("ПолучательСчет=%s", payee)
+		if tx.FromAccountID == st.Account.ID {
+			line("ДатаСписано=%s", tx.EffectiveDate().Format(dateLayout))
+		} else {
+			line("ДатаПоступило=%s", tx.EffectiveDate().Format(dateLayout))
+		}
+		line("ВидОплаты=01")
+		line("НазначениеПлатежа=%s", strings.ReplaceAll(tx.Description, "\n", " "))
+		line("КонецДокумента")
+	}
+	line("КонецФайла")
+
+	return encodeWindows1251(b.String())
+}
+
+func (svc *Service) counterpartyNumber(ctx context.Context, accountID string) string {
+	if accountID == "" {
+		return ""
+	}
+	if acc, ok := svc.GetAccount(ctx, accountID); ok {
+		return acc.Number
+	}
+	return ""
+}
+
+// Обратное преобразование к charsetReader: кириллица в windows-1251, прочие не-ASCII символы заменяются на '?'
+func encodeWindows1251(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			out = append(out, byte(r))
+		case r >= 0x0410 && r <= 0x044F:
+			out = append(out, byte(r-0x0410+0xC0))
+		case r == 'Ё':
+			out = append(out, 0xA8)
+		case r == 'ё':
+			out = append(out, 0xB8)
+		case r == '№':
+			out = append(out, 0xB9)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// Подмножество ISO 20022 camt.053.001.02 (BankToCustomerStatement)
+type camt053Document struct {
+	XMLName xml.Name `xml:"urn:iso:std:iso:20022:tech:xsd:camt.053.001.02 Document"`
+	Stmt    struct {
+		GrpHdr struct {
+			MsgID   string `xml:"MsgId"`
+			CreDtTm string `xml:"CreDtTm"`
+		} `xml:"GrpHdr"`
+		Stmt camt053Statement `xml:"Stmt"`
+	} `xml:"BkToCstmrStmt"`
+}
+
+type camt053Statement struct {
+	ID      string `xml:"Id"`
+	CreDtTm string `xml:"CreDtTm"`
+	FrToDt  struct {
+		FrDtTm string `xml:"FrDtTm"`
+		ToDtTm string `xml:"ToDtTm"`
+	} `xml:"FrToDt"`
+	Acct struct {
+		ID  camtAccountID `xml:"Id"`
+		Ccy string        `xml:"Ccy"`
+	} `xml:"Acct"`
+	Bal       []camtBalance `xml:"Bal"`
+	TxsSummry struct {
+		TtlNtries    camtEntriesTotal `xml:"TtlNtries"`
+		TtlCdtNtries camtEntriesTotal `xml:"TtlCdtNtries"`
+		TtlDbtNtries camtEntriesTotal `xml:"TtlDbtNtries"`
+	} `xml:"TxsSummry"`
+	Ntry []camtEntry `xml:"Ntry"`
+}
+
+type camtAccountID struct {
+	Othr struct {
+		ID string `xml:"Id"`
+	} `xml:"Othr"`
+}
+
+type camtAccount struct {
+	ID camtAccountID `xml:"Id"`
+}
+
+type camtRelatedParties struct {
+	DbtrAcct *camtAccount `xml:"DbtrAcct,omitempty"`
+	CdtrAcct *camtAccount `xml:"CdtrAcct,omitempty"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Tp struct {
+		CdOrPrtry struct {
+			Cd string `xml:"Cd"`
+		} `xml:"CdOrPrtry"`
+	} `xml:"Tp"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Dt        struct {
+		Dt string `xml:"Dt"`
+	} `xml:"Dt"`
+}
+
+type camtEntriesTotal struct {
+	NbOfNtries int    `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camtEntry struct {
+	NtryRef   string     `xml:"NtryRef"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Sts       string     `xml:"Sts"`
+	BookgDt   struct {
+		DtTm string `xml:"DtTm"`
+	} `xml:"BookgDt"`
+	ValDt struct {
+		Dt string `xml:"Dt"`
+	} `xml:"ValDt"`
+	AcctSvcrRef string `xml:"AcctSvcrRef"`
+	BkTxCd      struct {
+		Prtry struct {
+			Cd string `xml:"Cd"`
+		} `xml:"Prtry"`
+	} `xml:"BkTxCd"`
+	NtryDtls struct {
+		TxDtls struct {
+			Refs struct {
+				TxID string `xml:"TxId"`
+			} `xml:"Refs"`
+			RltdPties *camtRelatedParties `xml:"RltdPties,omitempty"`
+			RmtInf    struct {
+				Ustrd string `xml:"Ustrd"`
+			} `xml:"RmtInf"`
+		} `xml:"TxDtls"`
+	} `xml:"NtryDtls"`
+}
+
+func creditDebit(amount decimal.Decimal) string {
+	if amount.IsNegative() {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+// FormatCAMT053 формирует выписку ISO 20022 camt.053 по уже посчитанной выписке периода
+func (svc *Service) FormatCAMT053(ctx context.Context, st storage.Statement, now time.Time) ([]byte, error) {
+	const dateLayout = "2006-01-02"
+	ccy := st.Account.Currency
+	stmtID := fmt.Sprintf("%s-%s-%s", st.Account.Number, st.From.Format("20060102"), st.To.Format("20060102"))
+
+	var doc camt053Document
+	doc.Stmt.GrpHdr.MsgID = stmtID
+	doc.Stmt.GrpHdr.CreDtTm = now.Format(time.RFC3339)
+
+	s := &doc.Stmt.Stmt
+	s.ID = stmtID
+	s.CreDtTm = now.Format(time.RFC3339)
+	s.FrToDt.FrDtTm = st.From.Format(time.RFC3339)
+	s.FrToDt.ToDtTm = st.To.Format(time.RFC3339)
+	s.Acct.ID.Othr.ID = st.Account.Number
+	s.Acct.Ccy = ccy
+
+	balance := func(code string, amount decimal.Decimal, at time.Time) camtBalance {
+		var b camtBalance
+		b.Tp.CdOrPrtry.Cd = code
+		b.Amt = camtAmount{Ccy: ccy, Value: amount.Abs().StringFixed(2)}
+		b.CdtDbtInd = creditDebit(amount)
+		b.Dt.Dt = at.Format(dateLayout)
+		return b
+	}
+	s.Bal = []camtBalance{
+		balance("OPBD", st.OpeningBalance, st.From),
+		balance("CLBD", st.ClosingBalance, st.To),
+	}
+
+	credits, debits := 0, 0
+	for _, tx := range st.Transactions {
+		delta := signedAmount(tx, st.Account.ID)
+		if delta.IsPositive() {
+			credits++
+		} else {
+			debits++
+		}
+
+		var e camtEntry
+		e.NtryRef = tx.ID
+		e.Amt = camtAmount{Ccy: ccy, Value: tx.Amount.StringFixed(2)}
+		e.CdtDbtInd = creditDebit(delta)
+		e.Sts = "BOOK"
+		e.BookgDt.DtTm = tx.BookedAt().Format(time.RFC3339)
+		e.ValDt.Dt = tx.EffectiveDate().Format(dateLayout)
+		e.AcctSvcrRef = fmt.Sprintf("%d", tx.Sequence)
+		e.BkTxCd.Prtry.Cd = tx.TransactionType
+		e.NtryDtls.TxDtls.Refs.TxID = tx.ID
+		e.NtryDtls.TxDtls.RmtInf.Ustrd = tx.Description
+
+		payer, payee := svc.counterpartyNumber(ctx, tx.FromAccountID), svc.counterpartyNumber(ctx, tx.ToAccountID)
+		if payer != "" || payee != "" {
+			parties := &camtRelatedParties{}
+			if payer != "" {
+				parties.DbtrAcct = &camtAccount{}
+				parties.DbtrAcct.ID.Othr.ID = payer
+			}
+			if payee != "" {
+				parties.CdtrAcct = &camtAccount{}
+				parties.CdtrAcct.ID.Othr.ID = payee
+			}
+			e.NtryDtls.TxDtls.RltdPties = parties
+		}
+		s.Ntry = append(s.Ntry, e)
+	}
+	s.TxsSummry.TtlNtries = camtEntriesTotal{NbOfNtries: len(st.Transactions), Sum: st.TotalCredits.Add(st.TotalDebits).StringFixed(2)}
+	s.TxsSummry.TtlCdtNtries = camtEntriesTotal{NbOfNtries: credits, Sum: st.TotalCredits.StringFixed(2)}
+	s.TxsSummry.TtlDbtNtries = camtEntriesTotal{NbOfNtries: debits, Sum: st.TotalDebits.StringFixed(2)}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// FormatMT940 формирует выписку SWIFT MT940 (блок 4). Текст приводится к набору символов SWIFT X:
+// кириллица транслитерируется, поле :86: режется на строки по 65 символов (не больше 6 строк).
+func (svc *Service) FormatMT940(ctx context.Context, st storage.Statement) []byte {
+	const dateLayout = "060102"
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString(fmt.Sprintf(format, args...))
+		b.WriteString("\r\n")
+	}
+	mtAmount := func(amount decimal.Decimal) string {
+		return strings.Replace(amount.Abs().StringFixed(2), ".", ",", 1)
+	}
+	mark := func(amount decimal.Decimal) string {
+		if amount.IsNegative() {
+			return "D"
+		}
+		return "C"
+	}
+	ccy := st.Account.Currency
+
+	line(":20:STMT%s", st.To.Format("20060102"))
+	line(":25:%s", st.Account.Number)
+	line(":28C:%05d/1", st.To.YearDay())
+	line(":60F:%s%s%s%s", mark(st.OpeningBalance), st.From.Format(dateLayout), ccy, mtAmount(st.OpeningBalance))
+	for _, tx := range st.Transactions {
+		delta := signedAmount(tx, st.Account.ID)
+		line(":61:%s%s%s%sNTRF%s//%d", tx.EffectiveDate().Format(dateLayout), tx.BookedAt().Format("0102"), mark(delta),
+			mtAmount(delta), truncateRunes(strings.ReplaceAll(tx.ID, "-", ""), 16), tx.Sequence)
+
+		details := swiftText(tx.Description)
+		if counterparty := svc.counterpartyNumber(ctx, counterpartyID(tx, st.Account.ID)); counterparty != "" {
+			details += " / " + counterparty
+		}
+		for i, chunk := range chunkRunes(details, 65, 6) {
+			if i == 0 {
+				line(":86:%s", chunk)
+			} else {
+				line("%s", chunk)
+			}
+		}
+	}
+	line(":62F:%s%s%s%s", mark(st.ClosingBalance), st.To.Format(dateLayout), ccy, mtAmount(st.ClosingBalance))
+	line("-")
+	return []byte(b.String())
+}
+
+func counterpartyID(tx storage.Transaction, accountID string) string {
+	if tx.FromAccountID == accountID {
+		return tx.ToAccountID
+	}
+	return tx.FromAccountID
+}
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "iu", 'я': "ia",
+}
+
+// swiftText оставляет только символы набора SWIFT X: латиница, цифры и / - ? : ( ) . , ' + пробел
+func swiftText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		if latin, ok := cyrillicToLatin[lower]; ok {
+			if r != lower && latin != "" {
+				latin = strings.ToUpper(latin[:1]) + latin[1:]
+			}
+			b.WriteString(latin)
+			continue
+		}
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			b.WriteRune(r)
+		case r == '>':
+			// стрелка "->" в описаниях обмена
+		default:
+			b.WriteRune('.')
+		}
+	}
+	return b.String()
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+func chunkRunes(s string, size, maxChunks int) []string {
+	r := []rune(s)
+	var chunks []string
+	for len(r) > 0 && len(chunks) < maxChunks {
+		n := size
+		if len(r) < n {
+			n = len(r)
+		}
+		chunks = append(chunks, string(r[:n]))
+		r = r[n:]
+	}
+	return chunks
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+var DevConfig = struct {
+	Enabled         bool // включает POST /dev/seed; на боевом стенде выключено
+	MaxUsers        int  // ограничения одного запроса на генерацию, чтобы он укладывался в таймауты HTTP
+	MaxTransactions int
+}{
+	Enabled:         os.Getenv("BANKAPP_DEV_MODE") == "true",
+	MaxUsers:        10000,
+	MaxTransactions: 1000000,
+}
+
+// StressConfig — параметры генератора нагрузочных данных (подкоманда generate и POST /dev/seed)
+type StressConfig struct {
+	Users        int
+	Cards        int // карт на счёт; покупки проводятся по одной из карт счёта
+	Transactions int
+	Days         int   // глубина истории от текущего момента
+	Seed         int64 // одинаковый seed даёт одинаковые суммы, контрагентов и время операций
+	BatchSize    int   // столько проводок записывается под одной блокировкой хранилища
+}
+
+type StressReport struct {
+	Users        int           `json:"users"`
+	Accounts     int           `json:"accounts"`
+	Cards        int           `json:"cards"`
+	Transactions int           `json:"transactions"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	Elapsed      time.Duration `json:"elapsed"`
+}
+
+// Суммы покупок распределены логнормально: Median — медиана чека в рублях, Sigma — разброс
+type stressMerchant struct {
+	Name     string
+	Category string
+	Median   float64
+	Sigma    float64
+	Weight   int
+}
+
+var stressMerchants = []stressMerchant{
+	{"Pyaterochka", "groceries", 650, 0.7, 180},
+	{"Magnit", "groceries", 550, 0.7, 150},
+	{"Perekrestok", "groceries", 1200, 0.6, 90},
+	{"VkusVill", "groceries", 900, 0.5, 70},
+	{"Coffee Like", "cafe", 250, 0.3, 110},
+	{"Shokoladnitsa", "cafe", 900, 0.5, 40},
+	{"Yandex Taxi", "transport", 450, 0.6, 90},
+	{"Moscow Metro", "transport", 62, 0.1, 140},
+	{"Lukoil", "fuel", 2500, 0.4, 45},
+	{"Ozon", "marketplace", 1800, 1.0, 80},
+	{"Wildberries", "marketplace", 1500, 1.0, 90},
+	{"DNS", "electronics", 7000, 1.1, 12},
+	{"Apteka Rigla", "pharmacy", 700, 0.8, 35},
+	{"MTS", "telecom", 600, 0.3, 15},
+	{"Mosenergosbyt", "utilities", 3500, 0.4, 8},
+	{"Kinopoisk", "subscriptions", 299, 0.05, 10},
+	{"Sportmaster", "clothing", 4500, 0.8, 10},
+	{"Aeroflot", "travel", 18000, 0.7, 2},
+}
+
+// Относительная интенсивность операций по часам суток: ночью почти нет, пики в обед и вечером
+var stressHourWeights = [24]int{1, 1, 1, 1, 1, 2, 4, 8, 12, 12, 11, 12, 15, 15, 12, 11, 12, 15, 18, 18, 14, 10, 6, 3}
+
+const (
+	stressSalaryMedian     = 65000
+	stressTransferMedian   = 2500
+	stressWithdrawalMedian = 5000
+	stressPasswordPlain    = "stress-password"
+)
+
+// GenerateStressData создаёт пользователей со счетами и записывает в хранилище cfg.Transactions проводок
+// за последние cfg.Days дней: покупки, переводы между клиентами, снятия наличных и зарплаты. Остатки
+// не уходят в минус: если денег на покупку не хватает, вместо неё приходит зарплата.
+func (svc *Service) GenerateStressData(ctx context.Context, cfg StressConfig, now time.Time) (StressReport, error) {
+	started := time.Now()
+	if cfg.Users < 2 || cfg.Transactions < 1 || cfg.Days < 1 {
+		return StressReport{}, fmt.Errorf("need at least 2 users, 1 transaction and 1 day")
+	}
+	if cfg.Cards < 0 {
+		return StressReport{}, fmt.Errorf("cards per account cannot be negative")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10000
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	report := StressReport{From: now.AddDate(0, 0, -cfg.Days), To: now}
+
+	accounts, cards, err := svc.createStressAccounts(ctx, cfg, report.From, rng)
+	if err != nil {
+		return StressReport{}, err
+	}
+	report.Users = len(accounts)
+	report.Accounts = len(accounts)
+	report.Cards = len(accounts) * cfg.Cards
+
+	balances := make([]int64, len(accounts)) // в копейках
+	activity := rand.NewZipf(rng, 1.2, 8, uint64(len(accounts)-1))
+	merchantPicker := newWeightedPicker(len(stressMerchants), func(i int) int { return stressMerchants[i].Weight })
+
+	batch := make([]storage.Transaction, 0, cfg.BatchSize)
+	for i, ts := range stressTimestamps(rng, cfg.Transactions, report.From, cfg.Days) {
+		payer := int(activity.Uint64())
+		acc := accounts[payer]
+		payee := -1
+		tx := storage.Transaction{ID: storage.GenerateID(), Timestamp: ts}
+
+		roll := rng.Intn(100)
+		switch {
+		case roll < 72:
+			m := stressMerchants[merchantPicker.pick(rng)]
+			tx.TransactionType = "payment"
+			tx.FromAccountID = acc.ID
+			tx.Amount = stressAmount(rng, m.Median, m.Sigma, 0.01)
+			tx.Merchant = m.Name
+			tx.Category = m.Category
+			if len(cards[payer]) > 0 {
+				tx.CardID = cards[payer][rng.Intn(len(cards[payer]))]
+			}
+			tx.Describe(storage.DescCardPayment, map[string]string{"merchant": m.Name})
+		case roll < 84:
+			payee = (payer + 1 + rng.Intn(len(accounts)-1)) % len(accounts)
+			tx.TransactionType = "transfer"
+			tx.FromAccountID = acc.ID
+			tx.ToAccountID = accounts[payee].ID
+			tx.Amount = stressAmount(rng, stressTransferMedian, 1.0, 0.01)
+			tx.Describe(storage.DescTransfer, map[string]string{"from": acc.Number, "to": accounts[payee].Number})
+		case roll < 90:
+			tx.TransactionType = "withdrawal"
+			tx.FromAccountID = acc.ID
+			tx.Amount = stressAmount(rng, stressWithdrawalMedian, 0.6, 100)
+			tx.Description = "ATM cash withdrawal"
+		}
+		if tx.FromAccountID != "" && balances[payer] < tx.Amount.Shift(2).IntPart() {
+			tx, payee = storage.Transaction{ID: tx.ID, Timestamp: ts}, -1
+		}
+		if tx.TransactionType == "" {
+			tx.TransactionType = "deposit"
+			tx.ToAccountID = acc.ID
+			payee = payer
+			tx.Amount = stressAmount(rng, stressSalaryMedian, 0.5, 100)
+			tx.Describe(storage.DescDeposit, map[string]string{"account": acc.Number})
+		}
+
+		cents := tx.Amount.Shift(2).IntPart()
+		if tx.FromAccountID != "" {
+			balances[payer] -= cents
+		}
+		if payee >= 0 {
+			balances[payee] += cents
+		}
+
+		batch = append(batch, tx)
+		if len(batch) == cfg.BatchSize || i == cfg.Transactions-1 {
+			if err := svc.LoadTransactions(ctx, batch); err != nil {
+				return StressReport{}, err
+			}
+			report.Transactions += len(batch)
+			batch = batch[:0]
+			if report.Transactions%(cfg.BatchSize*10) == 0 {
+				log.Printf("Stress data: %d/%d transactions", report.Transactions, cfg.Transactions)
+			}
+		}
+	}
+
+	report.Elapsed = time.Since(started)
+	return report, nil
+}
+
+// SeedDevData заполняет хранилище тестовыми данными по запросу POST /dev/seed. Логины получают префикс
+// stress<seed>, поэтому повторный запуск с тем же seed упрётся в занятые логины — seed 0 выбирается случайно.
+func (svc *Service) SeedDevData(ctx context.Context, req storage.SeedRequest, now time.Time) (StressReport, error) {
+	if !DevConfig.Enabled {
+		return StressReport{}, &storage.StorageError{Kind: storage.ErrForbidden, Message: "seeding is available only in dev mode"}
+	}
+	cfg := StressConfig{Users: req.Users, Cards: req.Cards, Transactions: req.Transactions, Days: req.Days, Seed: req.Seed}
+	if cfg.Users == 0 {
+		cfg.Users = 100
+	}
+	if cfg.Cards == 0 {
+		cfg.Cards = 1
+	}
+	if cfg.Transactions == 0 {
+		cfg.Transactions = 10000
+	}
+	if cfg.Days == 0 {
+		cfg.Days = 90
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = now.UnixNano()
+	}
+	switch {
+	case cfg.Users < 2 || cfg.Users > DevConfig.MaxUsers:
+		return StressReport{}, invalidInputf("users must be between 2 and %d", DevConfig.MaxUsers)
+	case cfg.Transactions < 1 || cfg.Transactions > DevConfig.MaxTransactions:
+		return StressReport{}, invalidInputf("transactions must be between 1 and %d", DevConfig.MaxTransactions)
+	case cfg.Cards < 0:
+		return StressReport{}, invalidInputf("cards_per_account cannot be negative")
+	case cfg.Days < 1:
+		return StressReport{}, invalidInputf("days must be positive")
+	}
+
+	report, err := svc.GenerateStressData(ctx, cfg, now)
+	if err != nil {
+		return StressReport{}, err
+	}
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: time.Now(),
+		Actor:     "admin",
+		Action:    "dev.seed",
+		Details: map[string]string{
+			"seed":         strconv.FormatInt(cfg.Seed, 10),
+			"users":        strconv.Itoa(report.Users),
+			"cards":        strconv.Itoa(report.Cards),
+			"transactions": strconv.Itoa(report.Transactions),
+		},
+	})
+	return report, nil
+}
+
+// createStressAccounts создаёт пользователей с одним счётом и cfg.Cards картами каждый; cards[i] — ID карт accounts[i]
+func (svc *Service) createStressAccounts(ctx context.Context, cfg StressConfig, openedAt time.Time, rng *rand.Rand) (accounts []storage.Account, cards [][]string, err error) {
+	product, ok := storage.GetProduct(storage.DefaultProductCode)
+	if !ok {
+		return nil, nil, fmt.Errorf("default product %s not found", storage.DefaultProductCode)
+	}
+	passwordHash, err := HashPassword(stressPasswordPlain)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := fmt.Sprintf("stress%d", cfg.Seed)
+
+	accounts = make([]storage.Account, 0, cfg.Users)
+	cards = make([][]string, 0, cfg.Users)
+	for i := 0; i < cfg.Users; i++ {
+		user := storage.User{
+			ID:            storage.GenerateID(),
+			Username:      fmt.Sprintf("%s_%06d", prefix, i),
+			Email:         fmt.Sprintf("%s_%06d@example.com", prefix, i),
+			PasswordHash:  passwordHash,
+			CreatedAt:     openedAt,
+			EmailVerified: true,
+			Language:      storage.DefaultLanguage,
+			KYCStatus:     storage.KYCNone,
+		}
+		if err := svc.AddUser(ctx, user); err != nil {
+			return nil, nil, err
+		}
+		account := storage.Account{
+			ID:        storage.GenerateID(),
+			UserID:    user.ID,
+			Number:    fmt.Sprintf("40817810%012d", rng.Int63n(1e12)),
+			Balance:   decimal.Zero,
+			CreatedAt: openedAt,
+
+			ProductCode:        product.Code,
+			Currency:           product.Currencies[0],
+			InterestRate:       product.InterestRate,
+			MonthlyFee:         product.MonthlyFee,
+			DailyTransferLimit: product.DailyTransferLimit,
+			AccruedInterest:    decimal.Zero,
+
+			Status: storage.AccountStatusActive,
+		}
+		if err := svc.AddAccount(ctx, account); err != nil {
+			return nil, nil, err
+		}
+		accountCards := make([]string, 0, cfg.Cards)
+		for j := 0; j < cfg.Cards; j++ {
+			card := storage.NewCard(account.ID)
+			card.CreatedAt = openedAt
+			if err := svc.AddCard(ctx, card); err != nil {
+				return nil, nil, err
+			}
+			accountCards = append(accountCards, card.ID)
+		}
+		accounts = append(accounts, account)
+		cards = append(cards, accountCards)
+	}
+	return accounts, cards, nil
+}
+
+// stressTimestamps распределяет n операций по дням (в выходные на 20% больше) и часам суток, по возрастанию
+func stressTimestamps(rng *rand.Rand, n int, from time.Time, days int) []time.Time {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	dayPicker := newWeightedPicker(days, func(i int) int {
+		if wd := start.AddDate(0, 0, i).Weekday(); wd == time.Saturday || wd == time.Sunday {
+			return 12
+		}
+		return 10
+	})
+	hourPicker := newWeightedPicker(24, func(i int) int { return stressHourWeights[i] })
+
+	stamps := make([]time.Time, n)
+	for i := range stamps {
+		offset := time.Duration(hourPicker.pick(rng))*time.Hour + time.Duration(rng.Int63n(int64(time.Hour)))
+		stamps[i] = start.AddDate(0, 0, dayPicker.pick(rng)).Add(offset).Truncate(time.Second)
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+	return stamps
+}
+
+// stressAmount — логнормальная сумма с медианой median, округлённая вверх до кратного step (и не меньше step)
+func stressAmount(rng *rand.Rand, median, sigma, step float64) decimal.Decimal {
+	value := median * math.Exp(sigma*rng.NormFloat64())
+	return decimal.NewFromFloat(math.Max(step, math.Ceil(value/step)*step)).Round(2)
+}
+
+// weightedPicker выбирает индекс пропорционально весу двоичным поиском по накопленным суммам
+type weightedPicker struct {
+	cumulative []int
+}
+
+func newWeightedPicker(n int, weight func(i int) int) weightedPicker {
+	p := weightedPicker{cumulative: make([]int, n)}
+	total := 0
+	for i := 0; i < n; i++ {
+		total += weight(i)
+		p.cumulative[i] = total
+	}
+	return p
+}
+
+func (p weightedPicker) pick(rng *rand.Rand) int {
+	x := rng.Intn(p.cumulative[len(p.cumulative)-1])
+	return sort.SearchInts(p.cumulative, x+1)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const MaxImportedTransactions = 10000
+
+// csvColumns — номера колонок выписки по названиям из заголовка; -1 — колонка не задана в описании
+type csvColumns struct {
+	date, amount, debit, credit, currency, description, counterparty, category, externalRef int
+}
+
+func resolveCSVColumns(header []string, m storage.CSVImportMapping) (csvColumns, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+	var missing []string
+	column := func(name string, required bool) int {
+		if name == "" {
+			if required {
+				missing = append(missing, "<empty>")
+			}
+			return -1
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			missing = append(missing, name)
+			return -1
+		}
+		return i
+	}
+	cols := csvColumns{
+		date:         column(m.Date, true),
+		amount:       column(m.Amount, false),
+		debit:        column(m.Debit, false),
+		credit:       column(m.Credit, false),
+		currency:     column(m.Currency, false),
+		description:  column(m.Description, false),
+		counterparty: column(m.Counterparty, false),
+		category:     column(m.Category, false),
+		externalRef:  column(m.ExternalRef, true),
+	}
+	if len(missing) > 0 {
+		return csvColumns{}, invalidInputf("columns not found in CSV header: %s", strings.Join(missing, ", "))
+	}
+	if (m.Amount == "") == (m.Debit == "" && m.Credit == "") {
+		return csvColumns{}, invalidInputf("mapping needs either amount or debit/credit columns")
+	}
+	return cols, nil
+}
+
+// parseStatementAmount понимает суммы в записи разных банков: «1 234,56», «-1234.56», «1,234.56»
+func parseStatementAmount(raw string) (decimal.Decimal, error) {
+	value := strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(strings.TrimSpace(raw))
+	if strings.Contains(value, ",") {
+		if strings.Contains(value, ".") {
+			value = strings.ReplaceAll(value, ",", "")
+		} else {
+			value = strings.ReplaceAll(value, ",", ".")
+		}
+	}
+	return decimal.NewFromString(value)
+}
+
+// importedRow разбирает строку выписки в операцию по счёту; знак суммы задаёт направление
+func importedRow(record []string, cols csvColumns, dateFormat string, account storage.Account, now time.Time) (storage.Transaction, error) {
+	cell := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	tx := storage.Transaction{
+		ExternalRef:     cell(cols.externalRef),
+		TransactionType: "imported",
+		Description:     cell(cols.description),
+		Merchant:        cell(cols.counterparty),
+		Category:        strings.ToLower(cell(cols.category)),
+	}
+	if tx.ExternalRef == "" {
+		return tx, fmt.Errorf("external reference is empty")
+	}
+	date, err := time.Parse(dateFormat, cell(cols.date))
+	if err != nil {
+		return tx, fmt.Errorf("date %q does not match format %s", cell(cols.date), dateFormat)
+	}
+	if date.After(now) {
+		return tx, fmt.Errorf("date %s is in the future", cell(cols.date))
+	}
+	if currency := strings.ToUpper(cell(cols.currency)); currency != "" && currency != account.Currency {
+		return tx, fmt.Errorf("currency %s differs from account currency %s", currency, account.Currency)
+	}
+
+	var amount decimal.Decimal
+	if cols.amount >= 0 {
+		if amount, err = parseStatementAmount(cell(cols.amount)); err != nil {
+			return tx, fmt.Errorf("invalid amount %q", cell(cols.amount))
+		}
+	} else {
+		for _, side := range []struct {
+			column int
+			sign   int64
+		}{{cols.credit, 1}, {cols.debit, -1}} {
+			if cell(side.column) == "" {
+				continue
+			}
+			value, err := parseStatementAmount(cell(side.column))
+			if err != nil {
+				return tx, fmt.Errorf("invalid amount %q", cell(side.column))
+			}
+			amount = amount.Add(value.Abs().Mul(decimal.NewFromInt(side.sign)))
+		}
+	}
+	if amount.IsZero() {
+		return tx, fmt.Errorf("amount is zero or missing")
+	}
+	if amount.IsNegative() {
+		tx.FromAccountID = account.ID
+	} else {
+		tx.ToAccountID = account.ID
+	}
+	tx.Amount = storage.NormalizeAmount(amount.Abs(), account.Currency)
+	tx.Timestamp = date
+	tx.BookingDate = date
+	tx.ValueDate = date
+	return tx, nil
+}
+
+// ImportTransactions загружает историю операций счёта из CSV-выписки другого банка. Операции хранятся
+// отдельно от журнала с пометкой imported и не меняют остаток, лимиты и проценты. Повторная загрузка той же
+// выписки безопасна: строки с уже загруженным external_ref пропускаются как дубликаты; строки с ошибками
+// попадают в отчёт, не останавливая загрузку остальных.
+func (svc *Service) ImportTransactions(ctx context.Context, account storage.Account, actor string, req storage.ImportTransactionsRequest, now time.Time) (storage.TransactionImportReport, error) {
+	reader := csv.NewReader(bytes.NewReader([]byte(req.CSV)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+	if req.Mapping.Delimiter != "" {
+		delimiter := []rune(req.Mapping.Delimiter)
+		if len(delimiter) != 1 || delimiter[0] == '"' || delimiter[0] == '\n' {
+			return storage.TransactionImportReport{}, invalidInputf("delimiter must be a single character")
+		}
+		reader.Comma = delimiter[0]
+	}
+	dateFormat := req.Mapping.DateFormat
+	if dateFormat == "" {
+		dateFormat = "2006-01-02"
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return storage.TransactionImportReport{}, invalidInputf("CSV header is missing or invalid")
+	}
+	cols, err := resolveCSVColumns(header, req.Mapping)
+	if err != nil {
+		return storage.TransactionImportReport{}, err
+	}
+
+	report := storage.TransactionImportReport{ImportID: storage.GenerateID(), AccountID: account.ID}
+	info := &storage.ImportInfo{ImportID: report.ImportID, Source: strings.TrimSpace(req.Source), ImportedAt: now}
+	var txs []storage.Transaction
+	lines := make(map[string]int) // external_ref -> строка, где он встретился впервые
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			return storage.TransactionImportReport{}, invalidInputf("invalid CSV: %v", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		report.Total++
+		if report.Total > MaxImportedTransactions {
+			return storage.TransactionImportReport{}, invalidInputf("statement is limited to %d transactions", MaxImportedTransactions)
+		}
+		tx, err := importedRow(record, cols, dateFormat, account, now)
+		if err != nil {
+			report.Skipped = append(report.Skipped, storage.TransactionImportRow{Line: line, ExternalRef: tx.ExternalRef, Status: storage.ImportRowRejected, Error: err.Error()})
+			continue
+		}
+		if _, seen := lines[tx.ExternalRef]; seen {
+			report.Skipped = append(report.Skipped, storage.TransactionImportRow{Line: line, ExternalRef: tx.ExternalRef, Status: storage.ImportRowDuplicate})
+			continue
+		}
+		lines[tx.ExternalRef] = line
+		tx.ID = storage.GenerateID()
+		tx.Imported = info
+		txs = append(txs, tx)
+	}
+	if report.Total == 0 {
+		return storage.TransactionImportReport{}, invalidInputf("statement contains no transactions")
+	}
+
+	added, err := svc.AddImportedTransactions(ctx, account.ID, txs)
+	if err != nil {
+		return storage.TransactionImportReport{}, err
+	}
+	addedRefs := make(map[string]bool, len(added))
+	for _, tx := range added {
+		addedRefs[tx.ExternalRef] = true
+	}
+	for _, tx := range txs {
+		if !addedRefs[tx.ExternalRef] {
+			report.Skipped = append(report.Skipped, storage.TransactionImportRow{Line: lines[tx.ExternalRef], ExternalRef: tx.ExternalRef, Status: storage.ImportRowDuplicate})
+		}
+	}
+	sort.Slice(report.Skipped, func(i, j int) bool { return report.Skipped[i].Line < report.Skipped[j].Line })
+	report.Imported = len(added)
+	for _, row := range report.Skipped {
+		if row.Status == storage.ImportRowDuplicate {
+			report.Duplicates++
+		} else {
+			report.Rejected++
+		}
+	}
+
+	svc.AddAuditEntry(ctx, storage.AuditEntry{
+		ID:        storage.GenerateID(),
+		Timestamp: now,
+		Actor:     actor,
+		Action:    "transaction.import",
+		Details: map[string]string{
+			"import_id":  report.ImportID,
+			"account_id": account.ID,
+			"source":     info.Source,
+			"imported":   fmt.Sprint(report.Imported),
+			"duplicates": fmt.Sprint(report.Duplicates),
+			"rejected":   fmt.Sprint(report.Rejected),
+		},
+	})
+	log.Printf("Statement import %s for account %s: %d imported, %d duplicates, %d rejected", report.ImportID, account.ID, report.Imported, report.Duplicates, report.Rejected)
+	return report, nil
+}
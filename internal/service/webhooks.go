@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/storage"
+)
+
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+func sampleTransaction() storage.Transaction {
+	return storage.Transaction{
+		ID:              "00000000-0000-0000-0000-000000000001",
+		FromAccountID:   "00000000-0000-0000-0000-0000000000a1",
+		Amount:          decimal.NewFromInt(1500),
+		Timestamp:       time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC),
+		TransactionType: "payment",
+		Description:     "Payment to Coffee Shop",
+		Merchant:        "Coffee Shop",
+		Sequence:        42,
+	}
+}
+
+var WebhookEventCatalog = []storage.WebhookEventType{
+	{
+		Type:        storage.EventBalanceChanged,
+		Description: "Баланс счёта изменился",
+		SamplePayload: map[string]interface{}{
+			"balance":  decimal.NewFromInt(98500),
+			"currency": "RUB",
+		},
+	},
+	{
+		Type:        storage.EventCardPayment,
+		Description: "Проведена оплата картой",
+		SamplePayload: map[string]interface{}{
+			"card_id":  "00000000-0000-0000-0000-0000000000c1",
+			"amount":   decimal.NewFromInt(1500),
+			"merchant": "Coffee Shop",
+		},
+	},
+	{
+		Type:        storage.EventLoanPaymentDue,
+		Description: "Приближается дата платежа по кредиту",
+		SamplePayload: map[string]interface{}{
+			"loan_id":  "00000000-0000-0000-0000-0000000000l1",
+			"due_date": time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+			"amount":   decimal.NewFromFloat(8791.59),
+		},
+	},
+	{
+		Type:        storage.EventLoanDelinquency,
+		Description: "Кредит перешёл в просрочку или в дефолт",
+		SamplePayload: map[string]interface{}{
+			"loan_id":          "00000000-0000-0000-0000-0000000000l1",
+			"status":           storage.LoanDelinquent,
+			"days_past_due":    5,
+			"overdue_amount":   decimal.NewFromFloat(8791.59),
+			"penalty_interest": decimal.NewFromFloat(24.08),
+		},
+	},
+	{
+		Type:        storage.EventAccountAlert,
+		Description: "Сработало оповещение по счёту",
+		SamplePayload: map[string]interface{}{
+			"rule_id":        "00000000-0000-0000-0000-0000000000r1",
+			"alert_type":     storage.AlertBalanceBelow,
+			"threshold":      decimal.NewFromInt(1000),
+			"transaction_id": "00000000-0000-0000-0000-000000000001",
+			"amount":         decimal.NewFromInt(1500),
+			"balance":        decimal.NewFromInt(700),
+			"currency":       "RUB",
+			"message":        "The balance of account 40817810000000000001 is 700.00 RUB, below your alert threshold of 1000.00 RUB.",
+		},
+	},
+	{
+		Type:        storage.EventPaymentRequest,
+		Description: "Запрос денег создан, принят, отклонён или отозван",
+		SamplePayload: map[string]interface{}{
+			"payment_request_id": "00000000-0000-0000-0000-0000000000p1",
+			"status":             storage.MoneyRequestPending,
+			"amount":             decimal.NewFromInt(1500),
+			"currency":           "RUB",
+			"requester_name":     "Ivan Petrov",
+			"description":        "Dinner",
+		},
+	},
+	{
+		Type:          storage.EventTransactionCreated,
+		Description:   "По счёту проведена новая транзакция",
+		SamplePayload: sampleTransaction(),
+	},
+}
+
+func FindWebhookEventType(eventType string) (storage.WebhookEventType, bool) {
+	for _, et := range WebhookEventCatalog {
+		if et.Type == eventType {
+			return et, true
+		}
+	}
+	return storage.WebhookEventType{}, false
+}
+
+// Подпись: hex(HMAC-SHA256(secret, timestamp + "." + body)) в заголовке X-Webhook-Signature
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func DeliverWebhook(ctx context.Context, hook storage.Webhook, event storage.Event, test bool) storage.WebhookDelivery {
+	delivery := storage.WebhookDelivery{WebhookID: hook.ID, EventType: event.Type, Test: test, SentAt: time.Now()}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	timestamp := strconv.FormatInt(delivery.SentAt.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(hook.Secret, timestamp, body))
+	if test {
+		req.Header.Set("X-Webhook-Test", "true")
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return delivery
+}
+
+// StartWebhookDispatcher доставляет события шины подписчикам пользователя, выбравшим этот тип
+func (svc *Service) StartWebhookDispatcher(ctx context.Context) {
+	events := svc.events.SubscribeAll(1024)
+	go func() {
+		for event := range events {
+			for _, hook := range svc.GetUserWebhooks(ctx, event.UserID) {
+				if !hook.Active || !hook.Accepts(event.Type) {
+					continue
+				}
+				go func(hook storage.Webhook, event storage.Event) {
+					delivery := DeliverWebhook(ctx, hook, event, false)
+					if !delivery.Success {
+						metrics.add(metricWebhookUndelivered, 1, "target", "user")
+						log.Printf("Webhook %s delivery of %s failed: %s", hook.ID, event.Type, delivery.Error)
+					}
+				}(hook, event)
+			}
+		}
+	}()
+}
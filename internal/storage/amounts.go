@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// CurrencyScales — сколько знаков после запятой допускает валюта (минорные единицы ISO 4217).
+// Валюты не из списка считаются двухзнаковыми.
+var CurrencyScales = map[string]int32{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"CNY": 2,
+}
+
+const defaultCurrencyScale = 2
+
+func CurrencyScale(currency string) int32 {
+	if scale, ok := CurrencyScales[currency]; ok {
+		return scale
+	}
+	return defaultCurrencyScale
+}
+
+// ValidateAmount отклоняет суммы с лишними знаками после запятой: 10.005 RUB — ошибка, 10.50 и 10.5 — нет
+func ValidateAmount(amount decimal.Decimal, currency string) error {
+	scale := CurrencyScale(currency)
+	if !amount.Equal(amount.Truncate(scale)) {
+		return &StorageError{
+			Kind:    ErrInvalidInput,
+			Code:    CodeValidation,
+			Message: fmt.Sprintf("amount %s has more than %d decimal places allowed for %s", amount.String(), scale, currency),
+		}
+	}
+	return nil
+}
+
+// NormalizeAmount приводит сумму к канонической записи валюты: 100 RUB хранится как 100.00.
+// Лишние знаки округляются банковским округлением, поэтому вызывать стоит после ValidateAmount.
+func NormalizeAmount(amount decimal.Decimal, currency string) decimal.Decimal {
+	scale := CurrencyScale(currency)
+	return decimal.NewFromBigInt(amount.RoundBank(scale).Shift(scale).BigInt(), -scale)
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var CacheConfig = struct {
+	TTL        time.Duration // запись живёт не дольше, даже если хранилище не сообщило об изменении
+	MaxEntries int           // на каждую коллекцию; при переполнении новые записи не кешируются до вытеснения устаревших
+}{
+	TTL:        30 * time.Second,
+	MaxEntries: 100_000,
+}
+
+// WriteNotifier — хранилище, которое сообщает о записи отдельных пользователей, счетов и карт
+type WriteNotifier interface {
+	OnWrite(fn func(collection, id string))
+}
+
+// CacheStats — счётчики кеша одной коллекции с момента запуска
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+}
+
+// CacheReporter — хранилище с кешем чтений; статистика нужна для метрик
+type CacheReporter interface {
+	CacheStats() map[string]CacheStats
+}
+
+// CachedRepository — кеш чтений поверх хранилища: поиск пользователя, счёта и карты по ID идёт в память процесса,
+// а не в базу. Запись инвалидирует ключ через WriteNotifier, TTL ограничивает срок жизни на случай
+// пропущенного уведомления. Остальные методы Repository вызываются напрямую.
+type CachedRepository struct {
+	Repository
+	users    *readCache[User]
+	accounts *readCache[Account]
+	cards    *readCache[Card]
+}
+
+func NewCachedRepository(repo Repository, writes WriteNotifier) *CachedRepository {
+	c := &CachedRepository{
+		Repository: repo,
+		users:      newReadCache[User](),
+		accounts:   newReadCache[Account](),
+		cards:      newReadCache[Card](),
+	}
+	writes.OnWrite(func(collection, id string) {
+		switch collection {
+		case CollectionUsers:
+			c.users.invalidate(id)
+		case CollectionAccounts:
+			c.accounts.invalidate(id)
+		case CollectionCards:
+			c.cards.invalidate(id)
+		}
+	})
+	return c
+}
+
+func (c *CachedRepository) GetUser(ctx context.Context, userID string) (User, bool) {
+	return c.users.get(userID, func() (User, bool) { return c.Repository.GetUser(ctx, userID) })
+}
+
+func (c *CachedRepository) GetAccount(ctx context.Context, accountID string) (Account, bool) {
+	return c.accounts.get(accountID, func() (Account, bool) { return c.Repository.GetAccount(ctx, accountID) })
+}
+
+func (c *CachedRepository) GetCard(ctx context.Context, cardID string) (Card, bool) {
+	return c.cards.get(cardID, func() (Card, bool) { return c.Repository.GetCard(ctx, cardID) })
+}
+
+func (c *CachedRepository) CacheStats() map[string]CacheStats {
+	return map[string]CacheStats{
+		CollectionUsers:    c.users.stats(),
+		CollectionAccounts: c.accounts.stats(),
+		CollectionCards:    c.cards.stats(),
+	}
+}
+
+type cacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+type readCache[T any] struct {
+	mu          sync.Mutex
+	entries     map[string]cacheEntry[T]
+	epoch       uint64 // растёт при каждой инвалидации; чтение, пересёкшееся с записью, не попадает в кеш
+	hits        uint64
+	misses      uint64
+	invalidated uint64
+}
+
+func newReadCache[T any]() *readCache[T] {
+	return &readCache[T]{entries: make(map[string]cacheEntry[T])}
+}
+
+// get отдаёт значение из кеша или читает его через load. Отсутствующие записи не кешируются:
+// только что созданный счёт должен быть виден сразу. load вызывается без блокировки кеша,
+// так что инвалидация из хранилища (под его блокировкой) не приводит к взаимной блокировке.
+func (rc *readCache[T]) get(id string, load func() (T, bool)) (T, bool) {
+	now := time.Now()
+	rc.mu.Lock()
+	if e, ok := rc.entries[id]; ok && now.Before(e.expires) {
+		rc.hits++
+		rc.mu.Unlock()
+		return e.value, true
+	}
+	rc.misses++
+	epoch := rc.epoch
+	rc.mu.Unlock()
+
+	value, ok := load()
+	if !ok {
+		return value, false
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.epoch != epoch {
+		return value, true
+	}
+	if len(rc.entries) >= CacheConfig.MaxEntries {
+		for key, e := range rc.entries {
+			if !now.Before(e.expires) {
+				delete(rc.entries, key)
+			}
+		}
+		if len(rc.entries) >= CacheConfig.MaxEntries {
+			return value, true
+		}
+	}
+	rc.entries[id] = cacheEntry[T]{value: value, expires: now.Add(CacheConfig.TTL)}
+	return value, true
+}
+
+func (rc *readCache[T]) invalidate(id string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.epoch++
+	if _, ok := rc.entries[id]; ok {
+		delete(rc.entries, id)
+		rc.invalidated++
+	}
+}
+
+func (rc *readCache[T]) stats() CacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return CacheStats{Hits: rc.hits, Misses: rc.misses, Invalidations: rc.invalidated}
+}
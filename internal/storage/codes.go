@@ -0,0 +1,47 @@
+package storage
+
+// ErrorCode — машиночитаемый код ошибки API, стабилен между версиями сообщений
+type ErrorCode string
+
+const (
+	CodeValidation          ErrorCode = "VALIDATION_ERROR"
+	CodeUnauthorized        ErrorCode = "UNAUTHORIZED"
+	CodeForbidden           ErrorCode = "FORBIDDEN"
+	CodeNotFound            ErrorCode = "NOT_FOUND"
+	CodeConflict            ErrorCode = "CONFLICT"
+	CodeInsufficientFunds   ErrorCode = "INSUFFICIENT_FUNDS"
+	CodeQuotaExceeded       ErrorCode = "QUOTA_EXCEEDED"
+	CodeLimitExceeded       ErrorCode = "LIMIT_EXCEEDED"
+	CodeRateLimited         ErrorCode = "RATE_LIMITED"
+	CodeUnsupportedVersion  ErrorCode = "UNSUPPORTED_API_VERSION"
+	CodeInternal            ErrorCode = "INTERNAL_ERROR"
+	CodeServiceUnavailable  ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeRequestCancelled    ErrorCode = "REQUEST_CANCELLED"
+	CodeRequestTimeout      ErrorCode = "REQUEST_TIMEOUT"
+	CodeAccountNotFound     ErrorCode = "ACCOUNT_NOT_FOUND"
+	CodeAccountClosed       ErrorCode = "ACCOUNT_CLOSED"
+	CodeUserNotFound        ErrorCode = "USER_NOT_FOUND"
+	CodeCardNotFound        ErrorCode = "CARD_NOT_FOUND"
+	CodeLoanNotFound        ErrorCode = "LOAN_NOT_FOUND"
+	CodeTransactionNotFound ErrorCode = "TRANSACTION_NOT_FOUND"
+	CodeAliasNotFound       ErrorCode = "ALIAS_NOT_FOUND"
+	CodeConfirmationInvalid ErrorCode = "CONFIRMATION_INVALID"
+	CodeKYCRequired         ErrorCode = "KYC_REQUIRED"
+	CodeFraudSuspected      ErrorCode = "FRAUD_SUSPECTED"
+	CodeInvoiceNotFound     ErrorCode = "INVOICE_NOT_FOUND"
+	CodeInvoiceNotPayable   ErrorCode = "INVOICE_NOT_PAYABLE"
+	CodeEscrowNotFound      ErrorCode = "ESCROW_NOT_FOUND"
+	CodeOperationDisabled   ErrorCode = "OPERATION_DISABLED"
+	CodeBankLimitExceeded   ErrorCode = "BANK_LIMIT_EXCEEDED"
+	CodeCreditDeclined      ErrorCode = "CREDIT_DECLINED"
+	CodeSignatureRequired   ErrorCode = "SIGNATURE_REQUIRED"
+	CodeInvalidSignature    ErrorCode = "INVALID_SIGNATURE"
+	CodeVersionConflict     ErrorCode = "VERSION_CONFLICT"
+	CodeOrgNotFound         ErrorCode = "ORGANIZATION_NOT_FOUND"
+	CodeApprovalNotFound    ErrorCode = "APPROVAL_NOT_FOUND"
+	CodeConsentNotFound     ErrorCode = "CONSENT_NOT_FOUND"
+	CodePaymentNotFound     ErrorCode = "PAYMENT_NOT_FOUND"
+
+	CodePaymentRequestNotFound   ErrorCode = "PAYMENT_REQUEST_NOT_FOUND"
+	CodePaymentRequestNotPending ErrorCode = "PAYMENT_REQUEST_NOT_PENDING"
+)
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"log"
+	"strings"
+	"text/template"
+)
+
+// Ключи шаблонов описаний транзакций. Ключ и параметры сохраняются в транзакции,
+// текст рендерится на языке владельца счёта при выдаче выписки или ленты операций.
+const (
+	DescCardPayment      = "card_payment"
+	DescRefund           = "refund"
+	DescTransfer         = "transfer"
+	DescExchangeOut      = "exchange_out"
+	DescExchangeIn       = "exchange_in"
+	DescDeposit          = "deposit"
+	DescLoanDisbursement = "loan_disbursement"
+	DescFXSweepOut       = "fx_sweep_out"
+	DescFXSweepIn        = "fx_sweep_in"
+	DescInterest         = "interest"
+	DescCustodyFee       = "custody_fee"
+	DescMonthlyFee       = "monthly_fee"
+	DescClosurePayout    = "closure_payout"
+	DescDepositReversal  = "deposit_reversal"
+	DescReceivableOffset = "receivable_offset"
+	DescChargeback       = "chargeback"
+	DescInvoicePayment   = "invoice_payment"
+	DescPaymentRequest   = "payment_request"
+	DescEscrowFund       = "escrow_fund"
+	DescEscrowRelease    = "escrow_release"
+	DescEscrowRefund     = "escrow_refund"
+	DescAutoTransfer     = "auto_transfer"
+	DescLoanPayment      = "loan_payment"
+	DefaultLanguage      = "en"
+)
+
+var descriptionTemplates = map[string]map[string]string{
+	"en": {
+		DescCardPayment:      "Payment to {{.merchant}}",
+		DescRefund:           "Refund from {{.merchant}}{{if .reason}}: {{.reason}}{{end}}",
+		DescTransfer:         "Transfer from {{.from}} to {{.to}}",
+		DescExchangeOut:      "Exchange {{.amount}} {{.from_currency}} -> {{.to_currency}} at {{.rate}}",
+		DescExchangeIn:       "Exchange {{.amount}} {{.from_currency}} -> {{.credited}} {{.to_currency}}",
+		DescDeposit:          "Deposit to account {{.account}}",
+		DescLoanDisbursement: "Loan disbursement (ID: {{.loan_id}})",
+		DescFXSweepOut:       "End-of-day FX sweep {{.amount}} {{.from_currency}} -> {{.to_currency}} at {{.rate}}",
+		DescFXSweepIn:        "End-of-day FX sweep from account {{.from}}",
+		DescInterest:         "Interest for {{.period}}",
+		DescCustodyFee:       "Custody fee on {{.currency}} balance for {{.period}}",
+		DescMonthlyFee:       "Account maintenance fee for {{.period}}",
+		DescClosurePayout:    "Closing balance of {{.from}} transferred to {{.to}}",
+		DescDepositReversal:  "Reversal of erroneous deposit to account {{.account}}{{if .reason}}: {{.reason}}{{end}}",
+		DescReceivableOffset: "Repayment of outstanding amount from incoming funds to account {{.account}}",
+		DescChargeback:       "Chargeback of payment to {{.merchant}}",
+		DescInvoicePayment:   "Payment of invoice {{.invoice}}{{if .description}}: {{.description}}{{end}}",
+		DescPaymentRequest:   "Payment requested by {{.requester}}{{if .description}}: {{.description}}{{end}}",
+		DescEscrowFund:       "Escrow deposit for a deal with {{.seller}}{{if .description}}: {{.description}}{{end}}",
+		DescEscrowRelease:    "Escrow payout from {{.buyer}}{{if .description}}: {{.description}}{{end}}",
+		DescEscrowRefund:     "Escrow refund{{if .description}}: {{.description}}{{end}}",
+		DescAutoTransfer:     "Auto-transfer from {{.from}} to {{.to}}{{if eq .kind \"top_up\"}} (top-up){{else}} (excess sweep){{end}}",
+		DescLoanPayment:      "Scheduled loan payment due {{.due_date}} (ID: {{.loan_id}})",
+	},
+	"ru": {
+		DescCardPayment:      "Оплата: {{.merchant}}",
+		DescRefund:           "Возврат от {{.merchant}}{{if .reason}}: {{.reason}}{{end}}",
+		DescTransfer:         "Перевод со счёта {{.from}} на счёт {{.to}}",
+		DescExchangeOut:      "Обмен {{.amount}} {{.from_currency}} -> {{.to_currency}} по курсу {{.rate}}",
+		DescExchangeIn:       "Обмен {{.amount}} {{.from_currency}} -> {{.credited}} {{.to_currency}}",
+		DescDeposit:          "Пополнение счёта {{.account}}",
+		DescLoanDisbursement: "Выдача кредита (ID: {{.loan_id}})",
+		DescFXSweepOut:       "Конвертация остатка на конец дня {{.amount}} {{.from_currency}} -> {{.to_currency}} по курсу {{.rate}}",
+		DescFXSweepIn:        "Конвертация остатка на конец дня со счёта {{.from}}",
+		DescInterest:         "Проценты за {{.period}}",
+		DescCustodyFee:       "Плата за хранение остатка в {{.currency}} за {{.period}}",
+		DescMonthlyFee:       "Плата за обслуживание счёта за {{.period}}",
+		DescClosurePayout:    "Остаток закрытого счёта {{.from}} переведён на счёт {{.to}}",
+		DescDepositReversal:  "Отмена ошибочного пополнения счёта {{.account}}{{if .reason}}: {{.reason}}{{end}}",
+		DescReceivableOffset: "Погашение задолженности из поступления на счёт {{.account}}",
+		DescChargeback:       "Возврат по спору с {{.merchant}}",
+		DescInvoicePayment:   "Оплата счёта {{.invoice}}{{if .description}}: {{.description}}{{end}}",
+		DescPaymentRequest:   "Перевод по запросу {{.requester}}{{if .description}}: {{.description}}{{end}}",
+		DescEscrowFund:       "Депонирование по сделке с {{.seller}}{{if .description}}: {{.description}}{{end}}",
+		DescEscrowRelease:    "Выплата по безопасной сделке от {{.buyer}}{{if .description}}: {{.description}}{{end}}",
+		DescEscrowRefund:     "Возврат по безопасной сделке{{if .description}}: {{.description}}{{end}}",
+		DescAutoTransfer:     "Автоперевод со счёта {{.from}} на счёт {{.to}}{{if eq .kind \"top_up\"}} (пополнение){{else}} (излишек остатка){{end}}",
+		DescLoanPayment:      "Плановый платёж по кредиту за {{.due_date}} (ID: {{.loan_id}})",
+	},
+}
+
+var descriptionCatalog = compileDescriptionCatalog(descriptionTemplates)
+
+func compileDescriptionCatalog(sources map[string]map[string]string) map[string]map[string]*template.Template {
+	catalog := make(map[string]map[string]*template.Template, len(sources))
+	for lang, templates := range sources {
+		catalog[lang] = make(map[string]*template.Template, len(templates))
+		for key, text := range templates {
+			catalog[lang][key] = template.Must(template.New(lang + "." + key).Option("missingkey=zero").Parse(text))
+		}
+	}
+	return catalog
+}
+
+func IsSupportedLanguage(lang string) bool {
+	_, ok := descriptionCatalog[lang]
+	return ok
+}
+
+func renderDescription(lang, key string, params map[string]string) (string, bool) {
+	tmpl, ok := descriptionCatalog[lang][key]
+	if !ok {
+		tmpl, ok = descriptionCatalog[DefaultLanguage][key]
+	}
+	if !ok {
+		return "", false
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, params); err != nil {
+		log.Printf("Failed to render description %s (%s): %v", key, lang, err)
+		return "", false
+	}
+	return sb.String(), true
+}
+
+// Describe проставляет ключ шаблона, параметры и описание на языке по умолчанию
+// (оно же попадает в поисковый индекс)
+func (tx *Transaction) Describe(key string, params map[string]string) {
+	tx.DescriptionKey = key
+	tx.DescriptionParams = params
+	if text, ok := renderDescription(DefaultLanguage, key, params); ok {
+		tx.Description = text
+	}
+}
+
+// LocalizedDescription возвращает описание на языке lang; для транзакций без шаблона — исходный текст
+func LocalizedDescription(tx Transaction, lang string) string {
+	if tx.DescriptionKey == "" {
+		return tx.Description
+	}
+	if text, ok := renderDescription(lang, tx.DescriptionKey, tx.DescriptionParams); ok {
+		return text
+	}
+	return tx.Description
+}
+
+func LocalizeTransactions(txs []Transaction, lang string) []Transaction {
+	for i := range txs {
+		txs[i].Description = LocalizedDescription(txs[i], lang)
+	}
+	return txs
+}
@@ -0,0 +1,45 @@
+package storage
+
+import "time"
+
+const (
+	EventBalanceChanged  = "balance.changed"
+	EventCardPayment     = "card.payment"
+	EventLoanPaymentDue  = "loan.payment_due"
+	EventLoanDelinquency = "loan.delinquency"
+	EventAccountAlert    = "account.alert"
+	EventPaymentRequest  = "payment_request.updated"
+
+	EventTransactionCreated = "transaction.created"
+)
+
+// События жизненного цикла оплат мерчанту — уходят на вебхук мерчанта, а не в шину пользователя
+const (
+	ChargeAuthorized    = "charge.authorized"
+	ChargeCaptured      = "charge.captured"
+	ChargeVoided        = "charge.voided" // авторизация отменена или истекла
+	ChargeRefunded      = "charge.refunded"
+	ChargeDisputeOpened = "charge.dispute_opened"
+	ChargeChargeback    = "charge.chargeback" // спор решён; outcome в data: accepted или rejected
+)
+
+type MerchantEvent struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	MerchantID string                 `json:"merchant_id"`
+	Data       map[string]interface{} `json:"data"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type Event struct {
+	Type      string      `json:"type"`
+	UserID    string      `json:"user_id"`
+	AccountID string      `json:"account_id,omitempty"`
+	Payload   interface{} `json:"payload,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Publisher — приёмник событий хранилища (шина событий сервисного слоя)
+type Publisher interface {
+	Publish(event Event)
+}
@@ -0,0 +1,25 @@
+package storage
+
+import "github.com/shopspring/decimal"
+
+var daysInYear = decimal.NewFromInt(365)
+
+// DailyAccrual считает начисление за один день: проценты по ставке счёта (могут быть отрицательными)
+// минус плата за хранение остатка сверх бесплатного лимита
+func DailyAccrual(acc Account) decimal.Decimal {
+	if !acc.Balance.IsPositive() {
+		return decimal.Zero
+	}
+	hundred := decimal.NewFromInt(100)
+
+	accrual := acc.Balance.Mul(acc.InterestRate).Div(hundred).Div(daysInYear)
+
+	if acc.CustodyFeeRate.IsPositive() {
+		chargeable := acc.Balance.Sub(acc.CustodyFeeFreeBalance)
+		if chargeable.IsPositive() {
+			fee := chargeable.Mul(acc.CustodyFeeRate).Div(hundred).Div(daysInYear)
+			accrual = accrual.Sub(fee)
+		}
+	}
+	return accrual
+}
@@ -0,0 +1,2534 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	EmailVerified         bool      `json:"email_verified"`
+	VerificationCode      string    `json:"-"`
+	VerificationSentAt    time.Time `json:"-"`
+	VerificationExpiresAt time.Time `json:"-"` // после этого код не принимается, нужен новый
+	VerificationAttempts  int       `json:"-"` // неверные попытки ввода текущего кода
+
+	ParentID string `json:"parent_id,omitempty"` // для зависимых (детских) профилей
+	Language string `json:"language,omitempty"`  // язык описаний операций в выписках и ленте
+
+	Profile      *UserProfile `json:"profile,omitempty"`
+	KYCStatus    string       `json:"kyc_status"`
+	KYCNote      string       `json:"kyc_note,omitempty"` // причина последнего отказа в верификации
+	KYCUpdatedAt *time.Time   `json:"kyc_updated_at,omitempty"`
+}
+
+const (
+	KYCNone     = "none"
+	KYCPending  = "pending"
+	KYCVerified = "verified"
+)
+
+// KYC — статус проверки личности; у пользователей, созданных до появления KYC, он пустой и считается none
+func (u User) KYC() string {
+	if u.KYCStatus == "" {
+		return KYCNone
+	}
+	return u.KYCStatus
+}
+
+// UserProfile — анкетные данные клиента для проверки личности
+type UserProfile struct {
+	FullName       string `json:"full_name"`
+	DateOfBirth    string `json:"date_of_birth"` // YYYY-MM-DD
+	Address        string `json:"address"`
+	DocumentNumber string `json:"document_number"`
+}
+
+// Complete — заполнены все поля, нужные для отправки на проверку
+func (p UserProfile) Complete() bool {
+	return p.FullName != "" && p.DateOfBirth != "" && p.Address != "" && p.DocumentNumber != ""
+}
+
+// UpdateProfileRequest — частичное обновление анкеты: nil-поля не меняются
+type UpdateProfileRequest struct {
+	FullName       *string `json:"full_name"`
+	DateOfBirth    *string `json:"date_of_birth"`
+	Address        *string `json:"address"`
+	DocumentNumber *string `json:"document_number"`
+}
+
+type KYCDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Token      string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Revoked    bool      `json:"revoked"`
+
+	Kind   string   `json:"kind"` // login | personal_access_token | api_key | oauth
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes"`
+
+	// Токены доступа сторонних приложений: чьё это приложение, по какому согласию выдан токен и когда он истекает
+	ClientID  string     `json:"client_id,omitempty"`
+	GrantID   string     `json:"grant_id,omitempty"`
+	ConsentID string     `json:"consent_id,omitempty"` // согласие Open Banking, по которому токен читает счета
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+const (
+	SessionKindLogin  = "login"
+	SessionKindPAT    = "personal_access_token"
+	SessionKindAPIKey = "api_key" // запрос с ключом X-API-Key; сессия собирается из ключа и не хранится
+	SessionKindOAuth  = "oauth"   // токен доступа стороннего приложения по согласию пользователя
+)
+
+const (
+	ScopeAccountsRead   = "accounts:read"
+	ScopeAccountsWrite  = "accounts:write"
+	ScopeTransfersWrite = "transfers:write"
+	ScopeCardsManage    = "cards:manage"
+	ScopeAnalyticsRead  = "analytics:read"
+)
+
+var AllScopes = []string{ScopeAccountsRead, ScopeAccountsWrite, ScopeTransfersWrite, ScopeCardsManage, ScopeAnalyticsRead}
+
+// Персональные токены могут получить только scope на чтение
+var ReadOnlyScopes = map[string]bool{ScopeAccountsRead: true, ScopeAnalyticsRead: true}
+
+func (s Session) HasScope(scope string) bool {
+	for _, sc := range s.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// UserAPIKey — ключ для программного доступа к API от имени пользователя. Передаётся в заголовке X-API-Key
+// вместо токена сессии; хранится только хеш ключа.
+type UserAPIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Access     string     `json:"access"` // read_only | transact
+	Scopes     []string   `json:"scopes"`
+	Prefix     string     `json:"prefix"` // первые символы ключа, чтобы отличать ключи в списке
+	KeyHash    string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+const (
+	APIKeyReadOnly = "read_only"
+	APIKeyTransact = "transact"
+)
+
+// APIKeyAccessScopes — scope, которые получает ключ с данным уровнем доступа
+var APIKeyAccessScopes = map[string][]string{
+	APIKeyReadOnly: {ScopeAccountsRead, ScopeAnalyticsRead},
+	APIKeyTransact: {ScopeAccountsRead, ScopeAnalyticsRead, ScopeTransfersWrite},
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string `json:"name"`
+	Access string `json:"access"`
+}
+
+type APIClient struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Клиент с адресами возврата может запрашивать у пользователей согласие по OAuth2 на перечисленные scope
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	OAuthScopes  []string `json:"oauth_scopes,omitempty"`
+	CallbackURL  string   `json:"callback_url,omitempty"` // куда слать изменения статусов платежей Open Banking
+}
+
+type CreateAPIClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	OAuthScopes  []string `json:"oauth_scopes,omitempty"`
+	CallbackURL  string   `json:"callback_url,omitempty"`
+}
+
+// OAuthScopes — scope, на которые стороннее приложение просит согласие, и scope API, которые получает его токен
+var OAuthScopes = map[string]string{
+	"accounts:read":     ScopeAccountsRead,
+	"transactions:read": ScopeAnalyticsRead,
+	"payments:write":    ScopeTransfersWrite,
+}
+
+// OAuthGrant — согласие пользователя на доступ стороннего приложения. Пока оно не отозвано, приложение
+// обменивает refresh token на новые токены доступа.
+type OAuthGrant struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	ClientID         string     `json:"client_id"`
+	ClientName       string     `json:"client_name"`
+	Scopes           []string   `json:"scopes"` // OAuth-scope из согласия
+	ConsentID        string     `json:"consent_id,omitempty"`
+	RefreshTokenHash string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	RefreshedAt      *time.Time `json:"refreshed_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+// OAuthCode — одноразовый код авторизации; хранится только хеш
+type OAuthCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string // PKCE S256, если приложение его передало
+	ConsentID     string
+	ExpiresAt     time.Time
+}
+
+type OAuthAuthorizeRequest struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"` // через пробел
+	State         string `json:"state,omitempty"`
+	CodeChallenge string `json:"code_challenge,omitempty"`
+	// Поддерживается только S256; пусто — S256, если передан code_challenge
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+	Approve             bool   `json:"approve"`
+
+	// Согласие Open Banking, созданное приложением заранее, и счета, которые пользователь ему открывает
+	// (пусто — все его счета)
+	ConsentID  string   `json:"consent_id,omitempty"`
+	AccountIDs []string `json:"account_ids,omitempty"`
+}
+
+// OAuthConsent — что показать пользователю на экране согласия
+type OAuthConsent struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+
+	AccountConsent *AccountAccessConsent   `json:"account_consent,omitempty"`
+	PaymentConsent *DomesticPaymentConsent `json:"payment_consent,omitempty"`
+	Accounts       []Account               `json:"accounts,omitempty"` // из каких счетов пользователь выбирает
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// AccountAccessConsent — согласие на доступ к информации о счетах (Open Banking AIS). Приложение создаёт его
+// заранее с нужными разрешениями, пользователь подтверждает на экране OAuth2 и выбирает счета.
+type AccountAccessConsent struct {
+	ID              string     `json:"id"`
+	ClientID        string     `json:"client_id"`
+	UserID          string     `json:"user_id,omitempty"` // заполняется при подтверждении
+	Permissions     []string   `json:"permissions"`
+	AccountIDs      []string   `json:"account_ids,omitempty"`
+	Status          string     `json:"status"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	TransactionFrom *time.Time `json:"transaction_from,omitempty"` // окно истории, которую приложению можно читать
+	TransactionTo   *time.Time `json:"transaction_to,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StatusUpdatedAt time.Time  `json:"status_updated_at"`
+}
+
+type CreateAccountConsentRequest struct {
+	Permissions     []string
+	ExpiresAt       *time.Time
+	TransactionFrom *time.Time
+	TransactionTo   *time.Time
+}
+
+// Статусы согласия — как в спецификациях Open Banking
+const (
+	ConsentAwaitingAuthorisation = "AwaitingAuthorisation"
+	ConsentAuthorised            = "Authorised"
+	ConsentRejected              = "Rejected"
+	ConsentRevoked               = "Revoked"
+)
+
+// Разрешения согласия: Basic — без реквизитов и описаний, Detail — с ними; выписка требует ещё Credits и/или Debits
+const (
+	PermReadAccountsBasic      = "ReadAccountsBasic"
+	PermReadAccountsDetail     = "ReadAccountsDetail"
+	PermReadBalances           = "ReadBalances"
+	PermReadTransactionsBasic  = "ReadTransactionsBasic"
+	PermReadTransactionsDetail = "ReadTransactionsDetail"
+	PermReadTransactionsCredit = "ReadTransactionsCredits"
+	PermReadTransactionsDebit  = "ReadTransactionsDebits"
+)
+
+var AccountConsentPermissions = map[string]bool{
+	PermReadAccountsBasic: true, PermReadAccountsDetail: true, PermReadBalances: true,
+	PermReadTransactionsBasic: true, PermReadTransactionsDetail: true, PermReadTransactionsCredit: true, PermReadTransactionsDebit: true,
+}
+
+func (c AccountAccessConsent) Allows(perm string) bool {
+	for _, p := range c.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversAccount — открыт ли счёт приложению этим согласием
+func (c AccountAccessConsent) CoversAccount(accountID string) bool {
+	for _, id := range c.AccountIDs {
+		if id == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentInitiation — что именно приложение просит перевести; платёж должен повторить её без изменений
+type PaymentInitiation struct {
+	InstructionID         string          `json:"instruction_id"`
+	EndToEndID            string          `json:"end_to_end_id"`
+	Amount                decimal.Decimal `json:"amount"`
+	Currency              string          `json:"currency"`
+	CreditorAccountNumber string          `json:"creditor_account_number"`
+	CreditorName          string          `json:"creditor_name,omitempty"`
+	Reference             string          `json:"reference,omitempty"`
+}
+
+func (p PaymentInitiation) Equal(other PaymentInitiation) bool {
+	return p.InstructionID == other.InstructionID && p.EndToEndID == other.EndToEndID && p.Amount.Equal(other.Amount) &&
+		p.Currency == other.Currency && p.CreditorAccountNumber == other.CreditorAccountNumber &&
+		p.CreditorName == other.CreditorName && p.Reference == other.Reference
+}
+
+// DomesticPaymentConsent — согласие на один перевод по инициативе приложения (Open Banking PIS). Пользователь
+// подтверждает его на экране OAuth2 и выбирает счёт списания; исполняется согласие один раз.
+type DomesticPaymentConsent struct {
+	ID              string            `json:"id"`
+	ClientID        string            `json:"client_id"`
+	UserID          string            `json:"user_id,omitempty"`
+	DebtorAccountID string            `json:"debtor_account_id,omitempty"`
+	Initiation      PaymentInitiation `json:"initiation"`
+	Status          string            `json:"status"` // AwaitingAuthorisation | Authorised | Rejected | Consumed
+	PaymentID       string            `json:"payment_id,omitempty"`
+	ExpiresAt       time.Time         `json:"expires_at"`
+	CreatedAt       time.Time         `json:"created_at"`
+	StatusUpdatedAt time.Time         `json:"status_updated_at"`
+}
+
+const ConsentConsumed = "Consumed"
+
+// DomesticPayment — платёж, исполненный по согласию
+type DomesticPayment struct {
+	ID                string            `json:"id"`
+	ConsentID         string            `json:"consent_id"`
+	ClientID          string            `json:"client_id"`
+	UserID            string            `json:"user_id"`
+	DebtorAccountID   string            `json:"debtor_account_id"`
+	CreditorAccountID string            `json:"creditor_account_id"`
+	Initiation        PaymentInitiation `json:"initiation"`
+	Status            string            `json:"status"`
+	TransactionID     string            `json:"transaction_id,omitempty"`
+	RejectReason      string            `json:"reject_reason,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	StatusUpdatedAt   time.Time         `json:"status_updated_at"`
+}
+
+const (
+	PaymentStatusPending   = "Pending"
+	PaymentStatusCompleted = "AcceptedSettlementCompleted"
+	PaymentStatusRejected  = "Rejected"
+)
+
+// Merchant — торговая точка-эквайринговый клиент: оплаты картой зачисляются на её расчётный счёт
+type Merchant struct {
+	ID                  string    `json:"id"`
+	UserID              string    `json:"user_id"` // владелец, чей счёт используется для расчётов
+	Name                string    `json:"name"`
+	Category            string    `json:"category,omitempty"` // категория оплат по умолчанию
+	SettlementAccountID string    `json:"settlement_account_id"`
+	Active              bool      `json:"active"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// MerchantWebhook — адрес мерчанта для событий по его оплатам. После ротации старый секрет ещё
+// PreviousSecretExpiresAt подписывает запросы вторым заголовком, чтобы мерчант успел обновить проверку.
+type MerchantWebhook struct {
+	MerchantID              string     `json:"merchant_id"`
+	URL                     string     `json:"url"`
+	Events                  []string   `json:"events"` // пусто — все события charge.*
+	Secret                  string     `json:"-"`
+	PreviousSecret          string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	Active                  bool       `json:"active"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+func (h MerchantWebhook) Accepts(eventType string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, t := range h.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type MerchantWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// MerchantWebhookDelivery — попытка доставки события мерчанту; повторы пишутся отдельными записями
+type MerchantWebhookDelivery struct {
+	ID         string    `json:"id"`
+	MerchantID string    `json:"merchant_id"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Test       bool      `json:"test"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// MerchantAPIKey — ключ доступа мерчанта к /merchant/*; хранится только хеш, ключ показывается один раз
+type MerchantAPIKey struct {
+	ID         string     `json:"id"`
+	MerchantID string     `json:"merchant_id"`
+	Prefix     string     `json:"prefix"` // первые символы ключа, чтобы отличать ключи в списке
+	KeyHash    string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type RegisterMerchantRequest struct {
+	UserID              string `json:"user_id"`
+	Name                string `json:"name"`
+	Category            string `json:"category"`
+	SettlementAccountID string `json:"settlement_account_id"`
+}
+
+// MerchantSettlement — итог по оплатам мерчанта за день
+type MerchantSettlement struct {
+	Date        string          `json:"date"`
+	Currency    string          `json:"currency"`
+	Payments    int             `json:"payments"`
+	Gross       decimal.Decimal `json:"gross"`
+	Refunds     decimal.Decimal `json:"refunds"`
+	Chargebacks decimal.Decimal `json:"chargebacks"`
+	Net         decimal.Decimal `json:"net"`
+}
+
+// Chargeback — спор клиента по оплате мерчанту. Пока спор открыт, сумма удерживается на расчётном
+// счёте мерчанта; админ либо возвращает её клиенту, либо снимает удержание в пользу мерчанта.
+type Chargeback struct {
+	ID                  string               `json:"id"`
+	TransactionID       string               `json:"transaction_id"` // оспариваемая оплата
+	MerchantID          string               `json:"merchant_id"`
+	UserID              string               `json:"user_id"`
+	CustomerAccountID   string               `json:"customer_account_id"`
+	SettlementAccountID string               `json:"settlement_account_id"`
+	Amount              decimal.Decimal      `json:"amount"`
+	HeldAmount          decimal.Decimal      `json:"held_amount"` // удержано у мерчанта; меньше Amount, если средств не хватило
+	Reason              string               `json:"reason"`
+	Status              string               `json:"status"`
+	Evidence            []ChargebackEvidence `json:"evidence,omitempty"`
+	Resolution          string               `json:"resolution,omitempty"`                 // комментарий админа
+	ChargebackTxIDs     []string             `json:"chargeback_transaction_ids,omitempty"` // возврат клиенту: с мерчанта и, при нехватке, за счёт банка
+	ReceivableID        string               `json:"receivable_id,omitempty"`              // непокрытая удержанием часть, долг мерчанта
+	CreatedAt           time.Time            `json:"created_at"`
+	ResolvedAt          *time.Time           `json:"resolved_at,omitempty"`
+}
+
+type ChargebackEvidence struct {
+	Text        string    `json:"text"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+const (
+	ChargebackOpen              = "open"
+	ChargebackEvidenceSubmitted = "evidence_submitted"
+	ChargebackAccepted          = "accepted" // средства возвращены клиенту
+	ChargebackRejected          = "rejected" // удержание снято в пользу мерчанта
+)
+
+func (c Chargeback) IsResolved() bool {
+	return c.Status == ChargebackAccepted || c.Status == ChargebackRejected
+}
+
+type ChargebackRequest struct {
+	Amount decimal.Decimal `json:"amount"` // необязательно; по умолчанию невозвращённый остаток оплаты
+	Reason string          `json:"reason"`
+}
+
+type ChargebackEvidenceRequest struct {
+	Text string `json:"text"`
+}
+
+type ResolveChargebackRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateWebhookRequest struct {
+	UserID string   `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookEventType struct {
+	Type          string      `json:"type"`
+	Description   string      `json:"description"`
+	SamplePayload interface{} `json:"sample_payload"`
+}
+
+type WebhookDelivery struct {
+	WebhookID  string    `json:"webhook_id"`
+	EventType  string    `json:"event_type"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Test       bool      `json:"test"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+const (
+	EmailSent   = "sent"   // провайдер принял письмо
+	EmailFailed = "failed" // провайдер отказал или недоступен
+	EmailLogged = "logged" // почта не настроена, письмо только записано в лог
+)
+
+// EmailDelivery — попытка отправки письма; MessageID — идентификатор у провайдера для поиска в его журнале
+type EmailDelivery struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	MessageID string    `json:"message_id,omitempty"`
+	To        string    `json:"to"`
+	Subject   string    `json:"subject"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+const (
+	NotificationPending = "pending" // ждёт отправки или повтора
+	NotificationSent    = "sent"    // доставлено; из очереди удаляется, след остаётся в журнале отправок
+	NotificationDead    = "dead"    // попытки исчерпаны, ждёт разбора в dead-letter
+)
+
+// EmailNotification — письмо в очереди отправки. Текст не отдаётся в API: в нём бывают коды подтверждения и токены.
+type EmailNotification struct {
+	ID            string     `json:"id"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"-"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+type SecurityEvent struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Type      string            `json:"type"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+const (
+	SecurityLoginFailed         = "login_failed"
+	SecurityNewDevice           = "device_added"
+	SecurityPasswordReset       = "password_reset_requested"
+	SecurityPasswordChanged     = "password_changed"
+	SecurityOTPFailed           = "otp_failed"
+	SecuritySessionRevoked      = "session_revoked"
+	SecurityTokenIssued         = "token_issued"
+	SecurityAPIKeyIssued        = "api_key_issued"
+	SecurityAPIKeyRotated       = "api_key_rotated"
+	SecurityAPIKeyRevoked       = "api_key_revoked"
+	SecurityOAuthGranted        = "oauth_granted"
+	SecurityOAuthRevoked        = "oauth_revoked"
+	SecurityCardCVVMismatch     = "card_cvv_failed"
+	SecurityCardRevealed        = "card_details_revealed"
+	SecurityPaymentDeclined     = "payment_declined_fraud"
+	SecurityDeviceKeyRegistered = "device_key_registered"
+)
+
+type AuditEntry struct {
+	ID        string            `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Actor     string            `json:"actor"`
+	Action    string            `json:"action"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+type RetentionPolicy struct {
+	Name   string        `json:"name"`
+	Target string        `json:"target"` // card.cvv | session.client_info | transaction
+	After  time.Duration `json:"after"`
+	Action string        `json:"action"` // hash | purge | archive
+}
+
+// TransactionArchiveStats — состояние архива журнала: сколько проводок вынесено из горячего журнала и до какой даты
+type TransactionArchiveStats struct {
+	ArchivedTransactions int        `json:"archived_transactions"`
+	HotTransactions      int        `json:"hot_transactions"`
+	ArchivedAccounts     int        `json:"archived_accounts"`
+	ArchivedThrough      *time.Time `json:"archived_through,omitempty"` // самая поздняя дата валютирования в архиве
+	LastArchivedAt       *time.Time `json:"last_archived_at,omitempty"`
+}
+
+type Account struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id"`
+	Number    string          `json:"number"`
+	Balance   decimal.Decimal `json:"balance"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	HeldAmount       decimal.Decimal `json:"held_amount"`
+	AvailableBalance decimal.Decimal `json:"available_balance"` // Balance минус активные холды
+
+	ProductCode        string          `json:"product_code"`
+	Currency           string          `json:"currency"`
+	InterestRate       decimal.Decimal `json:"interest_rate"`
+	MonthlyFee         decimal.Decimal `json:"monthly_fee"`                  // в рублях, списывается в последний день месяца
+	MonthlyFeePeriod   string          `json:"monthly_fee_period,omitempty"` // последний месяц (YYYY-MM), за который плата списана
+	DailyTransferLimit decimal.Decimal `json:"daily_transfer_limit"`
+
+	AccruedInterest       decimal.Decimal `json:"accrued_interest"`
+	CustodyFeeRate        decimal.Decimal `json:"custody_fee_rate"`
+	CustodyFeeFreeBalance decimal.Decimal `json:"custody_fee_free_balance"`
+
+	Status   string     `json:"status"`
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+
+	// Расчётный счёт организации: распоряжаются им участники по ролям, UserID — представитель, открывший счёт
+	OrganizationID string `json:"organization_id,omitempty"`
+
+	Version int64 `json:"version"` // растёт при каждой записи; хранилище пишет счёт, только если версия не изменилась с момента чтения
+}
+
+const (
+	AccountStatusActive = "active"
+	AccountStatusClosed = "closed"
+)
+
+// InterestCertificate — справка о процентах по счёту за календарный год (для налоговой декларации),
+// собирается из проводок interest и custody_fee начислятора
+type InterestCertificate struct {
+	Number       string            `json:"number"`
+	Account      Account           `json:"account"`
+	HolderName   string            `json:"holder_name"`
+	Year         int               `json:"year"`
+	Postings     []InterestPosting `json:"postings"`
+	TotalEarned  decimal.Decimal   `json:"total_earned"`
+	TotalCharged decimal.Decimal   `json:"total_charged"` // плата за хранение остатка
+	NetInterest  decimal.Decimal   `json:"net_interest"`
+	IssuedAt     time.Time         `json:"issued_at"`
+}
+
+// AccountInterest — проценты по счёту для финансовой сводки: текущая ставка, начислено и ещё не выплачено
+// (за вычетом платы за хранение), выплачено с начала года
+type AccountInterest struct {
+	AccountID        string          `json:"account_id"`
+	Currency         string          `json:"currency"`
+	Rate             decimal.Decimal `json:"rate"`
+	Floating         bool            `json:"floating"` // ставка привязана к ключевой ставке ЦБ
+	Accrued          decimal.Decimal `json:"accrued"`
+	CreditedThisYear decimal.Decimal `json:"credited_this_year"`
+}
+
+type InterestPosting struct {
+	TransactionID string          `json:"transaction_id"`
+	ValueDate     time.Time       `json:"value_date"`
+	Type          string          `json:"type"` // interest | custody_fee
+	Amount        decimal.Decimal `json:"amount"`
+	Period        string          `json:"period,omitempty"`
+}
+
+type Statement struct {
+	Account        Account         `json:"account"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	TotalCredits   decimal.Decimal `json:"total_credits"`
+	TotalDebits    decimal.Decimal `json:"total_debits"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	Transactions   []Transaction   `json:"transactions"`
+}
+
+// MonthlyReport — финансовый отчёт клиента за календарный месяц для скачивания и вложения в письмо.
+// Доходы и расходы считаются без переводов между своими счетами; итоги и разбивка по категориям — в рублях.
+type MonthlyReport struct {
+	UserID      string                 `json:"user_id"`
+	HolderName  string                 `json:"holder_name"`
+	Month       string                 `json:"month"` // YYYY-MM
+	From        time.Time              `json:"from"`
+	To          time.Time              `json:"to"`
+	Currency    string                 `json:"currency"`
+	Accounts    []MonthlyReportAccount `json:"accounts"`
+	Income      decimal.Decimal        `json:"income"`
+	Spending    decimal.Decimal        `json:"spending"`
+	Net         decimal.Decimal        `json:"net"`
+	Categories  []CategorySpending     `json:"categories"` // по убыванию суммы
+	Loans       []LoanSummary          `json:"loans"`      // непогашенные на момент формирования
+	GeneratedAt time.Time              `json:"generated_at"`
+}
+
+// MonthlyReportAccount — движение по счёту за месяц в его валюте
+type MonthlyReportAccount struct {
+	AccountID      string          `json:"account_id"`
+	Number         string          `json:"number"`
+	Currency       string          `json:"currency"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	Income         decimal.Decimal `json:"income"`
+	Spending       decimal.Decimal `json:"spending"`
+}
+
+// CategorySpending — расходы одной категории: для оплат — категория мерчанта, для прочих списаний — тип операции
+type CategorySpending struct {
+	Category     string          `json:"category"`
+	Amount       decimal.Decimal `json:"amount"`
+	Share        decimal.Decimal `json:"share"` // процент от всех расходов месяца
+	Transactions int             `json:"transactions"`
+}
+
+// Cashflow — доходы и расходы клиента по месяцам, от старого к новому; итоги в рублях по текущему курсу
+type Cashflow struct {
+	UserID      string          `json:"user_id"`
+	Currency    string          `json:"currency"`
+	Months      []CashflowMonth `json:"months"`
+	Income      decimal.Decimal `json:"income"`
+	Expenses    decimal.Decimal `json:"expenses"`
+	Net         decimal.Decimal `json:"net"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+type CashflowMonth struct {
+	Month    string            `json:"month"` // YYYY-MM
+	Income   decimal.Decimal   `json:"income"`
+	Expenses decimal.Decimal   `json:"expenses"`
+	Net      decimal.Decimal   `json:"net"`
+	Accounts []CashflowAccount `json:"accounts,omitempty"` // только с per_account=true
+}
+
+// CashflowAccount — доходы и расходы одного счёта за месяц в валюте счёта
+type CashflowAccount struct {
+	AccountID string          `json:"account_id"`
+	Number    string          `json:"number"`
+	Currency  string          `json:"currency"`
+	Income    decimal.Decimal `json:"income"`
+	Expenses  decimal.Decimal `json:"expenses"`
+	Net       decimal.Decimal `json:"net"`
+}
+
+// MerchantSpending — «куда уходят деньги»: оплаты картой клиента за период по мерчантам, суммы в рублях
+type MerchantSpending struct {
+	UserID    string          `json:"user_id"`
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Currency  string          `json:"currency"`
+	Sort      string          `json:"sort"`
+	Payments  int             `json:"payments"` // по всем мерчантам, а не только попавшим в топ
+	Total     decimal.Decimal `json:"total"`
+	Merchants []MerchantSpend `json:"merchants"`
+}
+
+// MerchantSpend — оплаты одному мерчанту; Total — за вычетом возвратов и чарджбэков, Average — средний чек
+type MerchantSpend struct {
+	MerchantID    string          `json:"merchant_id,omitempty"` // пусто для мерчантов без регистрации в банке
+	Name          string          `json:"name"`
+	Category      string          `json:"category,omitempty"`
+	Payments      int             `json:"payments"`
+	Gross         decimal.Decimal `json:"gross"`
+	Refunded      decimal.Decimal `json:"refunded"`
+	Total         decimal.Decimal `json:"total"`
+	Average       decimal.Decimal `json:"average"`
+	Share         decimal.Decimal `json:"share"` // процент от Total всех мерчантов
+	LastPaymentAt time.Time       `json:"last_payment_at"`
+}
+
+// Периодичность регулярных платежей
+const (
+	RecurringWeekly    = "weekly"
+	RecurringMonthly   = "monthly"
+	RecurringQuarterly = "quarterly"
+	RecurringYearly    = "yearly"
+)
+
+// RecurringPayment — регулярный платёж, найденный по истории: подписка у мерчанта или перевод одному получателю
+// (например, аренда). Суммы — в валюте счёта.
+type RecurringPayment struct {
+	AccountID      string           `json:"account_id"`
+	Currency       string           `json:"currency"`
+	Merchant       string           `json:"merchant,omitempty"`
+	MerchantID     string           `json:"merchant_id,omitempty"`
+	ToAccountID    string           `json:"to_account_id,omitempty"` // для регулярных переводов
+	Category       string           `json:"category"`
+	Period         string           `json:"period"`
+	Occurrences    int              `json:"occurrences"`
+	Amount         decimal.Decimal  `json:"amount"` // последний платёж — ожидаемая сумма следующего
+	AverageAmount  decimal.Decimal  `json:"average_amount"`
+	PreviousAmount *decimal.Decimal `json:"previous_amount,omitempty"` // предыдущая сумма, если последний платёж подорожал
+	FirstDate      time.Time        `json:"first_date"`
+	LastDate       time.Time        `json:"last_date"`
+	NextDate       time.Time        `json:"next_date"`
+	Active         bool             `json:"active"` // false — очередной платёж давно пропущен, похоже, подписка отменена
+}
+
+type RecurringPayments struct {
+	UserID       string             `json:"user_id"`
+	Payments     []RecurringPayment `json:"payments"`
+	MonthlyTotal decimal.Decimal    `json:"monthly_total"` // оценка ежемесячных трат на активные платежи в рублях
+	Currency     string             `json:"currency"`
+}
+
+// AccountClosure — итог закрытия счёта: финальные проводки и выписка за весь срок жизни счёта
+type AccountClosure struct {
+	Account    Account      `json:"account"`
+	ClosedAt   time.Time    `json:"closed_at"`
+	Settlement *Transaction `json:"settlement,omitempty"`
+	Payout     *Transaction `json:"payout,omitempty"`
+	Statement  *Statement   `json:"statement,omitempty"`
+}
+
+type CloseAccountRequest struct {
+	PayoutAccountID string `json:"payout_account_id"`
+}
+
+// CustodyFee — плата за хранение остатка в валюте: годовой процент на сумму сверх FreeBalance
+type CustodyFee struct {
+	AnnualRate  decimal.Decimal `json:"annual_rate"`
+	FreeBalance decimal.Decimal `json:"free_balance"`
+}
+
+func (a Account) IsClosed() bool {
+	return a.Status == AccountStatusClosed
+}
+
+func (a *Account) refreshAvailable() {
+	a.AvailableBalance = a.Balance.Sub(a.HeldAmount)
+}
+
+type Product struct {
+	Code               string          `json:"code"`
+	Name               string          `json:"name"`
+	Currencies         []string        `json:"currencies"`
+	InterestRate       decimal.Decimal `json:"interest_rate"`
+	MonthlyFee         decimal.Decimal `json:"monthly_fee"`
+	DailyTransferLimit decimal.Decimal `json:"daily_transfer_limit"`
+	MaxPerUser         int             `json:"max_per_user"`
+	RequiresProduct    string          `json:"requires_product,omitempty"`
+	Business           bool            `json:"business,omitempty"` // открывается только организациям
+
+	CustodyFees map[string]CustodyFee `json:"custody_fees,omitempty"` // key: валюта
+}
+
+// Organization — юрлицо или ИП. Расчётные счета принадлежат организации, а её участники работают с ними
+// в пределах своей роли.
+type Organization struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	TaxID     string      `json:"tax_id"` // ИНН: 10 цифр у юрлица, 12 у ИП
+	Members   []OrgMember `json:"members"`
+	CreatedAt time.Time   `json:"created_at"`
+
+	// ApprovalThreshold — переводы со счетов организации дороже этой суммы в рублях исполняются только после
+	// подтверждения вторым участником; 0 — без двойного контроля
+	ApprovalThreshold decimal.Decimal `json:"approval_threshold"`
+}
+
+type OrgMember struct {
+	UserID  string    `json:"user_id"`
+	Role    string    `json:"role"`
+	AddedBy string    `json:"added_by,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+const (
+	OrgRoleOwner      = "owner"      // все права, включая участников и открытие счетов
+	OrgRoleAccountant = "accountant" // платежи и выписки
+	OrgRoleViewer     = "viewer"     // только просмотр
+)
+
+// Права участника на счета организации
+const (
+	OrgPermView   = "view"   // остатки, выписки, оповещения
+	OrgPermPay    = "pay"    // переводы, обмен и оплаты картой
+	OrgPermManage = "manage" // участники, открытие и закрытие счетов, выпуск карт
+)
+
+var orgRolePermissions = map[string][]string{
+	OrgRoleOwner:      {OrgPermView, OrgPermPay, OrgPermManage},
+	OrgRoleAccountant: {OrgPermView, OrgPermPay},
+	OrgRoleViewer:     {OrgPermView},
+}
+
+// ValidOrgRole — известна ли роль участника
+func ValidOrgRole(role string) bool {
+	_, ok := orgRolePermissions[role]
+	return ok
+}
+
+func (o Organization) Member(userID string) (OrgMember, bool) {
+	for _, m := range o.Members {
+		if m.UserID == userID {
+			return m, true
+		}
+	}
+	return OrgMember{}, false
+}
+
+// Allows — даёт ли роль пользователя в организации право perm
+func (o Organization) Allows(userID, perm string) bool {
+	member, ok := o.Member(userID)
+	if !ok {
+		return false
+	}
+	for _, p := range orgRolePermissions[member.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Organization) Owners() int {
+	owners := 0
+	for _, m := range o.Members {
+		if m.Role == OrgRoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
+
+type CreateOrganizationRequest struct {
+	Name        string `json:"name"`
+	TaxID       string `json:"tax_id"`
+	OwnerUserID string `json:"owner_user_id,omitempty"` // без сессии; с сессией владельцем становится её пользователь
+}
+
+type OrgMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type ApprovalThresholdRequest struct {
+	Threshold decimal.Decimal `json:"threshold"`
+}
+
+// PaymentApproval — перевод со счёта организации выше порога двойного контроля: его создаёт один участник,
+// а исполняет только после подтверждения другой
+type PaymentApproval struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"organization_id"`
+	FromAccountID  string          `json:"from_account_id"`
+	ToAccountID    string          `json:"to_account_id"`
+	Amount         decimal.Decimal `json:"amount"`
+	Currency       string          `json:"currency"`
+	Status         string          `json:"status"`
+	MakerUserID    string          `json:"maker_user_id,omitempty"`
+	CheckerUserID  string          `json:"checker_user_id,omitempty"`
+	Reason         string          `json:"reason,omitempty"` // причина отклонения
+	TransactionID  string          `json:"transaction_id,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+	DecidedAt      *time.Time      `json:"decided_at,omitempty"`
+}
+
+const (
+	PaymentApprovalPending  = "pending"
+	PaymentApprovalExecuted = "executed"
+	PaymentApprovalRejected = "rejected"
+	PaymentApprovalExpired  = "expired"
+)
+
+type PaymentDecisionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type OpenBusinessAccountRequest struct {
+	ProductCode string `json:"product_code"` // по умолчанию business
+	Currency    string `json:"currency"`
+}
+
+type AccountWithProduct struct {
+	Account
+	Product Product `json:"product"`
+}
+
+type Card struct {
+	ID          string    `json:"id"`
+	AccountID   string    `json:"account_id"`
+	Number      string    `json:"number"`
+	ExpiryMonth int       `json:"expiry_month"`
+	ExpiryYear  int       `json:"expiry_year"`
+	CVV         string    `json:"-"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	CVVHash     string     `json:"-"`
+	CVVPurgedAt *time.Time `json:"cvv_purged_at,omitempty"`
+
+	HolderName        string     `json:"holder_name,omitempty"`
+	DeliveryStatus    string     `json:"delivery_status,omitempty"`
+	DeliveryUpdatedAt *time.Time `json:"delivery_updated_at,omitempty"`
+}
+
+// CardReveal — запрос владельца на показ реквизитов карты: код подтверждения на email (step-up),
+// затем одноразовый токен с коротким сроком жизни. Коды и токены хранятся только в виде хешей.
+type CardReveal struct {
+	ID        string    `json:"id"`
+	CardID    string    `json:"card_id"`
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"` // срок действия кода, после подтверждения — токена
+	Status    string    `json:"status"`
+
+	CodeHash  string `json:"-"`
+	Attempts  int    `json:"-"`
+	TokenHash string `json:"-"`
+}
+
+const (
+	CardRevealPendingStepUp = "pending_step_up"
+	CardRevealReady         = "ready"
+	CardRevealRedeemed      = "redeemed"
+	CardRevealFailed        = "failed"
+	CardRevealExpired       = "expired"
+)
+
+type ConfirmCardRevealRequest struct {
+	Code string `json:"code"`
+}
+
+// CardDetails — раскрытые реквизиты карты; CVV пуст, если уже заменён хешем по политике хранения
+type CardDetails struct {
+	CardID      string `json:"card_id"`
+	Number      string `json:"number"`
+	ExpiryMonth int    `json:"expiry_month"`
+	ExpiryYear  int    `json:"expiry_year"`
+	CVV         string `json:"cvv,omitempty"`
+	HolderName  string `json:"holder_name,omitempty"`
+}
+
+const (
+	DeliveryOrdered   = "ordered"
+	DeliveryProduced  = "produced"
+	DeliveryShipped   = "shipped"
+	DeliveryDelivered = "delivered"
+	DeliveryReturned  = "returned"
+)
+
+var DeliveryStatuses = map[string]bool{
+	DeliveryOrdered: true, DeliveryProduced: true, DeliveryShipped: true, DeliveryDelivered: true, DeliveryReturned: true,
+}
+
+const (
+	CardStatusActive  = "active"
+	CardStatusBlocked = "blocked"
+)
+
+func (c Card) IsActive(now time.Time) bool {
+	expiry := time.Date(c.ExpiryYear, time.Month(c.ExpiryMonth)+1, 0, 23, 59, 59, 0, time.UTC) // Последний день месяца
+	return c.Status == CardStatusActive && !now.After(expiry)
+}
+
+type Transaction struct {
+	ID              string          `json:"id"`
+	FromAccountID   string          `json:"from_account_id,omitempty"`
+	ToAccountID     string          `json:"to_account_id,omitempty"`
+	Amount          decimal.Decimal `json:"amount"`
+	Timestamp       time.Time       `json:"timestamp"`
+	TransactionType string          `json:"transaction_type"`
+	Description     string          `json:"description,omitempty"`
+	Merchant        string          `json:"merchant,omitempty"`
+	MerchantID      string          `json:"merchant_id,omitempty"`
+	CardID          string          `json:"card_id,omitempty"` // карта, которой оплачено; возвраты наследуют её от оплаты
+	Category        string          `json:"category,omitempty"`
+	LinkedTxID      string          `json:"linked_transaction_id,omitempty"` // операция, из которой возникла эта: возврат, отмена, второй шаг обмена
+	GroupID         string          `json:"group_id,omitempty"`              // исходная операция цепочки; заполняется при записи по LinkedTxID
+	Sequence        int64           `json:"sequence"`
+
+	DescriptionKey    string            `json:"description_key,omitempty"` // шаблон описания, см. descriptions.go
+	DescriptionParams map[string]string `json:"description_params,omitempty"`
+
+	// Дата проводки — когда операция записана в наш журнал; дата валютирования — с какого момента она влияет
+	// на остаток, проценты, выписки и аналитику. Обе заполняются при записи в журнал, по умолчанию равны Timestamp;
+	// дата валютирования раньше даты проводки бывает у перенесённой истории и входящих внешних переводов.
+	BookingDate time.Time `json:"booking_date"`
+	ValueDate   time.Time `json:"value_date"`
+	ExternalRef string    `json:"external_ref,omitempty"` // идентификатор операции в исходной системе
+
+	Fraud *FraudAssessment `json:"fraud,omitempty"` // оценка риска при авторизации карточной оплаты
+
+	// Операция, загруженная из выписки другого банка: хранится отдельно от журнала и не меняет остаток
+	Imported *ImportInfo `json:"imported,omitempty"`
+}
+
+// ImportInfo — откуда взята импортированная операция
+type ImportInfo struct {
+	ImportID   string    `json:"import_id"`
+	Source     string    `json:"source,omitempty"` // название банка-источника, как его указал пользователь
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// TransactionDetail — операция вместе с родительской и всей группой связанных проводок (исходная операция первой)
+type TransactionDetail struct {
+	Transaction Transaction   `json:"transaction"`
+	Parent      *Transaction  `json:"parent,omitempty"`
+	Group       []Transaction `json:"group,omitempty"`
+}
+
+// FraudAssessment — оценка риска платежа: 0 — безопасно, 100 — почти наверняка мошенничество
+type FraudAssessment struct {
+	Score      int       `json:"score"`
+	Provider   string    `json:"provider"` // external или rules (правила, если внешний сервис не ответил)
+	Reasons    []string  `json:"reasons,omitempty"`
+	Declined   bool      `json:"declined"`
+	AssessedAt time.Time `json:"assessed_at"`
+}
+
+const (
+	FraudProviderExternal = "external"
+	FraudProviderRules    = "rules"
+)
+
+// EffectiveDate — дата, на которую операция влияет на остаток: дата валютирования, если она задана
+func (tx Transaction) EffectiveDate() time.Time {
+	if !tx.ValueDate.IsZero() {
+		return tx.ValueDate
+	}
+	return tx.Timestamp
+}
+
+// BookedAt — дата проводки операции в журнале банка
+func (tx Transaction) BookedAt() time.Time {
+	if !tx.BookingDate.IsZero() {
+		return tx.BookingDate
+	}
+	return tx.Timestamp
+}
+
+type TransactionSearchResult struct {
+	Transaction
+	Score int `json:"score"`
+}
+
+const (
+	SearchKindUser    = "user"
+	SearchKindAccount = "account"
+	SearchKindCard    = "card"
+)
+
+type AdminSearchResult struct {
+	Kind         string `json:"kind"`
+	ID           string `json:"id"`
+	UserID       string `json:"user_id,omitempty"`
+	Label        string `json:"label"`
+	MatchedField string `json:"matched_field"`
+	Score        int    `json:"score"`
+}
+
+type Loan struct {
+	ID              string          `json:"id"`
+	UserID          string          `json:"user_id"`
+	AccountID       string          `json:"account_id"`
+	Amount          decimal.Decimal `json:"amount"`
+	InterestRate    decimal.Decimal `json:"interest_rate"`
+	TermMonths      int             `json:"term_months"`
+	StartDate       time.Time       `json:"start_date"`
+	PaymentSchedule []Payment       `json:"payment_schedule"`
+	RemainingAmount decimal.Decimal `json:"remaining_amount"`
+	// Просрочка: статус и пени ведёт ежедневная задача, PenaltyAccruedAt — до какого момента пени начислены
+	Status           string          `json:"status"`
+	PenaltyInterest  decimal.Decimal `json:"penalty_interest"`
+	PenaltyAccruedAt *time.Time      `json:"penalty_accrued_at,omitempty"`
+	DelinquentSince  *time.Time      `json:"delinquent_since,omitempty"`
+	DefaultedAt      *time.Time      `json:"defaulted_at,omitempty"`
+	GuarantorUserID  string          `json:"guarantor_user_id,omitempty"` // поручитель отвечает по долгу, если заёмщик не платит
+	Collateral       []Collateral    `json:"collateral,omitempty"`
+	// Кредитные каникулы: сколько месяцев платежей уже отложено за срок кредита
+	HolidayMonths int         `json:"holiday_months,omitempty"`
+	History       []LoanEvent `json:"history,omitempty"`
+}
+
+// LoanEvent — изменение условий кредита после выдачи
+type LoanEvent struct {
+	Type      string            `json:"type"`
+	Timestamp time.Time         `json:"timestamp"`
+	Actor     string            `json:"actor"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+const LoanEventHoliday = "payment_holiday"
+
+// Collateral — залог по кредиту. Заявленная стоимость — в валюте кредита; залог снимается, когда кредит погашен.
+type Collateral struct {
+	ID            string          `json:"id"`
+	AssetType     string          `json:"asset_type"`
+	Description   string          `json:"description"`
+	DeclaredValue decimal.Decimal `json:"declared_value"`
+	Status        string          `json:"status"`
+	PledgedAt     *time.Time      `json:"pledged_at,omitempty"`
+	ReleasedAt    *time.Time      `json:"released_at,omitempty"`
+}
+
+const (
+	CollateralRealEstate = "real_estate"
+	CollateralVehicle    = "vehicle"
+	CollateralDeposit    = "deposit"
+	CollateralSecurities = "securities"
+	CollateralOther      = "other"
+
+	CollateralPending  = "pending" // заявка ещё не одобрена, залог не оформлен
+	CollateralPledged  = "pledged"
+	CollateralReleased = "released"
+)
+
+// ReleaseCollateral снимает залог с погашенного кредита; возвращает, сколько позиций освобождено
+func (l *Loan) ReleaseCollateral(now time.Time) int {
+	released := 0
+	l.Collateral = append([]Collateral(nil), l.Collateral...)
+	for i := range l.Collateral {
+		if l.Collateral[i].Status == CollateralPledged {
+			l.Collateral[i].Status = CollateralReleased
+			l.Collateral[i].ReleasedAt = &now
+			released++
+		}
+	}
+	return released
+}
+
+// LoanApplication — одобренная заявка на кредит с поручителем: кредит выдаётся, когда поручитель согласится,
+// под тем же ID. Условия зафиксированы при подаче, график считается от даты выдачи.
+type LoanApplication struct {
+	ID              string          `json:"id"`
+	UserID          string          `json:"user_id"`
+	AccountID       string          `json:"account_id"`
+	GuarantorUserID string          `json:"guarantor_user_id"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	InterestRate    decimal.Decimal `json:"interest_rate"`
+	TermMonths      int             `json:"term_months"`
+	CreditGrade     string          `json:"credit_grade"`
+	Collateral      []Collateral    `json:"collateral,omitempty"`
+	Status          string          `json:"status"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ExpiresAt       time.Time       `json:"expires_at"` // поручитель не ответил к сроку — заявка истекает
+	DecidedAt       *time.Time      `json:"decided_at,omitempty"`
+}
+
+const (
+	LoanApplicationPending  = "pending_guarantee"
+	LoanApplicationAccepted = "accepted" // поручитель согласился, кредит выдан
+	LoanApplicationDeclined = "declined"
+	LoanApplicationExpired  = "expired"
+)
+
+// LoanGuarantees — поручительства пользователя: заявки, ждущие его согласия, и кредиты, по которым он отвечает.
+// Liability — непогашенный долг по этим кредитам в рублях.
+type LoanGuarantees struct {
+	UserID       string            `json:"user_id"`
+	Requests     []LoanApplication `json:"requests"`     // ждут согласия пользователя как поручителя
+	Applications []LoanApplication `json:"applications"` // заявки пользователя, ждущие согласия его поручителя
+	Loans        []LoanSummary     `json:"loans"`
+	Liability    decimal.Decimal   `json:"liability"`
+	Currency     string            `json:"currency"`
+}
+
+const (
+	LoanCurrent    = "current"
+	LoanDelinquent = "delinquent" // есть просроченный платёж
+	LoanDefault    = "default"    // просрочка дольше LoanDelinquencyConfig.DefaultAfterDays
+)
+
+// Saga — журнал многошаговой операции (например, выдачи кредита). Если шаг падает, выполненные шаги
+// откатываются в обратном порядке; если не удаётся и откат, операция остаётся в статусе stuck для разбора админом.
+type Saga struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	Refs       map[string]string `json:"refs,omitempty"` // затронутые сущности: loan_id, account_id, ...
+	Status     string            `json:"status"`
+	Steps      []SagaStep        `json:"steps"`
+	Error      string            `json:"error,omitempty"`
+	Resolution string            `json:"resolution,omitempty"` // комментарий админа при ручном закрытии
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type SagaStep struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	SagaRunning     = "running"
+	SagaCompleted   = "completed"
+	SagaCompensated = "compensated" // шаг упал, выполненные шаги откатаны
+	SagaStuck       = "stuck"       // откат не удался, нужна ручная проверка
+	SagaResolved    = "resolved"    // закрыта админом вручную
+
+	SagaStepPending            = "pending"
+	SagaStepDone               = "done"
+	SagaStepFailed             = "failed"
+	SagaStepCompensated        = "compensated"
+	SagaStepCompensationFailed = "compensation_failed"
+)
+
+type ResolveSagaRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+// EODBatch — закрытие операционного дня и отчёт о нём. Шаги выполняются по порядку; выполненный шаг при повторном
+// запуске за ту же дату пропускается, поэтому перезапуск после сбоя не начисляет проценты и не списывает платежи дважды.
+type EODBatch struct {
+	Date        string                  `json:"date"` // операционный день, YYYY-MM-DD
+	Status      string                  `json:"status"`
+	Trigger     string                  `json:"trigger"`  // schedule или manual — чем запущен последний прогон
+	Attempts    int                     `json:"attempts"` // сколько раз запускался прогон за эту дату
+	Steps       []EODStep               `json:"steps"`
+	Settlements []EODMerchantSettlement `json:"settlements"`
+	StartedAt   time.Time               `json:"started_at"`
+	FinishedAt  *time.Time              `json:"finished_at,omitempty"`
+}
+
+type EODStep struct {
+	Name       string                     `json:"name"`
+	Status     string                     `json:"status"`
+	Processed  int                        `json:"processed"`
+	Skipped    int                        `json:"skipped,omitempty"` // например, платежи по кредиту без достаточного остатка
+	Failed     int                        `json:"failed,omitempty"`
+	Amounts    map[string]decimal.Decimal `json:"amounts,omitempty"` // суммы шага по валютам
+	Error      string                     `json:"error,omitempty"`
+	FinishedAt *time.Time                 `json:"finished_at,omitempty"`
+}
+
+// EODMerchantSettlement — итог мерчанта за операционный день
+type EODMerchantSettlement struct {
+	MerchantID string `json:"merchant_id"`
+	Name       string `json:"name"`
+	MerchantSettlement
+}
+
+const (
+	EODRunning   = "running"
+	EODCompleted = "completed"
+	EODFailed    = "failed" // шаг не выполнился; повторный запуск продолжит с него
+
+	EODTriggerSchedule = "schedule"
+	EODTriggerManual   = "manual"
+
+	EODStepPending = "pending"
+	EODStepDone    = "done"
+	EODStepFailed  = "failed"
+)
+
+type EODRunRequest struct {
+	Date string `json:"date"` // пусто — сегодня
+}
+
+// BalanceSnapshot — остаток счёта на конец операционного дня
+type BalanceSnapshot struct {
+	Date             string          `json:"date"`
+	AccountID        string          `json:"account_id"`
+	UserID           string          `json:"user_id"`
+	Currency         string          `json:"currency"`
+	Balance          decimal.Decimal `json:"balance"`
+	AvailableBalance decimal.Decimal `json:"available_balance"`
+	AccruedInterest  decimal.Decimal `json:"accrued_interest"`
+}
+
+// CreditScore — внутренний кредитный рейтинг клиента (300–850). Пересчитывается ежедневно и при заявке на кредит;
+// грейд определяет надбавку к ставке и максимальную сумму нового кредита.
+type CreditScore struct {
+	UserID         string              `json:"user_id"`
+	Score          int                 `json:"score"`
+	Grade          string              `json:"grade"`
+	RateAdjustment decimal.Decimal     `json:"rate_adjustment"` // п.п. к ставке кредита
+	MaxLoanAmount  decimal.Decimal     `json:"max_loan_amount"` // в рублях; ноль — кредит не выдаётся
+	Currency       string              `json:"currency"`
+	Factors        []CreditScoreFactor `json:"factors"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+// CreditScoreFactor — вклад одного фактора в рейтинг относительно базового значения
+type CreditScoreFactor struct {
+	Name   string `json:"name"`
+	Impact int    `json:"impact"`
+	Detail string `json:"detail"`
+}
+
+// CreditGrade — условия кредитования для грейда
+type CreditGrade struct {
+	Grade          string
+	MinScore       int
+	RateAdjustment decimal.Decimal
+	MaxLoanAmount  decimal.Decimal
+}
+
+// LoanView — кредит с показателями на момент AsOf, которые считаются при чтении, а не хранятся
+type LoanView struct {
+	Loan
+	AsOf              time.Time       `json:"as_of"`
+	AccruedInterest   decimal.Decimal `json:"accrued_interest"` // начислено и не уплачено: просроченные проценты и доля текущего периода
+	OverdueAmount     decimal.Decimal `json:"overdue_amount"`
+	DaysPastDue       int             `json:"days_past_due"`
+	NextPaymentDate   *time.Time      `json:"next_payment_date,omitempty"`
+	NextPaymentAmount decimal.Decimal `json:"next_payment_amount"`
+	EffectiveRate     decimal.Decimal `json:"effective_rate"` // годовая ставка с учётом ежемесячной капитализации, %
+}
+
+// LoanSummary — кредит в списке: без графика платежей, с показателями на момент запроса
+type LoanSummary struct {
+	ID                string          `json:"id"`
+	AccountID         string          `json:"account_id"`
+	Amount            decimal.Decimal `json:"amount"`
+	InterestRate      decimal.Decimal `json:"interest_rate"`
+	TermMonths        int             `json:"term_months"`
+	StartDate         time.Time       `json:"start_date"`
+	RemainingAmount   decimal.Decimal `json:"remaining_amount"`
+	Status            string          `json:"status"`
+	Active            bool            `json:"active"`
+	DaysPastDue       int             `json:"days_past_due"`
+	OverdueAmount     decimal.Decimal `json:"overdue_amount"`
+	NextPaymentDate   *time.Time      `json:"next_payment_date,omitempty"`
+	NextPaymentAmount decimal.Decimal `json:"next_payment_amount"`
+}
+
+type Payment struct {
+	DueDate       time.Time       `json:"due_date"`
+	Amount        decimal.Decimal `json:"amount"`
+	PrincipalPart decimal.Decimal `json:"principal_part"`
+	InterestPart  decimal.Decimal `json:"interest_part"`
+	Paid          bool            `json:"paid"`
+}
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Language string `json:"language"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	UserID string `json:"user_id"`
+	Code   string `json:"code"`
+}
+
+type ResendVerificationRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type CreateAccountRequest struct {
+	UserID      string `json:"user_id"`
+	ProductCode string `json:"product_code"`
+	Currency    string `json:"currency"`
+}
+
+type GenerateCardRequest struct {
+	AccountID string `json:"account_id"`
+}
+
+type BatchCardItem struct {
+	AccountID  string `json:"account_id"`
+	HolderName string `json:"holder_name"`
+}
+
+type BatchCardRequest struct {
+	Employer string          `json:"employer"`
+	Items    []BatchCardItem `json:"items"`
+}
+
+type BatchCardItemResult struct {
+	AccountID  string `json:"account_id"`
+	HolderName string `json:"holder_name"`
+	CardID     string `json:"card_id,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PaymentInstruction — один платёж из импортированного файла (pain.001 или CSV); счета указаны номерами
+type PaymentInstruction struct {
+	EndToEndID      string          `json:"end_to_end_id"`
+	DebtorAccount   string          `json:"debtor_account"`
+	CreditorAccount string          `json:"creditor_account"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	RemittanceInfo  string          `json:"remittance_info,omitempty"`
+}
+
+type PaymentResult struct {
+	PaymentInstruction
+	Status        string `json:"status"` // pending | executed | rejected
+	TransactionID string `json:"transaction_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// PaymentImportReport — отчёт о пакете платежей, результат операции payment_import
+type PaymentImportReport struct {
+	MessageID  string          `json:"message_id"`
+	Format     string          `json:"format"` // pain.001 | csv
+	Total      int             `json:"total"`
+	Executed   int             `json:"executed"`
+	Rejected   int             `json:"rejected"`
+	ControlSum decimal.Decimal `json:"control_sum"`
+	Payments   []PaymentResult `json:"payments"`
+}
+
+const (
+	PaymentPending  = "pending"
+	PaymentExecuted = "executed"
+	PaymentRejected = "rejected"
+)
+
+type UpdateDeliveryRequest struct {
+	DeliveryStatus string `json:"delivery_status"`
+}
+
+type Operation struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Status      string      `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Result      interface{} `json:"result,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationCompleted = "completed"
+	OperationFailed    = "failed"
+)
+
+type PaymentRequest struct {
+	CardNumber string          `json:"card_number"`
+	CVV        string          `json:"cvv,omitempty"`
+	Token      string          `json:"token,omitempty"`     // токен устройства вместо номера карты; CVV при этом не нужен
+	DeviceID   string          `json:"device_id,omitempty"` // устройство, к которому привязан токен
+	Amount     decimal.Decimal `json:"amount"`
+	Merchant   string          `json:"merchant"`
+	Category   string          `json:"category,omitempty"`
+	MerchantID string          `json:"merchant_id,omitempty"` // зарегистрированный мерчант; средства уходят на его расчётный счёт
+}
+
+type Hold struct {
+	ID          string          `json:"id"`
+	AccountID   string          `json:"account_id"`
+	CardID      string          `json:"card_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Merchant    string          `json:"merchant"`
+	MerchantID  string          `json:"merchant_id,omitempty"`
+	Category    string          `json:"category,omitempty"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	ClosedAt    *time.Time      `json:"closed_at,omitempty"`
+	CapturedAmt decimal.Decimal `json:"captured_amount"`
+	CaptureTxID string          `json:"capture_transaction_id,omitempty"`
+
+	Fraud *FraudAssessment `json:"fraud,omitempty"`
+}
+
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+)
+
+// PaymentChallenge — крупная оплата картой, ожидающая подтверждения владельцем кодом из письма (3-D Secure).
+// Сумма до подтверждения заблокирована холдом HoldID; проводка готовится при создании и проводится при подтверждении.
+type PaymentChallenge struct {
+	ID            string          `json:"id"`
+	UserID        string          `json:"user_id"`
+	AccountID     string          `json:"account_id"`
+	CardID        string          `json:"card_id"`
+	HoldID        string          `json:"-"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	Merchant      string          `json:"merchant"`
+	MerchantID    string          `json:"merchant_id,omitempty"`
+	Status        string          `json:"status"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+	ClosedAt      *time.Time      `json:"closed_at,omitempty"`
+	TransactionID string          `json:"transaction_id,omitempty"`
+
+	Payment  Transaction `json:"-"`
+	CodeHash string      `json:"-"`
+	Attempts int         `json:"-"`
+}
+
+const (
+	PaymentChallengePending   = "pending_confirmation"
+	PaymentChallengeConfirmed = "confirmed"
+	PaymentChallengeFailed    = "failed"
+	PaymentChallengeExpired   = "expired"
+)
+
+type PaymentConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+type CaptureRequest struct {
+	Amount decimal.Decimal `json:"amount"` // необязательно; по умолчанию вся сумма холда
+}
+
+// Receivable — долг клиента перед банком, если списание не покрыто остатком счёта
+type Receivable struct {
+	ID         string          `json:"id"`
+	UserID     string          `json:"user_id"`
+	AccountID  string          `json:"account_id"`
+	Amount     decimal.Decimal `json:"amount"`
+	Reason     string          `json:"reason"`                // deposit_reversal | custody_fee | monthly_fee | chargeback
+	SourceTxID string          `json:"source_transaction_id"` // операция, которая не была покрыта
+	CreatedAt  time.Time       `json:"created_at"`
+
+	Outstanding decimal.Decimal `json:"outstanding"` // гасится из будущих поступлений на счёт
+	Status      string          `json:"status"`
+	SettledAt   *time.Time      `json:"settled_at,omitempty"`
+}
+
+const (
+	ReceivableOpen    = "open"
+	ReceivableSettled = "settled"
+)
+
+type ReverseDepositRequest struct {
+	Reason string `json:"reason"`
+}
+
+// DepositReversal — итог отмены пополнения: списанная часть и непокрытый остаток
+type DepositReversal struct {
+	Deposit    Transaction  `json:"deposit"`
+	Reversal   *Transaction `json:"reversal,omitempty"`
+	Receivable *Receivable  `json:"receivable,omitempty"`
+}
+
+// TierLimits — лимиты клиента по уровню KYC в базовой валюте; нулевое значение — без ограничения
+type TierLimits struct {
+	DailyTransferCap decimal.Decimal `json:"daily_transfer_cap"` // переводы и оплаты картой за календарный день
+	MaxBalance       decimal.Decimal `json:"max_balance"`        // суммарный остаток на всех счетах
+}
+
+// UserLimits — лимиты уровня клиента и их текущее использование
+type UserLimits struct {
+	UserID           string          `json:"user_id"`
+	Tier             string          `json:"tier"`
+	Currency         string          `json:"currency"`
+	DailyTransferCap decimal.Decimal `json:"daily_transfer_cap"`
+	TransferredToday decimal.Decimal `json:"transferred_today"`
+	MaxBalance       decimal.Decimal `json:"max_balance"`
+	TotalBalance     decimal.Decimal `json:"total_balance"`
+}
+
+// LimitOverride — временное повышение дневного лимита переводов по заявке клиента, действует после одобрения админом
+type LimitOverride struct {
+	ID           string          `json:"id"`
+	UserID       string          `json:"user_id"`
+	AccountID    string          `json:"account_id"`
+	Limit        decimal.Decimal `json:"limit"` // новый дневной лимит на время действия
+	Duration     time.Duration   `json:"duration"`
+	Reason       string          `json:"reason"`
+	Status       string          `json:"status"`
+	RequestedAt  time.Time       `json:"requested_at"`
+	DecidedAt    *time.Time      `json:"decided_at,omitempty"`
+	DecisionNote string          `json:"decision_note,omitempty"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"` // выставляется при одобрении
+}
+
+const (
+	LimitOverridePending  = "pending"
+	LimitOverrideApproved = "approved"
+	LimitOverrideRejected = "rejected"
+)
+
+func (o LimitOverride) ActiveAt(now time.Time) bool {
+	return o.Status == LimitOverrideApproved && o.ExpiresAt != nil && now.Before(*o.ExpiresAt)
+}
+
+type LimitOverrideRequest struct {
+	Limit         decimal.Decimal `json:"limit"`
+	DurationHours int             `json:"duration_hours"`
+	Reason        string          `json:"reason"`
+}
+
+// LimitOverrideDecision — решение админа; при одобрении можно урезать лимит и срок относительно заявки
+type LimitOverrideDecision struct {
+	Limit         decimal.Decimal `json:"limit"`
+	DurationHours int             `json:"duration_hours"`
+	Note          string          `json:"note"`
+}
+
+// Broadcast — рассылка объявления админом; письма уходят из очереди получателей с ограничением скорости
+type Broadcast struct {
+	ID          string            `json:"id"`
+	Template    string            `json:"template"`
+	Params      map[string]string `json:"params,omitempty"`
+	Subject     string            `json:"subject,omitempty"` // только для шаблона custom
+	Body        string            `json:"body,omitempty"`
+	Audience    BroadcastAudience `json:"audience"`
+	CreatedBy   string            `json:"created_by"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Status      string            `json:"status"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	Total       int               `json:"total"`
+	Sent        int               `json:"sent"`
+	Failed      int               `json:"failed"`
+	Skipped     int               `json:"skipped"`
+}
+
+const (
+	BroadcastQueued    = "queued"
+	BroadcastSending   = "sending"
+	BroadcastCompleted = "completed"
+)
+
+// BroadcastAudience — фильтр получателей; пустой фильтр означает всех пользователей
+type BroadcastAudience struct {
+	Products []string `json:"products,omitempty"` // владельцы хотя бы одного открытого счёта этих продуктов
+	Language string   `json:"language,omitempty"`
+}
+
+type BroadcastRecipient struct {
+	BroadcastID string     `json:"broadcast_id"`
+	UserID      string     `json:"user_id"`
+	Email       string     `json:"email"`
+	Language    string     `json:"language"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+
+	NextAttemptAt time.Time `json:"-"` // повтор после неудачной отправки
+}
+
+const (
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	RecipientFailed  = "failed"
+	RecipientSkipped = "skipped" // email не подтверждён
+)
+
+type CreateBroadcastRequest struct {
+	Template string            `json:"template"`
+	Params   map[string]string `json:"params"`
+	Subject  string            `json:"subject"`
+	Body     string            `json:"body"`
+	Audience BroadcastAudience `json:"audience"`
+}
+
+// BackdatedTransactionRequest — перенос исторической операции админом при миграции из другой системы
+type BackdatedTransactionRequest struct {
+	Type          string          `json:"type"` // deposit | withdrawal | transfer | payment
+	FromAccountID string          `json:"from_account_id,omitempty"`
+	ToAccountID   string          `json:"to_account_id,omitempty"`
+	Amount        decimal.Decimal `json:"amount"`
+	ValueDate     time.Time       `json:"value_date"`
+	Description   string          `json:"description"`
+	Merchant      string          `json:"merchant,omitempty"`
+	Category      string          `json:"category,omitempty"`
+	ExternalRef   string          `json:"external_ref"`
+	Reason        string          `json:"reason"`
+}
+
+// CSVImportMapping описывает, в каких колонках выписки другого банка лежат поля операции. Колонки задаются
+// по названию из строки заголовка. Сумма — либо одной колонкой со знаком (минус — списание), либо парой
+// колонок debit/credit.
+type CSVImportMapping struct {
+	Delimiter    string `json:"delimiter,omitempty"`   // по умолчанию ","
+	DateFormat   string `json:"date_format,omitempty"` // раскладка Go, по умолчанию 2006-01-02
+	Date         string `json:"date"`
+	Amount       string `json:"amount,omitempty"`
+	Debit        string `json:"debit,omitempty"`
+	Credit       string `json:"credit,omitempty"`
+	Currency     string `json:"currency,omitempty"` // если задана, должна совпадать с валютой счёта
+	Description  string `json:"description,omitempty"`
+	Counterparty string `json:"counterparty,omitempty"`
+	Category     string `json:"category,omitempty"`
+	ExternalRef  string `json:"external_ref"`
+}
+
+type ImportTransactionsRequest struct {
+	Source  string           `json:"source"`
+	CSV     string           `json:"csv"`
+	Mapping CSVImportMapping `json:"mapping"`
+}
+
+// TransactionImportRow — итог по строке выписки, которая не была загружена
+type TransactionImportRow struct {
+	Line        int    `json:"line"`
+	ExternalRef string `json:"external_ref,omitempty"`
+	Status      string `json:"status"` // duplicate | rejected
+	Error       string `json:"error,omitempty"`
+}
+
+// TransactionImportReport — результат загрузки выписки: сколько операций добавлено и какие строки пропущены
+type TransactionImportReport struct {
+	ImportID   string                 `json:"import_id"`
+	AccountID  string                 `json:"account_id"`
+	Total      int                    `json:"total"`
+	Imported   int                    `json:"imported"`
+	Duplicates int                    `json:"duplicates"`
+	Rejected   int                    `json:"rejected"`
+	Skipped    []TransactionImportRow `json:"skipped,omitempty"`
+}
+
+const (
+	ImportRowDuplicate = "duplicate"
+	ImportRowRejected  = "rejected"
+)
+
+type RefundRequest struct {
+	Amount decimal.Decimal `json:"amount"` // необязательно; по умолчанию остаток платежа
+	Reason string          `json:"reason"`
+}
+
+type ParentalControl struct {
+	AccountID           string          `json:"account_id"`
+	DailySpendLimit     decimal.Decimal `json:"daily_spend_limit"`     // 0 — без лимита
+	PerTransactionLimit decimal.Decimal `json:"per_transaction_limit"` // 0 — без лимита
+	BlockedCategories   []string        `json:"blocked_categories"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+}
+
+type CreateDependentRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type DependentDashboard struct {
+	Child              User                       `json:"child"`
+	Accounts           []Account                  `json:"accounts"`
+	Controls           []ParentalControl          `json:"controls"`
+	SpentToday         decimal.Decimal            `json:"spent_today"`
+	SpentThisMonth     decimal.Decimal            `json:"spent_this_month"`
+	SpendingByCategory map[string]decimal.Decimal `json:"spending_by_category"`
+	RecentTransactions []Transaction              `json:"recent_transactions"`
+}
+
+type TransferRequest struct {
+	FromAccountID   string          `json:"from_account_id"`
+	ToAccountID     string          `json:"to_account_id"`
+	ToAccountNumber string          `json:"to_account_number,omitempty"`
+	Amount          decimal.Decimal `json:"amount"`
+}
+
+// Alias — запись справочника получателей: телефон или логин -> счёт для входящих P2P-переводов
+type Alias struct {
+	Type      string    `json:"type"`
+	Value     string    `json:"value"` // нормализованное значение: +79161234567, ivan
+	UserID    string    `json:"user_id"`
+	AccountID string    `json:"account_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	AliasPhone    = "phone"
+	AliasUsername = "username"
+)
+
+func (a Alias) Key() string { return a.Type + ":" + a.Value }
+
+type AliasRequest struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	AccountID string `json:"account_id"` // необязательно; по умолчанию основной рублёвый счёт
+}
+
+// P2PTransferRequest — перевод по телефону (+7...) или логину (@ivan). Без confirmation_token
+// возвращается получатель для подтверждения, с токеном — перевод выполняется.
+type P2PTransferRequest struct {
+	FromAccountID     string          `json:"from_account_id"`
+	To                string          `json:"to"`
+	Amount            decimal.Decimal `json:"amount"`
+	ConfirmationToken string          `json:"confirmation_token,omitempty"`
+}
+
+type P2PConfirmation struct {
+	Alias             string          `json:"alias"`
+	DisplayName       string          `json:"display_name"`
+	Currency          string          `json:"currency"`
+	Amount            decimal.Decimal `json:"amount"`
+	ConfirmationToken string          `json:"confirmation_token"`
+	ExpiresAt         time.Time       `json:"expires_at"`
+}
+
+// Invoice — счёт на оплату, выставленный владельцем счёта. Ссылку /invoices/{id} можно передать
+// плательщику; оплата переводит Amount на AccountID, оплатить счёт можно только один раз.
+type Invoice struct {
+	ID             string          `json:"id"`
+	IssuerUserID   string          `json:"issuer_user_id"`
+	AccountID      string          `json:"account_id"` // счёт зачисления
+	Amount         decimal.Decimal `json:"amount"`
+	Currency       string          `json:"currency"`
+	Description    string          `json:"description"`
+	Status         string          `json:"status"`
+	PaymentLink    string          `json:"payment_link"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	PaidAt         *time.Time      `json:"paid_at,omitempty"`
+	PayerAccountID string          `json:"payer_account_id,omitempty"`
+	TransactionID  string          `json:"transaction_id,omitempty"`
+	CancelledAt    *time.Time      `json:"cancelled_at,omitempty"`
+}
+
+const (
+	InvoiceOpen      = "open"
+	InvoicePaid      = "paid"
+	InvoiceExpired   = "expired" // не хранится: открытый счёт после ExpiresAt
+	InvoiceCancelled = "cancelled"
+)
+
+// StatusAt — статус с учётом срока: неоплаченный счёт после ExpiresAt считается просроченным
+func (inv Invoice) StatusAt(now time.Time) string {
+	if inv.Status == InvoiceOpen && !now.Before(inv.ExpiresAt) {
+		return InvoiceExpired
+	}
+	return inv.Status
+}
+
+type CreateInvoiceRequest struct {
+	AccountID      string          `json:"account_id"`
+	Amount         decimal.Decimal `json:"amount"`
+	Description    string          `json:"description"`
+	ExpiresAt      *time.Time      `json:"expires_at,omitempty"`       // по умолчанию через InvoiceConfig.DefaultTTL
+	ExpiresInHours int             `json:"expires_in_hours,omitempty"` // альтернатива expires_at
+}
+
+type PayInvoiceRequest struct {
+	FromAccountID string `json:"from_account_id"`
+}
+
+// InvoiceView — то, что видит плательщик по ссылке: без счетов и идентификаторов выставившего
+type InvoiceView struct {
+	ID          string          `json:"id"`
+	PayeeName   string          `json:"payee_name"`
+	Amount      decimal.Decimal `json:"amount"`
+	Currency    string          `json:"currency"`
+	Description string          `json:"description"`
+	Status      string          `json:"status"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// MoneyRequest — запрос денег у другого пользователя. Плательщик видит его среди входящих и может принять
+// (перевод Amount со своего счёта на AccountID) или отклонить; запрос исполняется не больше одного раза.
+type MoneyRequest struct {
+	ID              string          `json:"id"`
+	RequesterUserID string          `json:"requester_user_id"`
+	RequesterName   string          `json:"requester_name"`
+	AccountID       string          `json:"account_id"` // счёт зачисления
+	PayerUserID     string          `json:"payer_user_id"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	Description     string          `json:"description"`
+	Status          string          `json:"status"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+	CreatedAt       time.Time       `json:"created_at"`
+	DecidedAt       *time.Time      `json:"decided_at,omitempty"`
+	DeclineReason   string          `json:"decline_reason,omitempty"`
+	PayerAccountID  string          `json:"payer_account_id,omitempty"`
+	TransactionID   string          `json:"transaction_id,omitempty"`
+}
+
+const (
+	MoneyRequestPending   = "pending"
+	MoneyRequestAccepted  = "accepted"
+	MoneyRequestDeclined  = "declined"
+	MoneyRequestCancelled = "cancelled"
+	MoneyRequestExpired   = "expired" // не хранится: ожидающий запрос после ExpiresAt
+)
+
+// StatusAt — статус с учётом срока: неотвеченный запрос после ExpiresAt считается просроченным
+func (pr MoneyRequest) StatusAt(now time.Time) string {
+	if pr.Status == MoneyRequestPending && !now.Before(pr.ExpiresAt) {
+		return MoneyRequestExpired
+	}
+	return pr.Status
+}
+
+type CreateMoneyRequestRequest struct {
+	AccountID      string          `json:"account_id"`
+	Payer          string          `json:"payer"` // телефон или логин плательщика, как в /transfers/p2p
+	Amount         decimal.Decimal `json:"amount"`
+	Description    string          `json:"description"`
+	ExpiresInHours int             `json:"expires_in_hours,omitempty"` // по умолчанию PaymentRequestConfig.DefaultTTL
+}
+
+type AcceptMoneyRequestRequest struct {
+	FromAccountID string `json:"from_account_id"`
+}
+
+type DeclineMoneyRequestRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Escrow — безопасная сделка: деньги покупателя лежат на системном счёте эскроу, пока продавец не исполнит
+// обязательство и покупатель не подтвердит получение. Все движения — связанные проводки (LinkedTxID = FundTxID).
+type Escrow struct {
+	ID              string          `json:"id"`
+	BuyerUserID     string          `json:"buyer_user_id"`
+	BuyerAccountID  string          `json:"buyer_account_id"`
+	SellerUserID    string          `json:"seller_user_id"`
+	SellerAccountID string          `json:"seller_account_id"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	Description     string          `json:"description"`
+	Status          string          `json:"status"`
+	FundTxID        string          `json:"fund_transaction_id"`
+	SettleTxID      string          `json:"settle_transaction_id,omitempty"` // выплата продавцу или возврат покупателю
+	FulfillBy       time.Time       `json:"fulfill_by"`                      // не исполнено к сроку — деньги возвращаются покупателю
+	ReleaseBy       *time.Time      `json:"release_by,omitempty"`            // покупатель молчит после исполнения — деньги уходят продавцу
+	FulfilledAt     *time.Time      `json:"fulfilled_at,omitempty"`
+	DisputeReason   string          `json:"dispute_reason,omitempty"`
+	DisputedAt      *time.Time      `json:"disputed_at,omitempty"`
+	Resolution      string          `json:"resolution,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ClosedAt        *time.Time      `json:"closed_at,omitempty"`
+}
+
+const (
+	EscrowFunded    = "funded"
+	EscrowFulfilled = "fulfilled"
+	EscrowDisputed  = "disputed"
+	EscrowReleased  = "released" // деньги у продавца
+	EscrowRefunded  = "refunded" // деньги вернулись покупателю
+)
+
+func (e Escrow) IsClosed() bool {
+	return e.Status == EscrowReleased || e.Status == EscrowRefunded
+}
+
+type CreateEscrowRequest struct {
+	BuyerAccountID     string          `json:"buyer_account_id"`
+	SellerAccountID    string          `json:"seller_account_id"`
+	Amount             decimal.Decimal `json:"amount"`
+	Description        string          `json:"description"`
+	FulfillWithinHours int             `json:"fulfill_within_hours,omitempty"` // по умолчанию EscrowConfig.FulfillTimeout
+}
+
+type EscrowDisputeRequest struct {
+	Reason string `json:"reason"`
+}
+
+type EscrowDecisionRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+type AccountLookup struct {
+	AccountID  string `json:"account_id"`
+	Number     string `json:"number"`
+	Currency   string `json:"currency"`
+	HolderName string `json:"holder_name"`
+}
+
+type DepositRequest struct {
+	ToAccountID string          `json:"to_account_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	ValueDate   *time.Time      `json:"value_date,omitempty"` // для входящих внешних переводов, зачисленных с опозданием
+}
+
+type ExchangeRequest struct {
+	FromAccountID string          `json:"from_account_id"`
+	ToAccountID   string          `json:"to_account_id"`
+	Amount        decimal.Decimal `json:"amount"`
+}
+
+type ExchangeQuote struct {
+	FromCurrency   string          `json:"from_currency"`
+	ToCurrency     string          `json:"to_currency"`
+	Rate           decimal.Decimal `json:"rate"`
+	SpreadPercent  decimal.Decimal `json:"spread_percent"`
+	DebitedAmount  decimal.Decimal `json:"debited_amount"`
+	CreditedAmount decimal.Decimal `json:"credited_amount"`
+	OutTransaction Transaction     `json:"out_transaction"`
+	InTransaction  Transaction     `json:"in_transaction"`
+}
+
+// ExternalBankLink — подключение пользователя к другому банку через коннектор агрегации. По нему фоновая
+// синхронизация подтягивает счета и операции; Credentials — токен доступа к банку-источнику, наружу не отдаётся.
+type ExternalBankLink struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Connector   string     `json:"connector"`
+	BankName    string     `json:"bank_name"`
+	Credentials string     `json:"-"`
+	Status      string     `json:"status"` // active | failed
+	LastSyncAt  *time.Time `json:"last_sync_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const (
+	BankLinkActive = "active"
+	BankLinkFailed = "failed"
+)
+
+type LinkBankRequest struct {
+	Connector   string `json:"connector"`
+	Credentials string `json:"credentials"`
+}
+
+// ExternalAccount — счёт в другом банке, только для просмотра: остаток обновляет синхронизация, операций
+// по нему банк не проводит
+type ExternalAccount struct {
+	ID               string          `json:"id"`
+	LinkID           string          `json:"link_id"`
+	UserID           string          `json:"user_id"`
+	BankName         string          `json:"bank_name"`
+	ExternalID       string          `json:"external_id"` // идентификатор счёта у банка-источника
+	Name             string          `json:"name"`
+	MaskedNumber     string          `json:"masked_number,omitempty"`
+	Currency         string          `json:"currency"`
+	Balance          decimal.Decimal `json:"balance"`
+	AvailableBalance decimal.Decimal `json:"available_balance"`
+	ReadOnly         bool            `json:"read_only"`
+	SyncedAt         time.Time       `json:"synced_at"`
+}
+
+// ExternalTransaction — операция по внешнему счёту; ExternalID уникален в пределах счёта
+type ExternalTransaction struct {
+	ID           string          `json:"id"`
+	AccountID    string          `json:"account_id"`
+	ExternalID   string          `json:"external_id"`
+	Amount       decimal.Decimal `json:"amount"`
+	Direction    string          `json:"direction"` // credit | debit
+	Description  string          `json:"description,omitempty"`
+	Counterparty string          `json:"counterparty,omitempty"`
+	BookedAt     time.Time       `json:"booked_at"`
+}
+
+type FXSweepRule struct {
+	UserID          string          `json:"user_id"`
+	TargetAccountID string          `json:"target_account_id"`
+	Threshold       decimal.Decimal `json:"threshold"`
+	Enabled         bool            `json:"enabled"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+type FXSweepRuleRequest struct {
+	TargetAccountID string          `json:"target_account_id"`
+	Threshold       decimal.Decimal `json:"threshold"`
+	Enabled         bool            `json:"enabled"`
+}
+
+// AutoTransferRule — правило автоперевода между своими счетами в одной валюте. Правило проверяется после каждой
+// транзакции по наблюдаемому счёту: у sweep это источник (излишек над Threshold уходит на TargetAccountID),
+// у top_up — получатель (при остатке ниже Threshold он пополняется с SourceAccountID до TopUpTo).
+type AutoTransferRule struct {
+	ID                string          `json:"id"`
+	UserID            string          `json:"user_id"`
+	Kind              string          `json:"kind"`
+	SourceAccountID   string          `json:"source_account_id"`
+	TargetAccountID   string          `json:"target_account_id"`
+	Threshold         decimal.Decimal `json:"threshold"`
+	TopUpTo           decimal.Decimal `json:"top_up_to,omitempty"` // только top_up; ноль — до Threshold
+	Enabled           bool            `json:"enabled"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	LastTriggeredAt   *time.Time      `json:"last_triggered_at,omitempty"`
+	LastTransactionID string          `json:"last_transaction_id,omitempty"`
+	LastError         string          `json:"last_error,omitempty"`
+}
+
+const (
+	AutoTransferSweep = "sweep"
+	AutoTransferTopUp = "top_up"
+)
+
+// WatchedAccountID — счёт, изменение которого запускает проверку правила
+func (r AutoTransferRule) WatchedAccountID() string {
+	if r.Kind == AutoTransferTopUp {
+		return r.TargetAccountID
+	}
+	return r.SourceAccountID
+}
+
+type AutoTransferRuleRequest struct {
+	Kind            string          `json:"kind"`
+	SourceAccountID string          `json:"source_account_id"`
+	TargetAccountID string          `json:"target_account_id"`
+	Threshold       decimal.Decimal `json:"threshold"`
+	TopUpTo         decimal.Decimal `json:"top_up_to"`
+	Enabled         *bool           `json:"enabled,omitempty"`
+}
+
+const (
+	AlertBalanceBelow     = "balance_below"     // остаток опустился ниже Threshold
+	AlertTransactionAbove = "transaction_above" // операция по счёту больше Threshold
+	AlertForeignCurrency  = "foreign_currency"  // операция в валюте, отличной от рубля
+	AlertRecurringPrice   = "recurring_price"   // регулярный платёж подорожал больше чем на Threshold процентов
+
+	AlertChannelEmail = "email"
+	AlertChannelPush  = "push" // событие account.alert в WebSocket, SSE и вебхуки пользователя
+)
+
+// AlertRule — оповещение по счёту, проверяется после каждой транзакции по нему. Threshold — в валюте счёта,
+// у recurring_price — в процентах.
+// balance_below срабатывает один раз при переходе остатка через порог и снова — только после того, как остаток
+// вернётся к порогу или выше.
+type AlertRule struct {
+	ID                string          `json:"id"`
+	AccountID         string          `json:"account_id"`
+	UserID            string          `json:"user_id"`
+	Type              string          `json:"type"`
+	Threshold         decimal.Decimal `json:"threshold"`
+	Channels          []string        `json:"channels"`
+	Enabled           bool            `json:"enabled"`
+	Below             bool            `json:"below,omitempty"` // только balance_below: остаток сейчас ниже порога
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	LastTriggeredAt   *time.Time      `json:"last_triggered_at,omitempty"`
+	LastTransactionID string          `json:"last_transaction_id,omitempty"`
+}
+
+type AlertRuleRequest struct {
+	Type      string          `json:"type"`
+	Threshold decimal.Decimal `json:"threshold"`
+	Channels  []string        `json:"channels,omitempty"`
+	Enabled   *bool           `json:"enabled,omitempty"`
+}
+
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// UserSettings — пользовательские настройки уведомлений; дайджест по умолчанию выключен
+type UserSettings struct {
+	UserID           string     `json:"user_id"`
+	DigestFrequency  string     `json:"digest_frequency"`
+	DigestLastSentAt *time.Time `json:"digest_last_sent_at,omitempty"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+type UserSettingsRequest struct {
+	DigestFrequency string `json:"digest_frequency"`
+}
+
+// Digest — сводка по счетам пользователя за период [From, To]
+type Digest struct {
+	UserID          string              `json:"user_id"`
+	Frequency       string              `json:"frequency"`
+	From            time.Time           `json:"from"`
+	To              time.Time           `json:"to"`
+	Accounts        []DigestAccount     `json:"accounts"`
+	TopTransactions []Transaction       `json:"top_transactions"`
+	UpcomingLoans   []DigestLoanPayment `json:"upcoming_loan_payments"`
+}
+
+type DigestAccount struct {
+	AccountID      string          `json:"account_id"`
+	Number         string          `json:"number"`
+	Currency       string          `json:"currency"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	Change         decimal.Decimal `json:"change"`
+}
+
+type DigestLoanPayment struct {
+	LoanID  string          `json:"loan_id"`
+	DueDate time.Time       `json:"due_date"`
+	Amount  decimal.Decimal `json:"amount"`
+}
+
+const (
+	RateKindKeyRate = "key_rate"
+	RateKindFX      = "fx"
+)
+
+// BankOverview — сводка по банку для админской панели; суммы в рублях по курсу ЦБ, разбивка — в валютах счетов
+type BankOverview struct {
+	GeneratedAt  time.Time          `json:"generated_at"`
+	Currency     string             `json:"currency"`
+	Users        int                `json:"users"`
+	Accounts     int                `json:"accounts"`
+	Deposits     OverviewAmount     `json:"deposits"`
+	Loans        OverviewLoans      `json:"loans"`
+	Today        OverviewDay        `json:"today"`
+	TopMerchants []OverviewMerchant `json:"top_merchants"`
+	MerchantDays int                `json:"top_merchants_days"` // за сколько дней считается рейтинг мерчантов
+}
+
+type OverviewAmount struct {
+	Total      decimal.Decimal            `json:"total"`
+	ByCurrency map[string]decimal.Decimal `json:"by_currency"`
+}
+
+type OverviewLoans struct {
+	Outstanding int            `json:"outstanding"`
+	Principal   OverviewAmount `json:"principal"`
+}
+
+type OverviewDay struct {
+	Date         string         `json:"date"`
+	Transactions int            `json:"transactions"`
+	Volume       OverviewAmount `json:"volume"`
+}
+
+type OverviewMerchant struct {
+	MerchantID string          `json:"merchant_id,omitempty"`
+	Name       string          `json:"name"`
+	Payments   int             `json:"payments"`
+	Volume     decimal.Decimal `json:"volume"`
+}
+
+// ReconciliationReport — сверка остатков счетов с журналом: остаток каждого счёта пересчитывается из проводок
+// и сравнивается с хранимым Balance. Расхождение означает запись остатка без проводки или проводку без движения денег.
+type ReconciliationReport struct {
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Accounts      int                  `json:"accounts"`     // проверено счетов
+	Transactions  int                  `json:"transactions"` // проводок в журнале
+	Consistent    bool                 `json:"consistent"`
+	Discrepancies []BalanceDiscrepancy `json:"discrepancies"`
+}
+
+type BalanceDiscrepancy struct {
+	AccountID     string          `json:"account_id"`
+	UserID        string          `json:"user_id"`
+	Number        string          `json:"number"`
+	Currency      string          `json:"currency"`
+	StoredBalance decimal.Decimal `json:"stored_balance"`
+	LedgerBalance decimal.Decimal `json:"ledger_balance"`
+	Difference    decimal.Decimal `json:"difference"` // stored_balance − ledger_balance
+	Credits       decimal.Decimal `json:"credits"`
+	Debits        decimal.Decimal `json:"debits"`
+	Transactions  int             `json:"transactions"`
+}
+
+// RateSnapshot — значение ставки на дату: курс валюты в рублях за единицу или ключевая ставка
+type RateSnapshot struct {
+	Kind      string          `json:"kind"`
+	Currency  string          `json:"currency,omitempty"`
+	Date      string          `json:"date"` // YYYY-MM-DD, на которую источник установил значение
+	Rate      decimal.Decimal `json:"rate"`
+	Source    string          `json:"source,omitempty"` // cbr, ecb или static
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+// RateOverride — заранее заданное значение ставки ЦБ в песочнице, действующее с EffectiveFrom до следующего override
+type RateOverride struct {
+	ID            string          `json:"id"`
+	Kind          string          `json:"kind"`
+	Currency      string          `json:"currency,omitempty"`
+	Rate          decimal.Decimal `json:"rate"`
+	EffectiveFrom time.Time       `json:"effective_from"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type RateOverrideRequest struct {
+	Kind          string          `json:"kind"`
+	Currency      string          `json:"currency"`
+	Rate          decimal.Decimal `json:"rate"`
+	EffectiveFrom time.Time       `json:"effective_from"`
+}
+
+// SeedRequest — параметры POST /dev/seed; незаданные поля берутся по умолчанию, seed 0 — случайный
+type SeedRequest struct {
+	Users        int   `json:"users"`
+	Cards        int   `json:"cards_per_account"`
+	Transactions int   `json:"transactions"`
+	Days         int   `json:"days"`
+	Seed         int64 `json:"seed"`
+}
+
+type ApplyLoanRequest struct {
+	UserID          string              `json:"user_id"`
+	AccountID       string              `json:"account_id"`
+	Amount          decimal.Decimal     `json:"amount"`
+	TermMonths      int                 `json:"term_months"`
+	GuarantorUserID string              `json:"guarantor_user_id,omitempty"`
+	Collateral      []CollateralRequest `json:"collateral,omitempty"`
+}
+
+type CollateralRequest struct {
+	AssetType     string          `json:"asset_type"`
+	Description   string          `json:"description"`
+	DeclaredValue decimal.Decimal `json:"declared_value"`
+}
+
+type LoanHolidayRequest struct {
+	Months int    `json:"months"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (h Webhook) Accepts(eventType string) bool {
+	for _, t := range h.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Типы операций, которыми банк управляет глобально: выключатель на время инцидента и дневной лимит объёма
+const (
+	OpTransfer       = "transfer"
+	OpP2PTransfer    = "p2p_transfer"
+	OpBatchPayment   = "batch_payment"
+	OpCardPayment    = "card_payment"
+	OpDeposit        = "deposit"
+	OpExchange       = "exchange"
+	OpInvoicePayment = "invoice_payment"
+	OpEscrow         = "escrow"
+	OpLoan           = "loan"
+)
+
+// OperationControl — настройки банка для типа операции. DailyCap — суммарный объём операций этого типа
+// по всем клиентам за календарный день в рублях; ноль — без ограничения.
+type OperationControl struct {
+	Type      string          `json:"type"`
+	Disabled  bool            `json:"disabled"`
+	Reason    string          `json:"reason,omitempty"`
+	DailyCap  decimal.Decimal `json:"daily_cap"`
+	UpdatedAt time.Time       `json:"updated_at,omitempty"`
+}
+
+// OperationControlView — настройки типа операции вместе с объёмом, набранным за сегодня
+type OperationControlView struct {
+	OperationControl
+	Currency  string          `json:"currency"`
+	UsedToday decimal.Decimal `json:"used_today"`
+}
+
+// OperationControlRequest — частичное изменение настроек: не переданные поля остаются прежними
+type OperationControlRequest struct {
+	Disabled *bool            `json:"disabled"`
+	Reason   *string          `json:"reason"`
+	DailyCap *decimal.Decimal `json:"daily_cap"`
+}
+
+// CardToken — токен карты для оплаты с устройства клиента вместо номера карты. Токен привязан к устройству:
+// оплата принимается, только если передан тот же device_id. Хранится хеш токена, сам токен показывается один раз.
+type CardToken struct {
+	ID         string     `json:"id"`
+	CardID     string     `json:"card_id"`
+	UserID     string     `json:"user_id"`
+	DeviceID   string     `json:"device_id"`
+	DeviceName string     `json:"device_name,omitempty"`
+	Last4      string     `json:"last4"` // последние символы токена, чтобы клиент отличал токены в списке
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	TokenHash string `json:"-"`
+}
+
+const (
+	CardTokenActive    = "active"
+	CardTokenSuspended = "suspended"
+	CardTokenDeleted   = "deleted"
+)
+
+type CardTokenRequest struct {
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+}
+
+// DeviceKey — открытый ключ устройства клиента для подписи крупных переводов. Закрытый ключ не покидает устройство,
+// поэтому подпись доказывает, что перевод подтвердил именно владелец устройства.
+type DeviceKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Algorithm  string     `json:"algorithm"`
+	PublicKey  string     `json:"public_key"` // base64 DER SubjectPublicKeyInfo
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+const (
+	DeviceKeyEd25519   = "ed25519"
+	DeviceKeyECDSAP256 = "ecdsa-p256"
+)
+
+func (k DeviceKey) Active() bool {
+	return k.RevokedAt == nil
+}
+
+type DeviceKeyRequest struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"` // base64 DER или PEM
+}
+
+// DeviceSignature — подпись перевода из заголовков X-Device-Key-Id, X-Device-Timestamp, X-Device-Signature
+type DeviceSignature struct {
+	KeyID     string
+	Timestamp string
+	Signature string // base64
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ProductChecking        = "checking"
+	ProductSavings         = "savings"
+	ProductForeignCurrency = "foreign_currency"
+	ProductBusiness        = "business"
+
+	DefaultProductCode = ProductChecking
+	BaseCurrency       = "RUB"
+)
+
+var productCatalog = map[string]Product{
+	ProductChecking: {
+		Code:               ProductChecking,
+		Name:               "Текущий счёт",
+		Currencies:         []string{"RUB"},
+		InterestRate:       decimal.Zero,
+		MonthlyFee:         decimal.Zero,
+		DailyTransferLimit: decimal.NewFromInt(1000000),
+		MaxPerUser:         5,
+	},
+	ProductSavings: {
+		Code:               ProductSavings,
+		Name:               "Накопительный счёт",
+		Currencies:         []string{"RUB"},
+		InterestRate:       decimal.NewFromInt(12),
+		MonthlyFee:         decimal.Zero,
+		DailyTransferLimit: decimal.NewFromInt(300000),
+		MaxPerUser:         3,
+		RequiresProduct:    ProductChecking,
+	},
+	ProductForeignCurrency: {
+		Code:               ProductForeignCurrency,
+		Name:               "Валютный счёт",
+		Currencies:         []string{"USD", "EUR", "CNY"},
+		InterestRate:       decimal.Zero,
+		MonthlyFee:         decimal.NewFromInt(99),
+		DailyTransferLimit: decimal.NewFromInt(10000),
+		MaxPerUser:         3,
+		RequiresProduct:    ProductChecking,
+		CustodyFees: map[string]CustodyFee{
+			"EUR": {AnnualRate: decimal.NewFromFloat(1.5), FreeBalance: decimal.NewFromInt(10000)},
+		},
+	},
+	ProductBusiness: {
+		Code:               ProductBusiness,
+		Name:               "Расчётный счёт",
+		Currencies:         []string{"RUB", "USD", "EUR", "CNY"},
+		InterestRate:       decimal.Zero,
+		MonthlyFee:         decimal.NewFromInt(490),
+		DailyTransferLimit: decimal.NewFromInt(10000000),
+		MaxPerUser:         10, // на организацию
+		Business:           true,
+	},
+}
+
+func GetProduct(code string) (Product, bool) {
+	product, ok := productCatalog[code]
+	return product, ok
+}
+
+func ListProducts() []Product {
+	products := make([]Product, 0, len(productCatalog))
+	for _, p := range productCatalog {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Code < products[j].Code })
+	return products
+}
+
+func (p Product) CustodyFeeFor(currency string) CustodyFee {
+	if fee, ok := p.CustodyFees[currency]; ok {
+		return fee
+	}
+	return CustodyFee{AnnualRate: decimal.Zero, FreeBalance: decimal.Zero}
+}
+
+func (p Product) SupportsCurrency(currency string) bool {
+	for _, c := range p.Currencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckProductEligibility проверяет, может ли пользователь с текущим набором счетов открыть продукт
+func CheckProductEligibility(product Product, currency string, existing []Account) error {
+	if !product.SupportsCurrency(currency) {
+		return fmt.Errorf("product %s is not available in currency %s", product.Code, currency)
+	}
+
+	sameProduct := 0
+	hasRequired := product.RequiresProduct == ""
+	for _, acc := range existing {
+		if acc.ProductCode == product.Code {
+			sameProduct++
+		}
+		if acc.ProductCode == product.RequiresProduct {
+			hasRequired = true
+		}
+	}
+	if product.MaxPerUser > 0 && sameProduct >= product.MaxPerUser {
+		return fmt.Errorf("user already has the maximum of %d %s accounts", product.MaxPerUser, product.Code)
+	}
+	if !hasRequired {
+		return fmt.Errorf("product %s requires an open %s account", product.Code, product.RequiresProduct)
+	}
+	return nil
+}
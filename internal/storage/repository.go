@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Repository — контракт хранилища для сервисного слоя; InMemoryStorage — его реализация.
+// Все методы принимают контекст: изменяющие операции не начинаются, если он уже отменён.
+type Repository interface {
+	// Поколения коллекций и агрегаты
+	Generation(ctx context.Context, collection string) uint64
+	Generations(ctx context.Context) map[string]uint64
+	GetUserSummary(ctx context.Context, userID string) UserSummary
+	ReconcileUserSummaries(ctx context.Context) []string
+	BankStats(ctx context.Context, dayStart, merchantsSince time.Time) BankStats
+	LedgerBalances(ctx context.Context) ([]Account, map[string]LedgerTotals, int)
+
+	// Пользователи
+	AddUser(ctx context.Context, user User) error
+	GetUserByUsername(ctx context.Context, username string) (User, bool)
+	GetUserByEmail(ctx context.Context, email string) (User, bool)
+	GetUser(ctx context.Context, userID string) (User, bool)
+	VerifyUserEmail(ctx context.Context, userID, code string, maxAttempts int, now time.Time) error
+	UpdateUserPassword(ctx context.Context, userID, passwordHash string) error
+	UpdateUser(ctx context.Context, userID string, update func(*User) error) (User, error)
+	GetDependents(ctx context.Context, parentID string) []User
+	ListUsers(ctx context.Context) []User
+	SetAlias(ctx context.Context, alias Alias) (Alias, error)
+	GetAlias(ctx context.Context, aliasType, value string) (Alias, bool)
+	GetUserAliases(ctx context.Context, userID string) []Alias
+	DeleteAlias(ctx context.Context, userID, aliasType, value string) error
+
+	// Счета и движение средств
+	AddAccount(ctx context.Context, account Account) error
+	GetAccount(ctx context.Context, accountID string) (Account, bool)
+	GetAccountByNumber(ctx context.Context, number string) (Account, bool)
+	GetUserAccounts(ctx context.Context, userID string) []Account
+	ListAccounts(ctx context.Context) []Account
+	GetOrganizationAccounts(ctx context.Context, orgID string) []Account
+	AddOrganization(ctx context.Context, org Organization) error
+	GetOrganization(ctx context.Context, orgID string) (Organization, bool)
+	GetUserOrganizations(ctx context.Context, userID string) []Organization
+	UpdateOrganization(ctx context.Context, orgID string, update func(*Organization) error) (Organization, error)
+	AddPaymentApproval(ctx context.Context, approval PaymentApproval) error
+	GetPaymentApproval(ctx context.Context, id string) (PaymentApproval, bool)
+	ListPaymentApprovals(ctx context.Context, orgID, status string) []PaymentApproval
+	UpdatePaymentApproval(ctx context.Context, id string, update func(*PaymentApproval) error) (PaymentApproval, error)
+	AccrueInterest(ctx context.Context, accountID string, amount decimal.Decimal) error
+	SetAccountInterestRate(ctx context.Context, accountID string, rate decimal.Decimal) error
+	ChargeMonthlyFee(ctx context.Context, accountID string, fee decimal.Decimal, now time.Time) (Transaction, bool, error)
+	PostAccruedInterest(ctx context.Context, accountID string, now time.Time) (Transaction, bool, error)
+	CloseAccount(ctx context.Context, accountID, payoutAccountID string, now time.Time) (AccountClosure, error)
+	UpdateAccountBalance(ctx context.Context, accountID string, amount decimal.Decimal) error
+	TransferFunds(ctx context.Context, fromAccountID, toAccountID string, amount decimal.Decimal, now time.Time) (Transaction, error)
+	ExchangeFunds(ctx context.Context, outTx, inTx Transaction, debit, credit decimal.Decimal) error
+
+	// Журнал транзакций
+	AddTransaction(ctx context.Context, tx Transaction)
+	PostBackdatedTransaction(ctx context.Context, tx Transaction) error
+	AddImportedTransactions(ctx context.Context, accountID string, txs []Transaction) ([]Transaction, error)
+	GetImportedTransactions(ctx context.Context, accountID string) []Transaction
+	LoadTransactions(ctx context.Context, txs []Transaction) error
+	GetAccountTransactionsSince(ctx context.Context, accountID string, since int64) []Transaction
+	GetAccountTransactionsBatch(ctx context.Context, accountID string, since int64, limit int) []Transaction
+	ArchiveTransactions(ctx context.Context, cutoff, now time.Time) (int, error)
+	GetArchivedTransactions(ctx context.Context, accountID string, since time.Time) []Transaction
+	TransactionArchiveStats(ctx context.Context) TransactionArchiveStats
+	SearchUserTransactions(ctx context.Context, userID, query string) []TransactionSearchResult
+	AdminSearch(ctx context.Context, query string, limit int) []AdminSearchResult
+	GetTransaction(ctx context.Context, txID string) (Transaction, bool)
+	GetTransactionDetail(ctx context.Context, txID string) (TransactionDetail, bool)
+	GetRefundedAmount(ctx context.Context, txID string) decimal.Decimal
+	RefundPayment(ctx context.Context, refund Transaction) error
+	ReverseDeposit(ctx context.Context, depositTxID string, reversal Transaction, receivable Receivable, window time.Duration, now time.Time) (DepositReversal, error)
+	GetUserReceivables(ctx context.Context, userID string) []Receivable
+	ListReceivables(ctx context.Context, status string) []Receivable
+	GetAccountTransactions(ctx context.Context, accountID string) []Transaction
+	GetCardTransactions(ctx context.Context, cardID string) []Transaction
+
+	// Карты, кредиты, сессии, партнёры, операции, вебхуки, холды, аудит и настройки
+	AddCard(ctx context.Context, card Card) error
+	UpdateCardDelivery(ctx context.Context, cardID, status string, at time.Time) (Card, error)
+	HashCardCVVs(ctx context.Context, cutoff time.Time, hash func(Card) string, now time.Time) int
+	PurgeSessionClientInfo(ctx context.Context, cutoff time.Time) int
+	GetCard(ctx context.Context, cardID string) (Card, bool)
+	AddCardReveal(ctx context.Context, reveal CardReveal) error
+	UpdateCardReveal(ctx context.Context, revealID string, update func(*CardReveal) error) (CardReveal, error)
+	RedeemCardReveal(ctx context.Context, tokenHash string, now time.Time) (CardReveal, Card, error)
+	ExpireCardReveals(ctx context.Context, now time.Time) []CardReveal
+	AddCardToken(ctx context.Context, token CardToken) error
+	GetCardTokenByHash(ctx context.Context, tokenHash string) (CardToken, bool)
+	ListCardTokens(ctx context.Context, cardID string) []CardToken
+	SetCardTokenStatus(ctx context.Context, cardID, tokenID string, from []string, status string, now time.Time) (CardToken, error)
+	TouchCardToken(ctx context.Context, tokenID string, now time.Time)
+	GetAccountCards(ctx context.Context, accountID string) []Card
+	GetCardByNumber(ctx context.Context, number string) (Card, bool)
+	AddLoan(ctx context.Context, loan Loan) error
+	GetUserLoans(ctx context.Context, userID string) []Loan
+	ListLoans(ctx context.Context) []Loan
+	GetLoan(ctx context.Context, loanID string) (Loan, bool)
+	RemoveLoan(ctx context.Context, loanID string) error
+	UpdateLoan(ctx context.Context, loanID string, update func(*Loan) error) (Loan, error)
+	CollectLoanPayment(ctx context.Context, loanID string, now time.Time) (Transaction, Payment, bool, error)
+	GetGuaranteedLoans(ctx context.Context, userID string) []Loan
+	AddLoanApplication(ctx context.Context, app LoanApplication) error
+	GetLoanApplication(ctx context.Context, id string) (LoanApplication, bool)
+	ListLoanApplications(ctx context.Context, userID, status string) []LoanApplication
+	UpdateLoanApplication(ctx context.Context, id string, update func(*LoanApplication) error) (LoanApplication, error)
+	SaveCreditScore(ctx context.Context, score CreditScore) error
+	GetCreditScore(ctx context.Context, userID string) (CreditScore, bool)
+	AddSession(ctx context.Context, session Session) error
+	GetSessionByToken(ctx context.Context, token string) (Session, bool)
+	TouchSession(ctx context.Context, sessionID string, seenAt time.Time)
+	GetUserSessions(ctx context.Context, userID string) []Session
+	HasKnownDevice(ctx context.Context, userID, userAgent, ip string) bool
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID string) int
+	SetFXSweepRule(ctx context.Context, rule FXSweepRule) error
+	GetFXSweepRule(ctx context.Context, userID string) (FXSweepRule, bool)
+	DeleteFXSweepRule(ctx context.Context, userID string) error
+	ListFXSweepRules(ctx context.Context) []FXSweepRule
+	SaveAutoTransferRule(ctx context.Context, rule AutoTransferRule) error
+	GetAutoTransferRule(ctx context.Context, ruleID string) (AutoTransferRule, bool)
+	ListAutoTransferRules(ctx context.Context, userID string) []AutoTransferRule
+	AddBankLink(ctx context.Context, link ExternalBankLink) error
+	GetBankLink(ctx context.Context, id string) (ExternalBankLink, bool)
+	ListBankLinks(ctx context.Context, userID string) []ExternalBankLink
+	UpdateBankLink(ctx context.Context, id string, update func(*ExternalBankLink) error) (ExternalBankLink, error)
+	DeleteBankLink(ctx context.Context, userID, id string) error
+	SyncExternalAccount(ctx context.Context, account ExternalAccount, txs []ExternalTransaction) (ExternalAccount, int, error)
+	RemoveExternalAccounts(ctx context.Context, linkID string, keepExternalIDs []string) int
+	ListExternalAccounts(ctx context.Context, userID string) []ExternalAccount
+	GetExternalAccount(ctx context.Context, id string) (ExternalAccount, bool)
+	GetExternalTransactions(ctx context.Context, accountID string) []ExternalTransaction
+	DeleteAutoTransferRule(ctx context.Context, userID, ruleID string) error
+	RunAutoTransferRule(ctx context.Context, ruleID string, tx Transaction, now time.Time) (Transaction, bool, error)
+	AddAlertRule(ctx context.Context, rule AlertRule) error
+	UpdateAlertRule(ctx context.Context, accountID, ruleID string, update func(*AlertRule) error) (AlertRule, error)
+	ListAlertRules(ctx context.Context, accountID string) []AlertRule
+	DeleteAlertRule(ctx context.Context, accountID, ruleID string) error
+	GetUserSettings(ctx context.Context, userID string) UserSettings
+	SaveUserSettings(ctx context.Context, settings UserSettings) error
+	ListDigestSubscribers(ctx context.Context) []UserSettings
+	MarkDigestSent(ctx context.Context, userID string, sentAt time.Time)
+	AddAPIClient(ctx context.Context, client APIClient)
+	GetAPIClient(ctx context.Context, clientID string) (APIClient, bool)
+	ListAPIClients(ctx context.Context) []APIClient
+	AddLimitOverride(ctx context.Context, o LimitOverride) error
+	GetLimitOverride(ctx context.Context, id string) (LimitOverride, bool)
+	ListLimitOverrides(ctx context.Context, accountID, status string) []LimitOverride
+	DecideLimitOverride(ctx context.Context, id string, decide func(*LimitOverride)) (LimitOverride, error)
+	ActiveLimitOverride(ctx context.Context, accountID string, now time.Time) (LimitOverride, bool)
+	UpdateAPIClient(ctx context.Context, clientID string, update func(*APIClient)) (APIClient, error)
+	AddOAuthCode(ctx context.Context, code OAuthCode) error
+	RedeemOAuthCode(ctx context.Context, codeHash string, now time.Time) (OAuthCode, error)
+	AddOAuthGrant(ctx context.Context, grant OAuthGrant) error
+	GetUserOAuthGrants(ctx context.Context, userID string) []OAuthGrant
+	RefreshOAuthGrant(ctx context.Context, clientID, refreshHash, newRefreshHash string, now time.Time) (OAuthGrant, error)
+	RevokeOAuthGrant(ctx context.Context, userID, grantID string, now time.Time) (OAuthGrant, error)
+	RevokeClientOAuthGrants(ctx context.Context, clientID string, now time.Time) int
+	AddAccountConsent(ctx context.Context, consent AccountAccessConsent) error
+	GetAccountConsent(ctx context.Context, id string) (AccountAccessConsent, bool)
+	UpdateAccountConsent(ctx context.Context, id string, update func(*AccountAccessConsent) error) (AccountAccessConsent, error)
+	AddPaymentConsent(ctx context.Context, consent DomesticPaymentConsent) error
+	GetPaymentConsent(ctx context.Context, id string) (DomesticPaymentConsent, bool)
+	UpdatePaymentConsent(ctx context.Context, id string, update func(*DomesticPaymentConsent) error) (DomesticPaymentConsent, error)
+	AddDomesticPayment(ctx context.Context, payment DomesticPayment) error
+	GetDomesticPayment(ctx context.Context, id string) (DomesticPayment, bool)
+	UpdateDomesticPayment(ctx context.Context, id string, update func(*DomesticPayment) error) (DomesticPayment, error)
+	RememberSignature(ctx context.Context, key string, at time.Time, window time.Duration) bool
+	AddDeviceKey(ctx context.Context, key DeviceKey) error
+	GetDeviceKey(ctx context.Context, keyID string) (DeviceKey, bool)
+	ListDeviceKeys(ctx context.Context, userID string) []DeviceKey
+	RevokeDeviceKey(ctx context.Context, userID, keyID string, now time.Time) (DeviceKey, error)
+	TouchDeviceKey(ctx context.Context, keyID string, now time.Time)
+	SaveOperation(ctx context.Context, op Operation)
+	GetOperation(ctx context.Context, operationID string) (Operation, bool)
+	AddWebhook(ctx context.Context, hook Webhook) error
+	GetWebhook(ctx context.Context, webhookID string) (Webhook, bool)
+	GetUserWebhooks(ctx context.Context, userID string) []Webhook
+	DeleteWebhook(ctx context.Context, webhookID string) error
+	CreateHold(ctx context.Context, hold Hold) error
+	GetHold(ctx context.Context, holdID string) (Hold, bool)
+	CaptureHold(ctx context.Context, holdID string, amount decimal.Decimal, tx Transaction, now time.Time) (Hold, error)
+	ReleaseHold(ctx context.Context, holdID, status string, now time.Time) (Hold, error)
+	ExpireHolds(ctx context.Context, now time.Time) []Hold
+	AddPaymentChallenge(ctx context.Context, c PaymentChallenge, hold Hold) error
+	GetPaymentChallenge(ctx context.Context, id string) (PaymentChallenge, bool)
+	UpdatePaymentChallenge(ctx context.Context, id string, update func(*PaymentChallenge) error, now time.Time) (PaymentChallenge, error)
+	CompletePaymentChallenge(ctx context.Context, id string, now time.Time) (PaymentChallenge, error)
+	ExpirePaymentChallenges(ctx context.Context, now time.Time) []PaymentChallenge
+	AddAuditEntry(ctx context.Context, entry AuditEntry)
+	GetAuditLog(ctx context.Context, action string) []AuditEntry
+	AddSecurityEvent(ctx context.Context, event SecurityEvent)
+	GetSecurityEvents(ctx context.Context, userID string, from, to time.Time, eventType string) []SecurityEvent
+	SetParentalControl(ctx context.Context, control ParentalControl) error
+	GetParentalControl(ctx context.Context, accountID string) (ParentalControl, bool)
+	AddRateOverride(ctx context.Context, o RateOverride) error
+	DeleteRateOverride(ctx context.Context, id string) error
+	ListRateOverrides(ctx context.Context) []RateOverride
+	SaveRateSnapshots(ctx context.Context, snapshots []RateSnapshot) error
+	RateHistory(ctx context.Context, kind, currency, from, to string) []RateSnapshot
+
+	// Мерчанты и эквайринг
+	AddMerchant(ctx context.Context, m Merchant) error
+	GetMerchant(ctx context.Context, merchantID string) (Merchant, bool)
+	ListMerchants(ctx context.Context) []Merchant
+	AddMerchantAPIKey(ctx context.Context, key MerchantAPIKey) error
+	GetMerchantAPIKeys(ctx context.Context, merchantID string) []MerchantAPIKey
+	RevokeMerchantAPIKey(ctx context.Context, merchantID, keyID string, now time.Time) (MerchantAPIKey, error)
+	AddUserAPIKey(ctx context.Context, key UserAPIKey) error
+	GetUserAPIKeys(ctx context.Context, userID string) []UserAPIKey
+	RotateUserAPIKey(ctx context.Context, userID, keyID, prefix, keyHash string, now time.Time) (UserAPIKey, error)
+	RevokeUserAPIKey(ctx context.Context, userID, keyID string, now time.Time) (UserAPIKey, error)
+	AuthenticateUserAPIKey(ctx context.Context, keyHash string, now time.Time) (UserAPIKey, error)
+	AuthenticateMerchantKey(ctx context.Context, keyHash string, now time.Time) (Merchant, error)
+	PayMerchant(ctx context.Context, tx Transaction) error
+	GetMerchantTransactions(ctx context.Context, merchantID string) []Transaction
+	SetMerchantWebhook(ctx context.Context, hook MerchantWebhook) error
+	GetMerchantWebhook(ctx context.Context, merchantID string) (MerchantWebhook, bool)
+	DeleteMerchantWebhook(ctx context.Context, merchantID string) error
+	AddMerchantWebhookDelivery(ctx context.Context, d MerchantWebhookDelivery)
+	GetMerchantWebhookDeliveries(ctx context.Context, merchantID, eventType string, failedOnly bool) []MerchantWebhookDelivery
+	OpenChargeback(ctx context.Context, cb Chargeback) (Chargeback, error)
+	GetChargeback(ctx context.Context, id string) (Chargeback, bool)
+	ListChargebacks(ctx context.Context, merchantID, userID, status string) []Chargeback
+	AddChargebackEvidence(ctx context.Context, merchantID, id string, evidence ChargebackEvidence) (Chargeback, error)
+	ResolveChargeback(ctx context.Context, id string, accept bool, resolution string, tx Transaction, receivable Receivable, now time.Time) (Chargeback, error)
+
+	// Счета на оплату
+	AddInvoice(ctx context.Context, inv Invoice) error
+	GetInvoice(ctx context.Context, id string) (Invoice, bool)
+	ListInvoices(ctx context.Context, issuerUserID string) []Invoice
+	PayInvoice(ctx context.Context, id, fromAccountID string, tx Transaction, now time.Time) (Invoice, Transaction, error)
+	CancelInvoice(ctx context.Context, id, issuerUserID string, now time.Time) (Invoice, error)
+
+	// Запросы денег между пользователями
+	AddMoneyRequest(ctx context.Context, pr MoneyRequest) error
+	GetMoneyRequest(ctx context.Context, id string) (MoneyRequest, bool)
+	ListMoneyRequests(ctx context.Context, userID, role string) []MoneyRequest
+	AcceptMoneyRequest(ctx context.Context, id, fromAccountID string, tx Transaction, now time.Time) (MoneyRequest, Transaction, error)
+	CloseMoneyRequest(ctx context.Context, id, status, reason string, now time.Time) (MoneyRequest, error)
+
+	// Безопасные сделки (эскроу)
+	OpenEscrow(ctx context.Context, e Escrow, fundTx Transaction) (Escrow, error)
+	GetEscrow(ctx context.Context, id string) (Escrow, bool)
+	ListEscrows(ctx context.Context, userID, status string) []Escrow
+	UpdateEscrow(ctx context.Context, id string, update func(*Escrow) error) (Escrow, error)
+	SettleEscrow(ctx context.Context, id string, release bool, from []string, tx Transaction, resolution string, now time.Time) (Escrow, error)
+	DueEscrows(ctx context.Context, now time.Time) []Escrow
+
+	// Выключатели и дневные лимиты банка по типам операций
+	SetOperationControl(ctx context.Context, c OperationControl) error
+	GetOperationControl(ctx context.Context, opType string) (OperationControl, bool)
+	ReserveOperationVolume(ctx context.Context, opType string, day time.Time, amount decimal.Decimal) error
+	ReleaseOperationVolume(ctx context.Context, opType string, day time.Time, amount decimal.Decimal)
+	OperationVolume(ctx context.Context, opType string, day time.Time) decimal.Decimal
+
+	// Дневной лимит переводов счёта
+	OutgoingDebitsSince(ctx context.Context, accountID string, since time.Time) decimal.Decimal
+	ReserveTransferLimit(ctx context.Context, accountID string, since time.Time, limit, amount decimal.Decimal) error
+	ReleaseTransferLimit(ctx context.Context, accountID string, amount decimal.Decimal)
+
+	// Многошаговые операции с компенсацией
+	SaveSaga(ctx context.Context, saga Saga) error
+	GetSaga(ctx context.Context, id string) (Saga, bool)
+	ListSagas(ctx context.Context, status string) []Saga
+
+	// Закрытие операционного дня
+	SaveEODBatch(ctx context.Context, batch EODBatch) error
+	GetEODBatch(ctx context.Context, date string) (EODBatch, bool)
+	ListEODBatches(ctx context.Context) []EODBatch
+	SnapshotBalances(ctx context.Context, date string) ([]BalanceSnapshot, error)
+	ListBalanceSnapshots(ctx context.Context, date, accountID string) []BalanceSnapshot
+
+	// Рассылки объявлений
+	AddBroadcast(ctx context.Context, b Broadcast, recipients []BroadcastRecipient) error
+	GetBroadcast(ctx context.Context, id string) (Broadcast, bool)
+	ListBroadcasts(ctx context.Context) []Broadcast
+	GetBroadcastRecipients(ctx context.Context, id, status string) ([]BroadcastRecipient, error)
+	NextBroadcastRecipients(ctx context.Context, limit int, now time.Time) []BroadcastRecipient
+	RecordBroadcastDelivery(ctx context.Context, broadcastID, userID string, sendErr error, maxAttempts int, retryAfter time.Duration, now time.Time) (Broadcast, error)
+
+	// Очередь писем с повторами и dead-letter
+	AddEmailNotification(ctx context.Context, n EmailNotification) error
+	ClaimEmailNotifications(ctx context.Context, limit int, lease time.Duration, now time.Time) []EmailNotification
+	RecordEmailAttempt(ctx context.Context, id string, sendErr error, maxAttempts int, retryAt, now time.Time) (EmailNotification, error)
+	ListEmailNotifications(ctx context.Context, status string) []EmailNotification
+	RequeueEmailNotification(ctx context.Context, id string, now time.Time) (EmailNotification, error)
+}
+
+var _ Repository = (*InMemoryStorage)(nil)
@@ -0,0 +1,5688 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+type InMemoryStorage struct {
+	users            map[string]User                   // key: UserID
+	accounts         map[string]Account                // key: AccountID
+	cards            map[string]Card                   // key: CardID
+	loans            map[string]Loan                   // key: LoanID
+	transactions     []Transaction                     // Просто список всех транзакций
+	descIndex        map[string][]int                  // key: термин из описания/мерчанта -> индексы в transactions
+	txByID           map[string]int                    // key: TransactionID -> индекс в transactions
+	txGroups         map[string][]int                  // key: GroupID -> индексы связанных проводок в transactions
+	archivedTxs      []Transaction                     // начало журнала, вынесенное политикой хранения; индексы выше считаются от него
+	archiveIndex     map[string][]int                  // key: AccountID -> индексы архивных операций счёта в archivedTxs
+	archivedTotals   map[string]LedgerTotals           // key: AccountID -> обороты архивных операций (для сверки)
+	archiveHorizon   time.Time                         // самая поздняя дата валютирования среди архивных операций
+	archivedAt       time.Time                         // последний перенос в архив
+	refunded         map[string]decimal.Decimal        // key: TransactionID платежа -> сумма возвратов
+	userIndex        map[string]string                 // key: Username -> UserID (для быстрой проверки уникальности)
+	emailIndex       map[string]string                 // key: Email -> UserID
+	dependentIndex   map[string][]string               // key: ParentID -> []UserID
+	accountIndex     map[string][]string               // key: UserID -> []AccountID
+	numberIndex      map[string]string                 // key: Account.Number -> AccountID
+	searchIndex      map[string][]searchEntry          // key: триграмма логина/email/номера счёта -> записи для поиска админом
+	cardIndex        map[string][]string               // key: AccountID -> []CardID
+	panLast4Index    map[string][]string               // key: последние 4 цифры карты -> []CardID
+	loanIndex        map[string][]string               // key: UserID -> []LoanID
+	guaranteeIndex   map[string][]string               // key: UserID поручителя -> []LoanID
+	loanApplications map[string]LoanApplication        // key: LoanID (заявки, ждущие согласия поручителя)
+	organizations    map[string]Organization           // key: OrganizationID
+	orgIndex         map[string][]string               // key: UserID участника -> []OrganizationID
+	orgAccountIndex  map[string][]string               // key: OrganizationID -> []AccountID (расчётные счета)
+	paymentApprovals map[string]PaymentApproval        // key: PaymentApprovalID
+	summaries        map[string]*UserSummary           // key: UserID (инкрементальные агрегаты для финансовой сводки)
+	sessions         map[string]Session                // key: SessionID
+	sessionToken     map[string]string                 // key: Token -> SessionID
+	sessionIndex     map[string][]string               // key: UserID -> []SessionID
+	securityEvents   map[string][]SecurityEvent        // key: UserID
+	fxSweepRules     map[string]FXSweepRule            // key: UserID
+	transferRules    map[string]AutoTransferRule       // key: RuleID (автопереводы между своими счетами)
+	bankLinks        map[string]ExternalBankLink       // key: LinkID
+	externalAccounts map[string]ExternalAccount        // key: ExternalAccount.ID
+	externalTxs      map[string][]ExternalTransaction  // key: ExternalAccount.ID
+	alertRules       map[string]AlertRule              // key: RuleID (оповещения по счетам)
+	userSettings     map[string]UserSettings           // key: UserID
+	apiClients       map[string]APIClient              // key: ClientID
+	oauthCodes       map[string]OAuthCode              // key: sha256 кода авторизации
+	oauthGrants      map[string]OAuthGrant             // key: GrantID
+	oauthRefresh     map[string]string                 // key: sha256 refresh token -> GrantID
+	accountConsents  map[string]AccountAccessConsent   // key: ConsentID
+	paymentConsents  map[string]DomesticPaymentConsent // key: ConsentID
+	domesticPayments map[string]DomesticPayment        // key: PaymentID
+	operations       map[string]Operation              // key: OperationID
+	webhooks         map[string]Webhook                // key: WebhookID
+	holds            map[string]Hold                   // key: HoldID (авторизации по картам)
+	parentalControls map[string]ParentalControl        // key: AccountID
+	auditLog         []AuditEntry                      // журнал аудита, только добавление
+	generations      map[string]uint64                 // key: коллекция -> счётчик изменений (монотонный)
+	seenSignatures   map[string]time.Time              // key: ClientID+Signature -> время запроса (защита от повторов)
+	rateOverrides    map[string]RateOverride           // key: OverrideID (ставки ЦБ для песочницы)
+	receivables      map[string]Receivable             // key: ReceivableID
+	receivableIndex  map[string][]string               // key: UserID -> []ReceivableID
+	reversedDeposits map[string]string                 // key: TransactionID пополнения -> ID отменяющей операции
+	limitOverrides   map[string]LimitOverride          // key: OverrideID (заявки на повышение лимита)
+	cardReveals      map[string]CardReveal             // key: RevealID
+	revealTokens     map[string]string                 // key: sha256 одноразового токена -> RevealID
+	broadcasts       map[string]Broadcast              // key: BroadcastID
+	broadcastQueue   map[string][]BroadcastRecipient   // key: BroadcastID -> получатели (очередь писем рассылки)
+	aliases          map[string]Alias                  // key: Alias.Key() (тип:значение)
+	externalRefs     map[string]string                 // key: ExternalRef перенесённой операции -> TransactionID
+	importedTxs      map[string][]Transaction          // key: AccountID -> операции из выписок других банков
+	importedRefs     map[string]string                 // key: AccountID + "/" + ExternalRef -> TransactionID
+	merchants        map[string]Merchant               // key: MerchantID
+	merchantKeys     map[string]MerchantAPIKey         // key: KeyID
+	merchantKeyHash  map[string]string                 // key: sha256 ключа мерчанта -> KeyID
+	userAPIKeys      map[string]UserAPIKey             // key: KeyID
+	userAPIKeyHash   map[string]string                 // key: sha256 ключа пользователя -> KeyID
+	merchantTxIndex  map[string][]int                  // key: MerchantID -> индексы в transactions (оплаты и возвраты)
+	cardTxIndex      map[string][]int                  // key: CardID -> индексы в transactions
+	debitTxIndex     map[string][]int                  // key: AccountID -> индексы исходящих списаний клиента (OutgoingDebitTypes)
+	merchantHooks    map[string]MerchantWebhook        // key: MerchantID
+	merchantHookLog  map[string]merchantDeliveryLog    // key: MerchantID -> журнал доставок по порядку
+	chargebacks      map[string]Chargeback             // key: ChargebackID
+	chargebacksByTx  map[string][]string               // key: TransactionID оплаты -> []ChargebackID
+	invoices         map[string]Invoice                // key: InvoiceID
+	moneyRequests    map[string]MoneyRequest           // key: MoneyRequestID
+	sagas            map[string]Saga                   // key: SagaID
+	eodBatches       map[string]EODBatch               // key: операционный день YYYY-MM-DD
+	balanceSnapshots map[string][]BalanceSnapshot      // key: операционный день -> остатки счетов на конец дня
+	escrows          map[string]Escrow                 // key: EscrowID
+	opControls       map[string]OperationControl       // key: тип операции (выключатели и дневные лимиты банка)
+	opVolumes        map[string]operationVolume        // key: тип операции -> объём за текущий день
+	transferHolds    map[string]decimal.Decimal        // key: AccountID -> списания, прошедшие проверку лимита, но ещё не проведённые
+	creditScores     map[string]CreditScore            // key: UserID
+	deviceKeys       map[string]DeviceKey              // key: KeyID
+	challenges       map[string]PaymentChallenge       // key: PaymentID (оплаты, ожидающие 3-D Secure)
+	cardTokens       map[string]CardToken              // key: TokenID (токены карт на устройствах)
+	cardTokenHash    map[string]string                 // key: sha256 токена -> TokenID
+	rateHistory      map[string][]RateSnapshot         // key: вид:валюта -> значения ставок ЦБ по датам
+	emailQueue       map[string]EmailNotification      // key: NotificationID (неотправленные письма и dead-letter)
+	mu               sync.RWMutex                      // Mutex для защиты доступа к данным
+
+	events     Publisher                     // получает transaction.created при каждой записи в журнал
+	writeHooks []func(collection, id string) // вызываются при записи пользователя, счёта или карты (инвалидация кеша)
+}
+
+type UserSummary struct {
+	TotalBalance  decimal.Decimal
+	TotalLoanDebt decimal.Decimal
+	ActiveLoans   int
+	Accounts      int
+
+	OutstandingReceivables decimal.Decimal
+}
+
+// BankStats — сырые агрегаты по всему банку для админской сводки; суммы по валютам счетов
+type BankStats struct {
+	Users            int
+	Accounts         int                        // открытые счета
+	Deposits         map[string]decimal.Decimal // остатки открытых счетов
+	OutstandingLoans int
+	LoanPrincipal    map[string]decimal.Decimal // непогашенный основной долг
+	DayTransactions  int                        // проведено с начала дня
+	DayVolume        map[string]decimal.Decimal
+	Merchants        map[string]*MerchantStats // key: MerchantID или название для оплат без зарегистрированного мерчанта
+}
+
+// LedgerTotals — движение по счёту по журналу; остаток по журналу — Credits − Debits
+type LedgerTotals struct {
+	Credits      decimal.Decimal
+	Debits       decimal.Decimal
+	Transactions int
+}
+
+type MerchantStats struct {
+	MerchantID string
+	Name       string
+	Payments   int
+	Volume     map[string]decimal.Decimal
+}
+
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrConflict          = errors.New("conflict")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidInput      = errors.New("invalid input")
+	ErrQuotaExceeded     = errors.New("quota exceeded")
+	ErrForbidden         = errors.New("forbidden")
+	ErrUnavailable       = errors.New("unavailable") // операция временно отключена банком
+)
+
+// StorageError сохраняет человекочитаемое сообщение и категорию ошибки для errors.Is
+type StorageError struct {
+	Kind    error
+	Code    ErrorCode // необязательный точный код для ответа API
+	Message string
+}
+
+func (e *StorageError) Error() string { return e.Message }
+
+func (e *StorageError) Unwrap() error { return e.Kind }
+
+func notFoundf(format string, args ...interface{}) error {
+	return &StorageError{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func notFoundCodef(code ErrorCode, format string, args ...interface{}) error {
+	return &StorageError{Kind: ErrNotFound, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func accountClosedError(accountID string) error {
+	return &StorageError{Kind: ErrConflict, Code: CodeAccountClosed, Message: fmt.Sprintf("account %s is closed", accountID)}
+}
+
+func conflictf(format string, args ...interface{}) error {
+	return &StorageError{Kind: ErrConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func NewInMemoryStorage(events Publisher) *InMemoryStorage {
+	return &InMemoryStorage{
+		users:            make(map[string]User),
+		accounts:         make(map[string]Account),
+		cards:            make(map[string]Card),
+		loans:            make(map[string]Loan),
+		transactions:     make([]Transaction, 0),
+		descIndex:        make(map[string][]int),
+		txByID:           make(map[string]int),
+		txGroups:         make(map[string][]int),
+		archiveIndex:     make(map[string][]int),
+		archivedTotals:   make(map[string]LedgerTotals),
+		refunded:         make(map[string]decimal.Decimal),
+		userIndex:        make(map[string]string),
+		emailIndex:       make(map[string]string),
+		dependentIndex:   make(map[string][]string),
+		accountIndex:     make(map[string][]string),
+		numberIndex:      make(map[string]string),
+		searchIndex:      make(map[string][]searchEntry),
+		cardIndex:        make(map[string][]string),
+		panLast4Index:    make(map[string][]string),
+		loanIndex:        make(map[string][]string),
+		guaranteeIndex:   make(map[string][]string),
+		loanApplications: make(map[string]LoanApplication),
+		organizations:    make(map[string]Organization),
+		orgIndex:         make(map[string][]string),
+		orgAccountIndex:  make(map[string][]string),
+		paymentApprovals: make(map[string]PaymentApproval),
+		summaries:        make(map[string]*UserSummary),
+		sessions:         make(map[string]Session),
+		sessionToken:     make(map[string]string),
+		sessionIndex:     make(map[string][]string),
+		securityEvents:   make(map[string][]SecurityEvent),
+		fxSweepRules:     make(map[string]FXSweepRule),
+		transferRules:    make(map[string]AutoTransferRule),
+		bankLinks:        make(map[string]ExternalBankLink),
+		externalAccounts: make(map[string]ExternalAccount),
+		externalTxs:      make(map[string][]ExternalTransaction),
+		alertRules:       make(map[string]AlertRule),
+		userSettings:     make(map[string]UserSettings),
+		apiClients:       make(map[string]APIClient),
+		oauthCodes:       make(map[string]OAuthCode),
+		oauthGrants:      make(map[string]OAuthGrant),
+		oauthRefresh:     make(map[string]string),
+		accountConsents:  make(map[string]AccountAccessConsent),
+		paymentConsents:  make(map[string]DomesticPaymentConsent),
+		domesticPayments: make(map[string]DomesticPayment),
+		operations:       make(map[string]Operation),
+		webhooks:         make(map[string]Webhook),
+		holds:            make(map[string]Hold),
+		generations:      make(map[string]uint64),
+		parentalControls: make(map[string]ParentalControl),
+		seenSignatures:   make(map[string]time.Time),
+		rateOverrides:    make(map[string]RateOverride),
+		receivables:      make(map[string]Receivable),
+		receivableIndex:  make(map[string][]string),
+		reversedDeposits: make(map[string]string),
+		limitOverrides:   make(map[string]LimitOverride),
+		broadcasts:       make(map[string]Broadcast),
+		broadcastQueue:   make(map[string][]BroadcastRecipient),
+		aliases:          make(map[string]Alias),
+		externalRefs:     make(map[string]string),
+		importedTxs:      make(map[string][]Transaction),
+		importedRefs:     make(map[string]string),
+		merchants:        make(map[string]Merchant),
+		merchantKeys:     make(map[string]MerchantAPIKey),
+		merchantKeyHash:  make(map[string]string),
+		userAPIKeys:      make(map[string]UserAPIKey),
+		userAPIKeyHash:   make(map[string]string),
+		merchantTxIndex:  make(map[string][]int),
+		cardTxIndex:      make(map[string][]int),
+		debitTxIndex:     make(map[string][]int),
+		merchantHooks:    make(map[string]MerchantWebhook),
+		merchantHookLog:  make(map[string]merchantDeliveryLog),
+		chargebacks:      make(map[string]Chargeback),
+		chargebacksByTx:  make(map[string][]string),
+		invoices:         make(map[string]Invoice),
+		moneyRequests:    make(map[string]MoneyRequest),
+		sagas:            make(map[string]Saga),
+		eodBatches:       make(map[string]EODBatch),
+		balanceSnapshots: make(map[string][]BalanceSnapshot),
+		escrows:          make(map[string]Escrow),
+		opControls:       make(map[string]OperationControl),
+		opVolumes:        make(map[string]operationVolume),
+		transferHolds:    make(map[string]decimal.Decimal),
+		creditScores:     make(map[string]CreditScore),
+		deviceKeys:       make(map[string]DeviceKey),
+		challenges:       make(map[string]PaymentChallenge),
+		cardTokens:       make(map[string]CardToken),
+		cardTokenHash:    make(map[string]string),
+		rateHistory:      make(map[string][]RateSnapshot),
+		emailQueue:       make(map[string]EmailNotification),
+		cardReveals:      make(map[string]CardReveal),
+		revealTokens:     make(map[string]string),
+		events:           events,
+	}
+}
+
+const (
+	CollectionUsers        = "users"
+	CollectionAccounts     = "accounts"
+	CollectionCards        = "cards"
+	CollectionLoans        = "loans"
+	CollectionTransactions = "transactions"
+	CollectionReceivables  = "receivables"
+
+	CollectionExternalAccounts = "external_accounts"
+)
+
+// Вызывающий должен удерживать s.mu. Любая запись в коллекцию увеличивает её поколение,
+// что позволяет кешам (ETag, сводка) инвалидироваться точно, а не по TTL.
+func (s *InMemoryStorage) bump(collection string) {
+	s.generations[collection]++
+}
+
+// OnWrite регистрирует fn, который вызывается после каждой записи пользователя, счёта или карты с её коллекцией и ID.
+// fn выполняется под s.mu, поэтому не должен обращаться к хранилищу.
+func (s *InMemoryStorage) OnWrite(fn func(collection, id string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeHooks = append(s.writeHooks, fn)
+}
+
+// written сообщает подписчикам OnWrite о записи. Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) written(collection, id string) {
+	for _, fn := range s.writeHooks {
+		fn(collection, id)
+	}
+}
+
+func (s *InMemoryStorage) putUser(user User) {
+	s.users[user.ID] = user
+	s.bump(CollectionUsers)
+	s.written(CollectionUsers, user.ID)
+}
+
+// putAccount записывает счёт без проверки версии и увеличивает acc.Version. Подходит, только если счёт прочитан
+// и записан в одном шаге, как в служебных доначислениях; операции, которые сначала проверяют прочитанный счёт,
+// пишут через casAccounts. Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) putAccount(acc *Account) {
+	acc.Version++
+	s.accounts[acc.ID] = *acc
+	s.bump(CollectionAccounts)
+	s.written(CollectionAccounts, acc.ID)
+}
+
+// casAccounts записывает счета, только если ни один не изменился с момента чтения: версия каждого должна совпадать
+// с хранимой, иначе не пишется ни один и возвращается конфликт. Пока всё хранилище под одной блокировкой, конфликт
+// невозможен, но с построчными блокировками или SQL именно эта проверка не даёт, например, переводу и оплате картой
+// затереть изменения друг друга. Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) casAccounts(accs ...*Account) error {
+	for _, acc := range accs {
+		if current, ok := s.accounts[acc.ID]; ok && current.Version != acc.Version {
+			return &StorageError{Kind: ErrConflict, Code: CodeVersionConflict, Message: fmt.Sprintf("account %s was modified concurrently (version %d, expected %d)", acc.ID, current.Version, acc.Version)}
+		}
+	}
+	for _, acc := range accs {
+		s.putAccount(acc)
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) putCard(card Card) {
+	s.cards[card.ID] = card
+	s.bump(CollectionCards)
+	s.written(CollectionCards, card.ID)
+}
+
+func (s *InMemoryStorage) putLoan(loan Loan) {
+	s.loans[loan.ID] = loan
+	s.bump(CollectionLoans)
+}
+
+func (s *InMemoryStorage) putReceivable(rec Receivable) {
+	if _, exists := s.receivables[rec.ID]; !exists {
+		s.receivableIndex[rec.UserID] = append(s.receivableIndex[rec.UserID], rec.ID)
+	}
+	s.receivables[rec.ID] = rec
+	s.bump(CollectionReceivables)
+}
+
+func (s *InMemoryStorage) Generation(ctx context.Context, collection string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generations[collection]
+}
+
+func (s *InMemoryStorage) Generations(ctx context.Context) map[string]uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(map[string]uint64, len(s.generations))
+	for k, v := range s.generations {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+func (s *InMemoryStorage) summaryFor(userID string) *UserSummary {
+	sum, ok := s.summaries[userID]
+	if !ok {
+		sum = &UserSummary{TotalBalance: decimal.Zero, TotalLoanDebt: decimal.Zero, OutstandingReceivables: decimal.Zero}
+		s.summaries[userID] = sum
+	}
+	return sum
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) adjustSummaryBalance(userID string, delta decimal.Decimal) {
+	sum := s.summaryFor(userID)
+	sum.TotalBalance = sum.TotalBalance.Add(delta)
+}
+
+func (s *InMemoryStorage) GetUserSummary(ctx context.Context, userID string) UserSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sum, ok := s.summaries[userID]; ok {
+		return *sum
+	}
+	return UserSummary{TotalBalance: decimal.Zero, TotalLoanDebt: decimal.Zero, OutstandingReceivables: decimal.Zero}
+}
+
+func (s *InMemoryStorage) computeUserSummary(userID string) UserSummary {
+	sum := UserSummary{TotalBalance: decimal.Zero, TotalLoanDebt: decimal.Zero, OutstandingReceivables: decimal.Zero}
+	for _, id := range s.accountIndex[userID] {
+		if acc, ok := s.accounts[id]; ok {
+			sum.TotalBalance = sum.TotalBalance.Add(acc.Balance)
+			sum.Accounts++
+		}
+	}
+	for _, id := range s.loanIndex[userID] {
+		if loan, ok := s.loans[id]; ok {
+			sum.TotalLoanDebt = sum.TotalLoanDebt.Add(loan.RemainingAmount)
+			if loan.RemainingAmount.GreaterThan(decimal.Zero) {
+				sum.ActiveLoans++
+			}
+		}
+	}
+	for _, id := range s.receivableIndex[userID] {
+		sum.OutstandingReceivables = sum.OutstandingReceivables.Add(s.receivables[id].Outstanding)
+	}
+	return sum
+}
+
+func (s *InMemoryStorage) ReconcileUserSummaries(ctx context.Context) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var mismatched []string
+	for userID := range s.users {
+		expected := s.computeUserSummary(userID)
+		cached := s.summaryFor(userID)
+		if !cached.TotalBalance.Equal(expected.TotalBalance) ||
+			!cached.TotalLoanDebt.Equal(expected.TotalLoanDebt) ||
+			cached.ActiveLoans != expected.ActiveLoans ||
+			cached.Accounts != expected.Accounts ||
+			!cached.OutstandingReceivables.Equal(expected.OutstandingReceivables) {
+			mismatched = append(mismatched, userID)
+			*cached = expected
+		}
+	}
+	return mismatched
+}
+
+// LedgerBalances пересчитывает движения по всем счетам из журнала. Счета и итоги снимаются под одной блокировкой,
+// поэтому расхождение не может возникнуть из-за операции, проведённой между чтением остатка и журнала.
+// Архивные операции не перечитываются: их обороты по счетам накоплены при переносе в архив.
+func (s *InMemoryStorage) LedgerBalances(ctx context.Context) ([]Account, map[string]LedgerTotals, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accounts := make([]Account, 0, len(s.accounts))
+	for _, acc := range s.accounts {
+		accounts = append(accounts, acc)
+	}
+	totals := make(map[string]LedgerTotals, len(s.accounts))
+	for accountID, t := range s.archivedTotals {
+		totals[accountID] = t
+	}
+	for _, tx := range s.transactions {
+		addLedgerTotals(totals, tx)
+	}
+	return accounts, totals, len(s.archivedTxs) + len(s.transactions)
+}
+
+// addLedgerTotals добавляет проводку к оборотам счёта списания и счёта зачисления
+func addLedgerTotals(totals map[string]LedgerTotals, tx Transaction) {
+	if tx.FromAccountID != "" {
+		t := totals[tx.FromAccountID]
+		t.Debits = t.Debits.Add(tx.Amount)
+		t.Transactions++
+		totals[tx.FromAccountID] = t
+	}
+	if tx.ToAccountID != "" {
+		t := totals[tx.ToAccountID]
+		t.Credits = t.Credits.Add(tx.Amount)
+		if tx.ToAccountID != tx.FromAccountID {
+			t.Transactions++
+		}
+		totals[tx.ToAccountID] = t
+	}
+}
+
+// BankStats считает агрегаты за один проход: журнал просматривается с конца, пока дата проводки не раньше
+// merchantsSince, так что цена не зависит от длины всей истории. dayStart — начало дня для дневного оборота.
+func (s *InMemoryStorage) BankStats(ctx context.Context, dayStart, merchantsSince time.Time) BankStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := BankStats{
+		Users:         len(s.users),
+		Deposits:      make(map[string]decimal.Decimal),
+		LoanPrincipal: make(map[string]decimal.Decimal),
+		DayVolume:     make(map[string]decimal.Decimal),
+		Merchants:     make(map[string]*MerchantStats),
+	}
+	for _, acc := range s.accounts {
+		if acc.IsClosed() {
+			continue
+		}
+		stats.Accounts++
+		stats.Deposits[acc.Currency] = stats.Deposits[acc.Currency].Add(acc.Balance)
+	}
+	for _, loan := range s.loans {
+		if !loan.RemainingAmount.IsPositive() {
+			continue
+		}
+		currency := BaseCurrency
+		if acc, ok := s.accounts[loan.AccountID]; ok {
+			currency = acc.Currency
+		}
+		stats.OutstandingLoans++
+		stats.LoanPrincipal[currency] = stats.LoanPrincipal[currency].Add(loan.RemainingAmount)
+	}
+
+	since := merchantsSince
+	if dayStart.Before(since) {
+		since = dayStart
+	}
+	for i := len(s.transactions) - 1; i >= 0; i-- {
+		tx := s.transactions[i]
+		if tx.BookingDate.Before(since) {
+			break
+		}
+		currency := s.transactionCurrency(tx)
+		if !tx.BookingDate.Before(dayStart) {
+			stats.DayTransactions++
+			stats.DayVolume[currency] = stats.DayVolume[currency].Add(tx.Amount)
+		}
+		if tx.TransactionType != "payment" || tx.BookingDate.Before(merchantsSince) || (tx.MerchantID == "" && tx.Merchant == "") {
+			continue
+		}
+		key := tx.MerchantID
+		if key == "" {
+			key = tx.Merchant
+		}
+		m, ok := stats.Merchants[key]
+		if !ok {
+			m = &MerchantStats{MerchantID: tx.MerchantID, Name: tx.Merchant, Volume: make(map[string]decimal.Decimal)}
+			if merchant, ok := s.merchants[tx.MerchantID]; ok {
+				m.Name = merchant.Name
+			}
+			stats.Merchants[key] = m
+		}
+		m.Payments++
+		m.Volume[currency] = m.Volume[currency].Add(tx.Amount)
+	}
+	return stats
+}
+
+func (s *InMemoryStorage) AddUser(ctx context.Context, user User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.userIndex[user.Username]; exists {
+		return conflictf("username '%s' already taken", user.Username)
+	}
+	if _, exists := s.emailIndex[user.Email]; exists {
+		return conflictf("email '%s' already registered", user.Email)
+	}
+
+	if user.ParentID != "" {
+		if _, exists := s.users[user.ParentID]; !exists {
+			return notFoundCodef(CodeUserNotFound, "parent user %s not found", user.ParentID)
+		}
+		s.dependentIndex[user.ParentID] = append(s.dependentIndex[user.ParentID], user.ID)
+	}
+
+	s.putUser(user)
+	s.userIndex[user.Username] = user.ID
+	s.emailIndex[user.Email] = user.ID
+	s.indexForSearch(SearchKindUser, user.ID, "username", user.Username)
+	s.indexForSearch(SearchKindUser, user.ID, "email", user.Email)
+	return nil
+}
+
+func (s *InMemoryStorage) GetUserByUsername(ctx context.Context, username string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userID, ok := s.userIndex[username]
+	if !ok {
+		return User{}, false
+	}
+	user, ok := s.users[userID]
+	return user, ok
+}
+
+func (s *InMemoryStorage) GetUserByEmail(ctx context.Context, email string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userID, ok := s.emailIndex[email]
+	if !ok {
+		return User{}, false
+	}
+	user, ok := s.users[userID]
+	return user, ok
+}
+
+func (s *InMemoryStorage) GetUser(ctx context.Context, userID string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[userID]
+	return user, ok
+}
+
+// VerifyUserEmail подтверждает email кодом из письма. Просроченный код не принимается, после maxAttempts неверных
+// попыток код сгорает — нужен новый.
+func (s *InMemoryStorage) VerifyUserEmail(ctx context.Context, userID, code string, maxAttempts int, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", userID)
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	if user.VerificationCode == "" || !now.Before(user.VerificationExpiresAt) {
+		return &StorageError{Kind: ErrConflict, Message: "verification code has expired or too many attempts were made, request a new one"}
+	}
+	if user.VerificationCode != code {
+		user.VerificationAttempts++
+		if user.VerificationAttempts >= maxAttempts {
+			user.VerificationCode = ""
+		}
+		s.putUser(user)
+		return &StorageError{Kind: ErrInvalidInput, Message: "invalid verification code"}
+	}
+	user.EmailVerified = true
+	user.VerificationCode = ""
+	user.VerificationAttempts = 0
+	s.putUser(user)
+	return nil
+}
+
+func (s *InMemoryStorage) UpdateUserPassword(ctx context.Context, userID, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", userID)
+	}
+	user.PasswordHash = passwordHash
+	s.putUser(user)
+	return nil
+}
+
+// UpdateUser применяет update к пользователю под блокировкой; при ошибке update изменения не сохраняются
+func (s *InMemoryStorage) UpdateUser(ctx context.Context, userID string, update func(*User) error) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return User{}, notFoundCodef(CodeUserNotFound, "user %s not found", userID)
+	}
+	if user.Profile != nil {
+		profile := *user.Profile
+		user.Profile = &profile
+	}
+	if err := update(&user); err != nil {
+		return User{}, err
+	}
+	s.putUser(user)
+	return user, nil
+}
+
+func (s *InMemoryStorage) AddAccount(ctx context.Context, account Account) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[account.UserID]; !exists {
+		return notFoundCodef(CodeUserNotFound, "user with ID %s not found", account.UserID)
+	}
+	if _, exists := s.numberIndex[account.Number]; exists {
+		return conflictf("account number %s already in use", account.Number)
+	}
+	if account.OrganizationID != "" {
+		if _, exists := s.organizations[account.OrganizationID]; !exists {
+			return notFoundCodef(CodeOrgNotFound, "organization %s not found", account.OrganizationID)
+		}
+		s.orgAccountIndex[account.OrganizationID] = append(s.orgAccountIndex[account.OrganizationID], account.ID)
+	}
+	account.refreshAvailable()
+	account.Version = 0
+	s.putAccount(&account)
+	s.accountIndex[account.UserID] = append(s.accountIndex[account.UserID], account.ID)
+	s.numberIndex[account.Number] = account.ID
+	s.indexForSearch(SearchKindAccount, account.ID, "number", account.Number)
+	sum := s.summaryFor(account.UserID)
+	sum.Accounts++
+	sum.TotalBalance = sum.TotalBalance.Add(account.Balance)
+	return nil
+}
+
+func (s *InMemoryStorage) GetAccount(ctx context.Context, accountID string) (Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acc, ok := s.accounts[accountID]
+	return acc, ok
+}
+
+func (s *InMemoryStorage) GetAccountByNumber(ctx context.Context, number string) (Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accountID, ok := s.numberIndex[number]
+	if !ok {
+		return Account{}, false
+	}
+	acc, ok := s.accounts[accountID]
+	return acc, ok
+}
+
+func (s *InMemoryStorage) GetUserAccounts(ctx context.Context, userID string) []Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accountIDs := s.accountIndex[userID]
+	accounts := make([]Account, 0, len(accountIDs))
+	for _, id := range accountIDs {
+		if acc, ok := s.accounts[id]; ok {
+			accounts = append(accounts, acc)
+		}
+	}
+	return accounts
+}
+
+// GetOrganizationAccounts — расчётные счета организации
+func (s *InMemoryStorage) GetOrganizationAccounts(ctx context.Context, orgID string) []Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accounts := make([]Account, 0, len(s.orgAccountIndex[orgID]))
+	for _, id := range s.orgAccountIndex[orgID] {
+		if acc, ok := s.accounts[id]; ok {
+			accounts = append(accounts, acc)
+		}
+	}
+	return accounts
+}
+
+// AddOrganization регистрирует организацию; ИНН уникален, участники должны существовать
+func (s *InMemoryStorage) AddOrganization(ctx context.Context, org Organization) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.organizations {
+		if existing.TaxID == org.TaxID {
+			return conflictf("organization with tax ID %s already exists", org.TaxID)
+		}
+	}
+	for _, m := range org.Members {
+		if _, exists := s.users[m.UserID]; !exists {
+			return notFoundCodef(CodeUserNotFound, "user %s not found", m.UserID)
+		}
+	}
+	s.organizations[org.ID] = org
+	for _, m := range org.Members {
+		s.orgIndex[m.UserID] = append(s.orgIndex[m.UserID], org.ID)
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) GetOrganization(ctx context.Context, orgID string) (Organization, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	org, ok := s.organizations[orgID]
+	return org, ok
+}
+
+// GetUserOrganizations — организации, где пользователь участник
+func (s *InMemoryStorage) GetUserOrganizations(ctx context.Context, userID string) []Organization {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	orgs := make([]Organization, 0, len(s.orgIndex[userID]))
+	for _, id := range s.orgIndex[userID] {
+		if org, ok := s.organizations[id]; ok {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// UpdateOrganization атомарно меняет организацию; изменения состава участников переносятся в индекс по пользователям
+func (s *InMemoryStorage) UpdateOrganization(ctx context.Context, orgID string, update func(*Organization) error) (Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return Organization{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org, ok := s.organizations[orgID]
+	if !ok {
+		return Organization{}, notFoundCodef(CodeOrgNotFound, "organization %s not found", orgID)
+	}
+	before := org
+	org.Members = append([]OrgMember(nil), org.Members...)
+	if err := update(&org); err != nil {
+		return Organization{}, err
+	}
+	for _, m := range org.Members {
+		if _, exists := s.users[m.UserID]; !exists {
+			return Organization{}, notFoundCodef(CodeUserNotFound, "user %s not found", m.UserID)
+		}
+	}
+	s.organizations[orgID] = org
+	for _, m := range before.Members {
+		if _, still := org.Member(m.UserID); !still {
+			ids := s.orgIndex[m.UserID]
+			for i, id := range ids {
+				if id == orgID {
+					s.orgIndex[m.UserID] = append(ids[:i:i], ids[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	for _, m := range org.Members {
+		if _, was := before.Member(m.UserID); !was {
+			s.orgIndex[m.UserID] = append(s.orgIndex[m.UserID], orgID)
+		}
+	}
+	return org, nil
+}
+
+func (s *InMemoryStorage) AddPaymentApproval(ctx context.Context, approval PaymentApproval) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.organizations[approval.OrganizationID]; !exists {
+		return notFoundCodef(CodeOrgNotFound, "organization %s not found", approval.OrganizationID)
+	}
+	if _, exists := s.accounts[approval.FromAccountID]; !exists {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", approval.FromAccountID)
+	}
+	s.paymentApprovals[approval.ID] = approval
+	return nil
+}
+
+func (s *InMemoryStorage) GetPaymentApproval(ctx context.Context, id string) (PaymentApproval, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	approval, ok := s.paymentApprovals[id]
+	return approval, ok
+}
+
+// ListPaymentApprovals — переводы организации на подтверждении по статусу (пусто — все); новые сверху
+func (s *InMemoryStorage) ListPaymentApprovals(ctx context.Context, orgID, status string) []PaymentApproval {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]PaymentApproval, 0)
+	for _, approval := range s.paymentApprovals {
+		if approval.OrganizationID == orgID && (status == "" || approval.Status == status) {
+			result = append(result, approval)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+func (s *InMemoryStorage) UpdatePaymentApproval(ctx context.Context, id string, update func(*PaymentApproval) error) (PaymentApproval, error) {
+	if err := ctx.Err(); err != nil {
+		return PaymentApproval{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	approval, ok := s.paymentApprovals[id]
+	if !ok {
+		return PaymentApproval{}, notFoundCodef(CodeApprovalNotFound, "payment approval %s not found", id)
+	}
+	if err := update(&approval); err != nil {
+		return PaymentApproval{}, err
+	}
+	s.paymentApprovals[id] = approval
+	return approval, nil
+}
+
+func (s *InMemoryStorage) ListAccounts(ctx context.Context) []Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accounts := make([]Account, 0, len(s.accounts))
+	for _, acc := range s.accounts {
+		accounts = append(accounts, acc)
+	}
+	return accounts
+}
+
+func (s *InMemoryStorage) ListUsers(ctx context.Context) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return users
+}
+
+func (s *InMemoryStorage) AccrueInterest(ctx context.Context, accountID string, amount decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	acc.AccruedInterest = acc.AccruedInterest.Add(amount)
+	return s.casAccounts(&acc)
+}
+
+// SetAccountInterestRate меняет годовую ставку на остаток; уже начисленные проценты не пересчитываются
+func (s *InMemoryStorage) SetAccountInterestRate(ctx context.Context, accountID string, rate decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	acc.InterestRate = rate
+	return s.casAccounts(&acc)
+}
+
+// PostAccruedInterest переносит накопленные проценты/комиссии на баланс одной транзакцией.
+// Комиссия за хранение не списывается сверх имеющегося остатка.
+func (s *InMemoryStorage) PostAccruedInterest(ctx context.Context, accountID string, now time.Time) (Transaction, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return Transaction{}, false, notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+
+	posting := planAccrued(acc, now)
+	posting.apply(&acc)
+	if err := s.casAccounts(&acc); err != nil {
+		return Transaction{}, false, err
+	}
+	tx, posted := s.commitAccrued(acc, posting, now)
+	if posted && tx.ToAccountID == acc.ID {
+		s.offsetReceivables(acc.ID, tx.ID, now)
+	}
+	return tx, posted, nil
+}
+
+// accrualPosting — проводка накопленных процентов или комиссии, рассчитанная без записи в хранилище
+type accrualPosting struct {
+	tx        Transaction
+	amount    decimal.Decimal // изменение остатка: проценты положительные, комиссия отрицательная
+	shortfall decimal.Decimal // часть комиссии, не покрытая остатком
+}
+
+// planAccrued рассчитывает проводку накопленного по счёту. Комиссия за хранение не списывается сверх остатка.
+func planAccrued(acc Account, now time.Time) accrualPosting {
+	amount := acc.AccruedInterest.RoundBank(CurrencyScale(acc.Currency))
+	var shortfall decimal.Decimal
+	if amount.IsNegative() && acc.Balance.Add(amount).IsNegative() {
+		shortfall = acc.Balance.Add(amount).Neg()
+		amount = acc.Balance.Neg()
+	}
+	posting := accrualPosting{amount: amount, shortfall: shortfall}
+	if amount.IsZero() {
+		return posting
+	}
+
+	posting.tx = Transaction{
+		ID:        GenerateID(),
+		Amount:    amount.Abs(),
+		Timestamp: now,
+	}
+	if amount.IsPositive() {
+		posting.tx.ToAccountID = acc.ID
+		posting.tx.TransactionType = "interest"
+		posting.tx.Describe(DescInterest, map[string]string{"period": now.Format("2006-01")})
+	} else {
+		posting.tx.FromAccountID = acc.ID
+		posting.tx.TransactionType = "custody_fee"
+		posting.tx.Describe(DescCustodyFee, map[string]string{"currency": acc.Currency, "period": now.Format("2006-01")})
+	}
+	return posting
+}
+
+// apply переносит проводку на копию счёта; в хранилище ничего не пишется
+func (p accrualPosting) apply(acc *Account) {
+	acc.AccruedInterest = decimal.Zero
+	acc.Balance = acc.Balance.Add(p.amount)
+	acc.refreshAvailable()
+}
+
+// commitAccrued записывает проводку в журнал и сводку, а непокрытую комиссию — в задолженность.
+// Вызывающий должен удерживать s.mu и уже сохранить счёт с применённой проводкой.
+func (s *InMemoryStorage) commitAccrued(acc Account, p accrualPosting, now time.Time) (Transaction, bool) {
+	if p.shortfall.IsPositive() {
+		// Непокрытая часть комиссии за хранение не теряется, а становится задолженностью
+		s.recordReceivable(Receivable{ID: GenerateID(), Amount: p.shortfall, Reason: "custody_fee"}, acc, "", now)
+	}
+	if p.amount.IsZero() {
+		return Transaction{}, false
+	}
+	s.adjustSummaryBalance(acc.UserID, p.amount)
+	s.appendTransaction(p.tx)
+	return p.tx, true
+}
+
+// ChargeMonthlyFee списывает плату за обслуживание fee (в валюте счёта) за месяц now. Плата за месяц
+// списывается один раз и не больше доступного остатка (за вычетом холдов); остальное становится задолженностью.
+func (s *InMemoryStorage) ChargeMonthlyFee(ctx context.Context, accountID string, fee decimal.Decimal, now time.Time) (Transaction, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return Transaction{}, false, notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	period := now.Format("2006-01")
+	if acc.IsClosed() || acc.MonthlyFeePeriod == period {
+		return Transaction{}, false, nil
+	}
+
+	amount := fee.RoundBank(CurrencyScale(acc.Currency))
+	shortfall := decimal.Zero
+	if acc.AvailableBalance.LessThan(amount) {
+		shortfall = amount.Sub(decimal.Max(acc.AvailableBalance, decimal.Zero))
+		amount = amount.Sub(shortfall)
+	}
+	acc.Balance = acc.Balance.Sub(amount)
+	acc.MonthlyFeePeriod = period
+	acc.refreshAvailable()
+	if err := s.casAccounts(&acc); err != nil {
+		return Transaction{}, false, err
+	}
+	if shortfall.IsPositive() {
+		s.recordReceivable(Receivable{ID: GenerateID(), Amount: shortfall, Reason: "monthly_fee"}, acc, "", now)
+	}
+	if !amount.IsPositive() {
+		return Transaction{}, false, nil
+	}
+	tx := Transaction{
+		ID:              GenerateID(),
+		FromAccountID:   acc.ID,
+		Amount:          amount,
+		Timestamp:       now,
+		TransactionType: "monthly_fee",
+	}
+	tx.Describe(DescMonthlyFee, map[string]string{"period": period})
+	s.adjustSummaryBalance(acc.UserID, amount.Neg())
+	s.appendTransaction(tx)
+	return tx, true, nil
+}
+
+// CloseAccount закрывает счёт одной операцией: доначисляет проценты и комиссии за день закрытия,
+// проводит накопленное и переводит остаток на payoutAccountID (счёт того же владельца и валюты)
+func (s *InMemoryStorage) CloseAccount(ctx context.Context, accountID, payoutAccountID string, now time.Time) (AccountClosure, error) {
+	if err := ctx.Err(); err != nil {
+		return AccountClosure{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return AccountClosure{}, notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	if acc.IsClosed() {
+		return AccountClosure{}, accountClosedError(accountID)
+	}
+	if acc.HeldAmount.IsPositive() {
+		return AccountClosure{}, conflictf("account %s has pending authorizations", accountID)
+	}
+	for _, loanID := range s.loanIndex[acc.UserID] {
+		if loan := s.loans[loanID]; loan.AccountID == accountID && loan.RemainingAmount.IsPositive() {
+			return AccountClosure{}, conflictf("account %s services an outstanding loan %s", accountID, loanID)
+		}
+	}
+	for _, id := range s.receivableIndex[acc.UserID] {
+		if rec := s.receivables[id]; rec.AccountID == accountID && rec.Status == ReceivableOpen {
+			return AccountClosure{}, conflictf("account %s has an outstanding receivable %s", accountID, id)
+		}
+	}
+
+	var payout Account
+	if payoutAccountID != "" {
+		if payout, ok = s.accounts[payoutAccountID]; !ok {
+			return AccountClosure{}, notFoundCodef(CodeAccountNotFound, "payout account %s not found", payoutAccountID)
+		}
+		if payout.ID == acc.ID || payout.UserID != acc.UserID || payout.Currency != acc.Currency || payout.IsClosed() {
+			return AccountClosure{}, &StorageError{Kind: ErrInvalidInput, Message: "payout account must be another open account of the same owner and currency"}
+		}
+	}
+
+	// Проводки и задолженности пишутся, только когда закрытие точно состоится
+	closure := AccountClosure{ClosedAt: now}
+	acc.AccruedInterest = acc.AccruedInterest.Add(DailyAccrual(acc))
+	settlement := planAccrued(acc, now)
+	settlement.apply(&acc)
+
+	changed := []*Account{&acc}
+	var payoutTx *Transaction
+	if acc.Balance.IsPositive() {
+		if payoutAccountID == "" {
+			return AccountClosure{}, &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("account %s has a remaining balance, payout_account_id is required", accountID)}
+		}
+		payoutTx = &Transaction{
+			ID:              GenerateID(),
+			FromAccountID:   acc.ID,
+			ToAccountID:     payout.ID,
+			Amount:          acc.Balance,
+			Timestamp:       now,
+			TransactionType: "closure_payout",
+		}
+		payoutTx.Describe(DescClosurePayout, map[string]string{"from": acc.Number, "to": payout.Number})
+		payout.Balance = payout.Balance.Add(acc.Balance)
+		payout.refreshAvailable()
+		acc.Balance = decimal.Zero
+		acc.refreshAvailable()
+		changed = append(changed, &payout)
+	}
+
+	acc.Status = AccountStatusClosed
+	acc.ClosedAt = &now
+	if err := s.casAccounts(changed...); err != nil {
+		return AccountClosure{}, err
+	}
+	if tx, posted := s.commitAccrued(acc, settlement, now); posted {
+		closure.Settlement = &tx
+	}
+	if payoutTx != nil {
+		s.appendTransaction(*payoutTx)
+		closure.Payout = payoutTx
+	}
+	closure.Account = acc
+	return closure, nil
+}
+
+func (s *InMemoryStorage) UpdateAccountBalance(ctx context.Context, accountID string, amount decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	if acc.IsClosed() {
+		return accountClosedError(accountID)
+	}
+
+	newBalance := acc.Balance.Add(amount)
+	if newBalance.IsNegative() || (amount.IsNegative() && newBalance.LessThan(acc.HeldAmount)) {
+		return &StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("insufficient funds on account %s", accountID)}
+	}
+
+	acc.Balance = newBalance
+	acc.refreshAvailable()
+	if err := s.casAccounts(&acc); err != nil {
+		return err
+	}
+	s.adjustSummaryBalance(acc.UserID, amount)
+	return nil
+}
+
+// TransferFunds атомарно переводит amount между счетами одной валюты и записывает транзакцию
+func (s *InMemoryStorage) TransferFunds(ctx context.Context, fromAccountID, toAccountID string, amount decimal.Decimal, now time.Time) (Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, ok := s.accounts[fromAccountID]
+	if !ok {
+		return Transaction{}, notFoundCodef(CodeAccountNotFound, "source account %s not found", fromAccountID)
+	}
+	to, ok := s.accounts[toAccountID]
+	if !ok {
+		return Transaction{}, notFoundCodef(CodeAccountNotFound, "destination account %s not found", toAccountID)
+	}
+	if from.IsClosed() {
+		return Transaction{}, accountClosedError(from.ID)
+	}
+	if to.IsClosed() {
+		return Transaction{}, accountClosedError(to.ID)
+	}
+	if from.Currency != to.Currency {
+		return Transaction{}, &StorageError{Kind: ErrInvalidInput, Message: "accounts have different currencies, use /exchange"}
+	}
+	if from.AvailableBalance.LessThan(amount) {
+		return Transaction{}, &StorageError{Kind: ErrInsufficientFunds, Message: "insufficient funds in source account"}
+	}
+
+	from.Balance = from.Balance.Sub(amount)
+	to.Balance = to.Balance.Add(amount)
+	from.refreshAvailable()
+	to.refreshAvailable()
+	if err := s.casAccounts(&from, &to); err != nil {
+		return Transaction{}, err
+	}
+	s.adjustSummaryBalance(from.UserID, amount.Neg())
+	s.adjustSummaryBalance(to.UserID, amount)
+
+	tx := Transaction{
+		ID:              GenerateID(),
+		FromAccountID:   from.ID,
+		ToAccountID:     to.ID,
+		Amount:          amount,
+		Timestamp:       now,
+		TransactionType: "transfer",
+	}
+	tx.Describe(DescTransfer, map[string]string{"from": from.Number, "to": to.Number})
+	s.appendTransaction(tx)
+	return tx, nil
+}
+
+// ExchangeFunds атомарно списывает и зачисляет средства по двум связанным транзакциям
+func (s *InMemoryStorage) ExchangeFunds(ctx context.Context, outTx, inTx Transaction, debit, credit decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, ok := s.accounts[outTx.FromAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", outTx.FromAccountID)
+	}
+	to, ok := s.accounts[inTx.ToAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", inTx.ToAccountID)
+	}
+	if from.IsClosed() || to.IsClosed() {
+		return &StorageError{Kind: ErrConflict, Code: CodeAccountClosed, Message: "exchange involves a closed account"}
+	}
+	if from.AvailableBalance.LessThan(debit) {
+		return &StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("insufficient funds on account %s", from.ID)}
+	}
+
+	from.Balance = from.Balance.Sub(debit)
+	to.Balance = to.Balance.Add(credit)
+	from.refreshAvailable()
+	to.refreshAvailable()
+	if err := s.casAccounts(&from, &to); err != nil {
+		return err
+	}
+	s.adjustSummaryBalance(from.UserID, debit.Neg())
+	s.adjustSummaryBalance(to.UserID, credit)
+
+	s.appendTransaction(outTx)
+	s.appendTransaction(inTx)
+	return nil
+}
+
+// PostBackdatedTransaction проводит перенесённую операцию с датой валютирования в прошлом: меняет остатки
+// сторон (у любой из них может не быть счёта в банке) и записывает транзакцию. ExternalRef проверяется
+// на уникальность, чтобы повторный прогон миграции не задвоил историю.
+func (s *InMemoryStorage) PostBackdatedTransaction(ctx context.Context, tx Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.externalRefs[tx.ExternalRef]; ok {
+		return conflictf("transaction with external reference %s already posted as %s", tx.ExternalRef, existing)
+	}
+
+	var from, to Account
+	if tx.FromAccountID != "" {
+		acc, ok := s.accounts[tx.FromAccountID]
+		if !ok {
+			return notFoundCodef(CodeAccountNotFound, "source account %s not found", tx.FromAccountID)
+		}
+		if acc.IsClosed() {
+			return accountClosedError(acc.ID)
+		}
+		if acc.AvailableBalance.LessThan(tx.Amount) {
+			return &StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("insufficient funds on account %s", acc.ID)}
+		}
+		from = acc
+	}
+	if tx.ToAccountID != "" {
+		acc, ok := s.accounts[tx.ToAccountID]
+		if !ok {
+			return notFoundCodef(CodeAccountNotFound, "destination account %s not found", tx.ToAccountID)
+		}
+		if acc.IsClosed() {
+			return accountClosedError(acc.ID)
+		}
+		to = acc
+	}
+	if from.ID != "" && to.ID != "" && from.Currency != to.Currency {
+		return &StorageError{Kind: ErrInvalidInput, Message: "accounts have different currencies"}
+	}
+
+	var changed []*Account
+	if from.ID != "" {
+		from.Balance = from.Balance.Sub(tx.Amount)
+		from.refreshAvailable()
+		changed = append(changed, &from)
+	}
+	if to.ID != "" {
+		to.Balance = to.Balance.Add(tx.Amount)
+		to.refreshAvailable()
+		changed = append(changed, &to)
+	}
+	if err := s.casAccounts(changed...); err != nil {
+		return err
+	}
+	if from.ID != "" {
+		s.adjustSummaryBalance(from.UserID, tx.Amount.Neg())
+	}
+	if to.ID != "" {
+		s.adjustSummaryBalance(to.UserID, tx.Amount)
+	}
+	s.externalRefs[tx.ExternalRef] = tx.ID
+	s.appendTransaction(tx)
+	return nil
+}
+
+// AddImportedTransactions сохраняет операции из выписки другого банка рядом с журналом, не трогая остатки.
+// Операции с уже загруженным для этого счёта ExternalRef пропускаются; возвращаются добавленные.
+func (s *InMemoryStorage) AddImportedTransactions(ctx context.Context, accountID string, txs []Transaction) ([]Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[accountID]; !ok {
+		return nil, notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	added := make([]Transaction, 0, len(txs))
+	for _, tx := range txs {
+		key := accountID + "/" + tx.ExternalRef
+		if _, exists := s.importedRefs[key]; exists {
+			continue
+		}
+		s.importedRefs[key] = tx.ID
+		s.importedTxs[accountID] = append(s.importedTxs[accountID], tx)
+		added = append(added, tx)
+	}
+	return added, nil
+}
+
+// GetImportedTransactions — операции, загруженные из выписок других банков для счёта
+func (s *InMemoryStorage) GetImportedTransactions(ctx context.Context, accountID string) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Transaction(nil), s.importedTxs[accountID]...)
+}
+
+func (s *InMemoryStorage) AddTransaction(ctx context.Context, tx Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendTransaction(tx)
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) appendTransaction(tx Transaction) {
+	if tx.BookingDate.IsZero() {
+		tx.BookingDate = tx.Timestamp
+	}
+	if tx.ValueDate.IsZero() {
+		tx.ValueDate = tx.BookingDate
+	}
+	s.accrueBackValue(tx)
+	tx = s.recordTransaction(tx)
+	s.bump(CollectionTransactions)
+	s.publishTransaction(tx)
+
+	// Проценты зачисляются до сохранения счёта, их зачёт делает PostAccruedInterest
+	if tx.ToAccountID != "" && tx.TransactionType != "interest" {
+		s.offsetReceivables(tx.ToAccountID, tx.ID, tx.Timestamp)
+	}
+}
+
+// recordTransaction кладёт транзакцию в журнал и индексы без побочных эффектов. Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) recordTransaction(tx Transaction) Transaction {
+	tx.Amount = NormalizeAmount(tx.Amount, s.transactionCurrency(tx))
+	pos := len(s.archivedTxs) + len(s.transactions)
+	tx.Sequence = int64(pos + 1)
+	if parentPos, ok := s.txByID[tx.LinkedTxID]; ok {
+		parent := s.journalAt(parentPos)
+		if tx.GroupID == "" {
+			tx.GroupID = parent.GroupID
+			if tx.GroupID == "" {
+				tx.GroupID = tx.LinkedTxID
+			}
+		}
+		if tx.CardID == "" {
+			tx.CardID = parent.CardID
+		}
+	}
+	s.transactions = append(s.transactions, tx)
+	s.txByID[tx.ID] = pos
+	if tx.GroupID != "" {
+		s.txGroups[tx.GroupID] = append(s.txGroups[tx.GroupID], pos)
+	}
+	if tx.MerchantID != "" {
+		s.merchantTxIndex[tx.MerchantID] = append(s.merchantTxIndex[tx.MerchantID], pos)
+	}
+	if tx.CardID != "" {
+		s.cardTxIndex[tx.CardID] = append(s.cardTxIndex[tx.CardID], pos)
+	}
+	if tx.FromAccountID != "" && OutgoingDebitTypes[tx.TransactionType] {
+		s.debitTxIndex[tx.FromAccountID] = append(s.debitTxIndex[tx.FromAccountID], pos)
+	}
+
+	seen := make(map[string]bool)
+	for _, term := range tokenize(tx.Description + " " + tx.Merchant) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		s.descIndex[term] = append(s.descIndex[term], pos)
+	}
+	return tx
+}
+
+// transactionCurrency — валюта проводки по счёту списания или зачисления. Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) transactionCurrency(tx Transaction) string {
+	for _, id := range []string{tx.FromAccountID, tx.ToAccountID} {
+		if acc, ok := s.accounts[id]; ok {
+			return acc.Currency
+		}
+	}
+	return BaseCurrency
+}
+
+// LoadTransactions массово загружает готовые проводки (генератор нагрузочных данных): остатки меняются без
+// проверки средств, события и вебхуки не публикуются. Пакет применяется целиком или не применяется вовсе.
+func (s *InMemoryStorage) LoadTransactions(ctx context.Context, txs []Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deltas := make(map[string]decimal.Decimal)
+	for _, tx := range txs {
+		for _, side := range []struct {
+			accountID string
+			delta     decimal.Decimal
+		}{{tx.FromAccountID, tx.Amount.Neg()}, {tx.ToAccountID, tx.Amount}} {
+			if side.accountID == "" {
+				continue
+			}
+			if _, ok := s.accounts[side.accountID]; !ok {
+				return notFoundCodef(CodeAccountNotFound, "account %s not found", side.accountID)
+			}
+			deltas[side.accountID] = deltas[side.accountID].Add(side.delta)
+		}
+	}
+
+	for accountID, delta := range deltas {
+		acc := s.accounts[accountID]
+		acc.Balance = acc.Balance.Add(delta)
+		acc.refreshAvailable()
+		s.putAccount(&acc)
+		s.adjustSummaryBalance(acc.UserID, delta)
+	}
+	for _, tx := range txs {
+		if tx.BookingDate.IsZero() {
+			tx.BookingDate = tx.Timestamp
+		}
+		if tx.ValueDate.IsZero() {
+			tx.ValueDate = tx.BookingDate
+		}
+		s.recordTransaction(tx)
+	}
+	s.bump(CollectionTransactions)
+	return nil
+}
+
+// accrueBackValue доначисляет проценты за дни между датой валютирования и датой проводки: остаток уже
+// изменён операцией, поэтому разница дневного начисления «после» и «до» умножается на число пропущенных дней.
+// Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) accrueBackValue(tx Transaction) {
+	days := int(startOfDay(tx.BookingDate).Sub(startOfDay(tx.ValueDate)).Hours() / 24)
+	if days <= 0 || tx.TransactionType == "interest" || tx.TransactionType == "custody_fee" {
+		return
+	}
+	for _, side := range []struct {
+		accountID string
+		delta     decimal.Decimal
+	}{{tx.FromAccountID, tx.Amount.Neg()}, {tx.ToAccountID, tx.Amount}} {
+		acc, ok := s.accounts[side.accountID]
+		if !ok || acc.IsClosed() {
+			continue
+		}
+		before := acc
+		before.Balance = acc.Balance.Sub(side.delta)
+		adjustment := DailyAccrual(acc).Sub(DailyAccrual(before)).Mul(decimal.NewFromInt(int64(days)))
+		if adjustment.IsZero() {
+			continue
+		}
+		acc.AccruedInterest = acc.AccruedInterest.Add(adjustment)
+		s.putAccount(&acc)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Вызывающий должен удерживать s.mu; публикация в шину неблокирующая
+func (s *InMemoryStorage) publishTransaction(tx Transaction) {
+	for _, accountID := range []string{tx.FromAccountID, tx.ToAccountID} {
+		if acc, ok := s.accounts[accountID]; ok {
+			s.events.Publish(Event{
+				Type:      EventTransactionCreated,
+				UserID:    acc.UserID,
+				AccountID: acc.ID,
+				Payload:   tx,
+				Timestamp: tx.Timestamp,
+			})
+		}
+	}
+}
+
+// journalAt — проводка по индексу журнала: индексы сквозные, начало журнала может лежать в архиве.
+// Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) journalAt(pos int) Transaction {
+	if pos < len(s.archivedTxs) {
+		return s.archivedTxs[pos]
+	}
+	return s.transactions[pos-len(s.archivedTxs)]
+}
+
+// ArchiveTransactions переносит в архив начало журнала — проводки, у которых и дата валютирования, и дата проводки
+// раньше cutoff, вплоть до первой более новой. Порядковые номера сохраняются, обороты архивных проводок копятся
+// по счетам, чтобы сверка остатков с журналом сходилась. Из горячих индексов (поиск, группы, карты, мерчанты,
+// списания, поиск по ID) архивные проводки убираются. Возвращает число перенесённых проводок.
+func (s *InMemoryStorage) ArchiveTransactions(ctx context.Context, cutoff, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for n < len(s.transactions) {
+		tx := s.transactions[n]
+		if !tx.EffectiveDate().Before(cutoff) || !tx.BookedAt().Before(cutoff) {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	base := len(s.archivedTxs)
+	for i, tx := range s.transactions[:n] {
+		pos := base + i
+		s.archivedTxs = append(s.archivedTxs, tx)
+		s.archiveIndex[tx.FromAccountID] = append(s.archiveIndex[tx.FromAccountID], pos)
+		if tx.ToAccountID != tx.FromAccountID {
+			s.archiveIndex[tx.ToAccountID] = append(s.archiveIndex[tx.ToAccountID], pos)
+		}
+		addLedgerTotals(s.archivedTotals, tx)
+		if tx.EffectiveDate().After(s.archiveHorizon) {
+			s.archiveHorizon = tx.EffectiveDate()
+		}
+		delete(s.txByID, tx.ID)
+	}
+	delete(s.archiveIndex, "")
+
+	// Индексы упорядочены по возрастанию, архивные позиции — их начало
+	hot := base + n
+	for _, index := range []map[string][]int{s.descIndex, s.txGroups, s.merchantTxIndex, s.cardTxIndex, s.debitTxIndex} {
+		for key, positions := range index {
+			i := sort.SearchInts(positions, hot)
+			switch {
+			case i == len(positions):
+				delete(index, key)
+			case i > 0:
+				index[key] = append([]int(nil), positions[i:]...)
+			}
+		}
+	}
+	s.transactions = append([]Transaction(nil), s.transactions[n:]...)
+	s.archivedAt = now
+	s.bump(CollectionTransactions)
+	return n, nil
+}
+
+// GetArchivedTransactions — архивные проводки счёта с датой валютирования не раньше since, в порядке журнала
+func (s *InMemoryStorage) GetArchivedTransactions(ctx context.Context, accountID string, since time.Time) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if since.After(s.archiveHorizon) {
+		return nil
+	}
+	var result []Transaction
+	for _, pos := range s.archiveIndex[accountID] {
+		if tx := s.archivedTxs[pos]; !tx.EffectiveDate().Before(since) {
+			result = append(result, tx)
+		}
+	}
+	return result
+}
+
+func (s *InMemoryStorage) TransactionArchiveStats(ctx context.Context) TransactionArchiveStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := TransactionArchiveStats{
+		ArchivedTransactions: len(s.archivedTxs),
+		HotTransactions:      len(s.transactions),
+		ArchivedAccounts:     len(s.archiveIndex),
+	}
+	if len(s.archivedTxs) > 0 {
+		horizon, archivedAt := s.archiveHorizon, s.archivedAt
+		stats.ArchivedThrough = &horizon
+		stats.LastArchivedAt = &archivedAt
+	}
+	return stats
+}
+
+// GetAccountTransactionsSince возвращает транзакции счёта с порядковым номером больше since; архив не читается
+func (s *InMemoryStorage) GetAccountTransactionsSince(ctx context.Context, accountID string, since int64) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var accountTxs []Transaction
+	start := s.hotStart(since)
+	for _, tx := range s.transactions[start:] {
+		if tx.FromAccountID == accountID || tx.ToAccountID == accountID {
+			accountTxs = append(accountTxs, tx)
+		}
+	}
+	return accountTxs
+}
+
+// GetAccountTransactionsBatch — не больше limit транзакций счёта с порядковым номером больше since, по возрастанию
+// номера, начиная с архива. Выгрузка читает журнал такими порциями и не держит блокировку, пока отдаёт их клиенту.
+func (s *InMemoryStorage) GetAccountTransactionsBatch(ctx context.Context, accountID string, since int64, limit int) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var accountTxs []Transaction
+	if since >= 0 {
+		archived := s.archiveIndex[accountID]
+		for i := sort.SearchInts(archived, int(since)); i < len(archived) && len(accountTxs) < limit; i++ {
+			accountTxs = append(accountTxs, s.archivedTxs[archived[i]])
+		}
+		if len(accountTxs) == limit {
+			return accountTxs
+		}
+	}
+	start := s.hotStart(since)
+	for _, tx := range s.transactions[start:] {
+		if tx.FromAccountID == accountID || tx.ToAccountID == accountID {
+			accountTxs = append(accountTxs, tx)
+			if len(accountTxs) == limit {
+				break
+			}
+		}
+	}
+	return accountTxs
+}
+
+// hotStart — индекс в горячем журнале первой операции с порядковым номером больше since.
+// Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) hotStart(since int64) int {
+	start := int(since) - len(s.archivedTxs)
+	switch {
+	case since < 0 || start > len(s.transactions):
+		return len(s.transactions)
+	case start < 0:
+		return 0
+	}
+	return start
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchUserTransactions ищет по индексу описаний: каждый термин запроса сопоставляется
+// с терминами индекса по префиксу, релевантность — число совпавших терминов запроса.
+func (s *InMemoryStorage) SearchUserTransactions(ctx context.Context, userID, query string) []TransactionSearchResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userAccounts := make(map[string]bool)
+	for _, id := range s.accountIndex[userID] {
+		userAccounts[id] = true
+	}
+
+	scores := make(map[int]int)
+	for _, queryTerm := range UniqueTerms(tokenize(query)) {
+		matched := make(map[int]bool)
+		for term, postings := range s.descIndex {
+			if !strings.HasPrefix(term, queryTerm) {
+				continue
+			}
+			for _, pos := range postings {
+				matched[pos] = true
+			}
+		}
+		for pos := range matched {
+			tx := s.journalAt(pos)
+			if userAccounts[tx.FromAccountID] || userAccounts[tx.ToAccountID] {
+				scores[pos]++
+			}
+		}
+	}
+
+	results := make([]TransactionSearchResult, 0, len(scores))
+	for pos, score := range scores {
+		results = append(results, TransactionSearchResult{Transaction: s.journalAt(pos), Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].EffectiveDate().After(results[j].EffectiveDate())
+	})
+	return results
+}
+
+type searchEntry struct {
+	Kind  string
+	ID    string
+	Field string
+	Value string // нормализованное значение поля, по нему проверяется совпадение кандидата
+}
+
+const MinSearchQueryLen = 3
+
+func trigrams(s string) []string {
+	runes := []rune(s)
+	if len(runes) < MinSearchQueryLen {
+		return nil
+	}
+	grams := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return UniqueTerms(grams)
+}
+
+// Вызывающий должен удерживать s.mu. Логины, email и номера счетов не меняются после создания,
+// поэтому индекс только пополняется.
+func (s *InMemoryStorage) indexForSearch(kind, id, field, value string) {
+	entry := searchEntry{Kind: kind, ID: id, Field: field, Value: strings.ToLower(value)}
+	for _, gram := range trigrams(entry.Value) {
+		s.searchIndex[gram] = append(s.searchIndex[gram], entry)
+	}
+}
+
+// AdminSearch ищет по фрагменту номера счёта, последним 4 цифрам карты, логину и email.
+// Кандидаты берутся из самого короткого списка триграмм запроса, поэтому полного перебора нет;
+// ранжирование: точное совпадение, затем префикс/суффикс, затем вхождение.
+func (s *InMemoryStorage) AdminSearch(ctx context.Context, query string, limit int) []AdminSearchResult {
+	q := strings.ToLower(strings.Join(strings.Fields(query), ""))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best := make(map[string]AdminSearchResult)
+	consider := func(res AdminSearchResult) {
+		key := res.Kind + ":" + res.ID
+		if prev, ok := best[key]; !ok || res.Score > prev.Score {
+			best[key] = res
+		}
+	}
+
+	if len(q) == 4 && isDigits(q) {
+		for _, cardID := range s.panLast4Index[q] {
+			card := s.cards[cardID]
+			res := AdminSearchResult{Kind: SearchKindCard, ID: card.ID, Label: MaskPAN(card.Number), MatchedField: "pan_last4", Score: 3}
+			if acc, ok := s.accounts[card.AccountID]; ok {
+				res.UserID = acc.UserID
+			}
+			consider(res)
+		}
+	}
+
+	var candidates []searchEntry
+	for i, gram := range trigrams(q) {
+		postings := s.searchIndex[gram]
+		if i == 0 || len(postings) < len(candidates) {
+			candidates = postings
+		}
+	}
+	for _, entry := range candidates {
+		score := matchScore(entry.Value, q)
+		if score == 0 {
+			continue
+		}
+		res := AdminSearchResult{Kind: entry.Kind, ID: entry.ID, MatchedField: entry.Field, Score: score}
+		switch entry.Kind {
+		case SearchKindUser:
+			user := s.users[entry.ID]
+			res.UserID, res.Label = user.ID, user.Username+" <"+user.Email+">"
+		case SearchKindAccount:
+			acc := s.accounts[entry.ID]
+			res.UserID, res.Label = acc.UserID, acc.Number+" ("+acc.Currency+")"
+		}
+		consider(res)
+	}
+
+	results := make([]AdminSearchResult, 0, len(best))
+	for _, res := range best {
+		results = append(results, res)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Kind != results[j].Kind {
+			return results[i].Kind < results[j].Kind
+		}
+		return results[i].Label < results[j].Label
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func matchScore(value, query string) int {
+	switch {
+	case value == query:
+		return 3
+	case strings.HasPrefix(value, query), strings.HasSuffix(value, query):
+		return 2
+	case strings.Contains(value, query):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func UniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	unique := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func (s *InMemoryStorage) GetTransaction(ctx context.Context, txID string) (Transaction, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pos, ok := s.txByID[txID]
+	if !ok {
+		return Transaction{}, false
+	}
+	return s.journalAt(pos), true
+}
+
+// GetTransactionDetail — транзакция с родительской операцией и всей группой, если она есть
+func (s *InMemoryStorage) GetTransactionDetail(ctx context.Context, txID string) (TransactionDetail, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pos, ok := s.txByID[txID]
+	if !ok {
+		return TransactionDetail{}, false
+	}
+	detail := TransactionDetail{Transaction: s.journalAt(pos)}
+	if parentPos, ok := s.txByID[detail.Transaction.LinkedTxID]; ok {
+		parent := s.journalAt(parentPos)
+		detail.Parent = &parent
+	}
+	rootID := detail.Transaction.GroupID
+	if rootID == "" {
+		rootID = detail.Transaction.ID
+	}
+	members := s.txGroups[rootID]
+	if len(members) == 0 {
+		return detail, true
+	}
+	if rootPos, ok := s.txByID[rootID]; ok {
+		detail.Group = append(detail.Group, s.journalAt(rootPos))
+	}
+	for _, p := range members {
+		detail.Group = append(detail.Group, s.journalAt(p))
+	}
+	return detail, true
+}
+
+func (s *InMemoryStorage) GetRefundedAmount(ctx context.Context, txID string) decimal.Decimal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if amount, ok := s.refunded[txID]; ok {
+		return amount
+	}
+	return decimal.Zero
+}
+
+// RefundPayment зачисляет возврат по платежу; сумма всех возвратов не превышает исходный платёж
+func (s *InMemoryStorage) RefundPayment(ctx context.Context, refund Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.txByID[refund.LinkedTxID]
+	if !ok {
+		return notFoundCodef(CodeTransactionNotFound, "transaction %s not found", refund.LinkedTxID)
+	}
+	original := s.journalAt(pos)
+	if original.TransactionType != "payment" {
+		return &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("transaction %s is not a card payment", original.ID)}
+	}
+
+	for _, id := range s.chargebacksByTx[original.ID] {
+		if cb := s.chargebacks[id]; !cb.IsResolved() {
+			return conflictf("payment %s is under chargeback %s", original.ID, cb.ID)
+		}
+	}
+
+	already := s.refunded[original.ID]
+	if already.Add(refund.Amount).GreaterThan(original.Amount) {
+		return &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("refund exceeds remaining refundable amount %s", original.Amount.Sub(already).String())}
+	}
+
+	acc, ok := s.accounts[original.FromAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", original.FromAccountID)
+	}
+	if acc.IsClosed() {
+		return accountClosedError(acc.ID)
+	}
+	changed := []*Account{&acc}
+	// Оплата зарегистрированному мерчанту возвращается с его расчётного счёта
+	var settlement Account
+	if original.ToAccountID != "" {
+		if settlement, ok = s.accounts[original.ToAccountID]; !ok {
+			return notFoundCodef(CodeAccountNotFound, "settlement account %s not found", original.ToAccountID)
+		}
+		if settlement.IsClosed() {
+			return accountClosedError(settlement.ID)
+		}
+		if settlement.AvailableBalance.LessThan(refund.Amount) {
+			return &StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("insufficient funds on merchant settlement account %s", settlement.ID)}
+		}
+		settlement.Balance = settlement.Balance.Sub(refund.Amount)
+		settlement.refreshAvailable()
+		changed = append(changed, &settlement)
+	}
+	acc.Balance = acc.Balance.Add(refund.Amount)
+	acc.refreshAvailable()
+	if err := s.casAccounts(changed...); err != nil {
+		return err
+	}
+	if settlement.ID != "" {
+		s.adjustSummaryBalance(settlement.UserID, refund.Amount.Neg())
+	}
+	s.adjustSummaryBalance(acc.UserID, refund.Amount)
+
+	s.refunded[original.ID] = already.Add(refund.Amount)
+	s.appendTransaction(refund)
+	return nil
+}
+
+// ReverseDeposit отменяет ошибочное пополнение в пределах окна: доступный остаток списывается проводкой reversal,
+// непокрытая часть записывается дебиторской задолженностью на счёт. Баланс при этом не уходит в минус.
+func (s *InMemoryStorage) ReverseDeposit(ctx context.Context, depositTxID string, reversal Transaction, receivable Receivable, window time.Duration, now time.Time) (DepositReversal, error) {
+	if err := ctx.Err(); err != nil {
+		return DepositReversal{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.txByID[depositTxID]
+	if !ok {
+		return DepositReversal{}, notFoundCodef(CodeTransactionNotFound, "transaction %s not found", depositTxID)
+	}
+	deposit := s.journalAt(pos)
+	if deposit.TransactionType != "deposit" {
+		return DepositReversal{}, &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("transaction %s is not a deposit", deposit.ID)}
+	}
+	if _, done := s.reversedDeposits[deposit.ID]; done {
+		return DepositReversal{}, conflictf("deposit %s has already been reversed", deposit.ID)
+	}
+	if now.Sub(deposit.Timestamp) > window {
+		return DepositReversal{}, conflictf("deposit %s is outside the %s reversal window", deposit.ID, window)
+	}
+
+	acc, ok := s.accounts[deposit.ToAccountID]
+	if !ok {
+		return DepositReversal{}, notFoundCodef(CodeAccountNotFound, "account %s not found", deposit.ToAccountID)
+	}
+	if acc.IsClosed() {
+		return DepositReversal{}, accountClosedError(acc.ID)
+	}
+
+	result := DepositReversal{Deposit: deposit}
+	debit := decimal.Min(deposit.Amount, decimal.Max(acc.AvailableBalance, decimal.Zero))
+	if debit.IsPositive() {
+		acc.Balance = acc.Balance.Sub(debit)
+		acc.refreshAvailable()
+		if err := s.casAccounts(&acc); err != nil {
+			return DepositReversal{}, err
+		}
+		s.adjustSummaryBalance(acc.UserID, debit.Neg())
+
+		reversal.FromAccountID = acc.ID
+		reversal.Amount = debit
+		reversal.TransactionType = "deposit_reversal"
+		reversal.LinkedTxID = deposit.ID
+		s.appendTransaction(reversal)
+		result.Reversal = &reversal
+		s.reversedDeposits[deposit.ID] = reversal.ID
+	}
+
+	if shortfall := deposit.Amount.Sub(debit); shortfall.IsPositive() {
+		receivable.Amount = shortfall
+		receivable = s.recordReceivable(receivable, acc, deposit.ID, now)
+		result.Receivable = &receivable
+		if result.Reversal == nil {
+			s.reversedDeposits[deposit.ID] = receivable.ID
+		}
+	}
+	return result, nil
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) recordReceivable(rec Receivable, acc Account, sourceTxID string, now time.Time) Receivable {
+	rec.UserID = acc.UserID
+	rec.AccountID = acc.ID
+	rec.SourceTxID = sourceTxID
+	rec.CreatedAt = now
+	rec.Outstanding = rec.Amount
+	rec.Status = ReceivableOpen
+	s.putReceivable(rec)
+	sum := s.summaryFor(acc.UserID)
+	sum.OutstandingReceivables = sum.OutstandingReceivables.Add(rec.Amount)
+	return rec
+}
+
+// offsetReceivables гасит открытые задолженности счёта (старые первыми) из доступного остатка
+// после поступления fundingTxID. Вызывающий должен удерживать s.mu; счёт уже сохранён.
+func (s *InMemoryStorage) offsetReceivables(accountID, fundingTxID string, now time.Time) {
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return
+	}
+	for _, id := range s.receivableIndex[acc.UserID] {
+		if !acc.AvailableBalance.IsPositive() {
+			break
+		}
+		rec := s.receivables[id]
+		if rec.AccountID != accountID || rec.Status != ReceivableOpen {
+			continue
+		}
+		amount := decimal.Min(rec.Outstanding, acc.AvailableBalance)
+
+		acc.Balance = acc.Balance.Sub(amount)
+		acc.refreshAvailable()
+		s.putAccount(&acc)
+		s.adjustSummaryBalance(acc.UserID, amount.Neg())
+
+		rec.Outstanding = rec.Outstanding.Sub(amount)
+		if rec.Outstanding.IsZero() {
+			rec.Status = ReceivableSettled
+			settledAt := now
+			rec.SettledAt = &settledAt
+		}
+		s.putReceivable(rec)
+		sum := s.summaryFor(acc.UserID)
+		sum.OutstandingReceivables = sum.OutstandingReceivables.Sub(amount)
+
+		tx := Transaction{
+			ID:              GenerateID(),
+			FromAccountID:   acc.ID,
+			Amount:          amount,
+			Timestamp:       now,
+			TransactionType: "receivable_offset",
+			LinkedTxID:      fundingTxID,
+		}
+		tx.Describe(DescReceivableOffset, map[string]string{"account": acc.Number, "receivable": rec.ID, "reason": rec.Reason})
+		s.appendTransaction(tx)
+	}
+}
+
+// ListReceivables возвращает задолженности всех клиентов; status пустой — без фильтра
+func (s *InMemoryStorage) ListReceivables(ctx context.Context, status string) []Receivable {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Receivable, 0)
+	for _, rec := range s.receivables {
+		if status == "" || rec.Status == status {
+			result = append(result, rec)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+func (s *InMemoryStorage) GetUserReceivables(ctx context.Context, userID string) []Receivable {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []Receivable
+	for _, id := range s.receivableIndex[userID] {
+		if rec, ok := s.receivables[id]; ok {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
+func (s *InMemoryStorage) GetAccountTransactions(ctx context.Context, accountID string) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var accountTxs []Transaction
+	for _, tx := range s.transactions {
+		if tx.FromAccountID == accountID || tx.ToAccountID == accountID {
+			accountTxs = append(accountTxs, tx)
+		}
+	}
+	return accountTxs
+}
+
+var cardQuotaConfig = struct {
+	MaxActivePerAccount int
+	MaxActivePerUser    int
+}{
+	MaxActivePerAccount: 3,
+	MaxActivePerUser:    10,
+}
+
+func (s *InMemoryStorage) countActiveCards(accountID string, now time.Time) int {
+	count := 0
+	for _, id := range s.cardIndex[accountID] {
+		if card, ok := s.cards[id]; ok && card.IsActive(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// Квоты проверяются под той же блокировкой, что и вставка, поэтому параллельные выпуски не превысят лимит
+func (s *InMemoryStorage) AddCard(ctx context.Context, card Card) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, exists := s.accounts[card.AccountID]
+	if !exists {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", card.AccountID)
+	}
+
+	now := time.Now()
+	if cardQuotaConfig.MaxActivePerAccount > 0 && s.countActiveCards(card.AccountID, now) >= cardQuotaConfig.MaxActivePerAccount {
+		return &StorageError{Kind: ErrQuotaExceeded, Message: fmt.Sprintf("card limit reached: account %s already has %d active cards", card.AccountID, cardQuotaConfig.MaxActivePerAccount)}
+	}
+	if cardQuotaConfig.MaxActivePerUser > 0 {
+		userCards := 0
+		for _, accountID := range s.accountIndex[account.UserID] {
+			userCards += s.countActiveCards(accountID, now)
+		}
+		if userCards >= cardQuotaConfig.MaxActivePerUser {
+			return &StorageError{Kind: ErrQuotaExceeded, Message: fmt.Sprintf("card limit reached: user %s already has %d active cards", account.UserID, cardQuotaConfig.MaxActivePerUser)}
+		}
+	}
+	s.putCard(card)
+	s.cardIndex[card.AccountID] = append(s.cardIndex[card.AccountID], card.ID)
+	if len(card.Number) >= 4 {
+		last4 := card.Number[len(card.Number)-4:]
+		s.panLast4Index[last4] = append(s.panLast4Index[last4], card.ID)
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) UpdateCardDelivery(ctx context.Context, cardID, status string, at time.Time) (Card, error) {
+	if err := ctx.Err(); err != nil {
+		return Card{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	card, ok := s.cards[cardID]
+	if !ok {
+		return Card{}, notFoundCodef(CodeCardNotFound, "card %s not found", cardID)
+	}
+	card.DeliveryStatus = status
+	card.DeliveryUpdatedAt = &at
+	s.putCard(card)
+	return card, nil
+}
+
+// HashCardCVVs заменяет открытый CVV на HMAC-хеш у карт старше cutoff; возвращает число обработанных карт
+func (s *InMemoryStorage) HashCardCVVs(ctx context.Context, cutoff time.Time, hash func(Card) string, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	processed := 0
+	for _, card := range s.cards {
+		if card.CVV == "" || card.CreatedAt.After(cutoff) {
+			continue
+		}
+		card.CVVHash = hash(card)
+		card.CVV = ""
+		card.CVVPurgedAt = &now
+		s.putCard(card)
+		processed++
+	}
+	return processed
+}
+
+func (s *InMemoryStorage) PurgeSessionClientInfo(ctx context.Context, cutoff time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for id, session := range s.sessions {
+		if !session.Revoked || session.LastSeenAt.After(cutoff) || (session.IP == "" && session.UserAgent == "") {
+			continue
+		}
+		session.IP = ""
+		session.UserAgent = ""
+		s.sessions[id] = session
+		purged++
+	}
+	return purged
+}
+
+func (s *InMemoryStorage) GetAccountCards(ctx context.Context, accountID string) []Card {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cardIDs := s.cardIndex[accountID]
+	cards := make([]Card, 0, len(cardIDs))
+	for _, id := range cardIDs {
+		if card, ok := s.cards[id]; ok {
+			cards = append(cards, card)
+		}
+	}
+	return cards
+}
+
+func (s *InMemoryStorage) GetCard(ctx context.Context, cardID string) (Card, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	card, ok := s.cards[cardID]
+	return card, ok
+}
+
+func (s *InMemoryStorage) AddCardReveal(ctx context.Context, reveal CardReveal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cardReveals[reveal.ID] = reveal
+	return nil
+}
+
+// UpdateCardReveal применяет update к запросу в статусе pending_step_up; update может вернуть ошибку,
+// изменения при этом всё равно сохраняются (так учитываются неудачные попытки ввода кода)
+func (s *InMemoryStorage) UpdateCardReveal(ctx context.Context, revealID string, update func(*CardReveal) error) (CardReveal, error) {
+	if err := ctx.Err(); err != nil {
+		return CardReveal{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reveal, ok := s.cardReveals[revealID]
+	if !ok {
+		return CardReveal{}, notFoundf("card reveal %s not found", revealID)
+	}
+	if reveal.Status != CardRevealPendingStepUp {
+		return CardReveal{}, conflictf("card reveal %s is %s", revealID, reveal.Status)
+	}
+	err := update(&reveal)
+	s.cardReveals[revealID] = reveal
+	if reveal.TokenHash != "" {
+		s.revealTokens[reveal.TokenHash] = reveal.ID
+	}
+	return reveal, err
+}
+
+// RedeemCardReveal погашает одноразовый токен: повторное или просроченное предъявление даёт ErrNotFound
+func (s *InMemoryStorage) RedeemCardReveal(ctx context.Context, tokenHash string, now time.Time) (CardReveal, Card, error) {
+	if err := ctx.Err(); err != nil {
+		return CardReveal{}, Card{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revealID, ok := s.revealTokens[tokenHash]
+	if !ok {
+		return CardReveal{}, Card{}, notFoundf("reveal token is invalid or already used")
+	}
+	delete(s.revealTokens, tokenHash)
+	reveal := s.cardReveals[revealID]
+	if reveal.Status != CardRevealReady || !now.Before(reveal.ExpiresAt) {
+		reveal.Status = CardRevealFailed
+		s.cardReveals[revealID] = reveal
+		return CardReveal{}, Card{}, notFoundf("reveal token is invalid or already used")
+	}
+	reveal.Status = CardRevealRedeemed
+	s.cardReveals[revealID] = reveal
+	card, ok := s.cards[reveal.CardID]
+	if !ok {
+		return CardReveal{}, Card{}, notFoundCodef(CodeCardNotFound, "card %s not found", reveal.CardID)
+	}
+	return reveal, card, nil
+}
+
+// ExpireCardReveals закрывает запросы, по которым не ввели код или не погасили токен в срок
+func (s *InMemoryStorage) ExpireCardReveals(ctx context.Context, now time.Time) []CardReveal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []CardReveal
+	for id, reveal := range s.cardReveals {
+		if (reveal.Status != CardRevealPendingStepUp && reveal.Status != CardRevealReady) || now.Before(reveal.ExpiresAt) {
+			continue
+		}
+		if reveal.TokenHash != "" {
+			delete(s.revealTokens, reveal.TokenHash)
+		}
+		reveal.Status = CardRevealExpired
+		s.cardReveals[id] = reveal
+		expired = append(expired, reveal)
+	}
+	return expired
+}
+
+// AddCardToken выпускает токен; на одном устройстве у карты может быть только один неудалённый токен
+func (s *InMemoryStorage) AddCardToken(ctx context.Context, token CardToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cards[token.CardID]; !ok {
+		return notFoundCodef(CodeCardNotFound, "card %s not found", token.CardID)
+	}
+	for _, existing := range s.cardTokens {
+		if existing.CardID == token.CardID && existing.DeviceID == token.DeviceID && existing.Status != CardTokenDeleted {
+			return conflictf("card %s already has token %s on device %s", token.CardID, existing.ID, token.DeviceID)
+		}
+	}
+	s.cardTokens[token.ID] = token
+	s.cardTokenHash[token.TokenHash] = token.ID
+	return nil
+}
+
+func (s *InMemoryStorage) GetCardTokenByHash(ctx context.Context, tokenHash string) (CardToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token, ok := s.cardTokens[s.cardTokenHash[tokenHash]]
+	return token, ok
+}
+
+// ListCardTokens — токены карты, включая удалённые, в порядке выпуска
+func (s *InMemoryStorage) ListCardTokens(ctx context.Context, cardID string) []CardToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]CardToken, 0)
+	for _, token := range s.cardTokens {
+		if token.CardID == cardID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// SetCardTokenStatus меняет статус токена карты. Удаление окончательное: хеш удалённого токена забывается,
+// и оплатить им больше нельзя.
+func (s *InMemoryStorage) SetCardTokenStatus(ctx context.Context, cardID, tokenID string, from []string, status string, now time.Time) (CardToken, error) {
+	if err := ctx.Err(); err != nil {
+		return CardToken{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.cardTokens[tokenID]
+	if !ok || token.CardID != cardID {
+		return CardToken{}, notFoundf("card token %s not found", tokenID)
+	}
+	allowed := false
+	for _, st := range from {
+		allowed = allowed || token.Status == st
+	}
+	if !allowed {
+		return CardToken{}, conflictf("card token %s is %s", tokenID, token.Status)
+	}
+	token.Status = status
+	token.UpdatedAt = now
+	if status == CardTokenDeleted {
+		delete(s.cardTokenHash, token.TokenHash)
+	}
+	s.cardTokens[tokenID] = token
+	return token, nil
+}
+
+func (s *InMemoryStorage) TouchCardToken(ctx context.Context, tokenID string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token, ok := s.cardTokens[tokenID]; ok {
+		token.LastUsedAt = &now
+		s.cardTokens[tokenID] = token
+	}
+}
+
+func (s *InMemoryStorage) GetCardByNumber(ctx context.Context, number string) (Card, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, card := range s.cards {
+		if card.Number == number {
+			return card, true
+		}
+	}
+	return Card{}, false
+}
+
+func (s *InMemoryStorage) AddLoan(ctx context.Context, loan Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[loan.UserID]; !exists {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", loan.UserID)
+	}
+	if _, exists := s.accounts[loan.AccountID]; !exists {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", loan.AccountID)
+	}
+	s.putLoan(loan)
+	s.loanIndex[loan.UserID] = append(s.loanIndex[loan.UserID], loan.ID)
+	if loan.GuarantorUserID != "" {
+		s.guaranteeIndex[loan.GuarantorUserID] = append(s.guaranteeIndex[loan.GuarantorUserID], loan.ID)
+	}
+	sum := s.summaryFor(loan.UserID)
+	sum.TotalLoanDebt = sum.TotalLoanDebt.Add(loan.RemainingAmount)
+	if loan.RemainingAmount.GreaterThan(decimal.Zero) {
+		sum.ActiveLoans++
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) GetUserLoans(ctx context.Context, userID string) []Loan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loanIDs := s.loanIndex[userID]
+	loans := make([]Loan, 0, len(loanIDs))
+	for _, id := range loanIDs {
+		if loan, ok := s.loans[id]; ok {
+			loans = append(loans, loan)
+		}
+	}
+	return loans
+}
+
+// GetGuaranteedLoans — кредиты, по которым пользователь поручитель
+func (s *InMemoryStorage) GetGuaranteedLoans(ctx context.Context, userID string) []Loan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loans := make([]Loan, 0, len(s.guaranteeIndex[userID]))
+	for _, id := range s.guaranteeIndex[userID] {
+		if loan, ok := s.loans[id]; ok {
+			loans = append(loans, loan)
+		}
+	}
+	return loans
+}
+
+func (s *InMemoryStorage) AddLoanApplication(ctx context.Context, app LoanApplication) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, userID := range []string{app.UserID, app.GuarantorUserID} {
+		if _, exists := s.users[userID]; !exists {
+			return notFoundCodef(CodeUserNotFound, "user %s not found", userID)
+		}
+	}
+	if _, exists := s.accounts[app.AccountID]; !exists {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", app.AccountID)
+	}
+	s.loanApplications[app.ID] = app
+	return nil
+}
+
+func (s *InMemoryStorage) GetLoanApplication(ctx context.Context, id string) (LoanApplication, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	app, ok := s.loanApplications[id]
+	return app, ok
+}
+
+// ListLoanApplications — заявки, где пользователь заёмщик или поручитель, по статусу (пусто — все); новые сверху
+func (s *InMemoryStorage) ListLoanApplications(ctx context.Context, userID, status string) []LoanApplication {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]LoanApplication, 0)
+	for _, app := range s.loanApplications {
+		if (app.UserID == userID || app.GuarantorUserID == userID) && (status == "" || app.Status == status) {
+			result = append(result, app)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+func (s *InMemoryStorage) UpdateLoanApplication(ctx context.Context, id string, update func(*LoanApplication) error) (LoanApplication, error) {
+	if err := ctx.Err(); err != nil {
+		return LoanApplication{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, ok := s.loanApplications[id]
+	if !ok {
+		return LoanApplication{}, notFoundCodef(CodeLoanNotFound, "loan %s not found", id)
+	}
+	if err := update(&app); err != nil {
+		return LoanApplication{}, err
+	}
+	s.loanApplications[id] = app
+	return app, nil
+}
+
+func (s *InMemoryStorage) ListLoans(ctx context.Context) []Loan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loans := make([]Loan, 0, len(s.loans))
+	for _, loan := range s.loans {
+		loans = append(loans, loan)
+	}
+	return loans
+}
+
+func (s *InMemoryStorage) GetLoan(ctx context.Context, loanID string) (Loan, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loan, ok := s.loans[loanID]
+	return loan, ok
+}
+
+// UpdateLoan атомарно меняет кредит; изменение остатка долга переносится в сводку пользователя
+func (s *InMemoryStorage) UpdateLoan(ctx context.Context, loanID string, update func(*Loan) error) (Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return Loan{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loan, ok := s.loans[loanID]
+	if !ok {
+		return Loan{}, notFoundCodef(CodeLoanNotFound, "loan %s not found", loanID)
+	}
+	before := loan.RemainingAmount
+	loan.PaymentSchedule = append([]Payment(nil), loan.PaymentSchedule...)
+	loan.History = append([]LoanEvent(nil), loan.History...)
+	if err := update(&loan); err != nil {
+		return Loan{}, err
+	}
+	s.putLoan(loan)
+	sum := s.summaryFor(loan.UserID)
+	sum.TotalLoanDebt = sum.TotalLoanDebt.Add(loan.RemainingAmount.Sub(before))
+	switch {
+	case before.IsPositive() && !loan.RemainingAmount.IsPositive():
+		sum.ActiveLoans--
+	case !before.IsPositive() && loan.RemainingAmount.IsPositive():
+		sum.ActiveLoans++
+	}
+	return loan, nil
+}
+
+// CollectLoanPayment списывает со счёта кредита самый ранний неоплаченный платёж со сроком до now и отмечает его
+// оплаченным. Если таких платежей нет, возвращается false; если не хватает доступного остатка — ErrInsufficientFunds.
+func (s *InMemoryStorage) CollectLoanPayment(ctx context.Context, loanID string, now time.Time) (Transaction, Payment, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, Payment{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loan, ok := s.loans[loanID]
+	if !ok {
+		return Transaction{}, Payment{}, false, notFoundCodef(CodeLoanNotFound, "loan %s not found", loanID)
+	}
+	due := -1
+	for i, payment := range loan.PaymentSchedule {
+		if !payment.Paid && !payment.DueDate.After(now) {
+			due = i
+			break
+		}
+	}
+	if due < 0 {
+		return Transaction{}, Payment{}, false, nil
+	}
+	payment := loan.PaymentSchedule[due]
+	acc, ok := s.accounts[loan.AccountID]
+	if !ok {
+		return Transaction{}, Payment{}, false, notFoundCodef(CodeAccountNotFound, "account %s not found", loan.AccountID)
+	}
+	if acc.IsClosed() {
+		return Transaction{}, Payment{}, false, accountClosedError(acc.ID)
+	}
+	if acc.AvailableBalance.LessThan(payment.Amount) {
+		return Transaction{}, Payment{}, false, &StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("insufficient funds on account %s", acc.ID)}
+	}
+
+	acc.Balance = acc.Balance.Sub(payment.Amount)
+	acc.refreshAvailable()
+	if err := s.casAccounts(&acc); err != nil {
+		return Transaction{}, Payment{}, false, err
+	}
+	s.adjustSummaryBalance(acc.UserID, payment.Amount.Neg())
+
+	before := loan.RemainingAmount
+	loan.PaymentSchedule = append([]Payment(nil), loan.PaymentSchedule...)
+	loan.PaymentSchedule[due].Paid = true
+	loan.RemainingAmount = decimal.Max(loan.RemainingAmount.Sub(payment.PrincipalPart), decimal.Zero)
+	if !loan.RemainingAmount.IsPositive() {
+		loan.ReleaseCollateral(now)
+	}
+	s.putLoan(loan)
+	sum := s.summaryFor(loan.UserID)
+	sum.TotalLoanDebt = sum.TotalLoanDebt.Add(loan.RemainingAmount.Sub(before))
+	if before.IsPositive() && !loan.RemainingAmount.IsPositive() {
+		sum.ActiveLoans--
+	}
+
+	tx := Transaction{
+		ID:              GenerateID(),
+		FromAccountID:   acc.ID,
+		Amount:          payment.Amount,
+		Timestamp:       now,
+		TransactionType: "loan_payment",
+	}
+	tx.Describe(DescLoanPayment, map[string]string{"loan_id": loan.ID, "due_date": payment.DueDate.Format("2006-01-02")})
+	s.appendTransaction(tx)
+	return tx, loan.PaymentSchedule[due], true, nil
+}
+
+func (s *InMemoryStorage) SaveCreditScore(ctx context.Context, score CreditScore) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	score.Factors = append([]CreditScoreFactor(nil), score.Factors...)
+	s.creditScores[score.UserID] = score
+	return nil
+}
+
+func (s *InMemoryStorage) GetCreditScore(ctx context.Context, userID string) (CreditScore, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	score, ok := s.creditScores[userID]
+	return score, ok
+}
+
+// RemoveLoan удаляет кредит вместе с долгом в сводке — откат выдачи, по которой деньги так и не дошли до клиента
+func (s *InMemoryStorage) RemoveLoan(ctx context.Context, loanID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loan, ok := s.loans[loanID]
+	if !ok {
+		return notFoundCodef(CodeLoanNotFound, "loan %s not found", loanID)
+	}
+	delete(s.loans, loanID)
+	s.bump(CollectionLoans)
+	ids := s.loanIndex[loan.UserID]
+	for i, id := range ids {
+		if id == loanID {
+			s.loanIndex[loan.UserID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	ids = s.guaranteeIndex[loan.GuarantorUserID]
+	for i, id := range ids {
+		if id == loanID {
+			s.guaranteeIndex[loan.GuarantorUserID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	sum := s.summaryFor(loan.UserID)
+	sum.TotalLoanDebt = sum.TotalLoanDebt.Sub(loan.RemainingAmount)
+	if loan.RemainingAmount.GreaterThan(decimal.Zero) {
+		sum.ActiveLoans--
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) AddSession(ctx context.Context, session Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[session.UserID]; !exists {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", session.UserID)
+	}
+	s.sessions[session.ID] = session
+	s.sessionToken[session.Token] = session.ID
+	s.sessionIndex[session.UserID] = append(s.sessionIndex[session.UserID], session.ID)
+	return nil
+}
+
+func (s *InMemoryStorage) GetSessionByToken(ctx context.Context, token string) (Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessionID, ok := s.sessionToken[token]
+	if !ok {
+		return Session{}, false
+	}
+	session, ok := s.sessions[sessionID]
+	return session, ok
+}
+
+func (s *InMemoryStorage) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[sessionID]; ok {
+		session.LastSeenAt = seenAt
+		s.sessions[sessionID] = session
+	}
+}
+
+func (s *InMemoryStorage) GetUserSessions(ctx context.Context, userID string) []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessionIDs := s.sessionIndex[userID]
+	sessions := make([]Session, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		if session, ok := s.sessions[id]; ok {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// HasKnownDevice сообщает, входил ли пользователь раньше с этим user agent и IP
+func (s *InMemoryStorage) HasKnownDevice(ctx context.Context, userID, userAgent, ip string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, id := range s.sessionIndex[userID] {
+		if session, ok := s.sessions[id]; ok && session.UserAgent == userAgent && session.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *InMemoryStorage) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok || session.UserID != userID {
+		return notFoundf("session %s not found", sessionID)
+	}
+	session.Revoked = true
+	s.sessions[sessionID] = session
+	delete(s.sessionToken, session.Token)
+	return nil
+}
+
+func (s *InMemoryStorage) RevokeUserSessions(ctx context.Context, userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked := 0
+	for _, id := range s.sessionIndex[userID] {
+		session, ok := s.sessions[id]
+		if !ok || session.Revoked {
+			continue
+		}
+		session.Revoked = true
+		s.sessions[id] = session
+		delete(s.sessionToken, session.Token)
+		revoked++
+	}
+	return revoked
+}
+
+func (s *InMemoryStorage) SetFXSweepRule(ctx context.Context, rule FXSweepRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, ok := s.accounts[rule.TargetAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", rule.TargetAccountID)
+	}
+	if target.UserID != rule.UserID {
+		return &StorageError{Kind: ErrInvalidInput, Message: "target account must belong to the user"}
+	}
+	s.fxSweepRules[rule.UserID] = rule
+	return nil
+}
+
+// SetAlias привязывает телефон или логин к счёту пользователя; чужой алиас занять нельзя
+func (s *InMemoryStorage) SetAlias(ctx context.Context, alias Alias) (Alias, error) {
+	if err := ctx.Err(); err != nil {
+		return Alias{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[alias.AccountID]
+	if !ok {
+		return Alias{}, notFoundCodef(CodeAccountNotFound, "account %s not found", alias.AccountID)
+	}
+	if acc.UserID != alias.UserID {
+		return Alias{}, &StorageError{Kind: ErrInvalidInput, Message: "alias account must belong to the user"}
+	}
+	if acc.IsClosed() {
+		return Alias{}, accountClosedError(acc.ID)
+	}
+	if existing, ok := s.aliases[alias.Key()]; ok {
+		if existing.UserID != alias.UserID {
+			return Alias{}, conflictf("%s %s is already registered by another user", alias.Type, alias.Value)
+		}
+		alias.CreatedAt = existing.CreatedAt
+	}
+	s.aliases[alias.Key()] = alias
+	return alias, nil
+}
+
+func (s *InMemoryStorage) GetAlias(ctx context.Context, aliasType, value string) (Alias, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	alias, ok := s.aliases[Alias{Type: aliasType, Value: value}.Key()]
+	return alias, ok
+}
+
+func (s *InMemoryStorage) GetUserAliases(ctx context.Context, userID string) []Alias {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Alias, 0)
+	for _, alias := range s.aliases {
+		if alias.UserID == userID {
+			result = append(result, alias)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key() < result[j].Key() })
+	return result
+}
+
+func (s *InMemoryStorage) DeleteAlias(ctx context.Context, userID, aliasType, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := Alias{Type: aliasType, Value: value}.Key()
+	alias, ok := s.aliases[key]
+	if !ok || alias.UserID != userID {
+		return notFoundCodef(CodeAliasNotFound, "%s %s not found", aliasType, value)
+	}
+	delete(s.aliases, key)
+	return nil
+}
+
+func (s *InMemoryStorage) GetFXSweepRule(ctx context.Context, userID string) (FXSweepRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rule, ok := s.fxSweepRules[userID]
+	return rule, ok
+}
+
+func (s *InMemoryStorage) DeleteFXSweepRule(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.fxSweepRules[userID]; !ok {
+		return notFoundf("fx sweep rule for user %s not found", userID)
+	}
+	delete(s.fxSweepRules, userID)
+	return nil
+}
+
+func (s *InMemoryStorage) ListFXSweepRules(ctx context.Context) []FXSweepRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]FXSweepRule, 0, len(s.fxSweepRules))
+	for _, rule := range s.fxSweepRules {
+		if rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// SaveAutoTransferRule создаёт или заменяет правило; оба счёта должны принадлежать владельцу правила
+// и быть в одной валюте
+func (s *InMemoryStorage) SaveAutoTransferRule(ctx context.Context, rule AutoTransferRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source, ok := s.accounts[rule.SourceAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", rule.SourceAccountID)
+	}
+	target, ok := s.accounts[rule.TargetAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", rule.TargetAccountID)
+	}
+	if source.UserID != rule.UserID || target.UserID != rule.UserID {
+		return &StorageError{Kind: ErrInvalidInput, Message: "both accounts must belong to the user"}
+	}
+	if source.Currency != target.Currency {
+		return &StorageError{Kind: ErrInvalidInput, Message: "auto-transfer accounts must have the same currency"}
+	}
+	if source.IsClosed() {
+		return accountClosedError(source.ID)
+	}
+	if target.IsClosed() {
+		return accountClosedError(target.ID)
+	}
+	if existing, ok := s.transferRules[rule.ID]; ok && existing.UserID != rule.UserID {
+		return notFoundf("auto-transfer rule %s not found", rule.ID)
+	}
+	s.transferRules[rule.ID] = rule
+	return nil
+}
+
+func (s *InMemoryStorage) GetAutoTransferRule(ctx context.Context, ruleID string) (AutoTransferRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rule, ok := s.transferRules[ruleID]
+	return rule, ok
+}
+
+// ListAutoTransferRules — правила пользователя в порядке создания; пустой userID — все правила
+func (s *InMemoryStorage) ListAutoTransferRules(ctx context.Context, userID string) []AutoTransferRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]AutoTransferRule, 0)
+	for _, rule := range s.transferRules {
+		if userID == "" || rule.UserID == userID {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].CreatedAt.Before(rules[j].CreatedAt) })
+	return rules
+}
+
+func (s *InMemoryStorage) DeleteAutoTransferRule(ctx context.Context, userID, ruleID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, ok := s.transferRules[ruleID]
+	if !ok || rule.UserID != userID {
+		return notFoundf("auto-transfer rule %s not found", ruleID)
+	}
+	delete(s.transferRules, ruleID)
+	return nil
+}
+
+func (s *InMemoryStorage) AddBankLink(ctx context.Context, link ExternalBankLink) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.bankLinks[link.ID]; exists {
+		return conflictf("bank link %s already exists", link.ID)
+	}
+	s.bankLinks[link.ID] = link
+	return nil
+}
+
+func (s *InMemoryStorage) GetBankLink(ctx context.Context, id string) (ExternalBankLink, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	link, ok := s.bankLinks[id]
+	return link, ok
+}
+
+// ListBankLinks — подключения пользователя к другим банкам; пустой userID — все подключения (для синхронизации)
+func (s *InMemoryStorage) ListBankLinks(ctx context.Context, userID string) []ExternalBankLink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]ExternalBankLink, 0)
+	for _, link := range s.bankLinks {
+		if userID == "" || link.UserID == userID {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return links
+}
+
+func (s *InMemoryStorage) UpdateBankLink(ctx context.Context, id string, update func(*ExternalBankLink) error) (ExternalBankLink, error) {
+	if err := ctx.Err(); err != nil {
+		return ExternalBankLink{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.bankLinks[id]
+	if !ok {
+		return ExternalBankLink{}, notFoundf("bank link %s not found", id)
+	}
+	if err := update(&link); err != nil {
+		return ExternalBankLink{}, err
+	}
+	s.bankLinks[id] = link
+	return link, nil
+}
+
+// DeleteBankLink отключает банк вместе с его счетами и их операциями
+func (s *InMemoryStorage) DeleteBankLink(ctx context.Context, userID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.bankLinks[id]
+	if !ok || link.UserID != userID {
+		return notFoundf("bank link %s not found", id)
+	}
+	for accountID, account := range s.externalAccounts {
+		if account.LinkID == id {
+			delete(s.externalAccounts, accountID)
+			delete(s.externalTxs, accountID)
+		}
+	}
+	delete(s.bankLinks, id)
+	s.bump(CollectionExternalAccounts)
+	return nil
+}
+
+// SyncExternalAccount записывает свежий снимок внешнего счёта: счёт ищется по LinkID и ExternalID, так что его ID
+// между синхронизациями не меняется; из операций добавляются только те, чьего ExternalID ещё нет. Возвращает
+// сохранённый счёт и число новых операций.
+func (s *InMemoryStorage) SyncExternalAccount(ctx context.Context, account ExternalAccount, txs []ExternalTransaction) (ExternalAccount, int, error) {
+	if err := ctx.Err(); err != nil {
+		return ExternalAccount{}, 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bankLinks[account.LinkID]; !ok {
+		return ExternalAccount{}, 0, notFoundf("bank link %s not found", account.LinkID)
+	}
+	for _, existing := range s.externalAccounts {
+		if existing.LinkID == account.LinkID && existing.ExternalID == account.ExternalID {
+			account.ID = existing.ID
+			break
+		}
+	}
+	s.externalAccounts[account.ID] = account
+
+	known := make(map[string]bool, len(s.externalTxs[account.ID]))
+	for _, tx := range s.externalTxs[account.ID] {
+		known[tx.ExternalID] = true
+	}
+	added := 0
+	for _, tx := range txs {
+		if known[tx.ExternalID] {
+			continue
+		}
+		known[tx.ExternalID] = true
+		tx.AccountID = account.ID
+		s.externalTxs[account.ID] = append(s.externalTxs[account.ID], tx)
+		added++
+	}
+	s.bump(CollectionExternalAccounts)
+	return account, added, nil
+}
+
+// RemoveExternalAccounts удаляет счета подключения, которых банк-источник больше не возвращает
+func (s *InMemoryStorage) RemoveExternalAccounts(ctx context.Context, linkID string, keepExternalIDs []string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := make(map[string]bool, len(keepExternalIDs))
+	for _, id := range keepExternalIDs {
+		keep[id] = true
+	}
+	removed := 0
+	for accountID, account := range s.externalAccounts {
+		if account.LinkID == linkID && !keep[account.ExternalID] {
+			delete(s.externalAccounts, accountID)
+			delete(s.externalTxs, accountID)
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.bump(CollectionExternalAccounts)
+	}
+	return removed
+}
+
+func (s *InMemoryStorage) ListExternalAccounts(ctx context.Context, userID string) []ExternalAccount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accounts := make([]ExternalAccount, 0)
+	for _, account := range s.externalAccounts {
+		if account.UserID == userID {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].BankName != accounts[j].BankName {
+			return accounts[i].BankName < accounts[j].BankName
+		}
+		return accounts[i].Name < accounts[j].Name
+	})
+	return accounts
+}
+
+func (s *InMemoryStorage) GetExternalAccount(ctx context.Context, id string) (ExternalAccount, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	account, ok := s.externalAccounts[id]
+	return account, ok
+}
+
+// GetExternalTransactions — операции внешнего счёта, новые первыми
+func (s *InMemoryStorage) GetExternalTransactions(ctx context.Context, accountID string) []ExternalTransaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	txs := append([]ExternalTransaction(nil), s.externalTxs[accountID]...)
+	sort.Slice(txs, func(i, j int) bool { return txs[i].BookedAt.After(txs[j].BookedAt) })
+	return txs
+}
+
+// AddAlertRule заводит оповещение; счёт должен принадлежать владельцу правила и быть открытым
+func (s *InMemoryStorage) AddAlertRule(ctx context.Context, rule AlertRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[rule.AccountID]
+	if !ok || account.UserID != rule.UserID {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", rule.AccountID)
+	}
+	if account.IsClosed() {
+		return accountClosedError(account.ID)
+	}
+	s.alertRules[rule.ID] = rule
+	return nil
+}
+
+// UpdateAlertRule изменяет правило счёта под блокировкой: и настройки клиента, и состояние после срабатывания
+func (s *InMemoryStorage) UpdateAlertRule(ctx context.Context, accountID, ruleID string, update func(*AlertRule) error) (AlertRule, error) {
+	if err := ctx.Err(); err != nil {
+		return AlertRule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, ok := s.alertRules[ruleID]
+	if !ok || rule.AccountID != accountID {
+		return AlertRule{}, notFoundf("alert rule %s not found", ruleID)
+	}
+	if err := update(&rule); err != nil {
+		return AlertRule{}, err
+	}
+	s.alertRules[ruleID] = rule
+	return rule, nil
+}
+
+// ListAlertRules — оповещения счёта в порядке создания
+func (s *InMemoryStorage) ListAlertRules(ctx context.Context, accountID string) []AlertRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]AlertRule, 0)
+	for _, rule := range s.alertRules {
+		if rule.AccountID == accountID {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].CreatedAt.Before(rules[j].CreatedAt) })
+	return rules
+}
+
+func (s *InMemoryStorage) DeleteAlertRule(ctx context.Context, accountID, ruleID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, ok := s.alertRules[ruleID]
+	if !ok || rule.AccountID != accountID {
+		return notFoundf("alert rule %s not found", ruleID)
+	}
+	delete(s.alertRules, ruleID)
+	return nil
+}
+
+// RunAutoTransferRule проверяет правило по текущим остаткам и, если условие выполнено, проводит перевод tx
+// (сумма, счета и описание заполняются здесь) под одной блокировкой. Возвращает false, если переводить нечего.
+// Нехватка средств у источника top_up не ошибка: переводится доступная часть.
+func (s *InMemoryStorage) RunAutoTransferRule(ctx context.Context, ruleID string, tx Transaction, now time.Time) (Transaction, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, ok := s.transferRules[ruleID]
+	if !ok || !rule.Enabled {
+		return Transaction{}, false, nil
+	}
+	source, okSource := s.accounts[rule.SourceAccountID]
+	target, okTarget := s.accounts[rule.TargetAccountID]
+	fail := func(err *StorageError) (Transaction, bool, error) {
+		rule.LastError = err.Message
+		s.transferRules[rule.ID] = rule
+		return Transaction{}, false, err
+	}
+	switch {
+	case !okSource || !okTarget:
+		return fail(&StorageError{Kind: ErrNotFound, Code: CodeAccountNotFound, Message: "auto-transfer account no longer exists"})
+	case source.IsClosed() || target.IsClosed():
+		return fail(&StorageError{Kind: ErrConflict, Code: CodeAccountClosed, Message: "auto-transfer account is closed"})
+	}
+
+	var amount decimal.Decimal
+	switch rule.Kind {
+	case AutoTransferSweep:
+		amount = decimal.Min(source.Balance.Sub(rule.Threshold), source.AvailableBalance)
+	case AutoTransferTopUp:
+		if !target.Balance.LessThan(rule.Threshold) {
+			return Transaction{}, false, nil
+		}
+		goal := rule.Threshold
+		if rule.TopUpTo.GreaterThan(goal) {
+			goal = rule.TopUpTo
+		}
+		amount = decimal.Min(goal.Sub(target.Balance), source.AvailableBalance)
+		if !amount.IsPositive() {
+			return fail(&StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("no available funds on account %s to top up %s", source.ID, target.ID)})
+		}
+	}
+	if !amount.IsPositive() {
+		return Transaction{}, false, nil
+	}
+
+	source.Balance = source.Balance.Sub(amount)
+	target.Balance = target.Balance.Add(amount)
+	source.refreshAvailable()
+	target.refreshAvailable()
+	if err := s.casAccounts(&source, &target); err != nil {
+		return Transaction{}, false, err
+	}
+	s.adjustSummaryBalance(source.UserID, amount.Neg())
+	s.adjustSummaryBalance(target.UserID, amount)
+
+	tx.FromAccountID = source.ID
+	tx.ToAccountID = target.ID
+	tx.Amount = amount
+	tx.Describe(DescAutoTransfer, map[string]string{"from": source.Number, "to": target.Number, "kind": rule.Kind})
+	s.appendTransaction(tx)
+
+	rule.LastTriggeredAt = &now
+	rule.LastTransactionID = tx.ID
+	rule.LastError = ""
+	s.transferRules[rule.ID] = rule
+	return tx, true, nil
+}
+
+func (s *InMemoryStorage) AddAPIClient(ctx context.Context, client APIClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiClients[client.ID] = client
+}
+
+func (s *InMemoryStorage) GetAPIClient(ctx context.Context, clientID string) (APIClient, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	client, ok := s.apiClients[clientID]
+	return client, ok
+}
+
+func (s *InMemoryStorage) ListAPIClients(ctx context.Context) []APIClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]APIClient, 0, len(s.apiClients))
+	for _, c := range s.apiClients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].CreatedAt.Before(clients[j].CreatedAt) })
+	return clients
+}
+
+func (s *InMemoryStorage) UpdateAPIClient(ctx context.Context, clientID string, update func(*APIClient)) (APIClient, error) {
+	if err := ctx.Err(); err != nil {
+		return APIClient{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.apiClients[clientID]
+	if !ok {
+		return APIClient{}, notFoundf("api client %s not found", clientID)
+	}
+	update(&client)
+	s.apiClients[clientID] = client
+	return client, nil
+}
+
+func (s *InMemoryStorage) AddOAuthCode(ctx context.Context, code OAuthCode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[code.UserID]; !exists {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", code.UserID)
+	}
+	s.oauthCodes[code.CodeHash] = code
+	return nil
+}
+
+// RedeemOAuthCode погашает код авторизации: повторно и после истечения срока он не принимается
+func (s *InMemoryStorage) RedeemOAuthCode(ctx context.Context, codeHash string, now time.Time) (OAuthCode, error) {
+	if err := ctx.Err(); err != nil {
+		return OAuthCode{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.oauthCodes[codeHash]
+	if !ok {
+		return OAuthCode{}, notFoundf("authorization code not found or already used")
+	}
+	delete(s.oauthCodes, codeHash)
+	if now.After(code.ExpiresAt) {
+		return OAuthCode{}, conflictf("authorization code expired")
+	}
+	return code, nil
+}
+
+func (s *InMemoryStorage) AddOAuthGrant(ctx context.Context, grant OAuthGrant) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[grant.UserID]; !exists {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", grant.UserID)
+	}
+	s.oauthGrants[grant.ID] = grant
+	s.oauthRefresh[grant.RefreshTokenHash] = grant.ID
+	return nil
+}
+
+func (s *InMemoryStorage) GetUserOAuthGrants(ctx context.Context, userID string) []OAuthGrant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	grants := make([]OAuthGrant, 0)
+	for _, grant := range s.oauthGrants {
+		if grant.UserID == userID {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].CreatedAt.Before(grants[j].CreatedAt) })
+	return grants
+}
+
+// revokeGrantSessions отзывает токены доступа, выданные по согласию; вызывается под s.mu
+func (s *InMemoryStorage) revokeGrantSessions(grant OAuthGrant) {
+	for _, id := range s.sessionIndex[grant.UserID] {
+		session, ok := s.sessions[id]
+		if !ok || session.GrantID != grant.ID || session.Revoked {
+			continue
+		}
+		session.Revoked = true
+		s.sessions[id] = session
+		delete(s.sessionToken, session.Token)
+	}
+}
+
+// RefreshOAuthGrant меняет refresh token согласия приложения clientID на новый и отзывает выданные по нему
+// токены доступа. Refresh token другого приложения не принимается и остаётся в силе.
+func (s *InMemoryStorage) RefreshOAuthGrant(ctx context.Context, clientID, refreshHash, newRefreshHash string, now time.Time) (OAuthGrant, error) {
+	if err := ctx.Err(); err != nil {
+		return OAuthGrant{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grantID, ok := s.oauthRefresh[refreshHash]
+	if !ok || s.oauthGrants[grantID].ClientID != clientID {
+		return OAuthGrant{}, notFoundf("refresh token not found or revoked")
+	}
+	grant := s.oauthGrants[grantID]
+	delete(s.oauthRefresh, refreshHash)
+	s.revokeGrantSessions(grant)
+	grant.RefreshTokenHash = newRefreshHash
+	grant.RefreshedAt = &now
+	s.oauthGrants[grantID] = grant
+	s.oauthRefresh[newRefreshHash] = grantID
+	return grant, nil
+}
+
+// RevokeOAuthGrant отзывает согласие пользователя вместе с refresh token и токенами доступа приложения
+func (s *InMemoryStorage) RevokeOAuthGrant(ctx context.Context, userID, grantID string, now time.Time) (OAuthGrant, error) {
+	if err := ctx.Err(); err != nil {
+		return OAuthGrant{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grant, ok := s.oauthGrants[grantID]
+	if !ok || grant.UserID != userID {
+		return OAuthGrant{}, notFoundf("oauth grant %s not found", grantID)
+	}
+	if grant.RevokedAt == nil {
+		s.revokeOAuthGrant(&grant, now)
+	}
+	return grant, nil
+}
+
+// RevokeClientOAuthGrants отзывает все согласия, выданные приложению; возвращает их число
+func (s *InMemoryStorage) RevokeClientOAuthGrants(ctx context.Context, clientID string, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked := 0
+	for _, grant := range s.oauthGrants {
+		if grant.ClientID == clientID && grant.RevokedAt == nil {
+			s.revokeOAuthGrant(&grant, now)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+func (s *InMemoryStorage) revokeOAuthGrant(grant *OAuthGrant, now time.Time) {
+	grant.RevokedAt = &now
+	delete(s.oauthRefresh, grant.RefreshTokenHash)
+	s.oauthGrants[grant.ID] = *grant
+	s.revokeGrantSessions(*grant)
+}
+
+func (s *InMemoryStorage) AddAccountConsent(ctx context.Context, consent AccountAccessConsent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.accountConsents[consent.ID]; exists {
+		return conflictf("consent %s already exists", consent.ID)
+	}
+	s.accountConsents[consent.ID] = consent
+	return nil
+}
+
+func (s *InMemoryStorage) GetAccountConsent(ctx context.Context, id string) (AccountAccessConsent, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	consent, ok := s.accountConsents[id]
+	return consent, ok
+}
+
+func (s *InMemoryStorage) UpdateAccountConsent(ctx context.Context, id string, update func(*AccountAccessConsent) error) (AccountAccessConsent, error) {
+	if err := ctx.Err(); err != nil {
+		return AccountAccessConsent{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	consent, ok := s.accountConsents[id]
+	if !ok {
+		return AccountAccessConsent{}, notFoundCodef(CodeConsentNotFound, "consent %s not found", id)
+	}
+	consent.Permissions = append([]string(nil), consent.Permissions...)
+	consent.AccountIDs = append([]string(nil), consent.AccountIDs...)
+	if err := update(&consent); err != nil {
+		return AccountAccessConsent{}, err
+	}
+	s.accountConsents[id] = consent
+	return consent, nil
+}
+
+func (s *InMemoryStorage) AddPaymentConsent(ctx context.Context, consent DomesticPaymentConsent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.paymentConsents[consent.ID]; exists {
+		return conflictf("consent %s already exists", consent.ID)
+	}
+	s.paymentConsents[consent.ID] = consent
+	return nil
+}
+
+func (s *InMemoryStorage) GetPaymentConsent(ctx context.Context, id string) (DomesticPaymentConsent, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	consent, ok := s.paymentConsents[id]
+	return consent, ok
+}
+
+func (s *InMemoryStorage) UpdatePaymentConsent(ctx context.Context, id string, update func(*DomesticPaymentConsent) error) (DomesticPaymentConsent, error) {
+	if err := ctx.Err(); err != nil {
+		return DomesticPaymentConsent{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	consent, ok := s.paymentConsents[id]
+	if !ok {
+		return DomesticPaymentConsent{}, notFoundCodef(CodeConsentNotFound, "consent %s not found", id)
+	}
+	if err := update(&consent); err != nil {
+		return DomesticPaymentConsent{}, err
+	}
+	s.paymentConsents[id] = consent
+	return consent, nil
+}
+
+func (s *InMemoryStorage) AddDomesticPayment(ctx context.Context, payment DomesticPayment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.domesticPayments[payment.ID]; exists {
+		return conflictf("payment %s already exists", payment.ID)
+	}
+	s.domesticPayments[payment.ID] = payment
+	return nil
+}
+
+func (s *InMemoryStorage) GetDomesticPayment(ctx context.Context, id string) (DomesticPayment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payment, ok := s.domesticPayments[id]
+	return payment, ok
+}
+
+func (s *InMemoryStorage) UpdateDomesticPayment(ctx context.Context, id string, update func(*DomesticPayment) error) (DomesticPayment, error) {
+	if err := ctx.Err(); err != nil {
+		return DomesticPayment{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment, ok := s.domesticPayments[id]
+	if !ok {
+		return DomesticPayment{}, notFoundCodef(CodePaymentNotFound, "payment %s not found", id)
+	}
+	if err := update(&payment); err != nil {
+		return DomesticPayment{}, err
+	}
+	s.domesticPayments[id] = payment
+	return payment, nil
+}
+
+func (s *InMemoryStorage) AddMerchant(ctx context.Context, m Merchant) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[m.SettlementAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "settlement account %s not found", m.SettlementAccountID)
+	}
+	if acc.UserID != m.UserID {
+		return &StorageError{Kind: ErrInvalidInput, Message: "settlement account must belong to the merchant owner"}
+	}
+	if acc.IsClosed() {
+		return accountClosedError(acc.ID)
+	}
+	s.merchants[m.ID] = m
+	return nil
+}
+
+func (s *InMemoryStorage) GetMerchant(ctx context.Context, merchantID string) (Merchant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.merchants[merchantID]
+	return m, ok
+}
+
+func (s *InMemoryStorage) ListMerchants(ctx context.Context) []Merchant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	merchants := make([]Merchant, 0, len(s.merchants))
+	for _, m := range s.merchants {
+		merchants = append(merchants, m)
+	}
+	sort.Slice(merchants, func(i, j int) bool { return merchants[i].CreatedAt.Before(merchants[j].CreatedAt) })
+	return merchants
+}
+
+func (s *InMemoryStorage) AddMerchantAPIKey(ctx context.Context, key MerchantAPIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.merchants[key.MerchantID]; !ok {
+		return notFoundf("merchant %s not found", key.MerchantID)
+	}
+	s.merchantKeys[key.ID] = key
+	s.merchantKeyHash[key.KeyHash] = key.ID
+	return nil
+}
+
+func (s *InMemoryStorage) GetMerchantAPIKeys(ctx context.Context, merchantID string) []MerchantAPIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []MerchantAPIKey
+	for _, key := range s.merchantKeys {
+		if key.MerchantID == merchantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+func (s *InMemoryStorage) RevokeMerchantAPIKey(ctx context.Context, merchantID, keyID string, now time.Time) (MerchantAPIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return MerchantAPIKey{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.merchantKeys[keyID]
+	if !ok || key.MerchantID != merchantID {
+		return MerchantAPIKey{}, notFoundf("merchant key %s not found", keyID)
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &now
+		s.merchantKeys[keyID] = key
+		delete(s.merchantKeyHash, key.KeyHash)
+	}
+	return key, nil
+}
+
+func (s *InMemoryStorage) AddUserAPIKey(ctx context.Context, key UserAPIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[key.UserID]; !ok {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", key.UserID)
+	}
+	s.userAPIKeys[key.ID] = key
+	s.userAPIKeyHash[key.KeyHash] = key.ID
+	return nil
+}
+
+func (s *InMemoryStorage) GetUserAPIKeys(ctx context.Context, userID string) []UserAPIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]UserAPIKey, 0)
+	for _, key := range s.userAPIKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// RotateUserAPIKey заменяет секрет действующего ключа: старый перестаёт приниматься сразу, scope сохраняются
+func (s *InMemoryStorage) RotateUserAPIKey(ctx context.Context, userID, keyID, prefix, keyHash string, now time.Time) (UserAPIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return UserAPIKey{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.userAPIKeys[keyID]
+	if !ok || key.UserID != userID {
+		return UserAPIKey{}, notFoundf("api key %s not found", keyID)
+	}
+	if key.RevokedAt != nil {
+		return UserAPIKey{}, conflictf("api key %s is revoked", keyID)
+	}
+	delete(s.userAPIKeyHash, key.KeyHash)
+	key.Prefix = prefix
+	key.KeyHash = keyHash
+	key.RotatedAt = &now
+	s.userAPIKeys[keyID] = key
+	s.userAPIKeyHash[keyHash] = keyID
+	return key, nil
+}
+
+func (s *InMemoryStorage) RevokeUserAPIKey(ctx context.Context, userID, keyID string, now time.Time) (UserAPIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return UserAPIKey{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.userAPIKeys[keyID]
+	if !ok || key.UserID != userID {
+		return UserAPIKey{}, notFoundf("api key %s not found", keyID)
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &now
+		s.userAPIKeys[keyID] = key
+		delete(s.userAPIKeyHash, key.KeyHash)
+	}
+	return key, nil
+}
+
+// AuthenticateUserAPIKey находит действующий ключ по хешу и отмечает время его использования
+func (s *InMemoryStorage) AuthenticateUserAPIKey(ctx context.Context, keyHash string, now time.Time) (UserAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keyID, ok := s.userAPIKeyHash[keyHash]
+	if !ok {
+		return UserAPIKey{}, &StorageError{Kind: ErrNotFound, Code: CodeUnauthorized, Message: "unknown or revoked api key"}
+	}
+	key := s.userAPIKeys[keyID]
+	key.LastUsedAt = &now
+	s.userAPIKeys[keyID] = key
+	return key, nil
+}
+
+// AuthenticateMerchantKey находит активного мерчанта по хешу ключа и отмечает время использования ключа
+func (s *InMemoryStorage) AuthenticateMerchantKey(ctx context.Context, keyHash string, now time.Time) (Merchant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keyID, ok := s.merchantKeyHash[keyHash]
+	if !ok {
+		return Merchant{}, &StorageError{Kind: ErrNotFound, Code: CodeUnauthorized, Message: "unknown or revoked merchant key"}
+	}
+	key := s.merchantKeys[keyID]
+	m, ok := s.merchants[key.MerchantID]
+	if !ok || !m.Active {
+		return Merchant{}, &StorageError{Kind: ErrConflict, Code: CodeForbidden, Message: "merchant is not active"}
+	}
+	key.LastUsedAt = &now
+	s.merchantKeys[keyID] = key
+	return m, nil
+}
+
+// PayMerchant атомарно списывает оплату картой со счёта покупателя и зачисляет её на расчётный счёт мерчанта
+func (s *InMemoryStorage) PayMerchant(ctx context.Context, tx Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, ok := s.accounts[tx.FromAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", tx.FromAccountID)
+	}
+	to, ok := s.accounts[tx.ToAccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "settlement account %s not found", tx.ToAccountID)
+	}
+	if from.IsClosed() {
+		return accountClosedError(from.ID)
+	}
+	if to.IsClosed() {
+		return accountClosedError(to.ID)
+	}
+	if from.Currency != to.Currency {
+		return &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("merchant accepts payments in %s only", to.Currency)}
+	}
+	if from.AvailableBalance.LessThan(tx.Amount) {
+		return &StorageError{Kind: ErrInsufficientFunds, Message: fmt.Sprintf("insufficient funds on account %s", from.ID)}
+	}
+
+	from.Balance = from.Balance.Sub(tx.Amount)
+	to.Balance = to.Balance.Add(tx.Amount)
+	from.refreshAvailable()
+	to.refreshAvailable()
+	if err := s.casAccounts(&from, &to); err != nil {
+		return err
+	}
+	s.adjustSummaryBalance(from.UserID, tx.Amount.Neg())
+	s.adjustSummaryBalance(to.UserID, tx.Amount)
+	s.appendTransaction(tx)
+	return nil
+}
+
+// GetMerchantTransactions возвращает оплаты и возвраты мерчанта в порядке записи в журнал
+func (s *InMemoryStorage) GetMerchantTransactions(ctx context.Context, merchantID string) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	positions := s.merchantTxIndex[merchantID]
+	txs := make([]Transaction, 0, len(positions))
+	for _, pos := range positions {
+		txs = append(txs, s.journalAt(pos))
+	}
+	return txs
+}
+
+// GetCardTransactions возвращает оплаты картой и возвраты по ним в порядке записи в журнал
+func (s *InMemoryStorage) GetCardTransactions(ctx context.Context, cardID string) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	positions := s.cardTxIndex[cardID]
+	txs := make([]Transaction, 0, len(positions))
+	for _, pos := range positions {
+		txs = append(txs, s.journalAt(pos))
+	}
+	return txs
+}
+
+// Журнал доставок хранит последние попытки каждого мерчанта
+const merchantDeliveryLogSize = 500
+
+type merchantDeliveryLog []MerchantWebhookDelivery
+
+func (s *InMemoryStorage) SetMerchantWebhook(ctx context.Context, hook MerchantWebhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.merchants[hook.MerchantID]; !ok {
+		return notFoundf("merchant %s not found", hook.MerchantID)
+	}
+	s.merchantHooks[hook.MerchantID] = hook
+	return nil
+}
+
+func (s *InMemoryStorage) GetMerchantWebhook(ctx context.Context, merchantID string) (MerchantWebhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hook, ok := s.merchantHooks[merchantID]
+	return hook, ok
+}
+
+func (s *InMemoryStorage) DeleteMerchantWebhook(ctx context.Context, merchantID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.merchantHooks[merchantID]; !ok {
+		return notFoundf("merchant %s has no webhook configured", merchantID)
+	}
+	delete(s.merchantHooks, merchantID)
+	return nil
+}
+
+func (s *InMemoryStorage) AddMerchantWebhookDelivery(ctx context.Context, d MerchantWebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := append(s.merchantHookLog[d.MerchantID], d)
+	if len(log) > merchantDeliveryLogSize {
+		log = append(merchantDeliveryLog(nil), log[len(log)-merchantDeliveryLogSize:]...)
+	}
+	s.merchantHookLog[d.MerchantID] = log
+}
+
+// GetMerchantWebhookDeliveries — попытки доставки, новые сверху; eventType и failedOnly сужают выборку
+func (s *InMemoryStorage) GetMerchantWebhookDeliveries(ctx context.Context, merchantID, eventType string, failedOnly bool) []MerchantWebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	log := s.merchantHookLog[merchantID]
+	result := make([]MerchantWebhookDelivery, 0)
+	for i := len(log) - 1; i >= 0; i-- {
+		if (eventType == "" || log[i].EventType == eventType) && (!failedOnly || !log[i].Success) {
+			result = append(result, log[i])
+		}
+	}
+	return result
+}
+
+// OpenChargeback регистрирует спор по оплате мерчанту и удерживает сумму на его расчётном счёте.
+// Если доступных средств не хватает, удерживается сколько есть; остаток решается при удовлетворении спора.
+func (s *InMemoryStorage) OpenChargeback(ctx context.Context, cb Chargeback) (Chargeback, error) {
+	if err := ctx.Err(); err != nil {
+		return Chargeback{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.txByID[cb.TransactionID]
+	if !ok {
+		return Chargeback{}, notFoundCodef(CodeTransactionNotFound, "transaction %s not found", cb.TransactionID)
+	}
+	original := s.journalAt(pos)
+	if original.TransactionType != "payment" || original.MerchantID == "" {
+		return Chargeback{}, &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("transaction %s is not a payment to a registered merchant", original.ID)}
+	}
+	for _, id := range s.chargebacksByTx[original.ID] {
+		if existing := s.chargebacks[id]; !existing.IsResolved() {
+			return Chargeback{}, conflictf("payment %s already has an open chargeback %s", original.ID, existing.ID)
+		}
+	}
+
+	remaining := original.Amount.Sub(s.refunded[original.ID])
+	if cb.Amount.IsZero() {
+		cb.Amount = remaining
+	}
+	if !cb.Amount.IsPositive() || cb.Amount.GreaterThan(remaining) {
+		return Chargeback{}, &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("chargeback amount must be positive and at most %s", remaining.String())}
+	}
+
+	customer, ok := s.accounts[original.FromAccountID]
+	if !ok {
+		return Chargeback{}, notFoundCodef(CodeAccountNotFound, "account %s not found", original.FromAccountID)
+	}
+	if cb.UserID != "" && cb.UserID != customer.UserID {
+		return Chargeback{}, notFoundCodef(CodeTransactionNotFound, "transaction %s not found", original.ID)
+	}
+	settlement, ok := s.accounts[original.ToAccountID]
+	if !ok {
+		return Chargeback{}, notFoundCodef(CodeAccountNotFound, "settlement account %s not found", original.ToAccountID)
+	}
+
+	cb.MerchantID = original.MerchantID
+	cb.UserID = customer.UserID
+	cb.CustomerAccountID = customer.ID
+	cb.SettlementAccountID = settlement.ID
+	cb.Status = ChargebackOpen
+	cb.HeldAmount = decimal.Min(cb.Amount, decimal.Max(settlement.AvailableBalance, decimal.Zero))
+	if cb.HeldAmount.IsPositive() {
+		settlement.HeldAmount = settlement.HeldAmount.Add(cb.HeldAmount)
+		settlement.refreshAvailable()
+		if err := s.casAccounts(&settlement); err != nil {
+			return Chargeback{}, err
+		}
+	}
+
+	s.chargebacks[cb.ID] = cb
+	s.chargebacksByTx[original.ID] = append(s.chargebacksByTx[original.ID], cb.ID)
+	return cb, nil
+}
+
+func (s *InMemoryStorage) GetChargeback(ctx context.Context, id string) (Chargeback, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cb, ok := s.chargebacks[id]
+	return cb, ok
+}
+
+// ListChargebacks фильтрует споры по мерчанту, клиенту и статусу; пустой параметр — без фильтра
+func (s *InMemoryStorage) ListChargebacks(ctx context.Context, merchantID, userID, status string) []Chargeback {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []Chargeback
+	for _, cb := range s.chargebacks {
+		if (merchantID == "" || cb.MerchantID == merchantID) && (userID == "" || cb.UserID == userID) && (status == "" || cb.Status == status) {
+			result = append(result, cb)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+func (s *InMemoryStorage) AddChargebackEvidence(ctx context.Context, merchantID, id string, evidence ChargebackEvidence) (Chargeback, error) {
+	if err := ctx.Err(); err != nil {
+		return Chargeback{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cb, ok := s.chargebacks[id]
+	if !ok || cb.MerchantID != merchantID {
+		return Chargeback{}, notFoundf("chargeback %s not found", id)
+	}
+	if cb.IsResolved() {
+		return Chargeback{}, conflictf("chargeback %s is already %s", id, cb.Status)
+	}
+	cb.Evidence = append(cb.Evidence, evidence)
+	cb.Status = ChargebackEvidenceSubmitted
+	s.chargebacks[id] = cb
+	return cb, nil
+}
+
+// ResolveChargeback снимает удержание и, если спор удовлетворён, возвращает сумму клиенту проводкой chargeback,
+// связанной с исходной оплатой. Часть, которую нельзя списать с мерчанта, банк возмещает сам отдельной
+// проводкой и записывает задолженностью мерчанта.
+func (s *InMemoryStorage) ResolveChargeback(ctx context.Context, id string, accept bool, resolution string, tx Transaction, receivable Receivable, now time.Time) (Chargeback, error) {
+	if err := ctx.Err(); err != nil {
+		return Chargeback{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cb, ok := s.chargebacks[id]
+	if !ok {
+		return Chargeback{}, notFoundf("chargeback %s not found", id)
+	}
+	if cb.IsResolved() {
+		return Chargeback{}, conflictf("chargeback %s is already %s", id, cb.Status)
+	}
+	settlement, ok := s.accounts[cb.SettlementAccountID]
+	if !ok {
+		return Chargeback{}, notFoundCodef(CodeAccountNotFound, "settlement account %s not found", cb.SettlementAccountID)
+	}
+	customer, ok := s.accounts[cb.CustomerAccountID]
+	if !ok {
+		return Chargeback{}, notFoundCodef(CodeAccountNotFound, "account %s not found", cb.CustomerAccountID)
+	}
+	if accept && customer.IsClosed() {
+		return Chargeback{}, accountClosedError(customer.ID)
+	}
+
+	settlement.HeldAmount = settlement.HeldAmount.Sub(cb.HeldAmount)
+	settlement.refreshAvailable()
+	if err := s.casAccounts(&settlement); err != nil {
+		return Chargeback{}, err
+	}
+
+	cb.Resolution = resolution
+	cb.ResolvedAt = &now
+	if !accept {
+		cb.Status = ChargebackRejected
+		s.chargebacks[id] = cb
+		return cb, nil
+	}
+
+	debit := decimal.Min(cb.Amount, decimal.Max(settlement.AvailableBalance, decimal.Zero))
+	settlement.Balance = settlement.Balance.Sub(debit)
+	settlement.refreshAvailable()
+	customer.Balance = customer.Balance.Add(cb.Amount)
+	customer.refreshAvailable()
+	if err := s.casAccounts(&settlement, &customer); err != nil {
+		return Chargeback{}, err
+	}
+	s.adjustSummaryBalance(settlement.UserID, debit.Neg())
+	s.adjustSummaryBalance(customer.UserID, cb.Amount)
+
+	tx.ToAccountID = customer.ID
+	tx.TransactionType = "chargeback"
+	tx.MerchantID = cb.MerchantID
+	tx.LinkedTxID = cb.TransactionID
+	if debit.IsPositive() {
+		fromMerchant := tx
+		fromMerchant.FromAccountID = settlement.ID
+		fromMerchant.Amount = debit
+		s.appendTransaction(fromMerchant)
+		cb.ChargebackTxIDs = append(cb.ChargebackTxIDs, fromMerchant.ID)
+	}
+	if shortfall := cb.Amount.Sub(debit); shortfall.IsPositive() {
+		fromBank := tx
+		fromBank.ID = GenerateID()
+		fromBank.Amount = shortfall
+		s.appendTransaction(fromBank)
+		cb.ChargebackTxIDs = append(cb.ChargebackTxIDs, fromBank.ID)
+
+		receivable.Amount = shortfall
+		receivable = s.recordReceivable(receivable, settlement, cb.TransactionID, now)
+		cb.ReceivableID = receivable.ID
+	}
+
+	s.refunded[cb.TransactionID] = s.refunded[cb.TransactionID].Add(cb.Amount)
+	cb.Status = ChargebackAccepted
+	s.chargebacks[id] = cb
+	return cb, nil
+}
+
+func (s *InMemoryStorage) AddInvoice(ctx context.Context, inv Invoice) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.invoices[inv.ID]; exists {
+		return conflictf("invoice %s already exists", inv.ID)
+	}
+	s.invoices[inv.ID] = inv
+	return nil
+}
+
+func (s *InMemoryStorage) GetInvoice(ctx context.Context, id string) (Invoice, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inv, ok := s.invoices[id]
+	return inv, ok
+}
+
+// ListInvoices — счета, выставленные пользователем, новые сверху
+func (s *InMemoryStorage) ListInvoices(ctx context.Context, issuerUserID string) []Invoice {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Invoice, 0)
+	for _, inv := range s.invoices {
+		if inv.IssuerUserID == issuerUserID {
+			result = append(result, inv)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// PayInvoice атомарно переводит сумму счёта с fromAccountID на счёт зачисления и помечает счёт оплаченным,
+// поэтому два одновременных платежа по одной ссылке не спишут деньги дважды
+func (s *InMemoryStorage) PayInvoice(ctx context.Context, id, fromAccountID string, tx Transaction, now time.Time) (Invoice, Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return Invoice{}, Transaction{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invoices[id]
+	if !ok {
+		return Invoice{}, Transaction{}, notFoundCodef(CodeInvoiceNotFound, "invoice %s not found", id)
+	}
+	if status := inv.StatusAt(now); status != InvoiceOpen {
+		return Invoice{}, Transaction{}, &StorageError{Kind: ErrConflict, Code: CodeInvoiceNotPayable, Message: fmt.Sprintf("invoice %s is %s", id, status)}
+	}
+	from, ok := s.accounts[fromAccountID]
+	if !ok {
+		return Invoice{}, Transaction{}, notFoundCodef(CodeAccountNotFound, "source account %s not found", fromAccountID)
+	}
+	to, ok := s.accounts[inv.AccountID]
+	if !ok {
+		return Invoice{}, Transaction{}, notFoundCodef(CodeAccountNotFound, "destination account %s not found", inv.AccountID)
+	}
+	if from.ID == to.ID {
+		return Invoice{}, Transaction{}, &StorageError{Kind: ErrInvalidInput, Message: "cannot pay an invoice from the account it credits"}
+	}
+	if from.IsClosed() {
+		return Invoice{}, Transaction{}, accountClosedError(from.ID)
+	}
+	if to.IsClosed() {
+		return Invoice{}, Transaction{}, accountClosedError(to.ID)
+	}
+	if from.Currency != inv.Currency {
+		return Invoice{}, Transaction{}, &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("invoice is payable in %s only", inv.Currency)}
+	}
+	if from.AvailableBalance.LessThan(inv.Amount) {
+		return Invoice{}, Transaction{}, &StorageError{Kind: ErrInsufficientFunds, Message: "insufficient funds in source account"}
+	}
+
+	from.Balance = from.Balance.Sub(inv.Amount)
+	to.Balance = to.Balance.Add(inv.Amount)
+	from.refreshAvailable()
+	to.refreshAvailable()
+	if err := s.casAccounts(&from, &to); err != nil {
+		return Invoice{}, Transaction{}, err
+	}
+	s.adjustSummaryBalance(from.UserID, inv.Amount.Neg())
+	s.adjustSummaryBalance(to.UserID, inv.Amount)
+
+	tx.FromAccountID = from.ID
+	tx.ToAccountID = to.ID
+	tx.Amount = inv.Amount
+	tx.TransactionType = "transfer"
+	tx.Describe(DescInvoicePayment, map[string]string{"invoice": inv.ID, "description": inv.Description})
+	s.appendTransaction(tx)
+
+	inv.Status = InvoicePaid
+	inv.PaidAt = &now
+	inv.PayerAccountID = from.ID
+	inv.TransactionID = tx.ID
+	s.invoices[id] = inv
+	return inv, tx, nil
+}
+
+// CancelInvoice отзывает неоплаченный счёт; с непустым issuerUserID — только если счёт выставил этот пользователь
+func (s *InMemoryStorage) CancelInvoice(ctx context.Context, id, issuerUserID string, now time.Time) (Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return Invoice{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[id]
+	if !ok || (issuerUserID != "" && inv.IssuerUserID != issuerUserID) {
+		return Invoice{}, notFoundCodef(CodeInvoiceNotFound, "invoice %s not found", id)
+	}
+	if inv.Status != InvoiceOpen {
+		return Invoice{}, &StorageError{Kind: ErrConflict, Code: CodeInvoiceNotPayable, Message: fmt.Sprintf("invoice %s is already %s", id, inv.Status)}
+	}
+	inv.Status = InvoiceCancelled
+	inv.CancelledAt = &now
+	s.invoices[id] = inv
+	return inv, nil
+}
+
+func (s *InMemoryStorage) AddMoneyRequest(ctx context.Context, pr MoneyRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.moneyRequests[pr.ID]; exists {
+		return conflictf("payment request %s already exists", pr.ID)
+	}
+	s.moneyRequests[pr.ID] = pr
+	return nil
+}
+
+func (s *InMemoryStorage) GetMoneyRequest(ctx context.Context, id string) (MoneyRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pr, ok := s.moneyRequests[id]
+	return pr, ok
+}
+
+// ListMoneyRequests — запросы денег пользователя, новые сверху: incoming — где он плательщик,
+// outgoing — где он запросил деньги, пустая роль — все
+func (s *InMemoryStorage) ListMoneyRequests(ctx context.Context, userID, role string) []MoneyRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]MoneyRequest, 0)
+	for _, pr := range s.moneyRequests {
+		incoming := pr.PayerUserID == userID
+		outgoing := pr.RequesterUserID == userID
+		if (role == "incoming" && incoming) || (role == "outgoing" && outgoing) || (role == "" && (incoming || outgoing)) {
+			result = append(result, pr)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// AcceptMoneyRequest атомарно переводит запрошенную сумму с fromAccountID на счёт зачисления и помечает запрос
+// принятым, поэтому повторное или параллельное принятие не спишет деньги дважды
+func (s *InMemoryStorage) AcceptMoneyRequest(ctx context.Context, id, fromAccountID string, tx Transaction, now time.Time) (MoneyRequest, Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return MoneyRequest{}, Transaction{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pr, ok := s.moneyRequests[id]
+	if !ok {
+		return MoneyRequest{}, Transaction{}, notFoundCodef(CodePaymentRequestNotFound, "payment request %s not found", id)
+	}
+	if status := pr.StatusAt(now); status != MoneyRequestPending {
+		return MoneyRequest{}, Transaction{}, &StorageError{Kind: ErrConflict, Code: CodePaymentRequestNotPending, Message: fmt.Sprintf("payment request %s is %s", id, status)}
+	}
+	from, ok := s.accounts[fromAccountID]
+	if !ok {
+		return MoneyRequest{}, Transaction{}, notFoundCodef(CodeAccountNotFound, "source account %s not found", fromAccountID)
+	}
+	to, ok := s.accounts[pr.AccountID]
+	if !ok {
+		return MoneyRequest{}, Transaction{}, notFoundCodef(CodeAccountNotFound, "destination account %s not found", pr.AccountID)
+	}
+	if from.IsClosed() {
+		return MoneyRequest{}, Transaction{}, accountClosedError(from.ID)
+	}
+	if to.IsClosed() {
+		return MoneyRequest{}, Transaction{}, accountClosedError(to.ID)
+	}
+	if from.Currency != pr.Currency {
+		return MoneyRequest{}, Transaction{}, &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("payment request is payable in %s only", pr.Currency)}
+	}
+	if from.AvailableBalance.LessThan(pr.Amount) {
+		return MoneyRequest{}, Transaction{}, &StorageError{Kind: ErrInsufficientFunds, Message: "insufficient funds in source account"}
+	}
+
+	from.Balance = from.Balance.Sub(pr.Amount)
+	to.Balance = to.Balance.Add(pr.Amount)
+	from.refreshAvailable()
+	to.refreshAvailable()
+	if err := s.casAccounts(&from, &to); err != nil {
+		return MoneyRequest{}, Transaction{}, err
+	}
+	s.adjustSummaryBalance(from.UserID, pr.Amount.Neg())
+	s.adjustSummaryBalance(to.UserID, pr.Amount)
+
+	tx.FromAccountID = from.ID
+	tx.ToAccountID = to.ID
+	tx.Amount = pr.Amount
+	tx.TransactionType = "transfer"
+	tx.Describe(DescPaymentRequest, map[string]string{"requester": pr.RequesterName, "description": pr.Description})
+	s.appendTransaction(tx)
+
+	pr.Status = MoneyRequestAccepted
+	pr.DecidedAt = &now
+	pr.PayerAccountID = from.ID
+	pr.TransactionID = tx.ID
+	s.moneyRequests[id] = pr
+	return pr, tx, nil
+}
+
+// CloseMoneyRequest переводит ожидающий ответа запрос в status (declined или cancelled) без движения денег
+func (s *InMemoryStorage) CloseMoneyRequest(ctx context.Context, id, status, reason string, now time.Time) (MoneyRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return MoneyRequest{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, ok := s.moneyRequests[id]
+	if !ok {
+		return MoneyRequest{}, notFoundCodef(CodePaymentRequestNotFound, "payment request %s not found", id)
+	}
+	if current := pr.StatusAt(now); current != MoneyRequestPending {
+		return MoneyRequest{}, &StorageError{Kind: ErrConflict, Code: CodePaymentRequestNotPending, Message: fmt.Sprintf("payment request %s is already %s", id, current)}
+	}
+	pr.Status = status
+	pr.DecidedAt = &now
+	pr.DeclineReason = reason
+	s.moneyRequests[id] = pr
+	return pr, nil
+}
+
+// SystemUserID — владелец служебных счетов банка; такие счета не входят в сводки и списки счетов клиентов
+const SystemUserID = "system"
+
+func EscrowAccountID(currency string) string {
+	return "escrow-" + currency
+}
+
+// escrowAccount возвращает системный счёт эскроу в валюте, открывая его при первом обращении.
+// Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) escrowAccount(currency string, now time.Time) Account {
+	id := EscrowAccountID(currency)
+	if acc, ok := s.accounts[id]; ok {
+		return acc
+	}
+	acc := Account{
+		ID:              id,
+		UserID:          SystemUserID,
+		Number:          "ESCROW-" + currency,
+		Balance:         decimal.Zero,
+		CreatedAt:       now,
+		ProductCode:     "escrow",
+		Currency:        currency,
+		InterestRate:    decimal.Zero,
+		MonthlyFee:      decimal.Zero,
+		AccruedInterest: decimal.Zero,
+		Status:          AccountStatusActive,
+	}
+	acc.refreshAvailable()
+	s.putAccount(&acc)
+	return acc
+}
+
+// OpenEscrow списывает сумму сделки с покупателя на системный счёт эскроу проводкой fundTx
+func (s *InMemoryStorage) OpenEscrow(ctx context.Context, e Escrow, fundTx Transaction) (Escrow, error) {
+	if err := ctx.Err(); err != nil {
+		return Escrow{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buyer, ok := s.accounts[e.BuyerAccountID]
+	if !ok {
+		return Escrow{}, notFoundCodef(CodeAccountNotFound, "buyer account %s not found", e.BuyerAccountID)
+	}
+	seller, ok := s.accounts[e.SellerAccountID]
+	if !ok {
+		return Escrow{}, notFoundCodef(CodeAccountNotFound, "seller account %s not found", e.SellerAccountID)
+	}
+	if buyer.IsClosed() {
+		return Escrow{}, accountClosedError(buyer.ID)
+	}
+	if seller.IsClosed() {
+		return Escrow{}, accountClosedError(seller.ID)
+	}
+	if buyer.UserID == seller.UserID {
+		return Escrow{}, &StorageError{Kind: ErrInvalidInput, Message: "buyer and seller must be different users"}
+	}
+	if buyer.Currency != seller.Currency {
+		return Escrow{}, &StorageError{Kind: ErrInvalidInput, Message: "buyer and seller accounts have different currencies"}
+	}
+	if buyer.AvailableBalance.LessThan(e.Amount) {
+		return Escrow{}, &StorageError{Kind: ErrInsufficientFunds, Message: "insufficient funds in buyer account"}
+	}
+
+	escrow := s.escrowAccount(buyer.Currency, e.CreatedAt)
+	buyer.Balance = buyer.Balance.Sub(e.Amount)
+	buyer.refreshAvailable()
+	escrow.Balance = escrow.Balance.Add(e.Amount)
+	escrow.refreshAvailable()
+	if err := s.casAccounts(&buyer, &escrow); err != nil {
+		return Escrow{}, err
+	}
+	s.adjustSummaryBalance(buyer.UserID, e.Amount.Neg())
+
+	fundTx.FromAccountID = buyer.ID
+	fundTx.ToAccountID = escrow.ID
+	fundTx.Amount = e.Amount
+	fundTx.TransactionType = "escrow_fund"
+	fundTx.Describe(DescEscrowFund, map[string]string{"seller": seller.Number, "description": e.Description})
+	s.appendTransaction(fundTx)
+
+	e.BuyerUserID = buyer.UserID
+	e.SellerUserID = seller.UserID
+	e.Currency = buyer.Currency
+	e.Status = EscrowFunded
+	e.FundTxID = fundTx.ID
+	s.escrows[e.ID] = e
+	return e, nil
+}
+
+func (s *InMemoryStorage) GetEscrow(ctx context.Context, id string) (Escrow, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.escrows[id]
+	return e, ok
+}
+
+// ListEscrows — сделки, где пользователь покупатель или продавец (пустой userID — все), по статусу; новые сверху
+func (s *InMemoryStorage) ListEscrows(ctx context.Context, userID, status string) []Escrow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Escrow, 0)
+	for _, e := range s.escrows {
+		if (userID == "" || e.BuyerUserID == userID || e.SellerUserID == userID) && (status == "" || e.Status == status) {
+			result = append(result, e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// UpdateEscrow меняет статус сделки без движения денег (исполнение, спор); закрытые сделки не меняются
+func (s *InMemoryStorage) UpdateEscrow(ctx context.Context, id string, update func(*Escrow) error) (Escrow, error) {
+	if err := ctx.Err(); err != nil {
+		return Escrow{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.escrows[id]
+	if !ok {
+		return Escrow{}, notFoundCodef(CodeEscrowNotFound, "escrow %s not found", id)
+	}
+	if e.IsClosed() {
+		return Escrow{}, conflictf("escrow %s is already %s", id, e.Status)
+	}
+	if err := update(&e); err != nil {
+		return Escrow{}, err
+	}
+	s.escrows[id] = e
+	return e, nil
+}
+
+// SettleEscrow выплачивает деньги сделки продавцу (release) или возвращает покупателю проводкой tx,
+// связанной с депонированием. Сделка должна быть в одном из статусов from — это защищает от гонки
+// между действием клиента и таймаутом.
+func (s *InMemoryStorage) SettleEscrow(ctx context.Context, id string, release bool, from []string, tx Transaction, resolution string, now time.Time) (Escrow, error) {
+	if err := ctx.Err(); err != nil {
+		return Escrow{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.escrows[id]
+	if !ok {
+		return Escrow{}, notFoundCodef(CodeEscrowNotFound, "escrow %s not found", id)
+	}
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || e.Status == status
+	}
+	if !allowed {
+		return Escrow{}, conflictf("escrow %s is %s", id, e.Status)
+	}
+
+	payeeID, status, txType, key := e.BuyerAccountID, EscrowRefunded, "escrow_refund", DescEscrowRefund
+	if release {
+		payeeID, status, txType, key = e.SellerAccountID, EscrowReleased, "escrow_release", DescEscrowRelease
+	}
+	payee, ok := s.accounts[payeeID]
+	if !ok {
+		return Escrow{}, notFoundCodef(CodeAccountNotFound, "account %s not found", payeeID)
+	}
+	if payee.IsClosed() {
+		return Escrow{}, accountClosedError(payee.ID)
+	}
+	escrow := s.escrowAccount(e.Currency, now)
+	escrow.Balance = escrow.Balance.Sub(e.Amount)
+	escrow.refreshAvailable()
+	payee.Balance = payee.Balance.Add(e.Amount)
+	payee.refreshAvailable()
+	if err := s.casAccounts(&escrow, &payee); err != nil {
+		return Escrow{}, err
+	}
+	s.adjustSummaryBalance(payee.UserID, e.Amount)
+
+	tx.FromAccountID = escrow.ID
+	tx.ToAccountID = payee.ID
+	tx.Amount = e.Amount
+	tx.TransactionType = txType
+	tx.LinkedTxID = e.FundTxID
+	params := map[string]string{"description": e.Description}
+	if buyer, ok := s.accounts[e.BuyerAccountID]; ok {
+		params["buyer"] = buyer.Number
+	}
+	tx.Describe(key, params)
+	s.appendTransaction(tx)
+
+	e.Status = status
+	e.SettleTxID = tx.ID
+	e.Resolution = resolution
+	e.ClosedAt = &now
+	s.escrows[id] = e
+	return e, nil
+}
+
+// DueEscrows — сделки с истёкшим сроком: не исполненные к FulfillBy и не подтверждённые к ReleaseBy
+func (s *InMemoryStorage) DueEscrows(ctx context.Context, now time.Time) []Escrow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var due []Escrow
+	for _, e := range s.escrows {
+		if (e.Status == EscrowFunded && now.After(e.FulfillBy)) || (e.Status == EscrowFulfilled && e.ReleaseBy != nil && now.After(*e.ReleaseBy)) {
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+// operationVolume — объём операций одного типа за день Day; с наступлением нового дня счёт начинается с нуля
+type operationVolume struct {
+	Day    time.Time
+	Amount decimal.Decimal
+}
+
+func operationDisabledError(c OperationControl) error {
+	msg := fmt.Sprintf("operation %s is temporarily disabled", c.Type)
+	if c.Reason != "" {
+		msg += ": " + c.Reason
+	}
+	return &StorageError{Kind: ErrUnavailable, Code: CodeOperationDisabled, Message: msg}
+}
+
+func (s *InMemoryStorage) SetOperationControl(ctx context.Context, c OperationControl) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opControls[c.Type] = c
+	return nil
+}
+
+func (s *InMemoryStorage) GetOperationControl(ctx context.Context, opType string) (OperationControl, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.opControls[opType]
+	return c, ok
+}
+
+// ReserveOperationVolume атомарно проверяет выключатель и дневной лимит типа операции и засчитывает
+// amount (в рублях) в объём дня day. Резерв снимается ReleaseOperationVolume, если операция не прошла.
+func (s *InMemoryStorage) ReserveOperationVolume(ctx context.Context, opType string, day time.Time, amount decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.opControls[opType]
+	if !ok {
+		return nil
+	}
+	if c.Disabled {
+		return operationDisabledError(c)
+	}
+	if !c.DailyCap.IsPositive() {
+		return nil
+	}
+	v := s.opVolumes[opType]
+	if !v.Day.Equal(day) {
+		v = operationVolume{Day: day}
+	}
+	if v.Amount.Add(amount).GreaterThan(c.DailyCap) {
+		return &StorageError{
+			Kind:    ErrQuotaExceeded,
+			Code:    CodeBankLimitExceeded,
+			Message: fmt.Sprintf("daily bank limit for %s operations is exhausted, try again tomorrow", opType),
+		}
+	}
+	v.Amount = v.Amount.Add(amount)
+	s.opVolumes[opType] = v
+	return nil
+}
+
+func (s *InMemoryStorage) ReleaseOperationVolume(ctx context.Context, opType string, day time.Time, amount decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.opVolumes[opType]
+	if !ok || !v.Day.Equal(day) {
+		return
+	}
+	v.Amount = decimal.Max(v.Amount.Sub(amount), decimal.Zero)
+	s.opVolumes[opType] = v
+}
+
+// OutgoingDebitTypes — типы проводок, которыми клиент сам списывает деньги со своего счёта. Они засчитываются
+// в дневной лимит переводов счёта; оплаты картой считаются отдельно, обмен и банковские списания не считаются.
+var OutgoingDebitTypes = map[string]bool{
+	"transfer":    true,
+	"escrow_fund": true,
+	"withdrawal":  true,
+}
+
+// outgoingDebitsSince считает по индексу списаний счёта, а не по всему журналу: проверка лимита идёт под
+// блокировкой записи при каждом переводе. Вызывающий должен удерживать s.mu.
+func (s *InMemoryStorage) outgoingDebitsSince(accountID string, since time.Time) decimal.Decimal {
+	total := decimal.Zero
+	for _, pos := range s.debitTxIndex[accountID] {
+		if tx := s.journalAt(pos); !tx.EffectiveDate().Before(since) {
+			total = total.Add(tx.Amount)
+		}
+	}
+	return total
+}
+
+// OutgoingDebitsSince суммирует исходящие списания клиента со счёта начиная с момента since
+func (s *InMemoryStorage) OutgoingDebitsSince(ctx context.Context, accountID string, since time.Time) decimal.Decimal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.outgoingDebitsSince(accountID, since)
+}
+
+// ReserveTransferLimit атомарно проверяет дневной лимит счёта: проведённые с since списания, ещё не проведённые
+// резервы и amount вместе не должны превышать limit. Резерв снимается ReleaseTransferLimit после того, как
+// списание проведено или не прошло.
+func (s *InMemoryStorage) ReserveTransferLimit(ctx context.Context, accountID string, since time.Time, limit, amount decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", accountID)
+	}
+	spent := s.outgoingDebitsSince(accountID, since).Add(s.transferHolds[accountID])
+	if spent.Add(amount).GreaterThan(limit) {
+		return &StorageError{
+			Kind:    ErrQuotaExceeded,
+			Code:    CodeLimitExceeded,
+			Message: fmt.Sprintf("transfer exceeds the daily limit of %s on account %s (transferred today: %s)", limit.String(), acc.Number, spent.String()),
+		}
+	}
+	s.transferHolds[accountID] = s.transferHolds[accountID].Add(amount)
+	return nil
+}
+
+func (s *InMemoryStorage) ReleaseTransferLimit(ctx context.Context, accountID string, amount decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if held := s.transferHolds[accountID].Sub(amount); held.IsPositive() {
+		s.transferHolds[accountID] = held
+	} else {
+		delete(s.transferHolds, accountID)
+	}
+}
+
+// OperationVolume — объём операций типа за день day, засчитанный в дневной лимит
+func (s *InMemoryStorage) OperationVolume(ctx context.Context, opType string, day time.Time) decimal.Decimal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.opVolumes[opType]; ok && v.Day.Equal(day) {
+		return v.Amount
+	}
+	return decimal.Zero
+}
+
+// SaveSaga создаёт или перезаписывает запись о многошаговой операции
+func (s *InMemoryStorage) SaveSaga(ctx context.Context, saga Saga) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saga.Steps = append([]SagaStep(nil), saga.Steps...)
+	s.sagas[saga.ID] = saga
+	return nil
+}
+
+func (s *InMemoryStorage) GetSaga(ctx context.Context, id string) (Saga, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saga, ok := s.sagas[id]
+	return saga, ok
+}
+
+// ListSagas — операции с указанным статусом (пустой — все), новые сверху
+func (s *InMemoryStorage) ListSagas(ctx context.Context, status string) []Saga {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Saga, 0)
+	for _, saga := range s.sagas {
+		if status == "" || saga.Status == status {
+			result = append(result, saga)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// SaveEODBatch создаёт или перезаписывает запись о закрытии операционного дня
+func (s *InMemoryStorage) SaveEODBatch(ctx context.Context, batch EODBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch.Steps = append([]EODStep(nil), batch.Steps...)
+	batch.Settlements = append([]EODMerchantSettlement(nil), batch.Settlements...)
+	s.eodBatches[batch.Date] = batch
+	return nil
+}
+
+func (s *InMemoryStorage) GetEODBatch(ctx context.Context, date string) (EODBatch, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	batch, ok := s.eodBatches[date]
+	return batch, ok
+}
+
+// ListEODBatches — закрытия дней, последние сверху
+func (s *InMemoryStorage) ListEODBatches(ctx context.Context) []EODBatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]EODBatch, 0, len(s.eodBatches))
+	for _, batch := range s.eodBatches {
+		result = append(result, batch)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date > result[j].Date })
+	return result
+}
+
+// SnapshotBalances фиксирует остатки всех открытых счетов клиентов на дату; повторный снимок за ту же дату
+// заменяет предыдущий
+func (s *InMemoryStorage) SnapshotBalances(ctx context.Context, date string) ([]BalanceSnapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots := make([]BalanceSnapshot, 0, len(s.accounts))
+	for _, acc := range s.accounts {
+		if acc.IsClosed() || acc.UserID == SystemUserID {
+			continue
+		}
+		snapshots = append(snapshots, BalanceSnapshot{
+			Date:             date,
+			AccountID:        acc.ID,
+			UserID:           acc.UserID,
+			Currency:         acc.Currency,
+			Balance:          acc.Balance,
+			AvailableBalance: acc.AvailableBalance,
+			AccruedInterest:  acc.AccruedInterest,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].AccountID < snapshots[j].AccountID })
+	s.balanceSnapshots[date] = snapshots
+	return append([]BalanceSnapshot(nil), snapshots...), nil
+}
+
+// ListBalanceSnapshots — остатки на конец дня date; accountID, если задан, сужает выборку до одного счёта
+func (s *InMemoryStorage) ListBalanceSnapshots(ctx context.Context, date, accountID string) []BalanceSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]BalanceSnapshot, 0)
+	for _, snapshot := range s.balanceSnapshots[date] {
+		if accountID == "" || snapshot.AccountID == accountID {
+			result = append(result, snapshot)
+		}
+	}
+	return result
+}
+
+func (s *InMemoryStorage) AddLimitOverride(ctx context.Context, o LimitOverride) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[o.AccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", o.AccountID)
+	}
+	if acc.IsClosed() {
+		return accountClosedError(acc.ID)
+	}
+	for _, existing := range s.limitOverrides {
+		if existing.AccountID == o.AccountID && existing.Status == LimitOverridePending {
+			return conflictf("account %s already has a pending limit override request %s", o.AccountID, existing.ID)
+		}
+	}
+	o.UserID = acc.UserID
+	s.limitOverrides[o.ID] = o
+	return nil
+}
+
+func (s *InMemoryStorage) GetLimitOverride(ctx context.Context, id string) (LimitOverride, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.limitOverrides[id]
+	return o, ok
+}
+
+// ListLimitOverrides возвращает заявки по счёту (accountID пустой — все) и статусу (пустой — любой), старые первыми
+func (s *InMemoryStorage) ListLimitOverrides(ctx context.Context, accountID, status string) []LimitOverride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]LimitOverride, 0)
+	for _, o := range s.limitOverrides {
+		if (accountID == "" || o.AccountID == accountID) && (status == "" || o.Status == status) {
+			result = append(result, o)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].RequestedAt.Before(result[j].RequestedAt) })
+	return result
+}
+
+// DecideLimitOverride применяет решение к заявке, пока она ожидает рассмотрения
+func (s *InMemoryStorage) DecideLimitOverride(ctx context.Context, id string, decide func(*LimitOverride)) (LimitOverride, error) {
+	if err := ctx.Err(); err != nil {
+		return LimitOverride{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.limitOverrides[id]
+	if !ok {
+		return LimitOverride{}, notFoundf("limit override %s not found", id)
+	}
+	if o.Status != LimitOverridePending {
+		return LimitOverride{}, conflictf("limit override %s is already %s", id, o.Status)
+	}
+	decide(&o)
+	s.limitOverrides[id] = o
+	return o, nil
+}
+
+// ActiveLimitOverride — действующее на момент now одобренное повышение лимита счёта с самым поздним сроком
+func (s *InMemoryStorage) ActiveLimitOverride(ctx context.Context, accountID string, now time.Time) (LimitOverride, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found LimitOverride
+	ok := false
+	for _, o := range s.limitOverrides {
+		if o.AccountID == accountID && o.ActiveAt(now) && (!ok || o.ExpiresAt.After(*found.ExpiresAt)) {
+			found, ok = o, true
+		}
+	}
+	return found, ok
+}
+
+// AddBroadcast ставит рассылку в очередь вместе со списком получателей; счётчики считаются здесь
+// GetUserSettings возвращает сохранённые настройки или настройки по умолчанию
+func (s *InMemoryStorage) GetUserSettings(ctx context.Context, userID string) UserSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if settings, ok := s.userSettings[userID]; ok {
+		return settings
+	}
+	return UserSettings{UserID: userID, DigestFrequency: DigestOff}
+}
+
+func (s *InMemoryStorage) SaveUserSettings(ctx context.Context, settings UserSettings) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[settings.UserID]; !ok {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", settings.UserID)
+	}
+	s.userSettings[settings.UserID] = settings
+	return nil
+}
+
+// ListDigestSubscribers — настройки пользователей, включивших дайджест
+func (s *InMemoryStorage) ListDigestSubscribers(ctx context.Context) []UserSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]UserSettings, 0)
+	for _, settings := range s.userSettings {
+		if settings.DigestFrequency != DigestOff {
+			list = append(list, settings)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UserID < list[j].UserID })
+	return list
+}
+
+func (s *InMemoryStorage) MarkDigestSent(ctx context.Context, userID string, sentAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if settings, ok := s.userSettings[userID]; ok {
+		settings.DigestLastSentAt = &sentAt
+		s.userSettings[userID] = settings
+	}
+}
+
+func (s *InMemoryStorage) AddBroadcast(ctx context.Context, b Broadcast, recipients []BroadcastRecipient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.broadcasts[b.ID]; exists {
+		return conflictf("broadcast %s already exists", b.ID)
+	}
+	queue := make([]BroadcastRecipient, len(recipients))
+	b.Total, b.Sent, b.Failed, b.Skipped = len(recipients), 0, 0, 0
+	for i, r := range recipients {
+		r.BroadcastID = b.ID
+		if r.Status == "" {
+			r.Status = RecipientPending
+		}
+		if r.Status == RecipientSkipped {
+			b.Skipped++
+		}
+		queue[i] = r
+	}
+	b.Status = BroadcastQueued
+	if b.Skipped == b.Total {
+		b.Status = BroadcastCompleted
+		completed := b.CreatedAt
+		b.CompletedAt = &completed
+	}
+	s.broadcasts[b.ID] = b
+	s.broadcastQueue[b.ID] = queue
+	return nil
+}
+
+func (s *InMemoryStorage) GetBroadcast(ctx context.Context, id string) (Broadcast, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.broadcasts[id]
+	return b, ok
+}
+
+// ListBroadcasts возвращает рассылки, новые первыми
+func (s *InMemoryStorage) ListBroadcasts(ctx context.Context) []Broadcast {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Broadcast, 0, len(s.broadcasts))
+	for _, b := range s.broadcasts {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// GetBroadcastRecipients возвращает получателей рассылки с фильтром по статусу (пустой — любой)
+func (s *InMemoryStorage) GetBroadcastRecipients(ctx context.Context, id, status string) ([]BroadcastRecipient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	queue, ok := s.broadcastQueue[id]
+	if !ok {
+		return nil, notFoundf("broadcast %s not found", id)
+	}
+	result := make([]BroadcastRecipient, 0, len(queue))
+	for _, r := range queue {
+		if status == "" || r.Status == status {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// NextBroadcastRecipients выбирает до limit получателей, готовых к отправке, начиная со старых рассылок
+func (s *InMemoryStorage) NextBroadcastRecipients(ctx context.Context, limit int, now time.Time) []BroadcastRecipient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pending := make([]Broadcast, 0)
+	for _, b := range s.broadcasts {
+		if b.Status != BroadcastCompleted {
+			pending = append(pending, b)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+
+	result := make([]BroadcastRecipient, 0, limit)
+	for _, b := range pending {
+		for _, r := range s.broadcastQueue[b.ID] {
+			if len(result) >= limit {
+				return result
+			}
+			if r.Status == RecipientPending && !r.NextAttemptAt.After(now) {
+				result = append(result, r)
+			}
+		}
+	}
+	return result
+}
+
+// RecordBroadcastDelivery фиксирует попытку отправки: sendErr == nil — доставлено, иначе повтор через retryAfter,
+// пока не исчерпаны maxAttempts. Рассылка завершается, когда в очереди не осталось ожидающих получателей.
+func (s *InMemoryStorage) RecordBroadcastDelivery(ctx context.Context, broadcastID, userID string, sendErr error, maxAttempts int, retryAfter time.Duration, now time.Time) (Broadcast, error) {
+	if err := ctx.Err(); err != nil {
+		return Broadcast{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.broadcasts[broadcastID]
+	if !ok {
+		return Broadcast{}, notFoundf("broadcast %s not found", broadcastID)
+	}
+	queue := s.broadcastQueue[broadcastID]
+	idx := -1
+	for i := range queue {
+		if queue[i].UserID == userID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return Broadcast{}, notFoundf("recipient %s not found in broadcast %s", userID, broadcastID)
+	}
+	r := &queue[idx]
+	if r.Status != RecipientPending {
+		return b, conflictf("recipient %s of broadcast %s is already %s", userID, broadcastID, r.Status)
+	}
+
+	r.Attempts++
+	if sendErr == nil {
+		r.Status = RecipientSent
+		r.LastError = ""
+		sentAt := now
+		r.SentAt = &sentAt
+		b.Sent++
+	} else {
+		r.LastError = sendErr.Error()
+		r.NextAttemptAt = now.Add(retryAfter)
+		if r.Attempts >= maxAttempts {
+			r.Status = RecipientFailed
+			b.Failed++
+		}
+	}
+
+	b.Status = BroadcastSending
+	if b.Sent+b.Failed+b.Skipped >= b.Total {
+		b.Status = BroadcastCompleted
+		completed := now
+		b.CompletedAt = &completed
+	}
+	s.broadcasts[broadcastID] = b
+	return b, nil
+}
+
+func (s *InMemoryStorage) AddDeviceKey(ctx context.Context, key DeviceKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[key.UserID]; !ok {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", key.UserID)
+	}
+	for _, existing := range s.deviceKeys {
+		if existing.Active() && existing.PublicKey == key.PublicKey {
+			return conflictf("device key is already registered")
+		}
+	}
+	s.deviceKeys[key.ID] = key
+	return nil
+}
+
+func (s *InMemoryStorage) GetDeviceKey(ctx context.Context, keyID string) (DeviceKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.deviceKeys[keyID]
+	return key, ok
+}
+
+// ListDeviceKeys — ключи пользователя, включая отозванные, в порядке регистрации
+func (s *InMemoryStorage) ListDeviceKeys(ctx context.Context, userID string) []DeviceKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]DeviceKey, 0)
+	for _, key := range s.deviceKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+func (s *InMemoryStorage) RevokeDeviceKey(ctx context.Context, userID, keyID string, now time.Time) (DeviceKey, error) {
+	if err := ctx.Err(); err != nil {
+		return DeviceKey{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.deviceKeys[keyID]
+	if !ok || key.UserID != userID {
+		return DeviceKey{}, notFoundf("device key %s not found", keyID)
+	}
+	if !key.Active() {
+		return DeviceKey{}, conflictf("device key %s is already revoked", keyID)
+	}
+	key.RevokedAt = &now
+	s.deviceKeys[keyID] = key
+	return key, nil
+}
+
+func (s *InMemoryStorage) TouchDeviceKey(ctx context.Context, keyID string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.deviceKeys[keyID]; ok {
+		key.LastUsedAt = &now
+		s.deviceKeys[keyID] = key
+	}
+}
+
+// RememberSignature возвращает false, если подпись уже встречалась в окне; старые записи вычищаются
+func (s *InMemoryStorage) RememberSignature(ctx context.Context, key string, at time.Time, window time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, seenAt := range s.seenSignatures {
+		if at.Sub(seenAt) > window {
+			delete(s.seenSignatures, k)
+		}
+	}
+	if _, seen := s.seenSignatures[key]; seen {
+		return false
+	}
+	s.seenSignatures[key] = at
+	return true
+}
+
+func (s *InMemoryStorage) SaveOperation(ctx context.Context, op Operation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[op.ID] = op
+}
+
+func (s *InMemoryStorage) GetOperation(ctx context.Context, operationID string) (Operation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	op, ok := s.operations[operationID]
+	return op, ok
+}
+
+func (s *InMemoryStorage) AddWebhook(ctx context.Context, hook Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[hook.UserID]; !exists {
+		return notFoundCodef(CodeUserNotFound, "user %s not found", hook.UserID)
+	}
+	s.webhooks[hook.ID] = hook
+	return nil
+}
+
+func (s *InMemoryStorage) GetWebhook(ctx context.Context, webhookID string) (Webhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hook, ok := s.webhooks[webhookID]
+	return hook, ok
+}
+
+func (s *InMemoryStorage) GetUserWebhooks(ctx context.Context, userID string) []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var hooks []Webhook
+	for _, hook := range s.webhooks {
+		if hook.UserID == userID {
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks
+}
+
+func (s *InMemoryStorage) DeleteWebhook(ctx context.Context, webhookID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[webhookID]; !ok {
+		return notFoundf("webhook %s not found", webhookID)
+	}
+	delete(s.webhooks, webhookID)
+	return nil
+}
+
+func (s *InMemoryStorage) CreateHold(ctx context.Context, hold Hold) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createHold(hold)
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) createHold(hold Hold) error {
+	acc, ok := s.accounts[hold.AccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", hold.AccountID)
+	}
+	if acc.IsClosed() {
+		return accountClosedError(hold.AccountID)
+	}
+	if acc.AvailableBalance.LessThan(hold.Amount) {
+		return &StorageError{Kind: ErrInsufficientFunds, Message: "insufficient available funds for authorization"}
+	}
+	acc.HeldAmount = acc.HeldAmount.Add(hold.Amount)
+	acc.refreshAvailable()
+	if err := s.casAccounts(&acc); err != nil {
+		return err
+	}
+	s.holds[hold.ID] = hold
+	return nil
+}
+
+func (s *InMemoryStorage) GetHold(ctx context.Context, holdID string) (Hold, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hold, ok := s.holds[holdID]
+	return hold, ok
+}
+
+// CaptureHold списывает сумму (не больше авторизованной) и снимает холд целиком
+func (s *InMemoryStorage) CaptureHold(ctx context.Context, holdID string, amount decimal.Decimal, tx Transaction, now time.Time) (Hold, error) {
+	if err := ctx.Err(); err != nil {
+		return Hold{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hold, ok := s.holds[holdID]
+	if !ok {
+		return Hold{}, notFoundf("authorization %s not found", holdID)
+	}
+	if err := s.captureHold(&hold, amount, tx, now); err != nil {
+		return Hold{}, err
+	}
+	return hold, nil
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) captureHold(hold *Hold, amount decimal.Decimal, tx Transaction, now time.Time) error {
+	if hold.Status != HoldActive {
+		return conflictf("authorization %s is %s", hold.ID, hold.Status)
+	}
+	if amount.GreaterThan(hold.Amount) {
+		return &StorageError{Kind: ErrInvalidInput, Message: "capture amount exceeds authorized amount"}
+	}
+	acc, ok := s.accounts[hold.AccountID]
+	if !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", hold.AccountID)
+	}
+	var settlement Account
+	if tx.ToAccountID != "" {
+		if settlement, ok = s.accounts[tx.ToAccountID]; !ok {
+			return notFoundCodef(CodeAccountNotFound, "settlement account %s not found", tx.ToAccountID)
+		}
+		if settlement.IsClosed() {
+			return accountClosedError(settlement.ID)
+		}
+	}
+
+	acc.HeldAmount = acc.HeldAmount.Sub(hold.Amount)
+	acc.Balance = acc.Balance.Sub(amount)
+	acc.refreshAvailable()
+	changed := []*Account{&acc}
+	if settlement.ID != "" {
+		settlement.Balance = settlement.Balance.Add(amount)
+		settlement.refreshAvailable()
+		changed = append(changed, &settlement)
+	}
+	if err := s.casAccounts(changed...); err != nil {
+		return err
+	}
+	s.adjustSummaryBalance(acc.UserID, amount.Neg())
+	if settlement.ID != "" {
+		s.adjustSummaryBalance(settlement.UserID, amount)
+	}
+	s.appendTransaction(tx)
+
+	hold.Status = HoldCaptured
+	hold.CapturedAmt = amount
+	hold.CaptureTxID = tx.ID
+	hold.ClosedAt = &now
+	s.holds[hold.ID] = *hold
+	return nil
+}
+
+func (s *InMemoryStorage) ReleaseHold(ctx context.Context, holdID, status string, now time.Time) (Hold, error) {
+	if err := ctx.Err(); err != nil {
+		return Hold{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hold, ok := s.holds[holdID]
+	if !ok {
+		return Hold{}, notFoundf("authorization %s not found", holdID)
+	}
+	if hold.Status != HoldActive {
+		return Hold{}, conflictf("authorization %s is %s", holdID, hold.Status)
+	}
+	s.releaseHold(&hold, status, now)
+	return hold, nil
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) releaseHold(hold *Hold, status string, now time.Time) {
+	if acc, ok := s.accounts[hold.AccountID]; ok {
+		acc.HeldAmount = acc.HeldAmount.Sub(hold.Amount)
+		acc.refreshAvailable()
+		s.putAccount(&acc)
+	}
+	hold.Status = status
+	hold.ClosedAt = &now
+	s.holds[hold.ID] = *hold
+}
+
+func (s *InMemoryStorage) ExpireHolds(ctx context.Context, now time.Time) []Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []Hold
+	for _, hold := range s.holds {
+		if hold.Status == HoldActive && now.After(hold.ExpiresAt) {
+			s.releaseHold(&hold, HoldExpired, now)
+			expired = append(expired, hold)
+		}
+	}
+	return expired
+}
+
+// AddPaymentChallenge блокирует сумму оплаты холдом и сохраняет ожидающее подтверждение одной операцией
+func (s *InMemoryStorage) AddPaymentChallenge(ctx context.Context, c PaymentChallenge, hold Hold) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.createHold(hold); err != nil {
+		return err
+	}
+	c.HoldID = hold.ID
+	s.challenges[c.ID] = c
+	return nil
+}
+
+func (s *InMemoryStorage) GetPaymentChallenge(ctx context.Context, id string) (PaymentChallenge, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.challenges[id]
+	return c, ok
+}
+
+// UpdatePaymentChallenge применяет update к ожидающей оплате; изменения сохраняются и при ошибке update
+// (так учитываются неверные коды). Если update закрыл оплату, холд снимается.
+func (s *InMemoryStorage) UpdatePaymentChallenge(ctx context.Context, id string, update func(*PaymentChallenge) error, now time.Time) (PaymentChallenge, error) {
+	if err := ctx.Err(); err != nil {
+		return PaymentChallenge{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[id]
+	if !ok {
+		return PaymentChallenge{}, notFoundf("payment %s not found", id)
+	}
+	if c.Status != PaymentChallengePending {
+		return PaymentChallenge{}, conflictf("payment %s is %s", id, c.Status)
+	}
+	err := update(&c)
+	if c.Status != PaymentChallengePending {
+		s.closePaymentChallenge(&c, now)
+	}
+	s.challenges[id] = c
+	return c, err
+}
+
+// CompletePaymentChallenge проводит подтверждённую оплату списанием холда
+func (s *InMemoryStorage) CompletePaymentChallenge(ctx context.Context, id string, now time.Time) (PaymentChallenge, error) {
+	if err := ctx.Err(); err != nil {
+		return PaymentChallenge{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[id]
+	if !ok {
+		return PaymentChallenge{}, notFoundf("payment %s not found", id)
+	}
+	if c.Status != PaymentChallengePending {
+		return PaymentChallenge{}, conflictf("payment %s is %s", id, c.Status)
+	}
+	hold, ok := s.holds[c.HoldID]
+	if !ok {
+		return PaymentChallenge{}, notFoundf("authorization %s not found", c.HoldID)
+	}
+	tx := c.Payment
+	tx.Timestamp = now
+	if err := s.captureHold(&hold, c.Amount, tx, now); err != nil {
+		return PaymentChallenge{}, err
+	}
+	c.Status = PaymentChallengeConfirmed
+	c.TransactionID = tx.ID
+	c.ClosedAt = &now
+	s.challenges[id] = c
+	return c, nil
+}
+
+// ExpirePaymentChallenges закрывает неподтверждённые в срок оплаты и снимает их холды
+func (s *InMemoryStorage) ExpirePaymentChallenges(ctx context.Context, now time.Time) []PaymentChallenge {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []PaymentChallenge
+	for id, c := range s.challenges {
+		if c.Status == PaymentChallengePending && now.After(c.ExpiresAt) {
+			c.Status = PaymentChallengeExpired
+			s.closePaymentChallenge(&c, now)
+			s.challenges[id] = c
+			expired = append(expired, c)
+		}
+	}
+	return expired
+}
+
+// Вызывающий должен удерживать s.mu
+func (s *InMemoryStorage) closePaymentChallenge(c *PaymentChallenge, now time.Time) {
+	if hold, ok := s.holds[c.HoldID]; ok && hold.Status == HoldActive {
+		s.releaseHold(&hold, HoldReleased, now)
+	}
+	c.ClosedAt = &now
+}
+
+func (s *InMemoryStorage) AddAuditEntry(ctx context.Context, entry AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditLog = append(s.auditLog, entry)
+}
+
+func (s *InMemoryStorage) GetAuditLog(ctx context.Context, action string) []AuditEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]AuditEntry, 0)
+	for _, e := range s.auditLog {
+		if action == "" || e.Action == action {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (s *InMemoryStorage) AddSecurityEvent(ctx context.Context, event SecurityEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.securityEvents[event.UserID] = append(s.securityEvents[event.UserID], event)
+}
+
+// GetSecurityEvents возвращает события пользователя за период, новые первыми
+func (s *InMemoryStorage) GetSecurityEvents(ctx context.Context, userID string, from, to time.Time, eventType string) []SecurityEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := s.securityEvents[userID]
+	events := make([]SecurityEvent, 0)
+	for i := len(all) - 1; i >= 0; i-- {
+		e := all[i]
+		if e.Timestamp.Before(from) || e.Timestamp.After(to) || (eventType != "" && e.Type != eventType) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func (s *InMemoryStorage) GetDependents(ctx context.Context, parentID string) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.dependentIndex[parentID]
+	users := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := s.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func (s *InMemoryStorage) SetParentalControl(ctx context.Context, control ParentalControl) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[control.AccountID]; !ok {
+		return notFoundCodef(CodeAccountNotFound, "account %s not found", control.AccountID)
+	}
+	s.parentalControls[control.AccountID] = control
+	return nil
+}
+
+func (s *InMemoryStorage) GetParentalControl(ctx context.Context, accountID string) (ParentalControl, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	control, ok := s.parentalControls[accountID]
+	return control, ok
+}
+
+func (s *InMemoryStorage) AddRateOverride(ctx context.Context, o RateOverride) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if o.Kind != RateKindKeyRate && o.Kind != RateKindFX {
+		return &StorageError{Kind: ErrInvalidInput, Message: fmt.Sprintf("unknown rate kind %q", o.Kind)}
+	}
+	if o.Kind == RateKindFX {
+		o.Currency = strings.ToUpper(o.Currency)
+		if o.Currency == "" || o.Currency == BaseCurrency {
+			return &StorageError{Kind: ErrInvalidInput, Message: "FX override requires a non-base currency"}
+		}
+	}
+	if !o.Rate.IsPositive() {
+		return &StorageError{Kind: ErrInvalidInput, Message: "rate must be positive"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateOverrides[o.ID] = o
+	return nil
+}
+
+func (s *InMemoryStorage) DeleteRateOverride(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rateOverrides[id]; !ok {
+		return notFoundf("rate override %s not found", id)
+	}
+	delete(s.rateOverrides, id)
+	return nil
+}
+
+// ListRateOverrides возвращает overrides в порядке вступления в силу
+func (s *InMemoryStorage) ListRateOverrides(ctx context.Context) []RateOverride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]RateOverride, 0, len(s.rateOverrides))
+	for _, o := range s.rateOverrides {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].EffectiveFrom.Equal(list[j].EffectiveFrom) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].EffectiveFrom.Before(list[j].EffectiveFrom)
+	})
+	return list
+}
+
+func rateHistoryKey(kind, currency string) string {
+	return kind + ":" + currency
+}
+
+// SaveRateSnapshots сохраняет значения ставок; повторное значение на ту же дату заменяет прежнее
+func (s *InMemoryStorage) SaveRateSnapshots(ctx context.Context, snapshots []RateSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, snap := range snapshots {
+		key := rateHistoryKey(snap.Kind, snap.Currency)
+		history := s.rateHistory[key]
+		i := sort.Search(len(history), func(i int) bool { return history[i].Date >= snap.Date })
+		if i < len(history) && history[i].Date == snap.Date {
+			history[i] = snap
+			continue
+		}
+		history = append(history, RateSnapshot{})
+		copy(history[i+1:], history[i:])
+		history[i] = snap
+		s.rateHistory[key] = history
+	}
+	return nil
+}
+
+// RateHistory — значения ставки за даты from..to включительно (YYYY-MM-DD) в хронологическом порядке
+func (s *InMemoryStorage) RateHistory(ctx context.Context, kind, currency, from, to string) []RateSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := s.rateHistory[rateHistoryKey(kind, currency)]
+	start := sort.Search(len(history), func(i int) bool { return history[i].Date >= from })
+	end := sort.Search(len(history), func(i int) bool { return history[i].Date > to })
+	if end < start {
+		return []RateSnapshot{}
+	}
+	result := make([]RateSnapshot, end-start)
+	copy(result, history[start:end])
+	return result
+}
+
+func (s *InMemoryStorage) AddEmailNotification(ctx context.Context, n EmailNotification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emailQueue[n.ID] = n
+	return nil
+}
+
+// ClaimEmailNotifications выбирает до limit писем, чей срок отправки наступил, и откладывает их на lease,
+// чтобы параллельный проход не отправил их повторно; если отправитель упадёт, письмо вернётся в очередь после lease
+func (s *InMemoryStorage) ClaimEmailNotifications(ctx context.Context, limit int, lease time.Duration, now time.Time) []EmailNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := make([]EmailNotification, 0)
+	for _, n := range s.emailQueue {
+		if n.Status == NotificationPending && !n.NextAttemptAt.After(now) {
+			due = append(due, n)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].NextAttemptAt = now.Add(lease)
+		s.emailQueue[due[i].ID] = due[i]
+	}
+	return due
+}
+
+// RecordEmailAttempt фиксирует попытку отправки: sendErr == nil — письмо доставлено и покидает очередь,
+// иначе повтор в retryAt, а после maxAttempts неудач письмо переходит в dead-letter
+func (s *InMemoryStorage) RecordEmailAttempt(ctx context.Context, id string, sendErr error, maxAttempts int, retryAt, now time.Time) (EmailNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.emailQueue[id]
+	if !ok {
+		return EmailNotification{}, notFoundf("notification %s not found", id)
+	}
+	if n.Status != NotificationPending {
+		return n, conflictf("notification %s is %s", id, n.Status)
+	}
+	n.Attempts++
+	n.UpdatedAt = now
+	if sendErr == nil {
+		n.Status = NotificationSent
+		n.LastError = ""
+		sentAt := now
+		n.SentAt = &sentAt
+		delete(s.emailQueue, id)
+		return n, nil
+	}
+	n.LastError = sendErr.Error()
+	n.NextAttemptAt = retryAt
+	if n.Attempts >= maxAttempts {
+		n.Status = NotificationDead
+	}
+	s.emailQueue[id] = n
+	return n, nil
+}
+
+// ListEmailNotifications — письма в очереди, новые сверху; status сужает выборку
+func (s *InMemoryStorage) ListEmailNotifications(ctx context.Context, status string) []EmailNotification {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]EmailNotification, 0)
+	for _, n := range s.emailQueue {
+		if status == "" || n.Status == status {
+			result = append(result, n)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// RequeueEmailNotification возвращает письмо из dead-letter в очередь с новым счётчиком попыток
+func (s *InMemoryStorage) RequeueEmailNotification(ctx context.Context, id string, now time.Time) (EmailNotification, error) {
+	if err := ctx.Err(); err != nil {
+		return EmailNotification{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.emailQueue[id]
+	if !ok {
+		return EmailNotification{}, notFoundf("notification %s not found", id)
+	}
+	if n.Status != NotificationDead {
+		return EmailNotification{}, conflictf("notification %s is %s, only dead notifications can be requeued", id, n.Status)
+	}
+	n.Status = NotificationPending
+	n.Attempts = 0
+	n.NextAttemptAt = now
+	n.UpdatedAt = now
+	s.emailQueue[id] = n
+	return n, nil
+}
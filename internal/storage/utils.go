@@ -1,9 +1,11 @@
-package main
+package storage
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,11 +16,56 @@ func GenerateID() string {
 	return uuid.NewString()
 }
 
+func GenerateToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func GenerateAccountNumber() string {
 	n, _ := rand.Int(rand.Reader, big.NewInt(9000000000))
 	return fmt.Sprintf("40817810%010d", n.Int64()+1000000000)
 }
 
+func ValidateAccountNumber(number string) error {
+	if len(number) != 20 {
+		return fmt.Errorf("account number must contain 20 digits")
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("account number must contain only digits")
+		}
+	}
+	return nil
+}
+
+// MaskName оставляет первую букву каждого слова: "ivan petrov" -> "i*** p*****"
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, w := range words {
+		runes := []rune(w)
+		words[i] = string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	}
+	return strings.Join(words, " ")
+}
+
+// MaskPAN оставляет видимыми только последние 4 цифры: "4123456789012345" -> "**** **** **** 2345"
+func MaskPAN(number string) string {
+	if len(number) < 4 {
+		return number
+	}
+	return "**** **** **** " + number[len(number)-4:]
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
 func GenerateCardNumber() string {
 	n1, _ := rand.Int(rand.Reader, big.NewInt(9000))
 	n2, _ := rand.Int(rand.Reader, big.NewInt(10000))
@@ -32,6 +79,25 @@ func GenerateCVV() string {
 	return fmt.Sprintf("%03d", n.Int64()+100)
 }
 
+func GenerateVerificationCode() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(1000000))
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+func NewCard(accountID string) Card {
+	month, year := GenerateExpiryDate()
+	return Card{
+		ID:          GenerateID(),
+		AccountID:   accountID,
+		Number:      GenerateCardNumber(),
+		ExpiryMonth: month,
+		ExpiryYear:  year,
+		CVV:         GenerateCVV(),
+		Status:      CardStatusActive,
+		CreatedAt:   time.Now(),
+	}
+}
+
 func GenerateExpiryDate() (int, int) {
 	now := time.Now()
 	year := now.Year() + 4
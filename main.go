@@ -1,60 +1,88 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/mux"
+	httpapi "bankapp/internal/http"
+	"bankapp/internal/service"
+	"bankapp/internal/storage"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	// Отменяется по SIGINT/SIGTERM: фоновые задачи завершаются, сервер дожидается текущих запросов
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
 	log.Println("Starting Simple Bank API...")
 
-	InitStorage()
+	events := service.NewEventBus()
+	store := storage.NewInMemoryStorage(events)
 	log.Println("In-memory storage initialized.")
 
-	r := mux.NewRouter()
-
-	r.HandleFunc("/register", RegisterUserHandler).Methods("POST")
-	r.HandleFunc("/login", LoginUserHandler).Methods("POST")
-
-	r.HandleFunc("/accounts", CreateAccountHandler).Methods("POST")
-	r.HandleFunc("/users/{userId}/accounts", GetUserAccountsHandler).Methods("GET")
-
-	r.HandleFunc("/cards", GenerateCardHandler).Methods("POST")
-	r.HandleFunc("/accounts/{accountId}/cards", GetAccountCardsHandler).Methods("GET")
-	r.HandleFunc("/payments/card", PayWithCardHandler).Methods("POST")
+	svc := service.New(storage.NewCachedRepository(store, store), events)
 
-	r.HandleFunc("/transfers", TransferHandler).Methods("POST")
-	r.HandleFunc("/deposits", DepositHandler).Methods("POST")
+	// bankapp generate [флаги] — заполнить хранилище нагрузочными данными перед запуском сервера
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		if !generateStressData(ctx, svc, os.Args[2:]) {
+			return
+		}
+	}
 
-	r.HandleFunc("/loans", ApplyLoanHandler).Methods("POST")
-	r.HandleFunc("/loans/{loanId}/schedule", GetLoanScheduleHandler).Methods("GET")
+	svc.StartBackgroundJobs(ctx)
 
-	r.HandleFunc("/analytics/transactions/{accountId}", GetTransactionsHandler).Methods("GET")
-	r.HandleFunc("/analytics/summary/{userId}", GetFinancialSummaryHandler).Methods("GET")
+	handler := httpapi.NewHandler(svc)
 
 	port := "8080"
 	log.Printf("Server starting on port %s", port)
 
-	loggedRouter := loggingMiddleware(r)
-
-	err := http.ListenAndServe(":"+port, loggedRouter)
-	if err != nil {
+	server := &http.Server{Addr: ":" + port, Handler: handler.Routes()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Graceful shutdown failed: %v", err)
+		}
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+	log.Println("Server stopped")
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("--> %s %s %s", r.Method, r.RequestURI, r.Proto)
-		next.ServeHTTP(w, r)
-		log.Printf("<-- %s %s (%v)", r.Method, r.RequestURI, time.Since(start))
-	})
+// generateStressData разбирает флаги подкоманды generate и заполняет хранилище; false — сервер запускать не нужно
+func generateStressData(ctx context.Context, svc *service.Service, args []string) bool {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	cfg := service.StressConfig{}
+	fs.IntVar(&cfg.Users, "users", 1000, "number of users, one account each")
+	fs.IntVar(&cfg.Cards, "cards", 1, "cards per account")
+	fs.IntVar(&cfg.Transactions, "transactions", 1000000, "number of transactions")
+	fs.IntVar(&cfg.Days, "days", 365, "history depth in days")
+	fs.Int64Var(&cfg.Seed, "seed", 1, "random seed")
+	fs.IntVar(&cfg.BatchSize, "batch", 10000, "transactions written per storage lock")
+	exit := fs.Bool("exit", false, "print the report and exit instead of serving the data")
+	fs.Parse(args)
+
+	report, err := svc.GenerateStressData(ctx, cfg, time.Now())
+	if err != nil {
+		log.Fatalf("Stress data generation failed: %v", err)
+	}
+	log.Printf("Stress data: %d users, %d transactions from %s to %s in %s (%.0f tx/s)",
+		report.Users, report.Transactions, report.From.Format("2006-01-02"), report.To.Format("2006-01-02"),
+		report.Elapsed.Round(time.Millisecond), float64(report.Transactions)/report.Elapsed.Seconds())
+	return !*exit
 }